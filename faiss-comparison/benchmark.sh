@@ -197,20 +197,20 @@ for SCALE in "${SCALES[@]}"; do
     echo -e "${CYAN}  Searching $SEARCH_QUERIES queries...${NC}"
     search_times=()
 
-    # Capture timing from one sample search
-    sample_output=$(./hippocampus search -binary "$HIPPO_DB" \
+    # Capture timing from one sample search (-stats writes one JSON line to stderr)
+    stats_line=$(./hippocampus search -binary "$HIPPO_DB" \
         -region ap-southeast-2 \
         -text "test query" \
         -epsilon 0.3 \
         -threshold 0.5 \
-        -top-k 5 2>&1)
+        -top-k 5 \
+        -stats 2>&1 >/dev/null | grep '^{"operation"')
 
     # Extract timing data
-    if echo "$sample_output" | grep -q "TIMING:"; then
-        timing_line=$(echo "$sample_output" | grep "TIMING:")
-        hippo_embed=$(echo "$timing_line" | sed -n 's/.*EMBED:\([0-9.]*\).*/\1/p')
-        hippo_load=$(echo "$timing_line" | sed -n 's/.*LOAD:\([0-9.]*\).*/\1/p')
-        hippo_pure_search=$(echo "$timing_line" | sed -n 's/.*SEARCH:\([0-9.]*\).*/\1/p')
+    if [ -n "$stats_line" ]; then
+        hippo_embed=$(echo "$stats_line" | sed -n 's/.*"embed_ms":\([0-9.e+-]*\).*/\1/p')
+        hippo_load=$(echo "$stats_line" | sed -n 's/.*"load_ms":\([0-9.e+-]*\).*/\1/p')
+        hippo_pure_search=$(echo "$stats_line" | sed -n 's/.*"search_ms":\([0-9.e+-]*\).*/\1/p')
         echo -e "  ${CYAN}Timing breakdown: Embed=${hippo_embed}ms, Load=${hippo_load}ms, Search=${hippo_pure_search}ms${NC}"
     fi
 
@@ -0,0 +1,49 @@
+package langchaingo_test
+
+import (
+	"Hippocampus/integrations/langchaingo"
+	"Hippocampus/src/client"
+	"Hippocampus/src/embedding"
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/tmc/langchaingo/schema"
+	"github.com/tmc/langchaingo/vectorstores"
+)
+
+func Example() {
+	ctx := context.Background()
+
+	c, err := client.NewInMemory(512)
+	if err != nil {
+		log.Fatal(err)
+	}
+	c.Embedder = embedding.NewHashingProvider(512, 1)
+	c.SetVerbose(false)
+	defer c.Close()
+
+	store := langchaingo.New(c)
+	_, err = store.AddDocuments(ctx, []schema.Document{
+		{PageContent: "the cat sat on the mat", Metadata: map[string]any{"topic": "pets", "page": 1}},
+		{PageContent: "a cat chased the mouse", Metadata: map[string]any{"topic": "pets", "page": 2}},
+		{PageContent: "interest rates rose again", Metadata: map[string]any{"topic": "finance", "page": 3}},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	docs, err := store.SimilaritySearch(ctx, "where the cat sat", 2,
+		vectorstores.WithScoreThreshold(0.2),
+		vectorstores.WithFilters(map[string]any{"topic": "pets"}))
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, doc := range docs {
+		// Non-string metadata comes back as its JSON
+		fmt.Printf("page %s: %s\n", doc.Metadata["page"], doc.PageContent)
+	}
+	// Output:
+	// page 1: the cat sat on the mat
+	// page 2: a cat chased the mouse
+}
@@ -0,0 +1,234 @@
+// Package langchaingo adapts a Hippocampus client to langchaingo's
+// vectorstores.VectorStore, so a RAG pipeline can use a local .bin database:
+//
+//	c, _ := client.New("memories.bin", "us-east-1")
+//	store := langchaingo.New(c)
+//	store.AddDocuments(ctx, docs)
+//	hits, _ := store.SimilaritySearch(ctx, "query", 4, vectorstores.WithScoreThreshold(0.7))
+//
+// It lives in its own module so the core packages never depend on
+// langchaingo. Embeddings come from the client's Embedder; point that at the
+// provider the pipeline would otherwise use (embedding.NewProvider).
+package langchaingo
+
+import (
+	"Hippocampus/src/client"
+	"Hippocampus/src/types"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/tmc/langchaingo/schema"
+	"github.com/tmc/langchaingo/vectorstores"
+)
+
+// Metadata keys the adapter writes next to the document's own metadata
+const (
+	IDKey        = "id"        // returned by AddDocuments; kept if the document sets it
+	NamespaceKey = "namespace" // set from vectorstores.WithNameSpace
+)
+
+// ErrEmbedderOption is returned for vectorstores.WithEmbedder: the client
+// embeds with its own provider so stored and query vectors always match
+var ErrEmbedderOption = errors.New("langchaingo: WithEmbedder is not supported, set the client's Embedder instead")
+
+// Store is a vectorstores.VectorStore backed by a Hippocampus client
+type Store struct {
+	client *client.Client
+
+	// Epsilon is the per-dimension search box used when no score threshold
+	// is given. The default of 2 holds every pair of unit vectors, so results
+	// are the exact nearest neighbours; lower it to trade recall for speed on
+	// a large database. With a threshold the box is derived from it instead,
+	// wide enough that nothing meeting the threshold is missed.
+	Epsilon float32
+}
+
+var _ vectorstores.VectorStore = (*Store)(nil)
+
+func New(c *client.Client) *Store {
+	return &Store{client: c, Epsilon: 2}
+}
+
+// AddDocuments stores each document's page content with its metadata and
+// returns their IDs. Metadata values that are not strings are stored as
+// JSON and come back from SimilaritySearch as strings.
+func (s *Store) AddDocuments(ctx context.Context, docs []schema.Document, options ...vectorstores.Option) ([]string, error) {
+	opts, err := parseOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(docs))
+	for i, doc := range docs {
+		if opts.Deduplicater != nil && opts.Deduplicater(ctx, doc) {
+			continue
+		}
+
+		metadata, err := toMetadata(doc.Metadata)
+		if err != nil {
+			return ids, fmt.Errorf("document %d: %w", i, err)
+		}
+		if metadata[IDKey] == "" {
+			metadata[IDKey] = newID()
+		}
+		if opts.NameSpace != "" {
+			metadata[NamespaceKey] = opts.NameSpace
+		}
+
+		if err := s.client.InsertWithMetadata(metadata[IDKey], doc.PageContent, metadata); err != nil {
+			return ids, fmt.Errorf("document %d: %w", i, err)
+		}
+		ids = append(ids, metadata[IDKey])
+	}
+
+	return ids, s.client.Flush()
+}
+
+// SimilaritySearch returns up to numDocuments documents ordered by
+// similarity, with Score set to the cosine similarity. Filters may be a
+// map[string]string or map[string]any and must match metadata exactly.
+func (s *Store) SimilaritySearch(ctx context.Context, query string, numDocuments int, options ...vectorstores.Option) ([]schema.Document, error) {
+	opts, err := parseOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := toFilter(opts.Filters)
+	if err != nil {
+		return nil, err
+	}
+	if opts.NameSpace != "" {
+		if filter == nil {
+			filter = &types.Filter{Metadata: map[string]string{}}
+		}
+		filter.Metadata[NamespaceKey] = opts.NameSpace
+	}
+
+	epsilon, searchOpts := s.searchParams(opts.ScoreThreshold)
+
+	// Filters are applied to the ranked hits, so fetch more until enough
+	// match or the database has nothing further to offer
+	fetch := numDocuments
+	if filter != nil {
+		fetch *= 4
+	}
+	for {
+		results, err := s.client.SearchWithOptions(query, epsilon, 0, fetch, searchOpts)
+		if err != nil {
+			return nil, err
+		}
+
+		docs := make([]schema.Document, 0, numDocuments)
+		for _, result := range results {
+			if len(docs) == numDocuments {
+				break
+			}
+			if !filter.Matches(&types.Node{Metadata: result.Metadata}) {
+				continue
+			}
+			docs = append(docs, toDocument(result))
+		}
+
+		if len(docs) == numDocuments || len(results) < fetch {
+			return docs, nil
+		}
+		fetch *= 4
+	}
+}
+
+// searchParams turns a langchain score threshold (a cosine similarity) into
+// the tree's distance cutoff. For unit vectors similarity = 1 - d²/2, so the
+// cutoff is sqrt(2(1 - threshold)); no coordinate of a vector within that
+// distance can differ by more, so it doubles as the epsilon box.
+func (s *Store) searchParams(scoreThreshold float32) (float32, types.SearchOptions) {
+	if scoreThreshold <= 0 {
+		return s.Epsilon, types.SearchOptions{MaxDistance: float32(math.Inf(1))}
+	}
+
+	maxDistance := float32(math.Sqrt(2 * float64(1-scoreThreshold)))
+	if maxDistance == 0 {
+		// A threshold of 1 accepts exact matches only; keep the cutoff positive
+		maxDistance = math.SmallestNonzeroFloat32
+	}
+	return maxDistance, types.SearchOptions{MaxDistance: maxDistance}
+}
+
+func parseOptions(options []vectorstores.Option) (vectorstores.Options, error) {
+	var opts vectorstores.Options
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	if opts.Embedder != nil {
+		return opts, ErrEmbedderOption
+	}
+	if opts.ScoreThreshold < 0 || opts.ScoreThreshold > 1 {
+		return opts, fmt.Errorf("langchaingo: score threshold must be in [0, 1], got %g", opts.ScoreThreshold)
+	}
+	return opts, nil
+}
+
+// toMetadata flattens langchain metadata into the string map a node stores
+func toMetadata(metadata map[string]any) (map[string]string, error) {
+	out := make(map[string]string, len(metadata)+2)
+	for k, v := range metadata {
+		value, err := metadataString(v)
+		if err != nil {
+			return nil, fmt.Errorf("metadata %q: %w", k, err)
+		}
+		out[k] = value
+	}
+	return out, nil
+}
+
+func metadataString(v any) (string, error) {
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	encoded, err := json.Marshal(v)
+	return string(encoded), err
+}
+
+func toFilter(filters any) (*types.Filter, error) {
+	switch f := filters.(type) {
+	case nil:
+		return nil, nil
+	case map[string]string:
+		metadata := make(map[string]string, len(f))
+		for k, v := range f {
+			metadata[k] = v
+		}
+		return &types.Filter{Metadata: metadata}, nil
+	case map[string]any:
+		metadata, err := toMetadata(f)
+		if err != nil {
+			return nil, err
+		}
+		return &types.Filter{Metadata: metadata}, nil
+	default:
+		return nil, fmt.Errorf("langchaingo: unsupported filter type %T, want map[string]string or map[string]any", filters)
+	}
+}
+
+func toDocument(result client.SearchResult) schema.Document {
+	metadata := make(map[string]any, len(result.Metadata))
+	for k, v := range result.Metadata {
+		metadata[k] = v
+	}
+	return schema.Document{
+		PageContent: result.Text,
+		Metadata:    metadata,
+		Score:       result.Similarity,
+	}
+}
+
+func newID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	hippotypes "Hippocampus/src/types"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// BatchTiming summarises a BatchSearch. Search is wall-clock time for the
+// whole batch; the percentiles are over individual queries, which overlap.
+type BatchTiming struct {
+	Queries int           `json:"queries"`
+	Results int           `json:"results"`
+	Load    time.Duration `json:"load"`
+	Search  time.Duration `json:"search"`
+	P50     time.Duration `json:"p50"`
+	P95     time.Duration `json:"p95"`
+	Max     time.Duration `json:"max"`
+}
+
+// QueriesPerSecond is the batch's throughput
+func (t BatchTiming) QueriesPerSecond() float64 {
+	if t.Search <= 0 {
+		return 0
+	}
+	return float64(t.Queries) / t.Search.Seconds()
+}
+
+// BatchSearch searches for many precomputed query embeddings at once, in
+// parallel over the shared tree (see Tree.BatchSearch). results[i] holds the
+// hits for queries[i]. The result cache is neither consulted nor filled.
+func (client *Client) BatchSearch(queries [][]float32, epsilon float32, threshold float32, topK int, opts hippotypes.SearchOptions) ([][]SearchResult, BatchTiming, error) {
+	timing := BatchTiming{Queries: len(queries)}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	loadStart := time.Now()
+	tree, err := client.getTree()
+	timing.Load = time.Since(loadStart)
+	if err != nil {
+		return nil, timing, fmt.Errorf("tree loading error: %w", err)
+	}
+
+	searchStart := time.Now()
+	scored, durations, err := tree.BatchSearchTimed(queries, epsilon, threshold, topK, opts)
+	timing.Search = time.Since(searchStart)
+	if err != nil {
+		return nil, timing, err
+	}
+
+	results := make([][]SearchResult, len(scored))
+	for i, hits := range scored {
+		results[i] = toSearchResults(hits)
+		timing.Results += len(hits)
+	}
+
+	if len(durations) > 0 {
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		timing.P50 = durations[(len(durations)-1)*50/100]
+		timing.P95 = durations[(len(durations)-1)*95/100]
+		timing.Max = durations[len(durations)-1]
+	}
+
+	return results, timing, nil
+}
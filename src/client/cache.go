@@ -0,0 +1,139 @@
+package client
+
+import (
+	hippotypes "Hippocampus/src/types"
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"time"
+)
+
+// resultCache remembers recent SearchWithOptions results, keyed by the
+// prepared query vector and every search parameter. Agent loops repeat the
+// same query often; a hit skips the tree search (the embedding is still
+// fetched, since that is what produces the key). Entries are dropped
+// wholesale whenever the tree changes. Guarded by Client.mu.
+type resultCache struct {
+	maxEntries int
+	ttl        time.Duration // 0 keeps entries until evicted or invalidated
+
+	entries map[cacheKey]*list.Element
+	order   *list.List // most recently used at the front
+}
+
+type cacheKey [sha256.Size]byte
+
+type cacheEntry struct {
+	key     cacheKey
+	stored  time.Time
+	results []SearchResult
+}
+
+func newResultCache(maxEntries int, ttl time.Duration) *resultCache {
+	return &resultCache{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		entries:    make(map[cacheKey]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// searchCacheKey hashes the query and parameters. ok is false for options
+// that cannot be encoded (NaN weights), which are simply not cached.
+func searchCacheKey(query [512]float32, opts hippotypes.SearchOptions) (key cacheKey, ok bool) {
+	// The JSON leaves out the limits, which change only whether the search
+	// is cut short, and truncated results are never cached. Epsilon,
+	// threshold and topK are in it.
+	encodedOpts, err := json.Marshal(opts)
+	if err != nil {
+		return key, false
+	}
+
+	h := sha256.New()
+	var buf [4]byte
+	for _, v := range query {
+		binary.LittleEndian.PutUint32(buf[:], math.Float32bits(v))
+		h.Write(buf[:])
+	}
+	h.Write(encodedOpts)
+
+	h.Sum(key[:0])
+	return key, true
+}
+
+// get returns a copy of the cached results, so callers may modify the
+// slice without corrupting later hits
+func (c *resultCache) get(key cacheKey) ([]SearchResult, bool) {
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if c.ttl > 0 && time.Since(entry.stored) > c.ttl {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+	return copyResults(entry.results), true
+}
+
+// put stores a copy of results, evicting the least recently used entry
+// when full
+func (c *resultCache) put(key cacheKey, results []SearchResult) {
+	entry := &cacheEntry{key: key, stored: time.Now(), results: copyResults(results)}
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *resultCache) clear() {
+	clear(c.entries)
+	c.order.Init()
+}
+
+func copyResults(results []SearchResult) []SearchResult {
+	if results == nil {
+		return nil
+	}
+	out := make([]SearchResult, len(results))
+	copy(out, results)
+	return out
+}
+
+// EnableResultCache keeps up to maxEntries recent search results in memory,
+// each for at most ttl (0 means until the tree changes). Any insert clears
+// the cache. maxEntries <= 0 turns caching off, which is the default.
+func (client *Client) EnableResultCache(maxEntries int, ttl time.Duration) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if maxEntries <= 0 {
+		client.resultCache = nil
+		return
+	}
+	client.resultCache = newResultCache(maxEntries, ttl)
+}
+
+// treeChanged bumps the tree generation and drops every cached result.
+// Call it under mu after any change to the tree's nodes.
+func (client *Client) treeChanged() {
+	client.generation++
+	if client.resultCache != nil {
+		client.resultCache.clear()
+	}
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	hippotypes "Hippocampus/src/types"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestResultCacheHitMissInvalidate(t *testing.T) {
+	c := newTestClient(t, filepath.Join(t.TempDir(), "tree.bin"))
+	c.EnableResultCache(10, 0)
+	if err := c.Insert("a", "alpha memory"); err != nil {
+		t.Fatal(err)
+	}
+
+	all := hippotypes.SearchOptions{Epsilon: 100, MaxDistance: 1000, TopK: 100}
+	search := func(opts hippotypes.SearchOptions) []string {
+		t.Helper()
+		results, _, err := c.SearchOpts("alpha memory", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := texts(results)
+		slices.Sort(found)
+		return found
+	}
+	first, _, err := c.SearchOpts("alpha memory", all)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first[0].Text = "modified by the caller"
+
+	// A node added behind the client's back doesn't clear the cache, so
+	// only a search the cache can't answer sees it
+	key, err := c.embed(t.Context(), "alpha memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := c.getTree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.Insert(key, "unseen"); err != nil {
+		t.Fatal(err)
+	}
+	if got := search(all); !slices.Equal(got, []string{"alpha memory"}) {
+		t.Errorf("repeated search found %v, want the cached result unmodified", got)
+	}
+	other := all
+	other.TopK = 99
+	if got := search(other); !slices.Equal(got, []string{"alpha memory", "unseen"}) {
+		t.Errorf("search with another topK found %v, want a fresh search", got)
+	}
+
+	if err := c.Insert("b", "beta memory"); err != nil {
+		t.Fatal(err)
+	}
+	if got := search(all); !slices.Equal(got, []string{"alpha memory", "beta memory", "unseen"}) {
+		t.Errorf("after an insert found %v, want the cache cleared", got)
+	}
+
+	if _, err := c.DeleteFunc(func(n *hippotypes.Node) bool { return n.Value == "unseen" }); err != nil {
+		t.Fatal(err)
+	}
+	if got := search(all); !slices.Equal(got, []string{"alpha memory", "beta memory"}) {
+		t.Errorf("after a delete found %v, want the cache cleared", got)
+	}
+}
+
+func TestResultCacheEvictsAndExpires(t *testing.T) {
+	results := func(text string) []SearchResult { return []SearchResult{{Text: text}} }
+
+	lru := newResultCache(2, 0)
+	lru.put(cacheKey{1}, results("one"))
+	lru.put(cacheKey{2}, results("two"))
+	lru.get(cacheKey{1})
+	lru.put(cacheKey{3}, results("three"))
+	if _, ok := lru.get(cacheKey{2}); ok {
+		t.Error("least recently used entry was kept past maxEntries")
+	}
+	for _, key := range []cacheKey{{1}, {3}} {
+		if _, ok := lru.get(key); !ok {
+			t.Errorf("entry %d was evicted", key[0])
+		}
+	}
+
+	ttl := newResultCache(2, time.Minute)
+	ttl.put(cacheKey{1}, results("stale"))
+	ttl.put(cacheKey{2}, results("fresh"))
+	ttl.entries[cacheKey{1}].Value.(*cacheEntry).stored = time.Now().Add(-time.Hour)
+	if _, ok := ttl.get(cacheKey{1}); ok {
+		t.Error("entry older than the TTL was returned")
+	}
+	if got, ok := ttl.get(cacheKey{2}); !ok || got[0].Text != "fresh" {
+		t.Errorf("entry within the TTL: %v, %v", got, ok)
+	}
+	if len(ttl.entries) != 1 {
+		t.Errorf("%d entries left, want the expired one dropped", len(ttl.entries))
+	}
+}
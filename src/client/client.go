@@ -2,15 +2,20 @@ package client
 
 import (
 	"Hippocampus/src/embedding"
+	"Hippocampus/src/metrics"
 	"Hippocampus/src/storage"
 	hippotypes "Hippocampus/src/types"
 	"context"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"maps"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -19,127 +24,795 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
 )
 
+// DefaultCSVBatchSize is how many rows InsertCSV embeds and inserts at once
+const DefaultCSVBatchSize = 1000
+
+// DefaultFlushEvery is how many nodes single inserts add between flushes
+// unless the client sets FlushEvery
+const DefaultFlushEvery = 100
+
+// DefaultMaxPayloadSize caps InsertWithPayload blobs unless the client overrides it
+const DefaultMaxPayloadSize = 64 << 10
+
+// DefaultMaxValueSize and DefaultMaxMetadataSize cap a node's text and its
+// metadata (keys plus values). Every Save and Load rewrites or rereads
+// every node, so one huge value slows the whole database down.
+const (
+	DefaultMaxValueSize    = 1 << 20
+	DefaultMaxMetadataSize = 64 << 10
+)
+
+var (
+	ErrPayloadTooLarge  = errors.New("payload too large")
+	ErrValueTooLarge    = errors.New("value too large")
+	ErrMetadataTooLarge = errors.New("metadata too large")
+)
+
 type Client struct {
-	Storage storage.FileStorage
+	Storage storage.Backend
 	Region string
 	AWS aws.Config
 	Bedrock *bedrockruntime.Client
-
-	// In-memory cache
+	Embedder embedding.EmbeddingProvider
+	Metrics metrics.Collector
+	MaxPayloadSize int // Bytes; 0 disables the check
+	MaxValueSize int // Bytes of node text; 0 disables the check
+	MaxMetadataSize int // Bytes of metadata keys and values; 0 disables the check
+	AsyncFlush bool // Flush in the background from a snapshot; see flush.go
+	FlushEvery int // Single inserts flush when the node count reaches a multiple of this; 0 means DefaultFlushEvery, negative leaves it to Flush and Close
+	Normalize bool // Create new databases with L2-normalized keys (see Tree.Normalize)
+	ZeroVectors hippotypes.ZeroVectorPolicy // What inserts do with all-zero keys
+	SanitizeVectors bool // Replace NaN and ±Inf embedding values with 0 instead of rejecting the insert
+	StrictConfig bool // Fail, rather than warn once, when the embedder differs from the one the database was created with (see config.go)
+	Retention *hippotypes.Retention // Caps the database's size, overriding the cap recorded in it; nil uses that one (see retention.go)
+	CSVTimestampColumn int // 0-based InsertCSV column holding each row's RFC 3339 timestamp; 0, the key column, means there is none
+
+	// In-memory cache, guarded by mu so one client can serve concurrent
+	// inserts, searches and flushes. Embedding happens outside the lock.
+	mu         sync.Mutex
 	cachedTree *hippotypes.Tree
 	dirty      bool
+	lastFlush  time.Time
+
+	// Background flush state, guarded by mu
+	flushing     bool
+	flushPending bool
+	flushDone    *sync.Cond
+	flushErr     error
 	verbose    bool
+	configWarned bool // checkConfig has logged a mismatch
+
+	// lastStats is what LastStats reports; written is the database size
+	// after the last synchronous flush. Both guarded by mu.
+	lastStats OperationStats
+	written   int64
+
+	// generation counts changes to the tree; resultCache (nil unless
+	// EnableResultCache is called) is cleared whenever it moves
+	generation  uint64
+	resultCache *resultCache
 }
 
 
-func New(binaryPath, region string) (c *Client, err error) {
-	ctx := context.Background()
+// New opens the database at binaryPath (a file, a sharded directory or an
+// s3:// URL), loading the AWS config for region and embedding with Titan
+func New(binaryPath, region string) (*Client, error) {
+	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("aws config error: %w", err)
+	}
+
+	backend := storage.Open(binaryPath)
+	if bucket, key, ok := storage.ParseS3URL(binaryPath); ok {
+		backend = storage.NewS3Backend(bucket, key, region, "")
+	}
 
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	c, err := NewFromConfig(backend, cfg, embedding.NewTitanClient(region, embedding.TitanModelID, embedding.TitanDimensions, true))
 	if err != nil {
-		log.Fatalf("aws config error: %v", err)
 		return nil, err
 	}
+	c.Bedrock = bedrockruntime.NewFromConfig(cfg)
+	return c, nil
+}
+
+// NewFromConfig is a client over backend that shares an AWS config and
+// embedder the caller already holds, as the Lambda manager does across
+// agents. Nothing is loaded or dialled, and Bedrock is left nil.
+func NewFromConfig(backend storage.Backend, cfg aws.Config, embedder embedding.EmbeddingProvider) (*Client, error) {
+	if backend == nil {
+		return nil, fmt.Errorf("a storage backend is required")
+	}
+	if embedder == nil {
+		return nil, fmt.Errorf("an embedding provider is required")
+	}
 
 	return &Client{
-		Storage: *storage.New(binaryPath),
-		Region: region,
+		Storage: backend,
+		Region: cfg.Region,
 		AWS: cfg,
-		Bedrock: bedrockruntime.NewFromConfig(cfg),
-		cachedTree: nil,
-		dirty: false,
+		Embedder: embedder,
+		Metrics: metrics.Noop{},
+		MaxPayloadSize: DefaultMaxPayloadSize,
+		MaxValueSize: DefaultMaxValueSize,
+		MaxMetadataSize: DefaultMaxMetadataSize,
 		verbose: true, // Can be set to false for benchmarks
 	}, nil
 }
 
 
+// NewInMemory returns a client whose tree lives only in RAM: Flush is free
+// and nothing is written unless ExportTo is called or the storage's
+// ExportPath is set before Close. It embeds with Titan like New; tests
+// usually swap Embedder for an embedding.MockProvider.
+func NewInMemory(dimensions int) (*Client, error) {
+	if dimensions != 512 {
+		return nil, fmt.Errorf("unsupported dimensions %d: the tree stores 512", dimensions)
+	}
+
+	return &Client{
+		Storage: storage.NewMemory(),
+		Region: "us-east-1",
+		Embedder: embedding.NewTitanClient("us-east-1", embedding.TitanModelID, embedding.TitanDimensions, true),
+		Metrics: metrics.Noop{},
+		MaxPayloadSize: DefaultMaxPayloadSize,
+		MaxValueSize: DefaultMaxValueSize,
+		MaxMetadataSize: DefaultMaxMetadataSize,
+		verbose: true,
+	}, nil
+}
+
+// Close flushes pending inserts and closes the storage if it needs it
+// (an in-memory database with an ExportPath is written out)
+func (client *Client) Close() error {
+	if err := client.Flush(); err != nil {
+		return err
+	}
+	if err := client.WaitFlush(); err != nil {
+		return err
+	}
+	if closer, ok := client.Storage.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// ExportTo writes the current tree, including unflushed inserts, to a
+// database file at path
+func (client *Client) ExportTo(path string) error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	tree, err := client.getTree()
+	if err != nil {
+		return fmt.Errorf("tree loading error: %w", err)
+	}
+
+	fs := storage.New(path)
+	unlock, err := fs.Lock()
+	if err != nil {
+		return fmt.Errorf("lock error: %w", err)
+	}
+	defer unlock()
+
+	return fs.Save(tree)
+}
+
+// SetVerbose turns the progress and result lines printed to stdout on or
+// off; they are on by default
+func (client *Client) SetVerbose(verbose bool) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.verbose = verbose
+}
+
+// CheckEmbedder fails early if the embedding provider's vectors cannot be
+// stored in this database: 512 dimensions, or the input width of the
+// database's projection. A provider or model other than the one the
+// database was created with is an error with StrictConfig and a warning
+// otherwise.
+func (client *Client) CheckEmbedder() error {
+	dims, err := client.Embedder.Dimensions()
+	if err != nil {
+		return fmt.Errorf("%s: dimension check failed: %w", client.Embedder.Name(), err)
+	}
+
+	client.mu.Lock()
+	tree, err := client.getTree()
+	client.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("tree loading error: %w", err)
+	}
+
+	if expected := tree.VectorDims(); dims != expected {
+		return &embedding.DimensionError{Provider: client.Embedder.Name(), Expected: expected, Got: dims}
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	return client.checkConfig(tree, client.Embedder)
+}
+
+// embed fetches the embedding for text and turns it into a tree key
+func (client *Client) embed(ctx context.Context, text string) ([512]float32, error) {
+	vec, err := client.Embedder.GetEmbedding(ctx, text)
+	if err != nil {
+		return [512]float32{}, fmt.Errorf("embedding error: %w", err)
+	}
+
+	keys, err := client.toKeys(client.Embedder, [][]float32{vec})
+	if err != nil {
+		return [512]float32{}, err
+	}
+	return keys[0], nil
+}
+
+// Embed returns the embedder's raw vectors for texts, fetched in one batch
+// where the provider supports it. Nothing is projected or normalized.
+func (client *Client) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return fetchEmbeddings(ctx, client.Embedder, texts)
+}
+
 // getTree returns the in-memory tree, loading from disk if needed
 func (client *Client) getTree() (*hippotypes.Tree, error) {
 	if client.cachedTree == nil {
+		loadStart := time.Now()
 		tree, err := client.Storage.Load()
 		if err != nil {
 			return nil, err
 		}
 		client.cachedTree = tree
+		client.Metrics.ObserveLoad(time.Since(loadStart), len(tree.Nodes))
 	}
+
+	// Normalization is fixed when a database is created; mixing raw and
+	// normalized keys would make distances meaningless
+	if client.Normalize && !client.cachedTree.Normalize {
+		if len(client.cachedTree.Nodes) > 0 {
+			return nil, fmt.Errorf("%s was created without normalization; re-embed into a new database to enable it", client.Storage.Path())
+		}
+		client.cachedTree.Normalize = true
+	}
+	client.cachedTree.ZeroVectors = client.ZeroVectors
+	client.cachedTree.SanitizeNonFinite = client.SanitizeVectors
+
 	return client.cachedTree, nil
 }
 
-// Flush writes the cached tree to disk if dirty
-func (client *Client) Flush() error {
-	if client.dirty && client.cachedTree != nil {
-		if err := client.Storage.Save(client.cachedTree); err != nil {
-			return err
+// settings returns the tree, or while it is not loaded and the storage
+// can search without loading it, an empty tree carrying the persisted
+// settings (see storage.Searcher). Either holds what a key is made with.
+// Call with mu held.
+func (client *Client) settings() (*hippotypes.Tree, error) {
+	if searcher, ok := client.Storage.(storage.Searcher); ok && client.cachedTree == nil {
+		return searcher.Settings()
+	}
+	return client.getTree()
+}
+
+// ClientStats is TreeStats plus what the client knows about persistence
+type ClientStats struct {
+	hippotypes.TreeStats
+	Path          string    `json:"path"`
+	FileBytes     int64     `json:"file_bytes"`
+	Unflushed     bool      `json:"unflushed"`
+	LastFlush     time.Time `json:"last_flush"`     // zero until this client flushes
+	PendingAccess int       `json:"pending_access"` // nodes with hits the next flush writes
+}
+
+// Stats loads the tree if needed and reports its size and memory use
+func (client *Client) Stats() (ClientStats, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	tree, err := client.getTree()
+	if err != nil {
+		return ClientStats{}, fmt.Errorf("tree loading error: %w", err)
+	}
+
+	fileBytes, err := client.Storage.Size()
+	if err != nil {
+		return ClientStats{}, err
+	}
+
+	return ClientStats{
+		TreeStats:     tree.Stats(),
+		Path:          client.Storage.Path(),
+		FileBytes:     fileBytes,
+		Unflushed:     client.dirty || client.flushing || tree.PendingAccess() > 0,
+		LastFlush:     client.lastFlush,
+		PendingAccess: tree.PendingAccess(),
+	}, nil
+}
+
+// CompactResult reports the database size before and after a compaction
+type CompactResult struct {
+	Nodes       int   `json:"nodes"`
+	BeforeBytes int64 `json:"before_bytes"`
+	AfterBytes  int64 `json:"after_bytes"`
+}
+
+// Compact rewrites the database in one pass, including any unflushed inserts,
+// and rebuilds the indices. It refuses to run while another process holds the
+// write lock.
+func (client *Client) Compact() (CompactResult, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	// A background flush holds the file lock; let it finish rather than
+	// reporting our own write as another process
+	client.waitFlush()
+
+	unlock, err := client.Storage.TryLock()
+	if err != nil {
+		return CompactResult{}, fmt.Errorf("lock error: %w", err)
+	}
+	defer unlock()
+
+	before, err := client.Storage.Size()
+	if err != nil {
+		return CompactResult{}, err
+	}
+
+	tree, err := client.getTree()
+	if err != nil {
+		return CompactResult{}, fmt.Errorf("tree loading error: %w", err)
+	}
+
+	// Save directly: Flush would try to take the lock we already hold
+	if err := client.Storage.Save(tree); err != nil {
+		return CompactResult{}, fmt.Errorf("save error: %w", err)
+	}
+	client.dirty = false
+	tree.RebuildIndex()
+
+	after, err := client.Storage.Size()
+	if err != nil {
+		return CompactResult{}, err
+	}
+
+	return CompactResult{
+		Nodes:       len(tree.Nodes),
+		BeforeBytes: before,
+		AfterBytes:  after,
+	}, nil
+}
+
+func (client *Client) Insert(key, text string) error {
+	return client.InsertWithMetadata(key, text, nil)
+}
+
+// InsertWithMetadata is Insert with string metadata stored on the node
+func (client *Client) InsertWithMetadata(key, text string, metadata map[string]string) error {
+	return client.InsertWithPayload(key, text, metadata, nil)
+}
+
+// InsertWithPayload also stores an opaque blob that is returned with search results
+func (client *Client) InsertWithPayload(key, text string, metadata map[string]string, payload []byte) error {
+	_, err := client.insert(key, text, metadata, payload, nil)
+	return err
+}
+
+// InsertStats is InsertWithMetadata that also reports the insert's timings
+// and node counts
+func (client *Client) InsertStats(key, text string, metadata map[string]string) (OperationStats, error) {
+	return client.insert(key, text, metadata, nil, nil)
+}
+
+// CheckSize returns ErrValueTooLarge, ErrMetadataTooLarge or
+// ErrPayloadTooLarge, wrapped with the sizes, if a node with this text,
+// metadata and payload would exceed the client's limits
+func (client *Client) CheckSize(text string, metadata map[string]string, payload []byte) error {
+	if client.MaxValueSize > 0 && len(text) > client.MaxValueSize {
+		return fmt.Errorf("%w: %d bytes, limit is %d", ErrValueTooLarge, len(text), client.MaxValueSize)
+	}
+	if client.MaxMetadataSize > 0 {
+		size := 0
+		for k, v := range metadata {
+			size += len(k) + len(v)
+		}
+		if size > client.MaxMetadataSize {
+			return fmt.Errorf("%w: %d bytes, limit is %d", ErrMetadataTooLarge, size, client.MaxMetadataSize)
 		}
-		client.dirty = false
+	}
+	if client.MaxPayloadSize > 0 && len(payload) > client.MaxPayloadSize {
+		return fmt.Errorf("%w: %d bytes, limit is %d", ErrPayloadTooLarge, len(payload), client.MaxPayloadSize)
 	}
 	return nil
 }
 
-func (client *Client) Insert(key, text string) error {
+// insert embeds and stores one node. With up set it first applies up's
+// policy to the nodes already stored under up.id, recording the outcome.
+func (client *Client) insert(key, text string, metadata map[string]string, payload []byte, up *upsert) (OperationStats, error) {
 	ctx := context.Background()
+	stats := OperationStats{Operation: "insert"}
+
+	metadata = hippotypes.StampTimestamp(metadata, time.Time{})
+	if err := client.CheckSize(text, metadata, payload); err != nil {
+		return stats, err
+	}
 
 	// Time embedding generation
 	embedStart := time.Now()
-	embeddingSlice, err := embedding.GetEmbedding(ctx, client.Bedrock, text)
-	embedDuration := time.Since(embedStart)
+	embeddingArray, err := client.embed(ctx, text)
+	stats.Embed = time.Since(embedStart)
 	if err != nil {
-		return fmt.Errorf("embedding error: %w", err)
+		return stats, err
 	}
 
-	var embeddingArray [512]float32
-	copy(embeddingArray[:], embeddingSlice)
+	client.mu.Lock()
+	defer client.mu.Unlock()
 
 	// Time tree loading
 	loadStart := time.Now()
 	tree, err := client.getTree()
-	loadDuration := time.Since(loadStart)
+	stats.Load = time.Since(loadStart)
 	if err != nil {
-		return fmt.Errorf("tree loading error: %w", err)
+		return stats, fmt.Errorf("tree loading error: %w", err)
+	}
+
+	if err := client.checkConfig(tree, client.Embedder); err != nil {
+		return stats, err
+	}
+	if embeddingArray, err = tree.PrepareInsertKey(embeddingArray); err != nil {
+		return stats, fmt.Errorf("embedding error: %w", err)
+	}
+	if err := tree.Schema.Check(metadata); err != nil {
+		return stats, err
 	}
+	stats.NodesBefore = len(tree.Nodes)
+	if up != nil && !client.resolveConflict(tree, up) {
+		stats.NodesAfter = len(tree.Nodes)
+		return stats, nil
+	}
+	client.recordConfig(tree, client.Embedder)
 
 	// Time pure insert operation
 	insertStart := time.Now()
-	tree.Insert(embeddingArray, text)
-	insertDuration := time.Since(insertStart)
+	if err := tree.InsertWithPayload(embeddingArray, text, metadata, payload); err != nil {
+		return stats, fmt.Errorf("embedding error: %w", err)
+	}
+	stats.Insert = time.Since(insertStart)
+	stats.NodesAfter = len(tree.Nodes)
 	client.dirty = true
+	client.treeChanged()
 
 	// Time file flush (if needed)
-	var flushDuration time.Duration
-	if len(tree.Nodes) % 100 == 0 {
-		flushStart := time.Now()
-		if err := client.Flush(); err != nil {
-			return fmt.Errorf("flush error: %w", err)
+	if client.autoFlushDue(len(tree.Nodes)) {
+		if err := client.flushTimed(&stats); err != nil {
+			return stats, fmt.Errorf("flush error: %w", err)
 		}
-		flushDuration = time.Since(flushStart)
 	}
 
 	if client.verbose {
 		fmt.Printf("Successfully inserted %s (total nodes: %d)\n", key, len(tree.Nodes))
-		fmt.Printf("TIMING:EMBED:%.3f:LOAD:%.3f:INSERT:%.3f:FLUSH:%.3f\n",
-			embedDuration.Seconds()*1000,
-			loadDuration.Seconds()*1000,
-			insertDuration.Seconds()*1000,
-			flushDuration.Seconds()*1000)
 	}
-	return nil
+
+	client.Metrics.ObserveInsert(stats.insertTiming())
+	client.Metrics.SetNodeCount(len(tree.Nodes))
+	client.lastStats = stats
+
+	return stats, nil
 }
 
 
 
+// CountWithFilter counts the nodes matching filter (nil counts everything)
+func (client *Client) CountWithFilter(filter *hippotypes.Filter) (int, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	tree, err := client.getTree()
+	if err != nil {
+		return 0, fmt.Errorf("tree loading error: %w", err)
+	}
+	return tree.CountWithFilter(filter), nil
+}
+
+// GroupCount counts matching nodes per value of metaKey
+func (client *Client) GroupCount(metaKey string, filter *hippotypes.Filter) (map[string]int, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	tree, err := client.getTree()
+	if err != nil {
+		return nil, fmt.Errorf("tree loading error: %w", err)
+	}
+	return tree.GroupCount(metaKey, filter), nil
+}
+
+// SearchResult is a single detailed search hit
+type SearchResult struct {
+	Text       string            `json:"text"`
+	Distance   float32           `json:"distance"`
+	Similarity float32           `json:"similarity"`
+	Score      float32           `json:"score,omitempty"` // Hybrid or re-ranking score
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	Payload    []byte            `json:"payload,omitempty"` // base64 in JSON
+	Group      string            `json:"group,omitempty"`     // GroupBy value
+	Collapsed  int               `json:"collapsed,omitempty"` // Same-group results folded into this one
+}
+
 func (client *Client) Search(text string, epsilon float32, threshold float32, topK int) ([]string, error) {
+	results, err := client.SearchDetailed(text, epsilon, threshold, topK)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]string, len(results))
+	for i, result := range results {
+		values[i] = result.Text
+	}
+
+	return values, nil
+}
+
+// SearchDetailed is Search but returns the distance and similarity of every hit
+func (client *Client) SearchDetailed(text string, epsilon float32, threshold float32, topK int) ([]SearchResult, error) {
+	return client.SearchWithOptions(text, epsilon, threshold, topK, hippotypes.SearchOptions{})
+}
+
+// SearchWithOptions is SearchDetailed with the optional stages in opts (e.g. MMR re-ranking)
+func (client *Client) SearchWithOptions(text string, epsilon float32, threshold float32, topK int, opts hippotypes.SearchOptions) ([]SearchResult, error) {
+	results, _, err := client.SearchStats(text, epsilon, threshold, topK, opts)
+	return results, err
+}
+
+// SearchStats is SearchWithOptions that also reports the search's timings
+func (client *Client) SearchStats(text string, epsilon float32, threshold float32, topK int, opts hippotypes.SearchOptions) ([]SearchResult, OperationStats, error) {
+	opts.Epsilon, opts.Threshold, opts.TopK = epsilon, threshold, topK
+	return client.SearchOpts(text, opts)
+}
+
+// SearchOpts searches for text with everything, epsilon, threshold and topK
+// included, taken from opts (see hippotypes.DefaultSearchOptions), and
+// reports the search's timings
+func (client *Client) SearchOpts(text string, opts hippotypes.SearchOptions) ([]SearchResult, OperationStats, error) {
+	ctx := context.Background()
+	stats := OperationStats{Operation: "search"}
+
+	// Fail before paying for an embedding
+	if err := opts.Validate(); err != nil {
+		return nil, stats, err
+	}
+
+	// Time embedding generation
+	embedStart := time.Now()
+	embeddingArray, err := client.embed(ctx, text)
+	stats.Embed = time.Since(embedStart)
+	if err != nil {
+		return nil, stats, err
+	}
+
+	return client.searchKey(embeddingArray, client.Embedder, opts, stats)
+}
+
+// SearchByExamples searches with several example texts at once: the sum of
+// the positive embeddings minus the sum of the negative ones, normalized.
+// Several positives search from their centroid ("more like these"), and
+// positives A, C with negative B make the analogy query A - B + C. Every
+// example is normalized before combining so each counts the same. A nil
+// provider uses client.Embedder.
+func (client *Client) SearchByExamples(positiveTexts, negativeTexts []string, provider embedding.EmbeddingProvider, opts hippotypes.SearchOptions) ([]SearchResult, OperationStats, error) {
+	ctx := context.Background()
+	stats := OperationStats{Operation: "search"}
+	if provider == nil {
+		provider = client.Embedder
+	}
+
+	if len(positiveTexts) == 0 {
+		return nil, stats, fmt.Errorf("at least one positive example is required")
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, stats, err
+	}
+
+	embedStart := time.Now()
+	keys, err := client.embedAll(ctx, provider, append(append([]string{}, positiveTexts...), negativeTexts...))
+	stats.Embed = time.Since(embedStart)
+	if err != nil {
+		return nil, stats, err
+	}
+	if len(keys) != len(positiveTexts)+len(negativeTexts) {
+		return nil, stats, fmt.Errorf("embedding error: %s returned %d vectors for %d texts", provider.Name(), len(keys), len(positiveTexts)+len(negativeTexts))
+	}
+
+	examples := make([][]float32, len(keys))
+	for i := range keys {
+		if err := hippotypes.NormalizeVector(&keys[i]); err != nil {
+			return nil, stats, fmt.Errorf("example %d: %w", i, err)
+		}
+		examples[i] = keys[i][:]
+	}
+	combined, err := hippotypes.CombineVectors(examples[:len(positiveTexts)], examples[len(positiveTexts):])
+	if err != nil {
+		return nil, stats, err
+	}
+
+	var query [512]float32
+	copy(query[:], combined)
+	if err := hippotypes.NormalizeVector(&query); err != nil {
+		return nil, stats, fmt.Errorf("examples cancel out: %w", err)
+	}
+
+	return client.searchKey(query, provider, opts, stats)
+}
+
+// searchKey searches for an embedded query with everything else taken from
+// opts; provider is what embedded it, checked against the tree's config.
+// stats already holds the embedding time.
+func (client *Client) searchKey(embeddingArray [512]float32, provider embedding.EmbeddingProvider, opts hippotypes.SearchOptions, stats OperationStats) ([]SearchResult, OperationStats, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	// A backend that searches itself is used until something loads the tree
+	if searcher, ok := client.Storage.(storage.Searcher); ok && client.cachedTree == nil && searcher.CanSearch(opts) {
+		return client.searchBackend(searcher, embeddingArray, provider, opts, stats)
+	}
+
+	// Time tree loading
+	loadStart := time.Now()
+	tree, err := client.getTree()
+	stats.Load = time.Since(loadStart)
+	if err != nil {
+		return nil, stats, fmt.Errorf("tree loading error: %w", err)
+	}
+
+	if err := client.checkConfig(tree, provider); err != nil {
+		return nil, stats, err
+	}
+	if embeddingArray, err = tree.PrepareKey(embeddingArray); err != nil {
+		return nil, stats, fmt.Errorf("embedding error: %w", err)
+	}
+
+	// Time pure search operation
+	stats.NodesBefore = len(tree.Nodes)
+	stats.NodesAfter = len(tree.Nodes)
+	searchStart := time.Now()
+	search := tree.SearchOpts
+	if client.tracksAccess(tree, opts) {
+		// Searches that record hits skip the result cache
+		opts.TrackAccess = true
+		search = func(query [512]float32, opts hippotypes.SearchOptions) ([]hippotypes.ScoredNode, bool, error) {
+			scored, truncated, err := tree.SearchOpts(query, opts)
+			if err == nil {
+				tree.RecordAccess(scored, time.Now())
+			}
+			return scored, truncated, err
+		}
+	}
+	results, truncated, err := client.searchTree(search, embeddingArray, opts)
+	stats.Search = time.Since(searchStart)
+	stats.Truncated = truncated
+	if err != nil {
+		return nil, stats, err
+	}
+	stats.Results = len(results)
+	if len(results) == 0 && opts.Hint {
+		stats.Hint = tree.SearchHint(embeddingArray, opts)
+	}
+
+	client.reportSearch(results, opts, stats)
+	return results, stats, nil
+}
+
+// searchBackend is searchKey for a backend that searches without loading
+// the tree, such as a sharded directory larger than memory. Hints are not
+// computed, since they measure every node. Call with mu held.
+func (client *Client) searchBackend(searcher storage.Searcher, embeddingArray [512]float32, provider embedding.EmbeddingProvider, opts hippotypes.SearchOptions, stats OperationStats) ([]SearchResult, OperationStats, error) {
+	loadStart := time.Now()
+	settings, err := searcher.Settings()
+	stats.Load = time.Since(loadStart)
+	if err != nil {
+		return nil, stats, fmt.Errorf("tree loading error: %w", err)
+	}
+	if client.Normalize && !settings.Normalize {
+		return nil, stats, fmt.Errorf("%s was created without normalization; re-embed into a new database to enable it", client.Storage.Path())
+	}
+
+	if err := client.checkConfig(settings, provider); err != nil {
+		return nil, stats, err
+	}
+	if embeddingArray, err = settings.PrepareKey(embeddingArray); err != nil {
+		return nil, stats, fmt.Errorf("embedding error: %w", err)
+	}
+
+	searchStart := time.Now()
+	results, truncated, err := client.searchTree(searcher.SearchOpts, embeddingArray, opts)
+	stats.Search = time.Since(searchStart)
+	stats.Truncated = truncated
+	if err != nil {
+		return nil, stats, err
+	}
+	stats.Results = len(results)
+
+	client.reportSearch(results, opts, stats)
+	return results, stats, nil
+}
+
+// reportSearch prints the results if verbose and records the search's
+// stats. Call with mu held.
+func (client *Client) reportSearch(results []SearchResult, opts hippotypes.SearchOptions, stats OperationStats) {
+	if client.verbose {
+		fmt.Printf("\nFound %d results (top %d, threshold %.2f):\n", len(results), opts.TopK, opts.Threshold)
+		for _, result := range results {
+			if result.Collapsed > 0 {
+				fmt.Printf("  %s  (+%d more from %s)\n", result.Text, result.Collapsed, result.Group)
+			} else {
+				fmt.Printf("  %s\n", result.Text)
+			}
+		}
+		if stats.Hint != nil {
+			fmt.Printf("  hint: %s\n", stats.Hint.Message)
+		}
+	}
+
+	client.Metrics.ObserveSearch(stats.searchTiming())
+	client.lastStats = stats
+}
+
+
+// searchTree runs search, a tree's or a backend's SearchOpts, answering
+// from the result cache when it is enabled and holds this exact query.
+// Truncated results (see hippotypes.Tree.SearchWithLimits) are not cached,
+// and searches with TrackAccess or an Explanation neither read nor fill the
+// cache.
+func (client *Client) searchTree(search func([512]float32, hippotypes.SearchOptions) ([]hippotypes.ScoredNode, bool, error), query [512]float32, opts hippotypes.SearchOptions) ([]SearchResult, bool, error) {
+	var key cacheKey
+	cacheable := false
+	if client.resultCache != nil && !opts.TrackAccess && opts.Explanation == nil {
+		key, cacheable = searchCacheKey(query, opts)
+		if cacheable {
+			if results, ok := client.resultCache.get(key); ok {
+				return results, false, nil
+			}
+		}
+	}
+
+	scored, truncated, err := search(query, opts)
+	if err != nil {
+		return nil, truncated, err
+	}
+
+	results := toSearchResults(scored)
+
+	if cacheable && !truncated {
+		client.resultCache.put(key, results)
+	}
+	return results, truncated, nil
+}
+
+func toSearchResults(scored []hippotypes.ScoredNode) []SearchResult {
+	results := make([]SearchResult, len(scored))
+	for i, hit := range scored {
+		results[i] = SearchResult{
+			Text:       hit.Node.Value,
+			Distance:   hit.Distance,
+			Similarity: hippotypes.Similarity(hit.Distance),
+			Score:      hit.Score,
+			Metadata:   hit.Node.Metadata,
+			Payload:    hit.Node.Payload,
+			Group:      hit.Group,
+			Collapsed:  hit.Collapsed,
+		}
+	}
+	return results
+}
+
+// HybridSearch ranks memories by a mix of vector similarity and BM25 keyword
+// match; alpha 1 is pure vector search, 0 is pure keyword search
+func (client *Client) HybridSearch(text string, alpha float32, topK int) ([]SearchResult, error) {
 	ctx := context.Background()
 
 	// Time embedding generation
 	embedStart := time.Now()
-	embeddingSlice, err := embedding.GetEmbedding(ctx, client.Bedrock, text)
+	embeddingArray, err := client.embed(ctx, text)
 	embedDuration := time.Since(embedStart)
 	if err != nil {
-		return nil, fmt.Errorf("embedding error: %w", err)
+		return nil, err
 	}
 
-	var embeddingArray [512]float32
-	copy(embeddingArray[:], embeddingSlice)
+	client.mu.Lock()
+	defer client.mu.Unlock()
 
 	// Time tree loading
 	loadStart := time.Now()
@@ -149,33 +822,63 @@ func (client *Client) Search(text string, epsilon float32, threshold float32, to
 		return nil, fmt.Errorf("tree loading error: %w", err)
 	}
 
-	// Time pure search operation
+	if err := client.checkConfig(tree, client.Embedder); err != nil {
+		return nil, err
+	}
+	if embeddingArray, err = tree.PrepareKey(embeddingArray); err != nil {
+		return nil, fmt.Errorf("embedding error: %w", err)
+	}
+
 	searchStart := time.Now()
-	results := tree.Search(embeddingArray, epsilon, threshold, topK)
+	hits := tree.HybridSearch(text, embeddingArray, alpha, topK)
 	searchDuration := time.Since(searchStart)
 
-	values := make([]string, len(results))
-	for i, node := range results {
-		values[i] = node.Value
+	results := make([]SearchResult, len(hits))
+	for i, hit := range hits {
+		results[i] = SearchResult{
+			Text:       hit.Node.Value,
+			Distance:   hit.Distance,
+			Similarity: hit.Similarity,
+			Score:      hit.Score,
+			Metadata:   hit.Node.Metadata,
+			Payload:    hit.Node.Payload,
+		}
 	}
 
 	if client.verbose {
-		fmt.Printf("\nFound %d results (top %d, threshold %.2f):\n", len(results), topK, threshold)
-		for _, value := range values {
-			fmt.Printf("  %s\n", value)
+		fmt.Printf("\nFound %d results (top %d, hybrid alpha %.2f):\n", len(results), topK, alpha)
+		for _, result := range results {
+			fmt.Printf("  %s\n", result.Text)
 		}
-		fmt.Printf("TIMING:EMBED:%.3f:LOAD:%.6f:SEARCH:%.6f\n",
-			embedDuration.Seconds()*1000,
-			loadDuration.Seconds()*1000,
-			searchDuration.Seconds()*1000)
 	}
 
-	return values, nil
+	client.Metrics.ObserveSearch(metrics.SearchTiming{
+		Embed:   embedDuration,
+		Load:    loadDuration,
+		Search:  searchDuration,
+		Results: len(results),
+	})
+
+	return results, nil
 }
 
+// InsertCSV stores a key,text row per line, embedding and inserting
+// DefaultCSVBatchSize rows at a time. With CSVTimestampColumn set, each
+// row's time in that column is stored as its VectorRecord.Timestamp; rows
+// with the cell empty are stored without one.
+func (client *Client) InsertCSV(csvFilename string) error {
+	return client.InsertCSVBatch(csvFilename, DefaultCSVBatchSize)
+}
 
+// InsertCSVBatch is InsertCSV embedding and inserting batchSize rows at a
+// time (<= 0 means DefaultCSVBatchSize). Each batch is checked and stored
+// whole, and the database is flushed once at the end. Errors name the line
+// of the offending row; batches before it stay inserted.
+func (client *Client) InsertCSVBatch(csvFilename string, batchSize int) error {
+	if batchSize <= 0 {
+		batchSize = DefaultCSVBatchSize
+	}
 
-func (client *Client) InsertCSV(csvFilename string) error {
 	file, err := os.Open(csvFilename)
 	if err != nil {
 		return fmt.Errorf("Error opening file: %v", err)
@@ -184,6 +887,35 @@ func (client *Client) InsertCSV(csvFilename string) error {
 
 	reader := csv.NewReader(file)
 
+	texts := make([]string, 0, batchSize)
+	stamps := make([]time.Time, 0, batchSize)
+	lines := make([]int, 0, batchSize)
+	insertBatch := func() error {
+		if len(texts) == 0 {
+			return nil
+		}
+		keys, err := client.embedAll(context.Background(), client.Embedder, texts)
+		if err != nil {
+			return fmt.Errorf("lines %d-%d: %w", lines[0], lines[len(lines)-1], err)
+		}
+		records := make([]VectorRecord, len(texts))
+		for i, text := range texts {
+			records[i] = VectorRecord{Key: keys[i], Text: text, Timestamp: stamps[i]}
+		}
+		if err := client.insertRecords(records, client.Embedder, false); err != nil {
+			// Record errors are "record <i>: ..."; point at the line instead
+			var recordErr *recordError
+			if errors.As(err, &recordErr) {
+				return fmt.Errorf("line %d: %w", lines[recordErr.Index], recordErr.Err)
+			}
+			return err
+		}
+		texts = texts[:0]
+		stamps = stamps[:0]
+		lines = lines[:0]
+		return nil
+	}
+
 	for {
 		record, err := reader.Read()
 		if err != nil {
@@ -193,15 +925,497 @@ func (client *Client) InsertCSV(csvFilename string) error {
 			return fmt.Errorf("Error in reading line: %v", err)
 		}
 
-		if err := client.Insert(record[0], record[1]); err != nil {
-			return err
+		line, _ := reader.FieldPos(0)
+		if len(record) < 2 {
+			return fmt.Errorf("line %d: expected key,text but got %d field(s)", line, len(record))
+		}
+		if err := client.CheckSize(record[1], nil, nil); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
 		}
+
+		var stamp time.Time
+		if column := client.CSVTimestampColumn; column > 0 {
+			if column >= len(record) {
+				return fmt.Errorf("line %d: no timestamp column %d in %d field(s)", line, column, len(record))
+			}
+			if cell := strings.TrimSpace(record[column]); cell != "" {
+				if stamp, err = time.Parse(time.RFC3339Nano, cell); err != nil {
+					return fmt.Errorf("line %d: timestamp must be an RFC 3339 time: %w", line, err)
+				}
+			}
+		}
+
+		texts = append(texts, record[1])
+		stamps = append(stamps, stamp)
+		lines = append(lines, line)
+		if len(texts) == batchSize {
+			if err := insertBatch(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := insertBatch(); err != nil {
+		return err
 	}
 
 	// Flush after bulk insert
 	return client.Flush()
 }
 
+// VectorRecord is a memory whose embedding was computed elsewhere
+type VectorRecord struct {
+	Key      [512]float32
+	Text     string
+	Metadata map[string]string
+	Payload  []byte
+
+	// Timestamp, when set, is stored under hippotypes.TimestampKey in place
+	// of any timestamp in Metadata, e.g. when a chat log entry was written.
+	// Zero keeps a timestamp already in Metadata and otherwise stamps the
+	// time of the insert.
+	Timestamp time.Time
+}
+
+// recordError is a batch insert failing on records[Index]
+type recordError struct {
+	Index int
+	Err   error
+}
+
+func (e *recordError) Error() string {
+	return fmt.Sprintf("record %d: %v", e.Index, e.Err)
+}
+
+func (e *recordError) Unwrap() error {
+	return e.Err
+}
+
+// BatchInsert stores records with precomputed embeddings, e.g. from an
+// import, under one lock and flushes once. Nothing is embedded, so the
+// vectors must come from the model later queries will be embedded with;
+// a new database records that model as unknown.
+func (client *Client) BatchInsert(records []VectorRecord) error {
+	return client.batchInsert(records, nil)
+}
+
+// AppendBatch is BatchInsert without the flush, for importers that add
+// many batches and call Flush once at the end
+func (client *Client) AppendBatch(records []VectorRecord) error {
+	return client.insertRecords(records, nil, false)
+}
+
+// batchInsert is BatchInsert for records embedded by provider, or
+// precomputed elsewhere when provider is nil
+func (client *Client) batchInsert(records []VectorRecord, provider embedding.EmbeddingProvider) error {
+	return client.insertRecords(records, provider, true)
+}
+
+// insertRecords stores records as one all-or-nothing batch and, if flush
+// is set, writes the database once afterwards
+func (client *Client) insertRecords(records []VectorRecord, provider embedding.EmbeddingProvider, flush bool) error {
+	metadata := make([]map[string]string, len(records))
+	for i, record := range records {
+		metadata[i] = hippotypes.StampTimestamp(record.Metadata, record.Timestamp)
+		if err := client.CheckSize(record.Text, metadata[i], record.Payload); err != nil {
+			return &recordError{Index: i, Err: err}
+		}
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	loadStart := time.Now()
+	tree, err := client.getTree()
+	loadDuration := time.Since(loadStart)
+	if err != nil {
+		return fmt.Errorf("tree loading error: %w", err)
+	}
+	if err := client.checkConfig(tree, provider); err != nil {
+		return err
+	}
+
+	// Check every key before inserting any, so a bad record fails the
+	// whole batch rather than leaving half of it behind
+	keys := make([][512]float32, len(records))
+	for i, record := range records {
+		if keys[i], err = tree.PrepareInsertKey(record.Key); err != nil {
+			return &recordError{Index: i, Err: err}
+		}
+		if err := tree.Schema.Check(metadata[i]); err != nil {
+			return &recordError{Index: i, Err: err}
+		}
+	}
+
+	if len(records) > 0 {
+		client.recordConfig(tree, provider)
+	}
+
+	// Keys and metadata were checked above, so these cannot fail
+	insertStart := time.Now()
+	for i, record := range records {
+		tree.InsertWithPayload(keys[i], record.Text, metadata[i], record.Payload)
+	}
+	insertDuration := time.Since(insertStart)
+	if len(records) > 0 {
+		client.dirty = true
+		client.treeChanged()
+	}
+
+	var flushDuration time.Duration
+	if flush {
+		flushStart := time.Now()
+		if err := client.flush(); err != nil {
+			return fmt.Errorf("flush error: %w", err)
+		}
+		flushDuration = time.Since(flushStart)
+	}
+
+	client.Metrics.ObserveInsert(metrics.InsertTiming{
+		Load:   loadDuration,
+		Insert: insertDuration,
+		Flush:  flushDuration,
+	})
+	client.Metrics.SetNodeCount(len(tree.Nodes))
+
+	return nil
+}
+
+// InsertTexts embeds texts in one batch where the provider supports it and
+// stores them with BatchInsert, each with its own copy of metadata
+func (client *Client) InsertTexts(texts []string, metadata map[string]string) error {
+	keys, err := client.embedAll(context.Background(), client.Embedder, texts)
+	if err != nil {
+		return err
+	}
+
+	records := make([]VectorRecord, len(texts))
+	for i, text := range texts {
+		records[i] = VectorRecord{Key: keys[i], Text: text, Metadata: maps.Clone(metadata)}
+	}
+	return client.batchInsert(records, client.Embedder)
+}
+
+// InsertMulti stores one memory under several precomputed embeddings, e.g.
+// a key phrase and the full text. vectors[0] is the primary key; searches
+// with SearchOptions.MultiVector match the node through any of them and
+// return it once.
+func (client *Client) InsertMulti(vectors [][]float32, text string, metadata map[string]string) error {
+	if len(vectors) == 0 {
+		return fmt.Errorf("at least one vector is required")
+	}
+	metadata = hippotypes.StampTimestamp(metadata, time.Time{})
+	if err := client.CheckSize(text, metadata, nil); err != nil {
+		return err
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	loadStart := time.Now()
+	tree, err := client.getTree()
+	loadDuration := time.Since(loadStart)
+	if err != nil {
+		return fmt.Errorf("tree loading error: %w", err)
+	}
+
+	keys := make([][512]float32, len(vectors))
+	for i, vec := range vectors {
+		if keys[i], err = tree.VectorKey(vec); err != nil {
+			return fmt.Errorf("vector %d: %w", i, err)
+		}
+		if keys[i], err = tree.PrepareInsertKey(keys[i]); err != nil {
+			return fmt.Errorf("vector %d: %w", i, err)
+		}
+	}
+
+	client.recordConfig(tree, nil)
+	insertStart := time.Now()
+	if err := tree.InsertMulti(keys, text, metadata); err != nil {
+		return err
+	}
+	insertDuration := time.Since(insertStart)
+	client.dirty = true
+	client.treeChanged()
+
+	var flushDuration time.Duration
+	if client.autoFlushDue(len(tree.Nodes)) {
+		flushStart := time.Now()
+		if err := client.flush(); err != nil {
+			return fmt.Errorf("flush error: %w", err)
+		}
+		flushDuration = time.Since(flushStart)
+	}
+
+	client.Metrics.ObserveInsert(metrics.InsertTiming{
+		Load:   loadDuration,
+		Insert: insertDuration,
+		Flush:  flushDuration,
+	})
+	client.Metrics.SetNodeCount(len(tree.Nodes))
+
+	return nil
+}
+
+// Metadata keys set on every chunk stored by InsertDocument
+const (
+	DocIDKey      = "doc_id"
+	ChunkIndexKey = "chunk_index"
+	CharStartKey  = "char_start"
+	CharEndKey    = "char_end"
+)
+
+// InsertDocument splits a long text into overlapping chunks and stores each
+// one as its own node tagged with DocIDKey, ChunkIndexKey, CharStartKey and
+// CharEndKey. Search with SearchOptions{GroupBy: DocIDKey} to get the best
+// chunk per document. A nil provider uses client.Embedder.
+func (client *Client) InsertDocument(docID, text string, provider embedding.EmbeddingProvider, opts embedding.ChunkOptions) (int, error) {
+	return client.insertDocument(docID, text, nil, provider, opts, false)
+}
+
+// ReplaceDocument is InsertDocument that first removes the chunks already
+// stored under docID, with metadata added to every new chunk. The text is
+// embedded before the tree is touched, so if embedding fails the old
+// chunks are left in place; the delete and insert go out in one flush.
+func (client *Client) ReplaceDocument(docID, text string, metadata map[string]string, provider embedding.EmbeddingProvider, opts embedding.ChunkOptions) (int, error) {
+	return client.insertDocument(docID, text, metadata, provider, opts, true)
+}
+
+// DeleteDocument removes every chunk stored under docID
+func (client *Client) DeleteDocument(docID string) (int, error) {
+	if docID == "" {
+		return 0, fmt.Errorf("document ID is required")
+	}
+	return client.DeleteWhere(&hippotypes.Filter{Metadata: map[string]string{DocIDKey: docID}})
+}
+
+// DeleteWhere removes every node matching filter and flushes. A nil filter
+// is rejected rather than emptying the database.
+func (client *Client) DeleteWhere(filter *hippotypes.Filter) (int, error) {
+	if filter == nil {
+		return 0, fmt.Errorf("a filter is required")
+	}
+	return client.deleteNodes(func(tree *hippotypes.Tree) int {
+		return tree.DeleteWhere(filter)
+	})
+}
+
+// DeleteFunc removes every node match returns true for and flushes, like
+// DeleteWhere for conditions a Filter can't express
+func (client *Client) DeleteFunc(match func(n *hippotypes.Node) bool) (int, error) {
+	return client.deleteNodes(func(tree *hippotypes.Tree) int {
+		return tree.DeleteFunc(match)
+	})
+}
+
+func (client *Client) deleteNodes(remove func(tree *hippotypes.Tree) int) (int, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	tree, err := client.getTree()
+	if err != nil {
+		return 0, fmt.Errorf("tree loading error: %w", err)
+	}
+
+	deleted := remove(tree)
+	if deleted == 0 {
+		return 0, nil
+	}
+	client.dirty = true
+	client.treeChanged()
+
+	if err := client.flush(); err != nil {
+		return deleted, fmt.Errorf("flush error: %w", err)
+	}
+	client.Metrics.SetNodeCount(len(tree.Nodes))
+	return deleted, nil
+}
+
+// DocumentMetadata maps each document ID to the metaKey value on its
+// chunks. Documents whose chunks lack metaKey are left out.
+func (client *Client) DocumentMetadata(metaKey string) (map[string]string, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	tree, err := client.getTree()
+	if err != nil {
+		return nil, fmt.Errorf("tree loading error: %w", err)
+	}
+
+	docs := make(map[string]string)
+	for i := range tree.Nodes {
+		n := &tree.Nodes[i]
+		docID, ok := n.Metadata[DocIDKey]
+		if !ok {
+			continue
+		}
+		if v, ok := n.Metadata[metaKey]; ok {
+			docs[docID] = v
+		}
+	}
+	return docs, nil
+}
+
+func (client *Client) insertDocument(docID, text string, metadata map[string]string, provider embedding.EmbeddingProvider, opts embedding.ChunkOptions, replace bool) (int, error) {
+	ctx := context.Background()
+
+	if docID == "" {
+		return 0, fmt.Errorf("document ID is required")
+	}
+	if provider == nil {
+		provider = client.Embedder
+	}
+
+	chunks, err := embedding.ChunkText(text, opts)
+	if err != nil {
+		return 0, err
+	}
+	if len(chunks) == 0 {
+		return 0, fmt.Errorf("document %s has no text", docID)
+	}
+	// Chunks are bounded by opts, but the metadata is copied onto each one
+	if err := client.CheckSize("", metadata, nil); err != nil {
+		return 0, err
+	}
+
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.Text
+	}
+
+	embedStart := time.Now()
+	keys, err := client.embedAll(ctx, provider, texts)
+	embedDuration := time.Since(embedStart)
+	if err != nil {
+		return 0, err
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	loadStart := time.Now()
+	tree, err := client.getTree()
+	loadDuration := time.Since(loadStart)
+	if err != nil {
+		return 0, fmt.Errorf("tree loading error: %w", err)
+	}
+	if err := client.checkConfig(tree, provider); err != nil {
+		return 0, err
+	}
+
+	chunkMetadata := make([]map[string]string, len(chunks))
+	for i, chunk := range chunks {
+		chunkMetadata[i] = hippotypes.StampTimestamp(maps.Clone(metadata), time.Time{})
+		if chunkMetadata[i] == nil {
+			chunkMetadata[i] = make(map[string]string, 4)
+		}
+		chunkMetadata[i][DocIDKey] = docID
+		chunkMetadata[i][ChunkIndexKey] = strconv.Itoa(chunk.Index)
+		chunkMetadata[i][CharStartKey] = strconv.Itoa(chunk.Start)
+		chunkMetadata[i][CharEndKey] = strconv.Itoa(chunk.End)
+	}
+
+	// Check every key and the metadata before changing anything so a
+	// replace never deletes the old chunks and then fails part way through
+	// the new ones
+	for i := range keys {
+		if keys[i], err = tree.PrepareInsertKey(keys[i]); err != nil {
+			return 0, fmt.Errorf("chunk %d: embedding error: %w", i, err)
+		}
+		if err := tree.Schema.Check(chunkMetadata[i]); err != nil {
+			return 0, fmt.Errorf("chunk %d: %w", i, err)
+		}
+	}
+
+	insertStart := time.Now()
+	if replace && tree.DeleteWhere(&hippotypes.Filter{Metadata: map[string]string{DocIDKey: docID}}) > 0 {
+		client.dirty = true
+		client.treeChanged()
+	}
+	client.recordConfig(tree, provider)
+	for i, chunk := range chunks {
+		tree.InsertWithMetadata(keys[i], chunk.Text, chunkMetadata[i]) // checked above
+		client.dirty = true
+		client.treeChanged()
+	}
+	insertDuration := time.Since(insertStart)
+
+	flushStart := time.Now()
+	if err := client.flush(); err != nil {
+		return len(chunks), fmt.Errorf("flush error: %w", err)
+	}
+	flushDuration := time.Since(flushStart)
+
+	if client.verbose {
+		fmt.Printf("Successfully inserted %s as %d chunks (total nodes: %d)\n", docID, len(chunks), len(tree.Nodes))
+	}
+
+	client.Metrics.ObserveInsert(metrics.InsertTiming{
+		Embed:  embedDuration,
+		Load:   loadDuration,
+		Insert: insertDuration,
+		Flush:  flushDuration,
+	})
+	client.Metrics.SetNodeCount(len(tree.Nodes))
+
+	return len(chunks), nil
+}
+
+// embedAll embeds texts in one request when the provider supports batching
+func (client *Client) embedAll(ctx context.Context, provider embedding.EmbeddingProvider, texts []string) ([][512]float32, error) {
+	vecs, err := fetchEmbeddings(ctx, provider, texts)
+	if err != nil {
+		return nil, err
+	}
+	return client.toKeys(provider, vecs)
+}
+
+// fetchEmbeddings returns provider's raw vectors for texts, one per text in
+// the same order; callers index them alongside texts
+func fetchEmbeddings(ctx context.Context, provider embedding.EmbeddingProvider, texts []string) ([][]float32, error) {
+	var vecs [][]float32
+	if batch, ok := provider.(embedding.BatchEmbeddingProvider); ok {
+		var err error
+		if vecs, err = batch.GetEmbeddings(ctx, texts); err != nil {
+			return nil, fmt.Errorf("embedding error: %w", err)
+		}
+		if len(vecs) != len(texts) {
+			return nil, fmt.Errorf("embedding error: %s returned %d vectors for %d texts", provider.Name(), len(vecs), len(texts))
+		}
+	} else {
+		for _, text := range texts {
+			vec, err := provider.GetEmbedding(ctx, text)
+			if err != nil {
+				return nil, fmt.Errorf("embedding error: %w", err)
+			}
+			vecs = append(vecs, vec)
+		}
+	}
+	return vecs, nil
+}
+
+// toKeys checks provider's embeddings against the tree's vector width and
+// turns them into keys, through the tree's projection if it has one
+func (client *Client) toKeys(provider embedding.EmbeddingProvider, vecs [][]float32) ([][512]float32, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	tree, err := client.settings()
+	if err != nil {
+		return nil, fmt.Errorf("tree loading error: %w", err)
+	}
+
+	keys := make([][512]float32, len(vecs))
+	for i, vec := range vecs {
+		if err := embedding.CheckDimensions(provider, vec, tree.VectorDims()); err != nil {
+			return nil, err
+		}
+		if keys[i], err = tree.VectorKey(vec); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
 // CurationResult represents a single memory extracted by the curation agent
 type CurationResult struct {
 	Key       string `json:"key"`
@@ -293,9 +1507,11 @@ Return ONLY valid JSON array, no markdown:
 		return nil, fmt.Errorf("failed to parse LLM response as JSON: %w", err)
 	}
 
-	// Insert each memory with configured delay
+	// Embed each memory with configured delay, storing all of them or none
+	batch := client.Begin()
+	defer batch.Discard()
 	for i, result := range results {
-		if err := client.Insert(result.Key, result.Text); err != nil {
+		if err := batch.Insert(result.Key, result.Text); err != nil {
 			return nil, fmt.Errorf("failed to insert memory %d: %w", i, err)
 		}
 
@@ -304,6 +1520,9 @@ Return ONLY valid JSON array, no markdown:
 			time.Sleep(time.Duration(timeoutMs) * time.Millisecond)
 		}
 	}
+	if err := batch.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to store memories: %w", err)
+	}
 
 	fmt.Printf("\nAgent curation complete: %d memories created\n", len(results))
 	for i, result := range results {
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"Hippocampus/src/embedding"
+	"Hippocampus/src/storage"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestNewFromConfig(t *testing.T) {
+	backend := storage.NewMemory()
+	embedder := embedding.NewMockProvider(512)
+	cfg := aws.Config{Region: "ap-southeast-2", AppID: "hippocampus-test"}
+
+	c, err := NewFromConfig(backend, cfg, embedder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetVerbose(false)
+	if c.Storage != backend || c.Embedder != embedder {
+		t.Fatal("client does not use the given backend and embedder")
+	}
+	if c.Region != "ap-southeast-2" || c.AWS.AppID != "hippocampus-test" {
+		t.Fatalf("client region %q, app ID %q; want the given config's", c.Region, c.AWS.AppID)
+	}
+
+	if err := c.Insert("k", "a memory"); err != nil {
+		t.Fatal(err)
+	}
+	results, err := c.Search("a memory", 0.5, 0.5, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("search returned %v, want the inserted memory", results)
+	}
+
+	if _, err := NewFromConfig(nil, cfg, embedder); err == nil {
+		t.Error("nil backend accepted")
+	}
+	if _, err := NewFromConfig(backend, cfg, nil); err == nil {
+		t.Error("nil embedder accepted")
+	}
+}
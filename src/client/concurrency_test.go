@@ -0,0 +1,106 @@
+package client
+
+import (
+	"Hippocampus/src/embedding"
+	hippotypes "Hippocampus/src/types"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// newTestClient opens a client on a fresh database file in a temporary
+// directory, embedding with a MockProvider
+func newTestClient(t *testing.T, path string) *Client {
+	t.Helper()
+	c, err := New(path, "us-east-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetVerbose(false)
+	c.Embedder = embedding.NewMockProvider(512)
+	return c
+}
+
+// TestConcurrentInsertSearchFlush runs inserts, searches and flushes on one
+// client at once, with synchronous and background (AsyncFlush) flushing.
+// Run it with -race; it also checks that every insert reached the file.
+func TestConcurrentInsertSearchFlush(t *testing.T) {
+	for _, async := range []bool{false, true} {
+		t.Run(fmt.Sprintf("async=%v", async), func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "tree.bin")
+			c := newTestClient(t, path)
+			c.AsyncFlush = async
+			c.FlushEvery = 7
+
+			const writers, perWriter = 4, 25
+			var wg sync.WaitGroup
+			errs := make(chan error, 64)
+			for w := 0; w < writers; w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < perWriter; i++ {
+						if err := c.Insert("", fmt.Sprintf("writer %d memory %d", w, i)); err != nil {
+							errs <- err
+							return
+						}
+					}
+				}()
+			}
+			for r := 0; r < 3; r++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < 30; i++ {
+						opts := hippotypes.SearchOptions{Epsilon: 1, Threshold: 0.5, TopK: 5, TrackAccess: i%3 == 0}
+						if _, _, err := c.SearchOpts(fmt.Sprintf("memory %d", i), opts); err != nil {
+							errs <- err
+							return
+						}
+					}
+				}()
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 20; i++ {
+					if err := c.Flush(); err != nil {
+						errs <- err
+						return
+					}
+					if i%5 == 0 {
+						if err := c.WaitFlush(); err != nil {
+							errs <- err
+							return
+						}
+					}
+					if _, err := c.Stats(); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}()
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				t.Fatal(err)
+			}
+
+			if err := c.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			reopened := newTestClient(t, path)
+			count, err := reopened.CountWithFilter(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != writers*perWriter {
+				t.Fatalf("file holds %d nodes, want %d", count, writers*perWriter)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"Hippocampus/src/embedding"
+	"Hippocampus/src/storage"
+	hippotypes "Hippocampus/src/types"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+)
+
+// Config returns the embedding model and settings the database was created
+// with, or nil if they were never recorded
+func (client *Client) Config() (*hippotypes.Config, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	tree, err := client.getTree()
+	if err != nil {
+		return nil, fmt.Errorf("tree loading error: %w", err)
+	}
+	return tree.Config, nil
+}
+
+// checkConfig compares provider with the one recorded in tree's Config. A
+// mismatch is a *hippotypes.ConfigMismatchError with StrictConfig set and
+// otherwise logged, once per client. Call with mu held.
+func (client *Client) checkConfig(tree *hippotypes.Tree, provider embedding.EmbeddingProvider) error {
+	if provider == nil {
+		return nil
+	}
+	err := tree.Config.Check(provider.Name())
+	if err == nil {
+		return nil
+	}
+	if client.StrictConfig {
+		return err
+	}
+	if !client.configWarned {
+		client.configWarned = true
+		log.Printf("hippocampus: warning: %s: %v", client.Storage.Path(), err)
+	}
+	return nil
+}
+
+// recordConfig writes tree's Config on the first insert into an empty tree.
+// provider is what embedded the vectors being inserted, nil when they were
+// precomputed and the model is unknown. Call with mu held.
+func (client *Client) recordConfig(tree *hippotypes.Tree, provider embedding.EmbeddingProvider) {
+	if tree.Config != nil || len(tree.Nodes) > 0 {
+		return
+	}
+	name := ""
+	if provider != nil {
+		name = provider.Name()
+	}
+	tree.Config = hippotypes.NewConfig(name, tree.Normalize)
+}
+
+// ApplyExportHeader readies the database for the nodes of the export h
+// describes. An empty database takes its projection (and so its
+// dimensions), normalization, config and, where it has none of its own,
+// schema. One with nodes must already take vectors as wide, projected the
+// same way and from the same model. Either way the export's radii fill in
+// words missing from the database's table.
+func (client *Client) ApplyExportHeader(h *storage.ExportHeader) error {
+	if err := h.Validate(); err != nil {
+		return err
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	tree, err := client.getTree()
+	if err != nil {
+		return fmt.Errorf("tree loading error: %w", err)
+	}
+
+	if len(tree.Nodes) > 0 {
+		if tree.VectorDims() != h.Dimensions {
+			return fmt.Errorf("cannot import %d-dimension vectors into %s, which takes %d", h.Dimensions, client.Storage.Path(), tree.VectorDims())
+		}
+		if !sameProjection(tree.Projection, h.Projection) {
+			return fmt.Errorf("cannot import into %s: the export's vectors were projected differently", client.Storage.Path())
+		}
+		if h.Config != nil && h.Config.Provider != "" && tree.Config.Check(h.Config.String()) != nil {
+			return fmt.Errorf("cannot import vectors from %s into %s, created with %s", h.Config, client.Storage.Path(), tree.Config)
+		}
+	} else {
+		tree.Projection = h.Projection
+		tree.Normalize = h.Normalize
+		if h.Config != nil {
+			// A retention cap already set on the empty database stays
+			config := *h.Config
+			if tree.Config != nil && tree.Config.Retention != nil {
+				config.Retention = tree.Config.Retention
+			}
+			tree.Config = &config
+		}
+		if tree.Schema == nil {
+			tree.Schema = h.Schema
+		}
+	}
+
+	// A new map, since a background flush may be writing the old one
+	if len(h.Radii) > 0 {
+		table := maps.Clone(h.Radii)
+		maps.Copy(table, tree.Radii)
+		tree.Radii = table
+	}
+
+	client.dirty = true
+	client.treeChanged()
+	return client.flush()
+}
+
+// sameProjection reports whether a and b map vectors identically
+func sameProjection(a, b *hippotypes.Projection) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.InputDims == b.InputDims && a.OutputDims == b.OutputDims && slices.Equal(a.Matrix, b.Matrix)
+}
@@ -0,0 +1,43 @@
+package client
+
+import (
+	"Hippocampus/src/embedding"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// shortBatchProvider's batches come back one vector short
+type shortBatchProvider struct {
+	*embedding.MockProvider
+}
+
+func (p shortBatchProvider) GetEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	vecs, err := p.MockProvider.GetEmbeddings(ctx, texts)
+	if err != nil || len(vecs) == 0 {
+		return vecs, err
+	}
+	return vecs[:len(vecs)-1], nil
+}
+
+func TestShortEmbeddingBatchIsAnError(t *testing.T) {
+	c := newTestClient(t, filepath.Join(t.TempDir(), "tree.bin"))
+	c.Embedder = shortBatchProvider{embedding.NewMockProvider(512)}
+
+	texts := []string{"first", "second", "third"}
+	if _, err := c.Embed(context.Background(), texts); err == nil || !strings.Contains(err.Error(), "2 vectors for 3 texts") {
+		t.Fatalf("Embed error = %v, want a vector count mismatch", err)
+	}
+	if err := c.InsertTexts(texts, nil); err == nil || !strings.Contains(err.Error(), "2 vectors for 3 texts") {
+		t.Fatalf("InsertTexts error = %v, want a vector count mismatch", err)
+	}
+
+	count, err := c.CountWithFilter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Fatalf("%d nodes stored from a short batch", count)
+	}
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"Hippocampus/src/embedding"
+	hippotypes "Hippocampus/src/types"
+	"path/filepath"
+	"testing"
+)
+
+// exampleCosine is the cosine between two hashing embeddings
+func exampleCosine(a, b []float32) float32 {
+	var x, y [512]float32
+	copy(x[:], a)
+	copy(y[:], b)
+	return hippotypes.Cosine(&x, &y)
+}
+
+func TestCentroidLiesBetweenExamples(t *testing.T) {
+	provider := embedding.NewHashingProvider(512, 0)
+	vecs, err := provider.GetEmbeddings(t.Context(), []string{"red apples grow on trees", "green pears ripen slowly"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	centroid, err := hippotypes.MeanVector(vecs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	toA, toB, apart := exampleCosine(centroid, vecs[0]), exampleCosine(centroid, vecs[1]), exampleCosine(vecs[0], vecs[1])
+	if toA <= apart || toB <= apart {
+		t.Errorf("centroid is %.3f and %.3f from its examples, which are %.3f apart; want it closer to each", toA, toB, apart)
+	}
+	if diff := toA - toB; diff > 1e-5 || diff < -1e-5 {
+		t.Errorf("centroid of two unit vectors is %.4f from one and %.4f from the other, want it halfway", toA, toB)
+	}
+}
+
+func TestSearchByExamples(t *testing.T) {
+	c := newTestClient(t, filepath.Join(t.TempDir(), "tree.bin"))
+	memories := []string{
+		"red apples grow on trees",
+		"green pears ripen slowly",
+		"apples and pears in the orchard",
+		"blue ocean waves crash on rocks",
+		"storm clouds over the ocean",
+	}
+	if err := c.InsertTexts(memories, nil); err != nil {
+		t.Fatal(err)
+	}
+	opts := hippotypes.SearchOptions{Epsilon: 100, MaxDistance: 1000, TopK: len(memories)}
+
+	search := func(like, unlike []string) []string {
+		t.Helper()
+		results, _, err := c.SearchByExamples(like, unlike, nil, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return texts(results)
+	}
+	rank := func(found []string, text string) int {
+		for i, f := range found {
+			if f == text {
+				return i
+			}
+		}
+		return len(found)
+	}
+
+	// More like the two fruit memories: fruit first, the ocean last
+	fruit := search([]string{memories[0], memories[1]}, nil)
+	for _, ocean := range memories[3:] {
+		for _, f := range memories[:3] {
+			if rank(fruit, ocean) < rank(fruit, f) {
+				t.Errorf("fruit examples ranked %q above %q: %v", ocean, f, fruit)
+			}
+		}
+	}
+
+	// The orchard without the pears leans to the apples
+	analogy := search([]string{memories[2]}, []string{memories[1]})
+	if rank(analogy, memories[0]) > rank(analogy, memories[1]) {
+		t.Errorf("orchard minus pears ranked the pears above the apples: %v", analogy)
+	}
+
+	// An explicit provider embeds the examples instead of the client's
+	results, _, err := c.SearchByExamples([]string{memories[3]}, nil, embedding.NewMockProvider(512), opts)
+	if err != nil || len(results) == 0 || results[0].Text != memories[3] {
+		t.Errorf("single example with an explicit provider returned %v (%v)", texts(results), err)
+	}
+
+	if _, _, err := c.SearchByExamples(nil, []string{memories[0]}, nil, opts); err == nil {
+		t.Error("search with only negative examples succeeded")
+	}
+	if _, _, err := c.SearchByExamples([]string{memories[0]}, []string{memories[0]}, nil, opts); err == nil {
+		t.Error("examples that cancel out searched anyway")
+	}
+}
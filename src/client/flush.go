@@ -0,0 +1,203 @@
+package client
+
+import (
+	"Hippocampus/src/storage"
+	hippotypes "Hippocampus/src/types"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrConcurrentModification is returned, wrapped, by Flush (and anything
+// else that saves) when another client or process has saved the database
+// since this client loaded it. The unflushed changes are kept; Reload to
+// pick up the other writer's, then insert again and flush.
+var ErrConcurrentModification = storage.ErrConcurrentModification
+
+// Flush writes the cached tree to disk if dirty. With AsyncFlush it hands a
+// snapshot to a background writer and returns at once; a Flush while one is
+// in flight is coalesced into a single follow-up write. Errors from a
+// background write are returned by the next Flush, WaitFlush or Close.
+func (client *Client) Flush() error {
+	_, err := client.FlushStats()
+	return err
+}
+
+// WaitFlush blocks until any background flush has finished
+func (client *Client) WaitFlush() error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.waitFlush()
+	return client.takeFlushErr()
+}
+
+// Reload drops the cached tree and loads the database again, for a client
+// whose Flush failed with ErrConcurrentModification. Unflushed changes,
+// including access counts, would be lost, so unless discard is set Reload
+// returns ErrUnflushedChanges while there are any.
+func (client *Client) Reload(discard bool) error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.waitFlush()
+	if !discard && (client.dirty || client.cachedTree != nil && client.cachedTree.PendingAccess() > 0) {
+		return ErrUnflushedChanges
+	}
+
+	client.cachedTree = nil
+	client.dirty = false
+	client.flushErr = nil
+	client.treeChanged()
+
+	tree, err := client.getTree()
+	if err != nil {
+		return fmt.Errorf("tree loading error: %w", err)
+	}
+	client.Metrics.SetNodeCount(len(tree.Nodes))
+	return nil
+}
+
+// autoFlushDue reports whether a single insert that left the tree holding
+// nodes nodes should flush; see FlushEvery
+func (client *Client) autoFlushDue(nodes int) bool {
+	every := client.FlushEvery
+	if every == 0 {
+		every = DefaultFlushEvery
+	}
+	return every > 0 && nodes%every == 0
+}
+
+// flush is Flush for callers that already hold mu
+func (client *Client) flush() error {
+	if client.cachedTree == nil {
+		return client.takeFlushErr()
+	}
+	// Tracked searches leave their hits for the flush to write, so a
+	// search makes no copy of the nodes
+	if client.cachedTree.ApplyAccess() > 0 {
+		client.dirty = true
+		client.treeChanged()
+	}
+	if !client.dirty {
+		return client.takeFlushErr()
+	}
+
+	if !client.AsyncFlush {
+		// A flush that takes the database over its retention cap evicts and
+		// saves again
+		for round := 0; ; round++ {
+			if err := client.save(client.cachedTree); err != nil {
+				return err
+			}
+			client.dirty = false
+			client.lastFlush = time.Now()
+			size, err := client.Storage.Size()
+			if err == nil {
+				client.written = size
+			}
+			if err != nil || round == maxEvictionRounds || client.evict(client.cachedTree, size) == 0 {
+				return nil
+			}
+		}
+	}
+
+	client.dirty = false
+	if client.flushing {
+		client.flushPending = true
+		return client.takeFlushErr()
+	}
+
+	client.flushing = true
+	go client.flushInBackground(client.snapshot())
+	return client.takeFlushErr()
+}
+
+// snapshot copies the tree's slice header. Nodes are never modified after
+// insert, deletes swap in a new slice, and the capacity is clipped, so later
+// changes cannot show through. Radii, Projection, Schema and Config are
+// shared the same way: they are replaced, never edited.
+func (client *Client) snapshot() *hippotypes.Tree {
+	t := client.cachedTree
+	return &hippotypes.Tree{
+		Nodes:      t.Nodes[:len(t.Nodes):len(t.Nodes)],
+		Normalize:  t.Normalize,
+		Radii:      t.Radii,
+		Projection: t.Projection,
+		Schema:     t.Schema,
+		Config:     t.Config,
+	}
+}
+
+func (client *Client) flushInBackground(snap *hippotypes.Tree) {
+	for {
+		err := client.save(snap)
+		size, sizeErr := client.Storage.Size()
+
+		client.mu.Lock()
+		if err != nil {
+			// Keep the data marked dirty so the next Flush retries it
+			client.flushErr = err
+			client.dirty = true
+		} else {
+			client.lastFlush = time.Now()
+			// size only describes the tree if nothing was inserted since
+			// the snapshot; otherwise the next flush checks again
+			if sizeErr == nil && len(client.cachedTree.Nodes) == len(snap.Nodes) && client.evict(client.cachedTree, size) > 0 {
+				client.dirty = false
+				client.flushPending = true
+			}
+		}
+
+		if client.flushPending && err == nil {
+			client.flushPending = false
+			snap = client.snapshot()
+			client.mu.Unlock()
+			continue
+		}
+
+		client.flushPending = false
+		client.flushing = false
+		client.flushCond().Broadcast()
+		client.mu.Unlock()
+		return
+	}
+}
+
+// save writes t under the storage write lock
+func (client *Client) save(t *hippotypes.Tree) error {
+	flushStart := time.Now()
+	unlock, err := client.Storage.Lock()
+	if err != nil {
+		return fmt.Errorf("lock error: %w", err)
+	}
+	err = client.Storage.Save(t)
+	unlock()
+	if err != nil {
+		return err
+	}
+	client.Metrics.ObserveFlush(time.Since(flushStart))
+	return nil
+}
+
+// waitFlush waits for the background writer; callers hold mu
+func (client *Client) waitFlush() {
+	for client.flushing {
+		client.flushCond().Wait()
+	}
+}
+
+func (client *Client) flushCond() *sync.Cond {
+	if client.flushDone == nil {
+		client.flushDone = sync.NewCond(&client.mu)
+	}
+	return client.flushDone
+}
+
+func (client *Client) takeFlushErr() error {
+	err := client.flushErr
+	client.flushErr = nil
+	if err != nil {
+		return fmt.Errorf("background flush failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// Two clients over one file, like the CLI and a serve process: the second
+// flush is refused until its client reloads
+func TestFlushRefusesConcurrentModification(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.bin")
+	cli, serve := newTestClient(t, path), newTestClient(t, path)
+	cli.FlushEvery, serve.FlushEvery = -1, -1
+
+	if err := cli.Insert("a", "from cli"); err != nil {
+		t.Fatal(err)
+	}
+	if err := serve.Insert("b", "from serve"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	err := serve.Flush()
+	if !errors.Is(err, ErrConcurrentModification) {
+		t.Fatalf("second flush: %v, want ErrConcurrentModification", err)
+	}
+	if got := stored(t, newTestClient(t, path)); !slices.Equal(got, []string{"from cli"}) {
+		t.Fatalf("file holds %v after the refused flush, want only the first client's insert", got)
+	}
+
+	// The refused insert is kept, so reloading has to be asked to drop it
+	if err := serve.Reload(false); !errors.Is(err, ErrUnflushedChanges) {
+		t.Fatalf("reload with unflushed changes: %v, want ErrUnflushedChanges", err)
+	}
+	if err := serve.Reload(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := serve.Insert("b", "from serve"); err != nil {
+		t.Fatal(err)
+	}
+	if err := serve.Flush(); err != nil {
+		t.Fatalf("flush after reloading: %v", err)
+	}
+	if got := stored(t, newTestClient(t, path)); !slices.Equal(got, []string{"from cli", "from serve"}) {
+		t.Fatalf("file holds %v, want both inserts", got)
+	}
+
+	// Now the first client is behind
+	if err := cli.Insert("c", "late"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.Flush(); !errors.Is(err, ErrConcurrentModification) {
+		t.Errorf("flush of the client now behind: %v, want ErrConcurrentModification", err)
+	}
+}
+
+func TestAsyncFlushReportsConcurrentModification(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.bin")
+	first, second := newTestClient(t, path), newTestClient(t, path)
+	second.AsyncFlush = true
+	first.FlushEvery, second.FlushEvery = -1, -1
+
+	if err := second.Insert("a", "background"); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Insert("b", "foreground"); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The background write fails; WaitFlush hands its error back
+	if err := second.Flush(); err != nil {
+		t.Fatalf("starting the background flush: %v", err)
+	}
+	if err := second.WaitFlush(); !errors.Is(err, ErrConcurrentModification) {
+		t.Errorf("background flush: %v, want ErrConcurrentModification", err)
+	}
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"Hippocampus/src/embedding"
+	"testing"
+)
+
+// TestHybridSearchRareTokenWinsOnKeywords stores several notes sharing the
+// query's common words and one that only shares its rare part number.
+// Vector search ranks the notes about the router first; weighting keywords
+// puts the part number's note on top, since BM25 weighs a token found in
+// one note far above words found in most of them.
+func TestHybridSearchRareTokenWinsOnKeywords(t *testing.T) {
+	c, err := NewInMemory(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetVerbose(false)
+	c.Embedder = embedding.NewHashingProvider(512, 42)
+
+	const target = "Order replacement antenna xq7741 from the supplier"
+	notes := []string{
+		"The router keeps dropping the connection after the firmware update",
+		"After the firmware update the router dropped the wifi connection again",
+		"Router connection drops every evening since the update",
+		"The office router keeps rebooting after the firmware update",
+		"Wifi connection from the router is slow after the update",
+		target,
+	}
+	if err := c.InsertTexts(notes, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	const query = "router firmware update xq7741"
+
+	vector, err := c.HybridSearch(query, 1, len(notes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rank := rankOf(vector, target); rank == 0 {
+		t.Fatalf("pure vector search already ranks the exact match first: %v", texts(vector))
+	}
+
+	keywords, err := c.HybridSearch(query, 0.2, len(notes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rank := rankOf(keywords, target); rank != 0 {
+		t.Fatalf("with alpha 0.2 the exact match ranks %d: %v", rank, texts(keywords))
+	}
+}
+
+// rankOf is text's position in results, -1 when it is missing
+func rankOf(results []SearchResult, text string) int {
+	for i, r := range results {
+		if r.Text == text {
+			return i
+		}
+	}
+	return -1
+}
+
+func texts(results []SearchResult) []string {
+	values := make([]string, len(results))
+	for i, r := range results {
+		values[i] = r.Text
+	}
+	return values
+}
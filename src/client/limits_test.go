@@ -0,0 +1,58 @@
+package client
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInsertSizeLimits(t *testing.T) {
+	c := newTestClient(t, filepath.Join(t.TempDir(), "tree.bin"))
+	if c.MaxValueSize != DefaultMaxValueSize || c.MaxMetadataSize != DefaultMaxMetadataSize {
+		t.Fatalf("limits %d and %d, want the defaults", c.MaxValueSize, c.MaxMetadataSize)
+	}
+
+	huge := strings.Repeat("x", DefaultMaxValueSize+1)
+	if err := c.Insert("huge", huge); !errors.Is(err, ErrValueTooLarge) {
+		t.Errorf("value over the default limit: %v, want ErrValueTooLarge", err)
+	}
+	if err := c.Insert("fits", huge[:DefaultMaxValueSize]); err != nil {
+		t.Errorf("value at the default limit: %v", err)
+	}
+
+	big := map[string]string{"notes": strings.Repeat("y", DefaultMaxMetadataSize)}
+	if err := c.InsertWithMetadata("big", "small text", big); !errors.Is(err, ErrMetadataTooLarge) {
+		t.Errorf("metadata over the default limit: %v, want ErrMetadataTooLarge", err)
+	}
+
+	// Keys count towards the metadata size as well as values
+	c.MaxMetadataSize = 10
+	if err := c.CheckSize("", map[string]string{"abcdef": "ghij"}, nil); err != nil {
+		t.Errorf("10 bytes of metadata: %v", err)
+	}
+	if err := c.CheckSize("", map[string]string{"abcdef": "ghijk"}, nil); !errors.Is(err, ErrMetadataTooLarge) {
+		t.Errorf("11 bytes of metadata: %v, want ErrMetadataTooLarge", err)
+	}
+
+	// The stamped timestamp counts too, so restore room for it
+	c.MaxValueSize, c.MaxMetadataSize = 5, DefaultMaxMetadataSize
+	keys, err := c.embedAll(t.Context(), c.Embedder, []string{"ok", "too long"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := len(stored(t, c))
+	err = c.BatchInsert([]VectorRecord{{Key: keys[0], Text: "ok"}, {Key: keys[1], Text: "too long"}})
+	if !errors.Is(err, ErrValueTooLarge) {
+		t.Errorf("batch with one long value: %v, want ErrValueTooLarge", err)
+	}
+	if after := len(stored(t, c)); after != before {
+		t.Errorf("rejected batch stored %d nodes", after-before)
+	}
+
+	// 0 disables each check
+	c.MaxValueSize, c.MaxMetadataSize = 0, 0
+	if err := c.InsertWithMetadata("unlimited", huge, big); err != nil {
+		t.Errorf("with the limits disabled: %v", err)
+	}
+}
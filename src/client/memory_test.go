@@ -0,0 +1,101 @@
+package client
+
+import (
+	"Hippocampus/src/embedding"
+	"Hippocampus/src/storage"
+	hippotypes "Hippocampus/src/types"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// newMemoryClient is an in-memory client with a hashing embedder
+func newMemoryClient(t *testing.T) *Client {
+	t.Helper()
+	c, err := NewInMemory(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetVerbose(false)
+	c.Embedder = embedding.NewMockProvider(512)
+	return c
+}
+
+func TestInMemoryClientNeverTouchesDisk(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	c := newMemoryClient(t)
+
+	for _, m := range []struct{ text, topic string }{
+		{"red apples grow on trees", "fruit"},
+		{"green pears ripen slowly", "fruit"},
+		{"storm clouds over the ocean", "weather"},
+	} {
+		if err := c.InsertWithMetadata(m.text, m.text, map[string]string{"topic": m.topic}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	results, _, err := c.SearchOpts("apples", hippotypes.SearchOptions{Epsilon: 100, MaxDistance: 1000, TopK: 3, Filter: &hippotypes.Filter{Metadata: map[string]string{"topic": "fruit"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := texts(results); len(got) != 2 || got[0] != "red apples grow on trees" {
+		t.Errorf("filtered search returned %v", got)
+	}
+	if n, err := c.DeleteWhere(&hippotypes.Filter{Metadata: map[string]string{"topic": "weather"}}); err != nil || n != 1 {
+		t.Errorf("deleted %d nodes (%v), want 1", n, err)
+	}
+	if got := stored(t, c); len(got) != 2 {
+		t.Errorf("stored %v after the delete", got)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("in-memory client wrote %v", entries)
+	}
+	if c.Storage.Path() != ":memory:" {
+		t.Errorf("in-memory storage reports path %q", c.Storage.Path())
+	}
+}
+
+func TestInMemoryClientExports(t *testing.T) {
+	dir := t.TempDir()
+	c := newMemoryClient(t)
+	c.FlushEvery = -1
+	if err := c.InsertTexts([]string{"one", "two"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// ExportTo includes inserts not yet flushed
+	exported := filepath.Join(dir, "exported.bin")
+	if err := c.ExportTo(exported); err != nil {
+		t.Fatal(err)
+	}
+	if got := stored(t, newTestClient(t, exported)); !slices.Equal(got, []string{"one", "two"}) {
+		t.Errorf("exported file holds %v", got)
+	}
+
+	// Close writes to the storage's ExportPath
+	closed := filepath.Join(dir, "closed.bin")
+	c.Storage.(*storage.MemoryStorage).ExportPath = closed
+	if err := c.Insert("three", "three"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := stored(t, newTestClient(t, closed)); !slices.Equal(got, []string{"one", "three", "two"}) {
+		t.Errorf("file written on Close holds %v", got)
+	}
+
+	if _, err := NewInMemory(768); err == nil {
+		t.Error("in-memory client of 768 dimensions created")
+	}
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"Hippocampus/src/embedding"
+	hippotypes "Hippocampus/src/types"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+// scaledClient stores vectors of assorted lengths, plus a 10x copy of the
+// first, and scripts "query" and "query x10" as a vector and its 10x copy
+func scaledClient(t *testing.T, normalize bool) *Client {
+	t.Helper()
+	c, err := NewInMemory(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetVerbose(false)
+	c.Normalize = normalize
+	mock := embedding.NewMockProvider(512)
+	c.Embedder = mock
+
+	rng := rand.New(rand.NewPCG(10, 10))
+	vector := func(length float64) []float32 {
+		vec := make([]float32, 512)
+		for i := range vec {
+			vec[i] = float32(rng.NormFloat64() * length)
+		}
+		return vec
+	}
+	scale := func(vec []float32, by float32) []float32 {
+		scaled := make([]float32, len(vec))
+		for i, v := range vec {
+			scaled[i] = v * by
+		}
+		return scaled
+	}
+
+	var texts []string
+	for i := 0; i < 40; i++ {
+		text := fmt.Sprintf("memory %d", i)
+		mock.SetResponse(text, vector(0.2+3*rng.Float64()))
+		texts = append(texts, text)
+	}
+	first, err := mock.GetEmbedding(t.Context(), texts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.SetResponse("memory 0 x10", scale(first, 10))
+	texts = append(texts, "memory 0 x10")
+	if err := c.InsertTexts(texts, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	query := vector(1)
+	mock.SetResponse("query", query)
+	mock.SetResponse("query x10", scale(query, 10))
+	return c
+}
+
+func TestNormalizeRankingIgnoresScale(t *testing.T) {
+	opts := hippotypes.SearchOptions{Epsilon: 100, MaxDistance: 1000, TopK: 15}
+	search := func(c *Client, text string) []SearchResult {
+		t.Helper()
+		results, _, err := c.SearchOpts(text, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != opts.TopK {
+			t.Fatalf("%q returned %d results, want %d", text, len(results), opts.TopK)
+		}
+		return results
+	}
+
+	c := scaledClient(t, true)
+	plain, scaled := search(c, "query"), search(c, "query x10")
+	if !slices.Equal(texts(plain), texts(scaled)) {
+		t.Fatalf("rankings differ:\n%v\n%v", texts(plain), texts(scaled))
+	}
+	for i := range plain {
+		if math.Abs(float64(plain[i].Distance-scaled[i].Distance)) > 1e-5 {
+			t.Errorf("result %d: distance %v for the query, %v for its 10x copy", i, plain[i].Distance, scaled[i].Distance)
+		}
+	}
+
+	// The stored 10x copy is the same key as the original
+	results := search(c, "memory 0")
+	if len(results) < 2 || !slices.Equal(texts(results)[:2], []string{"memory 0", "memory 0 x10"}) ||
+		results[1].Distance > 1e-5 {
+		t.Errorf("memory 0 and its 10x copy should tie at distance 0: %v", results[:2])
+	}
+
+	// Without normalization Euclidean distance favours long vectors
+	// differently at each scale
+	raw := scaledClient(t, false)
+	if slices.Equal(texts(search(raw, "query")), texts(search(raw, "query x10"))) {
+		t.Error("raw keys rank a vector and its 10x copy the same; the comparison above proves nothing")
+	}
+}
@@ -0,0 +1,130 @@
+package client
+
+import (
+	"Hippocampus/src/metrics"
+	hippotypes "Hippocampus/src/types"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// OperationStats describes one insert, search or flush: where the time
+// went and how the database changed. It replaces scraping the TIMING lines
+// the CLI prints. Phases an operation did not run stay zero.
+type OperationStats struct {
+	Operation string // "insert", "search" or "flush"
+
+	Embed  time.Duration
+	Load   time.Duration
+	Insert time.Duration
+	Search time.Duration
+	Flush  time.Duration
+
+	NodesBefore int
+	NodesAfter  int
+	Results     int  // Search hits
+	Truncated   bool // SearchOptions.MaxCandidates or Deadline stopped the search early
+
+	// Hint says why a search with SearchOptions.Hint found nothing; nil
+	// for every other operation
+	Hint *hippotypes.SearchHint
+
+	// BytesWritten is the database size after a synchronous flush (the
+	// whole file is rewritten); 0 when nothing was written or the write
+	// went to the background
+	BytesWritten int64
+}
+
+// MarshalJSON writes durations as fractional milliseconds, like the TIMING lines
+func (s OperationStats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Operation    string  `json:"operation"`
+		EmbedMs      float64 `json:"embed_ms"`
+		LoadMs       float64 `json:"load_ms"`
+		InsertMs     float64 `json:"insert_ms"`
+		SearchMs     float64 `json:"search_ms"`
+		FlushMs      float64 `json:"flush_ms"`
+		NodesBefore  int     `json:"nodes_before"`
+		NodesAfter   int     `json:"nodes_after"`
+		Results      int     `json:"results"`
+		Truncated    bool    `json:"truncated,omitempty"`
+		BytesWritten int64   `json:"bytes_written"`
+
+		Hint *hippotypes.SearchHint `json:"hint,omitempty"`
+	}{
+		Operation:    s.Operation,
+		EmbedMs:      millis(s.Embed),
+		LoadMs:       millis(s.Load),
+		InsertMs:     millis(s.Insert),
+		SearchMs:     millis(s.Search),
+		FlushMs:      millis(s.Flush),
+		NodesBefore:  s.NodesBefore,
+		NodesAfter:   s.NodesAfter,
+		Results:      s.Results,
+		Truncated:    s.Truncated,
+		BytesWritten: s.BytesWritten,
+		Hint:         s.Hint,
+	})
+}
+
+func (s OperationStats) String() string {
+	return fmt.Sprintf("%s: embed %s, load %s, insert %s, search %s, flush %s, nodes %d -> %d, %d results, %d bytes written",
+		s.Operation, s.Embed, s.Load, s.Insert, s.Search, s.Flush, s.NodesBefore, s.NodesAfter, s.Results, s.BytesWritten)
+}
+
+// AddFlush folds a follow-up FlushStats into an insert's stats, for callers
+// that flush after every insert
+func (s *OperationStats) AddFlush(flush OperationStats) {
+	s.Flush += flush.Flush
+	if flush.BytesWritten > 0 {
+		s.BytesWritten = flush.BytesWritten
+	}
+}
+
+func millis(d time.Duration) float64 {
+	return d.Seconds() * 1000
+}
+
+func (s OperationStats) insertTiming() metrics.InsertTiming {
+	return metrics.InsertTiming{Embed: s.Embed, Load: s.Load, Insert: s.Insert, Flush: s.Flush}
+}
+
+func (s OperationStats) searchTiming() metrics.SearchTiming {
+	return metrics.SearchTiming{Embed: s.Embed, Load: s.Load, Search: s.Search, Results: s.Results}
+}
+
+// LastStats returns the stats of the most recent insert, search or flush
+// made through InsertStats, SearchStats, FlushStats or the methods built on
+// them (Insert, SearchWithOptions, Flush, ...)
+func (client *Client) LastStats() OperationStats {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	return client.lastStats
+}
+
+// FlushStats is Flush that also reports how long the write took and how
+// large the database is afterwards
+func (client *Client) FlushStats() (OperationStats, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	stats := OperationStats{Operation: "flush"}
+	if client.cachedTree != nil {
+		stats.NodesBefore = len(client.cachedTree.Nodes)
+		stats.NodesAfter = stats.NodesBefore
+	}
+	err := client.flushTimed(&stats)
+	client.lastStats = stats
+	return stats, err
+}
+
+// flushTimed is flush recording its duration and bytes written in stats;
+// callers hold mu
+func (client *Client) flushTimed(stats *OperationStats) error {
+	client.written = 0
+	flushStart := time.Now()
+	err := client.flush()
+	stats.Flush = time.Since(flushStart)
+	stats.BytesWritten = client.written
+	return err
+}
@@ -0,0 +1,101 @@
+package client
+
+import (
+	hippotypes "Hippocampus/src/types"
+	"context"
+	"fmt"
+)
+
+// SetProjection stores p in the database so every vector inserted or
+// searched for from now on goes through it. Existing keys would not match
+// projected queries, so only an empty database accepts one; migrate a full
+// database with Tree.Reproject instead.
+func (client *Client) SetProjection(p *hippotypes.Projection) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	tree, err := client.getTree()
+	if err != nil {
+		return fmt.Errorf("tree loading error: %w", err)
+	}
+	if len(tree.Nodes) > 0 {
+		return fmt.Errorf("database already holds %d nodes; reproject it instead", len(tree.Nodes))
+	}
+
+	tree.Projection = p
+	client.dirty = true
+	client.treeChanged()
+
+	return client.flush()
+}
+
+// SetDimensions makes an empty database store dims-wide keys from the
+// client's embedder: its vectors are copied when they are already dims wide
+// and randomly projected down otherwise (see hippotypes.RandomProjection).
+// A database already storing dims-wide keys from vectors that wide is left
+// as it is; any other with nodes in it is an error.
+func (client *Client) SetDimensions(dims int) error {
+	if dims <= 0 || dims > 512 {
+		return fmt.Errorf("dimensions must be in [1, 512], got %d", dims)
+	}
+	width, err := client.Embedder.Dimensions()
+	if err != nil {
+		return fmt.Errorf("embedding dimensions: %w", err)
+	}
+	if dims > width {
+		return fmt.Errorf("cannot store %d dimensions from %s, which produces %d", dims, client.Embedder.Name(), width)
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	tree, err := client.getTree()
+	if err != nil {
+		return fmt.Errorf("tree loading error: %w", err)
+	}
+
+	keyDims := 512
+	if tree.Projection != nil {
+		keyDims = tree.Projection.OutputDims
+	}
+	if keyDims == dims && tree.VectorDims() == width {
+		return nil
+	}
+	if len(tree.Nodes) > 0 {
+		return fmt.Errorf("database stores %d dimensions from %d-dimension vectors, not %d from %d", keyDims, tree.VectorDims(), dims, width)
+	}
+
+	var p *hippotypes.Projection
+	switch {
+	case dims == width && dims == 512:
+		// Plain tree keys need no projection
+	case dims == width:
+		p, err = hippotypes.IdentityProjection(dims)
+	default:
+		p, err = hippotypes.RandomProjection(width, dims, 1)
+	}
+	if err != nil {
+		return err
+	}
+
+	tree.Projection = p
+	client.dirty = true
+	client.treeChanged()
+
+	return client.flush()
+}
+
+// TrainProjection embeds sample texts with the client's embedder and fits a
+// PCA projection onto targetDims components (see hippotypes.TrainProjection).
+// Nothing is stored; pass the result to SetProjection to keep it.
+func (client *Client) TrainProjection(texts []string, targetDims int) (*hippotypes.Projection, error) {
+	vecs, err := fetchEmbeddings(context.Background(), client.Embedder, texts)
+	if err != nil {
+		return nil, err
+	}
+	return hippotypes.TrainProjection(vecs, targetDims)
+}
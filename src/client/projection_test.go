@@ -0,0 +1,140 @@
+package client
+
+import (
+	"Hippocampus/src/embedding"
+	"Hippocampus/src/storage"
+	hippotypes "Hippocampus/src/types"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+var projectionMemories = []string{
+	"red apples grow on trees",
+	"green pears ripen slowly",
+	"storm clouds over the ocean",
+	"waves crash on rocks",
+	"the train leaves at noon",
+}
+
+// newWideClient is a test client whose embedder returns dims-wide vectors
+func newWideClient(t *testing.T, path string, dims int) *Client {
+	t.Helper()
+	c := newTestClient(t, path)
+	c.Embedder = embedding.NewMockProvider(dims)
+	return c
+}
+
+// Callers keep inserting and searching with wide vectors; the tree only
+// ever sees projected keys
+func TestProjectionAppliesToInsertAndSearch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.bin")
+	c := newWideClient(t, path, 768)
+
+	sample := append(projectionMemories, "apples and pears in the orchard", "a storm at sea")
+	p, err := c.TrainProjection(sample, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.InputDims != 768 || p.OutputDims != 6 {
+		t.Fatalf("trained a %d -> %d projection", p.InputDims, p.OutputDims)
+	}
+	if err := c.SetProjection(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.InsertTexts(projectionMemories, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := storage.New(path).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Projection == nil || tree.Projection.InputDims != 768 || tree.Projection.OutputDims != 6 {
+		t.Fatalf("stored projection %+v", tree.Projection)
+	}
+	for _, n := range tree.Nodes {
+		for d := 6; d < 512; d++ {
+			if n.Key[d] != 0 {
+				t.Fatalf("%q has key dimension %d set past the projection", n.Value, d)
+			}
+		}
+	}
+
+	// A reopened client projects its queries through the stored matrix
+	reopened := newWideClient(t, path, 768)
+	for _, text := range projectionMemories {
+		results, _, err := reopened.SearchOpts(text, hippotypes.SearchOptions{Epsilon: 100, MaxDistance: 1000, TopK: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results[0].Text != text {
+			t.Errorf("search for %q found %v", text, texts(results))
+		}
+	}
+
+	// A plain 512-dimension embedder no longer fits
+	if err := newTestClient(t, path).Insert("k", "too narrow"); err == nil {
+		t.Error("512-dimension vector inserted into a 768-dimension projected database")
+	}
+	if err := c.SetProjection(p); err == nil {
+		t.Error("projection replaced on a database with nodes")
+	}
+}
+
+func TestSetDimensions(t *testing.T) {
+	dir := t.TempDir()
+	cases := []struct {
+		embedderDims, dims int
+		input, output      int // 0 means no projection
+	}{
+		{512, 512, 0, 0},
+		{512, 128, 512, 128},
+		{1024, 256, 1024, 256},
+		{64, 64, 64, 64},
+	}
+	for i, tc := range cases {
+		path := filepath.Join(dir, fmt.Sprintf("tree%d.bin", i))
+		c := newWideClient(t, path, tc.embedderDims)
+		if err := c.SetDimensions(tc.dims); err != nil {
+			t.Fatalf("%d from %d: %v", tc.dims, tc.embedderDims, err)
+		}
+		if err := c.Insert("k", "a memory"); err != nil {
+			t.Fatalf("%d from %d: %v", tc.dims, tc.embedderDims, err)
+		}
+		if err := c.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		tree, err := storage.New(path).Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch p := tree.Projection; {
+		case tc.output == 0 && p != nil:
+			t.Errorf("%d from %d stored projection %d -> %d, want none", tc.dims, tc.embedderDims, p.InputDims, p.OutputDims)
+		case tc.output != 0 && (p == nil || p.InputDims != tc.input || p.OutputDims != tc.output):
+			t.Errorf("%d from %d stored projection %+v, want %d -> %d", tc.dims, tc.embedderDims, p, tc.input, tc.output)
+		}
+
+		// Asking again for the same width is fine; another is not, once there are nodes
+		if err := c.SetDimensions(tc.dims); err != nil {
+			t.Errorf("repeating SetDimensions(%d): %v", tc.dims, err)
+		}
+		if tc.dims > 32 {
+			if err := c.SetDimensions(32); err == nil {
+				t.Errorf("width of a database with nodes changed from %d to 32", tc.dims)
+			}
+		}
+	}
+
+	c := newWideClient(t, filepath.Join(dir, "narrow.bin"), 64)
+	for _, dims := range []int{0, 128, 513} {
+		if err := c.SetDimensions(dims); err == nil {
+			t.Errorf("SetDimensions(%d) accepted from a 64-dimension embedder", dims)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package client
+
+import (
+	hippotypes "Hippocampus/src/types"
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"strings"
+)
+
+// DissimilarLabel marks a calibration pair that should fall outside every
+// radius
+const DissimilarLabel = "dissimilar"
+
+// RadiusPair is a labelled calibration example: Label is the radius word
+// the two texts should match at, or DissimilarLabel
+type RadiusPair struct {
+	A     string `json:"a"`
+	B     string `json:"b"`
+	Label string `json:"label"`
+}
+
+// RadiusValue resolves a radius word against the database's own table, then
+// the global one
+func (client *Client) RadiusValue(word string) (float32, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	tree, err := client.getTree()
+	if err != nil {
+		return 0, fmt.Errorf("tree loading error: %w", err)
+	}
+
+	epsilon, ok := tree.GetRadiusValue(word)
+	if !ok {
+		return 0, fmt.Errorf("unknown radius %q", word)
+	}
+	return epsilon, nil
+}
+
+// RadiusTable lists every radius word the database understands
+func (client *Client) RadiusTable() (map[string]float32, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	tree, err := client.getTree()
+	if err != nil {
+		return nil, fmt.Errorf("tree loading error: %w", err)
+	}
+	return tree.RadiusTable(), nil
+}
+
+// SetRadii merges radii into the database's own radius table and flushes,
+// so the calibration travels with the file
+func (client *Client) SetRadii(radii map[string]float32) error {
+	for word, epsilon := range radii {
+		if strings.TrimSpace(word) == "" {
+			return fmt.Errorf("radius word is empty")
+		}
+		if !(epsilon > 0) || math.IsInf(float64(epsilon), 0) {
+			return fmt.Errorf("radius %q: epsilon must be positive, got %v", word, epsilon)
+		}
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	tree, err := client.getTree()
+	if err != nil {
+		return fmt.Errorf("tree loading error: %w", err)
+	}
+
+	// A new map, since a background flush may be writing the old one
+	table := maps.Clone(tree.Radii)
+	if table == nil {
+		table = make(map[string]float32, len(radii))
+	}
+	for word, epsilon := range radii {
+		table[strings.ToLower(strings.TrimSpace(word))] = epsilon
+	}
+	tree.Radii = table
+	client.dirty = true
+	client.treeChanged()
+
+	return client.flush()
+}
+
+// Calibrate embeds every pair and fits an epsilon for each radius word that
+// labels at least one pair, using the DissimilarLabel pairs as negatives
+// (see hippotypes.FitRadius). Nothing is stored; pass the epsilons to
+// SetRadii to keep them.
+func (client *Client) Calibrate(pairs []RadiusPair) (map[string]hippotypes.RadiusFit, error) {
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("no calibration pairs")
+	}
+
+	texts := make([]string, 0, 2*len(pairs))
+	for i, pair := range pairs {
+		if pair.A == "" || pair.B == "" {
+			return nil, fmt.Errorf("pair %d: both texts are required", i)
+		}
+		if strings.TrimSpace(pair.Label) == "" {
+			return nil, fmt.Errorf("pair %d: label is required", i)
+		}
+		texts = append(texts, pair.A, pair.B)
+	}
+
+	keys, err := client.embedAll(context.Background(), client.Embedder, texts)
+	if err != nil {
+		return nil, err
+	}
+
+	client.mu.Lock()
+	tree, err := client.getTree()
+	if err == nil {
+		// Normalize like stored keys so distances match what search sees
+		for i := range keys {
+			if keys[i], err = tree.PrepareKey(keys[i]); err != nil {
+				err = fmt.Errorf("pair %d: %w", i/2, err)
+				break
+			}
+		}
+	}
+	client.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	distances := make(map[string][]float32)
+	for i, pair := range pairs {
+		label := strings.ToLower(strings.TrimSpace(pair.Label))
+		distances[label] = append(distances[label], hippotypes.BoxDistance(&keys[2*i], &keys[2*i+1]))
+	}
+
+	fits := make(map[string]hippotypes.RadiusFit)
+	for label, positive := range distances {
+		if label == DissimilarLabel {
+			continue
+		}
+		if fit, ok := hippotypes.FitRadius(positive, distances[DissimilarLabel]); ok {
+			fits[label] = fit
+		}
+	}
+	if len(fits) == 0 {
+		return nil, fmt.Errorf("no pairs are labelled with a radius word, only %q", DissimilarLabel)
+	}
+	return fits, nil
+}
+
+// SuggestRadii samples the database's own vectors as queries and recommends
+// an epsilon for each radius word whose search box holds a query's k exact
+// nearest neighbours (see hippotypes.Tree.SuggestEpsilon). Nothing is
+// stored; pass the epsilons to SetRadii to keep them.
+func (client *Client) SuggestRadii(k int) (map[string]float32, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	tree, err := client.getTree()
+	if err != nil {
+		return nil, fmt.Errorf("tree loading error: %w", err)
+	}
+	return tree.SuggestEpsilon(nil, k)
+}
@@ -0,0 +1,280 @@
+package client
+
+import (
+	"Hippocampus/src/embedding"
+	"Hippocampus/src/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DefaultReembedBatchSize is how many texts Reembed embeds at a time
+// unless told otherwise
+const DefaultReembedBatchSize = 64
+
+// ReembedFailure is a source node Reembed could not copy
+type ReembedFailure struct {
+	Index int    `json:"index"` // position in the source database
+	Text  string `json:"text"`
+	Error string `json:"error"`
+}
+
+// ReembedResult describes a finished Reembed, counting the work of any
+// earlier runs it resumed
+type ReembedResult struct {
+	Total    int              `json:"total"`
+	Inserted int              `json:"inserted"`
+	Resumed  int              `json:"resumed"` // source nodes handled by earlier runs
+	Failed   []ReembedFailure `json:"failed,omitempty"`
+}
+
+// reembedCheckpoint is written next to the target after every batch
+type reembedCheckpoint struct {
+	Source   string           `json:"source"`
+	Next     int              `json:"next"`     // source nodes handled, inserted or failed
+	Inserted int              `json:"inserted"` // target nodes when it was written
+	Failed   []ReembedFailure `json:"failed,omitempty"`
+}
+
+// ReembedCheckpointPath is where Reembed records its progress into target,
+// or "" for an in-memory target, which cannot be resumed
+func ReembedCheckpointPath(target *Client) string {
+	if _, ok := target.Storage.(*storage.MemoryStorage); ok {
+		return ""
+	}
+	return target.Storage.Path() + ".reembed"
+}
+
+// Reembed copies every node's text, metadata and payload into target,
+// embedded with provider (nil uses target's Embedder), for moving a
+// database to a different model. target's projection, if it has one,
+// applies, so a wider model can be projected down. Nodes stream from the
+// source batchSize at a time (<= 0 means DefaultReembedBatchSize); after
+// each batch target is flushed and a checkpoint written, so a Reembed that
+// was interrupted carries on where it stopped when called again. Texts
+// that fail to embed or insert are collected in the result rather than
+// stopping the run. progress, if not nil, is called after every batch.
+func (client *Client) Reembed(target *Client, provider embedding.EmbeddingProvider, batchSize int, progress func(done, total int)) (ReembedResult, error) {
+	ctx := context.Background()
+
+	if provider == nil {
+		provider = target.Embedder
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultReembedBatchSize
+	}
+	source := client.Storage.Path()
+	if source == target.Storage.Path() && ReembedCheckpointPath(target) != "" {
+		return ReembedResult{}, fmt.Errorf("cannot re-embed %s into itself", source)
+	}
+
+	path := ReembedCheckpointPath(target)
+	cp, err := readReembedCheckpoint(path)
+	if err != nil {
+		return ReembedResult{}, fmt.Errorf("checkpoint error: %w", err)
+	}
+	if cp.Source != "" && cp.Source != source {
+		return ReembedResult{}, fmt.Errorf("checkpoint %s is for %s, not %s", path, cp.Source, source)
+	}
+	cp.Source = source
+
+	existing, err := target.CountWithFilter(nil)
+	if err != nil {
+		return ReembedResult{}, err
+	}
+	if existing > 0 && cp.Next == 0 {
+		return ReembedResult{}, fmt.Errorf("%s already has %d nodes", target.Storage.Path(), existing)
+	}
+	if existing != cp.Inserted {
+		return ReembedResult{}, fmt.Errorf("%s has %d nodes but its checkpoint expects %d; remove both to start over", target.Storage.Path(), existing, cp.Inserted)
+	}
+
+	if err := client.Flush(); err != nil {
+		return ReembedResult{}, err
+	}
+	total, err := storage.CountNodes(client.Storage)
+	if err != nil {
+		return ReembedResult{}, err
+	}
+
+	result := ReembedResult{Total: int(total), Resumed: cp.Next}
+	batch := make([]SearchResult, 0, batchSize)
+	batchStart := 0
+
+	copyBatch := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		inserted, failed, err := target.reembedBatch(ctx, provider, batch, batchStart)
+		if err != nil {
+			return err
+		}
+		cp.Next = batchStart + len(batch)
+		cp.Inserted += inserted
+		cp.Failed = append(cp.Failed, failed...)
+		batch = batch[:0]
+
+		if err := writeReembedCheckpoint(path, cp); err != nil {
+			return fmt.Errorf("checkpoint error: %w", err)
+		}
+		if progress != nil {
+			progress(cp.Next, result.Total)
+		}
+		return nil
+	}
+
+	index := 0
+	var copyErr error
+	err = client.Scan(func(r SearchResult) bool {
+		i := index
+		index++
+		if i < cp.Next {
+			return true
+		}
+		if len(batch) == 0 {
+			batchStart = i
+		}
+		batch = append(batch, r)
+		if len(batch) == batchSize {
+			copyErr = copyBatch()
+		}
+		return copyErr == nil
+	}, nil)
+	if err == nil {
+		err = copyErr
+	}
+	if err == nil {
+		err = copyBatch()
+	}
+
+	result.Inserted = cp.Inserted
+	result.Failed = cp.Failed
+	if err != nil {
+		return result, err
+	}
+
+	if path != "" {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// reembedBatch embeds and inserts batch, whose first node is at source
+// position start. Texts that cannot be embedded, exceed the size limits,
+// or produce a key or carry metadata the tree rejects are returned as
+// failures; the error is for failures that stop the run, such as a failed
+// flush.
+func (client *Client) reembedBatch(ctx context.Context, provider embedding.EmbeddingProvider, batch []SearchResult, start int) (int, []ReembedFailure, error) {
+	var failed []ReembedFailure
+	fail := func(i int, err error) {
+		failed = append(failed, ReembedFailure{Index: start + i, Text: batch[i].Text, Error: err.Error()})
+	}
+
+	texts := make([]string, len(batch))
+	for i, r := range batch {
+		texts[i] = r.Text
+	}
+	keys, batchErr := client.embedAll(ctx, provider, texts)
+
+	records := make([]VectorRecord, 0, len(batch))
+	for i, r := range batch {
+		var key [512]float32
+		if batchErr == nil {
+			key = keys[i]
+		} else {
+			// Embed one at a time to find which texts failed the batch
+			one, err := client.embedAll(ctx, provider, texts[i:i+1])
+			if err != nil {
+				fail(i, err)
+				continue
+			}
+			key = one[0]
+		}
+
+		if err := client.CheckSize(r.Text, r.Metadata, r.Payload); err != nil {
+			fail(i, err)
+			continue
+		}
+		if err := client.checkInsert(key, r.Metadata); err != nil {
+			fail(i, err)
+			continue
+		}
+		records = append(records, VectorRecord{Key: key, Text: r.Text, Metadata: r.Metadata, Payload: r.Payload})
+	}
+
+	if err := client.batchInsert(records, provider); err != nil {
+		return 0, failed, err
+	}
+	// The checkpoint must not get ahead of what is on disk
+	if err := client.WaitFlush(); err != nil {
+		return 0, failed, err
+	}
+	return len(records), failed, nil
+}
+
+// checkInsert reports whether the tree would reject key or metadata on
+// insert, so one bad record can be set aside instead of failing a whole
+// BatchInsert
+func (client *Client) checkInsert(key [512]float32, metadata map[string]string) error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	tree, err := client.getTree()
+	if err != nil {
+		return fmt.Errorf("tree loading error: %w", err)
+	}
+	if _, err := tree.PrepareInsertKey(key); err != nil {
+		return err
+	}
+	return tree.Schema.Check(metadata)
+}
+
+func readReembedCheckpoint(path string) (reembedCheckpoint, error) {
+	var cp reembedCheckpoint
+	if path == "" {
+		return cp, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return cp, err
+	}
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return cp, fmt.Errorf("%s: %w", path, err)
+	}
+	return cp, nil
+}
+
+// writeReembedCheckpoint replaces the checkpoint atomically
+func writeReembedCheckpoint(path string, cp reembedCheckpoint) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
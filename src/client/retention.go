@@ -0,0 +1,94 @@
+package client
+
+import (
+	hippotypes "Hippocampus/src/types"
+	"fmt"
+	"log"
+)
+
+// maxEvictionRounds bounds the evict-and-save rounds one flush makes to get
+// under a byte cap; each round's estimate comes from the last saved size
+const maxEvictionRounds = 3
+
+// SetRetention records r in the database's config, so that this and every
+// later client evicts to stay within it, and marks the tree for the next
+// flush, which enforces it. nil removes the cap.
+func (client *Client) SetRetention(r *hippotypes.Retention) error {
+	if r != nil {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	tree, err := client.getTree()
+	if err != nil {
+		return fmt.Errorf("tree loading error: %w", err)
+	}
+
+	// An empty tree records its embedder now, as its first insert would
+	client.recordConfig(tree, client.Embedder)
+
+	// Configs are replaced, never edited, since a background flush may be
+	// writing this one (see snapshot)
+	var config hippotypes.Config
+	if tree.Config != nil {
+		config = *tree.Config
+	}
+	config.Retention = r
+	tree.Config = &config
+	client.dirty = true
+	return nil
+}
+
+// retention is the cap in force: client.Retention, or else the one recorded
+// in the database. Call with mu held.
+func (client *Client) retention(tree *hippotypes.Tree) *hippotypes.Retention {
+	if client.Retention != nil {
+		return client.Retention
+	}
+	if tree.Config != nil {
+		return tree.Config.Retention
+	}
+	return nil
+}
+
+// evict deletes what the retention cap says must go from a tree saved at
+// size bytes, returning how many nodes it deleted. Call with mu held.
+func (client *Client) evict(tree *hippotypes.Tree, size int64) int {
+	r := client.retention(tree)
+	excess := r.Excess(len(tree.Nodes), size)
+	if excess == 0 {
+		return 0
+	}
+
+	var strategy hippotypes.RetentionStrategy
+	if r != nil {
+		strategy = r.Strategy
+	}
+	evicted := tree.Evict(excess, strategy)
+	if evicted == 0 {
+		return 0
+	}
+	client.dirty = true
+	client.treeChanged()
+	client.Metrics.SetNodeCount(len(tree.Nodes))
+
+	if client.verbose {
+		log.Printf("hippocampus: %s: evicted %d nodes to stay within retention %s", client.Storage.Path(), evicted, r)
+	}
+	return evicted
+}
+
+// tracksAccess reports whether a search with opts should record its hits:
+// when it asks to, or when the retention cap evicts by last access, which
+// then needs every search's hits. Call with mu held.
+func (client *Client) tracksAccess(tree *hippotypes.Tree, opts hippotypes.SearchOptions) bool {
+	if opts.TrackAccess {
+		return true
+	}
+	r := client.retention(tree)
+	return r != nil && r.Strategy == hippotypes.EvictLeastMatched
+}
@@ -0,0 +1,143 @@
+package client
+
+import (
+	hippotypes "Hippocampus/src/types"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// stored returns the sorted texts of every node in the database
+func stored(t *testing.T, c *Client) []string {
+	t.Helper()
+	var found []string
+	if err := c.Scan(func(r SearchResult) bool {
+		found = append(found, r.Text)
+		return true
+	}, nil); err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(found)
+	return found
+}
+
+// capTo sets the retention cap and flushes to enforce it
+func capTo(t *testing.T, c *Client, r *hippotypes.Retention) {
+	t.Helper()
+	if err := c.SetRetention(r); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRetentionEvictsOldest(t *testing.T) {
+	c := newTestClient(t, filepath.Join(t.TempDir(), "tree.bin"))
+	for _, text := range []string{"a", "b", "c", "d", "e"} {
+		if err := c.Insert(text, text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	capTo(t, c, &hippotypes.Retention{MaxNodes: 3})
+	if got := stored(t, c); !slices.Equal(got, []string{"c", "d", "e"}) {
+		t.Errorf("oldest first kept %v, want the newest three", got)
+	}
+
+	// The cap is recorded, so later inserts keep to it too
+	if err := c.Insert("f", "f"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := stored(t, c); !slices.Equal(got, []string{"d", "e", "f"}) {
+		t.Errorf("after another insert kept %v", got)
+	}
+}
+
+func TestRetentionEvictsLeastImportant(t *testing.T) {
+	c := newTestClient(t, filepath.Join(t.TempDir(), "tree.bin"))
+	importance := map[string]string{"a": "high", "b": "0.5", "c": "", "d": "low", "e": "2.5", "f": "medium"}
+	for _, text := range []string{"a", "b", "c", "d", "e", "f"} {
+		var metadata map[string]string
+		if importance[text] != "" {
+			metadata = map[string]string{hippotypes.ImportanceKey: importance[text]}
+		}
+		if err := c.InsertWithMetadata(text, text, metadata); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// c has no importance, so it ranks lowest; then b at 0.5 and d at low (1)
+	capTo(t, c, &hippotypes.Retention{MaxNodes: 3, Strategy: hippotypes.EvictImportance})
+	if got := stored(t, c); !slices.Equal(got, []string{"a", "e", "f"}) {
+		t.Errorf("importance kept %v, want a, e and f", got)
+	}
+}
+
+func TestRetentionEvictsToByteCap(t *testing.T) {
+	c := newTestClient(t, filepath.Join(t.TempDir(), "tree.bin"))
+	for i := 0; i < 40; i++ {
+		if err := c.Insert("k", string(rune('a'+i%26))+" memory"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	full, err := c.Storage.Size()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	capTo(t, c, &hippotypes.Retention{MaxBytes: full / 2})
+	size, err := c.Storage.Size()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := len(stored(t, c))
+	if size > full/2 || n == 0 || n >= 40 {
+		t.Errorf("capped at %d bytes: %d nodes in %d bytes", full/2, n, size)
+	}
+}
+
+// TestRetentionEvictsLeastMatchedAfterReload checks that least-matched
+// eviction reads the access times saved in the file, so a new client
+// evicts in the same order as the one whose searches made them
+func TestRetentionEvictsLeastMatchedAfterReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.bin")
+	c := newTestClient(t, path)
+	for _, text := range []string{"a", "b", "c", "d", "e"} {
+		if err := c.Insert(text, text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	capTo(t, c, &hippotypes.Retention{MaxNodes: 5, Strategy: hippotypes.EvictLeastMatched})
+
+	// Under least-matched every search counts, without asking to
+	for _, text := range []string{"d", "b"} {
+		results, _, err := c.SearchOpts(text, hippotypes.SearchOptions{Epsilon: 100, MaxDistance: 1000, TopK: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := texts(results); !slices.Equal(got, []string{text}) {
+			t.Fatalf("search for %s found %v", text, got)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := newTestClient(t, path)
+	capTo(t, reopened, &hippotypes.Retention{MaxNodes: 2, Strategy: hippotypes.EvictLeastMatched})
+	if got := stored(t, reopened); !slices.Equal(got, []string{"b", "d"}) {
+		t.Fatalf("after reload kept %v, want the two searched for", got)
+	}
+	capTo(t, reopened, &hippotypes.Retention{MaxNodes: 1, Strategy: hippotypes.EvictLeastMatched})
+	if got := stored(t, reopened); !slices.Equal(got, []string{"b"}) {
+		t.Errorf("kept %v, want b, matched last", got)
+	}
+}
@@ -0,0 +1,39 @@
+package client
+
+import (
+	hippotypes "Hippocampus/src/types"
+)
+
+// Scan calls fn with every node matching filter (nil matches all), in
+// insertion order, until fn returns false. Pending inserts are flushed
+// first and the nodes are then streamed from the storage backend, so a
+// database is never loaded whole just to be walked and fn may call back
+// into the client. Distance and Similarity are zero.
+func (client *Client) Scan(fn func(SearchResult) bool, filter *hippotypes.Filter) error {
+	client.mu.Lock()
+	err := client.flush()
+	if err == nil {
+		client.waitFlush()
+		err = client.takeFlushErr()
+	}
+	client.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	schema, err := client.Storage.Schema()
+	if err != nil {
+		return err
+	}
+
+	return client.Storage.Scan(func(n *hippotypes.Node) bool {
+		if !filter.MatchesSchema(n, schema) {
+			return true
+		}
+		return fn(SearchResult{
+			Text:     n.Value,
+			Metadata: n.Metadata,
+			Payload:  n.Payload,
+		})
+	})
+}
@@ -0,0 +1,60 @@
+package client
+
+import (
+	hippotypes "Hippocampus/src/types"
+	"fmt"
+)
+
+// Schema returns the database's metadata schema, or nil if it has none
+func (client *Client) Schema() (*hippotypes.Schema, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	tree, err := client.getTree()
+	if err != nil {
+		return nil, fmt.Errorf("tree loading error: %w", err)
+	}
+	return tree.Schema, nil
+}
+
+// SetSchema stores schema in the database, or removes the schema when it
+// is nil. Every existing node must already fit it; the error names the
+// first that does not.
+func (client *Client) SetSchema(schema *hippotypes.Schema) error {
+	if err := schema.Validate(); err != nil {
+		return err
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	tree, err := client.getTree()
+	if err != nil {
+		return fmt.Errorf("tree loading error: %w", err)
+	}
+	for i := range tree.Nodes {
+		if err := schema.Check(tree.Nodes[i].Metadata); err != nil {
+			return fmt.Errorf("node %d (%q): %w", i, tree.Nodes[i].Value, err)
+		}
+	}
+
+	tree.Schema = schema
+	client.dirty = true
+	client.treeChanged()
+
+	return client.flush()
+}
+
+// CheckMetadata returns a *hippotypes.SchemaError if metadata does not fit
+// the database's schema, so callers can skip a record instead of failing a
+// whole BatchInsert
+func (client *Client) CheckMetadata(metadata map[string]string) error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	tree, err := client.getTree()
+	if err != nil {
+		return fmt.Errorf("tree loading error: %w", err)
+	}
+	return tree.Schema.Check(metadata)
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	hippotypes "Hippocampus/src/types"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.bin")
+	c := newTestClient(t, path)
+	if err := c.InsertWithMetadata("a", "counted", map[string]string{"count": "2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.InsertWithMetadata("b", "uncounted", map[string]string{"count": "lots"}); err != nil {
+		t.Fatal(err)
+	}
+
+	schema := &hippotypes.Schema{Fields: map[string]hippotypes.FieldSpec{"count": {Type: hippotypes.FieldInt}}}
+	var schemaErr *hippotypes.SchemaError
+	if err := c.SetSchema(schema); !errors.As(err, &schemaErr) || schemaErr.Field != "count" {
+		t.Fatalf("schema the stored nodes break: %v, want a *SchemaError for count", err)
+	}
+	if got, err := c.Schema(); err != nil || got != nil {
+		t.Fatalf("rejected schema was kept: %v, %v", got, err)
+	}
+
+	if n, err := c.DeleteWhere(&hippotypes.Filter{Metadata: map[string]string{"count": "lots"}}); err != nil || n != 1 {
+		t.Fatalf("deleted %d nodes: %v", n, err)
+	}
+	if err := c.SetSchema(schema); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.InsertWithMetadata("c", "bad", map[string]string{"count": "lots"}); !errors.As(err, &schemaErr) {
+		t.Errorf("insert breaking the schema: %v, want a *SchemaError", err)
+	}
+	if err := c.CheckMetadata(map[string]string{"count": "2.0"}); err != nil {
+		t.Errorf("CheckMetadata of an integral float: %v", err)
+	}
+
+	// The schema is in the file, so a fresh client enforces it and compares by value
+	reopened := newTestClient(t, path)
+	got, err := reopened.Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.Fields["count"].Type != hippotypes.FieldInt {
+		t.Fatalf("reloaded schema %+v", got)
+	}
+	if err := reopened.InsertWithMetadata("c", "bad", map[string]string{"count": "lots"}); !errors.As(err, &schemaErr) {
+		t.Errorf("insert after reopening: %v, want a *SchemaError", err)
+	}
+	if n, err := reopened.CountWithFilter(&hippotypes.Filter{Metadata: map[string]string{"count": "2.0"}}); err != nil || n != 1 {
+		t.Errorf("filter count=2.0 found %d nodes (%v), want the node stored as 2", n, err)
+	}
+
+	// nil removes it
+	if err := reopened.SetSchema(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.InsertWithMetadata("c", "free", map[string]string{"count": "lots"}); err != nil {
+		t.Errorf("insert without a schema: %v", err)
+	}
+}
@@ -0,0 +1,255 @@
+package client
+
+import (
+	"Hippocampus/src/storage"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// snapshotTimeFormat sorts lexically and contains no '-', so the name is
+// everything before the last '-' of a snapshot file's base name
+const snapshotTimeFormat = "20060102T150405.000000000Z"
+
+// ErrUnflushedChanges is returned by Restore when inserts that were never
+// flushed would be thrown away
+var ErrUnflushedChanges = errors.New("database has unflushed changes")
+
+// SnapshotInfo describes one restore point
+type SnapshotInfo struct {
+	Name    string    `json:"name"`
+	Version string    `json:"version"` // name-timestamp; pass to Restore for this exact snapshot
+	Created time.Time `json:"created"`
+	Path    string    `json:"path"`
+	Bytes   int64     `json:"bytes"`
+}
+
+// SnapshotDir is where snapshots of the database are kept: next to it, in
+// <database>.snapshots
+func (client *Client) SnapshotDir() (string, error) {
+	if _, ok := client.Storage.(*storage.MemoryStorage); ok {
+		return "", fmt.Errorf("snapshots need a database on disk")
+	}
+	path := strings.TrimSuffix(client.Storage.Path(), string(os.PathSeparator))
+	return path + ".snapshots", nil
+}
+
+func validSnapshotName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid snapshot name %q", name)
+	}
+	return nil
+}
+
+// Snapshot flushes pending inserts and records the database as a named
+// restore point. A single-file database is hard-linked when possible, which
+// costs nothing since saves replace the file rather than rewriting it;
+// otherwise (and for sharded databases) the tree is written out as one file.
+func (client *Client) Snapshot(name string) (SnapshotInfo, error) {
+	if err := validSnapshotName(name); err != nil {
+		return SnapshotInfo{}, err
+	}
+	dir, err := client.SnapshotDir()
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if err := client.flush(); err != nil {
+		return SnapshotInfo{}, fmt.Errorf("flush error: %w", err)
+	}
+	client.waitFlush()
+	if err := client.takeFlushErr(); err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	created := time.Now().UTC()
+	version := name + "-" + created.Format(snapshotTimeFormat)
+	path := filepath.Join(dir, version+".bin")
+
+	unlock, err := client.Storage.Lock()
+	if err != nil {
+		return SnapshotInfo{}, fmt.Errorf("lock error: %w", err)
+	}
+	defer unlock()
+
+	if err := client.writeSnapshot(path); err != nil {
+		return SnapshotInfo{}, fmt.Errorf("snapshot error: %w", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	return SnapshotInfo{Name: name, Version: version, Created: created, Path: path, Bytes: info.Size()}, nil
+}
+
+// writeSnapshot copies the flushed database to path; callers hold the
+// storage lock
+func (client *Client) writeSnapshot(path string) error {
+	if fs, ok := client.Storage.(*storage.FileStorage); ok {
+		if _, err := os.Stat(fs.Path()); err == nil {
+			if err := os.Link(fs.Path(), path); err == nil {
+				return nil
+			}
+			return copyFile(fs.Path(), path)
+		}
+	}
+
+	// Sharded, or nothing saved yet (the snapshot is an empty database)
+	tree, err := client.Storage.Load()
+	if err != nil {
+		return err
+	}
+	return storage.New(path).Save(tree)
+}
+
+// copyFile writes src to a temp file beside dst and renames it into place
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := out.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Chmod(0644); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, dst)
+}
+
+// ListSnapshots returns every snapshot of the database, oldest first
+func (client *Client) ListSnapshots() ([]SnapshotInfo, error) {
+	dir, err := client.SnapshotDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []SnapshotInfo
+	for _, entry := range entries {
+		version, ok := strings.CutSuffix(entry.Name(), ".bin")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		cut := strings.LastIndexByte(version, '-')
+		if cut <= 0 {
+			continue
+		}
+		created, err := time.Parse(snapshotTimeFormat, version[cut+1:])
+		if err != nil {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, SnapshotInfo{
+			Name:    version[:cut],
+			Version: version,
+			Created: created,
+			Path:    filepath.Join(dir, entry.Name()),
+			Bytes:   info.Size(),
+		})
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Created.Before(snapshots[j].Created)
+	})
+	return snapshots, nil
+}
+
+// findSnapshot resolves a snapshot name to its latest version, or a version
+// to itself
+func (client *Client) findSnapshot(name string) (SnapshotInfo, error) {
+	snapshots, err := client.ListSnapshots()
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		if snapshots[i].Version == name || snapshots[i].Name == name {
+			return snapshots[i], nil
+		}
+	}
+	return SnapshotInfo{}, fmt.Errorf("no snapshot named %q", name)
+}
+
+// Restore replaces the database with a snapshot, given by name (its latest
+// version) or by exact version. Unflushed inserts would be lost, so unless
+// force is set Restore returns ErrUnflushedChanges while there are any.
+func (client *Client) Restore(name string, force bool) (SnapshotInfo, error) {
+	snap, err := client.findSnapshot(name)
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	tree, err := storage.New(snap.Path).Load()
+	if err != nil {
+		return SnapshotInfo{}, fmt.Errorf("snapshot %s: %w", snap.Version, err)
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.waitFlush()
+	if client.dirty && !force {
+		return SnapshotInfo{}, ErrUnflushedChanges
+	}
+
+	unlock, err := client.Storage.Lock()
+	if err != nil {
+		return SnapshotInfo{}, fmt.Errorf("lock error: %w", err)
+	}
+	defer unlock()
+
+	if err := client.Storage.Save(tree); err != nil {
+		return SnapshotInfo{}, fmt.Errorf("save error: %w", err)
+	}
+
+	client.cachedTree = tree
+	client.dirty = false
+	client.flushErr = nil
+	client.lastFlush = time.Now()
+	client.treeChanged()
+
+	return snap, nil
+}
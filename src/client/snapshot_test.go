@@ -0,0 +1,153 @@
+package client
+
+import (
+	"Hippocampus/src/storage"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// nodeSet lists the value and key of every node saved at path
+func nodeSet(t *testing.T, path string) []string {
+	t.Helper()
+	tree, err := storage.New(path).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := make([]string, len(tree.Nodes))
+	for i, n := range tree.Nodes {
+		set[i] = fmt.Sprintf("%s %v", n.Value, n.Key[:4])
+	}
+	slices.Sort(set)
+	return set
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.bin")
+	c := newTestClient(t, path)
+	for i := 0; i < 3; i++ {
+		if err := c.Insert(fmt.Sprint(i), fmt.Sprintf("memory %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before, err := c.Snapshot("before-import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := nodeSet(t, path)
+
+	// A risky import: new nodes and one of the old ones gone
+	for i := 0; i < 10; i++ {
+		if err := c.Insert("", fmt.Sprintf("imported %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.DeleteDocument("1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := nodeSet(t, before.Path); !slices.Equal(got, want) {
+		t.Fatalf("snapshot changed with the database: %v", got)
+	}
+
+	if _, err := c.Restore("before-import", false); err != nil {
+		t.Fatal(err)
+	}
+	if got := nodeSet(t, path); !slices.Equal(got, want) {
+		t.Errorf("restored database holds %v, want %v", got, want)
+	}
+	// and the client searches the restored tree, not its cached one
+	if got := inRange(t, c, time.Time{}, time.Time{}); !slices.Equal(got, []string{"memory 0", "memory 1", "memory 2"}) {
+		t.Errorf("client searches %v after the restore", got)
+	}
+}
+
+func TestRestoreRefusesUnflushedChanges(t *testing.T) {
+	c := newTestClient(t, filepath.Join(t.TempDir(), "tree.bin"))
+	if err := c.Insert("a", "kept"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Snapshot("clean"); err != nil {
+		t.Fatal(err)
+	}
+
+	c.FlushEvery = -1
+	if err := c.Insert("b", "unflushed"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Restore("clean", false); !errors.Is(err, ErrUnflushedChanges) {
+		t.Fatalf("restore over unflushed inserts: %v, want ErrUnflushedChanges", err)
+	}
+	if _, err := c.Restore("clean", true); err != nil {
+		t.Fatal(err)
+	}
+	if got := inRange(t, c, time.Time{}, time.Time{}); !slices.Equal(got, []string{"kept"}) {
+		t.Errorf("forced restore left %v", got)
+	}
+}
+
+func TestSnapshotVersions(t *testing.T) {
+	c := newTestClient(t, filepath.Join(t.TempDir(), "tree.bin"))
+	if err := c.Insert("a", "first"); err != nil {
+		t.Fatal(err)
+	}
+	first, err := c.Snapshot("daily")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Insert("b", "second"); err != nil {
+		t.Fatal(err)
+	}
+	latest, err := c.Snapshot("daily")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Snapshot("pre-dedupe"); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshots, err := c.ListSnapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range snapshots {
+		names = append(names, s.Name)
+	}
+	if !slices.Equal(names, []string{"daily", "daily", "pre-dedupe"}) {
+		t.Fatalf("snapshots %v, want both dailies then pre-dedupe, oldest first", names)
+	}
+
+	// A name restores its latest version, a version itself
+	if snap, err := c.Restore("daily", false); err != nil || snap.Version != latest.Version {
+		t.Errorf("restoring daily got %s (%v), want %s", snap.Version, err, latest.Version)
+	}
+	if _, err := c.Restore(first.Version, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := inRange(t, c, time.Time{}, time.Time{}); !slices.Equal(got, []string{"first"}) {
+		t.Errorf("restoring %s left %v", first.Version, got)
+	}
+
+	if _, err := c.Restore("weekly", false); err == nil {
+		t.Error("restored a snapshot that doesn't exist")
+	}
+	for _, name := range []string{"", "..", "a/b"} {
+		if _, err := c.Snapshot(name); err == nil {
+			t.Errorf("snapshot named %q accepted", name)
+		}
+	}
+
+	memory, err := NewInMemory(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := memory.Snapshot("x"); err == nil {
+		t.Error("snapshot of an in-memory database accepted")
+	}
+}
@@ -0,0 +1,159 @@
+package client
+
+import (
+	hippotypes "Hippocampus/src/types"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SearchStream is SearchOpts that hands emit every hit inside the distance
+// cutoff as the search scores it, before the final ranking (see
+// hippotypes.Tree.SearchStream), then returns the ranked topK. emit
+// returning false, or ctx ending, stops the search at its next candidate
+// and emit is not called again; the result cache is neither consulted nor
+// filled. The search queues hits for emit,
+// which runs on the caller's goroutine without the client locked, so a
+// slow emit never holds up other callers and may call back into the
+// client.
+func (client *Client) SearchStream(ctx context.Context, text string, opts hippotypes.SearchOptions, emit func(SearchResult) bool) ([]SearchResult, OperationStats, error) {
+	stats := OperationStats{Operation: "search"}
+
+	if err := opts.Validate(); err != nil {
+		return nil, stats, err
+	}
+
+	embedStart := time.Now()
+	embeddingArray, err := client.embed(ctx, text)
+	stats.Embed = time.Since(embedStart)
+	if err != nil {
+		return nil, stats, err
+	}
+
+	// Turning down a hit cancels the search as ctx ending would, except
+	// that the hits scored so far are still ranked and returned
+	searchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	opts.Done = searchCtx.Done()
+
+	queue := hitQueue{ready: make(chan struct{}, 1)}
+	done := make(chan struct{})
+	var results []SearchResult
+	go func() {
+		defer close(done)
+		results, err = client.searchStream(ctx, embeddingArray, opts, &stats, queue.push)
+	}()
+
+	stopped := false
+	for finished := false; !finished; {
+		select {
+		case <-queue.ready:
+		case <-done:
+			finished = true
+		}
+		for _, hit := range queue.take() {
+			if stopped || ctx.Err() != nil {
+				break
+			}
+			if !emit(hit) {
+				stopped = true
+				cancel()
+			}
+		}
+	}
+
+	if err != nil {
+		return nil, stats, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, stats, err
+	}
+	return results, stats, nil
+}
+
+// searchStream runs the locked part of SearchStream, handing each hit to
+// push as it is scored
+func (client *Client) searchStream(ctx context.Context, embeddingArray [512]float32, opts hippotypes.SearchOptions, stats *OperationStats, push func(SearchResult)) ([]SearchResult, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	loadStart := time.Now()
+	tree, err := client.getTree()
+	stats.Load = time.Since(loadStart)
+	if err != nil {
+		return nil, fmt.Errorf("tree loading error: %w", err)
+	}
+
+	if err := client.checkConfig(tree, client.Embedder); err != nil {
+		return nil, err
+	}
+	key, err := tree.PrepareKey(embeddingArray)
+	if err != nil {
+		return nil, fmt.Errorf("embedding error: %w", err)
+	}
+
+	stats.NodesBefore = len(tree.Nodes)
+	stats.NodesAfter = len(tree.Nodes)
+	searchStart := time.Now()
+	scored, truncated, err := tree.SearchStream(key, opts, func(n hippotypes.Node, distance float32) bool {
+		push(SearchResult{
+			Text:       n.Value,
+			Distance:   distance,
+			Similarity: hippotypes.Similarity(distance),
+			Metadata:   n.Metadata,
+			Payload:    n.Payload,
+		})
+		return true
+	})
+	stats.Search = time.Since(searchStart)
+	stats.Truncated = truncated
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if client.tracksAccess(tree, opts) {
+		tree.RecordAccess(scored, time.Now())
+	}
+
+	results := toSearchResults(scored)
+	stats.Results = len(results)
+
+	client.Metrics.ObserveSearch(stats.searchTiming())
+	client.lastStats = *stats
+
+	return results, nil
+}
+
+// hitQueue passes hits from a search, which never waits on it, to the
+// goroutine emitting them
+type hitQueue struct {
+	mu    sync.Mutex
+	hits  []SearchResult
+	ready chan struct{} // buffered 1, so a push never blocks
+}
+
+// push queues a hit and wakes the emitting goroutine if it isn't already
+// due to wake
+func (q *hitQueue) push(hit SearchResult) {
+	q.mu.Lock()
+	q.hits = append(q.hits, hit)
+	q.mu.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// take removes and returns every queued hit
+func (q *hitQueue) take() []SearchResult {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	hits := q.hits
+	q.hits = nil
+	return hits
+}
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"Hippocampus/src/embedding"
+	hippotypes "Hippocampus/src/types"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// newStreamClient is a test client holding memories "m0".."m<n-1>", each
+// further from the text "query" than the last
+func newStreamClient(t *testing.T, n int) *Client {
+	t.Helper()
+	c := newTestClient(t, filepath.Join(t.TempDir(), "tree.bin"))
+	mock := c.Embedder.(*embedding.MockProvider)
+
+	query := make([]float32, 512)
+	query[0] = 1
+	mock.SetResponse("query", query)
+	texts := make([]string, n)
+	for i := range texts {
+		texts[i] = fmt.Sprintf("m%d", i)
+		vec := make([]float32, 512)
+		vec[0], vec[1] = 1, 0.05*float32(i+1)
+		mock.SetResponse(texts[i], vec)
+	}
+	if err := c.InsertTexts(texts, nil); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+var streamOpts = hippotypes.SearchOptions{Epsilon: 1, MaxDistance: 1, TopK: 3}
+
+func TestSearchStreamEmitsOutsideTheLock(t *testing.T) {
+	c := newStreamClient(t, 5)
+
+	var emitted []string
+	finished := make(chan struct{})
+	var results []SearchResult
+	var err error
+	go func() {
+		defer close(finished)
+		results, _, err = c.SearchStream(context.Background(), "query", streamOpts, func(hit SearchResult) bool {
+			// Calling back into the client deadlocks if emit runs locked
+			if _, err := c.CountWithFilter(nil); err != nil {
+				t.Error(err)
+			}
+			emitted = append(emitted, hit.Text)
+			return true
+		})
+	}()
+	select {
+	case <-finished:
+	case <-time.After(10 * time.Second):
+		t.Fatal("SearchStream deadlocked calling emit with the client locked")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slices.Sort(emitted)
+	if !slices.Equal(emitted, []string{"m0", "m1", "m2", "m3", "m4"}) {
+		t.Errorf("emitted %v, want every hit", emitted)
+	}
+	if got := texts(results); !slices.Equal(got, []string{"m0", "m1", "m2"}) {
+		t.Errorf("results %v, want the closest three in order", got)
+	}
+}
+
+func TestSearchStreamStopsWhenEmitDeclines(t *testing.T) {
+	c := newStreamClient(t, 5)
+
+	emitted := 0
+	results, _, err := c.SearchStream(context.Background(), "query", streamOpts, func(SearchResult) bool {
+		emitted++
+		return false
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if emitted != 1 {
+		t.Errorf("emit called %d times after declining the first hit", emitted)
+	}
+	// The search may finish before it sees the stop, but it still ranks
+	// what it scored
+	if len(results) == 0 || results[0].Text != "m0" {
+		t.Errorf("results %v, want the hits scored so far ranked", texts(results))
+	}
+}
+
+func TestSearchStreamHonoursContext(t *testing.T) {
+	c := newStreamClient(t, 5)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	emitted := 0
+	results, _, err := c.SearchStream(ctx, "query", streamOpts, func(SearchResult) bool {
+		emitted++
+		cancel()
+		return true
+	})
+	if !errors.Is(err, context.Canceled) || results != nil {
+		t.Fatalf("results %v, error %v; want context.Canceled", results, err)
+	}
+	if emitted != 1 {
+		t.Errorf("emit called %d times after the context ended", emitted)
+	}
+
+	if _, _, err := c.SearchStream(ctx, "query", streamOpts, func(SearchResult) bool {
+		t.Error("emit called with the context already ended")
+		return true
+	}); !errors.Is(err, context.Canceled) {
+		t.Errorf("search with an ended context: error %v", err)
+	}
+}
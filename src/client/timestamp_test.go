@@ -0,0 +1,134 @@
+package client
+
+import (
+	hippotypes "Hippocampus/src/types"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// inRange returns the sorted texts of nodes whose timestamp is in [since, until]
+func inRange(t *testing.T, c *Client, since, until time.Time) []string {
+	t.Helper()
+	opts := hippotypes.SearchOptions{
+		Epsilon:     100,
+		MaxDistance: 1000,
+		TopK:        100,
+		Filter:      &hippotypes.Filter{Since: since, Until: until},
+	}
+	results, _, err := c.SearchOpts("anything", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := texts(results)
+	slices.Sort(found)
+	return found
+}
+
+func TestBatchInsertHistoricalTimestamps(t *testing.T) {
+	c := newTestClient(t, filepath.Join(t.TempDir(), "tree.bin"))
+
+	day := func(month time.Month, d int) time.Time {
+		return time.Date(2022, month, d, 12, 0, 0, 0, time.UTC)
+	}
+	keys, err := c.embedAll(t.Context(), c.Embedder, []string{"march", "july", "august", "undated"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := []VectorRecord{
+		{Key: keys[0], Text: "march", Timestamp: day(time.March, 3)},
+		// Timestamp wins over a timestamp already in the metadata
+		{Key: keys[1], Text: "july", Timestamp: day(time.July, 4), Metadata: map[string]string{hippotypes.TimestampKey: day(time.March, 1).Format(time.RFC3339)}},
+		{Key: keys[2], Text: "august", Timestamp: day(time.August, 8)},
+		{Key: keys[3], Text: "undated"},
+	}
+	if err := c.BatchInsert(records); err != nil {
+		t.Fatal(err)
+	}
+	if ts := records[1].Metadata[hippotypes.TimestampKey]; ts != day(time.March, 1).Format(time.RFC3339) {
+		t.Fatalf("record's metadata was modified: %q", ts)
+	}
+
+	if got := inRange(t, c, day(time.July, 1), day(time.August, 8)); !slices.Equal(got, []string{"august", "july"}) {
+		t.Errorf("July-August 2022 found %v", got)
+	}
+	if got := inRange(t, c, time.Time{}, day(time.June, 1)); !slices.Equal(got, []string{"march"}) {
+		t.Errorf("before June 2022 found %v, want march and not the undated node", got)
+	}
+}
+
+func TestInsertStampsNow(t *testing.T) {
+	c := newTestClient(t, filepath.Join(t.TempDir(), "tree.bin"))
+	before := time.Now().Add(-time.Second)
+
+	if err := c.Insert("plain", "plain insert"); err != nil {
+		t.Fatal(err)
+	}
+	kept := time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC).Format(time.RFC3339)
+	if err := c.InsertWithMetadata("dated", "dated insert", map[string]string{hippotypes.TimestampKey: kept}); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := c.embedAll(t.Context(), c.Embedder, []string{"zero record", "dated record"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dated := map[string]string{hippotypes.TimestampKey: kept}
+	if err := c.BatchInsert([]VectorRecord{
+		{Key: keys[0], Text: "zero record"},
+		{Key: keys[1], Text: "dated record", Metadata: dated},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(dated) != 1 {
+		t.Fatalf("record's metadata was modified: %v", dated)
+	}
+
+	// A zero Timestamp and a plain Insert both mean now; a timestamp the
+	// caller gave in the metadata is kept
+	if got := inRange(t, c, before, time.Time{}); !slices.Equal(got, []string{"plain insert", "zero record"}) {
+		t.Errorf("since the test started found %v, want the undated inserts", got)
+	}
+	if got := inRange(t, c, time.Time{}, before); !slices.Equal(got, []string{"dated insert", "dated record"}) {
+		t.Errorf("before the test started found %v, want the dated inserts", got)
+	}
+}
+
+func TestInsertCSVTimestampColumn(t *testing.T) {
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "chat.csv")
+	rows := []string{
+		"1,new year message,2021-01-01T08:30:00Z",
+		"2,midyear message,2021-06-30T23:59:59+12:00",
+		"3,undated message,",
+		"4,december message,2021-12-24T18:00:00.5Z",
+	}
+	if err := os.WriteFile(csvPath, []byte(strings.Join(rows, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newTestClient(t, filepath.Join(dir, "tree.bin"))
+	c.CSVTimestampColumn = 2
+	if err := c.InsertCSV(csvPath); err != nil {
+		t.Fatal(err)
+	}
+
+	h1 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	h2 := time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)
+	if got := inRange(t, c, h1, h2.Add(-time.Nanosecond)); !slices.Equal(got, []string{"midyear message", "new year message"}) {
+		t.Errorf("first half of 2021 found %v", got)
+	}
+	if got := inRange(t, c, h2, time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)); !slices.Equal(got, []string{"december message"}) {
+		t.Errorf("second half of 2021 found %v", got)
+	}
+
+	bad := filepath.Join(dir, "bad.csv")
+	if err := os.WriteFile(bad, []byte("1,fine,2021-01-01T00:00:00Z\n2,broken,yesterday\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.InsertCSV(bad); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("bad timestamp error %v, want it to name line 2", err)
+	}
+}
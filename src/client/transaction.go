@@ -0,0 +1,79 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+)
+
+// ErrBatchClosed is returned by a Batch that was already committed or
+// discarded
+var ErrBatchClosed = errors.New("batch already committed or discarded")
+
+// Batch groups inserts so they reach the database together or not at all.
+// Insert embeds straight away but keeps the node in the batch; nothing
+// enters the tree until Commit, so neither searches nor the automatic
+// flushes of other inserts see it. A Batch is not safe for concurrent use.
+type Batch struct {
+	client  *Client
+	records []VectorRecord
+	closed  bool
+}
+
+// Begin starts a batch of inserts; see Batch
+func (client *Client) Begin() *Batch {
+	return &Batch{client: client}
+}
+
+// Insert embeds text and adds it to the batch
+func (b *Batch) Insert(key, text string) error {
+	return b.InsertWithMetadata(key, text, nil)
+}
+
+// InsertWithMetadata is Insert with string metadata stored on the node
+func (b *Batch) InsertWithMetadata(key, text string, metadata map[string]string) error {
+	if b.closed {
+		return ErrBatchClosed
+	}
+	if err := b.client.CheckSize(text, metadata, nil); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+
+	vec, err := b.client.embed(context.Background(), text)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	b.records = append(b.records, VectorRecord{Key: vec, Text: text, Metadata: maps.Clone(metadata)})
+	return nil
+}
+
+// Client is the client the batch commits to
+func (b *Batch) Client() *Client {
+	return b.client
+}
+
+// Len is the number of inserts waiting for Commit
+func (b *Batch) Len() int {
+	return len(b.records)
+}
+
+// Commit checks every buffered node, appends them all under one lock and
+// flushes once (see BatchInsert). If any node is rejected none are stored.
+// The batch is closed either way.
+func (b *Batch) Commit() error {
+	if b.closed {
+		return ErrBatchClosed
+	}
+	b.closed = true
+	records := b.records
+	b.records = nil
+	return b.client.batchInsert(records, b.client.Embedder)
+}
+
+// Discard drops the buffered inserts and closes the batch. Discarding a
+// closed batch does nothing, so it is safe to defer.
+func (b *Batch) Discard() {
+	b.closed = true
+	b.records = nil
+}
@@ -0,0 +1,117 @@
+package client
+
+import (
+	hippotypes "Hippocampus/src/types"
+	"fmt"
+	"maps"
+)
+
+// NodeIDKey is the metadata key Upsert keeps a node's ID under. It is the
+// key imports keep source IDs under, so Diff and get -id match on it too.
+const NodeIDKey = "id"
+
+// ConflictPolicy is what Upsert does when nodes with the ID already exist
+type ConflictPolicy string
+
+const (
+	ConflictReplace ConflictPolicy = "replace" // delete them and store the new node (the default)
+	ConflictSkip    ConflictPolicy = "skip"    // keep them and store nothing
+	ConflictAppend  ConflictPolicy = "append"  // store the new node alongside them
+)
+
+// ParseConflictPolicy reads "replace", "skip" or "append"; empty is replace
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch policy := ConflictPolicy(s); policy {
+	case "":
+		return ConflictReplace, nil
+	case ConflictReplace, ConflictSkip, ConflictAppend:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown conflict policy %q (use replace, skip or append)", s)
+}
+
+// Upsert outcomes
+const (
+	UpsertCreated  = "created"  // no node had the ID
+	UpsertReplaced = "replaced" // the nodes with the ID were deleted first
+	UpsertSkipped  = "skipped"  // a node had the ID, so nothing was stored
+	UpsertAppended = "appended" // stored alongside the nodes with the ID
+)
+
+// UpsertResult is what Upsert did
+type UpsertResult struct {
+	Outcome  string `json:"outcome"`
+	Replaced int    `json:"replaced,omitempty"` // nodes deleted under the ID
+}
+
+// upsert carries an Upsert's ID and policy into insert, and its outcome back
+type upsert struct {
+	id     string
+	policy ConflictPolicy
+	result UpsertResult
+}
+
+// Upsert stores text as the node with ID id, kept in its metadata under
+// NodeIDKey, doing what policy says with nodes already stored under the
+// ID. A replace deletes them and inserts the new node in the same flush;
+// a skip returns before paying for an embedding.
+func (client *Client) Upsert(id, text string, metadata map[string]string, policy ConflictPolicy) (UpsertResult, OperationStats, error) {
+	if id == "" {
+		return UpsertResult{}, OperationStats{Operation: "insert"}, fmt.Errorf("node ID is required")
+	}
+	if _, err := ParseConflictPolicy(string(policy)); err != nil {
+		return UpsertResult{}, OperationStats{Operation: "insert"}, err
+	}
+	if policy == "" {
+		policy = ConflictReplace
+	}
+
+	if policy == ConflictSkip {
+		existing, err := client.CountWithFilter(nodeIDFilter(id))
+		if err != nil {
+			return UpsertResult{}, OperationStats{Operation: "insert"}, err
+		}
+		if existing > 0 {
+			return UpsertResult{Outcome: UpsertSkipped}, OperationStats{Operation: "insert"}, nil
+		}
+	}
+
+	metadata = maps.Clone(metadata)
+	if metadata == nil {
+		metadata = make(map[string]string, 1)
+	}
+	metadata[NodeIDKey] = id
+
+	up := &upsert{id: id, policy: policy}
+	stats, err := client.insert(id, text, metadata, nil, up)
+	return up.result, stats, err
+}
+
+// resolveConflict applies up's policy to the nodes stored under its ID,
+// reporting whether the new node should still be inserted. Call with mu held.
+func (client *Client) resolveConflict(tree *hippotypes.Tree, up *upsert) bool {
+	filter := nodeIDFilter(up.id)
+	if tree.CountWithFilter(filter) == 0 {
+		up.result = UpsertResult{Outcome: UpsertCreated}
+		return true
+	}
+
+	switch up.policy {
+	case ConflictSkip:
+		// Another insert got there between the check and the embedding
+		up.result = UpsertResult{Outcome: UpsertSkipped}
+		return false
+	case ConflictAppend:
+		up.result = UpsertResult{Outcome: UpsertAppended}
+		return true
+	}
+
+	up.result = UpsertResult{Outcome: UpsertReplaced, Replaced: tree.DeleteWhere(filter)}
+	client.dirty = true
+	client.treeChanged()
+	return true
+}
+
+func nodeIDFilter(id string) *hippotypes.Filter {
+	return &hippotypes.Filter{Metadata: map[string]string{NodeIDKey: id}}
+}
@@ -0,0 +1,92 @@
+package client
+
+import (
+	"Hippocampus/src/embedding"
+	hippotypes "Hippocampus/src/types"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestUpsertPolicies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.bin")
+	c := newTestClient(t, path)
+	mock := c.Embedder.(*embedding.MockProvider)
+
+	upsert := func(id, text string, policy ConflictPolicy, want UpsertResult) {
+		t.Helper()
+		result, _, err := c.Upsert(id, text, map[string]string{"source": "chat"}, policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != want {
+			t.Errorf("upsert %s %q (%s): %+v, want %+v", id, text, policy, result, want)
+		}
+	}
+	withID := func(id string) []string {
+		t.Helper()
+		var found []string
+		if err := c.Scan(func(r SearchResult) bool {
+			if r.Metadata[NodeIDKey] == id {
+				found = append(found, r.Text)
+			}
+			return true
+		}, nil); err != nil {
+			t.Fatal(err)
+		}
+		slices.Sort(found)
+		return found
+	}
+
+	upsert("last_message", "hello", "", UpsertResult{Outcome: UpsertCreated})
+	upsert("last_message", "how are you", ConflictReplace, UpsertResult{Outcome: UpsertReplaced, Replaced: 1})
+	if got := withID("last_message"); !slices.Equal(got, []string{"how are you"}) {
+		t.Fatalf("after replacing, last_message holds %v", got)
+	}
+
+	// A skip of an existing ID doesn't even embed
+	calls := len(mock.Calls())
+	upsert("last_message", "ignored", ConflictSkip, UpsertResult{Outcome: UpsertSkipped})
+	if len(mock.Calls()) != calls {
+		t.Error("skipped upsert embedded its text")
+	}
+	upsert("greeting", "hi there", ConflictSkip, UpsertResult{Outcome: UpsertCreated})
+
+	upsert("last_message", "goodbye", ConflictAppend, UpsertResult{Outcome: UpsertAppended})
+	if got := withID("last_message"); !slices.Equal(got, []string{"goodbye", "how are you"}) {
+		t.Fatalf("after appending, last_message holds %v", got)
+	}
+	// A replace clears every copy, appended or not
+	upsert("last_message", "final", ConflictReplace, UpsertResult{Outcome: UpsertReplaced, Replaced: 2})
+
+	// The ID is stored with the caller's metadata, and the replace survives a reload
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	reopened := newTestClient(t, path)
+	results, _, err := reopened.SearchOpts("final", hippotypes.SearchOptions{Epsilon: 100, MaxDistance: 1000, TopK: 10, Filter: nodeIDFilter("last_message")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Text != "final" || results[0].Metadata["source"] != "chat" {
+		t.Errorf("reloaded last_message is %v", results)
+	}
+
+	if _, _, err := c.Upsert("", "text", nil, ""); err == nil {
+		t.Error("upsert without an ID succeeded")
+	}
+	if _, _, err := c.Upsert("id", "text", nil, "merge"); err == nil {
+		t.Error("unknown policy accepted")
+	}
+}
+
+func TestParseConflictPolicy(t *testing.T) {
+	for in, want := range map[string]ConflictPolicy{"": ConflictReplace, "replace": ConflictReplace, "skip": ConflictSkip, "append": ConflictAppend} {
+		if got, err := ParseConflictPolicy(in); err != nil || got != want {
+			t.Errorf("ParseConflictPolicy(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseConflictPolicy("Replace"); err == nil {
+		t.Error("policies are case-sensitive, but Replace was accepted")
+	}
+}
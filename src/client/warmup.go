@@ -0,0 +1,65 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// WarmupStats reports how long each phase of Warmup took
+type WarmupStats struct {
+	Load  time.Duration `json:"load"`  // reading the database, which builds the index too
+	Index time.Duration `json:"index"` // rebuilding an index the load left stale, usually 0
+	Nodes int           `json:"nodes"`
+}
+
+// Warmup loads the database and builds its index now, so the first search
+// after start doesn't pay for them. Cancelling ctx returns at once; a load
+// already under way still finishes in the background and is kept.
+func (client *Client) Warmup(ctx context.Context) (WarmupStats, error) {
+	if err := ctx.Err(); err != nil {
+		return WarmupStats{}, err
+	}
+
+	type result struct {
+		stats WarmupStats
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		stats, err := client.warmup(ctx)
+		done <- result{stats, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.stats, r.err
+	case <-ctx.Done():
+		return WarmupStats{}, ctx.Err()
+	}
+}
+
+func (client *Client) warmup(ctx context.Context) (WarmupStats, error) {
+	var stats WarmupStats
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	loadStart := time.Now()
+	tree, err := client.getTree()
+	stats.Load = time.Since(loadStart)
+	if err != nil {
+		return stats, fmt.Errorf("tree loading error: %w", err)
+	}
+	stats.Nodes = len(tree.Nodes)
+
+	if err := ctx.Err(); err != nil {
+		return stats, err
+	}
+
+	indexStart := time.Now()
+	if tree.EnsureIndex() {
+		stats.Index = time.Since(indexStart)
+	}
+	return stats, nil
+}
@@ -0,0 +1,131 @@
+package client
+
+import (
+	"Hippocampus/src/embedding"
+	"Hippocampus/src/storage"
+	hippotypes "Hippocampus/src/types"
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// coldBackend counts loads and returns trees without their index, the way
+// a large file's first search finds it. Loads wait for release when it is
+// set.
+type coldBackend struct {
+	storage.Backend
+	loads   atomic.Int32
+	release chan struct{}
+}
+
+func (b *coldBackend) Load() (*hippotypes.Tree, error) {
+	b.loads.Add(1)
+	if b.release != nil {
+		<-b.release
+	}
+	tree, err := b.Backend.Load()
+	if err != nil {
+		return nil, err
+	}
+	return &hippotypes.Tree{Nodes: tree.Nodes}, nil
+}
+
+// coldClient is a client over a coldBackend holding n memories
+func coldClient(t *testing.T, n int) (*Client, *coldBackend) {
+	t.Helper()
+	mem := storage.NewMemory()
+	embedder := embedding.NewMockProvider(512)
+	seed, err := NewFromConfig(mem, aws.Config{}, embedder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed.SetVerbose(false)
+	for i := 0; i < n; i++ {
+		if err := seed.Insert(fmt.Sprint(i), fmt.Sprintf("memory %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := seed.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &coldBackend{Backend: mem}
+	c, err := NewFromConfig(backend, aws.Config{}, embedder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetVerbose(false)
+	return c, backend
+}
+
+func TestWarmupBuildsIndexBeforeFirstSearch(t *testing.T) {
+	c, backend := coldClient(t, 50)
+
+	stats, err := c.Warmup(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Nodes != 50 || stats.Index == 0 {
+		t.Errorf("warmup stats %+v, want 50 nodes and time spent indexing", stats)
+	}
+
+	// Nothing is left for the first search to build
+	c.mu.Lock()
+	rebuilt := c.cachedTree.EnsureIndex()
+	c.mu.Unlock()
+	if rebuilt {
+		t.Fatal("the index was stale after warmup")
+	}
+
+	results, err := c.Search("memory 7", 0.5, 0.5, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0] != "memory 7" {
+		t.Errorf("search after warmup returned %v", results)
+	}
+	if n := backend.loads.Load(); n != 1 {
+		t.Errorf("backend loaded %d times, want once", n)
+	}
+
+	// A second warmup has nothing to do
+	stats, err = c.Warmup(t.Context())
+	if err != nil || stats.Index != 0 || backend.loads.Load() != 1 {
+		t.Errorf("second warmup %+v, %v after %d loads", stats, err, backend.loads.Load())
+	}
+}
+
+func TestWarmupCancel(t *testing.T) {
+	c, backend := coldClient(t, 10)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if _, err := c.Warmup(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("warmup with a cancelled context: %v", err)
+	}
+	if n := backend.loads.Load(); n != 0 {
+		t.Fatalf("cancelled warmup loaded %d times", n)
+	}
+
+	// Cancelling during a slow load returns at once; the load still lands
+	backend.release = make(chan struct{})
+	ctx, cancel = context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := c.Warmup(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("warmup past its deadline: %v", err)
+	}
+	close(backend.release)
+
+	results, err := c.Search("memory 3", 0.5, 0.5, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || backend.loads.Load() != 1 {
+		t.Errorf("search after a cancelled warmup returned %v after %d loads, want the tree it loaded", results, backend.loads.Load())
+	}
+}
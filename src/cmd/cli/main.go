@@ -2,27 +2,791 @@ package main
 
 import (
 	"Hippocampus/src/client"
+	"Hippocampus/src/embedding"
+	"Hippocampus/src/importer"
+	"Hippocampus/src/metrics"
+	"Hippocampus/src/ratelimit"
+	"Hippocampus/src/server"
+	"Hippocampus/src/storage"
+	"Hippocampus/src/types"
+	"Hippocampus/src/watch"
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"maps"
+	"math"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
 )
 
+// openClient creates a client that logs TIMING lines to stderr; -stats
+// prints the same figures as JSON for scripts
+func openClient(binary, region string) *client.Client {
+	c, err := client.New(binary, region)
+	if err != nil {
+		log.Fatalf("Failed to create client: %v", err)
+	}
+	c.Metrics = metrics.NewTimingLogger(log.Default())
+	return c
+}
+
+// requireDatabase exits unless the database at binary exists. An
+// s3:// database is checked when it is first read instead.
+func requireDatabase(binary string) {
+	if _, _, ok := storage.ParseS3URL(binary); ok {
+		return
+	}
+	if _, err := os.Stat(binary); err != nil {
+		log.Fatalf("Failed to open %s: %v", binary, err)
+	}
+}
+
+// printDiff summarises a diff, counting changed nodes by what changed
+func printDiff(report storage.DiffReport) {
+	fmt.Printf("A: %s (%d nodes)\n", report.A, report.NodesA)
+	fmt.Printf("B: %s (%d nodes)\n", report.B, report.NodesB)
+	if report.Identical() {
+		fmt.Println("Identical")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "  Same\t%d\n", report.Same)
+	fmt.Fprintf(w, "  Only in A\t%d\n", len(report.OnlyA))
+	fmt.Fprintf(w, "  Only in B\t%d\n", len(report.OnlyB))
+	fmt.Fprintf(w, "  Changed\t%d\n", len(report.Changed))
+
+	changedFields := make(map[string]int)
+	for _, change := range report.Changed {
+		for _, field := range change.Fields {
+			changedFields[field]++
+		}
+	}
+	for _, field := range []string{"value", "vector", "metadata", "payload"} {
+		if changedFields[field] > 0 {
+			fmt.Fprintf(w, "    %s\t%d\n", field, changedFields[field])
+		}
+	}
+	w.Flush()
+	fmt.Println("Use -o json for the differing nodes")
+}
+
+// retentionUsage describes the -retention flag of commands that write
+const retentionUsage = "cap the database's size, recorded in it so later runs keep to it, e.g. nodes=100000,bytes=50MB,strategy=oldest (strategies: oldest, importance, least-matched; none removes the cap)"
+
+// applyRetention records a -retention flag in c's database; an empty spec
+// leaves the database's cap as it is
+func applyRetention(c *client.Client, spec string) error {
+	if spec == "" {
+		return nil
+	}
+	r, err := types.ParseRetention(spec)
+	if err != nil {
+		return err
+	}
+	return c.SetRetention(r)
+}
+
+// printConsistency summarises a verify report, counting divergences by kind
+func printConsistency(report storage.ConsistencyReport) {
+	fmt.Printf("A: %s (%d nodes)\n", report.A, report.NodesA)
+	fmt.Printf("B: %s (%d nodes)\n", report.B, report.NodesB)
+	fmt.Printf("Compared %d nodes, %d vectors (max component error %g)\n", report.Compared, report.Sampled, report.MaxVectorError)
+	if report.Consistent() {
+		fmt.Println("Consistent")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, kind := range slices.Sorted(maps.Keys(report.Divergent)) {
+		fmt.Fprintf(w, "  %s\t%d\n", kind, report.Divergent[kind])
+	}
+	w.Flush()
+	for _, d := range report.Examples {
+		if d.Index < 0 {
+			fmt.Printf("  %s: %s\n", d.Kind, d.Detail)
+		} else {
+			fmt.Printf("  node %d %s: %s\n", d.Index, d.Kind, d.Detail)
+		}
+	}
+}
+
+// printExplain shows how a search narrowed the tree down, stage by stage
+func printExplain(report types.ExplainReport) {
+	fmt.Println()
+	fmt.Printf("Explain: %d vectors, epsilon %g, max distance %.4f\n", report.Vectors, report.Epsilon, report.MaxDistance)
+	if n := len(report.Dimensions); n > 0 {
+		narrowest, widest := report.Dimensions[0], report.Dimensions[n-1]
+		fmt.Printf("  Dimension ranges:    %d to %d candidates (narrowest dim %d, widest dim %d); %d of %d intersected via the index\n",
+			narrowest.Candidates, widest.Candidates, narrowest.Dim, widest.Dim, report.Intersected, n)
+	}
+	if n := len(report.Dimensions); report.MinDimMatches < n {
+		fmt.Printf("  %-21s%d\n", fmt.Sprintf("Inside %d of %d:", report.MinDimMatches, n), report.InBox)
+	} else {
+		fmt.Printf("  Inside every range:  %d\n", report.InBox)
+	}
+	fmt.Printf("  Filtered out:        %d\n", report.Filtered)
+	fmt.Printf("  Scored:              %d (%d the norm pre-filter would skip)\n", report.Scored, report.Prefiltered)
+	fmt.Printf("  Beyond max distance: %d\n", report.OutOfRange)
+	fmt.Printf("  Within max distance: %d\n", report.WithinRange)
+	fmt.Printf("  Returned:            %d\n", report.Returned)
+	if report.Truncated {
+		fmt.Println("  Search limits stopped the scoring early")
+	}
+	if best := report.BestRejected; best != nil {
+		fmt.Printf("  Closest rejected:    %q at distance %.4f (similarity %.4f)\n", best.Value, best.Distance, best.Similarity)
+	}
+}
+
+// parseFloats parses a comma-separated list
+func parseFloats(list string) ([]float32, error) {
+	var values []float32
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(field, 32)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, float32(v))
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("no values in %q", list)
+	}
+	return values, nil
+}
+
+// parseInts parses a comma-separated list
+func parseInts(list string) ([]int, error) {
+	var values []int
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		v, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("no values in %q", list)
+	}
+	return values, nil
+}
+
+// stringList is a flag that may be repeated, collecting every value
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ", ") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// benchQuery is one line of a bench queries file that is not a bare vector
+type benchQuery struct {
+	Vector []float32 `json:"vector"`
+	Text   string    `json:"text"`
+}
+
+// readBenchQueries reads query vectors, embedding text queries with the
+// client from newClient, created only if a text query needs it
+func readBenchQueries(path string, newClient func() *client.Client) ([][512]float32, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var c *client.Client
+	var queries [][512]float32
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64<<10), 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var q benchQuery
+		if strings.HasPrefix(text, "[") {
+			err = json.Unmarshal([]byte(text), &q.Vector)
+		} else {
+			err = json.Unmarshal([]byte(text), &q)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if q.Vector == nil && q.Text != "" {
+			if c == nil {
+				c = newClient()
+			}
+			if q.Vector, err = c.Embedder.GetEmbedding(context.Background(), q.Text); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+
+		var key [512]float32
+		if len(q.Vector) != len(key) {
+			return nil, fmt.Errorf("line %d: query has %d dimensions, expected %d", line, len(q.Vector), len(key))
+		}
+		copy(key[:], q.Vector)
+		queries = append(queries, key)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("%s has no queries", path)
+	}
+	return queries, nil
+}
+
+// nodeJSON is how get prints a node
+type nodeJSON struct {
+	Index    int               `json:"index"`
+	Value    string            `json:"value"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Payload  []byte            `json:"payload,omitempty"`
+	Norm     float64           `json:"norm"`
+	Vector   []float32         `json:"vector"`
+}
+
+// printSampledNode prints a node's value, metadata, norm and first dims
+// vector components
+func printSampledNode(node types.IndexedNode, dims int) {
+	fmt.Printf("\n#%d  %s\n", node.Index, node.Node.Value)
+
+	keys := make([]string, 0, len(node.Node.Metadata))
+	for k := range node.Node.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Printf("    %s = %s\n", k, node.Node.Metadata[k])
+	}
+	if len(node.Node.Payload) > 0 {
+		fmt.Printf("    payload: %d bytes\n", len(node.Node.Payload))
+	}
+
+	components := make([]string, dims)
+	for i := range components {
+		components[i] = strconv.FormatFloat(float64(node.Node.Key[i]), 'f', 4, 32)
+	}
+	fmt.Printf("    norm %.4f  [%s", node.Norm(), strings.Join(components, " "))
+	if dims < len(node.Node.Key) {
+		fmt.Print(" ...")
+	}
+	fmt.Println("]")
+}
+
+// shorten cuts text to at most n runes for a table cell
+func shorten(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > n {
+		return string(runes[:n-3]) + "..."
+	}
+	return text
+}
+
+// printSkipReasons lists how many rows an import skipped for each reason
+func printSkipReasons(result importer.Result) {
+	reasons := make([]string, 0, len(result.Reasons))
+	for reason := range result.Reasons {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		fmt.Printf("  %6d  %s\n", result.Reasons[reason], reason)
+	}
+}
+
+// embedFlags configure retries and the persistent embedding cache stored next to the database
+type embedFlags struct {
+	spec        *string
+	titanModel  *string
+	titanDims   *int
+	ollamaModel *string
+	ollamaURL   *string
+	timeout     *time.Duration
+	retries     *int
+	cache       *bool
+	cacheSize   *int
+	cacheTTL    *time.Duration
+	strict      *bool
+}
+
+func addEmbedFlags(fs *flag.FlagSet, cacheByDefault bool) *embedFlags {
+	defaults := embedding.DefaultRetryConfig()
+	return &embedFlags{
+		spec:        fs.String("embed", "", "embedding provider spec, e.g. ollama://localhost:11434/nomic-embed-text (schemes: "+strings.Join(embedding.Schemes(), ", ")+")"),
+		titanModel:  fs.String("titan", embedding.TitanModelID, "Titan embedding model ID"),
+		titanDims:   fs.Int("titan-dims", embedding.TitanDimensions, "Titan embedding dimensions (the database stores 512)"),
+		ollamaModel: fs.String("ollama", "", "embed with this Ollama model instead of Titan"),
+		ollamaURL:   fs.String("ollama-url", embedding.DefaultOllamaURL, "Ollama server URL"),
+		timeout:     fs.Duration("embed-timeout", defaults.Timeout, "timeout per embedding request"),
+		retries:     fs.Int("embed-retries", defaults.MaxAttempts-1, "retries for throttled, failed or timed-out embedding requests"),
+		cache:       fs.Bool("embed-cache", cacheByDefault, "cache embeddings in <binary>.embcache"),
+		cacheSize:   fs.Int("embed-cache-size", 10000, "maximum cached embeddings"),
+		cacheTTL:    fs.Duration("embed-cache-ttl", 0, "expire cached embeddings after this long (0 = never)"),
+		strict:      fs.Bool("strict", false, "fail instead of warning when the embedding model differs from the one the database was created with"),
+	}
+}
+
+// apply wraps the client's embedder; call the returned func to persist the cache
+func (f *embedFlags) apply(c *client.Client, binary string) func() {
+	// -ollama and -titan are shorthands for the matching -embed spec
+	if *f.spec != "" {
+		p, err := embedding.NewProvider(*f.spec)
+		if err != nil {
+			log.Fatalf("Invalid -embed: %v", err)
+		}
+		c.Embedder = p
+	} else if *f.ollamaModel != "" {
+		c.Embedder = embedding.NewOllamaClient(*f.ollamaURL, *f.ollamaModel)
+	} else {
+		c.Embedder = embedding.NewTitanClient(c.Region, *f.titanModel, *f.titanDims, true)
+	}
+
+	config := embedding.DefaultRetryConfig()
+	config.Timeout = *f.timeout
+	config.MaxAttempts = *f.retries + 1
+	c.Embedder = embedding.NewRetryingProvider(c.Embedder, config)
+	c.StrictConfig = *f.strict
+
+	if !*f.cache {
+		return func() {}
+	}
+
+	cache := embedding.NewCachingProvider(c.Embedder, *f.cacheSize, *f.cacheTTL)
+	path := binary + ".embcache"
+	if s3, ok := c.Storage.(*storage.S3Backend); ok {
+		path = s3.LocalPath() + ".embcache"
+	}
+	if err := cache.Load(path); err != nil {
+		log.Printf("Ignoring unreadable embedding cache %s: %v", path, err)
+	}
+	c.Embedder = cache
+
+	return func() {
+		if err := cache.Save(path); err != nil {
+			log.Printf("Failed to save embedding cache: %v", err)
+		}
+	}
+}
+
+// parseMetadata parses "k1=v1,k2=v2" into a map
+func parseMetadata(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid metadata pair %q (want key=value)", pair)
+		}
+		metadata[k] = v
+	}
+	return metadata, nil
+}
+
+// readRadiusPairs reads calibration pairs, one JSON object per line
+func readRadiusPairs(path string) ([]client.RadiusPair, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var pairs []client.RadiusPair
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64<<10), 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var pair client.RadiusPair
+		if err := json.Unmarshal([]byte(text), &pair); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs, scanner.Err()
+}
+
+// writeReembedReport writes one JSON object per failed node
+func writeReembedReport(path string, failed []client.ReembedFailure) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, failure := range failed {
+		if err := enc.Encode(failure); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// readTextLines returns the non-blank lines of path
+func readTextLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var texts []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64<<10), 16<<20)
+	for scanner.Scan() {
+		if text := strings.TrimSpace(scanner.Text()); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return texts, scanner.Err()
+}
+
+// zeroVectorPolicy parses a -zero-vectors flag
+func zeroVectorPolicy(s string) types.ZeroVectorPolicy {
+	policy, err := types.ParseZeroVectorPolicy(s)
+	if err != nil {
+		log.Fatalf("invalid -zero-vectors: %v", err)
+	}
+	return policy
+}
+
+// writeStats prints an operation's stats as one JSON line on stderr
+func writeStats(stats client.OperationStats) {
+	if err := json.NewEncoder(os.Stderr).Encode(stats); err != nil {
+		log.Fatalf("Failed to encode stats: %v", err)
+	}
+}
+
+// printJSON writes v to stdout, indented
+func printJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Fatalf("Failed to encode output: %v", err)
+	}
+}
+
+// parseJSONMetadata reads a JSON object of metadata. Strings are kept as
+// they are; numbers, booleans and nested values are stored as their JSON.
+func parseJSONMetadata(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var raw map[string]any
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("want a JSON object: %w", err)
+	}
+	if raw == nil {
+		return nil, fmt.Errorf("want a JSON object, got null")
+	}
+
+	metadata := make(map[string]string, len(raw))
+	for k, v := range raw {
+		if str, ok := v.(string); ok {
+			metadata[k] = str
+			continue
+		}
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		metadata[k] = string(encoded)
+	}
+	return metadata, nil
+}
+
+// parseSearchFilter builds the search -filter, -since and -until flags into
+// a Filter, or nil if none is set
+func parseSearchFilter(metadataJSON, since, until string) (*types.Filter, error) {
+	if metadataJSON == "" && since == "" && until == "" {
+		return nil, nil
+	}
+
+	metadata, err := parseJSONMetadata(metadataJSON)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -filter: %w", err)
+	}
+	filter := &types.Filter{Metadata: metadata}
+
+	if since != "" {
+		if filter.Since, err = time.Parse(time.RFC3339Nano, since); err != nil {
+			return nil, fmt.Errorf("invalid -since: %w", err)
+		}
+	}
+	if until != "" {
+		if filter.Until, err = time.Parse(time.RFC3339Nano, until); err != nil {
+			return nil, fmt.Errorf("invalid -until: %w", err)
+		}
+	}
+	return filter, nil
+}
+
+// printRetention shows a database's usage against its retention cap
+func printRetention(binary string, nodes int, r *types.Retention) {
+	if r == nil {
+		return
+	}
+	usage := fmt.Sprintf("%d", nodes)
+	if r.MaxNodes > 0 {
+		usage += fmt.Sprintf("/%d", r.MaxNodes)
+	}
+	usage += " nodes"
+	if r.MaxBytes > 0 {
+		size, _ := storage.Open(binary).Size()
+		usage += fmt.Sprintf(", %d/%d bytes", size, r.MaxBytes)
+	}
+	fmt.Printf("Retention:   %s (%s)\n", usage, r)
+}
+
+// printAccess shows the hit counters tracked searches left, if any
+func printAccess(a types.AccessStats) {
+	if a.Accessed == 0 {
+		return
+	}
+	fmt.Printf("Accessed:    %d nodes, %d hits (most %d, last %s)\n",
+		a.Accessed, a.Hits, a.MaxHits, a.LastAccessed.Format(time.RFC3339))
+}
+
+func printStats(binary string, stats types.Stats) {
+	fmt.Printf("Database:    %s\n", binary)
+	if size, err := storage.Open(binary).Size(); err == nil {
+		fmt.Printf("File size:   %d bytes\n", size)
+	}
+	fmt.Printf("Nodes:       %d (sampled %d)\n", stats.Nodes, stats.Sampled)
+	fmt.Printf("Dimensions:  %d\n", len(stats.Dimensions))
+	fmt.Printf("Duplicates:  %d (largest group %d)\n", stats.Duplicates, stats.LargestDuplicateGroup)
+	fmt.Printf("Normalized:  %t\n", stats.Normalized)
+	printRetention(binary, stats.Nodes, stats.Retention)
+	printAccess(stats.Access)
+
+	if stats.Sampled == 0 {
+		return
+	}
+
+	n := stats.Norms
+	fmt.Printf("Norms:       min %.4f  p50 %.4f  p95 %.4f  max %.4f  mean %.4f  zeroed %d\n",
+		n.Min, n.P50, n.P95, n.Max, n.Mean, n.Zeroed)
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "dim\tmin\tmax\tmean\tstddev\t")
+	for _, d := range stats.Dimensions {
+		fmt.Fprintf(w, "%d\t%.4f\t%.4f\t%.4f\t%.4f\t\n", d.Dim, d.Min, d.Max, d.Mean, d.StdDev)
+	}
+	w.Flush()
+}
+
+// printConfig shows what the database recorded when it was created; older
+// databases recorded nothing
+func printConfig(cfg *types.Config) {
+	fmt.Printf("Model:       %s\n", cfg)
+	if cfg == nil {
+		return
+	}
+	if cfg.Metric != "" {
+		fmt.Printf("Metric:      %s\n", cfg.Metric)
+	}
+	if !cfg.Created.IsZero() {
+		fmt.Printf("Created:     %s\n", cfg.Created.Format(time.RFC3339))
+	}
+}
+
+// printHeader shows everything a database's header records that printInfo
+// does not already: the file format, the vector width and projection, the
+// schema and the radius table. file is nil for databases that are not a
+// single file.
+func printHeader(h *storage.ExportHeader, file *storage.FileHeader) {
+	if file != nil && file.Version > 0 {
+		fmt.Printf("Format:      version %d, generation %d (%s)\n", file.Version, file.Generation, strings.Join(file.Flags, ", "))
+	}
+	if h.Projection != nil {
+		fmt.Printf("Input dims:  %d, projected to %d\n", h.Dimensions, h.Projection.OutputDims)
+	} else {
+		fmt.Printf("Input dims:  %d\n", h.Dimensions)
+	}
+	if h.Schema != nil {
+		fields := make([]string, 0, len(h.Schema.Fields))
+		for _, name := range h.Schema.FieldNames() {
+			field := h.Schema.Fields[name]
+			spec := name + "=" + string(field.Type)
+			if field.Required {
+				spec += "!"
+			}
+			fields = append(fields, spec)
+		}
+		strict := ""
+		if h.Schema.Strict {
+			strict = " (strict)"
+		}
+		fmt.Printf("Schema:      %s%s\n", strings.Join(fields, ","), strict)
+	}
+	if len(h.Radii) > 0 {
+		radii := make([]string, 0, len(h.Radii))
+		for _, word := range slices.Sorted(maps.Keys(h.Radii)) {
+			radii = append(radii, fmt.Sprintf("%s=%.4f", word, h.Radii[word]))
+		}
+		fmt.Printf("Radii:       %s\n", strings.Join(radii, ", "))
+	}
+}
+
+func printInfo(binary string, stats types.TreeStats, header *storage.ExportHeader, file *storage.FileHeader, compression *storage.CompressionStats, verbose bool) {
+	fmt.Printf("Database:    %s\n", binary)
+	if size, err := storage.Open(binary).Size(); err == nil {
+		fmt.Printf("File size:   %d bytes\n", size)
+	}
+	if info, err := os.Stat(binary); err == nil {
+		fmt.Printf("Last flush:  %s\n", info.ModTime().Format(time.RFC3339))
+	}
+	fmt.Printf("Nodes:       %d\n", stats.Nodes)
+	fmt.Printf("Normalized:  %t\n", stats.Normalized)
+	printConfig(stats.Config)
+	if stats.Config != nil {
+		printRetention(binary, stats.Nodes, stats.Config.Retention)
+	}
+	printAccess(stats.Access)
+
+	if !verbose {
+		return
+	}
+
+	fmt.Printf("Dimensions:  %d\n", stats.Dimensions)
+	printHeader(header, file)
+	fmt.Printf("Memory:      %d bytes (keys %d, values %d, metadata ~%d, payloads %d, index %d)\n",
+		stats.TotalBytes(), stats.KeyBytes, stats.ValueBytes, stats.MetadataBytes, stats.PayloadBytes, stats.IndexBytes)
+	fmt.Printf("Index dirty: %t\n", stats.IndexDirty)
+	fmt.Printf("Norms:       min %.4f  max %.4f  mean %.4f\n", stats.MinNorm, stats.MaxNorm, stats.MeanNorm)
+
+	if compression != nil {
+		fmt.Printf("Text:        %d -> %d bytes on disk (%.1f%% saved, %d/%d nodes compressed)\n",
+			compression.TextRawBytes, compression.TextStoredBytes, 100*compression.TextSavings(),
+			compression.CompressedNodes, compression.Nodes)
+		fmt.Printf("Vectors:     %d bytes (uncompressed float32)\n", compression.VectorBytes)
+	}
+}
+
 func main() {
 	if len(os.Args) < 2 {
 		fmt.Println("Hippocampus CLI - AI Agent Memory Database")
 		fmt.Println()
 		fmt.Println("Usage:")
-		fmt.Println("  hippocampus insert -binary tree.bin -key <id> -text <text>")
+		fmt.Println("  hippocampus insert -binary tree.bin -key <id> -text <text> [-metadata '{\"category\":\"food\"}'] [-timestamp 2024-01-15T10:00:00Z]")
 		fmt.Println("  hippocampus search -binary tree.bin -text <text> -epsilon 0.3 -threshold 0.5 -top-k 5")
-		fmt.Println("  hippocampus insert-csv -binary tree.bin -csv <file.csv>")
+		fmt.Println("  hippocampus search -binary tree.bin -text <text> -hybrid -alpha 0.5 -top-k 5")
+		fmt.Println("  hippocampus search -binary tree.bin -text <text> -mmr -mmr-lambda 0.7 -top-k 5")
+		fmt.Println("  hippocampus search -binary s3://bucket/agents/foo.bin -text <text>")
+		fmt.Println("  hippocampus search -binary tree.bin -text <text> -min-score 0.8")
+		fmt.Println("  hippocampus search -binary tree.bin -like \"text a\" -like \"text b\" -unlike \"text c\"")
+		fmt.Println("  hippocampus search -binary tree.bin -text <text> -top-k 5 -offset 5")
+		fmt.Println("  hippocampus search -binary tree.bin -text <text> -group-by doc_id")
+		fmt.Println("  hippocampus search -binary tree.bin -text <text> -filter '{\"category\":\"food\"}' -since 2024-01-01T00:00:00Z")
+		fmt.Println("  hippocampus search -binary tree.bin -o json - < query.txt")
+		fmt.Println("  hippocampus search -binary tree.bin -text <text> -embed ollama://localhost:11434/nomic-embed-text -strict")
+		fmt.Println("  hippocampus insert-csv -binary tree.bin -csv <file.csv> [-timestamp-column 2]")
+		fmt.Println("  hippocampus insert -binary tree.bin -key <id> -text <text> -retention nodes=100000,bytes=50MB,strategy=importance")
+		fmt.Println("  hippocampus calibrate -binary tree.bin -pairs pairs.jsonl [-dry-run]")
+		fmt.Println("  hippocampus tune -binary tree.bin -k 10 [-save]")
+		fmt.Println("  hippocampus search -binary tree.bin -text \"query\" -radius similar")
+		fmt.Println("  hippocampus project -binary new.bin -texts samples.txt -dims 256 -embed openai://text-embedding-3-small")
+		fmt.Println("  hippocampus reproject -binary big.bin -out small.bin -dims 256 [-random]")
+		fmt.Println("  hippocampus reembed -binary old.bin -out new.bin -embed ollama://localhost:11434/mxbai-embed-large [-resume] [-report failed.jsonl]")
+		fmt.Println("  hippocampus watch -binary notes.bin -dir ./notes -ollama nomic-embed-text [-once]")
+		fmt.Println("  cat notes.txt | hippocampus insert-lines -binary tree.bin [-prefix-metadata source=notes]")
+		fmt.Println("  hippocampus insert-doc -binary tree.bin -file notes.md [-doc-id notes] -chunk-size 256 -chunk-overlap 32")
+		fmt.Println("  hippocampus import -binary tree.bin -from chroma -path ./chroma_export/")
+		fmt.Println("  hippocampus import -binary tree.bin -from faiss -path vectors.f32 -texts texts.jsonl -dims 512")
+		fmt.Println("  hippocampus export -binary tree.bin -format parquet -out memories.parquet [-row-group-size 10000]")
+		fmt.Println("  hippocampus export-npy -binary tree.bin -vectors vectors.npy -values values.jsonl")
+		fmt.Println("  hippocampus import-npy -binary tree.bin -vectors vectors.npy -values values.jsonl")
 		fmt.Println("  hippocampus agent-curate -binary tree.bin -text <text> -importance high")
+		fmt.Println("  hippocampus serve -binary tree.bin -addr :8080")
+		fmt.Println("  hippocampus serve -binary tree.bin -addr :8080 -warmup")
+		fmt.Println("  hippocampus serve -binary tree.bin -addr :8080 -rate-limit 20 -rate-burst 40")
+		fmt.Println("  hippocampus serve -data-dir ./databases -addr :8080 -max-open 64")
+		fmt.Println("  hippocampus bench -binary tree.bin [-queries queries.jsonl] -k 10 -epsilons 0.1,0.2,0.3 [-thresholds 0,0.5] [-min-dim-matches 0,500,480] [-o json]")
+		fmt.Println("  hippocampus stats -binary tree.bin [-sample 10000] [-o json]")
+		fmt.Println("  hippocampus info -binary tree.bin [-v] [-o json]")
+		fmt.Println("  hippocampus compact -binary tree.bin")
+		fmt.Println("  hippocampus convert -in tree.bin -out tree.cz -to compressed|plain [-force]")
+		fmt.Println("  hippocampus snapshot -binary tree.bin -name before-import")
+		fmt.Println("  hippocampus snapshots -binary tree.bin [-o json]")
+		fmt.Println("  hippocampus restore -binary tree.bin -name before-import [-force]")
+		fmt.Println("  hippocampus diff -a prod.bin -b staging.bin [-o json]")
+		fmt.Println("  hippocampus verify -a plain.bin -b compressed.bin -sample 1000 [-tolerance 0.001]")
+		fmt.Println("  hippocampus sample -binary tree.bin -n 20 [-dims 8]")
+		fmt.Println("  hippocampus get -binary tree.bin -index 12345 | -id <id>")
+		fmt.Println("  hippocampus grep -binary tree.bin -pattern <text> [-regex] [-case-sensitive] -limit 20")
+		fmt.Println("  hippocampus count -binary tree.bin [-filter key=value] [-group-by key]")
+		fmt.Println("  hippocampus validate -binary tree.bin [-limit 20] [-o json]")
+		fmt.Println("  hippocampus schema set -binary tree.bin -fields 'category=string!,count=int,when=time' [-strict]")
+		fmt.Println("  hippocampus schema show -binary tree.bin [-o json]")
 		fmt.Println()
 		fmt.Println("Commands:")
 		fmt.Println("  insert        Store a single memory with a key")
 		fmt.Println("  search        Search for similar memories")
 		fmt.Println("  insert-csv    Bulk insert from CSV file")
+		fmt.Println("  insert-lines  Insert one memory per non-blank line of stdin")
+		fmt.Println("  watch         Keep a directory of notes indexed as it changes")
+		fmt.Println("  calibrate     Fit the named search radii to labelled text pairs")
+		fmt.Println("  tune          Suggest search radii from how the stored vectors are spread")
+		fmt.Println("  project       Train a projection for a wide embedding model and store it in a new database")
+		fmt.Println("  reproject     Copy a database with every key projected down to fewer dimensions")
+		fmt.Println("  reembed       Copy a database's texts into a new one, embedded with a different model")
+		fmt.Println("  insert-doc    Split a long document into overlapping chunks and insert each")
+		fmt.Println("  import        Copy memories and their embeddings from a Chroma or FAISS export")
+		fmt.Println("  export        Write every node to a Parquet file for DuckDB, Spark or pandas")
+		fmt.Println("  export-npy    Write keys as a numpy .npy matrix plus a JSON lines values file, led by the database header")
+		fmt.Println("  import-npy    Insert rows of a .npy matrix and values file written by export-npy, applying its header")
 		fmt.Println("  agent-curate  Use AI agent to decompose text into discrete memories")
+		fmt.Println("  serve         Serve a database, or a directory of them, over HTTP (/insert, /search, /search/stream, /embed, /info, /metrics)")
+		fmt.Println("  bench         Measure recall@k and latency of the index against exact search")
+		fmt.Println("  stats         Report per-dimension, norm and duplicate diagnostics")
+		fmt.Println("  info          Report node count, file size, embedding model and (with -v) memory use")
+		fmt.Println("  compact       Rewrite the database atomically and report the size change")
+		fmt.Println("  convert       Stream a database file into the plain or compressed format")
+		fmt.Println("  snapshot      Save a named restore point in <database>.snapshots")
+		fmt.Println("  snapshots     List restore points, oldest first")
+		fmt.Println("  restore       Replace the database with a snapshot (latest of that name)")
+		fmt.Println("  diff          Compare two databases: nodes only in one, and changed nodes")
+		fmt.Println("  sample        Print randomly chosen nodes with their norms, for spot checks")
+		fmt.Println("  get           Print one node, raw vector included, as JSON")
+		fmt.Println("  grep          Match stored text by substring or regex, no embedding needed")
+		fmt.Println("  count         Count nodes matching a metadata filter, optionally grouped")
+		fmt.Println("  validate      List nodes with NaN or infinite key values; exits 1 if any")
+		fmt.Println("  schema        Set, show or clear the typed metadata fields inserts must match")
 		fmt.Println()
 		fmt.Println("Global Flags:")
 		fmt.Println("  -binary       Database file path (default: tree.bin)")
@@ -39,67 +803,879 @@ func main() {
 		region := insertCmd.String("region", "us-east-1", "AWS region")
 		key := insertCmd.String("key", "", "key/identifier for the text")
 		text := insertCmd.String("text", "", "text to embed and store")
+		normalize := insertCmd.Bool("normalize", false, "L2-normalize vectors (fixed when the database is created)")
+		zeroVectors := insertCmd.String("zero-vectors", "allow", "all-zero keys on insert: allow, warn or reject")
+		metadataFlag := insertCmd.String("metadata", "", `metadata as a JSON object, e.g. {"category":"food","importance":3}`)
+		timestamp := insertCmd.String("timestamp", "", "when the memory happened, RFC 3339 (e.g. 2024-01-15T10:00:00Z)")
+		printStats := insertCmd.Bool("stats", false, "print the insert's timings and node counts as JSON on stderr")
+		embedOpts := addEmbedFlags(insertCmd, false)
+		retention := insertCmd.String("retention", "", retentionUsage)
 		insertCmd.Parse(os.Args[2:])
 
 		if *key == "" || *text == "" {
 			log.Fatal("both -key and -text are required")
 		}
 
-		client, err := client.New(*binary, *region)
+		metadata, err := parseJSONMetadata(*metadataFlag)
 		if err != nil {
-			log.Fatalf("Failed to create client: %v", err)
+			log.Fatalf("Invalid -metadata: %v", err)
+		}
+		if *timestamp != "" {
+			ts, err := time.Parse(time.RFC3339Nano, *timestamp)
+			if err != nil {
+				log.Fatalf("Invalid -timestamp: %v", err)
+			}
+			metadata = types.WithTimestamp(metadata, ts)
+		} else if ts, ok := metadata[types.TimestampKey]; ok {
+			if _, err := time.Parse(time.RFC3339Nano, ts); err != nil {
+				log.Fatalf("Invalid -metadata: %q must be an RFC 3339 time: %v", types.TimestampKey, err)
+			}
+		}
+
+		c := openClient(*binary, *region)
+		c.Normalize = *normalize
+		c.ZeroVectors = zeroVectorPolicy(*zeroVectors)
+		defer embedOpts.apply(c, *binary)()
+		if err := applyRetention(c, *retention); err != nil {
+			log.Fatal(err)
 		}
 
-		if err := client.Insert(*key, *text); err != nil {
+		if err := c.CheckEmbedder(); err != nil {
+			log.Fatal(err)
+		}
+
+		stats, err := c.InsertStats(*key, *text, metadata)
+		if err != nil {
 			log.Fatalf("Insert failed: %v", err)
 		}
 
+		// Insert only flushes every 100th node; write this one out now
+		flushed, err := c.FlushStats()
+		if err != nil {
+			log.Fatalf("Flush failed: %v", err)
+		}
+		if err := c.Close(); err != nil {
+			log.Fatalf("Flush failed: %v", err)
+		}
+
+		if *printStats {
+			stats.AddFlush(flushed)
+			writeStats(stats)
+		}
+
 	case "search":
 		searchCmd := flag.NewFlagSet("search", flag.ExitOnError)
 		binary := searchCmd.String("binary", "tree.bin", "database file")
 		region := searchCmd.String("region", "us-east-1", "AWS region")
 		text := searchCmd.String("text", "", "text to search for")
-		epsilon := searchCmd.Float64("epsilon", 0.3, "search radius (per-dimension bounding box)")
-		threshold := searchCmd.Float64("threshold", 0.5, "similarity threshold (0.0-1.0, higher = stricter)")
-		topK := searchCmd.Int("top-k", 5, "maximum number of results to return")
+		epsilon := searchCmd.Float64("epsilon", types.DefaultEpsilon, "search radius (per-dimension bounding box)")
+		radius := searchCmd.String("radius", "", "named search radius, e.g. similar or related (overrides -epsilon; see calibrate)")
+		threshold := searchCmd.Float64("threshold", types.DefaultThreshold, "similarity threshold (0.0-1.0, higher = stricter)")
+		topK := searchCmd.Int("top-k", types.DefaultTopK, "maximum number of results to return")
+		searchCmd.IntVar(topK, "top", types.DefaultTopK, "alias for -top-k")
+		hybrid := searchCmd.Bool("hybrid", false, "combine keyword (BM25) and vector ranking")
+		alpha := searchCmd.Float64("alpha", 0.5, "hybrid weight: 1 = pure vector, 0 = pure keyword")
+		mmr := searchCmd.Bool("mmr", false, "re-rank results for diversity (maximal marginal relevance)")
+		mmrLambda := searchCmd.Float64("mmr-lambda", 0.7, "MMR trade-off: 1 = pure relevance, 0 = pure diversity")
+		fetchK := searchCmd.Int("fetch-k", 0, "candidates to re-rank with -mmr (default 4x top-k)")
+		offset := searchCmd.Int("offset", 0, "skip this many ranked results (for paging)")
+		maxDistance := searchCmd.Float64("max-distance", 0, "explicit Euclidean distance cutoff (overrides -threshold)")
+		minScore := searchCmd.Float64("min-score", 0, "only return results with at least this cosine similarity, 0-1 (overrides -threshold)")
+		minDimMatches := searchCmd.Int("min-dim-matches", 0, "match nodes inside the epsilon range of at least this many dimensions (0 = all); higher recall, slower search")
+		multiVector := searchCmd.Bool("multi-vector", false, "also match nodes through their alternate keys, one result per node")
+		trackAccess := searchCmd.Bool("track-access", false, "count this search as a hit on each result, stored in its hit_count and last_accessed metadata")
+		groupBy := searchCmd.String("group-by", "", "keep the best result per value of this metadata key (e.g. doc_id), noting how many others it collapsed")
+		filterFlag := searchCmd.String("filter", "", `only match nodes with this metadata, as a JSON object, e.g. {"category":"food"}; keys may be dotted paths into JSON values, e.g. {"user.tier":"pro"}`)
+		since := searchCmd.String("since", "", "only match nodes with a timestamp at or after this RFC 3339 time")
+		until := searchCmd.String("until", "", "only match nodes with a timestamp at or before this RFC 3339 time")
+		output := searchCmd.String("o", "text", "output format: text or json")
+		printStats := searchCmd.Bool("stats", false, "print the search's timings as JSON on stderr")
+		explain := searchCmd.Bool("explain", false, "report how the search narrowed the tree to its results (as JSON on stderr with -o json)")
+		var like, unlike stringList
+		searchCmd.Var(&like, "like", "search from the centroid of example texts, with -text (repeatable)")
+		searchCmd.Var(&unlike, "unlike", "subtract an example text from the query, e.g. -like a -unlike b -like c for a - b + c (repeatable)")
+		embedOpts := addEmbedFlags(searchCmd, false)
 		searchCmd.Parse(os.Args[2:])
 
-		if *text == "" {
-			log.Fatal("-text is required")
+		// -text - (or a lone - argument) reads the query from stdin
+		if *text == "" && searchCmd.Arg(0) == "-" {
+			*text = "-"
+		}
+		if *text == "-" {
+			query, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				log.Fatalf("Failed to read query from stdin: %v", err)
+			}
+			*text = strings.TrimSpace(string(query))
+		}
+		if *text != "" {
+			like = append(stringList{*text}, like...)
+		}
+		if len(like) == 0 {
+			log.Fatal("-text or -like is required")
+		}
+		examples := len(like) > 1 || len(unlike) > 0
+		if examples && *hybrid {
+			log.Fatal("-hybrid can't be combined with -like or -unlike")
+		}
+		if *hybrid && *trackAccess {
+			log.Fatal("-hybrid can't be combined with -track-access")
+		}
+		if *hybrid && *explain {
+			log.Fatal("-hybrid can't be combined with -explain")
+		}
+		if *output != "text" && *output != "json" {
+			log.Fatalf("unknown output format: %s (use text or json)", *output)
 		}
 
-		client, err := client.New(*binary, *region)
+		filter, err := parseSearchFilter(*filterFlag, *since, *until)
 		if err != nil {
-			log.Fatalf("Failed to create client: %v", err)
+			log.Fatal(err)
+		}
+
+		c := openClient(*binary, *region)
+		defer embedOpts.apply(c, *binary)()
+		if *output == "json" {
+			c.SetVerbose(false)
 		}
 
-		_, err = client.Search(*text, float32(*epsilon), float32(*threshold), *topK)
+		if *radius != "" {
+			value, err := c.RadiusValue(*radius)
+			if err != nil {
+				log.Fatal(err)
+			}
+			*epsilon = float64(value)
+		}
+
+		if *hybrid {
+			results, err := c.HybridSearch(like[0], float32(*alpha), *topK)
+			if err != nil {
+				log.Fatalf("Hybrid search failed: %v", err)
+			}
+			if *output == "json" {
+				printJSON(results)
+			}
+			break
+		}
+
+		opts := types.SearchOptions{
+			Epsilon:       float32(*epsilon),
+			Threshold:     float32(*threshold),
+			TopK:          *topK,
+			MMR:           *mmr,
+			MMRLambda:     float32(*mmrLambda),
+			FetchK:        *fetchK,
+			Offset:        *offset,
+			MaxDistance:   float32(*maxDistance),
+			MinScore:      float32(*minScore),
+			GroupBy:       *groupBy,
+			MinDimMatches: *minDimMatches,
+			MultiVector:   *multiVector,
+			TrackAccess:   *trackAccess,
+			Filter:        filter,
+			Hint:          true,
+		}
+		if *explain {
+			opts.Explanation = &types.ExplainReport{}
+		}
+		searchCmd.Visit(func(f *flag.Flag) {
+			if f.Name == "threshold" && opts.MinScore > 0 {
+				log.Printf("warning: -min-score %g overrides -threshold %g", opts.MinScore, opts.Threshold)
+			}
+		})
+
+		var results []client.SearchResult
+		var stats client.OperationStats
+		if examples {
+			results, stats, err = c.SearchByExamples(like, unlike, nil, opts)
+		} else {
+			results, stats, err = c.SearchOpts(like[0], opts)
+		}
 		if err != nil {
 			log.Fatalf("Search failed: %v", err)
 		}
+		// The hits are held until a flush writes them
+		if *trackAccess {
+			if err := c.Close(); err != nil {
+				log.Fatalf("Failed to save access counts: %v", err)
+			}
+		}
+		if *output == "json" {
+			printJSON(results)
+			// Text output has the hint under the results already
+			if stats.Hint != nil {
+				log.Printf("hint: %s", stats.Hint.Message)
+			}
+		}
+		if *printStats {
+			writeStats(stats)
+		}
+		if *explain {
+			if *output == "json" {
+				if err := json.NewEncoder(os.Stderr).Encode(opts.Explanation); err != nil {
+					log.Fatalf("Failed to encode explanation: %v", err)
+				}
+			} else {
+				printExplain(*opts.Explanation)
+			}
+		}
+
+	case "insert-lines":
+		linesCmd := flag.NewFlagSet("insert-lines", flag.ExitOnError)
+		binary := linesCmd.String("binary", "tree.bin", "database file")
+		region := linesCmd.String("region", "us-east-1", "AWS region")
+		prefixMetadata := linesCmd.String("prefix-metadata", "", "metadata stored on every line: key=value[,key=value...]")
+		batchSize := linesCmd.Int("batch-size", 64, "lines embedded and inserted per batch")
+		normalize := linesCmd.Bool("normalize", false, "L2-normalize vectors (fixed when the database is created)")
+		zeroVectors := linesCmd.String("zero-vectors", "allow", "all-zero keys on insert: allow, warn or reject")
+		embedOpts := addEmbedFlags(linesCmd, false)
+		retention := linesCmd.String("retention", "", retentionUsage)
+		linesCmd.Parse(os.Args[2:])
+
+		metadata, err := parseMetadata(*prefixMetadata)
+		if err != nil {
+			log.Fatalf("Invalid -prefix-metadata: %v", err)
+		}
+		if *batchSize <= 0 {
+			log.Fatal("-batch-size must be positive")
+		}
+
+		// stdout is left to whatever follows in the pipeline
+		c := openClient(*binary, *region)
+		c.Normalize = *normalize
+		c.ZeroVectors = zeroVectorPolicy(*zeroVectors)
+		c.SetVerbose(false)
+		defer embedOpts.apply(c, *binary)()
+		if err := applyRetention(c, *retention); err != nil {
+			log.Fatal(err)
+		}
+
+		if err := c.CheckEmbedder(); err != nil {
+			log.Fatal(err)
+		}
+
+		inserted := 0
+		batch := make([]string, 0, *batchSize)
+		flushBatch := func() {
+			if len(batch) == 0 {
+				return
+			}
+			if err := c.InsertTexts(batch, metadata); err != nil {
+				log.Fatalf("Insert failed after %d lines: %v", inserted, err)
+			}
+			inserted += len(batch)
+			batch = batch[:0]
+			fmt.Fprintf(os.Stderr, "Inserted %d lines\n", inserted)
+		}
+
+		scanner := bufio.NewScanner(os.Stdin)
+		scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			batch = append(batch, line)
+			if len(batch) == *batchSize {
+				flushBatch()
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			log.Fatalf("Failed to read stdin after %d lines: %v", inserted, err)
+		}
+		flushBatch()
+
+		fmt.Fprintf(os.Stderr, "Inserted %d lines into %s\n", inserted, *binary)
 
 	case "insert-csv":
 		csvCmd := flag.NewFlagSet("insert-csv", flag.ExitOnError)
 		binary := csvCmd.String("binary", "tree.bin", "database file")
 		region := csvCmd.String("region", "us-east-1", "AWS region")
 		csvFile := csvCmd.String("csv", "", "csv file path")
+		batchSize := csvCmd.Int("batch-size", client.DefaultCSVBatchSize, "rows embedded and inserted per batch")
+		timestampColumn := csvCmd.Int("timestamp-column", 0, "0-based column holding each row's RFC 3339 timestamp, e.g. 2 for key,text,timestamp (0 means none)")
+		normalize := csvCmd.Bool("normalize", false, "L2-normalize vectors (fixed when the database is created)")
+		zeroVectors := csvCmd.String("zero-vectors", "allow", "all-zero keys on insert: allow, warn or reject")
+		embedOpts := addEmbedFlags(csvCmd, false)
+		retention := csvCmd.String("retention", "", retentionUsage)
 		csvCmd.Parse(os.Args[2:])
 
 		if *csvFile == "" {
 			log.Fatalf("-csv is required")
 		}
 
-		client, err := client.New(*binary, *region)
-		if err != nil {
-			log.Fatalf("Failed to create client: %v", err)
+		c := openClient(*binary, *region)
+		c.Normalize = *normalize
+		c.ZeroVectors = zeroVectorPolicy(*zeroVectors)
+		c.CSVTimestampColumn = *timestampColumn
+		defer embedOpts.apply(c, *binary)()
+		if err := applyRetention(c, *retention); err != nil {
+			log.Fatal(err)
 		}
 
-		if err := client.InsertCSV(*csvFile); err != nil {
+		if err := c.CheckEmbedder(); err != nil {
+			log.Fatal(err)
+		}
+
+		if err := c.InsertCSVBatch(*csvFile, *batchSize); err != nil {
 			log.Fatalf("CSV insert failed: %v", err)
 		}
 
-	case "agent-curate":
-		curateCmd := flag.NewFlagSet("agent-curate", flag.ExitOnError)
+	case "insert-doc":
+		docCmd := flag.NewFlagSet("insert-doc", flag.ExitOnError)
+		binary := docCmd.String("binary", "tree.bin", "database file")
+		region := docCmd.String("region", "us-east-1", "AWS region")
+		file := docCmd.String("file", "", "document to insert")
+		docID := docCmd.String("doc-id", "", "document ID stored on every chunk (default: file name)")
+		defaults := embedding.DefaultChunkOptions()
+		chunkSize := docCmd.Int("chunk-size", defaults.Size, "approximate tokens per chunk")
+		chunkOverlap := docCmd.Int("chunk-overlap", defaults.Overlap, "approximate tokens shared by neighbouring chunks")
+		normalize := docCmd.Bool("normalize", false, "L2-normalize vectors (fixed when the database is created)")
+		zeroVectors := docCmd.String("zero-vectors", "allow", "all-zero keys on insert: allow, warn or reject")
+		embedOpts := addEmbedFlags(docCmd, false)
+		retention := docCmd.String("retention", "", retentionUsage)
+		docCmd.Parse(os.Args[2:])
+
+		if *file == "" {
+			log.Fatal("-file is required")
+		}
+		if *docID == "" {
+			*docID = filepath.Base(*file)
+		}
+
+		text, err := os.ReadFile(*file)
+		if err != nil {
+			log.Fatalf("Failed to read document: %v", err)
+		}
+
+		c := openClient(*binary, *region)
+		c.Normalize = *normalize
+		c.ZeroVectors = zeroVectorPolicy(*zeroVectors)
+		defer embedOpts.apply(c, *binary)()
+		if err := applyRetention(c, *retention); err != nil {
+			log.Fatal(err)
+		}
+
+		if err := c.CheckEmbedder(); err != nil {
+			log.Fatal(err)
+		}
+
+		opts := embedding.ChunkOptions{Size: *chunkSize, Overlap: *chunkOverlap}
+		if _, err := c.InsertDocument(*docID, string(text), nil, opts); err != nil {
+			log.Fatalf("Document insert failed: %v", err)
+		}
+
+	case "project":
+		projectCmd := flag.NewFlagSet("project", flag.ExitOnError)
+		binary := projectCmd.String("binary", "tree.bin", "new, empty database file")
+		region := projectCmd.String("region", "us-east-1", "AWS region")
+		textsPath := projectCmd.String("texts", "", "sample texts, one per line, to train the projection on")
+		dims := projectCmd.Int("dims", 256, "dimensions to keep (at most 512)")
+		embedOpts := addEmbedFlags(projectCmd, false)
+		projectCmd.Parse(os.Args[2:])
+
+		if *textsPath == "" {
+			log.Fatal("-texts is required")
+		}
+		texts, err := readTextLines(*textsPath)
+		if err != nil {
+			log.Fatalf("Failed to read texts: %v", err)
+		}
+
+		c := openClient(*binary, *region)
+		c.Metrics = metrics.Noop{}
+		saveEmbedCache := embedOpts.apply(c, *binary)
+
+		p, err := c.TrainProjection(texts, *dims)
+		saveEmbedCache()
+		if err != nil {
+			log.Fatalf("Failed to train projection: %v", err)
+		}
+		if err := c.SetProjection(p); err != nil {
+			log.Fatalf("Failed to store projection: %v", err)
+		}
+
+		fmt.Printf("Stored a %d -> %d dimension projection in %s, trained on %d texts\n", p.InputDims, p.OutputDims, *binary, len(texts))
+
+	case "reproject":
+		reprojectCmd := flag.NewFlagSet("reproject", flag.ExitOnError)
+		binary := reprojectCmd.String("binary", "tree.bin", "database file or sharded directory to read")
+		out := reprojectCmd.String("out", "", "database file or sharded directory to write")
+		dims := reprojectCmd.Int("dims", 256, "dimensions to keep")
+		sample := reprojectCmd.Int("sample", 10000, "maximum keys to train on (0 = all)")
+		random := reprojectCmd.Bool("random", false, "use a random Gaussian projection instead of PCA")
+		k := reprojectCmd.Int("k", 10, "neighbours to compare before and after")
+		queries := reprojectCmd.Int("queries", 100, "nodes whose neighbourhoods are compared (0 = all)")
+		reprojectCmd.Parse(os.Args[2:])
+
+		if *out == "" {
+			log.Fatal("-out is required")
+		}
+		if _, err := os.Stat(*out); err == nil {
+			log.Fatalf("%s already exists", *out)
+		}
+
+		tree, err := storage.Open(*binary).Load()
+		if err != nil {
+			log.Fatalf("Failed to load %s: %v", *binary, err)
+		}
+		if len(tree.Nodes) == 0 {
+			log.Fatalf("%s is empty", *binary)
+		}
+
+		var p *types.Projection
+		if *random {
+			p, err = types.RandomProjection(512, *dims, 1)
+		} else {
+			var vectors [][]float32
+			for _, i := range types.SampleIndices(len(tree.Nodes), *sample) {
+				vectors = append(vectors, tree.Nodes[i].Key[:])
+			}
+			p, err = types.TrainProjection(vectors, *dims)
+		}
+		if err != nil {
+			log.Fatalf("Failed to train projection: %v", err)
+		}
+
+		projected, err := tree.Reproject(p)
+		if err != nil {
+			log.Fatalf("Failed to reproject: %v", err)
+		}
+
+		compared := types.SampleIndices(len(tree.Nodes), *queries)
+		overlap, err := types.NeighborOverlap(tree, projected, compared, *k)
+		if err != nil {
+			log.Fatalf("Failed to compare neighbours: %v", err)
+		}
+
+		if err := storage.Open(*out).Save(projected); err != nil {
+			log.Fatalf("Failed to save %s: %v", *out, err)
+		}
+
+		fmt.Printf("Reprojected %s -> %s: %d nodes, %d dimensions kept\n", *binary, *out, len(projected.Nodes), p.OutputDims)
+		fmt.Printf("Top-%d neighbour overlap: %.3f (mean over %d nodes)\n", *k, overlap, len(compared))
+
+	case "reembed":
+		reembedCmd := flag.NewFlagSet("reembed", flag.ExitOnError)
+		binary := reembedCmd.String("binary", "tree.bin", "database file or sharded directory to read")
+		out := reembedCmd.String("out", "", "database file to write; must be new or empty (e.g. just created by project)")
+		region := reembedCmd.String("region", "us-east-1", "AWS region")
+		batchSize := reembedCmd.Int("batch-size", client.DefaultReembedBatchSize, "texts embedded and inserted per batch")
+		resume := reembedCmd.Bool("resume", false, "continue an interrupted run from the checkpoint next to -out")
+		report := reembedCmd.String("report", "", "write the texts that failed, as JSON lines, to this file")
+		normalize := reembedCmd.Bool("normalize", false, "L2-normalize vectors (fixed when the database is created)")
+		embedOpts := addEmbedFlags(reembedCmd, false)
+		reembedCmd.Parse(os.Args[2:])
+
+		if *out == "" {
+			log.Fatal("-out is required")
+		}
+
+		source := openClient(*binary, *region)
+		target := openClient(*out, *region)
+		target.Normalize = *normalize
+		target.Metrics = metrics.Noop{}
+		target.SetVerbose(false)
+		defer embedOpts.apply(target, *out)()
+
+		checkpoint := client.ReembedCheckpointPath(target)
+		_, err := os.Stat(checkpoint)
+		switch {
+		case err == nil && !*resume:
+			log.Fatalf("%s has an unfinished re-embed; use -resume to continue it, or delete %s and %s to start over", *out, *out, checkpoint)
+		case err != nil && *resume:
+			log.Fatalf("Nothing to resume: %v", err)
+		}
+		if err := target.CheckEmbedder(); err != nil {
+			log.Fatal(err)
+		}
+
+		result, err := source.Reembed(target, nil, *batchSize, func(done, total int) {
+			fmt.Fprintf(os.Stderr, "Re-embedded %d of %d nodes\n", done, total)
+		})
+		if err != nil {
+			log.Fatalf("Re-embedding failed (%d nodes inserted; rerun with -resume): %v", result.Inserted, err)
+		}
+		if err := target.Close(); err != nil {
+			log.Fatalf("Failed to save %s: %v", *out, err)
+		}
+
+		fmt.Printf("Re-embedded %d of %d nodes from %s into %s", result.Inserted, result.Total, *binary, *out)
+		if result.Resumed > 0 {
+			fmt.Printf(" (%d done by earlier runs)", result.Resumed)
+		}
+		fmt.Println()
+
+		if len(result.Failed) > 0 {
+			fmt.Printf("%d nodes failed:\n", len(result.Failed))
+			for i, failure := range result.Failed {
+				if i == 10 && *report == "" {
+					fmt.Printf("  ... use -report for the rest\n")
+					break
+				}
+				if i < 10 {
+					fmt.Printf("  #%d  %s: %s\n", failure.Index, shorten(failure.Text, 40), failure.Error)
+				}
+			}
+		}
+		if *report != "" {
+			if err := writeReembedReport(*report, result.Failed); err != nil {
+				log.Fatalf("Failed to write %s: %v", *report, err)
+			}
+		}
+
+	case "watch":
+		watchCmd := flag.NewFlagSet("watch", flag.ExitOnError)
+		binary := watchCmd.String("binary", "tree.bin", "database file")
+		region := watchCmd.String("region", "us-east-1", "AWS region")
+		dir := watchCmd.String("dir", "", "directory of notes to index")
+		once := watchCmd.Bool("once", false, "sync once and exit instead of watching (for cron)")
+		debounce := watchCmd.Duration("debounce", watch.DefaultDebounce, "wait this long after the last change before syncing")
+		extensions := watchCmd.String("ext", strings.Join(watch.DefaultExtensions, ","), "comma-separated file extensions to index")
+		defaults := embedding.DefaultChunkOptions()
+		chunkSize := watchCmd.Int("chunk-size", defaults.Size, "approximate tokens per chunk")
+		chunkOverlap := watchCmd.Int("chunk-overlap", defaults.Overlap, "approximate tokens shared by neighbouring chunks")
+		normalize := watchCmd.Bool("normalize", false, "L2-normalize vectors (fixed when the database is created)")
+		zeroVectors := watchCmd.String("zero-vectors", "allow", "all-zero keys on insert: allow, warn or reject")
+		embedOpts := addEmbedFlags(watchCmd, true)
+		retention := watchCmd.String("retention", "", retentionUsage)
+		watchCmd.Parse(os.Args[2:])
+
+		if *dir == "" {
+			log.Fatal("-dir is required")
+		}
+
+		var exts []string
+		for _, ext := range strings.Split(*extensions, ",") {
+			ext = strings.ToLower(strings.TrimSpace(ext))
+			if ext == "" {
+				continue
+			}
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			exts = append(exts, ext)
+		}
+
+		c := openClient(*binary, *region)
+		c.Normalize = *normalize
+		c.ZeroVectors = zeroVectorPolicy(*zeroVectors)
+		c.SetVerbose(false)
+		c.Metrics = metrics.Noop{}
+		saveCache := embedOpts.apply(c, *binary)
+		if err := applyRetention(c, *retention); err != nil {
+			log.Fatal(err)
+		}
+
+		if err := c.CheckEmbedder(); err != nil {
+			log.Fatal(err)
+		}
+
+		w, err := watch.New(c, *dir, watch.Options{
+			Extensions: exts,
+			Chunk:      embedding.ChunkOptions{Size: *chunkSize, Overlap: *chunkOverlap},
+			Debounce:   *debounce,
+		})
+		if err != nil {
+			log.Fatalf("Failed to watch %s: %v", *dir, err)
+		}
+
+		if *once {
+			result, err := w.Sync()
+			saveCache()
+			if err != nil {
+				log.Fatalf("Sync failed: %v", err)
+			}
+			if err := c.Close(); err != nil {
+				log.Fatalf("Flush failed: %v", err)
+			}
+			fmt.Printf("Synced %s: %s\n", *dir, result)
+			if result.Failed > 0 {
+				os.Exit(1)
+			}
+			break
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		fmt.Printf("Watching %s into %s\n", *dir, *binary)
+		if err := w.Run(ctx); err != nil {
+			log.Fatalf("Watch failed: %v", err)
+		}
+
+		saveCache()
+		if err := c.Close(); err != nil {
+			log.Fatalf("Flush failed: %v", err)
+		}
+
+	case "tune":
+		tuneCmd := flag.NewFlagSet("tune", flag.ExitOnError)
+		binary := tuneCmd.String("binary", "tree.bin", "database file")
+		region := tuneCmd.String("region", "us-east-1", "AWS region")
+		k := tuneCmd.Int("k", 10, "exact nearest neighbours the \"related\" radius should hold for a typical query")
+		save := tuneCmd.Bool("save", false, "store the suggested radii in the database")
+		output := tuneCmd.String("o", "table", "output format: table or json")
+		tuneCmd.Parse(os.Args[2:])
+
+		if *output != "table" && *output != "json" {
+			log.Fatalf("unknown output format: %s (use table or json)", *output)
+		}
+
+		c := openClient(*binary, *region)
+		c.Metrics = metrics.Noop{}
+
+		before, err := c.RadiusTable()
+		if err != nil {
+			log.Fatalf("Failed to load database: %v", err)
+		}
+
+		radii, err := c.SuggestRadii(*k)
+		if err != nil {
+			log.Fatalf("Tuning failed: %v", err)
+		}
+
+		if *save {
+			if err := c.SetRadii(radii); err != nil {
+				log.Fatalf("Failed to store radii: %v", err)
+			}
+			if err := c.Close(); err != nil {
+				log.Fatalf("Flush failed: %v", err)
+			}
+		}
+
+		if *output == "json" {
+			printJSON(radii)
+			break
+		}
+
+		words := make([]string, 0, len(radii))
+		for word := range radii {
+			words = append(words, word)
+		}
+		sort.Slice(words, func(i, j int) bool { return radii[words[i]] < radii[words[j]] })
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "RADIUS\tBEFORE\tEPSILON")
+		for _, word := range words {
+			previous := "-"
+			if value, ok := before[word]; ok {
+				previous = fmt.Sprintf("%.4f", value)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%.4f\n", word, previous, radii[word])
+		}
+		w.Flush()
+		if *save {
+			fmt.Printf("Stored %d radii in %s\n", len(radii), *binary)
+		} else {
+			fmt.Println("Not stored; rerun with -save to keep them")
+		}
+
+	case "calibrate":
+		calibrateCmd := flag.NewFlagSet("calibrate", flag.ExitOnError)
+		binary := calibrateCmd.String("binary", "tree.bin", "database file")
+		region := calibrateCmd.String("region", "us-east-1", "AWS region")
+		pairsPath := calibrateCmd.String("pairs", "", `JSON lines of labelled pairs: {"a": "...", "b": "...", "label": "similar"}; label "dissimilar" marks pairs that should not match`)
+		dryRun := calibrateCmd.Bool("dry-run", false, "report the fitted radii without storing them")
+		output := calibrateCmd.String("o", "table", "output format: table or json")
+		embedOpts := addEmbedFlags(calibrateCmd, true)
+		calibrateCmd.Parse(os.Args[2:])
+
+		if *pairsPath == "" {
+			log.Fatal("-pairs is required")
+		}
+		if *output != "table" && *output != "json" {
+			log.Fatalf("unknown output format: %s (use table or json)", *output)
+		}
+
+		pairs, err := readRadiusPairs(*pairsPath)
+		if err != nil {
+			log.Fatalf("Failed to read pairs: %v", err)
+		}
+
+		c := openClient(*binary, *region)
+		c.Metrics = metrics.Noop{}
+		defer embedOpts.apply(c, *binary)()
+
+		before, err := c.RadiusTable()
+		if err != nil {
+			log.Fatalf("Failed to load database: %v", err)
+		}
+
+		fits, err := c.Calibrate(pairs)
+		if err != nil {
+			log.Fatalf("Calibration failed: %v", err)
+		}
+
+		if !*dryRun {
+			radii := make(map[string]float32, len(fits))
+			for word, fit := range fits {
+				radii[word] = fit.Epsilon
+			}
+			if err := c.SetRadii(radii); err != nil {
+				log.Fatalf("Failed to store radii: %v", err)
+			}
+			if err := c.Close(); err != nil {
+				log.Fatalf("Flush failed: %v", err)
+			}
+		}
+
+		if *output == "json" {
+			printJSON(fits)
+			break
+		}
+
+		words := make([]string, 0, len(fits))
+		for word := range fits {
+			words = append(words, word)
+		}
+		sort.Slice(words, func(i, j int) bool { return fits[words[i]].Epsilon < fits[words[j]].Epsilon })
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "RADIUS\tPAIRS\tBEFORE\tEPSILON\tRECALL\tFALSE POS")
+		for _, word := range words {
+			fit := fits[word]
+			previous := "-"
+			if value, ok := before[word]; ok {
+				previous = fmt.Sprintf("%.4f", value)
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%.4f\t%.3f\t%.3f\n", word, fit.Positives, previous, fit.Epsilon, fit.Recall, fit.FalsePositiveRate)
+		}
+		w.Flush()
+		if *dryRun {
+			fmt.Println("Dry run: radii not stored")
+		} else {
+			fmt.Printf("Stored %d radii in %s\n", len(fits), *binary)
+		}
+
+	case "import":
+		importCmd := flag.NewFlagSet("import", flag.ExitOnError)
+		binary := importCmd.String("binary", "tree.bin", "database file")
+		region := importCmd.String("region", "us-east-1", "AWS region")
+		from := importCmd.String("from", "", "export format: chroma or faiss")
+		path := importCmd.String("path", "", "chroma: .jsonl file or directory; faiss: float32 matrix or .fvecs file")
+		texts := importCmd.String("texts", "", "faiss: JSON lines of texts, one per vector")
+		dims := importCmd.Int("dims", 512, "faiss: dimensions of a raw float32 matrix")
+		batchSize := importCmd.Int("batch-size", importer.DefaultBatchSize, "records per insert batch")
+		normalize := importCmd.Bool("normalize", false, "L2-normalize vectors (fixed when the database is created)")
+		zeroVectors := importCmd.String("zero-vectors", "allow", "all-zero keys on insert: allow, warn or reject")
+		sanitize := importCmd.Bool("sanitize", false, "replace NaN and infinite vector values with 0 instead of skipping the row")
+		importCmd.Parse(os.Args[2:])
+
+		if *path == "" {
+			log.Fatal("-path is required")
+		}
+
+		var reader importer.Reader
+		switch *from {
+		case "chroma":
+			r, err := importer.NewChromaReader(*path)
+			if err != nil {
+				log.Fatalf("Failed to open export: %v", err)
+			}
+			defer r.Close()
+			reader = r
+		case "faiss":
+			if *texts == "" {
+				log.Fatal("-texts is required with -from faiss")
+			}
+			r, err := importer.NewFAISSReader(*path, *texts, *dims)
+			if err != nil {
+				log.Fatalf("Failed to open export: %v", err)
+			}
+			defer r.Close()
+			reader = r
+		default:
+			log.Fatalf("-from must be chroma or faiss, got %q", *from)
+		}
+
+		c := openClient(*binary, *region)
+		c.Normalize = *normalize
+		c.ZeroVectors = zeroVectorPolicy(*zeroVectors)
+		c.SanitizeVectors = *sanitize
+
+		result, err := importer.Import(c, reader, *batchSize)
+		if err != nil {
+			log.Fatalf("Import failed after %d of %d rows: %v", result.Inserted, result.Read, err)
+		}
+
+		fmt.Printf("Imported %d of %d rows into %s (%d skipped)\n", result.Inserted, result.Read, *binary, result.Skipped)
+		printSkipReasons(result)
+
+	case "export":
+		exportCmd := flag.NewFlagSet("export", flag.ExitOnError)
+		binary := exportCmd.String("binary", "tree.bin", "database file or sharded directory")
+		format := exportCmd.String("format", "parquet", "output format: parquet")
+		out := exportCmd.String("out", "", "output file")
+		rowGroupSize := exportCmd.Int("row-group-size", storage.DefaultParquetRowGroupSize, "rows per Parquet row group")
+		exportCmd.Parse(os.Args[2:])
+
+		if *out == "" {
+			log.Fatal("-out is required")
+		}
+		if *format != "parquet" {
+			log.Fatalf("unknown export format: %s (use parquet, or export-npy for numpy)", *format)
+		}
+		requireDatabase(*binary)
+
+		rows, err := storage.ExportParquetFrom(storage.Open(*binary), *out, *rowGroupSize)
+		if err != nil {
+			log.Fatalf("Export failed: %v", err)
+		}
+
+		fmt.Printf("Exported %d nodes to %s\n", rows, *out)
+
+	case "export-npy":
+		exportCmd := flag.NewFlagSet("export-npy", flag.ExitOnError)
+		binary := exportCmd.String("binary", "tree.bin", "database file or sharded directory")
+		vectors := exportCmd.String("vectors", "vectors.npy", "output .npy matrix, one row per node")
+		values := exportCmd.String("values", "values.jsonl", "output JSON lines of index, value, metadata and payload")
+		exportCmd.Parse(os.Args[2:])
+
+		tree, err := storage.Open(*binary).Load()
+		if err != nil {
+			log.Fatalf("Failed to load %s: %v", *binary, err)
+		}
+
+		if err := storage.ExportNpy(tree, *vectors, *values); err != nil {
+			log.Fatalf("Export failed: %v", err)
+		}
+
+		fmt.Printf("Exported %d nodes to %s and %s\n", len(tree.Nodes), *vectors, *values)
+
+	case "import-npy":
+		importCmd := flag.NewFlagSet("import-npy", flag.ExitOnError)
+		binary := importCmd.String("binary", "tree.bin", "database file")
+		region := importCmd.String("region", "us-east-1", "AWS region")
+		vectors := importCmd.String("vectors", "vectors.npy", "2-D float32 or float64 .npy matrix")
+		values := importCmd.String("values", "values.jsonl", "JSON lines of values, one per matrix row")
+		batchSize := importCmd.Int("batch-size", importer.DefaultBatchSize, "records per insert batch")
+		normalize := importCmd.Bool("normalize", false, "L2-normalize vectors (fixed when the database is created)")
+		zeroVectors := importCmd.String("zero-vectors", "allow", "all-zero keys on insert: allow, warn or reject")
+		sanitize := importCmd.Bool("sanitize", false, "replace NaN and infinite vector values with 0 instead of skipping the row")
+		importCmd.Parse(os.Args[2:])
+
+		reader, err := importer.NewNpyReader(*vectors, *values)
+		if err != nil {
+			log.Fatalf("Failed to open export: %v", err)
+		}
+		defer reader.Close()
+
+		c := openClient(*binary, *region)
+		c.Normalize = *normalize
+		c.ZeroVectors = zeroVectorPolicy(*zeroVectors)
+		c.SanitizeVectors = *sanitize
+
+		result, err := importer.Import(c, reader, *batchSize)
+		if err != nil {
+			log.Fatalf("Import failed after %d of %d rows: %v", result.Inserted, result.Read, err)
+		}
+
+		fmt.Printf("Imported %d of %d rows into %s (%d skipped)\n", result.Inserted, result.Read, *binary, result.Skipped)
+		printSkipReasons(result)
+
+	case "agent-curate":
+		curateCmd := flag.NewFlagSet("agent-curate", flag.ExitOnError)
 		binary := curateCmd.String("binary", "tree.bin", "database file")
 		region := curateCmd.String("region", "us-east-1", "AWS region")
 		text := curateCmd.String("text", "", "text to analyze and decompose into memories")
@@ -113,14 +1689,774 @@ func main() {
 			log.Fatal("-text is required")
 		}
 
-		client, err := client.New(*binary, *region)
+		c := openClient(*binary, *region)
+
+		if _, err := c.AgentCurate(*text, *importance, *modelID, *bedrockRegion, *timeout); err != nil {
+			log.Fatalf("Agent curation failed: %v", err)
+		}
+
+	case "serve":
+		serveCmd := flag.NewFlagSet("serve", flag.ExitOnError)
+		binary := serveCmd.String("binary", "tree.bin", "database file")
+		dataDir := serveCmd.String("data-dir", "", "serve every database in this directory instead of -binary, one <name>.bin each, created on first insert")
+		maxOpen := serveCmd.Int("max-open", server.DefaultMaxOpenDatabases, "with -data-dir, databases kept open before the least recently used is flushed and closed (0 = no limit)")
+		region := serveCmd.String("region", "us-east-1", "AWS region")
+		addr := serveCmd.String("addr", ":8080", "HTTP listen address")
+		asyncFlush := serveCmd.Bool("async-flush", false, "write periodic flushes in the background so inserts don't wait on disk")
+		resultCache := serveCmd.Int("result-cache", 0, "cache this many recent search results, cleared on every insert (0 = off)")
+		resultCacheTTL := serveCmd.Duration("result-cache-ttl", 0, "expire cached search results after this long (0 = never)")
+		maxCandidates := serveCmd.Int("max-candidates", types.DefaultMaxCandidates, "stop a search after scoring this many nodes and return what it found (0 = no limit)")
+		searchTimeout := serveCmd.Duration("search-timeout", types.DefaultSearchTimeout, "stop a search after this long and return what it found (0 = no limit)")
+		warmup := serveCmd.Bool("warmup", false, "load the database and build its index before accepting requests")
+		rateLimit := serveCmd.Float64("rate-limit", 0, "requests per second allowed per API key (X-API-Key, one of the comma-separated HIPPOCAMPUS_API_KEYS) or else client address (0 = no limit)")
+		rateBurst := serveCmd.Int("rate-burst", 0, "requests a caller may make at once before -rate-limit applies (default: the rate, rounded up)")
+		maxBody := serveCmd.Int64("max-body", ratelimit.DefaultMaxBodyBytes, "reject request bodies larger than this many bytes (0 = no limit)")
+		retention := serveCmd.String("retention", "", retentionUsage)
+		shadow := serveCmd.String("shadow", "", "mirror loads and saves of -binary to this second database in the background and log where they diverge (e.g. a compressed copy being migrated to)")
+		shadowSample := serveCmd.Int("shadow-sample", storage.DefaultVerifySample, "with -shadow, vectors compared per check")
+		shadowTolerance := serveCmd.Float64("shadow-tolerance", 0, "with -shadow, largest vector component difference counted as equal")
+		embedOpts := addEmbedFlags(serveCmd, true)
+		serveCmd.Parse(os.Args[2:])
+
+		serving := *binary
+		var srv *server.Server
+		var saveCache func()
+		var warm func(ctx context.Context) (string, error)
+		if *shadow != "" && *dataDir != "" {
+			log.Fatal("-shadow can't be combined with -data-dir")
+		}
+		if _, err := types.ParseRetention(*retention); err != nil {
+			log.Fatal(err)
+		}
+		if *dataDir == "" {
+			c := openClient(*binary, *region)
+			c.AsyncFlush = *asyncFlush
+			c.EnableResultCache(*resultCache, *resultCacheTTL)
+			saveCache = embedOpts.apply(c, *binary)
+			if err := applyRetention(c, *retention); err != nil {
+				log.Fatal(err)
+			}
+			var shadowed *storage.ShadowStorage
+			if *shadow != "" {
+				shadowed = storage.ShadowBackend(c.Storage, storage.Open(*shadow))
+				shadowed.Sample = *shadowSample
+				shadowed.Tolerance = float32(*shadowTolerance)
+				c.Storage = shadowed
+			}
+			srv = server.New(c)
+			if shadowed != nil {
+				shadowed.Observer = srv.Metrics()
+			}
+			warm = func(ctx context.Context) (string, error) {
+				stats, err := c.Warmup(ctx)
+				return fmt.Sprintf("%d nodes (load %s, index %s)", stats.Nodes, stats.Load.Round(time.Millisecond), stats.Index.Round(time.Millisecond)), err
+			}
+		} else {
+			// Every database shares one embedder, and one embedding cache
+			shared := &client.Client{Region: *region}
+			saveCache = embedOpts.apply(shared, filepath.Join(*dataDir, "embeddings"))
+			databases, err := server.NewDatabases(*dataDir, *maxOpen, func(path string) (*client.Client, error) {
+				c, err := client.New(path, *region)
+				if err != nil {
+					return nil, err
+				}
+				c.Embedder = shared.Embedder
+				c.StrictConfig = shared.StrictConfig
+				c.AsyncFlush = *asyncFlush
+				c.EnableResultCache(*resultCache, *resultCacheTTL)
+				if err := applyRetention(c, *retention); err != nil {
+					return nil, err
+				}
+				return c, nil
+			})
+			if err != nil {
+				log.Fatalf("Failed to open data directory: %v", err)
+			}
+			srv = server.NewMulti(databases)
+			serving = *dataDir
+			warm = func(ctx context.Context) (string, error) {
+				n, err := databases.Warmup(ctx)
+				return fmt.Sprintf("%d databases", n), err
+			}
+		}
+		srv.MaxCandidates = *maxCandidates
+		srv.SearchTimeout = *searchTimeout
+		srv.MaxBodyBytes = *maxBody
+		if *rateLimit > 0 {
+			burst := *rateBurst
+			if burst <= 0 {
+				burst = int(math.Ceil(*rateLimit))
+			}
+			srv.Limiter = ratelimit.NewTokenBucket(*rateLimit, burst)
+		}
+		// Keys come from the environment rather than a flag, which other
+		// users could read from the process list
+		for _, key := range strings.Split(os.Getenv("HIPPOCAMPUS_API_KEYS"), ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				if srv.APIKeys == nil {
+					srv.APIKeys = make(map[string]bool)
+				}
+				srv.APIKeys[key] = true
+			}
+		}
+		httpServer := &http.Server{Addr: *addr, Handler: srv}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		go func() {
+			<-ctx.Done()
+			httpServer.Shutdown(context.Background())
+		}()
+
+		if *warmup {
+			warmed, err := warm(ctx)
+			if err != nil {
+				log.Fatalf("Warmup failed: %v", err)
+			}
+			fmt.Printf("Warmed up %s\n", warmed)
+		}
+
+		fmt.Printf("Serving %s on %s (metrics at /metrics)\n", serving, *addr)
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server failed: %v", err)
+		}
+
+		saveCache()
+		if err := srv.Close(); err != nil {
+			log.Fatalf("Flush failed: %v", err)
+		}
+
+	case "bench":
+		benchCmd := flag.NewFlagSet("bench", flag.ExitOnError)
+		binary := benchCmd.String("binary", "tree.bin", "database file or sharded directory")
+		region := benchCmd.String("region", "us-east-1", "AWS region")
+		queriesPath := benchCmd.String("queries", "", "JSON lines of queries: a vector array, {\"vector\": [...]} or {\"text\": \"...\"} (default: sample stored keys)")
+		sample := benchCmd.Int("sample", 100, "maximum queries to evaluate (0 = all)")
+		k := benchCmd.Int("k", 10, "neighbours to compare (recall@k)")
+		epsilons := benchCmd.String("epsilons", "0.1,0.2,0.3", "comma-separated epsilons to measure")
+		thresholds := benchCmd.String("thresholds", "0", "comma-separated thresholds to measure")
+		minDimMatches := benchCmd.String("min-dim-matches", "0", "comma-separated dimension match counts to measure (0 = all dimensions)")
+		output := benchCmd.String("o", "table", "output format: table or json")
+		noPrefilter := benchCmd.Bool("no-prefilter", false, "score every candidate in the epsilon box, to compare against the norm pre-filter")
+		embedOpts := addEmbedFlags(benchCmd, false)
+		benchCmd.Parse(os.Args[2:])
+
+		epsilonList, err := parseFloats(*epsilons)
+		if err != nil {
+			log.Fatalf("invalid -epsilons: %v", err)
+		}
+		thresholdList, err := parseFloats(*thresholds)
+		if err != nil {
+			log.Fatalf("invalid -thresholds: %v", err)
+		}
+		matchList, err := parseInts(*minDimMatches)
 		if err != nil {
-			log.Fatalf("Failed to create client: %v", err)
+			log.Fatalf("invalid -min-dim-matches: %v", err)
 		}
 
-		_, err = client.AgentCurate(*text, *importance, *modelID, *bedrockRegion, *timeout)
+		tree, err := storage.Open(*binary).Load()
 		if err != nil {
-			log.Fatalf("Agent curation failed: %v", err)
+			log.Fatalf("Failed to load %s: %v", *binary, err)
+		}
+		if len(tree.Nodes) == 0 {
+			log.Fatalf("%s is empty", *binary)
+		}
+		tree.DisablePrefilter = *noPrefilter
+
+		var queries [][512]float32
+		if *queriesPath == "" {
+			for _, i := range types.SampleIndices(len(tree.Nodes), *sample) {
+				queries = append(queries, tree.Nodes[i].Key)
+			}
+		} else {
+			saveEmbedCache := func() {}
+			queries, err = readBenchQueries(*queriesPath, func() *client.Client {
+				c := openClient(*binary, *region)
+				saveEmbedCache = embedOpts.apply(c, *binary)
+				return c
+			})
+			saveEmbedCache()
+			if err != nil {
+				log.Fatalf("Failed to read queries: %v", err)
+			}
+			sampled := make([][512]float32, 0, len(queries))
+			for _, i := range types.SampleIndices(len(queries), *sample) {
+				sampled = append(sampled, queries[i])
+			}
+			queries = sampled
+		}
+
+		results, err := types.EvaluateRecall(tree, queries, *k, epsilonList, thresholdList, matchList)
+		if err != nil {
+			log.Fatalf("Benchmark failed: %v", err)
+		}
+
+		switch *output {
+		case "json":
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(results); err != nil {
+				log.Fatalf("Failed to encode results: %v", err)
+			}
+		case "table":
+			fmt.Printf("%s: %d nodes, %d queries, recall@%d against exact search\n", *binary, len(tree.Nodes), len(queries), *k)
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+			fmt.Fprintln(w, "epsilon\tthreshold\tmin dims\tmax distance\trecall\tresults\tscored\tskipped\tp50\tp95\t")
+			for _, r := range results {
+				dims := "all"
+				if r.MinDimMatches > 0 {
+					dims = strconv.Itoa(r.MinDimMatches)
+				}
+				fmt.Fprintf(w, "%g\t%g\t%s\t%.3f\t%.3f\t%.1f\t%.1f\t%.1f\t%s\t%s\t\n", r.Epsilon, r.Threshold, dims, r.MaxDistance, r.Recall, r.MeanResults, r.MeanScored, r.MeanSkipped, r.P50, r.P95)
+			}
+			w.Flush()
+		default:
+			log.Fatalf("unknown output format: %s (use table or json)", *output)
+		}
+
+	case "stats":
+		statsCmd := flag.NewFlagSet("stats", flag.ExitOnError)
+		binary := statsCmd.String("binary", "tree.bin", "database file or sharded directory")
+		sample := statsCmd.Int("sample", 10000, "maximum nodes to sample for dimension statistics (0 = all)")
+		output := statsCmd.String("o", "table", "output format: table or json")
+		statsCmd.Parse(os.Args[2:])
+
+		tree, err := storage.Open(*binary).Load()
+		if err != nil {
+			log.Fatalf("Failed to load %s: %v", *binary, err)
+		}
+
+		stats := tree.ComputeStats(*sample)
+
+		switch *output {
+		case "json":
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(stats); err != nil {
+				log.Fatalf("Failed to encode stats: %v", err)
+			}
+		case "table":
+			printStats(*binary, stats)
+		default:
+			log.Fatalf("unknown output format: %s (use table or json)", *output)
+		}
+
+	case "info":
+		infoCmd := flag.NewFlagSet("info", flag.ExitOnError)
+		binary := infoCmd.String("binary", "tree.bin", "database file")
+		verbose := infoCmd.Bool("v", false, "include the full file header, memory use, index state and vector norms")
+		output := infoCmd.String("o", "table", "output format: table or json")
+		infoCmd.Parse(os.Args[2:])
+
+		backend := storage.Open(*binary)
+		tree, err := backend.Load()
+		if err != nil {
+			log.Fatalf("Failed to load %s: %v", *binary, err)
+		}
+
+		stats := tree.Stats()
+
+		var compression *storage.CompressionStats
+		var file *storage.FileHeader
+		if fs, ok := backend.(*storage.FileStorage); ok && *verbose {
+			cs, err := fs.CompressionStats()
+			if err != nil {
+				log.Fatalf("Failed to read %s: %v", *binary, err)
+			}
+			compression = &cs
+			fh, err := fs.Header()
+			if err != nil {
+				log.Fatalf("Failed to read %s: %v", *binary, err)
+			}
+			file = &fh
+		}
+
+		switch *output {
+		case "json":
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(stats); err != nil {
+				log.Fatalf("Failed to encode info: %v", err)
+			}
+		case "table":
+			printInfo(*binary, stats, storage.NewExportHeader(tree), file, compression, *verbose)
+		default:
+			log.Fatalf("unknown output format: %s (use table or json)", *output)
+		}
+
+	case "compact":
+		compactCmd := flag.NewFlagSet("compact", flag.ExitOnError)
+		binary := compactCmd.String("binary", "tree.bin", "database file")
+		region := compactCmd.String("region", "us-east-1", "AWS region")
+		shardSize := compactCmd.Int("shard-size", 0, "rebalance a sharded database (directory) to this many nodes per shard")
+		compressThreshold := compactCmd.Int("compress-threshold", 0, "gzip node text of at least this many bytes (0 keeps the current setting, -1 stores raw)")
+		compactCmd.Parse(os.Args[2:])
+
+		c := openClient(*binary, *region)
+		if *shardSize > 0 {
+			if _, ok := c.Storage.(*storage.ShardedStorage); !ok {
+				log.Fatalf("-shard-size needs a sharded database directory, %s is a file", *binary)
+			}
+			c.Storage = storage.NewSharded(*binary, *shardSize)
+		}
+
+		if *compressThreshold != 0 {
+			switch s := c.Storage.(type) {
+			case *storage.FileStorage:
+				s.CompressThreshold = *compressThreshold
+			case *storage.ShardedStorage:
+				s.CompressThreshold = *compressThreshold
+			}
+		}
+
+		result, err := c.Compact()
+		if err != nil {
+			log.Fatalf("Compact failed: %v", err)
+		}
+
+		fmt.Printf("Compacted %s: %d nodes, %d -> %d bytes\n", *binary, result.Nodes, result.BeforeBytes, result.AfterBytes)
+
+	case "convert":
+		convertCmd := flag.NewFlagSet("convert", flag.ExitOnError)
+		in := convertCmd.String("in", "", "database file to read")
+		out := convertCmd.String("out", "", "file to write, which may be -in with -force")
+		to := convertCmd.String("to", "", "format to write: plain or compressed")
+		force := convertCmd.Bool("force", false, "allow -out to replace -in")
+		convertCmd.Parse(os.Args[2:])
+
+		if *in == "" || *out == "" || *to == "" {
+			log.Fatal("-in, -out and -to are required")
+		}
+		if inInfo, err := os.Stat(*in); err != nil {
+			log.Fatalf("Convert failed: %v", err)
+		} else if outInfo, err := os.Stat(*out); err == nil && os.SameFile(inInfo, outInfo) && !*force {
+			log.Fatalf("%s would replace %s in place; pass -force to do that", *out, *in)
+		}
+
+		result, err := storage.Convert(*in, *out, storage.Format(*to))
+		if err != nil {
+			log.Fatalf("Convert failed: %v", err)
+		}
+
+		// Conversion only changes how text is encoded, so keys come
+		// through exactly and there is no quantization error to report
+		fmt.Printf("Converted %s to %s (%s): %d nodes, %d -> %d bytes (ratio %.2f, lossless)\n",
+			*in, *out, *to, result.Nodes, result.BeforeBytes, result.AfterBytes, result.Ratio())
+
+	case "snapshot":
+		snapshotCmd := flag.NewFlagSet("snapshot", flag.ExitOnError)
+		binary := snapshotCmd.String("binary", "tree.bin", "database file or sharded directory")
+		region := snapshotCmd.String("region", "us-east-1", "AWS region")
+		name := snapshotCmd.String("name", "", "snapshot name")
+		snapshotCmd.Parse(os.Args[2:])
+
+		if *name == "" {
+			log.Fatal("-name is required")
+		}
+
+		c := openClient(*binary, *region)
+		snap, err := c.Snapshot(*name)
+		if err != nil {
+			log.Fatalf("Snapshot failed: %v", err)
+		}
+
+		fmt.Printf("Saved snapshot %s (%d bytes) to %s\n", snap.Version, snap.Bytes, snap.Path)
+
+	case "snapshots":
+		snapshotsCmd := flag.NewFlagSet("snapshots", flag.ExitOnError)
+		binary := snapshotsCmd.String("binary", "tree.bin", "database file or sharded directory")
+		region := snapshotsCmd.String("region", "us-east-1", "AWS region")
+		output := snapshotsCmd.String("o", "table", "output format: table or json")
+		snapshotsCmd.Parse(os.Args[2:])
+
+		c := openClient(*binary, *region)
+		snapshots, err := c.ListSnapshots()
+		if err != nil {
+			log.Fatalf("Failed to list snapshots: %v", err)
+		}
+
+		switch *output {
+		case "json":
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if snapshots == nil {
+				snapshots = []client.SnapshotInfo{}
+			}
+			if err := enc.Encode(snapshots); err != nil {
+				log.Fatalf("Failed to encode snapshots: %v", err)
+			}
+		case "table":
+			if len(snapshots) == 0 {
+				fmt.Printf("No snapshots of %s\n", *binary)
+				break
+			}
+			for _, snap := range snapshots {
+				fmt.Printf("%-24s %s %12d bytes  %s\n", snap.Name, snap.Created.Local().Format(time.RFC3339), snap.Bytes, snap.Version)
+			}
+		default:
+			log.Fatalf("unknown output format: %s (use table or json)", *output)
+		}
+
+	case "restore":
+		restoreCmd := flag.NewFlagSet("restore", flag.ExitOnError)
+		binary := restoreCmd.String("binary", "tree.bin", "database file or sharded directory")
+		region := restoreCmd.String("region", "us-east-1", "AWS region")
+		name := restoreCmd.String("name", "", "snapshot name (restores its latest version) or exact version")
+		force := restoreCmd.Bool("force", false, "restore even if unflushed changes would be lost")
+		restoreCmd.Parse(os.Args[2:])
+
+		if *name == "" {
+			log.Fatal("-name is required")
+		}
+
+		c := openClient(*binary, *region)
+		snap, err := c.Restore(*name, *force)
+		if errors.Is(err, client.ErrUnflushedChanges) {
+			log.Fatalf("Restore refused: %v (use -force to discard them)", err)
+		}
+		if err != nil {
+			log.Fatalf("Restore failed: %v", err)
+		}
+
+		fmt.Printf("Restored %s from snapshot %s\n", *binary, snap.Version)
+
+	case "diff":
+		diffCmd := flag.NewFlagSet("diff", flag.ExitOnError)
+		a := diffCmd.String("a", "", "first database file or sharded directory")
+		b := diffCmd.String("b", "", "second database file or sharded directory")
+		output := diffCmd.String("o", "table", "output format: table (summary) or json (every differing node)")
+		diffCmd.Parse(os.Args[2:])
+
+		if *a == "" || *b == "" {
+			log.Fatal("-a and -b are required")
+		}
+
+		report, err := storage.Diff(*a, *b)
+		if err != nil {
+			log.Fatalf("Diff failed: %v", err)
+		}
+
+		switch *output {
+		case "json":
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(report); err != nil {
+				log.Fatalf("Failed to encode diff: %v", err)
+			}
+		case "table":
+			printDiff(report)
+		default:
+			log.Fatalf("unknown output format: %s (use table or json)", *output)
+		}
+
+	case "verify":
+		verifyCmd := flag.NewFlagSet("verify", flag.ExitOnError)
+		a := verifyCmd.String("a", "", "database file or sharded directory to check against")
+		b := verifyCmd.String("b", "", "copy of -a in another storage format")
+		sample := verifyCmd.Int("sample", storage.DefaultVerifySample, "nodes whose vectors are compared (negative = all)")
+		tolerance := verifyCmd.Float64("tolerance", 0, "largest vector component difference counted as equal, for quantized copies")
+		output := verifyCmd.String("o", "table", "output format: table or json")
+		verifyCmd.Parse(os.Args[2:])
+
+		if *a == "" || *b == "" {
+			log.Fatal("-a and -b are required")
+		}
+		if *output != "table" && *output != "json" {
+			log.Fatalf("unknown output format: %s (use table or json)", *output)
+		}
+		if *sample == 0 {
+			log.Fatal("-sample must not be 0")
+		}
+		requireDatabase(*a)
+		requireDatabase(*b)
+
+		report, err := storage.Verify(storage.Open(*a), storage.Open(*b), storage.VerifyOptions{Sample: *sample, Tolerance: float32(*tolerance)})
+		if err != nil {
+			log.Fatalf("Verify failed: %v", err)
+		}
+
+		if *output == "json" {
+			printJSON(report)
+		} else {
+			printConsistency(report)
+		}
+		if !report.Consistent() {
+			os.Exit(1)
+		}
+
+	case "sample":
+		sampleCmd := flag.NewFlagSet("sample", flag.ExitOnError)
+		binary := sampleCmd.String("binary", "tree.bin", "database file or sharded directory")
+		n := sampleCmd.Int("n", 20, "nodes to sample")
+		dims := sampleCmd.Int("dims", 8, "leading vector dimensions to print")
+		sampleCmd.Parse(os.Args[2:])
+
+		requireDatabase(*binary)
+
+		// Reservoir-sample while streaming, so the tree is never loaded
+		sample, total, err := storage.Sample(storage.Open(*binary), *n)
+		if err != nil {
+			log.Fatalf("Scan failed: %v", err)
+		}
+
+		fmt.Printf("%d of %d nodes from %s\n", len(sample), total, *binary)
+		for _, node := range sample {
+			printSampledNode(node, min(*dims, 512))
+		}
+
+	case "get":
+		getCmd := flag.NewFlagSet("get", flag.ExitOnError)
+		binary := getCmd.String("binary", "tree.bin", "database file or sharded directory")
+		index := getCmd.Int("index", -1, "position of the node in the database")
+		id := getCmd.String("id", "", "find the node by its id metadata instead")
+		idKey := getCmd.String("id-key", importer.IDKey, "metadata key -id matches")
+		getCmd.Parse(os.Args[2:])
+
+		if (*index < 0) == (*id == "") {
+			log.Fatal("exactly one of -index or -id is required")
+		}
+		requireDatabase(*binary)
+
+		backend := storage.Open(*binary)
+		var node types.IndexedNode
+		if *id != "" {
+			found, ok, err := storage.FindNode(backend, *idKey, *id)
+			if err != nil {
+				log.Fatalf("Scan failed: %v", err)
+			}
+			if !ok {
+				log.Fatalf("No node with %s=%s", *idKey, *id)
+			}
+			node = found
+		} else {
+			found, err := storage.GetNode(backend, *index)
+			if err != nil {
+				log.Fatal(err)
+			}
+			node = types.IndexedNode{Index: *index, Node: found}
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(nodeJSON{
+			Index:    node.Index,
+			Value:    node.Node.Value,
+			Metadata: node.Node.Metadata,
+			Payload:  node.Node.Payload,
+			Norm:     node.Norm(),
+			Vector:   node.Node.Key[:],
+		}); err != nil {
+			log.Fatalf("Failed to encode node: %v", err)
+		}
+
+	case "grep":
+		grepCmd := flag.NewFlagSet("grep", flag.ExitOnError)
+		binary := grepCmd.String("binary", "tree.bin", "database file")
+		pattern := grepCmd.String("pattern", "", "substring (or regex with -regex) to match")
+		regex := grepCmd.Bool("regex", false, "treat -pattern as a regular expression")
+		caseSensitive := grepCmd.Bool("case-sensitive", false, "match case exactly")
+		limit := grepCmd.Int("limit", 20, "maximum number of matches (0 = all)")
+		grepCmd.Parse(os.Args[2:])
+
+		if *pattern == "" {
+			log.Fatal("-pattern is required")
+		}
+
+		match, err := types.NewValueMatcher(*pattern, *regex, *caseSensitive)
+		if err != nil {
+			log.Fatalf("Invalid pattern: %v", err)
+		}
+
+		// Stream from disk: grep never needs the search indices
+		found := 0
+		err = storage.Open(*binary).Scan(func(n *types.Node) bool {
+			if match(n.Value) {
+				fmt.Println(n.Value)
+				found++
+			}
+			return *limit <= 0 || found < *limit
+		})
+		if err != nil {
+			log.Fatalf("Scan failed: %v", err)
+		}
+
+	case "count":
+		countCmd := flag.NewFlagSet("count", flag.ExitOnError)
+		binary := countCmd.String("binary", "tree.bin", "database file")
+		filterFlag := countCmd.String("filter", "", "metadata filter: key=value[,key=value...]")
+		groupBy := countCmd.String("group-by", "", "metadata key to group counts by")
+		countCmd.Parse(os.Args[2:])
+
+		metadata, err := parseMetadata(*filterFlag)
+		if err != nil {
+			log.Fatalf("Invalid -filter: %v", err)
+		}
+
+		var filter *types.Filter
+		if metadata != nil {
+			filter = &types.Filter{Metadata: metadata}
+		}
+
+		// Stream from disk: counting never needs the search indices
+		db := storage.Open(*binary)
+		schema, err := db.Schema()
+		if err != nil {
+			log.Fatalf("Failed to read %s: %v", *binary, err)
+		}
+		total := 0
+		groups := make(map[string]int)
+		err = db.Scan(func(n *types.Node) bool {
+			if filter.MatchesSchema(n, schema) {
+				total++
+				if *groupBy != "" {
+					groups[types.GroupKey(n, *groupBy)]++
+				}
+			}
+			return true
+		})
+		if err != nil {
+			log.Fatalf("Scan failed: %v", err)
+		}
+
+		if *groupBy == "" {
+			fmt.Println(total)
+			break
+		}
+
+		names := make([]string, 0, len(groups))
+		for name := range groups {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "%s\tcount\n", *groupBy)
+		for _, name := range names {
+			fmt.Fprintf(w, "%s\t%d\n", name, groups[name])
+		}
+		fmt.Fprintf(w, "total\t%d\n", total)
+		w.Flush()
+
+	case "validate":
+		validateCmd := flag.NewFlagSet("validate", flag.ExitOnError)
+		binary := validateCmd.String("binary", "tree.bin", "database file or sharded directory")
+		limit := validateCmd.Int("limit", 20, "maximum bad keys to list (0 = all)")
+		output := validateCmd.String("o", "table", "output format: table or json")
+		validateCmd.Parse(os.Args[2:])
+
+		if *output != "table" && *output != "json" {
+			log.Fatalf("unknown output format: %s (use table or json)", *output)
+		}
+
+		// Stream from disk: checking keys never needs the search indices
+		var scanner types.InvalidScanner
+		err := storage.Open(*binary).Scan(func(n *types.Node) bool {
+			scanner.Add(n)
+			return true
+		})
+		if err != nil {
+			log.Fatalf("Scan failed: %v", err)
+		}
+
+		invalid := scanner.Invalid
+		listed := invalid
+		if *limit > 0 && len(listed) > *limit {
+			listed = listed[:*limit]
+		}
+
+		if *output == "json" {
+			printJSON(struct {
+				Nodes   int                 `json:"nodes"`
+				Invalid int                 `json:"invalid"`
+				Keys    []types.InvalidNode `json:"keys"`
+			}{scanner.Seen(), len(invalid), listed})
+		} else {
+			fmt.Printf("%s: %d nodes, %d keys with NaN or infinite values\n", *binary, scanner.Seen(), len(invalid))
+			if len(listed) > 0 {
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "index\tkey\tdim\tvalue\ttext")
+				for _, bad := range listed {
+					key := "primary"
+					if bad.AltKey >= 0 {
+						key = fmt.Sprintf("alt %d", bad.AltKey)
+					}
+					fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\n", bad.Index, key, bad.Dim, bad.Kind, shorten(bad.Text, 60))
+				}
+				w.Flush()
+			}
+		}
+		if len(invalid) > 0 {
+			os.Exit(1)
+		}
+
+	case "schema":
+		if len(os.Args) < 3 {
+			log.Fatal("usage: hippocampus schema set|show|clear -binary tree.bin")
+		}
+		action := os.Args[2]
+		schemaCmd := flag.NewFlagSet("schema "+action, flag.ExitOnError)
+		binary := schemaCmd.String("binary", "tree.bin", "database file or sharded directory")
+		region := schemaCmd.String("region", "us-east-1", "AWS region")
+		fieldsFlag := schemaCmd.String("fields", "", `set: name=type[,name=type...]; types are string, int, float, bool and time (RFC 3339), and a trailing "!" makes a field required`)
+		strict := schemaCmd.Bool("strict", false, "set: reject metadata fields the schema does not declare")
+		output := schemaCmd.String("o", "table", "show: output format, table or json")
+		schemaCmd.Parse(os.Args[3:])
+
+		switch action {
+		case "set", "clear":
+			var schema *types.Schema
+			if action == "set" {
+				fields, err := types.ParseSchemaFields(*fieldsFlag)
+				if err != nil {
+					log.Fatalf("Invalid -fields: %v", err)
+				}
+				schema = &types.Schema{Fields: fields, Strict: *strict}
+			}
+
+			c := openClient(*binary, *region)
+			if err := c.SetSchema(schema); err != nil {
+				log.Fatalf("Failed to set schema: %v", err)
+			}
+			if err := c.Close(); err != nil {
+				log.Fatalf("Failed to save %s: %v", *binary, err)
+			}
+			if schema == nil {
+				fmt.Printf("Removed the schema from %s\n", *binary)
+			} else {
+				fmt.Printf("Stored a schema with %d fields in %s\n", len(schema.Fields), *binary)
+			}
+
+		case "show":
+			if *output != "table" && *output != "json" {
+				log.Fatalf("unknown output format: %s (use table or json)", *output)
+			}
+			schema, err := storage.Open(*binary).Schema()
+			if err != nil {
+				log.Fatalf("Failed to read %s: %v", *binary, err)
+			}
+			if *output == "json" {
+				printJSON(schema)
+				break
+			}
+			if schema == nil {
+				fmt.Printf("%s has no schema\n", *binary)
+				break
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "field\ttype\trequired")
+			for _, name := range schema.FieldNames() {
+				field := schema.Fields[name]
+				fmt.Fprintf(w, "%s\t%s\t%t\n", name, field.Type, field.Required)
+			}
+			w.Flush()
+			if schema.Strict {
+				fmt.Println("Strict: other fields are rejected")
+			}
+
+		default:
+			log.Fatalf("unknown schema action: %s (use set, show or clear)", action)
 		}
 
 	default:
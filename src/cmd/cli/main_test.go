@@ -0,0 +1,187 @@
+package main
+
+import (
+	"Hippocampus/src/client"
+	"Hippocampus/src/storage"
+	"Hippocampus/src/types"
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMain runs the CLI instead of the tests when runCLI re-executes the
+// test binary, so each command sees its own os.Args and can exit
+func TestMain(m *testing.M) {
+	if os.Getenv("HIPPOCAMPUS_CLI_TEST") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runCLI runs the CLI with args and stdin, returning its stdout, its stderr
+// and whether it succeeded
+func runCLI(t *testing.T, stdin string, args ...string) (string, string, bool) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "HIPPOCAMPUS_CLI_TEST=1")
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	if _, exited := err.(*exec.ExitError); err != nil && !exited {
+		t.Fatal(err)
+	}
+	return stdout.String(), stderr.String(), err == nil
+}
+
+// mustRunCLI is runCLI for commands expected to succeed
+func mustRunCLI(t *testing.T, stdin string, args ...string) string {
+	t.Helper()
+	stdout, stderr, ok := runCLI(t, stdin, args...)
+	if !ok {
+		t.Fatalf("%v failed: %s", args, stderr)
+	}
+	return stdout
+}
+
+// searchJSON runs a wide search with -o json plus extra flags and returns
+// the texts found
+func searchJSON(t *testing.T, db, stdin string, extra ...string) []string {
+	t.Helper()
+	args := append([]string{"search", "-binary", db, "-embed", "mock://512", "-epsilon", "100", "-max-distance", "1000", "-top-k", "10", "-o", "json"}, extra...)
+	var results []client.SearchResult
+	if err := json.Unmarshal([]byte(mustRunCLI(t, stdin, args...)), &results); err != nil {
+		t.Fatalf("%v: stdout is not a JSON result list: %v", args, err)
+	}
+	found := make([]string, len(results))
+	for i, r := range results {
+		found[i] = r.Text
+	}
+	return found
+}
+
+// nodeMetadata loads db and maps each node's value to its metadata
+func nodeMetadata(t *testing.T, db string) map[string]map[string]string {
+	t.Helper()
+	tree, err := storage.New(db).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata := make(map[string]map[string]string, len(tree.Nodes))
+	for i := range tree.Nodes {
+		metadata[tree.Nodes[i].Value] = tree.Nodes[i].Metadata
+	}
+	return metadata
+}
+
+func TestInsertMetadataAndTimestamp(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "tree.bin")
+	insert := func(text string, flags ...string) {
+		t.Helper()
+		mustRunCLI(t, "", append([]string{"insert", "-binary", db, "-embed", "mock://512", "-key", text, "-text", text}, flags...)...)
+	}
+	insert("pasta for dinner", "-metadata", `{"category":"food","importance":3,"tags":["a","b"]}`, "-timestamp", "2024-01-15T10:00:00Z")
+	insert("pizza at lunch", "-metadata", `{"category":"food"}`, "-timestamp", "2024-03-01T12:00:00+02:00")
+	insert("gym session", "-metadata", `{"category":"health"}`)
+
+	stored := nodeMetadata(t, db)
+	pasta := stored["pasta for dinner"]
+	if pasta["category"] != "food" || pasta["importance"] != "3" || pasta["tags"] != `["a","b"]` {
+		t.Errorf("pasta stored with %v", pasta)
+	}
+	for text, want := range map[string]string{"pasta for dinner": "2024-01-15T10:00:00Z", "pizza at lunch": "2024-03-01T10:00:00Z"} {
+		got, err := time.Parse(time.RFC3339Nano, stored[text][types.TimestampKey])
+		if wantTime, _ := time.Parse(time.RFC3339, want); err != nil || !got.Equal(wantTime) {
+			t.Errorf("%s stored at %q, want %s", text, stored[text][types.TimestampKey], want)
+		}
+	}
+
+	if found := searchJSON(t, db, "", "-text", "dinner", "-filter", `{"category":"food"}`); len(found) != 2 {
+		t.Errorf("food filter found %v", found)
+	}
+	if found := searchJSON(t, db, "", "-text", "dinner", "-filter", `{"category":"food"}`, "-since", "2024-02-01T00:00:00Z"); len(found) != 1 || found[0] != "pizza at lunch" {
+		t.Errorf("food since February found %v", found)
+	}
+	if found := searchJSON(t, db, "", "-text", "dinner", "-until", "2024-02-01T00:00:00Z"); len(found) != 1 || found[0] != "pasta for dinner" {
+		t.Errorf("until February found %v", found)
+	}
+}
+
+// Malformed flags fail naming the flag, before the database is touched
+func TestInsertAndSearchFlagErrors(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "tree.bin")
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"insert", "-key", "k", "-text", "t", "-metadata", `{"category":`}, "Invalid -metadata"},
+		{[]string{"insert", "-key", "k", "-text", "t", "-metadata", `["food"]`}, "Invalid -metadata"},
+		{[]string{"insert", "-key", "k", "-text", "t", "-metadata", `{"timestamp":"yesterday"}`}, "Invalid -metadata"},
+		{[]string{"insert", "-key", "k", "-text", "t", "-timestamp", "2024-01-15"}, "Invalid -timestamp"},
+		{[]string{"search", "-text", "t", "-filter", `{"category"}`}, "invalid -filter"},
+		{[]string{"search", "-text", "t", "-since", "last week"}, "invalid -since"},
+		{[]string{"search", "-text", "t", "-until", "2024-13-01T00:00:00Z"}, "invalid -until"},
+	}
+	for _, tc := range cases {
+		args := append(tc.args, "-binary", db, "-embed", "mock://512")
+		_, stderr, ok := runCLI(t, "", args...)
+		if ok || !strings.Contains(stderr, tc.want) {
+			t.Errorf("%v: succeeded %v with %q, want an error naming %q", tc.args, ok, stderr, tc.want)
+		}
+	}
+	if _, err := os.Stat(db); !os.IsNotExist(err) {
+		t.Errorf("a rejected command created the database: %v", err)
+	}
+}
+
+func TestInsertLinesFromStdin(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "tree.bin")
+	lines := "red apples grow on trees\n\n   \ngreen pears ripen slowly\r\n  storm clouds over the ocean  \nwaves crash on rocks"
+
+	stdout, stderr, ok := runCLI(t, lines, "insert-lines", "-binary", db, "-embed", "mock://512", "-batch-size", "3", "-prefix-metadata", "source=notes,day=monday")
+	if !ok {
+		t.Fatalf("insert-lines failed: %s", stderr)
+	}
+	if stdout != "" {
+		t.Errorf("insert-lines wrote %q to stdout, want it left clean", stdout)
+	}
+	if !strings.Contains(stderr, "Inserted 3 lines\n") || !strings.Contains(stderr, "Inserted 4 lines into "+db) {
+		t.Errorf("progress on stderr: %q", stderr)
+	}
+
+	stored := nodeMetadata(t, db)
+	if len(stored) != 4 {
+		t.Fatalf("stored %d lines, want 4 without the blanks: %v", len(stored), stored)
+	}
+	for _, text := range []string{"red apples grow on trees", "green pears ripen slowly", "storm clouds over the ocean", "waves crash on rocks"} {
+		if m, ok := stored[text]; !ok || m["source"] != "notes" || m["day"] != "monday" {
+			t.Errorf("%q stored as %v (present %v)", text, m, ok)
+		}
+	}
+
+	if _, stderr, ok := runCLI(t, "x", "insert-lines", "-binary", db, "-embed", "mock://512", "-prefix-metadata", "source"); ok || !strings.Contains(stderr, "Invalid -prefix-metadata") {
+		t.Errorf("malformed -prefix-metadata: succeeded %v with %q", ok, stderr)
+	}
+}
+
+func TestSearchQueryFromStdin(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "tree.bin")
+	mustRunCLI(t, "red apples grow on trees\nstorm clouds over the ocean\n", "insert-lines", "-binary", db, "-embed", "mock://512")
+
+	// -text - and a lone - both read the query, trimmed, from stdin
+	for _, args := range [][]string{{"-text", "-"}, {"-"}} {
+		found := searchJSON(t, db, "  storm clouds over the ocean\n", args...)
+		if len(found) == 0 || found[0] != "storm clouds over the ocean" {
+			t.Errorf("search %v from stdin found %v", args, found)
+		}
+	}
+	if _, stderr, ok := runCLI(t, "\n", "search", "-binary", db, "-embed", "mock://512", "-text", "-"); ok || !strings.Contains(stderr, "-text or -like is required") {
+		t.Errorf("search with an empty stdin query: succeeded %v with %q", ok, stderr)
+	}
+}
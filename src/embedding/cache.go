@@ -0,0 +1,170 @@
+package embedding
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CachingProvider memoizes another provider's embeddings in an LRU keyed by
+// SHA-256 of (provider name, text). It is safe for concurrent use.
+type CachingProvider struct {
+	provider   EmbeddingProvider
+	maxEntries int
+	ttl        time.Duration
+
+	mu      sync.Mutex
+	entries map[[32]byte]*list.Element
+	order   *list.List // front = most recently used
+	hits    int
+	misses  int
+}
+
+type cacheEntry struct {
+	Key     [32]byte
+	Vector  []float32
+	Created time.Time
+}
+
+// NewCachingProvider wraps p. maxEntries <= 0 means unbounded and ttl <= 0
+// means entries never expire.
+func NewCachingProvider(p EmbeddingProvider, maxEntries int, ttl time.Duration) *CachingProvider {
+	return &CachingProvider{
+		provider:   p,
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		entries:    make(map[[32]byte]*list.Element),
+		order:      list.New(),
+	}
+}
+
+func (c *CachingProvider) cacheKey(text string) [32]byte {
+	return sha256.Sum256([]byte(c.provider.Name() + "\x00" + text))
+}
+
+func (c *CachingProvider) GetEmbedding(ctx context.Context, text string) ([]float32, error) {
+	key := c.cacheKey(text)
+
+	c.mu.Lock()
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		if c.ttl <= 0 || time.Since(entry.Created) < c.ttl {
+			c.order.MoveToFront(elem)
+			c.hits++
+			vec := append([]float32(nil), entry.Vector...)
+			c.mu.Unlock()
+			return vec, nil
+		}
+		c.remove(elem)
+	}
+	c.misses++
+	c.mu.Unlock()
+
+	// Call the provider without holding the lock; concurrent misses for the
+	// same text just embed it twice
+	vec, err := c.provider.GetEmbedding(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.add(&cacheEntry{Key: key, Vector: append([]float32(nil), vec...), Created: time.Now()})
+	c.mu.Unlock()
+
+	return vec, nil
+}
+
+func (c *CachingProvider) Dimensions() (int, error) {
+	return c.provider.Dimensions()
+}
+
+func (c *CachingProvider) Name() string {
+	return c.provider.Name()
+}
+
+// Stats returns the cache hit and miss counts since creation
+func (c *CachingProvider) Stats() (hits, misses int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
+
+// add inserts or replaces an entry and evicts the least recently used overflow; callers hold mu
+func (c *CachingProvider) add(entry *cacheEntry) {
+	if elem, ok := c.entries[entry.Key]; ok {
+		c.remove(elem)
+	}
+	c.entries[entry.Key] = c.order.PushFront(entry)
+
+	for c.maxEntries > 0 && c.order.Len() > c.maxEntries {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *CachingProvider) remove(elem *list.Element) {
+	delete(c.entries, elem.Value.(*cacheEntry).Key)
+	c.order.Remove(elem)
+}
+
+// Load restores entries written by Save. A missing file is not an error.
+func (c *CachingProvider) Load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	var entries []cacheEntry
+	if err := gob.NewDecoder(f).Decode(&entries); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Saved most recent first, so add in reverse to keep the LRU order
+	for i := len(entries) - 1; i >= 0; i-- {
+		if c.ttl > 0 && time.Since(entries[i].Created) >= c.ttl {
+			continue
+		}
+		c.add(&entries[i])
+	}
+
+	return nil
+}
+
+// Save writes the cache to path atomically
+func (c *CachingProvider) Save(path string) error {
+	c.mu.Lock()
+	entries := make([]cacheEntry, 0, c.order.Len())
+	for elem := c.order.Front(); elem != nil; elem = elem.Next() {
+		entries = append(entries, *elem.Value.(*cacheEntry))
+	}
+	c.mu.Unlock()
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	defer os.Remove(tmpPath)
+
+	if err := gob.NewEncoder(f).Encode(entries); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
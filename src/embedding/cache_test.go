@@ -0,0 +1,142 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// embedAll embeds texts through p, failing the test on any error
+func embedAll(t *testing.T, p EmbeddingProvider, texts ...string) [][]float32 {
+	t.Helper()
+	vecs := make([][]float32, len(texts))
+	for i, text := range texts {
+		vec, err := p.GetEmbedding(context.Background(), text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vecs[i] = vec
+	}
+	return vecs
+}
+
+func TestCachingProviderEmbedsRepeatedTextOnce(t *testing.T) {
+	mock := NewMockProvider(8)
+	cache := NewCachingProvider(mock, 0, 0)
+
+	first := embedAll(t, cache, "hello", "world", "hello", "hello", "world")
+	if calls := mock.Calls(); !slices.Equal(calls, []string{"hello", "world"}) {
+		t.Fatalf("provider embedded %v, want each text once", calls)
+	}
+	if !slices.Equal(first[0], first[2]) || !slices.Equal(first[1], first[4]) {
+		t.Error("cached vector differs from the first embedding")
+	}
+	if hits, misses := cache.Stats(); hits != 3 || misses != 2 {
+		t.Errorf("stats %d hits, %d misses; want 3 and 2", hits, misses)
+	}
+
+	// Callers get copies, so changing one leaves the cache alone
+	first[0][0] = 42
+	if again := embedAll(t, cache, "hello"); again[0][0] == 42 {
+		t.Error("a caller's change reached the cached vector")
+	}
+
+	// Once cached, concurrent callers never reach the provider
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.GetEmbedding(context.Background(), "world"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := len(mock.Calls()); n != 2 {
+		t.Errorf("provider called %d times, want 2", n)
+	}
+}
+
+func TestCachingProviderDoesNotCacheErrors(t *testing.T) {
+	mock := NewMockProvider(8)
+	cache := NewCachingProvider(mock, 0, 0)
+	failure := errors.New("model unavailable")
+	mock.FailNext(1, failure)
+
+	if _, err := cache.GetEmbedding(context.Background(), "hello"); !errors.Is(err, failure) {
+		t.Fatalf("first call: %v, want the provider's error", err)
+	}
+	embedAll(t, cache, "hello", "hello")
+	if n := len(mock.Calls()); n != 2 {
+		t.Errorf("provider called %d times, want the failure and one retry", n)
+	}
+}
+
+func TestCachingProviderEvictsLeastRecentlyUsed(t *testing.T) {
+	mock := NewMockProvider(8)
+	cache := NewCachingProvider(mock, 2, 0)
+
+	embedAll(t, cache, "a", "b", "a", "c") // b is least recently used when c arrives
+	embedAll(t, cache, "a", "c")
+	embedAll(t, cache, "b")
+	if calls := mock.Calls(); !slices.Equal(calls, []string{"a", "b", "c", "b"}) {
+		t.Errorf("provider embedded %v, want b again after its eviction", calls)
+	}
+}
+
+func TestCachingProviderExpiresEntries(t *testing.T) {
+	mock := NewMockProvider(8)
+	cache := NewCachingProvider(mock, 0, 20*time.Millisecond)
+
+	embedAll(t, cache, "hello", "hello")
+	time.Sleep(30 * time.Millisecond)
+	embedAll(t, cache, "hello")
+	if n := len(mock.Calls()); n != 2 {
+		t.Errorf("provider called %d times, want once before and once after the TTL", n)
+	}
+}
+
+func TestCachingProviderSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "embed.cache")
+	saved := NewCachingProvider(NewMockProvider(8), 0, 0)
+	want := embedAll(t, saved, "one", "two", "three")
+	if err := saved.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	mock := NewMockProvider(8)
+	loaded := NewCachingProvider(mock, 2, 0)
+	if err := loaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	// Saved most recent first, so the cap keeps "two" and "three"
+	got := embedAll(t, loaded, "three", "two", "one")
+	if calls := mock.Calls(); !slices.Equal(calls, []string{"one"}) {
+		t.Errorf("after loading, provider embedded %v, want only the evicted text", calls)
+	}
+	for i := range got {
+		if !slices.Equal(got[i], want[2-i]) {
+			t.Errorf("%d: loaded vector differs from the saved one", i)
+		}
+	}
+
+	// Entries are keyed by the provider, so another model's cache file misses
+	other := NewMockProvider(16)
+	cache := NewCachingProvider(other, 0, 0)
+	if err := cache.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	embedAll(t, cache, "one")
+	if n := len(other.Calls()); n != 1 {
+		t.Errorf("another provider used a cached vector, %d calls", n)
+	}
+
+	if err := NewCachingProvider(mock, 0, 0).Load(filepath.Join(t.TempDir(), "missing")); err != nil {
+		t.Errorf("loading a missing cache file: %v", err)
+	}
+}
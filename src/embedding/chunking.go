@@ -0,0 +1,122 @@
+package embedding
+
+import (
+	"fmt"
+	"unicode"
+)
+
+// ChunkOptions sizes chunks in approximate tokens. A word counts as one
+// token per four runes, rounded up, which is close enough for English text
+// and keeps long identifiers and URLs from producing oversized chunks.
+type ChunkOptions struct {
+	Size    int // target tokens per chunk
+	Overlap int // tokens repeated at the start of the next chunk
+}
+
+func DefaultChunkOptions() ChunkOptions {
+	return ChunkOptions{Size: 256, Overlap: 32}
+}
+
+func (o ChunkOptions) Validate() error {
+	if o.Size <= 0 {
+		return fmt.Errorf("chunk size must be positive, got %d", o.Size)
+	}
+	if o.Overlap < 0 || o.Overlap >= o.Size {
+		return fmt.Errorf("chunk overlap must be in [0, %d), got %d", o.Size, o.Overlap)
+	}
+	return nil
+}
+
+// Chunk is a slice of the source text. Start and End are rune offsets into
+// the original text, End exclusive.
+type Chunk struct {
+	Index int
+	Text  string
+	Start int
+	End   int
+}
+
+type word struct {
+	byteStart, byteEnd int
+	runeStart, runeEnd int
+	tokens             int
+}
+
+// ChunkText splits text into overlapping chunks on word boundaries. Text that
+// fits in one chunk comes back whole; blank text yields no chunks.
+func ChunkText(text string, opts ChunkOptions) ([]Chunk, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	words := splitWords(text)
+	if len(words) == 0 {
+		return nil, nil
+	}
+
+	var chunks []Chunk
+	start := 0
+	for {
+		// Take words until the next one would overflow, but always at least one
+		end := start
+		tokens := 0
+		for end < len(words) && (end == start || tokens+words[end].tokens <= opts.Size) {
+			tokens += words[end].tokens
+			end++
+		}
+
+		first, last := words[start], words[end-1]
+		chunks = append(chunks, Chunk{
+			Index: len(chunks),
+			Text:  text[first.byteStart:last.byteEnd],
+			Start: first.runeStart,
+			End:   last.runeEnd,
+		})
+
+		if end == len(words) {
+			return chunks, nil
+		}
+
+		// Back up over roughly Overlap tokens, always moving forward
+		next := end
+		for overlap := 0; next-1 > start && overlap+words[next-1].tokens <= opts.Overlap; next-- {
+			overlap += words[next-1].tokens
+		}
+		start = next
+	}
+}
+
+func splitWords(text string) []word {
+	var words []word
+	inWord := false
+	var cur word
+
+	runeIdx := 0
+	for byteIdx, r := range text {
+		if unicode.IsSpace(r) {
+			if inWord {
+				cur.byteEnd, cur.runeEnd = byteIdx, runeIdx
+				words = append(words, finishWord(cur))
+				inWord = false
+			}
+		} else if !inWord {
+			cur = word{byteStart: byteIdx, runeStart: runeIdx}
+			inWord = true
+		}
+		runeIdx++
+	}
+
+	if inWord {
+		cur.byteEnd, cur.runeEnd = len(text), runeIdx
+		words = append(words, finishWord(cur))
+	}
+	return words
+}
+
+func finishWord(w word) word {
+	w.tokens = (w.runeEnd - w.runeStart + 3) / 4
+	if w.tokens == 0 {
+		w.tokens = 1
+	}
+	return w
+}
@@ -0,0 +1,210 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// HashingProvider deterministically maps text to a unit vector from hashed
+// words and character trigrams, so texts sharing words or spellings land
+// near each other. It needs no network and is meant for tests and demos.
+type HashingProvider struct {
+	dims int
+	seed uint64
+}
+
+func NewHashingProvider(dims int, seed uint64) *HashingProvider {
+	return &HashingProvider{dims: dims, seed: seed}
+}
+
+func (h *HashingProvider) GetEmbedding(ctx context.Context, text string) ([]float32, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	vec := make([]float32, h.dims)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for _, w := range words {
+		h.add(vec, "w:"+w, 1)
+
+		padded := []rune("^" + w + "$")
+		for i := 0; i+3 <= len(padded); i++ {
+			h.add(vec, "t:"+string(padded[i:i+3]), 0.5)
+		}
+	}
+
+	var sumSquares float64
+	for _, v := range vec {
+		sumSquares += float64(v) * float64(v)
+	}
+	if sumSquares > 0 {
+		norm := float32(math.Sqrt(sumSquares))
+		for i := range vec {
+			vec[i] /= norm
+		}
+	}
+	return vec, nil
+}
+
+// add hashes feature into one signed bucket
+func (h *HashingProvider) add(vec []float32, feature string, weight float32) {
+	hasher := fnv.New64a()
+	var seed [8]byte
+	for i := range seed {
+		seed[i] = byte(h.seed >> (8 * i))
+	}
+	hasher.Write(seed[:])
+	hasher.Write([]byte(feature))
+	sum := hasher.Sum64()
+
+	if sum>>63 == 1 {
+		weight = -weight
+	}
+	vec[sum%uint64(len(vec))] += weight
+}
+
+func (h *HashingProvider) GetEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	vecs := make([][]float32, len(texts))
+	for i, text := range texts {
+		vec, err := h.GetEmbedding(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		vecs[i] = vec
+	}
+	return vecs, nil
+}
+
+func (h *HashingProvider) Dimensions() (int, error) {
+	return h.dims, nil
+}
+
+func (h *HashingProvider) Name() string {
+	return fmt.Sprintf("hashing %d", h.dims)
+}
+
+var ErrNoMockResponse = errors.New("no scripted response")
+
+// MockProvider returns scripted vectors, records every call and can be told
+// to fail or to take a while. Unscripted texts go to Fallback, a
+// HashingProvider by default. It is safe for concurrent use.
+type MockProvider struct {
+	dims int
+
+	mu        sync.Mutex
+	responses map[string][]float32
+	fallback  EmbeddingProvider
+	err       error
+	failures  int // calls left to fail with err; -1 means every call
+	latency   time.Duration
+	calls     []string
+}
+
+func NewMockProvider(dims int) *MockProvider {
+	return &MockProvider{
+		dims:      dims,
+		responses: make(map[string][]float32),
+		fallback:  NewHashingProvider(dims, 0),
+	}
+}
+
+// SetResponse scripts the vector returned for text
+func (m *MockProvider) SetResponse(text string, vec []float32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.responses[text] = append([]float32(nil), vec...)
+}
+
+// SetFallback handles unscripted texts; nil makes them fail with ErrNoMockResponse
+func (m *MockProvider) SetFallback(p EmbeddingProvider) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fallback = p
+}
+
+// FailNext makes the next n calls return err; n < 0 fails every call until
+// FailNext(0, nil)
+func (m *MockProvider) FailNext(n int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failures = n
+	m.err = err
+}
+
+// SetLatency delays every call, honouring context cancellation
+func (m *MockProvider) SetLatency(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.latency = d
+}
+
+// Calls returns the texts embedded so far, in order
+func (m *MockProvider) Calls() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.calls...)
+}
+
+func (m *MockProvider) GetEmbedding(ctx context.Context, text string) ([]float32, error) {
+	m.mu.Lock()
+	m.calls = append(m.calls, text)
+	latency := m.latency
+	var err error
+	if m.failures != 0 {
+		err = m.err
+		if m.failures > 0 {
+			m.failures--
+		}
+	}
+	vec, scripted := m.responses[text]
+	fallback := m.fallback
+	m.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	if scripted {
+		return append([]float32(nil), vec...), nil
+	}
+	if fallback == nil {
+		return nil, fmt.Errorf("%w for %q", ErrNoMockResponse, text)
+	}
+	return fallback.GetEmbedding(ctx, text)
+}
+
+func (m *MockProvider) GetEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	vecs := make([][]float32, len(texts))
+	for i, text := range texts {
+		vec, err := m.GetEmbedding(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		vecs[i] = vec
+	}
+	return vecs, nil
+}
+
+func (m *MockProvider) Dimensions() (int, error) {
+	return m.dims, nil
+}
+
+func (m *MockProvider) Name() string {
+	return fmt.Sprintf("mock %d", m.dims)
+}
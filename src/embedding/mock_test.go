@@ -0,0 +1,146 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+var (
+	_ BatchEmbeddingProvider = (*HashingProvider)(nil)
+	_ BatchEmbeddingProvider = (*MockProvider)(nil)
+)
+
+// dot is the dot product of two equal-length vectors
+func dot(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+func TestHashingProviderIsDeterministic(t *testing.T) {
+	h := NewHashingProvider(256, 0)
+	vecs, err := h.GetEmbeddings(context.Background(), []string{"The quick brown fox", "the quick brown fox!", "", "The quick brown fox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vecs[0]) != 256 {
+		t.Fatalf("embedding has %d dimensions, want 256", len(vecs[0]))
+	}
+	if !slices.Equal(vecs[0], vecs[3]) || !slices.Equal(vecs[0], vecs[1]) {
+		t.Error("the same words embedded differently")
+	}
+	if norm := math.Sqrt(dot(vecs[0], vecs[0])); math.Abs(norm-1) > 1e-5 {
+		t.Errorf("embedding norm %v, want 1", norm)
+	}
+	if dot(vecs[2], vecs[2]) != 0 {
+		t.Error("text without words embedded to a nonzero vector")
+	}
+
+	again, _ := NewHashingProvider(256, 0).GetEmbedding(context.Background(), "The quick brown fox")
+	reseeded, _ := NewHashingProvider(256, 9).GetEmbedding(context.Background(), "The quick brown fox")
+	if !slices.Equal(again, vecs[0]) {
+		t.Error("a new provider with the same seed embedded differently")
+	}
+	if slices.Equal(reseeded, vecs[0]) {
+		t.Error("another seed embedded identically")
+	}
+}
+
+// Texts sharing words or spellings are nearer than unrelated ones
+func TestHashingProviderNeighbours(t *testing.T) {
+	h := NewHashingProvider(512, 0)
+	vecs, err := h.GetEmbeddings(context.Background(), []string{
+		"red apples grow on trees",
+		"apples grow in the orchard",
+		"storm clouds over the ocean",
+		"apple",
+		"apples",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if near, far := dot(vecs[0], vecs[1]), dot(vecs[0], vecs[2]); near <= far {
+		t.Errorf("shared words scored %.3f, unrelated text %.3f", near, far)
+	}
+	if spelling, far := dot(vecs[3], vecs[4]), dot(vecs[3], vecs[2]); spelling <= far {
+		t.Errorf("apple and apples scored %.3f, unrelated text %.3f", spelling, far)
+	}
+}
+
+func TestMockProviderScriptsAndRecords(t *testing.T) {
+	ctx := context.Background()
+	m := NewMockProvider(3)
+	m.SetResponse("scripted", []float32{1, 2, 3})
+
+	vec, err := m.GetEmbedding(ctx, "scripted")
+	if err != nil || !slices.Equal(vec, []float32{1, 2, 3}) {
+		t.Fatalf("scripted response %v, %v", vec, err)
+	}
+	vec[0] = 42
+	if again, _ := m.GetEmbedding(ctx, "scripted"); again[0] != 1 {
+		t.Error("a caller's change reached the scripted response")
+	}
+
+	// Unscripted texts hash, then fail once the fallback is removed
+	want, _ := NewHashingProvider(3, 0).GetEmbedding(ctx, "other")
+	if got, err := m.GetEmbedding(ctx, "other"); err != nil || !slices.Equal(got, want) {
+		t.Errorf("fallback returned %v, %v; want the hashing embedding", got, err)
+	}
+	m.SetFallback(nil)
+	if _, err := m.GetEmbedding(ctx, "other"); !errors.Is(err, ErrNoMockResponse) {
+		t.Errorf("unscripted text without a fallback: %v", err)
+	}
+
+	if calls := m.Calls(); !slices.Equal(calls, []string{"scripted", "scripted", "other", "other"}) {
+		t.Errorf("recorded calls %v", calls)
+	}
+	if dims, _ := m.Dimensions(); dims != 3 || m.Name() != "mock 3" {
+		t.Errorf("mock reports %d dimensions as %q", dims, m.Name())
+	}
+}
+
+func TestMockProviderFailures(t *testing.T) {
+	ctx := context.Background()
+	m := NewMockProvider(3)
+	failure := errors.New("throttled")
+
+	m.FailNext(2, failure)
+	for i := 0; i < 2; i++ {
+		if _, err := m.GetEmbedding(ctx, "text"); !errors.Is(err, failure) {
+			t.Fatalf("call %d: %v, want the injected error", i, err)
+		}
+	}
+	if _, err := m.GetEmbedding(ctx, "text"); err != nil {
+		t.Fatalf("call after the failures: %v", err)
+	}
+
+	m.FailNext(-1, failure)
+	if _, err := m.GetEmbeddings(ctx, []string{"a", "b"}); !errors.Is(err, failure) {
+		t.Errorf("batch while failing every call: %v", err)
+	}
+	m.FailNext(0, nil)
+	if _, err := m.GetEmbeddings(ctx, []string{"a", "b"}); err != nil {
+		t.Errorf("batch after clearing failures: %v", err)
+	}
+}
+
+func TestMockProviderLatencyHonoursContext(t *testing.T) {
+	m := NewMockProvider(3)
+	m.SetLatency(time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := m.GetEmbedding(ctx, "slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("slow call: %v, want the context's deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("cancelled call took %v", elapsed)
+	}
+}
@@ -0,0 +1,195 @@
+package embedding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const DefaultOllamaURL = "http://localhost:11434"
+
+// BatchEmbeddingProvider embeds several texts in one request
+type BatchEmbeddingProvider interface {
+	EmbeddingProvider
+	GetEmbeddings(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// HTTPError is a non-2xx response from an embedding server
+type HTTPError struct {
+	Status int
+	Body   string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("http %d: %s", e.Status, e.Body)
+}
+
+// HTTPStatusCode lets RetryingProvider classify the failure
+func (e *HTTPError) HTTPStatusCode() int {
+	return e.Status
+}
+
+// OllamaClient talks to a local Ollama server. It uses the batch /api/embed
+// endpoint and falls back to the legacy single-prompt /api/embeddings when
+// the server is too old to have it (404).
+type OllamaClient struct {
+	baseURL string
+	model   string
+	HTTP    *http.Client
+
+	mu         sync.Mutex
+	legacyOnly bool
+	dimensions int
+}
+
+func NewOllamaClient(baseURL, model string) *OllamaClient {
+	if baseURL == "" {
+		baseURL = DefaultOllamaURL
+	}
+	return &OllamaClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		model:   model,
+		HTTP:    http.DefaultClient,
+	}
+}
+
+type ollamaEmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type ollamaEmbedResponse struct {
+	Embeddings [][]float64 `json:"embeddings"`
+}
+
+type ollamaLegacyRequest struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+}
+
+type ollamaLegacyResponse struct {
+	Embedding []float64 `json:"embedding"`
+}
+
+func (o *OllamaClient) GetEmbedding(ctx context.Context, text string) ([]float32, error) {
+	vecs, err := o.GetEmbeddings(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return vecs[0], nil
+}
+
+func (o *OllamaClient) GetEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	o.mu.Lock()
+	legacy := o.legacyOnly
+	o.mu.Unlock()
+
+	if !legacy {
+		var resp ollamaEmbedResponse
+		err := o.post(ctx, "/api/embed", ollamaEmbedRequest{Model: o.model, Input: texts}, &resp)
+		if err == nil {
+			if len(resp.Embeddings) != len(texts) {
+				return nil, fmt.Errorf("ollama returned %d embeddings for %d inputs", len(resp.Embeddings), len(texts))
+			}
+			vecs := make([][]float32, len(resp.Embeddings))
+			for i, e := range resp.Embeddings {
+				vecs[i] = toFloat32(e)
+			}
+			return vecs, nil
+		}
+
+		if StatusCode(err) != http.StatusNotFound {
+			return nil, err
+		}
+
+		o.mu.Lock()
+		o.legacyOnly = true
+		o.mu.Unlock()
+	}
+
+	// The legacy endpoint takes one prompt per request
+	vecs := make([][]float32, len(texts))
+	for i, text := range texts {
+		var resp ollamaLegacyResponse
+		if err := o.post(ctx, "/api/embeddings", ollamaLegacyRequest{Model: o.model, Prompt: text}, &resp); err != nil {
+			return nil, err
+		}
+		vecs[i] = toFloat32(resp.Embedding)
+	}
+	return vecs, nil
+}
+
+// Dimensions probes the model with a short text once and caches the answer
+func (o *OllamaClient) Dimensions() (int, error) {
+	o.mu.Lock()
+	dims := o.dimensions
+	o.mu.Unlock()
+	if dims > 0 {
+		return dims, nil
+	}
+
+	vec, err := o.GetEmbedding(context.Background(), "dimension probe")
+	if err != nil {
+		return 0, err
+	}
+
+	o.mu.Lock()
+	o.dimensions = len(vec)
+	o.mu.Unlock()
+	return len(vec), nil
+}
+
+func (o *OllamaClient) Name() string {
+	return "ollama " + o.model
+}
+
+func (o *OllamaClient) post(ctx context.Context, path string, body, out interface{}) error {
+	return postJSON(ctx, o.HTTP, o.baseURL+path, nil, body, out)
+}
+
+// postJSON sends body as JSON and decodes a 2xx response into out; other
+// statuses become an HTTPError
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, body, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("marshal error: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &HTTPError{Status: resp.StatusCode, Body: strings.TrimSpace(string(msg))}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("unmarshal error: %w", err)
+	}
+	return nil
+}
+
+func toFloat32(v []float64) []float32 {
+	out := make([]float32, len(v))
+	for i, f := range v {
+		out[i] = float32(f)
+	}
+	return out
+}
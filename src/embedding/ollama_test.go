@@ -0,0 +1,155 @@
+package embedding
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// fakeOllama emulates an Ollama server. A current one serves the batch
+// /api/embed; an old one only the single-prompt /api/embeddings and 404s
+// everything else. Embeddings are the input's length and its first byte.
+type fakeOllama struct {
+	legacy bool
+
+	mu    sync.Mutex
+	paths []string
+}
+
+func (f *fakeOllama) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.paths = append(f.paths, r.URL.Path)
+	f.mu.Unlock()
+
+	embed := func(text string) []float64 {
+		return []float64{float64(len(text)), float64(text[0])}
+	}
+
+	switch {
+	case r.Method != http.MethodPost:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	case r.URL.Path == "/api/embed" && !f.legacy:
+		var req ollamaEmbedRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Model == "" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		var resp ollamaEmbedResponse
+		for _, text := range req.Input {
+			resp.Embeddings = append(resp.Embeddings, embed(text))
+		}
+		json.NewEncoder(w).Encode(resp)
+	case r.URL.Path == "/api/embeddings":
+		var req ollamaLegacyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Model == "" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(ollamaLegacyResponse{Embedding: embed(req.Prompt)})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeOllama) requests() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.paths)
+}
+
+func checkOllamaEmbeddings(t *testing.T, vecs [][]float32, texts []string) {
+	t.Helper()
+	if len(vecs) != len(texts) {
+		t.Fatalf("%d embeddings for %d texts", len(vecs), len(texts))
+	}
+	for i, text := range texts {
+		want := []float32{float32(len(text)), float32(text[0])}
+		if !slices.Equal(vecs[i], want) {
+			t.Errorf("embedding %d = %v, want %v", i, vecs[i], want)
+		}
+	}
+}
+
+func TestOllamaBatchEndpoint(t *testing.T) {
+	fake := &fakeOllama{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	o := NewOllamaClient(server.URL+"/", "nomic-embed-text")
+	texts := []string{"alpha", "be", "gamma ray"}
+	vecs, err := o.GetEmbeddings(context.Background(), texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkOllamaEmbeddings(t, vecs, texts)
+
+	if got := fake.requests(); !slices.Equal(got, []string{"/api/embed"}) {
+		t.Fatalf("requests %v, want one batch request", got)
+	}
+	if dims, err := o.Dimensions(); err != nil || dims != 2 {
+		t.Fatalf("Dimensions() = %d, %v; want 2", dims, err)
+	}
+}
+
+func TestOllamaLegacyFallback(t *testing.T) {
+	fake := &fakeOllama{legacy: true}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	o := NewOllamaClient(server.URL, "nomic-embed-text")
+	texts := []string{"alpha", "be"}
+	vecs, err := o.GetEmbeddings(context.Background(), texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkOllamaEmbeddings(t, vecs, texts)
+
+	// The 404 switches to one legacy request per text
+	want := []string{"/api/embed", "/api/embeddings", "/api/embeddings"}
+	if got := fake.requests(); !slices.Equal(got, want) {
+		t.Fatalf("requests %v, want %v", got, want)
+	}
+
+	// and the client remembers, skipping the batch endpoint from then on
+	vec, err := o.GetEmbedding(context.Background(), "gamma")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkOllamaEmbeddings(t, [][]float32{vec}, []string{"gamma"})
+	if got := fake.requests(); !slices.Equal(got, append(want, "/api/embeddings")) {
+		t.Fatalf("requests %v, want only a legacy request after the fallback", got)
+	}
+}
+
+func TestOllamaOtherErrorsDoNotFallBack(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		http.Error(w, "model not loaded", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	_, err := NewOllamaClient(server.URL, "missing").GetEmbedding(context.Background(), "alpha")
+	if StatusCode(err) != http.StatusInternalServerError {
+		t.Fatalf("error %v, want the server's 500", err)
+	}
+	if !slices.Equal(paths, []string{"/api/embed"}) {
+		t.Fatalf("requests %v, want no legacy fallback after a 500", paths)
+	}
+}
+
+func TestOllamaBatchCountMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ollamaEmbedResponse{Embeddings: [][]float64{{1, 2}}})
+	}))
+	defer server.Close()
+
+	_, err := NewOllamaClient(server.URL, "m").GetEmbeddings(context.Background(), []string{"a", "b"})
+	if err == nil {
+		t.Fatal("one embedding for two inputs was accepted")
+	}
+}
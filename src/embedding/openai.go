@@ -0,0 +1,115 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const DefaultOpenAIURL = "https://api.openai.com"
+
+// OpenAIClient calls an OpenAI-compatible /v1/embeddings endpoint. That
+// covers OpenAI itself and llama.cpp's server.
+type OpenAIClient struct {
+	baseURL    string
+	model      string
+	apiKey     string
+	dimensions int // 0 lets the model choose
+	HTTP       *http.Client
+
+	mu       sync.Mutex
+	observed int
+}
+
+func NewOpenAIClient(baseURL, model, apiKey string, dimensions int) *OpenAIClient {
+	if baseURL == "" {
+		baseURL = DefaultOpenAIURL
+	}
+	return &OpenAIClient{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		model:      model,
+		apiKey:     apiKey,
+		dimensions: dimensions,
+		HTTP:       http.DefaultClient,
+	}
+}
+
+type openAIRequest struct {
+	Model      string   `json:"model,omitempty"`
+	Input      []string `json:"input"`
+	Dimensions int      `json:"dimensions,omitempty"`
+}
+
+type openAIResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+func (o *OpenAIClient) GetEmbedding(ctx context.Context, text string) ([]float32, error) {
+	vecs, err := o.GetEmbeddings(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return vecs[0], nil
+}
+
+func (o *OpenAIClient) GetEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	var headers map[string]string
+	if o.apiKey != "" {
+		headers = map[string]string{"Authorization": "Bearer " + o.apiKey}
+	}
+
+	var resp openAIResponse
+	req := openAIRequest{Model: o.model, Input: texts, Dimensions: o.dimensions}
+	if err := postJSON(ctx, o.HTTP, o.baseURL+"/v1/embeddings", headers, req, &resp); err != nil {
+		return nil, err
+	}
+
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("%s returned %d embeddings for %d inputs", o.Name(), len(resp.Data), len(texts))
+	}
+
+	vecs := make([][]float32, len(texts))
+	for _, d := range resp.Data {
+		if d.Index < 0 || d.Index >= len(vecs) {
+			return nil, fmt.Errorf("%s returned out-of-range index %d", o.Name(), d.Index)
+		}
+		vecs[d.Index] = d.Embedding
+	}
+	return vecs, nil
+}
+
+// Dimensions is the requested size when set, otherwise a cached probe
+func (o *OpenAIClient) Dimensions() (int, error) {
+	if o.dimensions > 0 {
+		return o.dimensions, nil
+	}
+
+	o.mu.Lock()
+	observed := o.observed
+	o.mu.Unlock()
+	if observed > 0 {
+		return observed, nil
+	}
+
+	vec, err := o.GetEmbedding(context.Background(), "dimension probe")
+	if err != nil {
+		return 0, err
+	}
+
+	o.mu.Lock()
+	o.observed = len(vec)
+	o.mu.Unlock()
+	return len(vec), nil
+}
+
+func (o *OpenAIClient) Name() string {
+	if o.model == "" {
+		return "openai-compatible " + o.baseURL
+	}
+	return "openai " + o.model
+}
@@ -0,0 +1,37 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+)
+
+// EmbeddingProvider turns text into vectors
+type EmbeddingProvider interface {
+	GetEmbedding(ctx context.Context, text string) ([]float32, error)
+
+	// Dimensions reports the length of the vectors GetEmbedding returns
+	Dimensions() (int, error)
+
+	// Name identifies the provider and model in error messages, e.g. "titan amazon.titan-embed-text-v2:0"
+	Name() string
+}
+
+// DimensionError is returned when a provider's vectors do not fit the database
+type DimensionError struct {
+	Provider string
+	Expected int
+	Got      int
+}
+
+func (e *DimensionError) Error() string {
+	return fmt.Sprintf("%s returns %d-dimensional embeddings but the database stores %d; use a model configured for %d dimensions or a separate database",
+		e.Provider, e.Got, e.Expected, e.Expected)
+}
+
+// CheckDimensions verifies that vec has the length the database expects
+func CheckDimensions(p EmbeddingProvider, vec []float32, expected int) error {
+	if len(vec) != expected {
+		return &DimensionError{Provider: p.Name(), Expected: expected, Got: len(vec)}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package embedding
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Factory builds a provider from a parsed spec such as ollama://localhost:11434/nomic-embed-text
+type Factory func(spec *url.URL) (EmbeddingProvider, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a provider available to NewProvider under scheme. It panics
+// if the scheme is already taken, like database/sql.Register.
+func Register(scheme string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, dup := registry[scheme]; dup {
+		panic("embedding: Register called twice for scheme " + scheme)
+	}
+	registry[scheme] = factory
+}
+
+// Schemes lists the registered provider schemes
+func Schemes() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	schemes := make([]string, 0, len(registry))
+	for scheme := range registry {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// NewProvider builds a provider from a URI-style spec:
+//
+//	titan://us-east-1/amazon.titan-embed-text-v2:0?dims=512
+//	ollama://localhost:11434/nomic-embed-text
+//	openai://text-embedding-3-small?dims=512   (key from OPENAI_API_KEY)
+//	llamacpp://localhost:8080
+//	mock://512                                 (offline HashingProvider)
+func NewProvider(spec string) (EmbeddingProvider, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("embedding spec %q: %w", spec, err)
+	}
+	if u.Scheme == "" {
+		return nil, fmt.Errorf("embedding spec %q: missing scheme (want one of %s)", spec, strings.Join(Schemes(), ", "))
+	}
+
+	registryMu.RLock()
+	factory, ok := registry[u.Scheme]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("embedding spec %q: unknown scheme %q (want one of %s)", spec, u.Scheme, strings.Join(Schemes(), ", "))
+	}
+
+	p, err := factory(u)
+	if err != nil {
+		return nil, fmt.Errorf("embedding spec %q: %w", spec, err)
+	}
+	return p, nil
+}
+
+func init() {
+	Register("titan", newTitanFromSpec)
+	Register("ollama", newOllamaFromSpec)
+	Register("openai", newOpenAIFromSpec)
+	Register("llamacpp", newLlamaCppFromSpec)
+	Register("mock", newMockFromSpec)
+}
+
+func newTitanFromSpec(u *url.URL) (EmbeddingProvider, error) {
+	region := u.Host
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	dims, err := intParam(u, "dims")
+	if err != nil {
+		return nil, err
+	}
+
+	normalize := true
+	if raw := u.Query().Get("normalize"); raw != "" {
+		if normalize, err = strconv.ParseBool(raw); err != nil {
+			return nil, fmt.Errorf("normalize must be true or false, got %q", raw)
+		}
+	}
+
+	return NewTitanClient(region, strings.TrimPrefix(u.Path, "/"), dims, normalize), nil
+}
+
+func newOllamaFromSpec(u *url.URL) (EmbeddingProvider, error) {
+	model := strings.TrimPrefix(u.Path, "/")
+	if model == "" {
+		return nil, fmt.Errorf("missing model (want ollama://host:port/model)")
+	}
+
+	baseURL := DefaultOllamaURL
+	if u.Host != "" {
+		baseURL = "http://" + u.Host
+	}
+	return NewOllamaClient(baseURL, model), nil
+}
+
+func newOpenAIFromSpec(u *url.URL) (EmbeddingProvider, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("missing model (want openai://model)")
+	}
+
+	dims, err := intParam(u, "dims")
+	if err != nil {
+		return nil, err
+	}
+
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("OPENAI_API_KEY is not set")
+	}
+
+	return NewOpenAIClient(u.Query().Get("base"), u.Host, apiKey, dims), nil
+}
+
+func newLlamaCppFromSpec(u *url.URL) (EmbeddingProvider, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("missing host (want llamacpp://host:port)")
+	}
+	return NewOpenAIClient("http://"+u.Host, strings.TrimPrefix(u.Path, "/"), "", 0), nil
+}
+
+func intParam(u *url.URL, name string) (int, error) {
+	raw := u.Query().Get(name)
+	if raw == "" {
+		return 0, nil
+	}
+
+	v, err := strconv.Atoi(raw)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("%s must be a positive integer, got %q", name, raw)
+	}
+	return v, nil
+}
+
+func newMockFromSpec(u *url.URL) (EmbeddingProvider, error) {
+	dims := 512
+	if u.Host != "" {
+		var err error
+		if dims, err = strconv.Atoi(u.Host); err != nil || dims <= 0 {
+			return nil, fmt.Errorf("dimensions must be a positive integer, got %q", u.Host)
+		}
+	}
+
+	seed, err := intParam(u, "seed")
+	if err != nil {
+		return nil, err
+	}
+	return NewHashingProvider(dims, uint64(seed)), nil
+}
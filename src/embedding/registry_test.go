@@ -0,0 +1,100 @@
+package embedding
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewProviderRejectsBadSpecs(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "")
+
+	tests := []struct {
+		spec string
+		want string // substring of the error
+	}{
+		{"", "missing scheme"},
+		{"localhost:11434/nomic-embed-text", "unknown scheme \"localhost\""},
+		{"nomic-embed-text", "missing scheme"},
+		{"cohere://embed-english-v3.0", "unknown scheme \"cohere\""},
+		{"ollama://local host/m", "invalid character"},
+		{"ollama://localhost:11434", "missing model"},
+		{"ollama://localhost:11434/", "missing model"},
+		{"openai://", "missing model"},
+		{"openai://text-embedding-3-small?dims=big", "dims must be a positive integer"},
+		{"openai://text-embedding-3-small?dims=0", "dims must be a positive integer"},
+		{"openai://text-embedding-3-small", "OPENAI_API_KEY"},
+		{"llamacpp:///model", "missing host"},
+		{"titan://us-east-1/amazon.titan-embed-text-v2:0?dims=-512", "dims must be a positive integer"},
+		{"titan://us-east-1/amazon.titan-embed-text-v2:0?normalize=maybe", "normalize must be true or false"},
+		{"mock://zero", "dimensions must be a positive integer"},
+		{"mock://0", "dimensions must be a positive integer"},
+		{"mock://512?seed=x", "seed must be a positive integer"},
+	}
+	for _, tt := range tests {
+		p, err := NewProvider(tt.spec)
+		if err == nil {
+			t.Errorf("NewProvider(%q) = %T, want an error", tt.spec, p)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("NewProvider(%q) error %q, want it to mention %q", tt.spec, err, tt.want)
+		}
+		if !strings.Contains(err.Error(), "embedding spec") {
+			t.Errorf("NewProvider(%q) error %q does not name the spec", tt.spec, err)
+		}
+	}
+}
+
+func TestNewProviderUnknownSchemeListsKnown(t *testing.T) {
+	_, err := NewProvider("cohere://embed-english-v3.0")
+	if err == nil {
+		t.Fatal("unknown scheme accepted")
+	}
+	for _, scheme := range Schemes() {
+		if !strings.Contains(err.Error(), scheme) {
+			t.Errorf("error %q does not list %q", err, scheme)
+		}
+	}
+}
+
+func TestNewProviderParsesSpecs(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+
+	p, err := NewProvider("ollama://gpu-box:11434/nomic-embed-text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o, ok := p.(*OllamaClient); !ok || o.baseURL != "http://gpu-box:11434" || o.model != "nomic-embed-text" {
+		t.Errorf("ollama spec built %#v", p)
+	}
+
+	if p, err = NewProvider("ollama:///all-minilm"); err != nil {
+		t.Fatal(err)
+	}
+	if o, ok := p.(*OllamaClient); !ok || o.baseURL != DefaultOllamaURL {
+		t.Errorf("ollama spec without a host built %#v, want the default URL", p)
+	}
+
+	if p, err = NewProvider("openai://text-embedding-3-small?dims=256"); err != nil {
+		t.Fatal(err)
+	}
+	if o, ok := p.(*OpenAIClient); !ok || o.model != "text-embedding-3-small" || o.dimensions != 256 || o.apiKey != "sk-test" {
+		t.Errorf("openai spec built %#v", p)
+	}
+
+	if p, err = NewProvider("mock://64?seed=7"); err != nil {
+		t.Fatal(err)
+	}
+	if h, ok := p.(*HashingProvider); !ok || h.dims != 64 || h.seed != 7 {
+		t.Errorf("mock spec built %#v", p)
+	}
+}
+
+func TestRegisterTwicePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("registering ollama a second time did not panic")
+		}
+	}()
+	Register("ollama", newOllamaFromSpec)
+}
@@ -0,0 +1,142 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// RetryConfig controls RetryingProvider
+type RetryConfig struct {
+	Timeout     time.Duration // per attempt; 0 disables
+	MaxAttempts int
+	BaseDelay   time.Duration // doubled after each failed attempt
+	MaxDelay    time.Duration
+}
+
+func DefaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		Timeout:     30 * time.Second,
+		MaxAttempts: 3,
+		BaseDelay:   200 * time.Millisecond,
+		MaxDelay:    5 * time.Second,
+	}
+}
+
+// EmbeddingError is returned by RetryingProvider once it gives up
+type EmbeddingError struct {
+	Provider   string
+	StatusCode int // HTTP status of the last attempt, 0 if there was no response
+	Attempts   int
+	Retried    bool
+	Err        error
+}
+
+func (e *EmbeddingError) Error() string {
+	msg := fmt.Sprintf("%s: embedding failed after %d attempt(s)", e.Provider, e.Attempts)
+	if e.StatusCode != 0 {
+		msg += fmt.Sprintf(" (status %d)", e.StatusCode)
+	}
+	return msg + ": " + e.Err.Error()
+}
+
+func (e *EmbeddingError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode extracts the HTTP status from err if it carries one (AWS SDK
+// response errors do), otherwise 0
+func StatusCode(err error) int {
+	var withStatus interface{ HTTPStatusCode() int }
+	if errors.As(err, &withStatus) {
+		return withStatus.HTTPStatusCode()
+	}
+	return 0
+}
+
+// RetryingProvider bounds each call with a timeout and retries connection
+// errors, timeouts, 429s and 5xx responses with exponential backoff and jitter
+type RetryingProvider struct {
+	provider EmbeddingProvider
+	config   RetryConfig
+}
+
+func NewRetryingProvider(p EmbeddingProvider, config RetryConfig) *RetryingProvider {
+	if config.MaxAttempts < 1 {
+		config.MaxAttempts = 1
+	}
+	return &RetryingProvider{provider: p, config: config}
+}
+
+func (r *RetryingProvider) GetEmbedding(ctx context.Context, text string) ([]float32, error) {
+	delay := r.config.BaseDelay
+
+	for attempt := 1; ; attempt++ {
+		vec, err := r.attempt(ctx, text)
+		if err == nil {
+			return vec, nil
+		}
+
+		status := StatusCode(err)
+		if attempt >= r.config.MaxAttempts || ctx.Err() != nil || !retryable(err, status) {
+			return nil, &EmbeddingError{
+				Provider:   r.provider.Name(),
+				StatusCode: status,
+				Attempts:   attempt,
+				Retried:    attempt > 1,
+				Err:        err,
+			}
+		}
+
+		// Full jitter keeps concurrent importers from retrying in lockstep
+		var sleep time.Duration
+		if delay > 0 {
+			sleep = time.Duration(rand.Int63n(int64(delay)) + 1)
+		}
+		select {
+		case <-time.After(sleep):
+		case <-ctx.Done():
+			return nil, &EmbeddingError{Provider: r.provider.Name(), Attempts: attempt, Retried: attempt > 1, Err: ctx.Err()}
+		}
+
+		delay *= 2
+		if r.config.MaxDelay > 0 && delay > r.config.MaxDelay {
+			delay = r.config.MaxDelay
+		}
+	}
+}
+
+func (r *RetryingProvider) attempt(ctx context.Context, text string) ([]float32, error) {
+	if r.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.config.Timeout)
+		defer cancel()
+	}
+	return r.provider.GetEmbedding(ctx, text)
+}
+
+// retryable reports whether err looks transient: throttling, a server
+// error, an attempt timeout or a network failure
+func retryable(err error, status int) bool {
+	if status != 0 {
+		return status == 429 || status >= 500
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+func (r *RetryingProvider) Dimensions() (int, error) {
+	return r.provider.Dimensions()
+}
+
+func (r *RetryingProvider) Name() string {
+	return r.provider.Name()
+}
@@ -0,0 +1,125 @@
+package embedding
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyServer answers /api/embed with failStatus for the first failures
+// requests and a 3-wide embedding after that, counting every request
+func flakyServer(t *testing.T, failures int32, failStatus int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= failures {
+			http.Error(w, "try again", failStatus)
+			return
+		}
+		json.NewEncoder(w).Encode(ollamaEmbedResponse{Embeddings: [][]float64{{1, 2, 3}}})
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+// fastRetries retries quickly enough for tests
+var fastRetries = RetryConfig{Timeout: time.Second, MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+func TestRetryFailsTwiceThenSucceeds(t *testing.T) {
+	server, requests := flakyServer(t, 2, http.StatusServiceUnavailable)
+	p := NewRetryingProvider(NewOllamaClient(server.URL, "test"), fastRetries)
+
+	vec, err := p.GetEmbedding(context.Background(), "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vec) != 3 || vec[2] != 3 {
+		t.Fatalf("embedding %v, want [1 2 3]", vec)
+	}
+	if n := requests.Load(); n != 3 {
+		t.Fatalf("%d requests, want 3", n)
+	}
+}
+
+func TestRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	server, requests := flakyServer(t, 10, http.StatusTooManyRequests)
+	p := NewRetryingProvider(NewOllamaClient(server.URL, "test"), fastRetries)
+
+	_, err := p.GetEmbedding(context.Background(), "hello")
+	var embedErr *EmbeddingError
+	if !errors.As(err, &embedErr) {
+		t.Fatalf("error %v, want an *EmbeddingError", err)
+	}
+	if embedErr.Attempts != 3 || !embedErr.Retried || embedErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("error %+v, want 3 attempts ending in a 429", embedErr)
+	}
+	if n := requests.Load(); n != 3 {
+		t.Fatalf("%d requests, want 3", n)
+	}
+}
+
+func TestRetrySkipsClientErrors(t *testing.T) {
+	server, requests := flakyServer(t, 10, http.StatusBadRequest)
+	p := NewRetryingProvider(NewOllamaClient(server.URL, "test"), fastRetries)
+
+	_, err := p.GetEmbedding(context.Background(), "hello")
+	var embedErr *EmbeddingError
+	if !errors.As(err, &embedErr) || embedErr.Attempts != 1 || embedErr.Retried {
+		t.Fatalf("error %v, want one attempt and no retry", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Fatalf("%d requests, want 1", n)
+	}
+}
+
+func TestRetryTimesOutSlowAttempt(t *testing.T) {
+	var requests atomic.Int32
+	release := make(chan struct{}) // lets the first, abandoned request end
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			<-release
+			return
+		}
+		json.NewEncoder(w).Encode(ollamaEmbedResponse{Embeddings: [][]float64{{1, 2, 3}}})
+	}))
+	defer server.Close()
+	defer close(release)
+
+	config := fastRetries
+	config.Timeout = 50 * time.Millisecond
+	p := NewRetryingProvider(NewOllamaClient(server.URL, "test"), config)
+
+	if _, err := p.GetEmbedding(context.Background(), "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Fatalf("%d requests, want 2", n)
+	}
+}
+
+func TestRetryBackoffWaitsAndHonoursContext(t *testing.T) {
+	server, requests := flakyServer(t, 10, http.StatusInternalServerError)
+	config := fastRetries
+	config.BaseDelay, config.MaxDelay = time.Hour, time.Hour
+	p := NewRetryingProvider(NewOllamaClient(server.URL, "test"), config)
+
+	// The first backoff is up to an hour; the context ends it early
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := p.GetEmbedding(ctx, "hello")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error %v, want the context's deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("backoff ignored the context for %v", elapsed)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Fatalf("%d requests, want 1 before the backoff", n)
+	}
+}
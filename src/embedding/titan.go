@@ -4,12 +4,87 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
+	"sync"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
 )
 
 
+const (
+	TitanModelID    = "amazon.titan-embed-text-v2:0"
+	TitanDimensions = 512
+)
+
+// TitanClient is the Bedrock Titan text embedding provider. The AWS config is
+// loaded on first use, so constructing one never touches the network.
+type TitanClient struct {
+	region     string
+	modelID    string
+	dimensions int
+	normalize  bool
+
+	// Logger receives per-request token counts when set
+	Logger *log.Logger
+
+	cfg     *aws.Config // used instead of loading one when set
+	once    sync.Once
+	bedrock *bedrockruntime.Client
+	initErr error
+}
+
+// NewTitanClient returns a Titan provider; an empty modelID or zero dimensions use the defaults
+func NewTitanClient(region, modelID string, dimensions int, normalize bool) *TitanClient {
+	if modelID == "" {
+		modelID = TitanModelID
+	}
+	if dimensions == 0 {
+		dimensions = TitanDimensions
+	}
+
+	return &TitanClient{
+		region:     region,
+		modelID:    modelID,
+		dimensions: dimensions,
+		normalize:  normalize,
+	}
+}
+
+// NewTitanClientFromConfig is NewTitanClient sharing an AWS config the
+// caller already loaded
+func NewTitanClientFromConfig(cfg aws.Config, modelID string, dimensions int, normalize bool) *TitanClient {
+	t := NewTitanClient(cfg.Region, modelID, dimensions, normalize)
+	t.cfg = &cfg
+	return t
+}
+
+func (t *TitanClient) client(ctx context.Context) (*bedrockruntime.Client, error) {
+	t.once.Do(func() {
+		if t.cfg != nil {
+			t.bedrock = bedrockruntime.NewFromConfig(*t.cfg)
+			return
+		}
+		cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(t.region))
+		if err != nil {
+			t.initErr = fmt.Errorf("aws config error: %w", err)
+			return
+		}
+		t.bedrock = bedrockruntime.NewFromConfig(cfg)
+	})
+	return t.bedrock, t.initErr
+}
+
+// Dimensions needs no probe: Titan v2 returns exactly the size it is asked for
+func (t *TitanClient) Dimensions() (int, error) {
+	return t.dimensions, nil
+}
+
+func (t *TitanClient) Name() string {
+	return "titan " + t.modelID
+}
+
 type TitanRequest struct {
 	InputText  string `json:"inputText"`
 	Dimensions int    `json:"dimensions,omitempty"`
@@ -22,11 +97,16 @@ type TitanResponse struct {
 	InputTextTokenCount int       `json:"inputTextTokenCount"`
 }
 
-func GetEmbedding(ctx context.Context, client *bedrockruntime.Client, text string) ([]float32, error) {
+func (t *TitanClient) GetEmbedding(ctx context.Context, text string) ([]float32, error) {
+	client, err := t.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	payload := TitanRequest{
 		InputText:  text,
-		Dimensions: 512,
-		Normalize:  true,
+		Dimensions: t.dimensions,
+		Normalize:  t.normalize,
 	}
 
 	body, err := json.Marshal(payload)
@@ -35,7 +115,7 @@ func GetEmbedding(ctx context.Context, client *bedrockruntime.Client, text strin
 	}
 
 	output, err := client.InvokeModel(ctx, &bedrockruntime.InvokeModelInput{
-		ModelId:     aws.String("amazon.titan-embed-text-v2:0"),
+		ModelId:     aws.String(t.modelID),
 		ContentType: aws.String("application/json"),
 		Body:        body,
 	})
@@ -48,8 +128,9 @@ func GetEmbedding(ctx context.Context, client *bedrockruntime.Client, text strin
 		return nil, fmt.Errorf("unmarshal error: %w", err)
 	}
 
-	fmt.Printf("Token count: %d\n", response.InputTextTokenCount)
-	fmt.Printf("Embedding dimensions: %d\n", len(response.Embedding))
+	if t.Logger != nil {
+		t.Logger.Printf("titan: %d tokens, %d dimensions", response.InputTextTokenCount, len(response.Embedding))
+	}
 
 	return response.Embedding, nil
 }
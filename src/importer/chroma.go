@@ -0,0 +1,187 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ChromaReader reads a Chroma collection exported as JSON lines. Each line
+// is either one record
+//
+//	{"id": "a", "embedding": [...], "document": "...", "metadata": {...}}
+//
+// or a page of collection.get(include=["embeddings", "documents", "metadatas"])
+// output, with parallel arrays
+//
+//	{"ids": [...], "embeddings": [[...]], "documents": [...], "metadatas": [...]}
+//
+// The path may be one .jsonl file or a directory of them, read in name
+// order. Parquet exports are not supported; convert them to JSON lines first.
+type ChromaReader struct {
+	files   []string
+	file    *os.File
+	scanner *bufio.Scanner
+	pending []Record // rest of the current page
+	row     int
+}
+
+type chromaLine struct {
+	ID        string         `json:"id"`
+	Embedding []float32      `json:"embedding"`
+	Document  *string        `json:"document"`
+	Metadata  map[string]any `json:"metadata"`
+
+	IDs        []string         `json:"ids"`
+	Embeddings [][]float32      `json:"embeddings"`
+	Documents  []*string        `json:"documents"`
+	Metadatas  []map[string]any `json:"metadatas"`
+}
+
+func NewChromaReader(path string) (*ChromaReader, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		if files, err = exportFiles(path); err != nil {
+			return nil, err
+		}
+	} else if strings.HasSuffix(path, ".parquet") {
+		return nil, fmt.Errorf("%s: parquet exports are not supported, convert to JSON lines", path)
+	}
+
+	return &ChromaReader{files: files}, nil
+}
+
+func exportFiles(dir string) ([]string, error) {
+	var files []string
+	for _, pattern := range []string{"*.jsonl", "*.json"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+
+	if len(files) == 0 {
+		if parquet, _ := filepath.Glob(filepath.Join(dir, "*.parquet")); len(parquet) > 0 {
+			return nil, fmt.Errorf("%s: parquet exports are not supported, convert to JSON lines", dir)
+		}
+		return nil, fmt.Errorf("%s: no .jsonl files to import", dir)
+	}
+	return files, nil
+}
+
+func (r *ChromaReader) Next() (Record, error) {
+	for {
+		if len(r.pending) > 0 {
+			rec := r.pending[0]
+			r.pending = r.pending[1:]
+			r.row++
+			if err := checkChromaRecord(rec); err != "" {
+				return Record{}, &SkipError{Row: r.row, Reason: err}
+			}
+			return rec, nil
+		}
+
+		if r.scanner == nil {
+			if err := r.openNext(); err != nil {
+				return Record{}, err
+			}
+		}
+
+		if !r.scanner.Scan() {
+			if err := r.scanner.Err(); err != nil {
+				return Record{}, fmt.Errorf("%s: %w", r.file.Name(), err)
+			}
+			r.file.Close()
+			r.scanner = nil
+			continue
+		}
+
+		line := strings.TrimSpace(r.scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var parsed chromaLine
+		if err := json.Unmarshal([]byte(line), &parsed); err != nil {
+			r.row++
+			return Record{}, &SkipError{Row: r.row, Reason: "invalid JSON"}
+		}
+		r.pending = parsed.records()
+	}
+}
+
+func (r *ChromaReader) openNext() error {
+	if len(r.files) == 0 {
+		return io.EOF
+	}
+
+	f, err := os.Open(r.files[0])
+	if err != nil {
+		return err
+	}
+	r.files = r.files[1:]
+	r.file = f
+	r.scanner = bufio.NewScanner(f)
+	// One line can hold a whole page of embeddings
+	r.scanner.Buffer(make([]byte, 0, 1<<20), 256<<20)
+	return nil
+}
+
+// Close releases the open export file, if any
+func (r *ChromaReader) Close() error {
+	if r.scanner != nil {
+		r.scanner = nil
+		return r.file.Close()
+	}
+	return nil
+}
+
+func (l *chromaLine) records() []Record {
+	if l.IDs == nil {
+		return []Record{{ID: l.ID, Vector: l.Embedding, Text: deref(l.Document), Metadata: toMetadata(l.Metadata)}}
+	}
+
+	records := make([]Record, len(l.IDs))
+	for i, id := range l.IDs {
+		records[i].ID = id
+		if i < len(l.Embeddings) {
+			records[i].Vector = l.Embeddings[i]
+		}
+		if i < len(l.Documents) {
+			records[i].Text = deref(l.Documents[i])
+		}
+		if i < len(l.Metadatas) {
+			records[i].Metadata = toMetadata(l.Metadatas[i])
+		}
+	}
+	return records
+}
+
+func checkChromaRecord(rec Record) string {
+	switch {
+	case rec.Vector == nil:
+		return "no embedding"
+	case rec.Text == "":
+		return "no document"
+	}
+	return ""
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,130 @@
+package importer
+
+import (
+	"Hippocampus/src/client"
+	"Hippocampus/src/embedding"
+	"Hippocampus/src/storage"
+	"Hippocampus/src/types"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// exportTree exports a tree of n nodes with a config, schema and radii,
+// projected from inputDims when that isn't 512, and opens it for import
+func exportTree(t *testing.T, n, inputDims int) (*types.Tree, *NpyReader) {
+	t.Helper()
+	tree := types.NewTree()
+	tree.Normalize = true
+	tree.Config = types.NewConfig("mock 512", true)
+	tree.Schema = &types.Schema{Fields: map[string]types.FieldSpec{"row": {Type: types.FieldInt, Required: true}}}
+	tree.Radii = map[string]float32{"apple": 0.25, "orchard": 0.5}
+	if inputDims != 512 {
+		p, err := types.RandomProjection(inputDims, 512, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree.Projection = p
+	}
+	for i := 0; i < n; i++ {
+		var key [512]float32
+		key[i] = 1
+		if err := tree.InsertWithMetadata(key, fmt.Sprintf("node %d", i), map[string]string{"row": fmt.Sprint(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir := t.TempDir()
+	vecPath, valuesPath := filepath.Join(dir, "vectors.npy"), filepath.Join(dir, "values.jsonl")
+	if err := storage.ExportNpy(tree, vecPath, valuesPath); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewNpyReader(vecPath, valuesPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return tree, r
+}
+
+func newImportClient(t *testing.T) *client.Client {
+	t.Helper()
+	c, err := client.New(filepath.Join(t.TempDir(), "tree.bin"), "us-east-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetVerbose(false)
+	c.Embedder = embedding.NewMockProvider(512)
+	return c
+}
+
+func TestImportAppliesExportHeader(t *testing.T) {
+	source, r := exportTree(t, 5, 512)
+	c := newImportClient(t)
+
+	result, err := Import(c, r, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Inserted != 5 {
+		t.Fatalf("imported %+v, want 5 rows", result)
+	}
+
+	tree, err := storage.New(c.Storage.Path()).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tree.Normalize || tree.Config == nil || tree.Config.String() != source.Config.String() {
+		t.Errorf("imported database normalizes %v with config %v, want %v", tree.Normalize, tree.Config, source.Config)
+	}
+	if tree.Schema == nil || tree.Schema.Fields["row"] != source.Schema.Fields["row"] {
+		t.Errorf("imported schema %+v, want %+v", tree.Schema, source.Schema)
+	}
+	if !maps.Equal(tree.Radii, source.Radii) {
+		t.Errorf("imported radii %v, want %v", tree.Radii, source.Radii)
+	}
+}
+
+func TestImportKeepsExistingRadii(t *testing.T) {
+	_, r := exportTree(t, 2, 512)
+	c := newImportClient(t)
+	if err := c.SetRadii(map[string]float32{"apple": 0.75}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Import(c, r, 0); err != nil {
+		t.Fatal(err)
+	}
+	tree, err := storage.New(c.Storage.Path()).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]float32{"apple": 0.75, "orchard": 0.5}; !maps.Equal(tree.Radii, want) {
+		t.Errorf("radii after import %v, want %v", tree.Radii, want)
+	}
+}
+
+// A database with nodes refuses an export of another width before any row
+func TestImportRefusesOtherDimensions(t *testing.T) {
+	_, r := exportTree(t, 3, 768)
+	c := newImportClient(t)
+	if err := c.Insert("existing", "already here"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Import(c, r, 0)
+	if err == nil || !strings.Contains(err.Error(), "cannot import 768-dimension vectors") {
+		t.Fatalf("import of 768-dimension export: %v", err)
+	}
+	if result.Read != 0 || result.Inserted != 0 {
+		t.Errorf("refused import read %+v", result)
+	}
+	if n, err := storage.New(c.Storage.Path()).NodeCount(); err != nil || n != 1 {
+		t.Errorf("database holds %d nodes after the refused import (%v), want 1", n, err)
+	}
+}
@@ -0,0 +1,164 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// FAISSReader pairs a matrix of float32 vectors with a JSON lines file of
+// texts, row for row. The vectors file is either raw little-endian float32
+// rows of a fixed width (e.g. index.reconstruct_n(0, index.ntotal).tofile())
+// or .fvecs, where each row starts with its int32 dimension. Each text line is a JSON string or an object with
+// "text" and optional "id" and "metadata".
+type FAISSReader struct {
+	vectors *bufio.Reader
+	texts   *bufio.Scanner
+	files   []*os.File
+	dims    int  // fixed row width; 0 for fvecs
+	fvecs   bool // rows carry their own dimension
+	row     int
+}
+
+type faissText struct {
+	ID       string         `json:"id"`
+	Text     string         `json:"text"`
+	Metadata map[string]any `json:"metadata"`
+}
+
+// NewFAISSReader opens the two files. dims is the row width of a raw matrix
+// and is ignored for .fvecs files, which record it per row.
+func NewFAISSReader(vectorsPath, textsPath string, dims int) (*FAISSReader, error) {
+	fvecs := strings.HasSuffix(vectorsPath, ".fvecs")
+	if !fvecs && dims <= 0 {
+		return nil, fmt.Errorf("a raw float32 matrix needs its dimensions")
+	}
+
+	vf, err := os.Open(vectorsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if !fvecs {
+		info, err := vf.Stat()
+		if err != nil {
+			vf.Close()
+			return nil, err
+		}
+		if info.Size()%int64(4*dims) != 0 {
+			vf.Close()
+			return nil, fmt.Errorf("%s: %d bytes is not a whole number of %d-dimension float32 rows", vectorsPath, info.Size(), dims)
+		}
+	}
+
+	tf, err := os.Open(textsPath)
+	if err != nil {
+		vf.Close()
+		return nil, err
+	}
+
+	texts := bufio.NewScanner(tf)
+	texts.Buffer(make([]byte, 0, 64<<10), 64<<20)
+
+	return &FAISSReader{
+		vectors: bufio.NewReader(vf),
+		texts:   texts,
+		files:   []*os.File{vf, tf},
+		dims:    dims,
+		fvecs:   fvecs,
+	}, nil
+}
+
+func (r *FAISSReader) Next() (Record, error) {
+	vec, vecErr := r.readVector()
+	text, textErr := r.readText()
+
+	switch {
+	case vecErr == io.EOF && textErr == io.EOF:
+		return Record{}, io.EOF
+	case vecErr == io.EOF:
+		return Record{}, fmt.Errorf("texts file has more rows than the %d vectors", r.row)
+	case textErr == io.EOF:
+		return Record{}, fmt.Errorf("vectors file has more rows than the %d texts", r.row)
+	case vecErr != nil:
+		return Record{}, vecErr
+	}
+
+	r.row++
+	if textErr != nil {
+		return Record{}, &SkipError{Row: r.row, Reason: "invalid text line"}
+	}
+	if text.Text == "" {
+		return Record{}, &SkipError{Row: r.row, Reason: "no document"}
+	}
+
+	return Record{ID: text.ID, Text: text.Text, Vector: vec, Metadata: toMetadata(text.Metadata)}, nil
+}
+
+func (r *FAISSReader) readVector() ([]float32, error) {
+	dims := r.dims
+	if r.fvecs {
+		var d int32
+		if err := binary.Read(r.vectors, binary.LittleEndian, &d); err != nil {
+			return nil, err
+		}
+		if d <= 0 || d > 1<<16 {
+			return nil, fmt.Errorf("row %d: corrupt fvecs dimension %d", r.row+1, d)
+		}
+		dims = int(d)
+	}
+
+	buf := make([]byte, 4*dims)
+	if _, err := io.ReadFull(r.vectors, buf); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) || (r.fvecs && err == io.EOF) {
+			return nil, fmt.Errorf("row %d: vectors file is truncated", r.row+1)
+		}
+		return nil, err
+	}
+
+	vec := make([]float32, dims)
+	for i := range vec {
+		vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return vec, nil
+}
+
+// readText returns io.EOF at the end of the file; any other error is a bad
+// line, and the row is skipped
+func (r *FAISSReader) readText() (faissText, error) {
+	for r.texts.Scan() {
+		line := strings.TrimSpace(r.texts.Text())
+		if line == "" {
+			continue
+		}
+
+		var t faissText
+		if strings.HasPrefix(line, `"`) {
+			err := json.Unmarshal([]byte(line), &t.Text)
+			return t, err
+		}
+		err := json.Unmarshal([]byte(line), &t)
+		return t, err
+	}
+
+	if err := r.texts.Err(); err != nil {
+		return faissText{}, err
+	}
+	return faissText{}, io.EOF
+}
+
+func (r *FAISSReader) Close() error {
+	var first error
+	for _, f := range r.files {
+		if err := f.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,205 @@
+// Package importer moves memories with precomputed embeddings from other
+// vector stores into a Hippocampus database without re-embedding them.
+package importer
+
+import (
+	"Hippocampus/src/client"
+	"Hippocampus/src/storage"
+	"Hippocampus/src/types"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// IDKey is the metadata key that keeps a record's ID from the source store
+const IDKey = "id"
+
+// DefaultBatchSize is how many records Import hands to BatchInsert at a time
+const DefaultBatchSize = 1000
+
+// Record is one memory read from an export
+type Record struct {
+	ID       string
+	Text     string
+	Vector   []float32
+	Metadata map[string]string
+	Payload  []byte
+}
+
+// Reader streams records from an export. Next returns io.EOF after the last
+// record. A *SkipError means the current row is unusable but reading can go on.
+type Reader interface {
+	Next() (Record, error)
+}
+
+// HeaderReader is a Reader whose export may begin with the header of the
+// database it came from, which Import applies to the target first
+type HeaderReader interface {
+	Reader
+	Header() *storage.ExportHeader // nil when the export has none
+}
+
+// SkipError describes a row that was read but cannot be imported
+type SkipError struct {
+	Row    int
+	Reason string
+}
+
+func (e *SkipError) Error() string {
+	return fmt.Sprintf("row %d: %s", e.Row, e.Reason)
+}
+
+// Result counts what an import did
+type Result struct {
+	Read     int            `json:"read"`
+	Inserted int            `json:"inserted"`
+	Skipped  int            `json:"skipped"`
+	Reasons  map[string]int `json:"reasons,omitempty"` // skipped rows per reason
+}
+
+func (r *Result) skip(reason string) {
+	r.Skipped++
+	if r.Reasons == nil {
+		r.Reasons = make(map[string]int)
+	}
+	r.Reasons[reason]++
+}
+
+// Import reads every record from r and inserts them into c in batches of
+// batchSize (<= 0 means DefaultBatchSize), flushing once at the end. Every
+// vector must have the database's 512 dimensions; rows that don't, rows
+// with NaN or infinite values (unless c.SanitizeVectors is set), rows over
+// c's size limits (see Client.CheckSize), rows whose metadata breaks the
+// database's schema and rows the reader rejects are skipped and counted
+// rather than failing the import. A HeaderReader's header is applied first
+// (see Client.ApplyExportHeader); an export the database can't take fails
+// before any row is read.
+func Import(c *client.Client, r Reader, batchSize int) (Result, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	var result Result
+	if hr, ok := r.(HeaderReader); ok && hr.Header() != nil {
+		if err := c.ApplyExportHeader(hr.Header()); err != nil {
+			return result, err
+		}
+	}
+	batch := make([]client.VectorRecord, 0, batchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := c.AppendBatch(batch); err != nil {
+			return err
+		}
+		result.Inserted += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+
+		var skip *SkipError
+		if errors.As(err, &skip) {
+			result.Read++
+			result.skip(skip.Reason)
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		result.Read++
+
+		var key [512]float32
+		if len(rec.Vector) != len(key) {
+			result.skip(fmt.Sprintf("%d dimensions, expected %d", len(rec.Vector), len(key)))
+			continue
+		}
+		copy(key[:], rec.Vector)
+		if !c.SanitizeVectors {
+			if err := types.ValidateKey(&key); err != nil {
+				result.skip("non-finite value")
+				continue
+			}
+		}
+		if key == ([512]float32{}) {
+			result.skip("zero vector")
+			continue
+		}
+
+		metadata := rec.Metadata
+		if rec.ID != "" {
+			if metadata == nil {
+				metadata = make(map[string]string, 1)
+			}
+			metadata[IDKey] = rec.ID
+		}
+
+		if err := c.CheckSize(rec.Text, metadata, rec.Payload); err != nil {
+			result.skip(sizeReason(err))
+			continue
+		}
+		if err := c.CheckMetadata(metadata); err != nil {
+			var schemaErr *types.SchemaError
+			if errors.As(err, &schemaErr) {
+				result.skip(fmt.Sprintf("metadata %q %s", schemaErr.Field, schemaErr.Reason))
+				continue
+			}
+			return result, err
+		}
+
+		batch = append(batch, client.VectorRecord{Key: key, Text: rec.Text, Metadata: metadata, Payload: rec.Payload})
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return result, err
+	}
+	return result, c.Flush()
+}
+
+// sizeReason names a CheckSize failure without the sizes, so rows skipped
+// for the same limit are counted together
+func sizeReason(err error) string {
+	for _, limit := range []error{client.ErrValueTooLarge, client.ErrMetadataTooLarge, client.ErrPayloadTooLarge} {
+		if errors.Is(err, limit) {
+			return limit.Error()
+		}
+	}
+	return err.Error()
+}
+
+// metadataString stores Chroma's str/int/float/bool metadata values as
+// strings, keeping strings verbatim and encoding the rest as JSON
+func metadataString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(encoded)
+}
+
+func toMetadata(raw map[string]any) map[string]string {
+	if len(raw) == 0 {
+		return nil
+	}
+	metadata := make(map[string]string, len(raw)+1)
+	for k, v := range raw {
+		metadata[k] = metadataString(v)
+	}
+	return metadata
+}
@@ -0,0 +1,141 @@
+package importer
+
+import (
+	"Hippocampus/src/storage"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// NpyReader pairs a 2-D .npy matrix (float32 or float64, as written by
+// np.save) with the JSON lines values file that `export-npy` writes, row for
+// row. Values lines are storage.NpyValue objects; plain JSON strings are
+// accepted too, for matrices produced outside Hippocampus. A leading
+// storage.ExportHeader line is returned by Header rather than as a row.
+type NpyReader struct {
+	matrix  *storage.NpyMatrix
+	values  *bufio.Scanner
+	file    *os.File
+	row     int
+	header  *storage.ExportHeader
+	pending string // the first values line, read looking for a header
+}
+
+func NewNpyReader(vectorsPath, valuesPath string) (*NpyReader, error) {
+	matrix, err := storage.OpenNpy(vectorsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(valuesPath)
+	if err != nil {
+		matrix.Close()
+		return nil, err
+	}
+
+	values := bufio.NewScanner(f)
+	values.Buffer(make([]byte, 0, 64<<10), 64<<20)
+
+	r := &NpyReader{matrix: matrix, values: values, file: f}
+	if err := r.readHeader(); err != nil {
+		r.Close()
+		return nil, fmt.Errorf("%s: %w", valuesPath, err)
+	}
+	return r, nil
+}
+
+// Header is the export's storage.ExportHeader, nil when the values file
+// has none
+func (r *NpyReader) Header() *storage.ExportHeader {
+	return r.header
+}
+
+// readHeader reads the first values line, keeping it for Next unless it
+// is a header
+func (r *NpyReader) readHeader() error {
+	line, ok := r.nextLine()
+	if !ok {
+		return r.values.Err()
+	}
+	h, isHeader, err := storage.ParseExportHeader([]byte(line))
+	if err != nil {
+		return err
+	}
+	if isHeader {
+		r.header = h
+	} else {
+		r.pending = line
+	}
+	return nil
+}
+
+// nextLine returns the next non-blank values line, false at the end
+func (r *NpyReader) nextLine() (string, bool) {
+	if r.pending != "" {
+		line := r.pending
+		r.pending = ""
+		return line, true
+	}
+	for r.values.Scan() {
+		if line := strings.TrimSpace(r.values.Text()); line != "" {
+			return line, true
+		}
+	}
+	return "", false
+}
+
+func (r *NpyReader) Next() (Record, error) {
+	vec, vecErr := r.matrix.Next()
+	value, valueErr := r.readValue()
+
+	switch {
+	case vecErr == io.EOF && valueErr == io.EOF:
+		return Record{}, io.EOF
+	case vecErr == io.EOF:
+		return Record{}, fmt.Errorf("values file has more rows than the %d vectors", r.row)
+	case valueErr == io.EOF:
+		return Record{}, fmt.Errorf("matrix has more rows than the %d values", r.row)
+	case vecErr != nil:
+		return Record{}, vecErr
+	}
+
+	r.row++
+	if valueErr != nil {
+		return Record{}, &SkipError{Row: r.row, Reason: "invalid values line"}
+	}
+	if value.Value == "" {
+		return Record{}, &SkipError{Row: r.row, Reason: "no value"}
+	}
+
+	return Record{Text: value.Value, Vector: vec, Metadata: value.Metadata, Payload: value.Payload}, nil
+}
+
+// readValue returns io.EOF at the end of the file; any other error is a bad
+// line, and the row is skipped
+func (r *NpyReader) readValue() (storage.NpyValue, error) {
+	if line, ok := r.nextLine(); ok {
+		var v storage.NpyValue
+		if strings.HasPrefix(line, `"`) {
+			err := json.Unmarshal([]byte(line), &v.Value)
+			return v, err
+		}
+		err := json.Unmarshal([]byte(line), &v)
+		return v, err
+	}
+
+	if err := r.values.Err(); err != nil {
+		return storage.NpyValue{}, err
+	}
+	return storage.NpyValue{}, io.EOF
+}
+
+func (r *NpyReader) Close() error {
+	err := r.matrix.Close()
+	if ferr := r.file.Close(); err == nil {
+		err = ferr
+	}
+	return err
+}
@@ -0,0 +1,127 @@
+package importer
+
+import (
+	"Hippocampus/src/storage"
+	"Hippocampus/src/types"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// awkwardFloats are values that survive a float32 round trip only if every
+// bit is copied: -0 equals 0 and subnormals flush to zero under a careless
+// conversion
+var awkwardFloats = []float32{
+	float32(math.Copysign(0, -1)),
+	math.SmallestNonzeroFloat32,
+	-math.SmallestNonzeroFloat32,
+	math.Float32frombits(0x007fffff), // largest subnormal
+	math.MaxFloat32,
+	-math.MaxFloat32,
+	1 + 1.0/(1<<23), // one ulp above 1
+}
+
+func TestNpyRoundTripIsBitwise(t *testing.T) {
+	rng := rand.New(rand.NewPCG(12, 12))
+	tree := types.NewTree()
+	for i := 0; i < 20; i++ {
+		var key [512]float32
+		for d := range key {
+			key[d] = float32(rng.NormFloat64() * math.Pow(10, float64(rng.IntN(20)-10)))
+		}
+		copy(key[i*len(awkwardFloats)%512:], awkwardFloats)
+
+		metadata := map[string]string{"row": fmt.Sprint(i)}
+		if err := tree.InsertWithPayload(key, fmt.Sprintf("node %d", i), metadata, []byte{byte(i), 0, 0xff}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir := t.TempDir()
+	vecPath, valuesPath := filepath.Join(dir, "vectors.npy"), filepath.Join(dir, "values.jsonl")
+	if err := storage.ExportNpy(tree, vecPath, valuesPath); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewNpyReader(vecPath, valuesPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if h := r.Header(); h == nil || h.Nodes != len(tree.Nodes) || h.Dimensions != 512 {
+		t.Fatalf("header %+v, want %d nodes of 512 dimensions", h, len(tree.Nodes))
+	}
+
+	for i := range tree.Nodes {
+		want := &tree.Nodes[i]
+		rec, err := r.Next()
+		if err != nil {
+			t.Fatalf("row %d: %v", i, err)
+		}
+		if len(rec.Vector) != len(want.Key) {
+			t.Fatalf("row %d: %d columns, want %d", i, len(rec.Vector), len(want.Key))
+		}
+		for d, v := range rec.Vector {
+			if math.Float32bits(v) != math.Float32bits(want.Key[d]) {
+				t.Fatalf("row %d column %d: %#08x, want %#08x", i, d, math.Float32bits(v), math.Float32bits(want.Key[d]))
+			}
+		}
+		if rec.Text != want.Value || !maps.Equal(rec.Metadata, want.Metadata) || !slices.Equal(rec.Payload, want.Payload) {
+			t.Fatalf("row %d: %q %v %v, want %q %v %v", i, rec.Text, rec.Metadata, rec.Payload, want.Value, want.Metadata, want.Payload)
+		}
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Fatalf("after the last row: %v, want io.EOF", err)
+	}
+}
+
+// TestNpyHeaderLayout checks the parts of the format np.load insists on for
+// shapes whose dicts have different lengths
+func TestNpyHeaderLayout(t *testing.T) {
+	for _, rows := range []int{0, 1, 9, 10, 12345} {
+		tree := types.NewTree()
+		for i := 0; i < rows; i++ {
+			var key [512]float32
+			key[0] = float32(i)
+			if err := tree.Insert(key, "x"); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		dir := t.TempDir()
+		vecPath := filepath.Join(dir, "vectors.npy")
+		if err := storage.ExportNpy(tree, vecPath, filepath.Join(dir, "values.jsonl")); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(vecPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(data[:6]) != "\x93NUMPY" || data[6] != 1 || data[7] != 0 {
+			t.Fatalf("%d rows: prefix %q, want NPY version 1.0", rows, data[:8])
+		}
+		dataStart := 10 + int(binary.LittleEndian.Uint16(data[8:10]))
+		if dataStart%64 != 0 {
+			t.Errorf("%d rows: data starts at byte %d, not on a 64-byte boundary", rows, dataStart)
+		}
+		if data[dataStart-1] != '\n' {
+			t.Errorf("%d rows: header does not end in a newline", rows)
+		}
+		want := fmt.Sprintf("{'descr': '<f4', 'fortran_order': False, 'shape': (%d, 512), }", rows)
+		if got := string(data[10 : 10+len(want)]); got != want {
+			t.Errorf("%d rows: header %q, want %q", rows, got, want)
+		}
+		if size := dataStart + rows*512*4; len(data) != size {
+			t.Errorf("%d rows: file is %d bytes, want %d", rows, len(data), size)
+		}
+	}
+}
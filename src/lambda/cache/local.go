@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Local is an in-process LRU Store. A warm Lambda container keeps it across
+// invocations, but each container has its own: on its own it cannot see
+// invalidations made by other containers, so keep its TTL short.
+type Local struct {
+	maxEntries int
+	ttl        time.Duration // caps every entry's TTL; 0 means no cap
+
+	mu          sync.Mutex
+	entries     map[string]*list.Element
+	order       *list.List // most recently used at the front
+	generations map[string]uint64
+}
+
+type localEntry struct {
+	key     string
+	value   []byte
+	expires time.Time // zero never expires
+}
+
+func NewLocal(maxEntries int, ttl time.Duration) *Local {
+	return &Local{
+		maxEntries:  maxEntries,
+		ttl:         ttl,
+		entries:     make(map[string]*list.Element),
+		order:       list.New(),
+		generations: make(map[string]uint64),
+	}
+}
+
+// Get returns the stored slice itself; callers must not modify it
+func (c *Local) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	entry := elem.Value.(*localEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.remove(elem)
+		return nil, false, nil
+	}
+
+	c.order.MoveToFront(elem)
+	return entry.value, true, nil
+}
+
+// Set keeps a copy of value; the caller may reuse its slice
+func (c *Local) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if c.ttl > 0 && (ttl <= 0 || ttl > c.ttl) {
+		ttl = c.ttl
+	}
+
+	entry := &localEntry{key: key, value: append([]byte(nil), value...)}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return nil
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.maxEntries {
+		c.remove(c.order.Back())
+	}
+	return nil
+}
+
+func (c *Local) Delete(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	return nil
+}
+
+func (c *Local) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*localEntry).key)
+}
+
+func (c *Local) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *Local) Generation(ctx context.Context, namespace string) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation(namespace), nil
+}
+
+func (c *Local) IncrGeneration(ctx context.Context, namespace string) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	gen := c.generation(namespace) + 1
+	c.generations[namespace] = gen
+	return gen, nil
+}
+
+func (c *Local) generation(namespace string) uint64 {
+	gen, ok := c.generations[namespace]
+	if !ok {
+		gen = initialGeneration()
+		c.generations[namespace] = gen
+	}
+	return gen
+}
@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// expire makes key's entry look as if its TTL ran out
+func expire(c *Local, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key].Value.(*localEntry).expires = time.Now().Add(-time.Second)
+}
+
+func TestLocalEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	c := NewLocal(2, 0)
+
+	c.Set(ctx, "a", []byte("1"), 0)
+	c.Set(ctx, "b", []byte("2"), 0)
+	c.Get(ctx, "a")
+	c.Set(ctx, "c", []byte("3"), 0)
+
+	if _, ok, _ := c.Get(ctx, "b"); ok {
+		t.Error("least recently used entry was kept past maxEntries")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok, _ := c.Get(ctx, key); !ok {
+			t.Errorf("%s was evicted", key)
+		}
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", c.Len())
+	}
+
+	// Overwriting keeps one entry and a copy of the value
+	value := []byte("new")
+	c.Set(ctx, "a", value, 0)
+	value[0] = 'x'
+	if got, _, _ := c.Get(ctx, "a"); string(got) != "new" || c.Len() != 2 {
+		t.Errorf("overwritten entry %q with %d entries", got, c.Len())
+	}
+}
+
+func TestLocalExpires(t *testing.T) {
+	ctx := context.Background()
+	c := NewLocal(10, time.Minute)
+
+	c.Set(ctx, "capped", []byte("1"), time.Hour)
+	c.Set(ctx, "short", []byte("2"), time.Second)
+	c.Set(ctx, "default", []byte("3"), 0)
+	for key, ttl := range map[string]time.Duration{"capped": time.Minute, "short": time.Second, "default": time.Minute} {
+		expires := c.entries[key].Value.(*localEntry).expires
+		if left := time.Until(expires); left > ttl || left < ttl-time.Second {
+			t.Errorf("%s expires in %v, want %v", key, left, ttl)
+		}
+	}
+
+	expire(c, "short")
+	if _, ok, _ := c.Get(ctx, "short"); ok {
+		t.Error("expired entry was returned")
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len() = %d, want the expired entry dropped", c.Len())
+	}
+
+	// Without a cap a zero TTL never expires
+	uncapped := NewLocal(10, 0)
+	uncapped.Set(ctx, "forever", []byte("1"), 0)
+	if expires := uncapped.entries["forever"].Value.(*localEntry).expires; !expires.IsZero() {
+		t.Errorf("zero TTL expires at %v", expires)
+	}
+}
+
+func TestTieredPromotesRemoteHits(t *testing.T) {
+	ctx := context.Background()
+	local := NewLocal(10, time.Minute)
+	remote := NewLocal(10, 0)
+	c := NewTiered(local, remote)
+
+	remote.Set(ctx, "search", []byte("results"), 24*time.Hour)
+	if got, ok, err := c.Get(ctx, "search"); !ok || err != nil || string(got) != "results" {
+		t.Fatalf("remote hit: %q, %v, %v", got, ok, err)
+	}
+	elem, ok := local.entries["search"]
+	if !ok {
+		t.Fatal("remote hit was not copied to the local tier")
+	}
+	if left := time.Until(elem.Value.(*localEntry).expires); left > time.Minute || left < time.Minute-time.Second {
+		t.Errorf("promoted entry expires in %v, want the local TTL", left)
+	}
+
+	// Later hits are served locally
+	remote.Delete(ctx, "search")
+	if _, ok, _ := c.Get(ctx, "search"); !ok {
+		t.Error("local copy was not used")
+	}
+	expire(local, "search")
+	if _, ok, _ := c.Get(ctx, "search"); ok {
+		t.Error("expired local copy was used")
+	}
+
+	if _, ok, _ := c.Get(ctx, "missing"); ok || local.Len() != 0 {
+		t.Errorf("remote miss: ok %v, %d local entries", ok, local.Len())
+	}
+
+	// Generations are the remote store's
+	gen, _ := c.IncrGeneration(ctx, "agent:a")
+	if remoteGen, _ := remote.Generation(ctx, "agent:a"); remoteGen != gen {
+		t.Errorf("tiered generation %d, remote %d", gen, remoteGen)
+	}
+	if len(local.generations) != 0 {
+		t.Errorf("local tier keeps generations %v", local.generations)
+	}
+}
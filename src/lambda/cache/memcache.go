@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// Memcache stores entries in memcached (e.g. ElastiCache)
+type Memcache struct {
+	client *memcache.Client
+}
+
+func NewMemcache(servers ...string) *Memcache {
+	mc := memcache.New(servers...)
+	mc.Timeout = 100 * time.Millisecond
+	mc.MaxIdleConns = 10
+
+	return &Memcache{
+		client: mc,
+	}
+}
+
+func (c *Memcache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	item, err := c.client.Get(key)
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return item.Value, true, nil
+}
+
+func (c *Memcache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.client.Set(&memcache.Item{
+		Key:        key,
+		Value:      value,
+		Expiration: expirationSeconds(ttl),
+	})
+}
+
+// expirationSeconds rounds ttl up to whole seconds. Memcached reads values
+// over 30 days as a unix timestamp, so longer TTLs are capped there.
+func expirationSeconds(ttl time.Duration) int32 {
+	const maxRelative = 30 * 24 * time.Hour
+	if ttl <= 0 {
+		return 0
+	}
+	if ttl > maxRelative {
+		ttl = maxRelative
+	}
+	return int32((ttl + time.Second - 1) / time.Second)
+}
+
+func (c *Memcache) Delete(ctx context.Context, key string) error {
+	err := c.client.Delete(key)
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return nil
+	}
+	return err
+}
+
+func (c *Memcache) Generation(ctx context.Context, namespace string) (uint64, error) {
+	key := generationKey(namespace)
+
+	item, err := c.client.Get(key)
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return c.seedGeneration(key)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(string(item.Value), 10, 64)
+}
+
+func (c *Memcache) IncrGeneration(ctx context.Context, namespace string) (uint64, error) {
+	key := generationKey(namespace)
+
+	gen, err := c.client.Increment(key, 1)
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		if _, err := c.seedGeneration(key); err != nil {
+			return 0, err
+		}
+		return c.client.Increment(key, 1)
+	}
+	return gen, err
+}
+
+// seedGeneration creates a missing counter, or reads the one a concurrent
+// caller created first
+func (c *Memcache) seedGeneration(key string) (uint64, error) {
+	gen := initialGeneration()
+	err := c.client.Add(&memcache.Item{Key: key, Value: []byte(strconv.FormatUint(gen, 10))})
+	if errors.Is(err, memcache.ErrNotStored) {
+		item, err := c.client.Get(key)
+		if err != nil {
+			return 0, err
+		}
+		return strconv.ParseUint(string(item.Value), 10, 64)
+	}
+	return gen, err
+}
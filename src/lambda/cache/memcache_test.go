@@ -0,0 +1,30 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpirationSeconds(t *testing.T) {
+	const month = 30 * 24 * time.Hour
+	tests := []struct {
+		ttl  time.Duration
+		want int32
+	}{
+		{0, 0},
+		{-time.Second, 0},
+		{time.Nanosecond, 1},
+		{time.Second, 1},
+		{1500 * time.Millisecond, 2},
+		{time.Hour, 3600},
+		{month, int32(month / time.Second)},
+		// Longer would be read as a unix timestamp in 1970
+		{month + time.Second, int32(month / time.Second)},
+		{365 * 24 * time.Hour, int32(month / time.Second)},
+	}
+	for _, tt := range tests {
+		if got := expirationSeconds(tt.ttl); got != tt.want {
+			t.Errorf("expirationSeconds(%v) = %d, want %d", tt.ttl, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis stores entries in a Redis server (e.g. ElastiCache for Redis)
+type Redis struct {
+	client *redis.Client
+}
+
+// NewRedis connects lazily to a redis:// or rediss:// url
+func NewRedis(url string) (*Redis, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	opts.DialTimeout = 100 * time.Millisecond
+	opts.ReadTimeout = 100 * time.Millisecond
+	opts.WriteTimeout = 100 * time.Millisecond
+
+	return &Redis{
+		client: redis.NewClient(opts),
+	}, nil
+}
+
+func (c *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := c.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (c *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if ttl < 0 {
+		ttl = 0
+	}
+	return c.client.Set(ctx, key, value, ttl).Err()
+}
+
+func (c *Redis) Delete(ctx context.Context, key string) error {
+	return c.client.Del(ctx, key).Err()
+}
+
+func (c *Redis) Generation(ctx context.Context, namespace string) (uint64, error) {
+	key := generationKey(namespace)
+
+	gen, err := c.client.Get(ctx, key).Uint64()
+	if errors.Is(err, redis.Nil) {
+		if err := c.client.SetNX(ctx, key, initialGeneration(), 0).Err(); err != nil {
+			return 0, err
+		}
+		return c.client.Get(ctx, key).Uint64()
+	}
+	return gen, err
+}
+
+func (c *Redis) IncrGeneration(ctx context.Context, namespace string) (uint64, error) {
+	key := generationKey(namespace)
+
+	// SETNX seeds a missing counter; INCR alone would restart it at 1
+	if err := c.client.SetNX(ctx, key, initialGeneration(), 0).Err(); err != nil {
+		return 0, err
+	}
+	gen, err := c.client.Incr(ctx, key).Result()
+	return uint64(gen), err
+}
+
+func (c *Redis) Close() error {
+	return c.client.Close()
+}
@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Store is a byte cache shared by Lambda invocations. Entries that depend
+// on an agent's data embed the agent's generation in their key; bumping the
+// generation with IncrGeneration orphans them all at once, which works the
+// same on backends that cannot list or delete by prefix.
+type Store interface {
+	// Get reports ok=false for a missing or expired key
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	// Set stores value for ttl; 0 keeps it until the backend evicts it
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+	// Generation returns the current generation of namespace
+	Generation(ctx context.Context, namespace string) (uint64, error)
+	// IncrGeneration advances namespace to a new generation and returns it
+	IncrGeneration(ctx context.Context, namespace string) (uint64, error)
+}
+
+// Open picks a Store from a CACHE_URL style address: memcached://host:port
+// (comma-separate several servers) or redis://[user:pass@]host:port/db.
+// An empty url disables caching and returns a nil Store.
+func Open(url string) (Store, error) {
+	switch {
+	case url == "":
+		return nil, nil
+	case strings.HasPrefix(url, "memcached://"):
+		servers := strings.Split(strings.TrimPrefix(url, "memcached://"), ",")
+		return NewMemcache(servers...), nil
+	case strings.HasPrefix(url, "redis://"), strings.HasPrefix(url, "rediss://"):
+		r, err := NewRedis(url)
+		if err != nil {
+			return nil, err
+		}
+		return r, nil
+	default:
+		return nil, fmt.Errorf("unsupported cache url %q: want memcached:// or redis://", url)
+	}
+}
+
+// Configure builds the Store for a Lambda: the remote cache at url (see
+// Open) fronted by an in-process LRU of localEntries entries, each kept at
+// most localTTL. With no url the LRU is used alone; localEntries <= 0 leaves
+// the remote cache (or nothing) on its own.
+func Configure(url string, localEntries int, localTTL time.Duration) (Store, error) {
+	remote, err := Open(url)
+	if err != nil {
+		return nil, err
+	}
+	if localEntries <= 0 {
+		return remote, nil
+	}
+
+	local := NewLocal(localEntries, localTTL)
+	if remote == nil {
+		return local, nil
+	}
+	return NewTiered(local, remote), nil
+}
+
+// generationKey holds namespace's counter, e.g. agent:{id}:gen
+func generationKey(namespace string) string {
+	return namespace + ":gen"
+}
+
+// initialGeneration seeds a namespace whose counter is missing. Starting
+// from the clock rather than 0 means a counter the backend evicted comes
+// back with values it never had before, so entries cached under the old
+// generations are never read again.
+func initialGeneration() uint64 {
+	return uint64(time.Now().UnixNano())
+}
+
+var (
+	_ Store = (*Memcache)(nil)
+	_ Store = (*Redis)(nil)
+	_ Store = (*Local)(nil)
+	_ Store = (*Tiered)(nil)
+)
@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Tiered checks a Local cache before a remote one and copies remote hits
+// into it. Generations always come from the remote store, so an
+// invalidation made by any container changes the keys every container
+// looks up, and the local tier never serves a result the remote one has
+// orphaned.
+type Tiered struct {
+	local  *Local
+	remote Store
+}
+
+func NewTiered(local *Local, remote Store) *Tiered {
+	return &Tiered{local: local, remote: remote}
+}
+
+func (c *Tiered) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	if value, ok, _ := c.local.Get(ctx, key); ok {
+		return value, true, nil
+	}
+
+	value, ok, err := c.remote.Get(ctx, key)
+	if ok {
+		c.local.Set(ctx, key, value, 0)
+	}
+	return value, ok, err
+}
+
+func (c *Tiered) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.local.Set(ctx, key, value, ttl)
+	return c.remote.Set(ctx, key, value, ttl)
+}
+
+func (c *Tiered) Delete(ctx context.Context, key string) error {
+	c.local.Delete(ctx, key)
+	return c.remote.Delete(ctx, key)
+}
+
+func (c *Tiered) Generation(ctx context.Context, namespace string) (uint64, error) {
+	return c.remote.Generation(ctx, namespace)
+}
+
+func (c *Tiered) IncrGeneration(ctx context.Context, namespace string) (uint64, error) {
+	return c.remote.IncrGeneration(ctx, namespace)
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const (
+	defaultAgentPageSize = 100
+	maxAgentPageSize     = 1000
+)
+
+type AgentDeleteRequest struct {
+	AgentID string `json:"agent_id"`
+	Confirm bool   `json:"confirm"`
+	DryRun  bool   `json:"dry_run"`
+}
+
+func (h *Handler) handleListAgents(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	limit := defaultAgentPageSize
+	if raw := request.QueryStringParameters["limit"]; raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			return errorResponse(400, "limit must be a positive integer")
+		}
+		limit = parsed
+	}
+	if limit > maxAgentPageSize {
+		limit = maxAgentPageSize
+	}
+
+	page, err := h.storage.ListAgents(request.QueryStringParameters["cursor"], limit)
+	if err != nil {
+		return errorResponse(500, fmt.Sprintf("list agents failed: %v", err))
+	}
+
+	return successResponse("list agents successful", page)
+}
+
+func (h *Handler) handleAgentDelete(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var req AgentDeleteRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return errorResponse(400, fmt.Sprintf("invalid request body: %v", err))
+	}
+
+	if req.AgentID == "" {
+		return errorResponse(400, "agent_id is required")
+	}
+
+	// agent IDs become file names on EFS and keys in S3
+	if strings.ContainsAny(req.AgentID, `/\`) || req.AgentID == "." || req.AgentID == ".." {
+		return errorResponse(400, "invalid agent_id")
+	}
+
+	if !req.Confirm && !req.DryRun {
+		return errorResponse(400, "confirm must be true to delete an agent (or set dry_run)")
+	}
+
+	result, err := h.storage.DeleteAgent(ctx, req.AgentID, req.DryRun)
+	if !req.DryRun {
+		h.invalidateAgent(ctx, req.AgentID)
+	}
+	if err != nil {
+		return errorResponse(500, fmt.Sprintf("agent delete failed: %v", err))
+	}
+
+	if req.DryRun {
+		return successResponse("agent delete dry run", result)
+	}
+	return successResponse("agent delete successful", result)
+}
+
+// handleFlush uploads every agent written since its last S3 sync, including
+// those SYNC_INTERVAL is holding back, e.g. before a deploy
+func (h *Handler) handleFlush(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	uploaded, err := h.storage.SyncDirty(ctx)
+	if err != nil {
+		return errorResponse(500, fmt.Sprintf("flush failed after %d uploads: %v", uploaded, err))
+	}
+
+	return successResponse("flush successful", map[string]interface{}{
+		"uploaded": uploaded,
+	})
+}
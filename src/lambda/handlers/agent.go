@@ -8,7 +8,6 @@ import (
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
 )
@@ -28,7 +27,7 @@ type CurationResult struct {
 	Reasoning string `json:"reasoning"`
 }
 
-func (h *Handler) handleAgentCurate(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+func (h *Handler) handleAgentCurate(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	var req AgentCurateRequest
 	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
 		return errorResponse(400, fmt.Sprintf("invalid request body: %v", err))
@@ -54,7 +53,8 @@ func (h *Handler) handleAgentCurate(request events.APIGatewayProxyRequest) (even
 		req.Timeout = 1000
 	}
 
-	memories, err := h.curateWithAgent(req)
+	memories, err := h.curateWithAgent(ctx, req)
+	h.invalidateAgent(ctx, req.AgentID)
 	if err != nil {
 		return errorResponse(500, fmt.Sprintf("curation failed: %v", err))
 	}
@@ -65,9 +65,7 @@ func (h *Handler) handleAgentCurate(request events.APIGatewayProxyRequest) (even
 	})
 }
 
-func (h *Handler) curateWithAgent(req AgentCurateRequest) ([]CurationResult, error) {
-	ctx := context.Background()
-
+func (h *Handler) curateWithAgent(ctx context.Context, req AgentCurateRequest) ([]CurationResult, error) {
 	systemPrompt := fmt.Sprintf(`You are a memory curation agent. Your task is to analyze text and extract discrete facts as structured memories.
 
 Importance Level: %s
@@ -89,12 +87,10 @@ Return ONLY valid JSON array, no markdown:
 
 	userPrompt := fmt.Sprintf("Analyze and extract memories from:\n\n%s", req.Text)
 
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(req.BedrockRegion))
-	if err != nil {
-		return nil, fmt.Errorf("failed to load AWS config: %w", err)
-	}
-
-	bedrock := bedrockruntime.NewFromConfig(cfg)
+	// Reuse the manager's credentials; only the region differs
+	bedrock := bedrockruntime.NewFromConfig(h.storage.AWSConfig(), func(o *bedrockruntime.Options) {
+		o.Region = req.BedrockRegion
+	})
 
 	input := &bedrockruntime.ConverseInput{
 		ModelId: aws.String(req.ModelID),
@@ -133,8 +129,15 @@ Return ONLY valid JSON array, no markdown:
 		return nil, fmt.Errorf("failed to parse LLM response as JSON: %w", err)
 	}
 
+	// All of the run's memories are stored or none are
+	batch, err := h.storage.Begin(ctx, req.AgentID)
+	if err != nil {
+		return nil, err
+	}
+	defer batch.Discard()
+
 	for i, result := range results {
-		if err := h.storage.Insert(req.AgentID, result.Key, result.Text); err != nil {
+		if err := batch.Insert(result.Key, result.Text); err != nil {
 			return nil, fmt.Errorf("failed to insert memory %d: %w", i, err)
 		}
 
@@ -143,5 +146,9 @@ Return ONLY valid JSON array, no markdown:
 		}
 	}
 
+	if err := h.storage.Commit(ctx, req.AgentID, batch); err != nil {
+		return nil, fmt.Errorf("failed to store memories: %w", err)
+	}
+
 	return results, nil
 }
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"Hippocampus/src/lambda/cache"
+	"Hippocampus/src/lambda/logging"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// searchCacheTTL bounds how long a search response can outlive a lost
+// invalidation
+const searchCacheTTL = 5 * time.Minute
+
+// SetCache enables caching of search responses; nil turns it off
+func (h *Handler) SetCache(store cache.Store) {
+	h.cache = store
+}
+
+func agentNamespace(agentID string) string {
+	return "agent:" + agentID
+}
+
+// searchCacheKey names the cached response for req under the agent's current
+// generation: agent:{id}:search:{gen}:{request hash}. Bumping the generation
+// leaves the old keys unreachable until their TTL expires them. It returns
+// "" when caching is off or unavailable.
+func (h *Handler) searchCacheKey(ctx context.Context, req SearchRequest) string {
+	if h.cache == nil {
+		return ""
+	}
+
+	gen, err := h.cache.Generation(ctx, agentNamespace(req.AgentID))
+	if err != nil {
+		h.warnCache(ctx, req.AgentID, "cache generation read failed", err)
+		return ""
+	}
+
+	encoded, err := json.Marshal(req)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%s:search:%d:%x", agentNamespace(req.AgentID), gen, sha256.Sum256(encoded))
+}
+
+func (h *Handler) cachedSearch(ctx context.Context, agentID, key string) (events.APIGatewayProxyResponse, bool) {
+	if key == "" {
+		return events.APIGatewayProxyResponse{}, false
+	}
+
+	body, ok, err := h.cache.Get(ctx, key)
+	if err != nil {
+		h.warnCache(ctx, agentID, "cache read failed", err)
+	}
+	if !ok {
+		return events.APIGatewayProxyResponse{}, false
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Body:       string(body),
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+		},
+	}, true
+}
+
+func (h *Handler) storeSearch(ctx context.Context, agentID, key string, resp events.APIGatewayProxyResponse) {
+	if key == "" || resp.StatusCode != 200 {
+		return
+	}
+	if err := h.cache.Set(ctx, key, []byte(resp.Body), searchCacheTTL); err != nil {
+		h.warnCache(ctx, agentID, "cache write failed", err)
+	}
+}
+
+// invalidateAgent orphans every cached search for agentID. Call it after
+// anything that may have changed the agent's memories, even on failure.
+func (h *Handler) invalidateAgent(ctx context.Context, agentID string) {
+	if h.cache == nil {
+		return
+	}
+	if _, err := h.cache.IncrGeneration(ctx, agentNamespace(agentID)); err != nil {
+		h.warnCache(ctx, agentID, "cache invalidation failed", err)
+	}
+}
+
+// warnCache logs a cache failure; requests carry on without the cache
+func (h *Handler) warnCache(ctx context.Context, agentID, msg string, err error) {
+	h.logger.Warn(ctx, msg, logging.Fields{
+		"agent_id": agentID,
+		"error":    err.Error(),
+	})
+}
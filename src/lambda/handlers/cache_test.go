@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"Hippocampus/src/embedding"
+	"Hippocampus/src/lambda/cache"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestWritesOrphanCachedSearches(t *testing.T) {
+	h, _ := newTestHandler(t, emptyS3{}, embedding.NewMockProvider(512))
+	store := cache.NewLocal(100, 0)
+	h.SetCache(store)
+
+	const search = `{"agent_id":"agent","text":"notes about cats","epsilon":2,"threshold":2,"max_distance":2,"top_k":10}`
+	var req SearchRequest
+	if err := json.Unmarshal([]byte(search), &req); err != nil {
+		t.Fatal(err)
+	}
+	req.SearchOptions = req.SearchOptions.WithDefaults()
+	found := func() int {
+		t.Helper()
+		status, resp := invoke(t, h, "POST", "/search", search)
+		if status != 200 {
+			t.Fatalf("search: status %d, %s", status, resp.Error)
+		}
+		results, _ := resp.Data.([]interface{})
+		return len(results)
+	}
+
+	if status, resp := invoke(t, h, "POST", "/insert", `{"agent_id":"agent","key":"k1","text":"first notes about cats"}`); status != 200 {
+		t.Fatalf("insert: status %d, %s", status, resp.Error)
+	}
+	if got := found(); got != 1 {
+		t.Fatalf("search found %d, want 1", got)
+	}
+	first := h.searchCacheKey(context.Background(), req)
+	if _, ok, _ := store.Get(context.Background(), first); !ok {
+		t.Fatalf("search response was not cached under %s", first)
+	}
+
+	// A repeated search is answered from the cache
+	store.Set(context.Background(), first, []byte(`{"message":"from the cache","data":[]}`), 0)
+	if got := found(); got != 0 {
+		t.Fatalf("repeated search found %d, want the cached response", got)
+	}
+
+	// An insert moves the agent to keys the old responses aren't under
+	if status, resp := invoke(t, h, "POST", "/insert", `{"agent_id":"agent","key":"k2","text":"second notes about cats"}`); status != 200 {
+		t.Fatalf("insert: status %d, %s", status, resp.Error)
+	}
+	second := h.searchCacheKey(context.Background(), req)
+	if second == first {
+		t.Fatal("insert left the search cache key unchanged")
+	}
+	if got := found(); got != 2 {
+		t.Errorf("search after an insert found %d, want both memories", got)
+	}
+
+	// and so does deleting the agent
+	if status, resp := invoke(t, h, "POST", "/agent-delete", `{"agent_id":"agent","confirm":true}`); status != 200 {
+		t.Fatalf("agent delete: status %d, %s", status, resp.Error)
+	}
+	if third := h.searchCacheKey(context.Background(), req); third == second || third == first {
+		t.Fatal("agent delete left the search cache key unchanged")
+	}
+	if got := found(); got != 0 {
+		t.Errorf("search after the agent was deleted found %d, want nothing", got)
+	}
+
+	// Other agents keep their cached responses
+	other := req
+	other.AgentID = "other"
+	key := h.searchCacheKey(context.Background(), other)
+	invoke(t, h, "POST", "/insert", `{"agent_id":"agent","key":"k3","text":"third notes about cats"}`)
+	if h.searchCacheKey(context.Background(), other) != key {
+		t.Error("insert for one agent changed another agent's cache key")
+	}
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// SetConfigEndpoint serves settings, plus what the handler itself knows, at
+// GET /config to requests with "Authorization: Bearer <token>". With no
+// token /config stays a 404. settings must hold nothing secret.
+func (h *Handler) SetConfigEndpoint(token string, settings map[string]interface{}) {
+	h.configToken = token
+	h.settings = settings
+}
+
+// handleConfig echoes the effective non-secret settings, for checking what
+// a deployment is actually running with
+func (h *Handler) handleConfig(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if h.configToken == "" {
+		return errorResponse(404, "unknown endpoint")
+	}
+	token, ok := strings.CutPrefix(requestHeader(request, "Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.configToken)) != 1 {
+		return errorResponse(401, "missing or invalid bearer token")
+	}
+
+	data := map[string]interface{}{
+		"region":            h.storage.GetRegion(),
+		"embedder":          h.embedder.Name(),
+		"latency_budget_ms": h.latencyBudget.Milliseconds(),
+		"max_candidates":    h.maxCandidates,
+		"search_timeout_ms": h.searchTimeout.Milliseconds(),
+		"max_body_bytes":    h.maxBodyBytes,
+		"rate_limited":      h.limiter != nil,
+		"search_cache":      h.cache != nil,
+	}
+	if dims, err := h.embedder.Dimensions(); err == nil {
+		data["embedder_dimensions"] = dims
+	}
+	for name, value := range h.settings {
+		data[name] = value
+	}
+
+	return successResponse("config", data)
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"Hippocampus/src/embedding"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestConfigEndpointNeedsToken(t *testing.T) {
+	h, _ := newTestHandler(t, emptyS3{}, embedding.NewMockProvider(512))
+
+	get := func(authorization string) (int, Response) {
+		t.Helper()
+		resp, err := h.Route(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: "GET",
+			Path:       "/config",
+			Headers:    map[string]string{"authorization": authorization},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded Response
+		if err := json.Unmarshal([]byte(resp.Body), &decoded); err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, decoded
+	}
+
+	if status, _ := get("Bearer anything"); status != 404 {
+		t.Fatalf("/config without a token configured: status %d, want 404", status)
+	}
+
+	h.SetConfigEndpoint("s3cret", map[string]interface{}{"embed_provider": "mock"})
+	for _, authorization := range []string{"", "s3cret", "Bearer wrong", "Basic s3cret"} {
+		if status, _ := get(authorization); status != 401 {
+			t.Errorf("Authorization %q: status %d, want 401", authorization, status)
+		}
+	}
+
+	status, resp := get("Bearer s3cret")
+	if status != 200 {
+		t.Fatalf("status %d, %s", status, resp.Error)
+	}
+	data := resp.Data.(map[string]interface{})
+	if data["embedder"] != "mock 512" || data["embedder_dimensions"] != 512.0 || data["embed_provider"] != "mock" {
+		t.Errorf("config %v, want the mock embedder and the given settings", data)
+	}
+}
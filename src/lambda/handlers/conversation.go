@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"Hippocampus/src/lambda/storage"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+// defaultConversationID is the conversation turns go to without one
+const defaultConversationID = "default"
+
+// conversationRoles are the roles a turn may have
+var conversationRoles = map[string]bool{"user": true, "assistant": true, "system": true}
+
+type ConversationRequest struct {
+	AgentID        string `json:"agent_id"`
+	ConversationID string `json:"conversation_id"`
+	Role           string `json:"role"`
+	Text           string `json:"text"`
+	MaxTurns       int    `json:"max_turns"` // turns kept verbatim before summarizing; 0 is the default
+	ModelID        string `json:"model_id"`
+	BedrockRegion  string `json:"bedrock_region"`
+}
+
+// BedrockConverser is the Bedrock call conversation summaries make, so tests
+// can stand in for Bedrock
+type BedrockConverser interface {
+	Converse(ctx context.Context, input *bedrockruntime.ConverseInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.ConverseOutput, error)
+}
+
+// SetConverser replaces how a Bedrock client is made for a region, such as
+// with a fake in tests
+func (h *Handler) SetConverser(newConverser func(region string) BedrockConverser) {
+	h.newConverser = newConverser
+}
+
+// converser is a Bedrock client for region on the manager's AWS config
+func (h *Handler) converser(region string) BedrockConverser {
+	if h.newConverser != nil {
+		return h.newConverser(region)
+	}
+	return bedrockruntime.NewFromConfig(h.storage.AWSConfig(), func(o *bedrockruntime.Options) {
+		o.Region = region
+	})
+}
+
+func (h *Handler) handleConversation(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var req ConversationRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return errorResponse(400, fmt.Sprintf("invalid request body: %v", err))
+	}
+
+	if req.AgentID == "" || req.Role == "" || req.Text == "" {
+		return errorResponse(400, "agent_id, role, and text are required")
+	}
+	req.Role = strings.ToLower(req.Role)
+	if !conversationRoles[req.Role] {
+		return errorResponse(400, "role must be user, assistant or system")
+	}
+	if req.MaxTurns < 0 {
+		return errorResponse(400, "max_turns must not be negative")
+	}
+
+	if req.ConversationID == "" {
+		req.ConversationID = defaultConversationID
+	}
+	if req.ModelID == "" {
+		req.ModelID = "us.amazon.nova-lite-v1:0"
+	}
+	if req.BedrockRegion == "" {
+		req.BedrockRegion = "us-east-1"
+	}
+
+	summarizer := &bedrockSummarizer{bedrock: h.converser(req.BedrockRegion), modelID: req.ModelID}
+	footprint, err := h.storage.AppendTurn(ctx, req.AgentID, req.ConversationID, req.Role, req.Text, req.MaxTurns, summarizer)
+	h.invalidateAgent(ctx, req.AgentID)
+	if err != nil {
+		return errorResponse(500, fmt.Sprintf("conversation append failed: %v", err))
+	}
+
+	return successResponse("conversation turn stored", footprint)
+}
+
+// bedrockSummarizer condenses conversation turns with a Bedrock model
+type bedrockSummarizer struct {
+	bedrock BedrockConverser
+	modelID string
+}
+
+func (s *bedrockSummarizer) Summarize(ctx context.Context, turns []storage.ConversationTurn) (string, error) {
+	systemPrompt := `You maintain the long-term memory of a chat agent. Summarize the conversation excerpt you are given into one compact memory.
+
+Guidelines:
+- Keep facts, preferences, decisions and open questions, attributed to the user or the assistant
+- Drop greetings, filler and anything repeated
+- Write plain prose in the third person, no markdown, at most 150 words`
+
+	var transcript strings.Builder
+	for _, turn := range turns {
+		fmt.Fprintf(&transcript, "[%d] %s: %s\n", turn.Index, turn.Role, turn.Text)
+	}
+
+	response, err := s.bedrock.Converse(ctx, &bedrockruntime.ConverseInput{
+		ModelId: aws.String(s.modelID),
+		Messages: []types.Message{
+			{
+				Role: types.ConversationRoleUser,
+				Content: []types.ContentBlock{
+					&types.ContentBlockMemberText{
+						Value: "Summarize this conversation excerpt:\n\n" + transcript.String(),
+					},
+				},
+			},
+		},
+		System: []types.SystemContentBlock{
+			&types.SystemContentBlockMemberText{
+				Value: systemPrompt,
+			},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("bedrock converse failed: %w", err)
+	}
+
+	message, ok := response.Output.(*types.ConverseOutputMemberMessage)
+	if !ok {
+		return "", fmt.Errorf("bedrock returned no message")
+	}
+	for _, block := range message.Value.Content {
+		if textBlock, ok := block.(*types.ContentBlockMemberText); ok && strings.TrimSpace(textBlock.Value) != "" {
+			return strings.TrimSpace(textBlock.Value), nil
+		}
+	}
+	return "", fmt.Errorf("bedrock returned an empty summary")
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"Hippocampus/src/embedding"
+	"Hippocampus/src/lambda/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+// fakeConverser answers every Converse with summary, or fails with err,
+// recording the prompts it was sent
+type fakeConverser struct {
+	summary string
+	err     error
+	prompts []string
+}
+
+func (f *fakeConverser) Converse(ctx context.Context, input *bedrockruntime.ConverseInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.ConverseOutput, error) {
+	f.prompts = append(f.prompts, input.Messages[0].Content[0].(*types.ContentBlockMemberText).Value)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &bedrockruntime.ConverseOutput{
+		Output: &types.ConverseOutputMemberMessage{Value: types.Message{
+			Role:    types.ConversationRoleAssistant,
+			Content: []types.ContentBlock{&types.ContentBlockMemberText{Value: f.summary}},
+		}},
+	}, nil
+}
+
+// newConversationHandler is a test handler whose summaries come from bedrock
+func newConversationHandler(t *testing.T, bedrock *fakeConverser) *Handler {
+	t.Helper()
+	h, _ := newTestHandler(t, emptyS3{}, embedding.NewMockProvider(512))
+	h.SetConverser(func(region string) BedrockConverser { return bedrock })
+	return h
+}
+
+// appendTurn posts a turn and decodes the footprint it returns
+func appendTurn(t *testing.T, h *Handler, body string) (int, Response, storage.ConversationFootprint) {
+	t.Helper()
+	status, resp := invoke(t, h, "POST", "/conversation", body)
+	var footprint storage.ConversationFootprint
+	if resp.Data != nil {
+		raw, _ := json.Marshal(resp.Data)
+		if err := json.Unmarshal(raw, &footprint); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return status, resp, footprint
+}
+
+func TestConversationSummarizesOldestTurns(t *testing.T) {
+	bedrock := &fakeConverser{summary: "The user likes tea; the assistant suggested green tea."}
+	h := newConversationHandler(t, bedrock)
+
+	turns := []string{
+		`{"agent_id":"agent","conversation_id":"chat","role":"user","text":"I like tea","max_turns":2}`,
+		`{"agent_id":"agent","conversation_id":"chat","role":"Assistant","text":"Try green tea","max_turns":2}`,
+	}
+	for i, body := range turns {
+		status, resp, footprint := appendTurn(t, h, body)
+		if status != 200 {
+			t.Fatalf("turn %d: status %d, %s", i, status, resp.Error)
+		}
+		want := storage.ConversationFootprint{ConversationID: "chat", Turn: i, TurnsStored: i + 1}
+		if footprint != want {
+			t.Fatalf("turn %d: footprint %+v, want %+v", i, footprint, want)
+		}
+	}
+	if len(bedrock.prompts) != 0 {
+		t.Fatalf("summarized %d times within max_turns", len(bedrock.prompts))
+	}
+
+	// The third turn is past max_turns, so all but the newest max_turns/2 go
+	status, resp, footprint := appendTurn(t, h, `{"agent_id":"agent","conversation_id":"chat","role":"user","text":"Thanks","max_turns":2}`)
+	if status != 200 {
+		t.Fatalf("third turn: status %d, %s", status, resp.Error)
+	}
+	want := storage.ConversationFootprint{ConversationID: "chat", Turn: 2, TurnsStored: 1, SummariesCreated: 1, Summarized: 2}
+	if footprint != want {
+		t.Fatalf("third turn: footprint %+v, want %+v", footprint, want)
+	}
+	if len(bedrock.prompts) != 1 {
+		t.Fatalf("summarized %d times, want once", len(bedrock.prompts))
+	}
+	prompt := bedrock.prompts[0]
+	if !strings.Contains(prompt, "[0] user: I like tea") || !strings.Contains(prompt, "[1] assistant: Try green tea") || strings.Contains(prompt, "Thanks") {
+		t.Errorf("summary prompt %q, want the two oldest turns only", prompt)
+	}
+
+	// Turns go to the default conversation without an ID and are numbered apart
+	_, _, footprint = appendTurn(t, h, `{"agent_id":"agent","role":"system","text":"be brief"}`)
+	if footprint.ConversationID != defaultConversationID || footprint.Turn != 0 || footprint.SummariesCreated != 0 {
+		t.Errorf("turn without a conversation ID: footprint %+v", footprint)
+	}
+}
+
+func TestConversationRejectsBadRequests(t *testing.T) {
+	bedrock := &fakeConverser{summary: "unused"}
+	h := newConversationHandler(t, bedrock)
+
+	for name, body := range map[string]string{
+		"missing agent_id": `{"role":"user","text":"hello"}`,
+		"missing role":     `{"agent_id":"agent","text":"hello"}`,
+		"missing text":     `{"agent_id":"agent","role":"user"}`,
+		"unknown role":     `{"agent_id":"agent","role":"narrator","text":"hello"}`,
+		"negative max":     `{"agent_id":"agent","role":"user","text":"hello","max_turns":-1}`,
+		"malformed body":   `{"agent_id":`,
+	} {
+		status, resp := invoke(t, h, "POST", "/conversation", body)
+		if status != 400 || resp.Error == "" {
+			t.Errorf("%s: status %d, error %q; want 400 with an error", name, status, resp.Error)
+		}
+	}
+	if status, resp := invoke(t, h, "POST", "/conversation", `{"role":"user","text":"hello"}`); !strings.Contains(resp.Error, "agent_id") {
+		t.Errorf("missing agent_id: status %d, error %q; want it named", status, resp.Error)
+	}
+}
+
+func TestConversationSummaryFailureKeepsTurn(t *testing.T) {
+	bedrock := &fakeConverser{err: errors.New("throttled")}
+	h := newConversationHandler(t, bedrock)
+
+	body := `{"agent_id":"agent","role":"user","text":"remember this","max_turns":1}`
+	if status, resp, _ := appendTurn(t, h, body); status != 200 {
+		t.Fatalf("first turn: status %d, %s", status, resp.Error)
+	}
+	status, resp, _ := appendTurn(t, h, body)
+	if status != 500 || !strings.Contains(resp.Error, "throttled") {
+		t.Fatalf("failed summary: status %d, error %q; want 500 naming the Bedrock error", status, resp.Error)
+	}
+
+	// Both turns are still stored, so the next attempt summarizes all three
+	bedrock.err, bedrock.summary = nil, "The user asked three times to remember this."
+	status, resp, footprint := appendTurn(t, h, body)
+	if status != 200 {
+		t.Fatalf("retry: status %d, %s", status, resp.Error)
+	}
+	if footprint.Turn != 2 || footprint.Summarized != 3 || footprint.TurnsStored != 0 || footprint.SummariesCreated != 1 {
+		t.Errorf("retry footprint %+v, want turns 0-2 summarized", footprint)
+	}
+}
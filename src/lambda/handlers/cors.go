@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const (
+	defaultCORSMethods = "GET, POST, OPTIONS"
+	defaultCORSHeaders = "Content-Type, Authorization"
+)
+
+// CORSConfig controls which browser origins may call the API.
+// An empty AllowedOrigins list denies every cross-origin request.
+type CORSConfig struct {
+	AllowedOrigins []string
+	AllowedMethods string
+	AllowedHeaders string
+}
+
+// NewCORSConfig builds a config from comma-separated env values, filling in default methods and headers
+func NewCORSConfig(origins, methods, headers string) CORSConfig {
+	cfg := CORSConfig{
+		AllowedMethods: methods,
+		AllowedHeaders: headers,
+	}
+
+	for _, origin := range strings.Split(origins, ",") {
+		origin = strings.TrimSpace(origin)
+		if origin != "" {
+			cfg.AllowedOrigins = append(cfg.AllowedOrigins, origin)
+		}
+	}
+
+	if cfg.AllowedMethods == "" {
+		cfg.AllowedMethods = defaultCORSMethods
+	}
+	if cfg.AllowedHeaders == "" {
+		cfg.AllowedHeaders = defaultCORSHeaders
+	}
+
+	return cfg
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for origin, or "" if it is not allowed
+func (c CORSConfig) allowOrigin(origin string) string {
+	if origin == "" {
+		return ""
+	}
+
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" {
+			return "*"
+		}
+		if strings.EqualFold(allowed, origin) {
+			return origin
+		}
+	}
+
+	return ""
+}
+
+func (h *Handler) SetCORS(cfg CORSConfig) {
+	h.cors = cfg
+}
+
+// handlePreflight answers OPTIONS requests for any route
+func (h *Handler) handlePreflight(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if h.cors.allowOrigin(requestHeader(request, "Origin")) == "" {
+		return errorResponse(403, "origin not allowed")
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: 204,
+		Headers: map[string]string{
+			"Access-Control-Max-Age": "600",
+		},
+	}, nil
+}
+
+// withCORS adds CORS headers to every response leaving Route, success or error
+func (h *Handler) withCORS(request events.APIGatewayProxyRequest, resp events.APIGatewayProxyResponse) events.APIGatewayProxyResponse {
+	allowed := h.cors.allowOrigin(requestHeader(request, "Origin"))
+	if allowed == "" {
+		return resp
+	}
+
+	if resp.Headers == nil {
+		resp.Headers = map[string]string{}
+	}
+
+	resp.Headers["Access-Control-Allow-Origin"] = allowed
+	resp.Headers["Access-Control-Allow-Methods"] = h.cors.AllowedMethods
+	resp.Headers["Access-Control-Allow-Headers"] = h.cors.AllowedHeaders
+	if allowed != "*" {
+		resp.Headers["Vary"] = "Origin"
+	}
+
+	return resp
+}
+
+// requestHeader looks up a header case-insensitively (HTTP APIs lowercase header names)
+func requestHeader(request events.APIGatewayProxyRequest, name string) string {
+	if value, ok := request.Headers[name]; ok {
+		return value
+	}
+
+	for key, value := range request.Headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"Hippocampus/src/embedding"
+	hippostorage "Hippocampus/src/storage"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const testOrigin = "https://app.example.com"
+
+// emptyS3 is an S3API with no objects in it
+type emptyS3 struct{}
+
+func (emptyS3) Download(ctx context.Context, bucket, key, ifNoneMatch string, w io.WriterAt) (string, error) {
+	return "", hippostorage.ErrObjectNotFound
+}
+
+func (emptyS3) PutObject(ctx context.Context, bucket, key string, body io.Reader) (string, error) {
+	return "etag", nil
+}
+
+func (emptyS3) HeadObject(ctx context.Context, bucket, key string) (int64, error) {
+	return 0, hippostorage.ErrObjectNotFound
+}
+
+func (emptyS3) DeleteObject(ctx context.Context, bucket, key string) error {
+	return nil
+}
+
+func (emptyS3) ListObjects(ctx context.Context, bucket, prefix string, fn func(key string, size int64)) error {
+	return nil
+}
+
+// newCORSServer serves h's Route over HTTP the way API Gateway calls it,
+// with agents stored in a temporary directory and embedded by embedder
+func newCORSServer(t *testing.T, embedder *embedding.MockProvider) *httptest.Server {
+	t.Helper()
+	h, _ := newTestHandler(t, emptyS3{}, embedder)
+	h.SetCORS(NewCORSConfig(testOrigin, "", ""))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		request := events.APIGatewayProxyRequest{
+			HTTPMethod: r.Method,
+			Path:       r.URL.Path,
+			Headers:    make(map[string]string),
+			Body:       string(body),
+		}
+		for name := range r.Header {
+			request.Headers[name] = r.Header.Get(name)
+		}
+
+		resp, err := h.Route(r.Context(), request)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		for name, value := range resp.Headers {
+			w.Header().Set(name, value)
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.WriteString(w, resp.Body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func postFrom(t *testing.T, url, origin, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp
+}
+
+func TestCORSHeadersOnEveryStatus(t *testing.T) {
+	embedder := embedding.NewMockProvider(512)
+	server := newCORSServer(t, embedder)
+
+	cases := []struct {
+		name   string
+		body   string
+		fail   bool // the embedder fails the request
+		status int
+	}{
+		{name: "success", body: `{"agent_id":"agent","key":"k","text":"a memory"}`, status: http.StatusOK},
+		{name: "bad request", body: `{"agent_id":`, status: http.StatusBadRequest},
+		{name: "server error", body: `{"agent_id":"agent","key":"k2","text":"another"}`, fail: true, status: http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.fail {
+				embedder.FailNext(1, errors.New("embedder down"))
+			}
+			resp := postFrom(t, server.URL+"/insert", testOrigin, tc.body)
+			if resp.StatusCode != tc.status {
+				t.Fatalf("status %d, want %d", resp.StatusCode, tc.status)
+			}
+
+			want := map[string]string{
+				"Access-Control-Allow-Origin":  testOrigin,
+				"Access-Control-Allow-Methods": defaultCORSMethods,
+				"Access-Control-Allow-Headers": defaultCORSHeaders,
+				"Vary":                         "Origin",
+			}
+			for name, value := range want {
+				if got := resp.Header.Get(name); got != value {
+					t.Errorf("%s = %q, want %q", name, got, value)
+				}
+			}
+		})
+	}
+}
+
+func TestCORSHeadersWithheldFromOtherOrigins(t *testing.T) {
+	server := newCORSServer(t, embedding.NewMockProvider(512))
+
+	for _, origin := range []string{"", "https://elsewhere.example.com"} {
+		resp := postFrom(t, server.URL+"/insert", origin, `{"agent_id":`)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("origin %q: status %d, want 400", origin, resp.StatusCode)
+		}
+		if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "" {
+			t.Errorf("origin %q: Access-Control-Allow-Origin = %q", origin, got)
+		}
+	}
+}
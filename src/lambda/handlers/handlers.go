@@ -4,30 +4,97 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
+	"Hippocampus/src/client"
+	"Hippocampus/src/embedding"
+	"Hippocampus/src/lambda/cache"
+	"Hippocampus/src/lambda/logging"
 	"Hippocampus/src/lambda/storage"
+	"Hippocampus/src/ratelimit"
+	"Hippocampus/src/types"
 
 	"github.com/aws/aws-lambda-go/events"
 )
 
 type Handler struct {
-	storage *storage.Manager
+	storage       *storage.Manager
+	cache         cache.Store // nil disables search caching
+	cors          CORSConfig
+	logger        logging.Logger
+	latencyBudget time.Duration
+	maxCandidates int
+	searchTimeout time.Duration
+	limiter       ratelimit.Limiter // nil disables throttling
+	maxBodyBytes  int
+	embedder      embedding.EmbeddingProvider // the agents' embedder, reported by /config
+	configToken   string                      // empty disables /config
+	settings      map[string]interface{}
+	newConverser  func(region string) BedrockConverser // nil uses Bedrock on the manager's AWS config
 }
 
-func New(storageManager *storage.Manager, _ interface{}) *Handler {
+func New(storageManager *storage.Manager, store cache.Store, embedder embedding.EmbeddingProvider) *Handler {
 	return &Handler{
-		storage: storageManager,
+		storage:       storageManager,
+		cache:         store,
+		embedder:      embedder,
+		logger:        logging.Default(),
+		latencyBudget: defaultLatencyBudget,
+		maxCandidates: types.DefaultMaxCandidates,
+		searchTimeout: types.DefaultSearchTimeout,
+		maxBodyBytes:  ratelimit.DefaultMaxBodyBytes,
 	}
 }
 
+// SetSearchLimits bounds the candidates a search scores and how long it may
+// run before it returns what it has, marked truncated; 0 removes a limit
+func (h *Handler) SetSearchLimits(maxCandidates int, timeout time.Duration) {
+	h.maxCandidates = maxCandidates
+	h.searchTimeout = timeout
+}
+
 
 func (h *Handler) Route(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	start := time.Now()
+	ctx = logging.WithRequestID(ctx, requestID(ctx, request))
+
+	resp, ok := h.admit(request)
+	var err error
+	if ok {
+		resp, err = h.route(ctx, request)
+	}
+
+	// Lambda may freeze the container as soon as Route returns, so agents
+	// this invocation wrote are uploaded now. Failures are logged by the
+	// upload and the agents stay dirty for the next invocation.
+	h.storage.SyncDue(ctx)
+
+	h.logRequest(ctx, request, resp, err, time.Since(start))
+
+	return h.withCORS(request, resp), err
+}
+
+func (h *Handler) route(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if request.HTTPMethod == "OPTIONS" {
+		return h.handlePreflight(request)
+	}
+
 	switch request.Path {
 	case "/":
 		if request.HTTPMethod != "GET" {
 			return errorResponse(400, "only GET method is supported for /")
 		}
 		return h.HandleUI(ctx, request)
+	case "/agents":
+		if request.HTTPMethod != "GET" {
+			return errorResponse(400, "only GET method is supported for /agents")
+		}
+		return h.handleListAgents(ctx, request)
+	case "/config":
+		if request.HTTPMethod != "GET" {
+			return errorResponse(400, "only GET method is supported for /config")
+		}
+		return h.handleConfig(ctx, request)
 	default:
 		if request.HTTPMethod != "POST" {
 			return errorResponse(400, "only POST method is supported")
@@ -35,15 +102,21 @@ func (h *Handler) Route(ctx context.Context, request events.APIGatewayProxyReque
 		
 		switch request.Path {
 		case "/insert":
-			return h.handleInsert(request)
+			return h.handleInsert(ctx, request)
 		case "/search":
-			return h.handleSearch(request)
+			return h.handleSearch(ctx, request)
 		case "/insert-csv":
-			return h.handleInsertCSV(request)
+			return h.handleInsertCSV(ctx, request)
 		case "/agent-curate":
-			return h.handleAgentCurate(request)
+			return h.handleAgentCurate(ctx, request)
 		case "/agent-safety":
 			return h.HandleSafetyAgent(request)
+		case "/agent-delete":
+			return h.handleAgentDelete(ctx, request)
+		case "/conversation":
+			return h.handleConversation(ctx, request)
+		case "/flush":
+			return h.handleFlush(ctx, request)
 		default:
 			return errorResponse(404, "unknown endpoint")
 		}
@@ -53,7 +126,7 @@ func (h *Handler) Route(ctx context.Context, request events.APIGatewayProxyReque
 
 
 
-func (h *Handler) handleInsert(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+func (h *Handler) handleInsert(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	var req InsertRequest
 	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
 		return errorResponse(400, fmt.Sprintf("invalid request body: %v", err))
@@ -63,14 +136,26 @@ func (h *Handler) handleInsert(request events.APIGatewayProxyRequest) (events.AP
 		return errorResponse(400, "agent_id, key, and text are required")
 	}
 
-	if err := h.storage.Insert(req.AgentID, req.Key, req.Text); err != nil {
+	policy, err := client.ParseConflictPolicy(req.OnConflict)
+	if err != nil {
+		return errorResponse(400, err.Error())
+	}
+
+	result, stats, err := h.storage.Upsert(ctx, req.AgentID, req.Key, req.Text, policy)
+	if result.Outcome != client.UpsertSkipped {
+		h.invalidateAgent(ctx, req.AgentID)
+	}
+	if err != nil {
 		return errorResponse(500, fmt.Sprintf("insert failed: %v", err))
 	}
 
-	return successResponse("insert successful", nil)
+	if req.Debug {
+		return statsResponse("insert successful", result, stats)
+	}
+	return successResponse("insert successful", result)
 }
 
-func (h *Handler) handleSearch(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+func (h *Handler) handleSearch(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	var req SearchRequest
 	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
 		return errorResponse(400, fmt.Sprintf("invalid request body: %v", err))
@@ -80,25 +165,105 @@ func (h *Handler) handleSearch(request events.APIGatewayProxyRequest) (events.AP
 		return errorResponse(400, "agent_id and text are required")
 	}
 	
-	if req.Epsilon == 0 {
-		req.Epsilon = 0.3
+	if req.MinScoreOverridesThreshold() {
+		h.logger.Warn(ctx, "min_score overrides threshold", logging.Fields{
+			"agent_id":  req.AgentID,
+			"min_score": req.MinScore,
+			"threshold": req.Threshold,
+		})
 	}
-	if req.Threshold == 0 {
-		req.Threshold = 0.5
+	req.SearchOptions = req.SearchOptions.WithDefaults()
+	opts := req.SearchOptions
+	filter, err := types.FilterFromJSON(req.Filter)
+	if err != nil {
+		return errorResponse(400, fmt.Sprintf("invalid filter: %v", err))
 	}
-	if req.TopK == 0 {
-		req.TopK = 5
+	opts.Filter = filter
+	if err := opts.Validate(); err != nil {
+		return errorResponse(400, err.Error())
 	}
-	
-	results, err := h.storage.Search(req.AgentID, req.Text, req.Epsilon, req.Threshold, req.TopK)
+	opts.MaxCandidates = h.maxCandidates
+	if h.searchTimeout > 0 {
+		opts.Deadline = time.Now().Add(h.searchTimeout)
+	}
+
+	// Debug and explain requests want the timings and counters of a real
+	// search, and tracked searches must reach the tree to count
+	if req.Debug || req.Explain || req.TrackAccess {
+		if req.Explain {
+			opts.Explanation = &types.ExplainReport{}
+		}
+		opts.Hint = req.Debug
+		resp, _, err := h.search(ctx, req, opts)
+		return resp, err
+	}
+
+	cacheKey := h.searchCacheKey(ctx, req)
+	if resp, ok := h.cachedSearch(ctx, req.AgentID, cacheKey); ok {
+		return resp, nil
+	}
+
+	// A truncated search may do better next time, so it is not cached
+	resp, truncated, err := h.search(ctx, req, opts)
+	if err == nil && !truncated {
+		h.storeSearch(ctx, req.AgentID, cacheKey, resp)
+	}
+	return resp, err
+}
+
+// search runs the search and reports whether the search limits cut it short
+func (h *Handler) search(ctx context.Context, req SearchRequest, opts types.SearchOptions) (events.APIGatewayProxyResponse, bool, error) {
+	if req.Detailed {
+		return h.handleSearchDetailed(ctx, req, opts)
+	}
+
+	results, stats, err := h.storage.SearchOpts(ctx, req.AgentID, req.Text, opts)
 	if err != nil {
-		return errorResponse(500, fmt.Sprintf("search failed: %v", err))
+		resp, err := errorResponse(500, fmt.Sprintf("search failed: %v", err))
+		return resp, false, err
+	}
+
+	values := make([]string, len(results))
+	for i, result := range results {
+		values[i] = result.Text
 	}
 	
-	return successResponse("search successful", results)
+	resp, err := searchResponse(values, stats, req.Debug, opts.Explanation)
+	return resp, stats.Truncated, err
 }
 
-func (h *Handler) handleInsertCSV(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+func (h *Handler) handleSearchDetailed(ctx context.Context, req SearchRequest, opts types.SearchOptions) (events.APIGatewayProxyResponse, bool, error) {
+	results, stats, err := h.storage.SearchOpts(ctx, req.AgentID, req.Text, opts)
+	if err != nil {
+		resp, err := errorResponse(500, fmt.Sprintf("search failed: %v", err))
+		return resp, false, err
+	}
+
+	items := make([]SearchResultItem, len(results))
+	for i, result := range results {
+		items[i] = SearchResultItem{
+			Key:        result.Metadata[client.NodeIDKey],
+			Text:       result.Text,
+			Similarity: result.Similarity,
+			Group:      result.Group,
+			Collapsed:  result.Collapsed,
+		}
+		if ts, err := time.Parse(time.RFC3339Nano, result.Metadata[types.TimestampKey]); err == nil {
+			items[i].Timestamp = ts.Format(time.RFC3339)
+		}
+		if len(result.Metadata) > 0 {
+			items[i].Metadata = make(map[string]interface{}, len(result.Metadata))
+			for k, v := range result.Metadata {
+				items[i].Metadata[k] = v
+			}
+		}
+	}
+
+	resp, err := searchResponse(items, stats, req.Debug, opts.Explanation)
+	return resp, stats.Truncated, err
+}
+
+func (h *Handler) handleInsertCSV(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	var req InsertCSVRequest
 	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
 		return errorResponse(400, fmt.Sprintf("invalid request body: %v", err))
@@ -108,7 +273,9 @@ func (h *Handler) handleInsertCSV(request events.APIGatewayProxyRequest) (events
 		return errorResponse(400, "agent_id and csv_file are required")
 	}
 
-	if err := h.storage.InsertCSV(req.AgentID, req.CSVFile); err != nil {
+	err := h.storage.InsertCSV(ctx, req.AgentID, req.CSVFile)
+	h.invalidateAgent(ctx, req.AgentID)
+	if err != nil {
 		return errorResponse(500, fmt.Sprintf("insert-csv failed: %v", err))
 	}
 
@@ -116,10 +283,39 @@ func (h *Handler) handleInsertCSV(request events.APIGatewayProxyRequest) (events
 }
 
 func successResponse(message string, data interface{}) (events.APIGatewayProxyResponse, error) {
-	resp := Response{
+	return jsonResponse(Response{
+		Message: message,
+		Data:    data,
+	})
+}
+
+// statsResponse is successResponse for debug requests, carrying the
+// operation's stats
+func statsResponse(message string, data interface{}, stats client.OperationStats) (events.APIGatewayProxyResponse, error) {
+	return jsonResponse(Response{
 		Message: message,
 		Data:    data,
+		Stats:   &stats,
+	})
+}
+
+// searchResponse is successResponse for a search, flagging results that the
+// search limits truncated and carrying the stats for debug requests
+func searchResponse(data interface{}, stats client.OperationStats, debug bool, explain *types.ExplainReport) (events.APIGatewayProxyResponse, error) {
+	resp := Response{
+		Message:   "search successful",
+		Data:      data,
+		Truncated: stats.Truncated,
+		Explain:   explain,
 	}
+	if debug {
+		resp.Stats = &stats
+		resp.Hint = stats.Hint
+	}
+	return jsonResponse(resp)
+}
+
+func jsonResponse(resp Response) (events.APIGatewayProxyResponse, error) {
 	body, _ := json.Marshal(resp)
 	return events.APIGatewayProxyResponse{
 		StatusCode: 200,
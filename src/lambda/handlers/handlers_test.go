@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"Hippocampus/src/embedding"
+	"Hippocampus/src/lambda/logging"
+	"Hippocampus/src/lambda/storage"
+	hippostorage "Hippocampus/src/storage"
+	"Hippocampus/src/types"
+	"context"
+	"encoding/json"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// countingS3 is emptyS3 counting the uploads it is sent
+type countingS3 struct {
+	emptyS3
+	puts atomic.Int32
+}
+
+func (c *countingS3) PutObject(ctx context.Context, bucket, key string, body io.Reader) (string, error) {
+	c.puts.Add(1)
+	return "etag", nil
+}
+
+// newTestHandler is a handler over agents stored in a temporary directory,
+// backed up to s3 and embedded by embedder, with logging discarded
+func newTestHandler(t *testing.T, s3 hippostorage.S3API, embedder embedding.EmbeddingProvider) (*Handler, *storage.Manager) {
+	t.Helper()
+	manager, err := storage.NewManagerWithConfig(t.TempDir(), aws.Config{Region: "us-east-1"}, storage.NewS3SyncWithAPI("bucket", s3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logging.NewJSON(io.Discard)
+	manager.SetLogger(logger)
+	manager.SetEmbedder(embedder)
+
+	h := New(manager, nil, embedder)
+	h.SetLogger(logger)
+	return h, manager
+}
+
+// invoke calls Route the way API Gateway does and decodes the response body
+func invoke(t *testing.T, h *Handler, method, path, body string) (int, Response) {
+	t.Helper()
+	resp, err := h.Route(context.Background(), events.APIGatewayProxyRequest{
+		HTTPMethod: method,
+		Path:       path,
+		Headers:    map[string]string{},
+		Body:       body,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Response
+	if err := json.Unmarshal([]byte(resp.Body), &decoded); err != nil {
+		t.Fatalf("%s %s: undecodable body %q: %v", method, path, resp.Body, err)
+	}
+	return resp.StatusCode, decoded
+}
+
+func TestRouteUploadsWritesBeforeReturning(t *testing.T) {
+	s3 := &countingS3{}
+	h, manager := newTestHandler(t, s3, embedding.NewMockProvider(512))
+
+	if status, resp := invoke(t, h, "POST", "/insert", `{"agent_id":"agent","key":"k1","text":"first"}`); status != 200 {
+		t.Fatalf("insert: status %d, %s", status, resp.Error)
+	}
+	if got := s3.puts.Load(); got != 1 {
+		t.Fatalf("%d uploads after the insert returned, want 1", got)
+	}
+
+	// Searches write nothing, so nothing is uploaded
+	invoke(t, h, "POST", "/search", `{"agent_id":"agent","text":"first"}`)
+	if got := s3.puts.Load(); got != 1 {
+		t.Fatalf("%d uploads after a search, want still 1", got)
+	}
+
+	// Inside the sync interval writes wait, and /flush sends them
+	manager.SetSyncInterval(time.Hour)
+	for _, key := range []string{"k2", "k3", "k4"} {
+		invoke(t, h, "POST", "/insert", `{"agent_id":"agent","key":"`+key+`","text":"more"}`)
+	}
+	if got := s3.puts.Load(); got != 1 {
+		t.Fatalf("%d uploads inside the interval, want still 1", got)
+	}
+	status, resp := invoke(t, h, "POST", "/flush", "")
+	if status != 200 || resp.Data.(map[string]interface{})["uploaded"] != 1.0 {
+		t.Fatalf("flush: status %d, data %v; want one upload", status, resp.Data)
+	}
+	if got := s3.puts.Load(); got != 2 {
+		t.Fatalf("%d uploads after the flush, want 2", got)
+	}
+}
+
+func TestDetailedSearchReportsTimestamp(t *testing.T) {
+	h, _ := newTestHandler(t, emptyS3{}, embedding.NewMockProvider(512))
+
+	before := time.Now().Add(-time.Second)
+	if status, resp := invoke(t, h, "POST", "/insert", `{"agent_id":"agent","key":"k1","text":"the meeting moved to Friday"}`); status != 200 {
+		t.Fatalf("insert: status %d, %s", status, resp.Error)
+	}
+
+	status, resp := invoke(t, h, "POST", "/search", `{"agent_id":"agent","text":"the meeting moved to Friday","detailed":true}`)
+	if status != 200 {
+		t.Fatalf("search: status %d, %s", status, resp.Error)
+	}
+	raw, _ := json.Marshal(resp.Data)
+	var items []SearchResultItem
+	if err := json.Unmarshal(raw, &items); err != nil || len(items) != 1 {
+		t.Fatalf("search data %s (%v), want one item", raw, err)
+	}
+
+	ts, err := time.Parse(time.RFC3339, items[0].Timestamp)
+	if err != nil {
+		t.Fatalf("timestamp %q is not RFC 3339: %v", items[0].Timestamp, err)
+	}
+	if ts.Before(before.Truncate(time.Second)) || ts.After(time.Now()) {
+		t.Errorf("timestamp %v, want the time of the insert", ts)
+	}
+	if items[0].Key != "k1" || items[0].Metadata[types.TimestampKey] == nil {
+		t.Errorf("item %+v, want key k1 and the timestamp in its metadata", items[0])
+	}
+}
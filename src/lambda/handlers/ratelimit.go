@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+
+	"Hippocampus/src/lambda/logging"
+	"Hippocampus/src/ratelimit"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// SetRateLimit throttles each caller with limiter; nil turns throttling off
+func (h *Handler) SetRateLimit(limiter ratelimit.Limiter) {
+	h.limiter = limiter
+}
+
+// SetMaxBodyBytes rejects request bodies larger than n bytes with a 413; 0
+// removes the limit
+func (h *Handler) SetMaxBodyBytes(n int) {
+	h.maxBodyBytes = n
+}
+
+// rateLimitKey names the caller a request is throttled as: the API Gateway
+// key when there is one, then the agent, then the source address
+func rateLimitKey(request events.APIGatewayProxyRequest) string {
+	if key := request.RequestContext.Identity.APIKey; key != "" {
+		return "key:" + key
+	}
+	if agentID := requestAgentID(request); agentID != "" {
+		return "agent:" + agentID
+	}
+	return "ip:" + request.RequestContext.Identity.SourceIP
+}
+
+// admit enforces the body size limit and the rate limit, returning the
+// rejection when the request may not go through
+func (h *Handler) admit(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, bool) {
+	if h.maxBodyBytes > 0 && len(request.Body) > h.maxBodyBytes {
+		resp, _ := errorResponse(413, fmt.Sprintf("request body exceeds %d bytes", h.maxBodyBytes))
+		return resp, false
+	}
+	if h.limiter == nil || request.HTTPMethod == "OPTIONS" {
+		return events.APIGatewayProxyResponse{}, true
+	}
+
+	ok, retryAfter := h.limiter.Allow(rateLimitKey(request))
+	if ok {
+		return events.APIGatewayProxyResponse{}, true
+	}
+	seconds := ratelimit.RetryAfterSeconds(retryAfter)
+	resp, _ := errorResponse(429, fmt.Sprintf("rate limit exceeded, retry in %ds", seconds))
+	resp.Headers["Retry-After"] = strconv.FormatInt(seconds, 10)
+	return resp, false
+}
+
+// throttledFields adds what logRequest records for a throttled request
+func throttledFields(fields logging.Fields, request events.APIGatewayProxyRequest, resp events.APIGatewayProxyResponse) {
+	fields["rate_limit_key"] = rateLimitKey(request)
+	fields["retry_after"] = resp.Headers["Retry-After"]
+}
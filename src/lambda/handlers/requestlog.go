@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"Hippocampus/src/lambda/logging"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+)
+
+const defaultLatencyBudget = 2 * time.Second
+
+func (h *Handler) SetLogger(logger logging.Logger) {
+	h.logger = logger
+}
+
+// SetLatencyBudget sets how long a request may take before it is logged as a warning
+func (h *Handler) SetLatencyBudget(budget time.Duration) {
+	h.latencyBudget = budget
+}
+
+// requestID prefers the API Gateway request ID, falling back to the Lambda invocation ID
+func requestID(ctx context.Context, request events.APIGatewayProxyRequest) string {
+	if request.RequestContext.RequestID != "" {
+		return request.RequestContext.RequestID
+	}
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		return lc.AwsRequestID
+	}
+	return ""
+}
+
+// logRequest writes one entry per request: path, agent, latency, status and error
+func (h *Handler) logRequest(ctx context.Context, request events.APIGatewayProxyRequest, resp events.APIGatewayProxyResponse, err error, latency time.Duration) {
+	fields := logging.Fields{
+		"method":     request.HTTPMethod,
+		"path":       request.Path,
+		"status":     resp.StatusCode,
+		"latency_ms": latency.Milliseconds(),
+	}
+
+	if agentID := requestAgentID(request); agentID != "" {
+		fields["agent_id"] = agentID
+	}
+
+	if err != nil {
+		fields["error"] = err.Error()
+	} else if resp.StatusCode >= 400 {
+		var body Response
+		if json.Unmarshal([]byte(resp.Body), &body) == nil && body.Error != "" {
+			fields["error"] = body.Error
+		}
+	}
+
+	switch {
+	case err != nil || resp.StatusCode >= 500:
+		h.logger.Error(ctx, "request failed", fields)
+	case resp.StatusCode == 429:
+		throttledFields(fields, request, resp)
+		h.logger.Warn(ctx, "request throttled", fields)
+	case h.latencyBudget > 0 && latency > h.latencyBudget:
+		fields["latency_budget_ms"] = h.latencyBudget.Milliseconds()
+		h.logger.Warn(ctx, "request exceeded latency budget", fields)
+	default:
+		h.logger.Info(ctx, "request complete", fields)
+	}
+}
+
+func requestAgentID(request events.APIGatewayProxyRequest) string {
+	if agentID := request.QueryStringParameters["agent_id"]; agentID != "" {
+		return agentID
+	}
+
+	var body struct {
+		AgentID string `json:"agent_id"`
+	}
+	if json.Unmarshal([]byte(request.Body), &body) != nil {
+		return ""
+	}
+	return body.AgentID
+}
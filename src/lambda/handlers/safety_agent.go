@@ -8,7 +8,6 @@ import (
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
 )
@@ -83,12 +82,10 @@ Use high-threshold searches for safety-critical queries.`
 
 	userPrompt := fmt.Sprintf("User says: %s\nCheck memory and respond safely.", req.Message)
 
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(req.BedrockRegion))
-	if err != nil {
-		return "", nil, fmt.Errorf("failed to load AWS config: %w", err)
-	}
-
-	bedrock := bedrockruntime.NewFromConfig(cfg)
+	// Reuse the manager's credentials; only the region differs
+	bedrock := bedrockruntime.NewFromConfig(h.storage.AWSConfig(), func(o *bedrockruntime.Options) {
+		o.Region = req.BedrockRegion
+	})
 
 	input := &bedrockruntime.ConverseInput{
 		ModelId: aws.String(req.ModelID),
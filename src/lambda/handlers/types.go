@@ -1,17 +1,46 @@
 package handlers
 
+import (
+	"Hippocampus/src/client"
+	"Hippocampus/src/types"
+)
+
+// InsertRequest stores text as the agent's node with ID Key. OnConflict is
+// what happens when the agent already has a node with that ID: replace (the
+// default), skip or append.
 type InsertRequest struct {
-	AgentID string `json:"agent_id"`
-	Key     string `json:"key"`
-	Text    string `json:"text"`
+	AgentID    string `json:"agent_id"`
+	Key        string `json:"key"`
+	Text       string `json:"text"`
+	OnConflict string `json:"on_conflict,omitempty"`
+	Debug      bool   `json:"debug,omitempty"` // include OperationStats in the response
 }
 
+// SearchRequest carries every types.SearchOptions field under its JSON
+// name (epsilon, top_k, group_by, ...); Filter is the JSON form
 type SearchRequest struct {
-	AgentID   string  `json:"agent_id"`
-	Text      string  `json:"text"`
-	Epsilon   float32 `json:"epsilon"`
-	Threshold float32 `json:"threshold"`
-	TopK      int     `json:"top_k"`
+	AgentID  string `json:"agent_id"`
+	Text     string `json:"text"`
+	Detailed bool   `json:"detailed"`
+
+	types.SearchOptions
+	Filter  map[string]interface{} `json:"filter,omitempty"`  // metadata to match; keys may be dotted paths like "user.tier"
+	Debug   bool                   `json:"debug,omitempty"`   // include OperationStats in the response; skips the cache
+	Explain bool                   `json:"explain,omitempty"` // include a types.ExplainReport in the response; skips the cache
+}
+
+// SearchResultItem is one hit in a detailed search response. Key is the
+// ID the node was inserted under, empty for nodes stored before inserts
+// kept it; Timestamp is when the memory happened, in RFC 3339, empty for
+// nodes stored before inserts recorded it.
+type SearchResultItem struct {
+	Key        string                 `json:"key,omitempty"`
+	Text       string                 `json:"text"`
+	Similarity float32                `json:"similarity"`
+	Timestamp  string                 `json:"timestamp,omitempty"`
+	Metadata   map[string]interface{} `json:"metadata,omitempty"`
+	Group      string                 `json:"group,omitempty"`     // group_by value
+	Collapsed  int                    `json:"collapsed,omitempty"` // same-group results folded into this one
 }
 
 type InsertCSVRequest struct {
@@ -20,7 +49,11 @@ type InsertCSVRequest struct {
 }
 
 type Response struct {
-	Message string      `json:"message"`
-	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
+	Message   string                 `json:"message"`
+	Data      interface{}            `json:"data,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+	Truncated bool                   `json:"truncated,omitempty"` // search limits stopped the search early; results are the best found
+	Stats     *client.OperationStats `json:"stats,omitempty"`     // only for debug requests
+	Explain   *types.ExplainReport   `json:"explain,omitempty"`   // only for explain requests
+	Hint      *types.SearchHint      `json:"hint,omitempty"`      // why a debug search found nothing
 }
@@ -57,6 +57,13 @@ Text: <textarea name="text"></textarea><br>
 <button type="submit">Insert</button>
 </form>
 
+<h2>Search Memories</h2>
+<form id="searchForm">
+Agent ID: <input name="agent_id" value="safety_demo_parent"><br>
+Query: <textarea name="text"></textarea><br>
+<button type="submit">Search</button>
+</form>
+
 <h2>Query Safety Agent</h2>
 <form id="safetyForm">
 Agent ID: <input name="agent_id" value="safety_demo_parent"><br>
@@ -97,6 +104,47 @@ document.getElementById('insertForm').addEventListener('submit', async e => {
 	showResult(result);
 });
 
+function formatSearchResults(text) {
+	let parsed;
+	try {
+		parsed = JSON.parse(text);
+	} catch (err) {
+		return text;
+	}
+	if (parsed.error) {
+		return "Error: " + parsed.error;
+	}
+	const items = parsed.data || [];
+	if (items.length === 0) {
+		return "No memories found";
+	}
+	return items.map((item, i) => {
+		let line = (i + 1) + ". [" + item.similarity.toFixed(3) + "] " + item.text;
+		if (item.key) {
+			line += "\n   key: " + item.key;
+		}
+		if (item.timestamp) {
+			line += "\n   stored: " + item.timestamp;
+		}
+		if (item.metadata) {
+			line += "\n   metadata: " + JSON.stringify(item.metadata);
+		}
+		return line;
+	}).join("\n");
+}
+
+document.getElementById('searchForm').addEventListener('submit', async e => {
+	e.preventDefault();
+	const data = {
+		agent_id: e.target.agent_id.value,
+		text: e.target.text.value,
+		detailed: true
+	};
+	showResult("Searching...");
+	const result = await postJSON('/search', data);
+	showResult(formatSearchResults(result));
+});
+
 document.getElementById('safetyForm').addEventListener('submit', async e => {
 	e.preventDefault();
 	const data = {
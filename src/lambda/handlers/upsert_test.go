@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"Hippocampus/src/client"
+	"Hippocampus/src/embedding"
+	"testing"
+)
+
+func TestInsertConflictPolicies(t *testing.T) {
+	s3 := &countingS3{}
+	h, _ := newTestHandler(t, s3, embedding.NewMockProvider(512))
+
+	insert := func(body, wantOutcome string, wantUploads int32) {
+		t.Helper()
+		status, resp := invoke(t, h, "POST", "/insert", body)
+		if status != 200 {
+			t.Fatalf("%s: status %d, %s", body, status, resp.Error)
+		}
+		data, _ := resp.Data.(map[string]interface{})
+		if data["outcome"] != wantOutcome {
+			t.Errorf("%s: outcome %v, want %s", body, resp.Data, wantOutcome)
+		}
+		if got := s3.puts.Load(); got != wantUploads {
+			t.Errorf("%s: %d uploads, want %d", body, got, wantUploads)
+		}
+	}
+	stored := func(text string) int {
+		t.Helper()
+		status, resp := invoke(t, h, "POST", "/search", `{"agent_id":"agent","text":"`+text+`","top_k":10,"epsilon":100,"max_distance":1000}`)
+		if status != 200 {
+			t.Fatalf("search: status %d, %s", status, resp.Error)
+		}
+		found, _ := resp.Data.([]interface{})
+		return len(found)
+	}
+
+	insert(`{"agent_id":"agent","key":"last_message","text":"hello"}`, client.UpsertCreated, 1)
+	// Replace is the default
+	insert(`{"agent_id":"agent","key":"last_message","text":"how are you"}`, client.UpsertReplaced, 2)
+	if n := stored("how are you"); n != 1 {
+		t.Fatalf("after a replace the agent holds %d nodes, want 1", n)
+	}
+
+	// A skip changes nothing, so it doesn't upload
+	insert(`{"agent_id":"agent","key":"last_message","text":"ignored","on_conflict":"skip"}`, client.UpsertSkipped, 2)
+	insert(`{"agent_id":"agent","key":"other","text":"new","on_conflict":"skip"}`, client.UpsertCreated, 3)
+
+	insert(`{"agent_id":"agent","key":"last_message","text":"goodbye","on_conflict":"append"}`, client.UpsertAppended, 4)
+	if n := stored("goodbye"); n != 3 {
+		t.Fatalf("after an append the agent holds %d nodes, want 3", n)
+	}
+	insert(`{"agent_id":"agent","key":"last_message","text":"final","on_conflict":"replace"}`, client.UpsertReplaced, 5)
+	if n := stored("final"); n != 2 {
+		t.Fatalf("after replacing both copies the agent holds %d nodes, want 2", n)
+	}
+
+	status, _ := invoke(t, h, "POST", "/insert", `{"agent_id":"agent","key":"k","text":"t","on_conflict":"merge"}`)
+	if status != 400 || s3.puts.Load() != 5 {
+		t.Errorf("unknown policy: status %d after %d uploads, want 400 and no upload", status, s3.puts.Load())
+	}
+}
@@ -0,0 +1,84 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+type Fields map[string]interface{}
+
+// Logger receives one structured entry per call. Tests can swap in their own
+// implementation to capture entries instead of writing JSON to stdout.
+type Logger interface {
+	Info(ctx context.Context, msg string, fields Fields)
+	Warn(ctx context.Context, msg string, fields Fields)
+	Error(ctx context.Context, msg string, fields Fields)
+}
+
+type contextKey struct{}
+
+// WithRequestID attaches a correlation ID that every log line written with ctx will carry
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, requestID)
+}
+
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// JSONLogger writes each entry as a single JSON line
+type JSONLogger struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func NewJSON(out io.Writer) *JSONLogger {
+	return &JSONLogger{out: out}
+}
+
+// Default logs to stdout, which Lambda forwards to CloudWatch
+func Default() *JSONLogger {
+	return NewJSON(os.Stdout)
+}
+
+func (l *JSONLogger) Info(ctx context.Context, msg string, fields Fields) {
+	l.write(ctx, "info", msg, fields)
+}
+
+func (l *JSONLogger) Warn(ctx context.Context, msg string, fields Fields) {
+	l.write(ctx, "warn", msg, fields)
+}
+
+func (l *JSONLogger) Error(ctx context.Context, msg string, fields Fields) {
+	l.write(ctx, "error", msg, fields)
+}
+
+func (l *JSONLogger) write(ctx context.Context, level, msg string, fields Fields) {
+	entry := make(map[string]interface{}, len(fields)+4)
+	for k, v := range fields {
+		entry[k] = v
+	}
+	entry["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	entry["level"] = level
+	entry["msg"] = msg
+	if id := RequestID(ctx); id != "" {
+		entry["request_id"] = id
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(append(line, '\n'))
+}
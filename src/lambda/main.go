@@ -1,11 +1,20 @@
 package main
 
 import (
+	"context"
 	"log"
+	"math"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"Hippocampus/src/lambda/cache"
 	"Hippocampus/src/lambda/handlers"
 	"Hippocampus/src/lambda/storage"
+	"Hippocampus/src/ratelimit"
+	"Hippocampus/src/types"
 
 	"github.com/aws/aws-lambda-go/lambda"
 )
@@ -31,7 +40,140 @@ func main() {
 		log.Fatalf("failed to initialize storage manager: %v", err)
 	}
 
-	handler := handlers.New(storageManager, nil)
+	// EMBED_PROVIDER picks the agents' embedder, Titan by default; settings it
+	// can't work with fail the cold start rather than the first insert
+	embedConfig, err := storage.EmbedConfigFromEnv(os.Getenv)
+	if err != nil {
+		log.Fatalf("invalid embedding settings: %v", err)
+	}
+	embedder, err := embedConfig.NewProvider(storageManager.AWSConfig())
+	if err != nil {
+		log.Fatalf("failed to create embedding provider: %v", err)
+	}
+	storageManager.SetEmbedder(embedder)
+
+	// Writes mark their agent dirty and the handler uploads dirty agents
+	// before each invocation returns, at most once per SYNC_INTERVAL per
+	// agent when it is set; POST /flush uploads everything outstanding
+	var syncInterval time.Duration
+	if interval := os.Getenv("SYNC_INTERVAL"); interval != "" {
+		if syncInterval, err = time.ParseDuration(interval); err != nil {
+			log.Fatalf("invalid SYNC_INTERVAL: %v", err)
+		}
+	}
+	storageManager.SetSyncInterval(syncInterval)
+
+	// memcached://host:port or redis://host:port, fronted by a per-container
+	// LRU; with no CACHE_URL the LRU alone caches searches
+	localEntries := 1000
+	if entries := os.Getenv("CACHE_LOCAL_ENTRIES"); entries != "" {
+		if localEntries, err = strconv.Atoi(entries); err != nil {
+			log.Fatalf("invalid CACHE_LOCAL_ENTRIES: %v", err)
+		}
+	}
+
+	localTTL := 30 * time.Second
+	if ttl := os.Getenv("CACHE_LOCAL_TTL"); ttl != "" {
+		if localTTL, err = time.ParseDuration(ttl); err != nil {
+			log.Fatalf("invalid CACHE_LOCAL_TTL: %v", err)
+		}
+	}
+
+	store, err := cache.Configure(os.Getenv("CACHE_URL"), localEntries, localTTL)
+	if err != nil {
+		log.Fatalf("invalid CACHE_URL: %v", err)
+	}
+
+	// Load the busiest agents during init rather than on their first
+	// request, within WARM_TIMEOUT so a slow load can't stall the container
+	if agents := os.Getenv("WARM_AGENTS"); agents != "" {
+		warmTimeout := 8 * time.Second
+		if timeout := os.Getenv("WARM_TIMEOUT"); timeout != "" {
+			if warmTimeout, err = time.ParseDuration(timeout); err != nil {
+				log.Fatalf("invalid WARM_TIMEOUT: %v", err)
+			}
+		}
+		var agentIDs []string
+		for _, agentID := range strings.Split(agents, ",") {
+			if agentID = strings.TrimSpace(agentID); agentID != "" {
+				agentIDs = append(agentIDs, agentID)
+			}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), warmTimeout)
+		if err := storageManager.Warmup(ctx, agentIDs); err != nil {
+			log.Printf("warmup stopped early: %v", err)
+		}
+		cancel()
+	}
+
+	handler := handlers.New(storageManager, store, embedder)
+	handler.SetCORS(handlers.NewCORSConfig(
+		os.Getenv("CORS_ALLOWED_ORIGINS"),
+		os.Getenv("CORS_ALLOWED_METHODS"),
+		os.Getenv("CORS_ALLOWED_HEADERS"),
+	))
+
+	if budget := os.Getenv("LATENCY_BUDGET_MS"); budget != "" {
+		ms, err := strconv.Atoi(budget)
+		if err != nil {
+			log.Fatalf("invalid LATENCY_BUDGET_MS: %v", err)
+		}
+		handler.SetLatencyBudget(time.Duration(ms) * time.Millisecond)
+	}
+
+	// Bound what one pathological search (say a huge epsilon) can cost
+	maxCandidates := types.DefaultMaxCandidates
+	if n := os.Getenv("SEARCH_MAX_CANDIDATES"); n != "" {
+		if maxCandidates, err = strconv.Atoi(n); err != nil {
+			log.Fatalf("invalid SEARCH_MAX_CANDIDATES: %v", err)
+		}
+	}
+	searchTimeout := types.DefaultSearchTimeout
+	if timeout := os.Getenv("SEARCH_TIMEOUT"); timeout != "" {
+		if searchTimeout, err = time.ParseDuration(timeout); err != nil {
+			log.Fatalf("invalid SEARCH_TIMEOUT: %v", err)
+		}
+	}
+	handler.SetSearchLimits(maxCandidates, searchTimeout)
+
+	// Throttle each API key (or agent, without one) to RATE_LIMIT_RPS with
+	// bursts of RATE_LIMIT_BURST; per container, so the fleet allows more
+	if rps := os.Getenv("RATE_LIMIT_RPS"); rps != "" {
+		rate, err := strconv.ParseFloat(rps, 64)
+		if err != nil || rate <= 0 {
+			log.Fatalf("invalid RATE_LIMIT_RPS: %q", rps)
+		}
+		burst := int(math.Ceil(rate))
+		if b := os.Getenv("RATE_LIMIT_BURST"); b != "" {
+			if burst, err = strconv.Atoi(b); err != nil {
+				log.Fatalf("invalid RATE_LIMIT_BURST: %v", err)
+			}
+		}
+		handler.SetRateLimit(ratelimit.NewTokenBucket(rate, burst))
+	}
+	if n := os.Getenv("MAX_BODY_BYTES"); n != "" {
+		maxBody, err := strconv.Atoi(n)
+		if err != nil {
+			log.Fatalf("invalid MAX_BODY_BYTES: %v", err)
+		}
+		handler.SetMaxBodyBytes(maxBody)
+	}
+
+	// GET /config echoes these to callers presenting CONFIG_TOKEN; only the
+	// cache's scheme, since its URL may carry a password
+	cacheBackend := "local"
+	if u, err := url.Parse(os.Getenv("CACHE_URL")); err == nil && u.Scheme != "" {
+		cacheBackend = u.Scheme
+	}
+	handler.SetConfigEndpoint(os.Getenv("CONFIG_TOKEN"), map[string]interface{}{
+		"embed":               embedConfig,
+		"efs_path":            efsPath,
+		"s3_bucket":           s3Bucket,
+		"sync_interval":       syncInterval.String(),
+		"cache_backend":       cacheBackend,
+		"cache_local_entries": localEntries,
+		"cache_local_ttl":     localTTL.String(),
+	})
 
 	lambda.Start(handler.Route)
 }
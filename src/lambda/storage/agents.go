@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"Hippocampus/src/lambda/logging"
+	hippostorage "Hippocampus/src/storage"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// AgentInfo describes one agent database found on EFS and/or S3
+type AgentInfo struct {
+	AgentID   string `json:"agent_id"`
+	NodeCount int64  `json:"node_count"`
+	EFSBytes  int64  `json:"efs_bytes"`
+	S3Bytes   int64  `json:"s3_bytes"`
+	OnEFS     bool   `json:"on_efs"`
+	InS3      bool   `json:"in_s3"`
+}
+
+// AgentPage is one page of ListAgents results, ordered by agent ID
+type AgentPage struct {
+	Agents     []AgentInfo `json:"agents"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	Total      int         `json:"total"`
+}
+
+// DeleteResult reports what DeleteAgent removed (or would remove on a dry run)
+type DeleteResult struct {
+	AgentID      string `json:"agent_id"`
+	DryRun       bool   `json:"dry_run"`
+	EFSDeleted   bool   `json:"efs_deleted"`
+	S3Deleted    bool   `json:"s3_deleted"`
+	CacheEvicted bool   `json:"cache_evicted"`
+}
+
+func (m *Manager) agentPath(agentID string) string {
+	return filepath.Join(m.efsPath, fmt.Sprintf("%s.bin", agentID))
+}
+
+// ListAgents merges the agents found on EFS and in S3. Pages start after cursor
+// (an agent ID, exclusive) and hold at most limit entries.
+func (m *Manager) ListAgents(cursor string, limit int) (*AgentPage, error) {
+	agents, err := m.collectAgents()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(agents))
+	for id := range agents {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	start := sort.SearchStrings(ids, cursor)
+	if start < len(ids) && ids[start] == cursor {
+		start++
+	}
+
+	end := start + limit
+	if end > len(ids) {
+		end = len(ids)
+	}
+
+	page := &AgentPage{
+		Agents: make([]AgentInfo, 0, end-start),
+		Total:  len(ids),
+	}
+
+	for _, id := range ids[start:end] {
+		info := agents[id]
+		if info.OnEFS {
+			count, err := hippostorage.New(m.agentPath(id)).NodeCount()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read node count for %s: %w", id, err)
+			}
+			info.NodeCount = count
+		}
+		page.Agents = append(page.Agents, *info)
+	}
+
+	if end < len(ids) {
+		page.NextCursor = ids[end-1]
+	}
+
+	return page, nil
+}
+
+func (m *Manager) collectAgents() (map[string]*AgentInfo, error) {
+	agents := make(map[string]*AgentInfo)
+
+	entries, err := os.ReadDir(m.efsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read EFS directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".bin") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %w", entry.Name(), err)
+		}
+		id := strings.TrimSuffix(entry.Name(), ".bin")
+		agents[id] = &AgentInfo{
+			AgentID:  id,
+			EFSBytes: info.Size(),
+			OnEFS:    true,
+		}
+	}
+
+	s3Agents, err := m.s3Sync.ListAgents()
+	if err != nil {
+		return nil, err
+	}
+
+	for id, size := range s3Agents {
+		info, ok := agents[id]
+		if !ok {
+			info = &AgentInfo{AgentID: id}
+			agents[id] = info
+		}
+		info.S3Bytes = size
+		info.InS3 = true
+	}
+
+	return agents, nil
+}
+
+// DeleteAgent evicts the cached client and removes the agent's EFS file and S3 backup
+func (m *Manager) DeleteAgent(ctx context.Context, agentID string, dryRun bool) (*DeleteResult, error) {
+	// Let in-flight inserts and searches for this agent finish first
+	unlock := m.lockAgent(agentID)
+	defer unlock()
+
+	result := &DeleteResult{AgentID: agentID, DryRun: dryRun}
+
+	// Holding the agent's lock is enough for the file and S3 calls below;
+	// clientsMutex only covers the maps, so other agents aren't held up
+	m.clientsMutex.Lock()
+	if _, ok := m.clients[agentID]; ok {
+		if !dryRun {
+			delete(m.clients, agentID)
+			delete(m.dirty, agentID)
+			delete(m.pendingDims, agentID)
+			delete(m.lastUpload, agentID)
+		}
+		result.CacheEvicted = true
+	}
+	m.clientsMutex.Unlock()
+
+	filePath := m.agentPath(agentID)
+	if _, err := os.Stat(filePath); err == nil {
+		if !dryRun {
+			if err := os.Remove(filePath); err != nil {
+				return nil, fmt.Errorf("failed to remove EFS file: %w", err)
+			}
+			os.Remove(filePath + ".lock")
+			os.Remove(filePath + ".etag")
+		}
+		result.EFSDeleted = true
+	}
+
+	if m.s3Sync.Exists(agentID) {
+		if !dryRun {
+			if err := m.s3Sync.Delete(agentID); err != nil {
+				return nil, err
+			}
+		}
+		result.S3Deleted = true
+	}
+
+	m.logger.Info(ctx, "agent deleted", logging.Fields{
+		"agent_id":      agentID,
+		"dry_run":       dryRun,
+		"efs_deleted":   result.EFSDeleted,
+		"s3_deleted":    result.S3Deleted,
+		"cache_evicted": result.CacheEvicted,
+	})
+
+	return result, nil
+}
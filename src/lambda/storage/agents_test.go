@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"Hippocampus/src/types"
+	"context"
+	"os"
+	"testing"
+)
+
+// newDeletableAgent inserts into agentID and backs its file up to s3
+func newDeletableAgent(t *testing.T, m *Manager, s3 *fakeS3, agentID string) {
+	t.Helper()
+	if err := m.Insert(context.Background(), agentID, "k", "memory of "+agentID); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.ReadFile(m.agentPath(agentID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s3.objects[agentKey(agentID)] = file
+}
+
+func TestDeleteAgentDryRun(t *testing.T) {
+	s3 := newFakeS3()
+	m := newTestManager(t, s3, 512)
+	newDeletableAgent(t, m, s3, "agent")
+
+	result, err := m.DeleteAgent(context.Background(), "agent", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DeleteResult{AgentID: "agent", DryRun: true, EFSDeleted: true, S3Deleted: true, CacheEvicted: true}
+	if *result != want {
+		t.Fatalf("result = %+v, want %+v", *result, want)
+	}
+
+	if _, err := os.Stat(m.agentPath("agent")); err != nil {
+		t.Fatalf("dry run removed the EFS file: %v", err)
+	}
+	if _, ok := s3.objects[agentKey("agent")]; !ok {
+		t.Fatal("dry run removed the S3 object")
+	}
+	if _, ok := m.clients["agent"]; !ok {
+		t.Fatal("dry run evicted the client")
+	}
+}
+
+func TestDeleteAgent(t *testing.T) {
+	s3 := newFakeS3()
+	m := newTestManager(t, s3, 512)
+	newDeletableAgent(t, m, s3, "agent")
+	newDeletableAgent(t, m, s3, "other")
+
+	result, err := m.DeleteAgent(context.Background(), "agent", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DeleteResult{AgentID: "agent", EFSDeleted: true, S3Deleted: true, CacheEvicted: true}
+	if *result != want {
+		t.Fatalf("result = %+v, want %+v", *result, want)
+	}
+
+	if _, err := os.Stat(m.agentPath("agent")); !os.IsNotExist(err) {
+		t.Fatalf("EFS file still there (stat error %v)", err)
+	}
+	if _, ok := s3.objects[agentKey("agent")]; ok {
+		t.Fatal("S3 object still there")
+	}
+	if _, ok := m.clients["agent"]; ok {
+		t.Fatal("client still cached")
+	}
+	if m.dirty["agent"] {
+		t.Fatal("deleted agent still queued for upload")
+	}
+	if _, ok := s3.objects[agentKey("other")]; !ok {
+		t.Fatal("another agent's S3 object was removed")
+	}
+
+	// Nothing is left to delete the second time
+	result, err = m.DeleteAgent(context.Background(), "agent", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (DeleteResult{AgentID: "agent"}); *result != want {
+		t.Fatalf("second delete = %+v, want %+v", *result, want)
+	}
+}
+
+func TestDeleteAgentDoesNotBlockOtherAgents(t *testing.T) {
+	s3 := newFakeS3()
+	m := newTestManager(t, s3, 512)
+	newDeletableAgent(t, m, s3, "agent")
+	newDeletableAgent(t, m, s3, "other")
+
+	s3.calls = make(chan string, 1)
+	s3.block = make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		_, err := m.DeleteAgent(context.Background(), "agent", false)
+		done <- err
+	}()
+	if method := <-s3.calls; method != "HeadObject" {
+		t.Fatalf("first S3 call was %s, want HeadObject", method)
+	}
+
+	// The delete is waiting on S3; the other agent must not wait on it
+	s3.calls = nil
+	ctx := context.Background()
+	results, _, err := m.SearchStats(ctx, "other", "memory of other", 1, 0.5, 5, types.SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+	if err := m.Insert(ctx, "other", "k2", "a second memory"); err != nil {
+		t.Fatal(err)
+	}
+
+	close(s3.block)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
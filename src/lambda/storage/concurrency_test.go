@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"Hippocampus/src/embedding"
+	"Hippocampus/src/lambda/logging"
+	hippostorage "Hippocampus/src/storage"
+	"Hippocampus/src/types"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// decodingS3 is fakeS3 checking that every upload is a whole database
+type decodingS3 struct {
+	*fakeS3
+	dir  string
+	seq  atomic.Int32
+	errs chan error
+}
+
+func (d *decodingS3) PutObject(ctx context.Context, bucket, key string, body io.Reader) (string, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	if _, err := loadBytes(d.dir, int(d.seq.Add(1)), data); err != nil {
+		d.errs <- fmt.Errorf("upload of %s does not load: %w", key, err)
+	}
+	return d.fakeS3.PutObject(ctx, bucket, key, bytes.NewReader(data))
+}
+
+// loadBytes decodes a database file's contents
+func loadBytes(dir string, n int, data []byte) (int, error) {
+	path := filepath.Join(dir, fmt.Sprintf("upload-%d.bin", n))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return 0, err
+	}
+	tree, err := hippostorage.New(path).Load()
+	if err != nil {
+		return 0, err
+	}
+	return len(tree.Nodes), nil
+}
+
+// TestConcurrentAgentOperations runs inserts, searches and syncs for
+// several agents at once. Run it with -race; it also checks that no upload
+// caught a file mid-flush and that every insert reached S3.
+func TestConcurrentAgentOperations(t *testing.T) {
+	s3 := &decodingS3{fakeS3: newFakeS3(), dir: t.TempDir(), errs: make(chan error, 100)}
+	m, err := NewManagerWithConfig(t.TempDir(), aws.Config{Region: "us-east-1"}, NewS3SyncWithAPI("bucket", s3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetLogger(logging.NewJSON(io.Discard))
+	m.SetEmbedder(embedding.NewHashingProvider(512, 1))
+	m.SetSyncInterval(time.Hour)
+	ctx := context.Background()
+
+	const agents, workers, perWorker = 5, 50, 4
+	errs := make(chan error, workers*perWorker)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			agentID := fmt.Sprintf("agent-%d", w%agents)
+			for i := 0; i < perWorker; i++ {
+				text := fmt.Sprintf("worker %d memory %d", w, i)
+				if err := m.Insert(ctx, agentID, fmt.Sprintf("%d-%d", w, i), text); err != nil {
+					errs <- err
+					return
+				}
+				results, _, err := m.SearchStats(ctx, agentID, text, 2, 0, 5, types.SearchOptions{})
+				if err != nil {
+					errs <- err
+					return
+				}
+				if len(results) == 0 {
+					errs <- fmt.Errorf("%s did not find %q just after inserting it", agentID, text)
+				}
+			}
+		}()
+	}
+
+	// Syncs run alongside, as the end of other invocations would
+	stop := make(chan struct{})
+	synced := make(chan struct{})
+	go func() {
+		defer close(synced)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if _, err := m.SyncDirty(ctx); err != nil {
+				errs <- err
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(stop)
+	<-synced
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	close(s3.errs)
+	for err := range s3.errs {
+		t.Error(err)
+	}
+
+	if _, err := m.SyncDirty(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for a := 0; a < agents; a++ {
+		agentID := fmt.Sprintf("agent-%d", a)
+		s3.mu.Lock()
+		data := s3.objects[agentKey(agentID)]
+		s3.mu.Unlock()
+		nodes, err := loadBytes(t.TempDir(), 0, data)
+		if err != nil {
+			t.Fatalf("%s in S3: %v", agentID, err)
+		}
+		if want := workers / agents * perWorker; nodes != want {
+			t.Errorf("%s has %d nodes in S3, want %d", agentID, nodes, want)
+		}
+	}
+}
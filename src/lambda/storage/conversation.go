@@ -0,0 +1,219 @@
+package storage
+
+import (
+	"Hippocampus/src/client"
+	"Hippocampus/src/lambda/logging"
+	"Hippocampus/src/types"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Metadata on conversation nodes. Every node carries ConversationKey and
+// ConversationKindKey; turns add their role and index, summaries the range
+// of turns they replaced.
+const (
+	ConversationKey        = "conversation"
+	ConversationKindKey    = "conversation_kind"
+	ConversationRoleKey    = "role"
+	ConversationTurnKey    = "turn"
+	ConversationFromKey    = "from_turn"
+	ConversationThroughKey = "through_turn"
+
+	conversationTurn    = "turn"
+	conversationSummary = "summary"
+)
+
+// DefaultConversationTurns is how many turns a conversation keeps verbatim
+// before the oldest are summarized
+const DefaultConversationTurns = 20
+
+// ConversationTurn is one stored turn of a conversation
+type ConversationTurn struct {
+	Index int    `json:"index"`
+	Role  string `json:"role"`
+	Text  string `json:"text"`
+}
+
+// Summarizer condenses conversation turns, oldest first, into the text of
+// one memory
+type Summarizer interface {
+	Summarize(ctx context.Context, turns []ConversationTurn) (string, error)
+}
+
+// ConversationFootprint is what a conversation holds after AppendTurn
+type ConversationFootprint struct {
+	ConversationID   string `json:"conversation_id"`
+	Turn             int    `json:"turn"`              // index of the appended turn
+	TurnsStored      int    `json:"turns_stored"`      // verbatim turns still stored
+	SummariesCreated int    `json:"summaries_created"` // summary nodes for the conversation
+	Summarized       int    `json:"summarized"`        // turns this call folded into a summary
+}
+
+// AppendTurn stores a turn of the agent's conversation. Once more than
+// maxTurns turns are stored the oldest are summarized into one memory node,
+// leaving the newest maxTurns/2 verbatim, and the originals are deleted.
+// Summarizing runs without the agent's lock, so searches carry on meanwhile;
+// if it fails the turn is still stored and the error is returned with the
+// footprint.
+func (m *Manager) AppendTurn(ctx context.Context, agentID, conversationID, role, text string, maxTurns int, summarizer Summarizer) (ConversationFootprint, error) {
+	if maxTurns <= 0 {
+		maxTurns = DefaultConversationTurns
+	}
+
+	footprint, oldest, err := m.storeTurn(ctx, agentID, conversationID, role, text, maxTurns)
+	if err != nil || len(oldest) == 0 {
+		return footprint, err
+	}
+
+	// One summary at a time per conversation; a turn appended meanwhile
+	// leaves the rest for the next one
+	summaryKey := agentID + "/" + conversationID
+	m.clientsMutex.Lock()
+	busy := m.summarizing[summaryKey]
+	m.summarizing[summaryKey] = true
+	m.clientsMutex.Unlock()
+	if busy {
+		return footprint, nil
+	}
+	defer func() {
+		m.clientsMutex.Lock()
+		delete(m.summarizing, summaryKey)
+		m.clientsMutex.Unlock()
+	}()
+
+	summary, err := summarizer.Summarize(ctx, oldest)
+	if err != nil {
+		return footprint, fmt.Errorf("failed to summarize conversation: %w", err)
+	}
+	if err := m.replaceTurns(ctx, agentID, conversationID, oldest, summary); err != nil {
+		return footprint, err
+	}
+
+	footprint.TurnsStored -= len(oldest)
+	footprint.SummariesCreated++
+	footprint.Summarized = len(oldest)
+	m.logger.Info(ctx, "conversation summarized", logging.Fields{
+		"agent_id":        agentID,
+		"conversation_id": conversationID,
+		"turns":           len(oldest),
+	})
+	return footprint, nil
+}
+
+// storeTurn inserts the turn under the agent's lock and returns the oldest
+// turns to summarize, if the conversation has grown past maxTurns
+func (m *Manager) storeTurn(ctx context.Context, agentID, conversationID, role, text string, maxTurns int) (ConversationFootprint, []ConversationTurn, error) {
+	unlock := m.lockAgent(agentID)
+	defer unlock()
+
+	footprint := ConversationFootprint{ConversationID: conversationID}
+	c, err := m.insertClient(ctx, agentID)
+	if err != nil {
+		return footprint, nil, err
+	}
+
+	turns, summaries, next, err := conversation(c, conversationID)
+	if err != nil {
+		return footprint, nil, err
+	}
+
+	turn := ConversationTurn{Index: next, Role: role, Text: text}
+	metadata := map[string]string{
+		ConversationKey:     conversationID,
+		ConversationKindKey: conversationTurn,
+		ConversationRoleKey: role,
+		ConversationTurnKey: strconv.Itoa(turn.Index),
+	}
+	key := fmt.Sprintf("%s/%d", conversationID, turn.Index)
+	if _, err := c.InsertStats(key, text, metadata); err != nil {
+		return footprint, nil, err
+	}
+	if _, err := c.FlushStats(); err != nil {
+		return footprint, nil, err
+	}
+	m.markDirty(agentID)
+	turns = append(turns, turn)
+
+	footprint.Turn = turn.Index
+	footprint.TurnsStored = len(turns)
+	footprint.SummariesCreated = summaries
+	if len(turns) <= maxTurns {
+		return footprint, nil, nil
+	}
+	return footprint, turns[:len(turns)-maxTurns/2], nil
+}
+
+// replaceTurns stores summary in place of turns, under the agent's lock. The
+// summary goes in first, so a failure part way loses nothing.
+func (m *Manager) replaceTurns(ctx context.Context, agentID, conversationID string, turns []ConversationTurn, summary string) error {
+	unlock := m.lockAgent(agentID)
+	defer unlock()
+
+	c, err := m.insertClient(ctx, agentID)
+	if err != nil {
+		return err
+	}
+
+	from, through := turns[0].Index, turns[len(turns)-1].Index
+	metadata := map[string]string{
+		ConversationKey:        conversationID,
+		ConversationKindKey:    conversationSummary,
+		ConversationFromKey:    strconv.Itoa(from),
+		ConversationThroughKey: strconv.Itoa(through),
+	}
+	key := fmt.Sprintf("%s/summary/%d-%d", conversationID, from, through)
+	if _, err := c.InsertStats(key, summary, metadata); err != nil {
+		return fmt.Errorf("failed to store summary: %w", err)
+	}
+
+	summarized := make(map[string]bool, len(turns))
+	for _, turn := range turns {
+		summarized[strconv.Itoa(turn.Index)] = true
+	}
+	_, err = c.DeleteFunc(func(n *types.Node) bool {
+		return n.Metadata[ConversationKey] == conversationID &&
+			n.Metadata[ConversationKindKey] == conversationTurn &&
+			summarized[n.Metadata[ConversationTurnKey]]
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete summarized turns: %w", err)
+	}
+	if _, err := c.FlushStats(); err != nil {
+		return err
+	}
+	m.markDirty(agentID)
+	return nil
+}
+
+// conversation returns the conversation's stored turns, oldest first, how
+// many summaries it has and the index its next turn gets
+func conversation(c *client.Client, conversationID string) ([]ConversationTurn, int, int, error) {
+	var turns []ConversationTurn
+	summaries, next := 0, 0
+
+	err := c.Scan(func(r client.SearchResult) bool {
+		switch r.Metadata[ConversationKindKey] {
+		case conversationTurn:
+			index, err := strconv.Atoi(r.Metadata[ConversationTurnKey])
+			if err != nil {
+				return true
+			}
+			turns = append(turns, ConversationTurn{Index: index, Role: r.Metadata[ConversationRoleKey], Text: r.Text})
+			next = max(next, index+1)
+		case conversationSummary:
+			summaries++
+			if through, err := strconv.Atoi(r.Metadata[ConversationThroughKey]); err == nil {
+				next = max(next, through+1)
+			}
+		}
+		return true
+	}, &types.Filter{Metadata: map[string]string{ConversationKey: conversationID}})
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to read conversation: %w", err)
+	}
+
+	sort.Slice(turns, func(i, j int) bool { return turns[i].Index < turns[j].Index })
+	return turns, summaries, next, nil
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"Hippocampus/src/embedding"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// EmbedProviders are the EMBED_PROVIDER values the Lambda accepts
+var EmbedProviders = []string{"titan", "ollama", "openai"}
+
+// EmbedConfig chooses the embedding provider agents use. It holds nothing
+// secret: OpenAI's key is read from OPENAI_API_KEY by the provider itself.
+type EmbedConfig struct {
+	Provider   string `json:"provider"`
+	Model      string `json:"model,omitempty"`
+	Dimensions int    `json:"dimensions,omitempty"`
+	Endpoint   string `json:"endpoint,omitempty"`
+}
+
+// EmbedConfigFromEnv reads EMBED_PROVIDER (default titan), EMBED_MODEL,
+// EMBED_DIMENSIONS and EMBED_ENDPOINT through getenv, failing on settings
+// the provider can't start without
+func EmbedConfigFromEnv(getenv func(string) string) (EmbedConfig, error) {
+	cfg := EmbedConfig{
+		Provider: strings.ToLower(strings.TrimSpace(getenv("EMBED_PROVIDER"))),
+		Model:    strings.TrimSpace(getenv("EMBED_MODEL")),
+		Endpoint: strings.TrimSpace(getenv("EMBED_ENDPOINT")),
+	}
+	if raw := strings.TrimSpace(getenv("EMBED_DIMENSIONS")); raw != "" {
+		dims, err := strconv.Atoi(raw)
+		if err != nil || dims <= 0 {
+			return EmbedConfig{}, fmt.Errorf("EMBED_DIMENSIONS must be a positive integer, got %q", raw)
+		}
+		cfg.Dimensions = dims
+	}
+
+	switch cfg.Provider {
+	case "", "titan":
+		cfg.Provider = "titan"
+		if cfg.Model == "" {
+			cfg.Model = embedding.TitanModelID
+		}
+		if cfg.Dimensions == 0 {
+			cfg.Dimensions = embedding.TitanDimensions
+		}
+		if cfg.Endpoint != "" {
+			return EmbedConfig{}, fmt.Errorf("EMBED_ENDPOINT is not used with EMBED_PROVIDER=titan; set AWS_REGION instead")
+		}
+	case "ollama":
+		if cfg.Model == "" {
+			return EmbedConfig{}, fmt.Errorf("EMBED_MODEL is required with EMBED_PROVIDER=ollama")
+		}
+		if cfg.Dimensions != 0 {
+			return EmbedConfig{}, fmt.Errorf("EMBED_DIMENSIONS is not supported with EMBED_PROVIDER=ollama; the model decides")
+		}
+	case "openai":
+		if cfg.Model == "" {
+			return EmbedConfig{}, fmt.Errorf("EMBED_MODEL is required with EMBED_PROVIDER=openai")
+		}
+		if getenv("OPENAI_API_KEY") == "" {
+			return EmbedConfig{}, fmt.Errorf("OPENAI_API_KEY is required with EMBED_PROVIDER=openai")
+		}
+	default:
+		return EmbedConfig{}, fmt.Errorf("unknown EMBED_PROVIDER %q (want one of %s)", cfg.Provider, strings.Join(EmbedProviders, ", "))
+	}
+	return cfg, nil
+}
+
+// Spec is the embedding.NewProvider spec for the config; titan's region
+// is region
+func (c EmbedConfig) Spec(region string) string {
+	query := url.Values{}
+	if c.Dimensions > 0 {
+		query.Set("dims", strconv.Itoa(c.Dimensions))
+	}
+
+	u := url.URL{Scheme: c.Provider}
+	switch c.Provider {
+	case "titan":
+		u.Host, u.Path = region, "/"+c.Model
+	case "ollama":
+		u.Host, u.Path = endpointHost(c.Endpoint), "/"+c.Model
+	case "openai":
+		u.Host = c.Model
+		if c.Endpoint != "" {
+			query.Set("base", c.Endpoint)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// endpointHost is host:port from an endpoint given either as that or as a URL
+func endpointHost(endpoint string) string {
+	if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return endpoint
+}
+
+// NewProvider builds the configured provider through the embedding
+// registry. Titan shares awsConfig instead of loading its own.
+func (c EmbedConfig) NewProvider(awsConfig aws.Config) (embedding.EmbeddingProvider, error) {
+	if c.Provider == "titan" {
+		return embedding.NewTitanClientFromConfig(awsConfig, c.Model, c.Dimensions, true), nil
+	}
+	return embedding.NewProvider(c.Spec(awsConfig.Region))
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"Hippocampus/src/embedding"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// fakeEnv is a getenv over vars
+func fakeEnv(vars map[string]string) func(string) string {
+	return func(name string) string { return vars[name] }
+}
+
+func TestEmbedConfigFromEnvBuildsEachProvider(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		want EmbedConfig
+		spec string
+		// embedder is the provider's Name and dims its Dimensions
+		embedder string
+		dims     int
+	}{
+		{
+			name:     "default is titan",
+			env:      map[string]string{},
+			want:     EmbedConfig{Provider: "titan", Model: embedding.TitanModelID, Dimensions: embedding.TitanDimensions},
+			spec:     "titan://ap-southeast-2/" + embedding.TitanModelID + "?dims=512",
+			embedder: "titan " + embedding.TitanModelID,
+			dims:     512,
+		},
+		{
+			name:     "titan with another model",
+			env:      map[string]string{"EMBED_PROVIDER": " Titan ", "EMBED_MODEL": "amazon.titan-embed-text-v1", "EMBED_DIMENSIONS": "256"},
+			want:     EmbedConfig{Provider: "titan", Model: "amazon.titan-embed-text-v1", Dimensions: 256},
+			spec:     "titan://ap-southeast-2/amazon.titan-embed-text-v1?dims=256",
+			embedder: "titan amazon.titan-embed-text-v1",
+			dims:     256,
+		},
+		{
+			name:     "ollama",
+			env:      map[string]string{"EMBED_PROVIDER": "ollama", "EMBED_MODEL": "nomic-embed-text", "EMBED_ENDPOINT": "http://10.0.0.5:11434/"},
+			want:     EmbedConfig{Provider: "ollama", Model: "nomic-embed-text", Endpoint: "http://10.0.0.5:11434/"},
+			spec:     "ollama://10.0.0.5:11434/nomic-embed-text",
+			embedder: "ollama nomic-embed-text",
+		},
+		{
+			name:     "openai",
+			env:      map[string]string{"EMBED_PROVIDER": "openai", "EMBED_MODEL": "text-embedding-3-small", "EMBED_DIMENSIONS": "512", "OPENAI_API_KEY": "sk-test"},
+			want:     EmbedConfig{Provider: "openai", Model: "text-embedding-3-small", Dimensions: 512},
+			spec:     "openai://text-embedding-3-small?dims=512",
+			embedder: "openai text-embedding-3-small",
+			dims:     512,
+		},
+		{
+			name:     "openai-compatible endpoint",
+			env:      map[string]string{"EMBED_PROVIDER": "openai", "EMBED_MODEL": "bge-small", "EMBED_ENDPOINT": "https://llm.internal/v1", "OPENAI_API_KEY": "sk-test"},
+			want:     EmbedConfig{Provider: "openai", Model: "bge-small", Endpoint: "https://llm.internal/v1"},
+			spec:     "openai://bge-small?base=https%3A%2F%2Fllm.internal%2Fv1",
+			embedder: "openai bge-small",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := EmbedConfigFromEnv(fakeEnv(tt.env))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg != tt.want {
+				t.Fatalf("config %+v, want %+v", cfg, tt.want)
+			}
+			if spec := cfg.Spec("ap-southeast-2"); spec != tt.spec {
+				t.Errorf("spec %q, want %q", spec, tt.spec)
+			}
+
+			provider, err := cfg.NewProvider(aws.Config{Region: "ap-southeast-2"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if provider.Name() != tt.embedder {
+				t.Errorf("embedder %q, want %q", provider.Name(), tt.embedder)
+			}
+			if tt.dims > 0 {
+				if dims, err := provider.Dimensions(); err != nil || dims != tt.dims {
+					t.Errorf("embedder dimensions %d (%v), want %d", dims, err, tt.dims)
+				}
+			}
+		})
+	}
+}
+
+func TestEmbedConfigFromEnvRejectsBadSettings(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string // part of the error
+	}{
+		{"unknown provider", map[string]string{"EMBED_PROVIDER": "cohere"}, `unknown EMBED_PROVIDER "cohere" (want one of titan, ollama, openai)`},
+		{"bad dimensions", map[string]string{"EMBED_DIMENSIONS": "many"}, "EMBED_DIMENSIONS must be a positive integer"},
+		{"negative dimensions", map[string]string{"EMBED_DIMENSIONS": "-512"}, "EMBED_DIMENSIONS must be a positive integer"},
+		{"titan endpoint", map[string]string{"EMBED_ENDPOINT": "http://localhost"}, "EMBED_ENDPOINT is not used with EMBED_PROVIDER=titan"},
+		{"ollama without model", map[string]string{"EMBED_PROVIDER": "ollama"}, "EMBED_MODEL is required with EMBED_PROVIDER=ollama"},
+		{"ollama dimensions", map[string]string{"EMBED_PROVIDER": "ollama", "EMBED_MODEL": "nomic-embed-text", "EMBED_DIMENSIONS": "512"}, "EMBED_DIMENSIONS is not supported"},
+		{"openai without model", map[string]string{"EMBED_PROVIDER": "openai", "OPENAI_API_KEY": "sk-test"}, "EMBED_MODEL is required with EMBED_PROVIDER=openai"},
+		{"openai without key", map[string]string{"EMBED_PROVIDER": "openai", "EMBED_MODEL": "text-embedding-3-small"}, "OPENAI_API_KEY is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := EmbedConfigFromEnv(fakeEnv(tt.env))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got %+v, error %v; want an error containing %q", cfg, err, tt.want)
+			}
+		})
+	}
+}
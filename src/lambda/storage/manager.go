@@ -2,115 +2,417 @@ package storage
 
 import (
 	"Hippocampus/src/client"
+	"Hippocampus/src/embedding"
+	"Hippocampus/src/lambda/logging"
+	hippostorage "Hippocampus/src/storage"
+	"Hippocampus/src/types"
+	"context"
 	"fmt"
 	"os"
-	"path/filepath"
 	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
 )
 
-// In storage/manager.go - NO awsConfig field
+// Manager owns the agent databases on EFS and their S3 backups. Its AWS
+// config is loaded once and shared by S3, the embedder and the handlers.
 type Manager struct {
 	efsPath      string
 	s3Bucket     string
 	region       string
+	awsConfig    aws.Config
 	clients      map[string]*client.Client
+	agentLocks   map[string]*agentLock // guarded by clientsMutex, like clients
+	dirty        map[string]bool       // agents flushed since their last upload; guarded by clientsMutex
+	lastUpload   map[string]time.Time  // when each agent was last uploaded; guarded by clientsMutex
+	syncInterval time.Duration         // see SetSyncInterval
+	now          func() time.Time      // time.Now, replaced in tests
+	summarizing  map[string]bool       // agent/conversation pairs being summarized; guarded by clientsMutex
+	pendingDims  map[string]int        // new agents' key widths, set by their first insert; guarded by clientsMutex
 	clientsMutex sync.RWMutex
 	s3Sync       *S3Sync
+	logger       logging.Logger
+	embedder     embedding.EmbeddingProvider // Shared by every agent client
 }
 
-// NewManager stays simple
+// NewManager loads the AWS config for region and builds the manager on it
 func NewManager(efsPath, s3Bucket, region string) (*Manager, error) {
+	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	return NewManagerWithConfig(efsPath, cfg, NewS3Sync(s3Bucket, cfg))
+}
+
+// NewManagerWithConfig is a manager using cfg for AWS and s3Sync for
+// backups, which tests can build over a fake S3
+func NewManagerWithConfig(efsPath string, cfg aws.Config, s3Sync *S3Sync) (*Manager, error) {
 	if err := os.MkdirAll(efsPath, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create EFS directory: %w", err)
 	}
-	
-	s3Sync, err := NewS3Sync(s3Bucket, region)
-	if err != nil {
-		return nil, fmt.Errorf("failed to initialize S3 sync: %w", err)
-	}
-	
+
 	return &Manager{
-		efsPath:  efsPath,
-		s3Bucket: s3Bucket,
-		region:   region,
-		clients:  make(map[string]*client.Client),
-		s3Sync:   s3Sync,
+		efsPath:     efsPath,
+		s3Bucket:    s3Sync.bucket,
+		region:      cfg.Region,
+		awsConfig:   cfg,
+		clients:     make(map[string]*client.Client),
+		agentLocks:  make(map[string]*agentLock),
+		dirty:       make(map[string]bool),
+		lastUpload:  make(map[string]time.Time),
+		now:         time.Now,
+		summarizing: make(map[string]bool),
+		pendingDims: make(map[string]int),
+		s3Sync:      s3Sync,
+		logger:      logging.Default(),
+		embedder:    embedding.NewTitanClientFromConfig(cfg, embedding.TitanModelID, embedding.TitanDimensions, true),
 	}, nil
 }
 
+// SetLogger replaces the logger used by the manager and its S3 sync
+func (m *Manager) SetLogger(logger logging.Logger) {
+	m.logger = logger
+	m.s3Sync.logger = logger
+}
+
 // Add method to get region
 func (m *Manager) GetRegion() string {
 	return m.region
 }
 
-func (m *Manager) getClient(agentID string) (*client.Client, error) {
+// SetEmbedder replaces the embedding provider for agents loaded from now
+// on; call it before serving requests
+func (m *Manager) SetEmbedder(embedder embedding.EmbeddingProvider) {
+	m.embedder = embedder
+}
+
+// AWSConfig is the config the manager loaded, for other AWS clients to share
+func (m *Manager) AWSConfig() aws.Config {
+	return m.awsConfig
+}
+
+// getClient returns the agent's client, loading it from EFS or S3 on first
+// use. Callers hold the agent's lock, so clientsMutex is only taken to read
+// and publish the map; the download doesn't hold up other agents.
+func (m *Manager) getClient(ctx context.Context, agentID string) (*client.Client, error) {
 	m.clientsMutex.RLock()
-	if c, ok := m.clients[agentID]; ok {
-		m.clientsMutex.RUnlock()
+	c, ok := m.clients[agentID]
+	m.clientsMutex.RUnlock()
+	if ok {
 		return c, nil
 	}
+
+	start := time.Now()
+	filePath := m.agentPath(agentID)
+
+	_, err := os.Stat(filePath)
+	if os.IsNotExist(err) {
+		if err := m.s3Sync.DownloadIfExists(ctx, agentID, filePath); err != nil {
+			return nil, fmt.Errorf("failed to download from S3: %w", err)
+		}
+		_, err = os.Stat(filePath)
+	}
+	exists := err == nil
+
+	// Every agent shares the manager's AWS config and embedder, so a cold
+	// agent costs a file open rather than another config load
+	c, err = client.NewFromConfig(hippostorage.New(filePath), m.awsConfig, m.embedder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+
+	// Keys are 512 wide, so a different embedder's vectors are projected.
+	// Setting that up writes the file, so a new agent waits for its first
+	// insert (see prepareInsert) rather than being created by a search.
+	width, err := m.embedder.Dimensions()
+	if err != nil {
+		return nil, fmt.Errorf("embedding dimensions: %w", err)
+	}
+	dims := 0
+	if width != embedding.TitanDimensions {
+		dims = min(width, embedding.TitanDimensions)
+	}
+	if dims > 0 && exists {
+		if err := c.SetDimensions(dims); err != nil {
+			return nil, fmt.Errorf("failed to set dimensions: %w", err)
+		}
+		dims = 0
+	}
+
+	m.clientsMutex.Lock()
+	m.clients[agentID] = c
+	if dims > 0 {
+		m.pendingDims[agentID] = dims
+	}
+	m.clientsMutex.Unlock()
+
+	m.logger.Info(ctx, "agent client loaded", logging.Fields{
+		"agent_id":   agentID,
+		"latency_ms": time.Since(start).Milliseconds(),
+	})
+	return c, nil
+}
+
+// prepareInsert sets the key width getClient put off for a new agent. Call
+// it with the agent's lock held before anything is stored.
+func (m *Manager) prepareInsert(agentID string, c *client.Client) error {
+	m.clientsMutex.RLock()
+	dims := m.pendingDims[agentID]
 	m.clientsMutex.RUnlock()
+	if dims == 0 {
+		return nil
+	}
 
+	if err := c.SetDimensions(dims); err != nil {
+		return fmt.Errorf("failed to set dimensions: %w", err)
+	}
+	m.clientsMutex.Lock()
+	delete(m.pendingDims, agentID)
+	m.clientsMutex.Unlock()
+	return nil
+}
+
+// insertClient is getClient for an operation about to store nodes
+func (m *Manager) insertClient(ctx context.Context, agentID string) (*client.Client, error) {
+	c, err := m.getClient(ctx, agentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.prepareInsert(agentID, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// unwritten reports whether the agent is new and nothing has been stored
+// for it, so a search has nothing to find
+func (m *Manager) unwritten(agentID string) bool {
+	m.clientsMutex.RLock()
+	defer m.clientsMutex.RUnlock()
+	return m.pendingDims[agentID] > 0
+}
+
+// agentLock serializes work on one agent: anything that touches the agent's
+// client or file, uploads included, so a file is never copied mid-Flush
+type agentLock struct {
+	ops sync.Mutex
+}
+
+// agentLockFor returns the agent's lock, creating it on first use. Entries
+// are never removed, so every caller for an agent shares one lock even
+// across DeleteAgent.
+func (m *Manager) agentLockFor(agentID string) *agentLock {
 	m.clientsMutex.Lock()
 	defer m.clientsMutex.Unlock()
 
-	if c, ok := m.clients[agentID]; ok {
-		return c, nil
+	l, ok := m.agentLocks[agentID]
+	if !ok {
+		l = &agentLock{}
+		m.agentLocks[agentID] = l
 	}
+	return l
+}
+
+// lockAgent blocks other operations on agentID until the returned func is
+// called. Different agents never wait on each other.
+func (m *Manager) lockAgent(agentID string) func() {
+	l := m.agentLockFor(agentID)
+	l.ops.Lock()
+	return l.ops.Unlock
+}
 
-	filePath := filepath.Join(m.efsPath, fmt.Sprintf("%s.bin", agentID))
+// Warmup loads each agent's database and builds its index ahead of the
+// first request, logging how long each phase took. An agent that fails is
+// logged and skipped; the error returned is ctx's if it ended first.
+func (m *Manager) Warmup(ctx context.Context, agentIDs []string) error {
+	for _, agentID := range agentIDs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		if err := m.s3Sync.DownloadIfExists(agentID, filePath); err != nil {
-			return nil, fmt.Errorf("failed to download from S3: %w", err)
+		unlock := m.lockAgent(agentID)
+		c, err := m.getClient(ctx, agentID)
+		var stats client.WarmupStats
+		if err == nil {
+			stats, err = c.Warmup(ctx)
 		}
+		unlock()
+
+		if err != nil {
+			m.logger.Warn(ctx, "agent warmup failed", logging.Fields{
+				"agent_id": agentID,
+				"error":    err.Error(),
+			})
+			continue
+		}
+		m.logger.Info(ctx, "agent warmed up", logging.Fields{
+			"agent_id": agentID,
+			"nodes":    stats.Nodes,
+			"load_ms":  stats.Load.Milliseconds(),
+			"index_ms": stats.Index.Milliseconds(),
+		})
 	}
+	return ctx.Err()
+}
+
+func (m *Manager) Insert(ctx context.Context, agentID, key, text string) error {
+	_, err := m.InsertStats(ctx, agentID, key, text)
+	return err
+}
 
-	c, err := client.New(filePath, m.region)
+// InsertStats is Insert reporting the insert and the flush that follows it
+func (m *Manager) InsertStats(ctx context.Context, agentID, key, text string) (client.OperationStats, error) {
+	unlock := m.lockAgent(agentID)
+	defer unlock()
+
+	c, err := m.insertClient(ctx, agentID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create client: %w", err)
+		return client.OperationStats{}, err
 	}
 
-	m.clients[agentID] = c
-	return c, nil
+	stats, err := c.InsertStats(key, text, nil)
+	if err != nil {
+		return stats, err
+	}
+
+	// Upload only what is fully on EFS
+	flushed, err := c.FlushStats()
+	if err != nil {
+		return stats, err
+	}
+	stats.AddFlush(flushed)
+	m.markDirty(agentID)
+
+	return stats, nil
 }
 
-func (m *Manager) Insert(agentID, key, text string) error {
-	c, err := m.getClient(agentID)
+// Upsert stores text as the agent's node with ID key, treating nodes already
+// stored under it as policy says (see client.Upsert). A skip changes nothing,
+// so it neither flushes nor marks the agent for the next S3 sync.
+func (m *Manager) Upsert(ctx context.Context, agentID, key, text string, policy client.ConflictPolicy) (client.UpsertResult, client.OperationStats, error) {
+	unlock := m.lockAgent(agentID)
+	defer unlock()
+
+	c, err := m.insertClient(ctx, agentID)
 	if err != nil {
-		return err
+		return client.UpsertResult{}, client.OperationStats{}, err
+	}
+
+	result, stats, err := c.Upsert(key, text, nil, policy)
+	if err != nil || result.Outcome == client.UpsertSkipped {
+		return result, stats, err
+	}
+
+	// Upload only what is fully on EFS
+	flushed, err := c.FlushStats()
+	if err != nil {
+		return result, stats, err
 	}
+	stats.AddFlush(flushed)
+	m.markDirty(agentID)
 
-	if err := c.Insert(key, text); err != nil {
+	return result, stats, nil
+}
+
+// Begin opens a batch of inserts for the agent; see client.Batch. The batch
+// only buffers, so the agent stays unlocked until Commit.
+func (m *Manager) Begin(ctx context.Context, agentID string) (*client.Batch, error) {
+	unlock := m.lockAgent(agentID)
+	defer unlock()
+
+	c, err := m.getClient(ctx, agentID)
+	if err != nil {
+		return nil, err
+	}
+	return c.Begin(), nil
+}
+
+// Commit stores everything in batch, opened with Begin for the same agent,
+// and queues the flushed file for upload
+func (m *Manager) Commit(ctx context.Context, agentID string, batch *client.Batch) error {
+	unlock := m.lockAgent(agentID)
+	defer unlock()
+
+	// A DeleteAgent since Begin evicted the batch's client; committing
+	// through it would bring the deleted file back
+	m.clientsMutex.RLock()
+	current := m.clients[agentID]
+	m.clientsMutex.RUnlock()
+	if current != batch.Client() {
+		batch.Discard()
+		return fmt.Errorf("agent %s was deleted while the batch was open", agentID)
+	}
+	if err := m.prepareInsert(agentID, current); err != nil {
+		batch.Discard()
 		return err
 	}
 
-	filePath := filepath.Join(m.efsPath, fmt.Sprintf("%s.bin", agentID))
-	go m.s3Sync.Upload(agentID, filePath)
+	// Commit flushes once when it finishes
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+	m.markDirty(agentID)
 
 	return nil
 }
 
-func (m *Manager) Search(agentID, text string, epsilon float32, threshold float32, topK int) (interface{}, error) {
-	c, err := m.getClient(agentID)
+func (m *Manager) Search(ctx context.Context, agentID, text string, epsilon float32, threshold float32, topK int) (interface{}, error) {
+	unlock := m.lockAgent(agentID)
+	defer unlock()
+
+	c, err := m.getClient(ctx, agentID)
 	if err != nil {
 		return nil, err
 	}
+	if m.unwritten(agentID) {
+		return []string{}, nil
+	}
 	return c.Search(text, epsilon, threshold, topK)
 }
 
-func (m *Manager) InsertCSV(agentID, csvFile string) error {
-	c, err := m.getClient(agentID)
+func (m *Manager) SearchDetailed(ctx context.Context, agentID, text string, epsilon float32, threshold float32, topK int, opts types.SearchOptions) ([]client.SearchResult, error) {
+	results, _, err := m.SearchStats(ctx, agentID, text, epsilon, threshold, topK, opts)
+	return results, err
+}
+
+// SearchStats is SearchDetailed that also reports the search's timings
+func (m *Manager) SearchStats(ctx context.Context, agentID, text string, epsilon float32, threshold float32, topK int, opts types.SearchOptions) ([]client.SearchResult, client.OperationStats, error) {
+	opts.Epsilon, opts.Threshold, opts.TopK = epsilon, threshold, topK
+	return m.SearchOpts(ctx, agentID, text, opts)
+}
+
+// SearchOpts is SearchStats taking epsilon, threshold and topK from opts
+func (m *Manager) SearchOpts(ctx context.Context, agentID, text string, opts types.SearchOptions) ([]client.SearchResult, client.OperationStats, error) {
+	unlock := m.lockAgent(agentID)
+	defer unlock()
+
+	c, err := m.getClient(ctx, agentID)
+	if err != nil {
+		return nil, client.OperationStats{}, err
+	}
+	if m.unwritten(agentID) {
+		return []client.SearchResult{}, client.OperationStats{}, nil
+	}
+	return c.SearchOpts(text, opts)
+}
+
+func (m *Manager) InsertCSV(ctx context.Context, agentID, csvFile string) error {
+	unlock := m.lockAgent(agentID)
+	defer unlock()
+
+	c, err := m.insertClient(ctx, agentID)
 	if err != nil {
 		return err
 	}
 
+	// InsertCSV flushes when it finishes
 	if err := c.InsertCSV(csvFile); err != nil {
 		return err
 	}
-
-	filePath := filepath.Join(m.efsPath, fmt.Sprintf("%s.bin", agentID))
-	go m.s3Sync.Upload(agentID, filePath)
+	m.markDirty(agentID)
 
 	return nil
 }
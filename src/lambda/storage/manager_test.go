@@ -0,0 +1,255 @@
+package storage
+
+import (
+	"Hippocampus/src/embedding"
+	"Hippocampus/src/lambda/logging"
+	hippostorage "Hippocampus/src/storage"
+	"Hippocampus/src/types"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// fakeS3 is an in-memory S3API. Calls to its methods wait on block when it
+// is set, so tests can hold a request in flight.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	puts    int // PutObject calls, guarded by mu
+	block   chan struct{}
+	calls   chan string // method names, as each call starts, when set
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: make(map[string][]byte)}
+}
+
+func (f *fakeS3) enter(method string) {
+	if f.calls != nil {
+		f.calls <- method
+	}
+	if f.block != nil {
+		<-f.block
+	}
+}
+
+func (f *fakeS3) Download(ctx context.Context, bucket, key, ifNoneMatch string, w io.WriterAt) (string, error) {
+	f.enter("Download")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.objects[key]
+	if !ok {
+		return "", hippostorage.ErrObjectNotFound
+	}
+	_, err := w.WriteAt(data, 0)
+	return "etag", err
+}
+
+func (f *fakeS3) PutObject(ctx context.Context, bucket, key string, body io.Reader) (string, error) {
+	f.enter("PutObject")
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.objects[key] = data
+	f.puts++
+	return "etag", nil
+}
+
+func (f *fakeS3) HeadObject(ctx context.Context, bucket, key string) (int64, error) {
+	f.enter("HeadObject")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.objects[key]
+	if !ok {
+		return 0, hippostorage.ErrObjectNotFound
+	}
+	return int64(len(data)), nil
+}
+
+func (f *fakeS3) DeleteObject(ctx context.Context, bucket, key string) error {
+	f.enter("DeleteObject")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.objects, key)
+	return nil
+}
+
+func (f *fakeS3) ListObjects(ctx context.Context, bucket, prefix string, fn func(key string, size int64)) error {
+	f.enter("ListObjects")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for key, data := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			fn(key, int64(len(data)))
+		}
+	}
+	return nil
+}
+
+// newTestManager is a manager over a temporary EFS directory and s3,
+// embedding dims-wide vectors with a HashingProvider
+func newTestManager(t *testing.T, s3 *fakeS3, dims int) *Manager {
+	t.Helper()
+	m, err := NewManagerWithConfig(t.TempDir(), aws.Config{Region: "us-east-1"}, NewS3SyncWithAPI("bucket", s3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetLogger(logging.NewJSON(io.Discard))
+	m.SetEmbedder(embedding.NewHashingProvider(dims, 1))
+	return m
+}
+
+func TestSearchNewAgentWritesNothing(t *testing.T) {
+	m := newTestManager(t, newFakeS3(), 768)
+	ctx := context.Background()
+
+	results, _, err := m.SearchStats(ctx, "agent", "anything", 1, 0.5, 5, types.SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Fatalf("new agent returned %d results", len(results))
+	}
+	if _, err := os.Stat(m.agentPath("agent")); !os.IsNotExist(err) {
+		t.Fatalf("search created the agent's file (stat error %v)", err)
+	}
+
+	// The first insert sets the projection the 768-wide vectors need
+	if err := m.Insert(ctx, "agent", "k", "the first memory"); err != nil {
+		t.Fatal(err)
+	}
+	results, _, err = m.SearchStats(ctx, "agent", "the first memory", 1, 0.5, 5, types.SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Text != "the first memory" {
+		t.Fatalf("results = %+v, want the inserted memory", results)
+	}
+}
+
+func TestGetClientDownloadDoesNotBlockOtherAgents(t *testing.T) {
+	s3 := newFakeS3()
+	m := newTestManager(t, s3, 512)
+	ctx := context.Background()
+	if err := m.Insert(ctx, "ready", "k", "already loaded"); err != nil {
+		t.Fatal(err)
+	}
+
+	s3.calls = make(chan string, 1)
+	s3.block = make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := m.SearchStats(ctx, "remote", "x", 1, 0.5, 5, types.SearchOptions{})
+		done <- err
+	}()
+	if method := <-s3.calls; method != "Download" {
+		t.Fatalf("first S3 call was %s, want Download", method)
+	}
+
+	// The download is still in flight; another agent must not wait on it
+	s3.calls = nil
+	results, _, err := m.SearchStats(ctx, "ready", "already loaded", 1, 0.5, 5, types.SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+
+	close(s3.block)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetClientDownloadsFromS3(t *testing.T) {
+	s3 := newFakeS3()
+	source := newTestManager(t, s3, 512)
+	ctx := context.Background()
+	if err := source.Insert(ctx, "agent", "k", "backed up memory"); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.ReadFile(source.agentPath("agent"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s3.objects[agentKey("agent")] = file
+
+	m := newTestManager(t, s3, 512)
+	results, _, err := m.SearchStats(ctx, "agent", "backed up memory", 1, 0.5, 5, types.SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Text != "backed up memory" {
+		t.Fatalf("results = %+v, want the backed up memory", results)
+	}
+	onEFS, err := os.ReadFile(m.agentPath("agent"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(onEFS, file) {
+		t.Fatal("downloaded file differs from the S3 object")
+	}
+}
+
+func TestAgentClientsShareManagerConfig(t *testing.T) {
+	cfg := aws.Config{Region: "eu-west-1", AppID: "hippocampus-test"}
+	m, err := NewManagerWithConfig(t.TempDir(), cfg, NewS3SyncWithAPI("bucket", newFakeS3()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetLogger(logging.NewJSON(io.Discard))
+	embedder := embedding.NewHashingProvider(512, 1)
+	m.SetEmbedder(embedder)
+
+	for _, agentID := range []string{"a", "b"} {
+		c, err := m.getClient(context.Background(), agentID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Embedder != embedder {
+			t.Errorf("agent %s embeds with %T, not the manager's embedder", agentID, c.Embedder)
+		}
+		if c.Region != "eu-west-1" || c.AWS.AppID != "hippocampus-test" {
+			t.Errorf("agent %s has region %q, app ID %q; want the manager's config", agentID, c.Region, c.AWS.AppID)
+		}
+		if fs, ok := c.Storage.(*hippostorage.FileStorage); !ok || fs.Path() != m.agentPath(agentID) {
+			t.Errorf("agent %s stores to %#v, want its EFS file", agentID, c.Storage)
+		}
+	}
+}
+
+func TestSyncUploadsToAgentKey(t *testing.T) {
+	s3 := newFakeS3()
+	m := newTestManager(t, s3, 512)
+	ctx := context.Background()
+	if err := m.Insert(ctx, "agent", "k", "a memory"); err != nil {
+		t.Fatal(err)
+	}
+	if len(s3.objects) != 0 {
+		t.Fatalf("insert uploaded before the sync: %v", s3.objects)
+	}
+
+	if n, err := m.SyncDirty(ctx); err != nil || n != 1 {
+		t.Fatalf("SyncDirty = %d, %v; want 1 upload", n, err)
+	}
+	file, err := os.ReadFile(m.agentPath("agent"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(s3.objects["agents/agent.bin"], file) {
+		t.Fatalf("S3 holds %d objects, want agents/agent.bin matching the EFS file", len(s3.objects))
+	}
+	if !m.s3Sync.Exists("agent") || m.s3Sync.Exists("other") {
+		t.Error("Exists does not follow the agents/<id>.bin layout")
+	}
+}
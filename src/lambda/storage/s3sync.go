@@ -1,85 +1,116 @@
 package storage
 
 import (
+	"Hippocampus/src/lambda/logging"
+	hippostorage "Hippocampus/src/storage"
+	"context"
 	"fmt"
-	"os"
+	"strings"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go-v2/aws"
 )
 
+// S3Sync backs agent databases up to S3, one object per agent under
+// agents/, each a hippostorage.S3Backend whose local copy is the EFS file
 type S3Sync struct {
-	bucket     string
-	uploader   *s3manager.Uploader
-	downloader *s3manager.Downloader
-	s3Client   *s3.S3
+	bucket string
+	api    hippostorage.S3API
+	logger logging.Logger
 }
 
-func NewS3Sync(bucket, region string) (*S3Sync, error) {
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(region),
-	})
-	if err != nil {
-		return nil, err
-	}
+// NewS3Sync backs up to bucket with the AWS config the caller already loaded
+func NewS3Sync(bucket string, cfg aws.Config) *S3Sync {
+	return NewS3SyncWithAPI(bucket, hippostorage.NewS3ClientFromConfig(cfg))
+}
 
+// NewS3SyncWithAPI is an S3Sync talking to api, such as
+// hippostorage.NewS3ClientWith over a fake Uploader and Downloader in tests
+func NewS3SyncWithAPI(bucket string, api hippostorage.S3API) *S3Sync {
 	return &S3Sync{
-		bucket:     bucket,
-		uploader:   s3manager.NewUploader(sess),
-		downloader: s3manager.NewDownloader(sess),
-		s3Client:   s3.New(sess),
-	}, nil
+		bucket: bucket,
+		api:    api,
+		logger: logging.Default(),
+	}
+}
+
+// agentKey is where the agent's database lives in the bucket
+func agentKey(agentID string) string {
+	return fmt.Sprintf("agents/%s.bin", agentID)
 }
 
-func (s *S3Sync) Upload(agentID, filePath string) error {
-	file, err := os.Open(filePath)
+// backend is the agent's object with filePath as its local copy
+func (s *S3Sync) backend(agentID, filePath string) *hippostorage.S3Backend {
+	return hippostorage.NewS3BackendAt(s.api, s.bucket, agentKey(agentID), filePath)
+}
+
+// Upload copies the agent's file to S3. ctx only carries the correlation ID for logging.
+func (s *S3Sync) Upload(ctx context.Context, agentID, filePath string) error {
+	start := time.Now()
+	err := s.backend(agentID, filePath).Upload(context.WithoutCancel(ctx))
+
+	fields := logging.Fields{
+		"agent_id":   agentID,
+		"latency_ms": time.Since(start).Milliseconds(),
+	}
 	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
+		fields["error"] = err.Error()
+		s.logger.Error(ctx, "s3 upload failed", fields)
+		return err
 	}
-	defer file.Close()
 
-	key := fmt.Sprintf("agents/%s.bin", agentID)
+	s.logger.Info(ctx, "s3 upload complete", fields)
+	return nil
+}
 
-	_, err = s.uploader.Upload(&s3manager.UploadInput{
-		Bucket: aws.String(s.bucket),
-		Key:    aws.String(key),
-		Body:   file,
-	})
+// DownloadIfExists fetches the agent's database to filePath, leaving it
+// alone when the agent has nothing in S3 or the copy there is unchanged
+func (s *S3Sync) DownloadIfExists(ctx context.Context, agentID, filePath string) error {
+	start := time.Now()
 
+	found, err := s.backend(agentID, filePath).Download(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to upload to S3: %w", err)
+		return err
+	}
+	if !found {
+		return nil
 	}
 
+	s.logger.Info(ctx, "s3 download complete", logging.Fields{
+		"agent_id":   agentID,
+		"latency_ms": time.Since(start).Milliseconds(),
+	})
+
 	return nil
 }
 
-func (s *S3Sync) DownloadIfExists(agentID, filePath string) error {
-	key := fmt.Sprintf("agents/%s.bin", agentID)
+// ListAgents returns the size of every agent database stored under the agents/ prefix
+func (s *S3Sync) ListAgents() (map[string]int64, error) {
+	agents := make(map[string]int64)
 
-	_, err := s.s3Client.HeadObject(&s3.HeadObjectInput{
-		Bucket: aws.String(s.bucket),
-		Key:    aws.String(key),
+	err := s.api.ListObjects(context.Background(), s.bucket, "agents/", func(key string, size int64) {
+		name := strings.TrimPrefix(key, "agents/")
+		if !strings.HasSuffix(name, ".bin") || strings.Contains(name, "/") {
+			return
+		}
+		agents[strings.TrimSuffix(name, ".bin")] = size
 	})
 
 	if err != nil {
-		return nil
+		return nil, fmt.Errorf("failed to list S3 objects: %w", err)
 	}
 
-	file, err := os.Create(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
-	}
-	defer file.Close()
+	return agents, nil
+}
 
-	_, err = s.downloader.Download(file, &s3.GetObjectInput{
-		Bucket: aws.String(s.bucket),
-		Key:    aws.String(key),
-	})
+func (s *S3Sync) Exists(agentID string) bool {
+	_, err := s.api.HeadObject(context.Background(), s.bucket, agentKey(agentID))
+	return err == nil
+}
 
-	if err != nil {
-		return fmt.Errorf("failed to download from S3: %w", err)
+func (s *S3Sync) Delete(agentID string) error {
+	if err := s.api.DeleteObject(context.Background(), s.bucket, agentKey(agentID)); err != nil {
+		return fmt.Errorf("failed to delete from S3: %w", err)
 	}
 
 	return nil
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// markDirty records that the agent's file on EFS is newer than its S3 copy.
+// The next sync uploads it once however many flushes came in between.
+func (m *Manager) markDirty(agentID string) {
+	m.clientsMutex.Lock()
+	m.dirty[agentID] = true
+	m.clientsMutex.Unlock()
+}
+
+// SetSyncInterval spaces each agent's uploads by SyncDue at least interval
+// apart. Writes inside the interval wait for a later invocation's SyncDue
+// or for SyncDirty; 0, the default, uploads at the end of every invocation
+// that wrote.
+func (m *Manager) SetSyncInterval(interval time.Duration) {
+	m.syncInterval = interval
+}
+
+// SyncDue uploads the dirty agents whose last upload is at least the sync
+// interval old and returns how many it uploaded. The handler calls it
+// before each invocation returns: Lambda freezes the execution environment
+// between invocations, so nothing can upload in the background.
+func (m *Manager) SyncDue(ctx context.Context) (int, error) {
+	return m.sync(ctx, false)
+}
+
+// SyncDirty uploads every agent flushed since its last upload, regardless
+// of the sync interval, and returns how many it uploaded
+func (m *Manager) SyncDirty(ctx context.Context) (int, error) {
+	return m.sync(ctx, true)
+}
+
+// sync uploads the dirty agents, only those due unless force is set. Each
+// upload holds the agent's lock, so it never reads a file mid-Flush. An
+// agent whose upload fails stays dirty for the next sync; the error is the
+// first failure.
+func (m *Manager) sync(ctx context.Context, force bool) (int, error) {
+	now := m.now()
+	m.clientsMutex.RLock()
+	agentIDs := make([]string, 0, len(m.dirty))
+	for agentID := range m.dirty {
+		if force || now.Sub(m.lastUpload[agentID]) >= m.syncInterval {
+			agentIDs = append(agentIDs, agentID)
+		}
+	}
+	m.clientsMutex.RUnlock()
+
+	uploaded := 0
+	var first error
+	for _, agentID := range agentIDs {
+		// S3Sync.Upload logs each failure itself
+		done, err := m.syncAgent(ctx, agentID)
+		if done {
+			uploaded++
+		}
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return uploaded, first
+}
+
+// syncAgent uploads the agent if it is still dirty once its lock is held,
+// reporting whether it did; a delete or another sync may have got there first
+func (m *Manager) syncAgent(ctx context.Context, agentID string) (bool, error) {
+	unlock := m.lockAgent(agentID)
+	defer unlock()
+
+	m.clientsMutex.Lock()
+	dirty := m.dirty[agentID]
+	delete(m.dirty, agentID)
+	m.clientsMutex.Unlock()
+	if !dirty {
+		return false, nil
+	}
+
+	if err := m.s3Sync.Upload(ctx, agentID, m.agentPath(agentID)); err != nil {
+		m.markDirty(agentID)
+		return false, err
+	}
+
+	m.clientsMutex.Lock()
+	m.lastUpload[agentID] = m.now()
+	m.clientsMutex.Unlock()
+	return true, nil
+}
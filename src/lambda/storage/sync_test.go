@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// uploads reports how many objects s3 has been sent
+func (f *fakeS3) uploads() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.puts
+}
+
+func TestSyncCoalescesWrites(t *testing.T) {
+	s3 := newFakeS3()
+	m := newTestManager(t, s3, 512)
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+	m.SetSyncInterval(10 * time.Second)
+
+	insert := func(agentID string, n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			if err := m.Insert(ctx, agentID, fmt.Sprint(i), fmt.Sprintf("%s memory %d", agentID, i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	syncDue := func(want int) {
+		t.Helper()
+		if n, err := m.SyncDue(ctx); err != nil || n != want {
+			t.Fatalf("SyncDue = %d, %v; want %d uploads", n, err, want)
+		}
+	}
+
+	// A burst of flushes is one upload per agent
+	insert("a", 20)
+	insert("b", 3)
+	syncDue(2)
+	if got := s3.uploads(); got != 2 {
+		t.Fatalf("%d uploads after the burst, want 2", got)
+	}
+	syncDue(0)
+
+	// Writes inside the interval wait for it to pass
+	now = now.Add(time.Second)
+	insert("a", 5)
+	syncDue(0)
+	now = now.Add(9 * time.Second)
+	syncDue(1)
+
+	// SyncDirty ignores the interval
+	insert("b", 1)
+	if n, err := m.SyncDirty(ctx); err != nil || n != 1 {
+		t.Fatalf("SyncDirty = %d, %v; want 1 upload", n, err)
+	}
+	if got := s3.uploads(); got != 4 {
+		t.Fatalf("%d uploads in all, want 4", got)
+	}
+}
+
+func TestSyncWithoutIntervalUploadsEachInvocation(t *testing.T) {
+	s3 := newFakeS3()
+	m := newTestManager(t, s3, 512)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if err := m.Insert(ctx, "agent", fmt.Sprint(i), fmt.Sprintf("memory %d", i)); err != nil {
+			t.Fatal(err)
+		}
+		if n, err := m.SyncDue(ctx); err != nil || n != 1 {
+			t.Fatalf("invocation %d: SyncDue = %d, %v; want 1 upload", i, n, err)
+		}
+	}
+	if n, _ := m.SyncDue(ctx); n != 0 {
+		t.Fatalf("SyncDue with nothing written uploaded %d agents", n)
+	}
+	if got := s3.uploads(); got != 3 {
+		t.Fatalf("%d uploads, want 3", got)
+	}
+}
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"io"
+	"log"
+	"time"
+)
+
+// InsertTiming breaks a single insert down into its phases
+type InsertTiming struct {
+	Embed  time.Duration
+	Load   time.Duration
+	Insert time.Duration
+	Flush  time.Duration
+}
+
+// SearchTiming breaks a single search down into its phases
+type SearchTiming struct {
+	Embed   time.Duration
+	Load    time.Duration
+	Search  time.Duration
+	Results int
+}
+
+// Collector receives client operation timings. Implementations must be safe
+// for concurrent use.
+type Collector interface {
+	ObserveInsert(t InsertTiming)
+	ObserveSearch(t SearchTiming)
+	ObserveFlush(d time.Duration)
+	ObserveLoad(d time.Duration, nodes int)
+	SetNodeCount(nodes int)
+}
+
+// Noop discards everything; it is the client default
+type Noop struct{}
+
+func (Noop) ObserveInsert(InsertTiming)     {}
+func (Noop) ObserveSearch(SearchTiming)     {}
+func (Noop) ObserveFlush(time.Duration)     {}
+func (Noop) ObserveLoad(time.Duration, int) {}
+func (Noop) SetNodeCount(int)               {}
+
+// TimingPrinter writes human-readable TIMING: lines. They are for people
+// watching a run; tools should read client.OperationStats instead.
+type TimingPrinter struct {
+	log *log.Logger
+}
+
+// NewTimingPrinter writes bare lines to out
+func NewTimingPrinter(out io.Writer) *TimingPrinter {
+	return &TimingPrinter{log: log.New(out, "", 0)}
+}
+
+// NewTimingLogger writes through l, with its prefix and flags
+func NewTimingLogger(l *log.Logger) *TimingPrinter {
+	return &TimingPrinter{log: l}
+}
+
+func (p *TimingPrinter) ObserveInsert(t InsertTiming) {
+	p.log.Printf("TIMING:EMBED:%.3f:LOAD:%.3f:INSERT:%.3f:FLUSH:%.3f",
+		millis(t.Embed), millis(t.Load), millis(t.Insert), millis(t.Flush))
+}
+
+func (p *TimingPrinter) ObserveSearch(t SearchTiming) {
+	p.log.Printf("TIMING:EMBED:%.3f:LOAD:%.6f:SEARCH:%.6f",
+		millis(t.Embed), millis(t.Load), millis(t.Search))
+}
+
+func (p *TimingPrinter) ObserveFlush(time.Duration)     {}
+func (p *TimingPrinter) ObserveLoad(time.Duration, int) {}
+func (p *TimingPrinter) SetNodeCount(int)               {}
+
+func millis(d time.Duration) float64 {
+	return d.Seconds() * 1000
+}
@@ -0,0 +1,239 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Latency buckets in seconds, from sub-millisecond searches to slow Bedrock calls
+var defaultBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+type histogram struct {
+	name    string
+	help    string
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(name, help string) *histogram {
+	return &histogram{
+		name:    name,
+		help:    help,
+		buckets: defaultBuckets,
+		counts:  make([]uint64, len(defaultBuckets)),
+	}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	v := d.Seconds()
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", h.name, h.help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", h.name)
+	for i, upper := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%g\"} %d\n", h.name, upper, h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(w, "%s_sum %g\n", h.name, h.sum)
+	fmt.Fprintf(w, "%s_count %d\n", h.name, h.count)
+}
+
+// Prometheus keeps counters and latency histograms in memory and renders them
+// in the Prometheus text exposition format.
+type Prometheus struct {
+	mu sync.Mutex
+
+	insert *histogram
+	search *histogram
+	embed  *histogram
+	flush  *histogram
+	load   *histogram
+
+	searchResults uint64
+	nodes         int
+	rejected      map[string]uint64 // requests refused by a server limit, by reason
+
+	// databaseNodes replaces nodes once any Database collector exists, so
+	// each database of a multi-database server has its own gauge
+	perDatabase   bool
+	databaseNodes map[string]int
+
+	shadowChecks      uint64
+	shadowDivergences map[string]uint64 // by kind, see storage.ShadowStorage
+}
+
+func NewPrometheus() *Prometheus {
+	return &Prometheus{
+		insert:   newHistogram("hippocampus_insert_duration_seconds", "Time spent adding an insert call's nodes to the tree."),
+		search:   newHistogram("hippocampus_search_duration_seconds", "Time spent searching the tree."),
+		embed:    newHistogram("hippocampus_embed_duration_seconds", "Time spent generating embeddings."),
+		flush:    newHistogram("hippocampus_flush_duration_seconds", "Time spent writing the tree to disk."),
+		load:     newHistogram("hippocampus_load_duration_seconds", "Time spent loading the tree from disk."),
+		rejected: make(map[string]uint64),
+
+		databaseNodes: make(map[string]int),
+
+		shadowDivergences: make(map[string]uint64),
+	}
+}
+
+func (p *Prometheus) ObserveInsert(t InsertTiming) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.embed.observe(t.Embed)
+	p.insert.observe(t.Insert)
+}
+
+func (p *Prometheus) ObserveSearch(t SearchTiming) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.embed.observe(t.Embed)
+	p.search.observe(t.Search)
+	p.searchResults += uint64(t.Results)
+}
+
+func (p *Prometheus) ObserveFlush(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.flush.observe(d)
+}
+
+func (p *Prometheus) ObserveLoad(d time.Duration, nodes int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.load.observe(d)
+	p.nodes = nodes
+}
+
+func (p *Prometheus) SetNodeCount(nodes int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.nodes = nodes
+}
+
+// Database is a Collector for the database called name, one of several a
+// server holds. Its timings go into the shared series and its node count
+// into its own hippocampus_nodes series, labelled with name. Once there is
+// one, the unlabelled gauge is no longer written.
+func (p *Prometheus) Database(name string) Collector {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.perDatabase = true
+	return databaseCollector{Prometheus: p, name: name}
+}
+
+// ForgetDatabase drops the node gauge of a database that was closed
+func (p *Prometheus) ForgetDatabase(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.databaseNodes, name)
+}
+
+// databaseCollector is Prometheus recording node counts under one name
+type databaseCollector struct {
+	*Prometheus
+	name string
+}
+
+func (c databaseCollector) ObserveLoad(d time.Duration, nodes int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.load.observe(d)
+	c.databaseNodes[c.name] = nodes
+}
+
+func (c databaseCollector) SetNodeCount(nodes int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.databaseNodes[c.name] = nodes
+}
+
+// ObserveRejected counts a request refused by a server limit rather than a
+// handler, such as "rate_limited" or "body_too_large"
+func (p *Prometheus) ObserveRejected(reason string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rejected[reason]++
+}
+
+// ObserveShadowCheck counts a comparison between a shadowed database and its
+// secondary copy, with the divergences it found by kind
+func (p *Prometheus) ObserveShadowCheck(divergent map[string]int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.shadowChecks++
+	for kind, n := range divergent {
+		p.shadowDivergences[kind] += uint64(n)
+	}
+}
+
+// Write renders every series in the text exposition format
+func (p *Prometheus) Write(w io.Writer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	buf := bufio.NewWriter(w)
+	defer buf.Flush()
+
+	fmt.Fprintf(buf, "# HELP hippocampus_insert_calls_total Insert calls; a batch or document counts once however many nodes it adds.\n")
+	fmt.Fprintf(buf, "# TYPE hippocampus_insert_calls_total counter\n")
+	fmt.Fprintf(buf, "hippocampus_insert_calls_total %d\n", p.insert.count)
+	fmt.Fprintf(buf, "# HELP hippocampus_searches_total Searches executed.\n")
+	fmt.Fprintf(buf, "# TYPE hippocampus_searches_total counter\n")
+	fmt.Fprintf(buf, "hippocampus_searches_total %d\n", p.search.count)
+	fmt.Fprintf(buf, "# HELP hippocampus_search_results_total Results returned across all searches.\n")
+	fmt.Fprintf(buf, "# TYPE hippocampus_search_results_total counter\n")
+	fmt.Fprintf(buf, "hippocampus_search_results_total %d\n", p.searchResults)
+	fmt.Fprintf(buf, "# HELP hippocampus_nodes Nodes currently in the tree.\n")
+	fmt.Fprintf(buf, "# TYPE hippocampus_nodes gauge\n")
+	if p.perDatabase {
+		for _, name := range slices.Sorted(maps.Keys(p.databaseNodes)) {
+			fmt.Fprintf(buf, "hippocampus_nodes{database=%q} %d\n", name, p.databaseNodes[name])
+		}
+	} else {
+		fmt.Fprintf(buf, "hippocampus_nodes %d\n", p.nodes)
+	}
+	fmt.Fprintf(buf, "# HELP hippocampus_rejected_requests_total Requests refused by the rate limit or body size limit.\n")
+	fmt.Fprintf(buf, "# TYPE hippocampus_rejected_requests_total counter\n")
+	for _, reason := range slices.Sorted(maps.Keys(p.rejected)) {
+		fmt.Fprintf(buf, "hippocampus_rejected_requests_total{reason=%q} %d\n", reason, p.rejected[reason])
+	}
+	if p.shadowChecks > 0 {
+		fmt.Fprintf(buf, "# HELP hippocampus_shadow_checks_total Comparisons between the database and its shadow copy.\n")
+		fmt.Fprintf(buf, "# TYPE hippocampus_shadow_checks_total counter\n")
+		fmt.Fprintf(buf, "hippocampus_shadow_checks_total %d\n", p.shadowChecks)
+		fmt.Fprintf(buf, "# HELP hippocampus_shadow_divergences_total Differences found between the database and its shadow copy.\n")
+		fmt.Fprintf(buf, "# TYPE hippocampus_shadow_divergences_total counter\n")
+		for _, kind := range slices.Sorted(maps.Keys(p.shadowDivergences)) {
+			fmt.Fprintf(buf, "hippocampus_shadow_divergences_total{kind=%q} %d\n", kind, p.shadowDivergences[kind])
+		}
+	}
+
+	for _, h := range []*histogram{p.insert, p.search, p.embed, p.flush, p.load} {
+		h.write(buf)
+	}
+}
+
+// Handler serves the metrics for a Prometheus scrape
+func (p *Prometheus) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		p.Write(w)
+	})
+}
@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scrape fetches p's metrics over HTTP, as Prometheus would
+func scrape(t *testing.T, p *Prometheus) string {
+	t.Helper()
+	server := httptest.NewServer(p.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("Content-Type %q", ct)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+// wantLines fails unless every line is in the scraped body
+func wantLines(t *testing.T, body string, lines ...string) {
+	t.Helper()
+	have := make(map[string]bool)
+	for _, line := range strings.Split(body, "\n") {
+		have[line] = true
+	}
+	for _, line := range lines {
+		if !have[line] {
+			t.Errorf("missing %q in:\n%s", line, body)
+		}
+	}
+}
+
+func TestPrometheusScrape(t *testing.T) {
+	p := NewPrometheus()
+
+	// Two insert calls, however many nodes each stored
+	p.ObserveInsert(InsertTiming{Embed: 10 * time.Millisecond, Insert: 2 * time.Millisecond})
+	p.ObserveInsert(InsertTiming{Embed: 10 * time.Millisecond, Insert: 2 * time.Millisecond})
+	p.ObserveSearch(SearchTiming{Search: time.Millisecond, Results: 3})
+	p.ObserveSearch(SearchTiming{Search: time.Millisecond, Results: 4})
+	p.ObserveLoad(5*time.Millisecond, 40)
+	p.SetNodeCount(42)
+	p.ObserveRejected("rate_limited")
+
+	body := scrape(t, p)
+	wantLines(t, body,
+		"# TYPE hippocampus_insert_calls_total counter",
+		"hippocampus_insert_calls_total 2",
+		"hippocampus_searches_total 2",
+		"hippocampus_search_results_total 7",
+		"# TYPE hippocampus_nodes gauge",
+		"hippocampus_nodes 42",
+		`hippocampus_rejected_requests_total{reason="rate_limited"} 1`,
+		"# TYPE hippocampus_insert_duration_seconds histogram",
+		`hippocampus_insert_duration_seconds_bucket{le="+Inf"} 2`,
+		"hippocampus_insert_duration_seconds_count 2",
+		"hippocampus_embed_duration_seconds_count 4",
+		"hippocampus_load_duration_seconds_count 1",
+	)
+	if strings.Contains(body, "hippocampus_inserts_total") {
+		t.Error("hippocampus_inserts_total is still written")
+	}
+	if strings.Contains(body, "hippocampus_shadow_checks_total") {
+		t.Error("shadow series written with no shadow checks")
+	}
+}
+
+func TestPrometheusScrapeByDatabase(t *testing.T) {
+	p := NewPrometheus()
+	a, b := p.Database("a"), p.Database("b")
+
+	a.ObserveLoad(time.Millisecond, 10)
+	b.SetNodeCount(3)
+	a.ObserveInsert(InsertTiming{Insert: time.Millisecond})
+	a.SetNodeCount(11)
+
+	body := scrape(t, p)
+	wantLines(t, body,
+		`hippocampus_nodes{database="a"} 11`,
+		`hippocampus_nodes{database="b"} 3`,
+		"hippocampus_insert_calls_total 1",
+		"hippocampus_load_duration_seconds_count 1",
+	)
+	if strings.Contains(body, "hippocampus_nodes 0") {
+		t.Error("unlabelled node gauge written alongside the per-database ones")
+	}
+
+	p.ForgetDatabase("b")
+	if body := scrape(t, p); strings.Contains(body, `database="b"`) {
+		t.Errorf("forgotten database still reported:\n%s", body)
+	}
+}
@@ -0,0 +1,108 @@
+// Package ratelimit throttles requests per caller so one client can't starve
+// the others.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// DefaultMaxBodyBytes is the request body size serve and the Lambda reject
+// above unless configured otherwise
+const DefaultMaxBodyBytes = 1 << 20
+
+// Limiter decides whether the caller identified by key may make a request
+// now. When it may not, retryAfter is how long until it may.
+// Implementations must be safe for concurrent use.
+type Limiter interface {
+	Allow(key string) (ok bool, retryAfter time.Duration)
+}
+
+// idleBuckets is how many Allow calls pass between sweeps of full buckets
+const idleBuckets = 1024
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// TokenBucket gives every key a bucket of Burst tokens refilled at Rate per
+// second; a request takes one token. Buckets that have refilled are
+// forgotten, so the map stays the size of the callers currently busy.
+type TokenBucket struct {
+	Rate  float64
+	Burst int
+
+	// Now is the clock, time.Now unless a test replaces it
+	Now func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	calls   int
+}
+
+// NewTokenBucket allows each key rps requests per second on average and up
+// to burst at once. A burst below 1 is raised to 1.
+func NewTokenBucket(rps float64, burst int) *TokenBucket {
+	return &TokenBucket{
+		Rate:    rps,
+		Burst:   max(burst, 1),
+		Now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+func (tb *TokenBucket) Allow(key string) (bool, time.Duration) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	now := tb.Now()
+	tb.calls++
+	if tb.calls%idleBuckets == 0 {
+		tb.sweep(now)
+	}
+
+	b, ok := tb.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(tb.Burst), last: now}
+		tb.buckets[key] = b
+	}
+	b.tokens = tb.refill(b, now)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if tb.Rate <= 0 {
+		return false, time.Duration(math.MaxInt64)
+	}
+	wait := (1 - b.tokens) / tb.Rate
+	return false, time.Duration(math.Ceil(wait * float64(time.Second)))
+}
+
+// refill is b's token count at now
+func (tb *TokenBucket) refill(b *bucket, now time.Time) float64 {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed <= 0 {
+		return b.tokens
+	}
+	return min(b.tokens+elapsed*tb.Rate, float64(tb.Burst))
+}
+
+// sweep drops the buckets that have refilled, which behave exactly like a
+// new one. Call with mu held.
+func (tb *TokenBucket) sweep(now time.Time) {
+	for key, b := range tb.buckets {
+		if tb.refill(b, now) >= float64(tb.Burst) {
+			delete(tb.buckets, key)
+		}
+	}
+}
+
+// RetryAfterSeconds is retryAfter for a Retry-After header, which counts
+// whole seconds, rounded up so a client that waits is let through
+func RetryAfterSeconds(retryAfter time.Duration) int64 {
+	return max(int64(math.Ceil(retryAfter.Seconds())), 1)
+}
@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is a TokenBucket clock that only moves when told to
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newFakeBucket(rps float64, burst int) (*TokenBucket, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	tb := NewTokenBucket(rps, burst)
+	tb.Now = clock.Now
+	return tb, clock
+}
+
+func TestTokenBucketBurstThenRate(t *testing.T) {
+	tb, clock := newFakeBucket(2, 3)
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := tb.Allow("a"); !ok {
+			t.Fatalf("request %d of the burst refused", i+1)
+		}
+	}
+	ok, retryAfter := tb.Allow("a")
+	if ok || retryAfter != 500*time.Millisecond {
+		t.Fatalf("past the burst: allowed %v, retry after %v; want refused for 500ms", ok, retryAfter)
+	}
+
+	// Other callers have their own buckets
+	if ok, _ := tb.Allow("b"); !ok {
+		t.Fatal("another key was refused")
+	}
+
+	clock.advance(250 * time.Millisecond)
+	if ok, retryAfter := tb.Allow("a"); ok || retryAfter != 250*time.Millisecond {
+		t.Fatalf("half a token later: allowed %v, retry after %v; want refused for 250ms", ok, retryAfter)
+	}
+	clock.advance(250 * time.Millisecond)
+	if ok, _ := tb.Allow("a"); !ok {
+		t.Fatal("refused once a token had refilled")
+	}
+
+	// Refilling stops at the burst
+	clock.advance(time.Hour)
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if ok, _ := tb.Allow("a"); ok {
+			allowed++
+		}
+	}
+	if allowed != 3 {
+		t.Errorf("after an hour idle allowed %d at once, want the burst of 3", allowed)
+	}
+}
+
+func TestTokenBucketZeroRateNeverRefills(t *testing.T) {
+	tb, clock := newFakeBucket(0, 0)
+	if ok, _ := tb.Allow("a"); !ok {
+		t.Fatal("a burst below 1 should still allow one request")
+	}
+	clock.advance(24 * time.Hour)
+	if ok, retryAfter := tb.Allow("a"); ok || retryAfter <= 24*time.Hour {
+		t.Errorf("zero rate: allowed %v, retry after %v; want refused for good", ok, retryAfter)
+	}
+}
+
+func TestTokenBucketSweepsRefilledBuckets(t *testing.T) {
+	tb, clock := newFakeBucket(1, 1)
+	for i := 0; i < idleBuckets-1; i++ {
+		tb.Allow(string(rune('a'+i%26)) + string(rune(i)))
+	}
+	if len(tb.buckets) == 0 {
+		t.Fatal("no buckets kept for busy callers")
+	}
+
+	// Every bucket has refilled by the time the next call sweeps, so only
+	// the bucket that call takes a token from is left
+	clock.advance(time.Minute)
+	tb.Allow("busy")
+	if len(tb.buckets) != 1 {
+		t.Errorf("%d buckets after the sweep, want the refilled ones dropped", len(tb.buckets))
+	}
+	if ok, _ := tb.Allow("busy"); ok {
+		t.Error("the busy caller's empty bucket was forgotten")
+	}
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	for _, tt := range []struct {
+		retryAfter time.Duration
+		want       int64
+	}{
+		{0, 1},
+		{time.Millisecond, 1},
+		{time.Second, 1},
+		{1001 * time.Millisecond, 2},
+		{90 * time.Second, 90},
+	} {
+		if got := RetryAfterSeconds(tt.retryAfter); got != tt.want {
+			t.Errorf("RetryAfterSeconds(%v) = %d, want %d", tt.retryAfter, got, tt.want)
+		}
+	}
+}
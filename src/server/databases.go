@@ -0,0 +1,297 @@
+package server
+
+import (
+	"Hippocampus/src/client"
+	"Hippocampus/src/metrics"
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultMaxOpenDatabases is how many databases a multi-database server
+// keeps open before it closes the least recently used
+const DefaultMaxOpenDatabases = 64
+
+// databaseExt is the extension of each database file in the data directory
+const databaseExt = ".bin"
+
+// ErrDatabaseNotFound is returned for a database that has no file yet and
+// was not asked to be created
+var ErrDatabaseNotFound = errors.New("database not found")
+
+// databaseName is what a database may be called: it becomes a file name in
+// the data directory, so no separators and no leading dot
+var databaseName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,127}$`)
+
+// ValidDatabaseName reports whether name is safe to use as a database name
+func ValidDatabaseName(name string) error {
+	if !databaseName.MatchString(name) || strings.Contains(name, "..") {
+		return fmt.Errorf("invalid database name %q: use letters, digits, '.', '_' and '-', starting with a letter or digit", name)
+	}
+	return nil
+}
+
+// database is one open client, shared by every request for it
+type database struct {
+	name   string
+	client *client.Client
+
+	users int           // requests holding it; guarded by Databases.mu
+	elem  *list.Element // position in Databases.recent
+}
+
+// Databases opens the databases of a data directory on demand, one file per
+// name, and keeps at most maxOpen of them open. When another is needed the
+// least recently used one no request is holding is flushed and closed.
+type Databases struct {
+	dir        string
+	maxOpen    int
+	openClient func(path string) (*client.Client, error)
+	metrics    *metrics.Prometheus // each client reports to it, under its name, when not nil
+
+	mu      sync.Mutex
+	dbs     map[string]*database
+	recent  *list.List               // most recently used at the front
+	closing map[string]chan struct{} // evicted databases still flushing; closed when done
+}
+
+// NewDatabases serves the databases in dir, creating it if needed. open
+// makes the client for a database file, configured as the server wants
+// (embedder, flushing, caches); maxOpen <= 0 keeps every database open.
+func NewDatabases(dir string, maxOpen int, open func(path string) (*client.Client, error)) (*Databases, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+	return &Databases{
+		dir:        dir,
+		maxOpen:    maxOpen,
+		openClient: open,
+		dbs:        make(map[string]*database),
+		recent:     list.New(),
+		closing:    make(map[string]chan struct{}),
+	}, nil
+}
+
+// Path is the file the database called name lives in
+func (d *Databases) Path(name string) string {
+	return filepath.Join(d.dir, name+databaseExt)
+}
+
+// acquire returns the named database, opening it if needed, and holds it
+// open until release is called. A database with no file is created only
+// when create is set; otherwise it is ErrDatabaseNotFound.
+func (d *Databases) acquire(name string, create bool) (db *database, release func(), err error) {
+	if err := ValidDatabaseName(name); err != nil {
+		return nil, nil, err
+	}
+
+	d.mu.Lock()
+	// Reopening a database before its eviction flush lands would read
+	// the file without the inserts being flushed
+	for done := d.closing[name]; done != nil; done = d.closing[name] {
+		d.mu.Unlock()
+		<-done
+		d.mu.Lock()
+	}
+	db, evicted, err := d.open(name, create)
+	if err == nil {
+		d.recent.MoveToFront(db.elem)
+		db.users++
+	}
+	d.mu.Unlock()
+
+	// Flushing can take a while, so other databases stay available meanwhile
+	d.close(evicted)
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, func() {
+		d.mu.Lock()
+		db.users--
+		d.mu.Unlock()
+	}, nil
+}
+
+// open returns the named database, opening it if it isn't already, along
+// with any databases evicted to make room, which the caller must close
+// once mu is released. Call with mu held.
+func (d *Databases) open(name string, create bool) (*database, []*database, error) {
+	if db, ok := d.dbs[name]; ok {
+		return db, nil, nil
+	}
+
+	path := d.Path(name)
+	if _, err := os.Stat(path); err != nil {
+		if !os.IsNotExist(err) {
+			return nil, nil, err
+		}
+		if !create {
+			return nil, nil, fmt.Errorf("%w: %s", ErrDatabaseNotFound, name)
+		}
+	}
+
+	evicted := d.evict()
+	c, err := d.openClient(path)
+	if err != nil {
+		return nil, evicted, fmt.Errorf("failed to open database %s: %w", name, err)
+	}
+	if d.metrics != nil {
+		c.Metrics = d.metrics.Database(name)
+	}
+	db := &database{name: name, client: c}
+	db.elem = d.recent.PushFront(db)
+	d.dbs[name] = db
+	return db, evicted, nil
+}
+
+// evict removes least recently used databases until there is room for one
+// more, and returns them for close. Databases a request is holding are
+// skipped, so under load more than maxOpen may be open for a while. Call
+// with mu held.
+func (d *Databases) evict() []*database {
+	if d.maxOpen <= 0 {
+		return nil
+	}
+	var evicted []*database
+	for e := d.recent.Back(); e != nil && len(d.dbs) >= d.maxOpen; {
+		db := e.Value.(*database)
+		e = e.Prev()
+		if db.users > 0 {
+			continue
+		}
+
+		d.recent.Remove(db.elem)
+		delete(d.dbs, db.name)
+		d.closing[db.name] = make(chan struct{})
+		evicted = append(evicted, db)
+	}
+	return evicted
+}
+
+// close flushes and closes databases evict removed, then lets requests
+// waiting for them reopen them. Call without mu held.
+func (d *Databases) close(evicted []*database) {
+	for _, db := range evicted {
+		if err := db.client.Close(); err != nil {
+			log.Printf("failed to flush database %s on eviction: %v", db.name, err)
+		}
+		if d.metrics != nil {
+			d.metrics.ForgetDatabase(db.name)
+		}
+
+		d.mu.Lock()
+		close(d.closing[db.name])
+		delete(d.closing, db.name)
+		d.mu.Unlock()
+	}
+}
+
+// Names lists the databases in the data directory, open or not, including
+// new ones that have not been flushed yet
+func (d *Databases) Names() ([]string, error) {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), databaseExt)
+		if ok && !entry.IsDir() && ValidDatabaseName(name) == nil {
+			seen[name] = true
+		}
+	}
+	d.mu.Lock()
+	for name := range d.dbs {
+		seen[name] = true
+	}
+	d.mu.Unlock()
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Flush persists pending inserts in every open database
+func (d *Databases) Flush() error {
+	return d.each(func(c *client.Client) error { return c.Flush() })
+}
+
+// Close flushes and closes every open database, after waiting for any
+// evicted ones to finish closing
+func (d *Databases) Close() error {
+	err := d.each(func(c *client.Client) error { return c.Close() })
+
+	d.mu.Lock()
+	clear(d.dbs)
+	d.recent.Init()
+	for len(d.closing) > 0 {
+		var done chan struct{}
+		for _, done = range d.closing {
+			break
+		}
+		d.mu.Unlock()
+		<-done
+		d.mu.Lock()
+	}
+	d.mu.Unlock()
+	return err
+}
+
+// each runs fn on every open database, returning the first error. The
+// databases are listed under mu but fn runs without it, so a slow flush
+// doesn't hold up requests for other databases.
+func (d *Databases) each(fn func(c *client.Client) error) error {
+	d.mu.Lock()
+	dbs := make([]*database, 0, d.recent.Len())
+	for e := d.recent.Front(); e != nil; e = e.Next() {
+		dbs = append(dbs, e.Value.(*database))
+	}
+	d.mu.Unlock()
+
+	var first error
+	for _, db := range dbs {
+		if err := fn(db.client); err != nil && first == nil {
+			first = fmt.Errorf("database %s: %w", db.name, err)
+		}
+	}
+	return first
+}
+
+// Warmup opens the databases already in the directory, up to maxOpen, and
+// loads each and builds its index ahead of its first request (see
+// client.Client.Warmup). It returns how many were warmed; the error is the
+// first failure, or ctx's if it ended first.
+func (d *Databases) Warmup(ctx context.Context) (int, error) {
+	names, err := d.Names()
+	if err != nil {
+		return 0, err
+	}
+	if d.maxOpen > 0 && len(names) > d.maxOpen {
+		names = names[:d.maxOpen]
+	}
+
+	for i, name := range names {
+		db, release, err := d.acquire(name, false)
+		if err != nil {
+			return i, err
+		}
+		_, err = db.client.Warmup(ctx)
+		release()
+		if err != nil {
+			return i, fmt.Errorf("database %s: %w", name, err)
+		}
+	}
+	return len(names), nil
+}
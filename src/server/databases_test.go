@@ -0,0 +1,250 @@
+package server
+
+import (
+	"Hippocampus/src/client"
+	"Hippocampus/src/embedding"
+	"Hippocampus/src/storage"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// newTestDatabases serves databases in a temporary directory with hashing
+// embedders, keeping at most maxOpen open
+func newTestDatabases(t *testing.T, maxOpen int) *Databases {
+	t.Helper()
+	d, err := NewDatabases(filepath.Join(t.TempDir(), "data"), maxOpen, func(path string) (*client.Client, error) {
+		c, err := client.New(path, "us-east-1")
+		if err != nil {
+			return nil, err
+		}
+		c.SetVerbose(false)
+		c.Embedder = embedding.NewMockProvider(512)
+		return c, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// postJSON sends body as JSON and decodes the response
+func postJSON(url string, body any) (int, Response, error) {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return 0, Response{}, err
+	}
+	resp, err := http.Post(url, "application/json", bytes.NewReader(encoded))
+	if err != nil {
+		return 0, Response{}, err
+	}
+	defer resp.Body.Close()
+	var decoded Response
+	err = json.NewDecoder(resp.Body).Decode(&decoded)
+	return resp.StatusCode, decoded, err
+}
+
+// post is postJSON for the test's own goroutine
+func post(t *testing.T, url string, body any) (int, Response) {
+	t.Helper()
+	status, resp, err := postJSON(url, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status, resp
+}
+
+// Two databases created with different key widths take inserts and
+// searches at once, each by path prefix and by database field
+func TestMultiDatabasesConcurrently(t *testing.T) {
+	d := newTestDatabases(t, 0)
+	ts := httptest.NewServer(NewMulti(d))
+	defer ts.Close()
+
+	dims := map[string]int{"alpha": 64, "beta": 128}
+	const inserts = 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4*inserts)
+	for name, width := range dims {
+		// The first insert creates the database at its width
+		if status, resp := post(t, ts.URL+"/db/"+name+"/insert", InsertRequest{Key: "0", Text: name + " memory 0", Dims: width}); status != http.StatusOK {
+			t.Fatalf("creating %s: %d %s", name, status, resp.Error)
+		}
+		for i := 1; i < inserts; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				req := InsertRequest{Database: name, Key: fmt.Sprint(i), Text: fmt.Sprintf("%s memory %d", name, i)}
+				if status, resp, err := postJSON(ts.URL+"/insert", req); err != nil || status != http.StatusOK {
+					errs <- fmt.Errorf("insert into %s: %d %s %v", name, status, resp.Error, err)
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				req := SearchRequest{Text: name + " memory 0"}
+				req.TopK = 1
+				if status, resp, err := postJSON(ts.URL+"/db/"+name+"/search", req); err != nil || status != http.StatusOK {
+					errs <- fmt.Errorf("search %s: %d %s %v", name, status, resp.Error, err)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	for name := range dims {
+		req := SearchRequest{Database: name, Text: name + " memory 7"}
+		req.TopK = 1
+		status, resp := post(t, ts.URL+"/search", req)
+		if found, _ := resp.Data.([]any); status != http.StatusOK || len(found) != 1 || found[0] != name+" memory 7" {
+			t.Errorf("search %s returned %d %v", name, status, resp.Data)
+		}
+	}
+
+	// A database keeps the width it was created with
+	if status, _ := post(t, ts.URL+"/db/alpha/insert", InsertRequest{Key: "x", Text: "wider", Dims: 128}); status != http.StatusBadRequest {
+		t.Errorf("changing alpha's width returned %d, want 400", status)
+	}
+
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for name, width := range dims {
+		tree, err := storage.New(d.Path(name)).Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tree.Nodes) != inserts || tree.Projection == nil || tree.Projection.OutputDims != width {
+			t.Errorf("%s holds %d nodes of projection %+v, want %d of width %d", name, len(tree.Nodes), tree.Projection, inserts, width)
+		}
+	}
+}
+
+func TestDatabaseNamesRejectTraversal(t *testing.T) {
+	for _, name := range []string{"notes", "project-1", "v2.0", "a_b"} {
+		if err := ValidDatabaseName(name); err != nil {
+			t.Errorf("%q rejected: %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "..", "../escape", "a/b", `a\b`, ".hidden", "a..b", "-flag", "name\x00", string(make([]byte, 200))} {
+		if err := ValidDatabaseName(name); err == nil {
+			t.Errorf("%q accepted", name)
+		}
+	}
+
+	d := newTestDatabases(t, 0)
+	ts := httptest.NewServer(NewMulti(d))
+	defer ts.Close()
+
+	if status, _ := post(t, ts.URL+"/insert", InsertRequest{Database: "../escape", Key: "k", Text: "t"}); status != http.StatusBadRequest {
+		t.Errorf("insert into ../escape returned %d, want 400", status)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(d.dir), "escape"+databaseExt)); !os.IsNotExist(err) {
+		t.Errorf("a file was created outside the data directory: %v", err)
+	}
+	if status, _ := post(t, ts.URL+"/insert", InsertRequest{Key: "k", Text: "t"}); status != http.StatusBadRequest {
+		t.Errorf("insert without a database returned %d, want 400", status)
+	}
+
+	// Searches never create databases
+	req := SearchRequest{Database: "missing", Text: "anything"}
+	if status, _ := post(t, ts.URL+"/search", req); status != http.StatusNotFound {
+		t.Errorf("search of a missing database returned %d, want 404", status)
+	}
+	if _, err := os.Stat(d.Path("missing")); !os.IsNotExist(err) {
+		t.Errorf("search created the database: %v", err)
+	}
+}
+
+func TestDatabasesEvictLeastRecentlyUsed(t *testing.T) {
+	d := newTestDatabases(t, 2)
+
+	insert := func(name, text string) {
+		t.Helper()
+		db, release, err := d.acquire(name, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer release()
+		db.client.FlushEvery = -1
+		if err := db.client.Insert(text, text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	open := func() []string {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		var names []string
+		for e := d.recent.Front(); e != nil; e = e.Next() {
+			names = append(names, e.Value.(*database).name)
+		}
+		return names
+	}
+
+	insert("a", "first")
+	insert("b", "second")
+	insert("a", "third")
+	insert("c", "fourth")
+
+	// b was least recently used, so it went, flushed
+	if got := open(); fmt.Sprint(got) != "[c a]" {
+		t.Errorf("open databases %v, want [c a]", got)
+	}
+	if n, err := storage.New(d.Path("b")).NodeCount(); err != nil || n != 1 {
+		t.Errorf("evicted b has %d nodes on disk (%v), want its unflushed insert", n, err)
+	}
+	if n, err := storage.New(d.Path("a")).NodeCount(); err == nil && n != 0 {
+		t.Errorf("a was flushed while still open: %d nodes", n)
+	}
+
+	// A database a request holds is not evicted; the cap gives way instead
+	_, releaseC, err := d.acquire("c", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, releaseA, err := d.acquire("a", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	insert("b", "fifth")
+	if got := open(); len(got) != 3 {
+		t.Errorf("open databases %v, want all three while two are held", got)
+	}
+	releaseC()
+	releaseA()
+	insert("d", "sixth")
+	if got := open(); len(got) > 2 || got[0] != "d" {
+		t.Errorf("open databases %v, want d and one other", got)
+	}
+
+	names, err := d.Names()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(names) != "[a b c d]" {
+		t.Errorf("Names() = %v", names)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]int64{"a": 2, "b": 2, "c": 1, "d": 1} {
+		if n, err := storage.New(d.Path(name)).NodeCount(); err != nil || n != want {
+			t.Errorf("%s has %d nodes after Close (%v), want %d", name, n, err, want)
+		}
+	}
+
+	if _, _, err := d.acquire("e", false); !errors.Is(err, ErrDatabaseNotFound) {
+		t.Errorf("acquiring a missing database: %v, want ErrDatabaseNotFound", err)
+	}
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// DefaultMaxEmbedTexts caps how many texts one /embed request may carry
+// unless the server overrides it
+const DefaultMaxEmbedTexts = 64
+
+// EmbedRequest is the body of POST /embed. Text is a string or an array of
+// strings.
+type EmbedRequest struct {
+	Database string          `json:"database,omitempty"`
+	Text     json.RawMessage `json:"text"`
+}
+
+// EmbedResult is the data of an /embed response, one vector per text in
+// request order
+type EmbedResult struct {
+	Model      string      `json:"model"`
+	Dimensions int         `json:"dimensions"`
+	Vectors    [][]float32 `json:"vectors"`
+}
+
+// handleEmbed proxies texts to the server's embedding provider, so a
+// front end can compare vectors without reaching the provider itself
+func (s *Server) handleEmbed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "only POST method is supported")
+		return
+	}
+
+	var req EmbedRequest
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+
+	texts, err := embedTexts(req.Text)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if s.MaxEmbedTexts > 0 && len(texts) > s.MaxEmbedTexts {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("%d texts, limit is %d", len(texts), s.MaxEmbedTexts))
+		return
+	}
+	db, release, ok := s.database(w, r, req.Database, false)
+	if !ok {
+		return
+	}
+	defer release()
+
+	for i, text := range texts {
+		if err := db.client.CheckSize(text, nil, nil); err != nil {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("text %d: %v", i, err))
+			return
+		}
+	}
+
+	// Embedding never touches the database, so it doesn't wait on mu
+	vecs, err := db.client.Embed(r.Context(), texts)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Sprintf("embed failed: %v", err))
+		return
+	}
+
+	result := EmbedResult{Model: db.client.Embedder.Name(), Vectors: vecs}
+	if len(vecs) > 0 {
+		result.Dimensions = len(vecs[0])
+	}
+	writeJSON(w, http.StatusOK, Response{Message: "embed successful", Data: result})
+}
+
+// embedTexts decodes an EmbedRequest's text, a string or an array of
+// non-empty strings
+func embedTexts(raw json.RawMessage) ([]string, error) {
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("text is required")
+	}
+
+	var texts []string
+	var one string
+	if err := json.Unmarshal(raw, &one); err == nil {
+		texts = []string{one}
+	} else if err := json.Unmarshal(raw, &texts); err != nil {
+		return nil, fmt.Errorf("text must be a string or an array of strings")
+	}
+
+	if len(texts) == 0 {
+		return nil, fmt.Errorf("text is required")
+	}
+	for i, text := range texts {
+		if text == "" {
+			return nil, fmt.Errorf("text %d is empty", i)
+		}
+	}
+	return texts, nil
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"Hippocampus/src/embedding"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// batchCounter is a MockProvider counting the batch calls it gets
+type batchCounter struct {
+	*embedding.MockProvider
+	batches atomic.Int32
+}
+
+func (b *batchCounter) GetEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	b.batches.Add(1)
+	return b.MockProvider.GetEmbeddings(ctx, texts)
+}
+
+// oneAtATime hides a provider's batch method
+type oneAtATime struct {
+	embedding.EmbeddingProvider
+}
+
+// embed sends body to POST /embed and decodes the response, with the
+// vectors, if any, decoded into result
+func embed(t *testing.T, s *Server, body string) (int, Response, EmbedResult) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/embed", strings.NewReader(body)))
+
+	var resp Response
+	var result EmbedResult
+	resp.Data = &result
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return w.Code, resp, result
+}
+
+func TestEmbedProxiesProvider(t *testing.T) {
+	c := newTestClient(t, 0)
+	mock := &batchCounter{MockProvider: embedding.NewMockProvider(512)}
+	c.Embedder = mock
+	s := New(c)
+	want, err := embedding.NewHashingProvider(512, 0).GetEmbeddings(context.Background(), []string{"hello", "world"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, resp, result := embed(t, s, `{"text":"hello"}`)
+	if status != http.StatusOK || result.Model != "mock 512" || result.Dimensions != 512 || len(result.Vectors) != 1 {
+		t.Fatalf("single text: %d %s, %s of %d dimensions with %d vectors", status, resp.Error, result.Model, result.Dimensions, len(result.Vectors))
+	}
+	if !slices.Equal(result.Vectors[0], want[0]) {
+		t.Error("single text returned another vector than the provider's")
+	}
+
+	// An array goes to the provider as one batch, in order
+	status, resp, result = embed(t, s, `{"text":["hello","world"]}`)
+	if status != http.StatusOK || len(result.Vectors) != 2 {
+		t.Fatalf("two texts: %d %s, %d vectors", status, resp.Error, len(result.Vectors))
+	}
+	if !slices.Equal(result.Vectors[0], want[0]) || !slices.Equal(result.Vectors[1], want[1]) {
+		t.Error("batch vectors out of order")
+	}
+	if n := mock.batches.Load(); n != 2 {
+		t.Errorf("provider got %d batch calls, want one per request", n)
+	}
+
+	// Without a batch method each text is embedded on its own
+	single := embedding.NewMockProvider(512)
+	c.Embedder = oneAtATime{single}
+	if status, resp, _ := embed(t, s, `{"text":["a","b","c"]}`); status != http.StatusOK {
+		t.Fatalf("texts one at a time: %d %s", status, resp.Error)
+	}
+	if calls := single.Calls(); !slices.Equal(calls, []string{"a", "b", "c"}) {
+		t.Errorf("provider embedded %v", calls)
+	}
+
+	// Embedding stores nothing
+	if n, err := c.CountWithFilter(nil); err != nil || n != 0 {
+		t.Errorf("database holds %d nodes after embedding (%v)", n, err)
+	}
+}
+
+func TestEmbedRejects(t *testing.T) {
+	c := newTestClient(t, 0)
+	mock := embedding.NewMockProvider(512)
+	c.Embedder = mock
+	c.MaxValueSize = 16
+	s := New(c)
+	s.MaxEmbedTexts = 3
+
+	cases := []struct {
+		body   string
+		status int
+		want   string
+	}{
+		{`{}`, http.StatusBadRequest, "text is required"},
+		{`{"text":[]}`, http.StatusBadRequest, "text is required"},
+		{`{"text":["a",""]}`, http.StatusBadRequest, "text 1 is empty"},
+		{`{"text":42}`, http.StatusBadRequest, "string or an array of strings"},
+		{`{"text":["a","b","c","d"]}`, http.StatusRequestEntityTooLarge, "4 texts, limit is 3"},
+		{`{"text":["short","a text well over sixteen bytes"]}`, http.StatusRequestEntityTooLarge, "text 1"},
+		{`{"text":"x","database":"other"}`, http.StatusNotFound, "single database"},
+	}
+	for _, tc := range cases {
+		if status, resp, _ := embed(t, s, tc.body); status != tc.status || !strings.Contains(resp.Error, tc.want) {
+			t.Errorf("%s: %d %q, want %d with %q", tc.body, status, resp.Error, tc.status, tc.want)
+		}
+	}
+	if calls := mock.Calls(); len(calls) != 0 {
+		t.Errorf("rejected requests embedded %v", calls)
+	}
+
+	mock.FailNext(1, errors.New("model unavailable"))
+	if status, resp, _ := embed(t, s, `{"text":"x"}`); status != http.StatusBadGateway || !strings.Contains(resp.Error, "model unavailable") {
+		t.Errorf("provider failure: %d %q, want 502", status, resp.Error)
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/embed", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /embed: %d, want 405", w.Code)
+	}
+
+	s.MaxBodyBytes = 64
+	if status, _, _ := embed(t, s, `{"text":"`+strings.Repeat("x", 100)+`"}`); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized body: %d, want 413", status)
+	}
+}
+
+// /embed counts against a caller's rate limit like every other endpoint
+func TestEmbedIsRateLimited(t *testing.T) {
+	s, _ := limitedServer(t)
+	send := func(apiKey string) int {
+		r := httptest.NewRequest(http.MethodPost, "/embed", strings.NewReader(`{"text":"hello"}`))
+		r.RemoteAddr = "10.0.0.1:1111"
+		r.Header.Set(APIKeyHeader, apiKey)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if status := send("team-a-secret"); status != http.StatusOK {
+		t.Fatalf("first embed: %d", status)
+	}
+	if status := send("team-a-secret"); status != http.StatusTooManyRequests {
+		t.Errorf("second embed from the same key: %d, want 429", status)
+	}
+	if w := get(s, "10.0.0.2:1111", "team-a-secret"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("/info after the key's embed: %d, want the limit shared", w.Code)
+	}
+}
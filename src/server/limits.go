@@ -0,0 +1,83 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+
+	"Hippocampus/src/ratelimit"
+)
+
+// APIKeyHeader names the caller for rate limiting when it holds one of the
+// server's APIKeys; otherwise requests are limited per remote address
+const APIKeyHeader = "X-API-Key"
+
+// admit enforces MaxBodyBytes and the Limiter ahead of every handler,
+// writing the rejection and returning false when the request may not go
+// through
+func (s *Server) admit(w http.ResponseWriter, r *http.Request) bool {
+	if s.MaxBodyBytes > 0 {
+		if r.ContentLength > s.MaxBodyBytes {
+			s.metrics.ObserveRejected("body_too_large")
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", s.MaxBodyBytes))
+			return false
+		}
+		// Bodies without a Content-Length are cut off while decoding
+		r.Body = http.MaxBytesReader(w, r.Body, s.MaxBodyBytes)
+	}
+
+	if s.Limiter == nil {
+		return true
+	}
+	key := s.clientKey(r)
+	ok, retryAfter := s.Limiter.Allow(key)
+	if ok {
+		return true
+	}
+
+	seconds := ratelimit.RetryAfterSeconds(retryAfter)
+	s.metrics.ObserveRejected("rate_limited")
+	log.Printf("throttled %s %s for %s, retry in %ds", r.Method, r.URL.Path, key, seconds)
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	writeError(w, http.StatusTooManyRequests, fmt.Sprintf("rate limit exceeded, retry in %ds", seconds))
+	return false
+}
+
+// clientKey names the caller a request is throttled as: its API key if
+// the key is one of APIKeys, so a caller can't dodge its limit by making
+// keys up, or else its address. Keys are named by a hash, since the name
+// is logged.
+func (s *Server) clientKey(r *http.Request) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" && s.APIKeys[key] {
+		sum := sha256.Sum256([]byte(key))
+		return "key:" + hex.EncodeToString(sum[:8])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// decodeBody decodes the JSON request body into v, answering 413 when it
+// runs past MaxBodyBytes and 400 when it is malformed
+func (s *Server) decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err == nil {
+		return true
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		s.metrics.ObserveRejected("body_too_large")
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit))
+		return false
+	}
+	writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+	return false
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"Hippocampus/src/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// limitedServer allows each caller one request, refilled every second of
+// the clock it returns
+func limitedServer(t *testing.T) (*Server, *time.Time) {
+	t.Helper()
+	s := New(newTestClient(t, 0))
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := ratelimit.NewTokenBucket(1, 1)
+	limiter.Now = func() time.Time { return now }
+	s.Limiter = limiter
+	s.APIKeys = map[string]bool{"team-a-secret": true}
+	return s, &now
+}
+
+// get sends GET /info from addr with the API key, if any, returning the status
+func get(s *Server, addr, apiKey string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/info", nil)
+	r.RemoteAddr = addr
+	if apiKey != "" {
+		r.Header.Set(APIKeyHeader, apiKey)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	return w
+}
+
+func TestLimiterIgnoresUnknownKeys(t *testing.T) {
+	s, now := limitedServer(t)
+
+	if w := get(s, "10.0.0.1:1111", "made-up-1"); w.Code != http.StatusOK {
+		t.Fatalf("first request: status %d", w.Code)
+	}
+	// A fresh made-up key, or another port, is still the same address
+	for _, key := range []string{"made-up-2", ""} {
+		w := get(s, "10.0.0.1:2222", key)
+		if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+			t.Errorf("key %q from the same address: status %d, Retry-After %q; want 429 after 1s", key, w.Code, w.Header().Get("Retry-After"))
+		}
+	}
+	if w := get(s, "10.0.0.2:1111", "made-up-1"); w.Code != http.StatusOK {
+		t.Errorf("another address: status %d, want its own limit", w.Code)
+	}
+
+	*now = now.Add(time.Second)
+	if w := get(s, "10.0.0.1:1111", "made-up-3"); w.Code != http.StatusOK {
+		t.Errorf("a second later: status %d", w.Code)
+	}
+}
+
+func TestLimiterKeysValidatedCallers(t *testing.T) {
+	s, now := limitedServer(t)
+
+	// The address is used up, but a valid key is its own caller
+	get(s, "10.0.0.1:1111", "")
+	if w := get(s, "10.0.0.1:1111", "team-a-secret"); w.Code != http.StatusOK {
+		t.Fatalf("valid key from a throttled address: status %d", w.Code)
+	}
+	// and follows the caller to other addresses
+	if w := get(s, "10.0.0.9:1111", "team-a-secret"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("valid key from another address: status %d, want its limit shared", w.Code)
+	}
+	*now = now.Add(time.Second)
+	if w := get(s, "10.0.0.9:1111", "team-a-secret"); w.Code != http.StatusOK {
+		t.Errorf("a second later: status %d", w.Code)
+	}
+
+	// The key is logged, so it must not be the secret itself
+	r := httptest.NewRequest(http.MethodGet, "/info", nil)
+	r.Header.Set(APIKeyHeader, "team-a-secret")
+	if key := s.clientKey(r); !strings.HasPrefix(key, "key:") || strings.Contains(key, "secret") {
+		t.Errorf("caller named %q, want a hash of the key", key)
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSearchRequestCarriesOptions(t *testing.T) {
+	var req SearchRequest
+	body := `{"text":"query","epsilon":0.4,"threshold":0.2,"top_k":3,"offset":2,"max_distance":1.5,"min_score":0.3,"group_by":"doc_id","mmr":true,"fetch_k":9,"filter":{"topic":"food"}}`
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatal(err)
+	}
+	opts := req.SearchOptions
+	if opts.Epsilon != 0.4 || opts.Threshold != 0.2 || opts.TopK != 3 || opts.Offset != 2 || opts.MaxDistance != 1.5 ||
+		opts.MinScore != 0.3 || opts.GroupBy != "doc_id" || !opts.MMR || opts.FetchK != 9 {
+		t.Errorf("decoded options %+v", opts)
+	}
+	// The JSON filter is the request's own; the server builds the typed one
+	if req.Filter["topic"] != "food" || opts.Filter != nil {
+		t.Errorf("filter decoded as %v and %+v", req.Filter, opts.Filter)
+	}
+}
+
+func TestSearchValidatesOptions(t *testing.T) {
+	s := New(newTestClient(t, 10))
+	search := func(body string) (int, Response) {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodPost, "/search", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		var resp Response
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return w.Code, resp
+	}
+
+	// Paging and the distance cutoff come through the options
+	status, resp := search(`{"text":"query","epsilon":1,"max_distance":10,"top_k":3,"offset":2}`)
+	if status != http.StatusOK || fmt.Sprint(resp.Data) != "[m2 m3 m4]" {
+		t.Errorf("paged search: %d %v %s", status, resp.Data, resp.Error)
+	}
+	// Left out, top_k takes its default
+	status, resp = search(`{"text":"query","epsilon":1,"max_distance":10}`)
+	if found, _ := resp.Data.([]any); status != http.StatusOK || len(found) != 5 {
+		t.Errorf("search without top_k: %d %v %s", status, resp.Data, resp.Error)
+	}
+
+	for body, want := range map[string]string{
+		`{"text":"query","epsilon":-0.5}`: "epsilon must be a non-negative number",
+		`{"text":"query","top_k":-1}`:     "topK must be positive",
+		`{"text":"query","offset":-2}`:    "offset must not be negative",
+		`{"text":"query","min_score":2}`:  "min score must be between 0 and 1",
+	} {
+		if status, resp := search(body); status != http.StatusBadRequest || !strings.Contains(resp.Error, want) {
+			t.Errorf("%s: %d %q, want 400 with %q", body, status, resp.Error, want)
+		}
+	}
+}
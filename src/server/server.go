@@ -0,0 +1,345 @@
+package server
+
+import (
+	"Hippocampus/src/client"
+	"Hippocampus/src/metrics"
+	"Hippocampus/src/ratelimit"
+	"Hippocampus/src/types"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// InsertRequest and SearchRequest name their database in Database when
+// the server holds several and the path doesn't (see NewMulti)
+type InsertRequest struct {
+	Database string `json:"database,omitempty"`
+	Key      string `json:"key"`
+	Text     string `json:"text"`
+	Dims     int    `json:"dims,omitempty"`  // key width for a database this insert creates; see client.SetDimensions
+	Debug    bool   `json:"debug,omitempty"` // include OperationStats in the response
+}
+
+// SearchRequest carries every types.SearchOptions field under its JSON
+// name (epsilon, top_k, group_by, ...); Filter is the JSON form
+type SearchRequest struct {
+	Database string `json:"database,omitempty"`
+	Text     string `json:"text"`
+	Detailed bool   `json:"detailed"`
+
+	types.SearchOptions
+	Filter  map[string]interface{} `json:"filter,omitempty"`  // metadata to match; keys may be dotted paths like "user.tier"
+	Debug   bool                   `json:"debug,omitempty"`   // include OperationStats in the response
+	Explain bool                   `json:"explain,omitempty"` // include a types.ExplainReport in the response
+}
+
+type Response struct {
+	Message   string                 `json:"message"`
+	Data      interface{}            `json:"data,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+	Truncated bool                   `json:"truncated,omitempty"` // search limits stopped the search early; results are the best found
+	Stats     *client.OperationStats `json:"stats,omitempty"`     // only for debug requests
+	Explain   *types.ExplainReport   `json:"explain,omitempty"`   // only for explain requests
+	Hint      *types.SearchHint      `json:"hint,omitempty"`      // why a debug search found nothing
+}
+
+// Server exposes a single database over HTTP, or with NewMulti every
+// database in a directory. Requests call their database's client
+// concurrently, which it is safe for.
+type Server struct {
+	// MaxCandidates and SearchTimeout bound every search (see
+	// types.SearchOptions); 0 removes a limit. The timeout counts from
+	// when the request arrives, so it includes embedding and waiting for
+	// other requests.
+	MaxCandidates int
+	SearchTimeout time.Duration
+
+	// MaxEmbedTexts caps the texts in one /embed request; 0 removes the cap
+	MaxEmbedTexts int
+
+	// MaxBodyBytes rejects larger request bodies with a 413; 0 removes the
+	// limit. Limiter throttles each caller (see APIKeyHeader) with a 429;
+	// nil turns throttling off. APIKeys are the keys trusted to name a
+	// caller; nil trusts none, so every caller is limited by address.
+	MaxBodyBytes int64
+	Limiter      ratelimit.Limiter
+	APIKeys      map[string]bool
+
+	single    *database  // nil with NewMulti
+	databases *Databases // nil with New
+	metrics   *metrics.Prometheus
+	mux       *http.ServeMux
+}
+
+func New(c *client.Client) *Server {
+	s := newServer()
+	s.single = &database{client: c}
+	c.Metrics = s.metrics
+	return s
+}
+
+// NewMulti serves every database in databases. Requests name theirs with a
+// /db/{name}/ path prefix or a database field; an insert into a database
+// that doesn't exist yet creates it.
+func NewMulti(databases *Databases) *Server {
+	s := newServer()
+	s.databases = databases
+	databases.metrics = s.metrics
+	s.mux.HandleFunc("/databases", s.handleDatabases)
+	return s
+}
+
+func newServer() *Server {
+	s := &Server{
+		MaxCandidates: types.DefaultMaxCandidates,
+		SearchTimeout: types.DefaultSearchTimeout,
+		MaxEmbedTexts: DefaultMaxEmbedTexts,
+		MaxBodyBytes:  ratelimit.DefaultMaxBodyBytes,
+		metrics:       metrics.NewPrometheus(),
+		mux:           http.NewServeMux(),
+	}
+
+	for _, prefix := range []string{"", "/db/{name}"} {
+		s.mux.HandleFunc(prefix+"/insert", s.handleInsert)
+		s.mux.HandleFunc(prefix+"/search", s.handleSearch)
+		s.mux.HandleFunc(prefix+"/search/stream", s.handleSearchStream)
+		s.mux.HandleFunc(prefix+"/embed", s.handleEmbed)
+		s.mux.HandleFunc(prefix+"/info", s.handleInfo)
+	}
+	s.mux.Handle("/metrics", s.metrics.Handler())
+
+	return s
+}
+
+// Metrics is the collector the server exposes at /metrics, for reporting
+// from outside the request path
+func (s *Server) Metrics() *metrics.Prometheus {
+	return s.metrics
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.admit(w, r) {
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// Flush persists pending inserts; call it before shutting down
+func (s *Server) Flush() error {
+	if s.databases != nil {
+		return s.databases.Flush()
+	}
+	return s.single.client.Flush()
+}
+
+// Close flushes, waits for any background flush and closes the storage
+func (s *Server) Close() error {
+	if s.databases != nil {
+		return s.databases.Close()
+	}
+	return s.single.client.Close()
+}
+
+// database resolves the database a request is for: the /db/{name}/ path
+// prefix, else name from the request itself. With NewMulti a database
+// that doesn't exist is created when create is set; otherwise, and for
+// any bad name, the error is written and ok is false. Call release once
+// the request is done with the database.
+func (s *Server) database(w http.ResponseWriter, r *http.Request, name string, create bool) (db *database, release func(), ok bool) {
+	if pathName := r.PathValue("name"); pathName != "" {
+		name = pathName
+	}
+
+	if s.databases == nil {
+		if name != "" {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("database %q: this server holds a single database", name))
+			return nil, nil, false
+		}
+		return s.single, func() {}, true
+	}
+
+	if name == "" {
+		writeError(w, http.StatusBadRequest, "database is required")
+		return nil, nil, false
+	}
+	db, release, err := s.databases.acquire(name, create)
+	switch {
+	case errors.Is(err, ErrDatabaseNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+		return nil, nil, false
+	case err != nil && ValidDatabaseName(name) != nil:
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil, nil, false
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return nil, nil, false
+	}
+	return db, release, true
+}
+
+func (s *Server) handleInsert(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "only POST method is supported")
+		return
+	}
+
+	var req InsertRequest
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+
+	if req.Key == "" || req.Text == "" {
+		writeError(w, http.StatusBadRequest, "key and text are required")
+		return
+	}
+
+	db, release, ok := s.database(w, r, req.Database, true)
+	if !ok {
+		return
+	}
+	defer release()
+
+	if req.Dims > 0 {
+		if err := db.client.SetDimensions(req.Dims); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid dims: %v", err))
+			return
+		}
+	}
+	stats, err := db.client.InsertStats(req.Key, req.Text, nil)
+
+	if err != nil {
+		// Another process saved the file since this server loaded it; the
+		// insert is kept but can't be flushed until the server reloads
+		status := http.StatusInternalServerError
+		if errors.Is(err, client.ErrConcurrentModification) {
+			status = http.StatusConflict
+		}
+		writeError(w, status, fmt.Sprintf("insert failed: %v", err))
+		return
+	}
+
+	resp := Response{Message: "insert successful"}
+	if req.Debug {
+		resp.Stats = &stats
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "only POST method is supported")
+		return
+	}
+
+	var req SearchRequest
+	if !s.decodeBody(w, r, &req) {
+		return
+	}
+
+	if req.Text == "" {
+		writeError(w, http.StatusBadRequest, "text is required")
+		return
+	}
+
+	if req.MinScoreOverridesThreshold() {
+		log.Printf("search: min_score %g overrides threshold %g", req.MinScore, req.Threshold)
+	}
+	opts := req.SearchOptions.WithDefaults()
+	filter, err := types.FilterFromJSON(req.Filter)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid filter: %v", err))
+		return
+	}
+	opts.Filter = filter
+	if err := opts.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	opts.MaxCandidates = s.MaxCandidates
+	if s.SearchTimeout > 0 {
+		opts.Deadline = start.Add(s.SearchTimeout)
+	}
+	if req.Explain {
+		opts.Explanation = &types.ExplainReport{}
+	}
+	opts.Hint = req.Debug
+
+	db, release, ok := s.database(w, r, req.Database, false)
+	if !ok {
+		return
+	}
+	defer release()
+
+	results, stats, err := db.client.SearchOpts(req.Text, opts)
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("search failed: %v", err))
+		return
+	}
+
+	resp := Response{Message: "search successful", Data: results, Truncated: stats.Truncated, Explain: opts.Explanation}
+	if req.Debug {
+		resp.Stats = &stats
+		resp.Hint = stats.Hint
+	}
+
+	if !req.Detailed {
+		values := make([]string, len(results))
+		for i, result := range results {
+			values[i] = result.Text
+		}
+		resp.Data = values
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "only GET method is supported")
+		return
+	}
+
+	db, release, ok := s.database(w, r, r.URL.Query().Get("database"), false)
+	if !ok {
+		return
+	}
+	defer release()
+
+	stats, err := db.client.Stats()
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("info failed: %v", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, Response{Message: "info", Data: stats})
+}
+
+// handleDatabases lists the databases a NewMulti server holds
+func (s *Server) handleDatabases(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "only GET method is supported")
+		return
+	}
+
+	names, err := s.databases.Names()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("listing databases failed: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, Response{Message: "databases", Data: names})
+}
+
+func writeJSON(w http.ResponseWriter, status int, resp Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func writeError(w http.ResponseWriter, status int, errMsg string) {
+	writeJSON(w, status, Response{Error: errMsg})
+}
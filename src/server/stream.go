@@ -0,0 +1,196 @@
+package server
+
+import (
+	"Hippocampus/src/client"
+	"Hippocampus/src/types"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// StreamResult is a "result" event of /search/stream: one hit, sent as the
+// search scores it. Rank is its place among the hits sent so far, 1 being
+// the closest, so a client can keep a running list in order.
+type StreamResult struct {
+	Text       string            `json:"text"`
+	Distance   float32           `json:"distance"`
+	Similarity float32           `json:"similarity"`
+	Rank       int               `json:"rank"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+}
+
+// StreamSummary is the "summary" event that ends a /search/stream
+// response: the final ranked topK and how many hits were streamed
+type StreamSummary struct {
+	Results   []client.SearchResult `json:"results"`
+	Streamed  int                   `json:"streamed"`
+	Truncated bool                  `json:"truncated,omitempty"` // search limits stopped the search early
+}
+
+// handleSearchStream answers GET /search/stream?text=...&epsilon=...
+// &threshold=...&top_k=...&max_distance=...&min_score=...&filter=<json>
+// with server-sent events: a "result" per hit as it is found, then a
+// "summary", or an "error" if the search fails once streaming has begun. A
+// client that disconnects stops the search.
+func (s *Server) handleSearchStream(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "only GET method is supported")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported by this connection")
+		return
+	}
+
+	query := r.URL.Query()
+	text := query.Get("text")
+	if text == "" {
+		writeError(w, http.StatusBadRequest, "text is required")
+		return
+	}
+
+	opts, err := streamOptions(query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if opts.MinScoreOverridesThreshold() {
+		log.Printf("search: min_score %g overrides threshold %g", opts.MinScore, opts.Threshold)
+	}
+	opts = opts.WithDefaults()
+	if err := opts.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	opts.MaxCandidates = s.MaxCandidates
+	if s.SearchTimeout > 0 {
+		opts.Deadline = start.Add(s.SearchTimeout)
+	}
+
+	// The event stream starts with the first event, so a search that fails
+	// before finding anything still gets a plain JSON error
+	started := false
+	begin := func() {
+		if started {
+			return
+		}
+		started = true
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+	}
+
+	db, release, ok := s.database(w, r, query.Get("database"), false)
+	if !ok {
+		return
+	}
+	defer release()
+
+	var distances []float32 // every hit sent so far, closest first
+	results, stats, err := db.client.SearchStream(r.Context(), text, opts, func(hit client.SearchResult) bool {
+		rank := sort.Search(len(distances), func(i int) bool { return distances[i] > hit.Distance })
+		distances = slices.Insert(distances, rank, hit.Distance)
+
+		begin()
+		if err := writeEvent(w, "result", StreamResult{
+			Text:       hit.Text,
+			Distance:   hit.Distance,
+			Similarity: hit.Similarity,
+			Rank:       rank + 1,
+			Metadata:   hit.Metadata,
+		}); err != nil {
+			return false
+		}
+		flusher.Flush()
+		return true
+	})
+
+	if r.Context().Err() != nil {
+		return
+	}
+	if err != nil {
+		if !started {
+			writeError(w, http.StatusInternalServerError, fmt.Sprintf("search failed: %v", err))
+			return
+		}
+		writeEvent(w, "error", Response{Error: fmt.Sprintf("search failed: %v", err)})
+		flusher.Flush()
+		return
+	}
+
+	begin()
+	writeEvent(w, "summary", StreamSummary{Results: results, Streamed: len(distances), Truncated: stats.Truncated})
+	flusher.Flush()
+}
+
+// streamOptions reads the search parameters of a /search/stream query
+// string; anything left out is zero, for WithDefaults to fill in
+func streamOptions(query url.Values) (types.SearchOptions, error) {
+	var opts types.SearchOptions
+	floats := []struct {
+		name string
+		dst  *float32
+	}{
+		{"epsilon", &opts.Epsilon},
+		{"threshold", &opts.Threshold},
+		{"max_distance", &opts.MaxDistance},
+		{"min_score", &opts.MinScore},
+	}
+	for _, f := range floats {
+		if v := query.Get(f.name); v != "" {
+			parsed, err := strconv.ParseFloat(v, 32)
+			if err != nil {
+				return opts, fmt.Errorf("invalid %s: %v", f.name, err)
+			}
+			*f.dst = float32(parsed)
+		}
+	}
+
+	if v := query.Get("top_k"); v != "" {
+		topK, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid top_k: %v", err)
+		}
+		opts.TopK = topK
+	}
+
+	if v := query.Get("track_access"); v != "" {
+		track, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid track_access: %v", err)
+		}
+		opts.TrackAccess = track
+	}
+
+	if v := query.Get("filter"); v != "" {
+		var raw map[string]interface{}
+		if err := json.Unmarshal([]byte(v), &raw); err != nil {
+			return opts, fmt.Errorf("invalid filter: %v", err)
+		}
+		filter, err := types.FilterFromJSON(raw)
+		if err != nil {
+			return opts, fmt.Errorf("invalid filter: %v", err)
+		}
+		opts.Filter = filter
+	}
+	return opts, nil
+}
+
+// writeEvent writes one server-sent event with data encoded as JSON
+func writeEvent(w http.ResponseWriter, event string, data any) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, encoded)
+	return err
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"Hippocampus/src/client"
+	"Hippocampus/src/embedding"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestClient is a client on a temporary file whose embedder maps
+// "query" to the first axis and "m0".."m<n-1>" to points increasingly far
+// from it, with n of them stored
+func newTestClient(t *testing.T, n int) *client.Client {
+	t.Helper()
+	c, err := client.New(filepath.Join(t.TempDir(), "tree.bin"), "us-east-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetVerbose(false)
+	mock := embedding.NewMockProvider(512)
+	c.Embedder = mock
+
+	query := make([]float32, 512)
+	query[0] = 1
+	mock.SetResponse("query", query)
+	texts := make([]string, n)
+	for i := range texts {
+		texts[i] = fmt.Sprintf("m%d", i)
+		vec := make([]float32, 512)
+		vec[0], vec[1] = 1, 0.05*float32(i+1)
+		mock.SetResponse(texts[i], vec)
+	}
+	if n > 0 {
+		if err := c.InsertTexts(texts, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c
+}
+
+// event is one server-sent event
+type event struct {
+	name string
+	data string
+}
+
+// readEvents reads the server-sent events of a response to the end
+func readEvents(t *testing.T, resp *http.Response) []event {
+	t.Helper()
+	var events []event
+	var current event
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			events = append(events, current)
+			current = event{}
+		case strings.HasPrefix(line, "event: "):
+			current.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			current.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func TestSearchStreamSendsEvents(t *testing.T) {
+	ts := httptest.NewServer(New(newTestClient(t, 4)))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/search/stream?text=query&epsilon=1&max_distance=1&top_k=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status %d, Content-Type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	events := readEvents(t, resp)
+	if len(events) != 5 {
+		t.Fatalf("got %d events, want 4 results and a summary: %v", len(events), events)
+	}
+	for i, e := range events[:4] {
+		var result StreamResult
+		if e.name != "result" || json.Unmarshal([]byte(e.data), &result) != nil {
+			t.Fatalf("event %d: %s %s, want a result", i, e.name, e.data)
+		}
+		if result.Rank < 1 || result.Rank > i+1 || !strings.HasPrefix(result.Text, "m") {
+			t.Errorf("event %d: %+v, want a hit ranked among the %d sent", i, result, i+1)
+		}
+	}
+
+	var summary StreamSummary
+	if events[4].name != "summary" || json.Unmarshal([]byte(events[4].data), &summary) != nil {
+		t.Fatalf("last event %s %s, want the summary", events[4].name, events[4].data)
+	}
+	if summary.Streamed != 4 || len(summary.Results) != 2 || summary.Results[0].Text != "m0" || summary.Results[1].Text != "m1" {
+		t.Errorf("summary %+v, want 4 streamed and m0, m1 ranked", summary)
+	}
+}
+
+func TestSearchStreamErrorsBeforeStreaming(t *testing.T) {
+	ts := httptest.NewServer(New(newTestClient(t, 1)))
+	defer ts.Close()
+
+	for _, query := range []string{
+		"",
+		"text=query&top_k=many",
+		"text=query&filter=" + url.QueryEscape("{not json"),
+	} {
+		resp, err := http.Get(ts.URL + "/search/stream?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body Response
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest || err != nil || body.Error == "" {
+			t.Errorf("%q: status %d, error %q; want a JSON 400", query, resp.StatusCode, body.Error)
+		}
+	}
+
+	resp, err := http.Post(ts.URL+"/search/stream?text=query", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status %d, want 405", resp.StatusCode)
+	}
+}
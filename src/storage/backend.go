@@ -0,0 +1,52 @@
+package storage
+
+import "Hippocampus/src/types"
+
+// Backend is where a client keeps its tree between flushes
+type Backend interface {
+	Load() (*types.Tree, error)
+	Save(t *types.Tree) error
+
+	// Scan streams persisted nodes in insertion order; fn returns false to stop
+	Scan(fn func(n *types.Node) bool) error
+
+	// Lock and TryLock guard Save against other writers; call the returned
+	// func to release
+	Lock() (func() error, error)
+	TryLock() (func() error, error)
+
+	// Size is the persisted size in bytes and Path names the backend in messages
+	Size() (int64, error)
+	Path() string
+
+	// Schema reads the persisted metadata schema without loading the tree;
+	// nil if there is none
+	Schema() (*types.Schema, error)
+}
+
+// Searcher is a Backend that can search without Load, a part at a time,
+// for databases larger than memory (see ShardedStorage)
+type Searcher interface {
+	Backend
+
+	// Settings is an empty tree carrying the persisted settings a query is
+	// prepared and checked with
+	Settings() (*types.Tree, error)
+
+	// CanSearch reports whether SearchOpts supports opts; the rest need Load
+	CanSearch(opts types.SearchOptions) bool
+
+	// SearchOpts is Tree.SearchOpts over the persisted nodes, for a query
+	// already prepared with Settings
+	SearchOpts(query [512]float32, opts types.SearchOptions) ([]types.ScoredNode, bool, error)
+}
+
+var (
+	_ Backend = (*FileStorage)(nil)
+	_ Backend = (*MemoryStorage)(nil)
+	_ Backend = (*ShardedStorage)(nil)
+	_ Backend = (*S3Backend)(nil)
+	_ Backend = (*ShadowStorage)(nil)
+
+	_ Searcher = (*ShardedStorage)(nil)
+)
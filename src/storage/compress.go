@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"Hippocampus/src/types"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// DefaultCompressThreshold is used when a compressed file is loaded without
+// an explicit threshold. Below roughly this size gzip's header costs more
+// than it saves.
+const DefaultCompressThreshold = 256
+
+// Text block schemes, the one-byte marker before each block
+const (
+	textRaw  byte = 0
+	textGzip byte = 1
+)
+
+// writeTextBlock writes a scheme byte and the length-prefixed encoding of
+// the value and metadata, gzipped when that is at least threshold bytes and
+// compression actually makes it smaller
+func writeTextBlock(w io.Writer, n *types.Node, threshold int) error {
+	var raw bytes.Buffer
+	if err := writeText(&raw, n); err != nil {
+		return err
+	}
+
+	scheme, block := textRaw, raw.Bytes()
+	if raw.Len() >= threshold {
+		var zipped bytes.Buffer
+		zw := gzip.NewWriter(&zipped)
+		if _, err := zw.Write(raw.Bytes()); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		if zipped.Len() < raw.Len() {
+			scheme, block = textGzip, zipped.Bytes()
+		}
+	}
+
+	if _, err := w.Write([]byte{scheme}); err != nil {
+		return err
+	}
+	return writeBytes(w, block)
+}
+
+func readTextBlock(r io.Reader, n *types.Node, stats *CompressionStats) error {
+	var scheme [1]byte
+	if _, err := io.ReadFull(r, scheme[:]); err != nil {
+		return err
+	}
+
+	block, err := readBytes(r)
+	if err != nil {
+		return err
+	}
+
+	raw := block
+	switch scheme[0] {
+	case textRaw:
+	case textGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(block))
+		if err != nil {
+			return fmt.Errorf("corrupt compressed text: %w", err)
+		}
+		if raw, err = io.ReadAll(zr); err != nil {
+			return fmt.Errorf("corrupt compressed text: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown text compression scheme %d", scheme[0])
+	}
+
+	if stats != nil {
+		stats.TextRawBytes += int64(len(raw))
+		stats.TextStoredBytes += int64(len(block))
+		if scheme[0] == textGzip {
+			stats.CompressedNodes++
+		}
+	}
+
+	return readText(bytes.NewReader(raw), n, formatVersion)
+}
+
+// CompressionStats reports how much node text compression saves. Vectors
+// are stored as raw float32s and counted separately.
+type CompressionStats struct {
+	Nodes           int   `json:"nodes"`
+	CompressedNodes int   `json:"compressed_nodes"`
+	TextRawBytes    int64 `json:"text_raw_bytes"`
+	TextStoredBytes int64 `json:"text_stored_bytes"`
+	VectorBytes     int64 `json:"vector_bytes"`
+}
+
+// TextSavings is the fraction of text bytes saved, 0 when nothing is compressed
+func (s CompressionStats) TextSavings() float64 {
+	if s.TextRawBytes == 0 {
+		return 0
+	}
+	return 1 - float64(s.TextStoredBytes)/float64(s.TextRawBytes)
+}
+
+// CompressionStats streams the file and measures its node text
+func (fs *FileStorage) CompressionStats() (CompressionStats, error) {
+	var stats CompressionStats
+
+	f, err := os.Open(fs.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return stats, nil
+		}
+		return stats, err
+	}
+	defer f.Close()
+
+	r, err := openFileReader(f)
+	if err != nil {
+		return stats, err
+	}
+	h, err := readHeader(r)
+	if err != nil {
+		if err == io.EOF {
+			return stats, nil
+		}
+		return stats, err
+	}
+
+	var n types.Node
+	for i := int64(0); i < h.nodeCount; i++ {
+		if h.flags&flagCompressText != 0 {
+			err = readNode(r, &n, h, &stats)
+		} else {
+			err = readNode(r, &n, h, nil)
+			if err == nil {
+				// Raw text: stored size is the encoded size
+				var raw countingWriter
+				writeText(&raw, &n)
+				stats.TextRawBytes += raw.n
+				stats.TextStoredBytes += raw.n
+			}
+		}
+		if err != nil {
+			return stats, err
+		}
+		stats.Nodes++
+		stats.VectorBytes += int64(binary.Size(n.Key))
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"Hippocampus/src/types"
+	"bytes"
+	"math/rand/v2"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// unicodeText mixes scripts, combining marks, emoji (including a ZWJ
+// sequence and a flag), right-to-left text and a few control characters
+const unicodeText = "記憶は海馬に保存される。 Память — это процесс. " +
+	"é ñ 👩‍💻 🇳🇿 😀 " +
+	"الذاكرة طويلة المدى " +
+	"tab\there\x00nul separator"
+
+// incompressible is n random bytes, which gzip can't shrink and which are
+// not valid UTF-8. Different seeds give unrelated bytes.
+func incompressible(n int, seed uint64) string {
+	rng := rand.New(rand.NewPCG(seed, seed))
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(rng.UintN(256))
+	}
+	return string(b)
+}
+
+// roundTripBlock writes n as a text block and reads it back, returning the
+// block's scheme byte
+func roundTripBlock(t *testing.T, n *types.Node, threshold int) (types.Node, byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := writeTextBlock(&buf, n, threshold); err != nil {
+		t.Fatal(err)
+	}
+	scheme := buf.Bytes()[0]
+
+	var got types.Node
+	if err := readTextBlock(&buf, &got, nil); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("%d bytes left after the block", buf.Len())
+	}
+	return got, scheme
+}
+
+func TestTextBlockUnicodeRoundTrip(t *testing.T) {
+	n := &types.Node{
+		Value: strings.Repeat(unicodeText, 20),
+		Metadata: map[string]string{
+			"язык":  "русский",
+			"絵文字":   "👍🏽",
+			"empty": "",
+		},
+	}
+
+	for _, threshold := range []int{0, 1 << 20} {
+		got, scheme := roundTripBlock(t, n, threshold)
+		want := textGzip
+		if threshold > 0 {
+			want = textRaw
+		}
+		if scheme != want {
+			t.Errorf("threshold %d: scheme %d, want %d", threshold, scheme, want)
+		}
+		if got.Value != n.Value {
+			t.Errorf("threshold %d: value changed in the round trip", threshold)
+		}
+		if !reflect.DeepEqual(got.Metadata, n.Metadata) {
+			t.Errorf("threshold %d: metadata %v, want %v", threshold, got.Metadata, n.Metadata)
+		}
+	}
+}
+
+func TestTextBlockIncompressibleStaysRaw(t *testing.T) {
+	n := &types.Node{
+		Value:    incompressible(4096, 1),
+		Metadata: map[string]string{"blob": incompressible(512, 2)},
+	}
+
+	got, scheme := roundTripBlock(t, n, 0)
+	if scheme != textRaw {
+		t.Errorf("scheme %d: gzip was kept although it made the text bigger", scheme)
+	}
+	if got.Value != n.Value || !reflect.DeepEqual(got.Metadata, n.Metadata) {
+		t.Error("incompressible text changed in the round trip")
+	}
+}
+
+func TestCompressedFileRoundTrip(t *testing.T) {
+	tree := types.NewTree()
+	texts := []string{
+		strings.Repeat(unicodeText, 10), // compressed
+		"短い",                            // under the threshold
+		incompressible(2048, 3),         // over it, but gzip doesn't help
+		"",
+	}
+	for i, text := range texts {
+		var key [512]float32
+		key[i] = 1
+		metadata := map[string]string{"名前": text[:min(len(text), 12)]}
+		if err := tree.InsertWithMetadata(key, text, metadata); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "compressed.bin")
+	fs := New(path)
+	fs.CompressThreshold = 64
+	if err := fs.Save(tree); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := New(path).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Nodes) != len(tree.Nodes) {
+		t.Fatalf("loaded %d nodes, want %d", len(loaded.Nodes), len(tree.Nodes))
+	}
+	for i := range tree.Nodes {
+		want, got := tree.Nodes[i], loaded.Nodes[i]
+		if got.Key != want.Key || got.Value != want.Value || !reflect.DeepEqual(got.Metadata, want.Metadata) {
+			t.Errorf("node %d changed in the round trip", i)
+		}
+	}
+
+	stats, err := New(path).CompressionStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Nodes != len(texts) || stats.CompressedNodes != 1 {
+		t.Errorf("stats = %+v, want %d nodes with 1 compressed", stats, len(texts))
+	}
+	if stats.TextStoredBytes >= stats.TextRawBytes {
+		t.Errorf("stored %d text bytes for %d raw", stats.TextStoredBytes, stats.TextRawBytes)
+	}
+}
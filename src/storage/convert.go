@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"Hippocampus/src/types"
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Format is an on-disk node encoding Convert can write
+type Format string
+
+const (
+	FormatPlain      Format = "plain"      // value and metadata stored raw
+	FormatCompressed Format = "compressed" // node text gzipped, see compress.go
+)
+
+// ConvertResult reports the sizes before and after a Convert
+type ConvertResult struct {
+	Nodes       int64
+	BeforeBytes int64
+	AfterBytes  int64
+}
+
+// Ratio is the converted size as a fraction of the original
+func (r ConvertResult) Ratio() float64 {
+	if r.BeforeBytes == 0 {
+		return 1
+	}
+	return float64(r.AfterBytes) / float64(r.BeforeBytes)
+}
+
+// Convert rewrites the database file at srcPath to dstPath in format,
+// streaming one node at a time so memory use does not grow with the
+// database. Both formats are lossless: keys, payloads and the header are
+// copied bit for bit and only the text encoding changes. dstPath may be
+// srcPath; the result is written to a temp file and renamed into place
+// under dstPath's write lock, like Save.
+func Convert(srcPath, dstPath string, format Format) (ConvertResult, error) {
+	var result ConvertResult
+
+	var threshold int
+	switch format {
+	case FormatPlain:
+	case FormatCompressed:
+		threshold = DefaultCompressThreshold
+	default:
+		return result, fmt.Errorf("unknown format %q (want %s or %s)", format, FormatPlain, FormatCompressed)
+	}
+
+	unlock, err := New(dstPath).Lock()
+	if err != nil {
+		return result, err
+	}
+	defer unlock()
+
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return result, err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return result, err
+	}
+	if info.IsDir() {
+		return result, fmt.Errorf("%s is a sharded database; use compact -compress-threshold to convert it", srcPath)
+	}
+	result.BeforeBytes = info.Size()
+
+	r, err := openFileReader(src)
+	if err != nil {
+		return result, err
+	}
+	h, err := readHeader(r)
+	if err != nil && err != io.EOF {
+		return result, fmt.Errorf("%s: %w", srcPath, err)
+	}
+	if err := checkNodeCount(r, h); err != nil {
+		return result, fmt.Errorf("%s: %w", srcPath, err)
+	}
+
+	// Like Save, the converted file is one generation on from the original
+	flags := h.flags&^flagCompressText | flagGeneration
+	if threshold > 0 {
+		flags |= flagCompressText
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(dstPath), filepath.Base(dstPath)+".tmp-*")
+	if err != nil {
+		return result, err
+	}
+	tmpPath := f.Name()
+	defer os.Remove(tmpPath)
+
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return result, err
+	}
+
+	if err := convertNodes(f, r, h, flags, threshold); err != nil {
+		f.Close()
+		return result, fmt.Errorf("%s: %w", srcPath, err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return result, err
+	}
+	if err := f.Close(); err != nil {
+		return result, err
+	}
+
+	if info, err := os.Stat(tmpPath); err == nil {
+		result.AfterBytes = info.Size()
+	}
+	if err := os.Rename(tmpPath, dstPath); err != nil {
+		return result, err
+	}
+	result.Nodes = h.nodeCount
+	return result, nil
+}
+
+// convertNodes writes a header with flags, then re-encodes each of h's
+// nodes from r, reusing one node so only one is in memory at a time
+func convertNodes(out io.Writer, r io.Reader, h header, flags int64, threshold int) error {
+	w := bufio.NewWriter(out)
+	if err := writeHeader(w, flags, h.radii, h.projection, h.schema, h.config, h.generation+1, h.nodeCount); err != nil {
+		return err
+	}
+
+	var n types.Node
+	for i := int64(0); i < h.nodeCount; i++ {
+		if err := readNode(r, &n, h, nil); err != nil {
+			return fmt.Errorf("node %d: %w", i, err)
+		}
+		if err := writeNode(w, &n, flags, threshold); err != nil {
+			return err
+		}
+	}
+
+	return w.Flush()
+}
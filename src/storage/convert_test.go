@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"Hippocampus/src/types"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// convertibleTree has repetitive text worth compressing, payloads, alternate
+// keys, radii and a schema, so every header part is carried across
+func convertibleTree(t *testing.T) *types.Tree {
+	t.Helper()
+	tree := types.NewTree()
+	tree.Radii = map[string]float32{"similar": 0.25}
+	tree.Schema = &types.Schema{Fields: map[string]types.FieldSpec{"n": {Type: types.FieldInt}}}
+	for i := 0; i < 50; i++ {
+		var key [512]float32
+		key[i] = float32(i) + 0.5
+		value := strings.Repeat(fmt.Sprintf("memory %d %s ", i, unicodeText), 1+i%5)
+		if err := tree.InsertWithPayload(key, value, map[string]string{"n": fmt.Sprint(i)}, []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tree.Nodes[3].AltKeys = [][512]float32{{1, 2, 3}}
+	return tree
+}
+
+func TestConvertRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	plainPath := filepath.Join(dir, "tree.bin")
+	want := convertibleTree(t)
+	if err := New(plainPath).Save(want); err != nil {
+		t.Fatal(err)
+	}
+
+	load := func(path string) (*types.Tree, FileHeader) {
+		t.Helper()
+		fs := New(path)
+		tree, err := fs.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, err := fs.Header()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tree, h
+	}
+	check := func(path string, compressed bool) {
+		t.Helper()
+		got, h := load(path)
+		if !reflect.DeepEqual(got.Nodes, want.Nodes) {
+			t.Fatalf("%s: nodes differ after conversion", path)
+		}
+		if !reflect.DeepEqual(got.Radii, want.Radii) || !reflect.DeepEqual(got.Schema, want.Schema) {
+			t.Fatalf("%s: header lost radii or schema: %v %v", path, got.Radii, got.Schema)
+		}
+		if slices.Contains(h.Flags, "compress-text") != compressed {
+			t.Fatalf("%s: flags %v, want compressed %v", path, h.Flags, compressed)
+		}
+	}
+
+	compressedPath := filepath.Join(dir, "tree.cz")
+	result, err := Convert(plainPath, compressedPath, FormatCompressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Nodes != int64(len(want.Nodes)) || result.AfterBytes >= result.BeforeBytes {
+		t.Fatalf("result %+v , want %d nodes in a smaller file", result, len(want.Nodes))
+	}
+	check(compressedPath, true)
+
+	backPath := filepath.Join(dir, "back.bin")
+	if _, err := Convert(compressedPath, backPath, FormatPlain); err != nil {
+		t.Fatal(err)
+	}
+	check(backPath, false)
+
+	// In place, through a temp file, and nothing is left behind
+	if _, err := Convert(backPath, backPath, FormatCompressed); err != nil {
+		t.Fatal(err)
+	}
+	check(backPath, true)
+	if leftovers, _ := filepath.Glob(filepath.Join(dir, "*.tmp-*")); len(leftovers) != 0 {
+		t.Fatalf("temp files left behind: %v", leftovers)
+	}
+}
+
+func TestConvertRejectsUnknownFormat(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "tree.bin")
+	if err := New(src).Save(convertibleTree(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(dir, "tree.mmap")
+	if _, err := Convert(src, dst, "mmap"); err == nil {
+		t.Fatal("unknown format accepted")
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Fatalf("failed conversion created %s", dst)
+	}
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"Hippocampus/src/types"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// bogusLength is far more than any file could hold; allocating it would
+// fail outright
+const bogusLength = int64(1) << 60
+
+// corruptFile writes a version 4 file with the given flags and node count
+// whose first node's key is followed by tail, and returns its path
+func corruptFile(t *testing.T, flags, nodeCount int64, tail ...any) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := writeHeader(&buf, flags, nil, nil, nil, nil, 0, nodeCount); err != nil {
+		t.Fatal(err)
+	}
+	var key [512]float32
+	key[0] = 1
+	binary.Write(&buf, binary.LittleEndian, key)
+	for _, v := range tail {
+		if err := binary.Write(&buf, binary.LittleEndian, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Padding, so the checks compare against a real remainder
+	buf.Write(make([]byte, 64))
+
+	path := filepath.Join(t.TempDir(), "corrupt.bin")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBogusLengthsAreCorrupt(t *testing.T) {
+	cases := []struct {
+		name      string
+		flags     int64
+		nodeCount int64
+		tail      []any
+	}{
+		{"value length", 0, 1, []any{bogusLength}},
+		{"metadata count", 0, 1, []any{int64(1), byte('v'), bogusLength}},
+		{"metadata key length", 0, 1, []any{int64(0), int64(1), bogusLength}},
+		{"payload length", 0, 1, []any{int64(0), int64(0), bogusLength}},
+		{"negative value length", 0, 1, []any{int64(-1)}},
+		{"compressed block length", flagCompressText, 1, []any{textRaw, bogusLength}},
+		{"compressed value length", flagCompressText, 1, []any{textRaw, int64(16), bogusLength, int64(0)}},
+		{"alternate key count", flagAltKeys, 1, []any{int64(0), int64(0), int64(0), int64(maxAltKeys)}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := New(corruptFile(t, tc.flags, tc.nodeCount, tc.tail...))
+
+			if _, err := fs.Load(); !errors.Is(err, ErrCorrupt) {
+				t.Errorf("Load: %v, want ErrCorrupt", err)
+			}
+			if err := fs.Scan(func(*types.Node) bool { return true }); !errors.Is(err, ErrCorrupt) {
+				t.Errorf("Scan: %v, want ErrCorrupt", err)
+			}
+			if _, err := GetNode(fs, 0); !errors.Is(err, ErrCorrupt) {
+				t.Errorf("GetNode: %v, want ErrCorrupt", err)
+			}
+		})
+	}
+
+	// Only Load allocates by the node count; Scan streams the nodes there are
+	fs := New(corruptFile(t, 0, bogusLength))
+	if _, err := fs.Load(); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Load with a bogus node count: %v, want ErrCorrupt", err)
+	}
+}
+
+// A bogus length inside a compressed block is caught against the
+// decompressed block, not the file
+func TestReadTextBlockBogusLength(t *testing.T) {
+	var block bytes.Buffer
+	binary.Write(&block, binary.LittleEndian, bogusLength)
+	block.WriteString("short value")
+
+	var buf bytes.Buffer
+	buf.WriteByte(textRaw)
+	if err := writeBytes(&buf, block.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	var n types.Node
+	if err := readTextBlock(bytes.NewReader(buf.Bytes()), &n, nil); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("readTextBlock: %v, want ErrCorrupt", err)
+	}
+}
+
+// A well-formed file next to the corrupt ones still loads
+func TestSaneLengthsLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.bin")
+	tree := types.NewTree()
+	var key [512]float32
+	key[0] = 1
+	if err := tree.InsertWithMetadata(key, "value", map[string]string{"k": "v"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(path).Save(tree); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := GetNode(New(path), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Value != "value" || n.Metadata["k"] != "v" {
+		t.Errorf("GetNode returned %q %v", n.Value, n.Metadata)
+	}
+}
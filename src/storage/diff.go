@@ -0,0 +1,227 @@
+package storage
+
+import (
+	"Hippocampus/src/types"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+)
+
+// diffIDKey is the metadata key Diff matches nodes on when both carry it;
+// it is the key imports keep source IDs under (importer.IDKey)
+const diffIDKey = "id"
+
+// DiffReport lists how the nodes of database B differ from those of A
+type DiffReport struct {
+	A       string       `json:"a"`
+	B       string       `json:"b"`
+	NodesA  int          `json:"nodes_a"`
+	NodesB  int          `json:"nodes_b"`
+	Same    int          `json:"same"`
+	OnlyA   []DiffNode   `json:"only_a"`
+	OnlyB   []DiffNode   `json:"only_b"`
+	Changed []NodeChange `json:"changed"`
+}
+
+// DiffNode identifies a node present in only one database
+type DiffNode struct {
+	Index int    `json:"index"`
+	ID    string `json:"id,omitempty"`
+	Value string `json:"value"`
+}
+
+// NodeChange is a node found in both databases with different contents.
+// Fields names what differs: value, vector, metadata or payload.
+type NodeChange struct {
+	IndexA int      `json:"index_a"`
+	IndexB int      `json:"index_b"`
+	ID     string   `json:"id,omitempty"`
+	Value  string   `json:"value"` // as stored in B
+	Fields []string `json:"fields"`
+}
+
+// Identical reports whether the databases hold the same nodes
+func (r *DiffReport) Identical() bool {
+	return len(r.OnlyA) == 0 && len(r.OnlyB) == 0 && len(r.Changed) == 0
+}
+
+// nodeDigest fingerprints a node so A can be held in memory as hashes
+// rather than nodes
+type nodeDigest struct {
+	value, vector, metadata, payload [16]byte
+}
+
+type digestRef struct {
+	index  int
+	digest nodeDigest
+}
+
+// Diff compares two databases (files or sharded directories). Nodes are
+// matched on their "id" metadata when they have one, and otherwise on value
+// and vector together, so an unmatched node shows up as only in A or B and a
+// matched one can differ only in what was not matched on. Both databases
+// are streamed; only a fixed-size digest per node of A is kept in memory,
+// and A is read a second time to describe nodes that are only in A.
+func Diff(aPath, bPath string) (DiffReport, error) {
+	report := DiffReport{A: aPath, B: bPath, OnlyA: []DiffNode{}, OnlyB: []DiffNode{}, Changed: []NodeChange{}}
+
+	for _, path := range []string{aPath, bPath} {
+		if _, err := os.Stat(path); err != nil {
+			return report, err
+		}
+	}
+
+	a, b := Open(aPath), Open(bPath)
+
+	pending := make(map[[32]byte][]digestRef)
+	err := a.Scan(func(n *types.Node) bool {
+		match := matchKey(n)
+		pending[match] = append(pending[match], digestRef{index: report.NodesA, digest: digestNode(n)})
+		report.NodesA++
+		return true
+	})
+	if err != nil {
+		return report, fmt.Errorf("%s: %w", aPath, err)
+	}
+
+	err = b.Scan(func(n *types.Node) bool {
+		index := report.NodesB
+		report.NodesB++
+
+		match := matchKey(n)
+		refs := pending[match]
+		if len(refs) == 0 {
+			report.OnlyB = append(report.OnlyB, DiffNode{Index: index, ID: n.Metadata[diffIDKey], Value: n.Value})
+			return true
+		}
+
+		// Duplicates pair up in order
+		ref := refs[0]
+		if len(refs) == 1 {
+			delete(pending, match)
+		} else {
+			pending[match] = refs[1:]
+		}
+
+		if fields := ref.digest.differences(digestNode(n)); len(fields) > 0 {
+			report.Changed = append(report.Changed, NodeChange{
+				IndexA: ref.index,
+				IndexB: index,
+				ID:     n.Metadata[diffIDKey],
+				Value:  n.Value,
+				Fields: fields,
+			})
+		} else {
+			report.Same++
+		}
+		return true
+	})
+	if err != nil {
+		return report, fmt.Errorf("%s: %w", bPath, err)
+	}
+
+	if len(pending) == 0 {
+		return report, nil
+	}
+
+	onlyA := make(map[int]bool)
+	for _, refs := range pending {
+		for _, ref := range refs {
+			onlyA[ref.index] = true
+		}
+	}
+
+	index := 0
+	err = a.Scan(func(n *types.Node) bool {
+		if onlyA[index] {
+			report.OnlyA = append(report.OnlyA, DiffNode{Index: index, ID: n.Metadata[diffIDKey], Value: n.Value})
+		}
+		index++
+		return true
+	})
+	if err != nil {
+		return report, fmt.Errorf("%s: %w", aPath, err)
+	}
+
+	return report, nil
+}
+
+// matchKey is the hash Diff pairs nodes by
+func matchKey(n *types.Node) [32]byte {
+	h := sha256.New()
+	if id, ok := n.Metadata[diffIDKey]; ok {
+		h.Write([]byte("id\x00"))
+		h.Write([]byte(id))
+	} else {
+		h.Write([]byte("value\x00"))
+		writeString(h, n.Value)
+		writeVector(h, &n.Key)
+	}
+
+	var key [32]byte
+	h.Sum(key[:0])
+	return key
+}
+
+func digestNode(n *types.Node) nodeDigest {
+	var d nodeDigest
+
+	h := sha256.New()
+	h.Write([]byte(n.Value))
+	copy(d.value[:], h.Sum(nil))
+
+	h.Reset()
+	writeVector(h, &n.Key)
+	for i := range n.AltKeys {
+		writeVector(h, &n.AltKeys[i])
+	}
+	copy(d.vector[:], h.Sum(nil))
+
+	// Metadata order is random; hash it sorted by key
+	h.Reset()
+	keys := make([]string, 0, len(n.Metadata))
+	for k := range n.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		writeString(h, k)
+		writeString(h, n.Metadata[k])
+	}
+	copy(d.metadata[:], h.Sum(nil))
+
+	h.Reset()
+	h.Write(n.Payload)
+	copy(d.payload[:], h.Sum(nil))
+
+	return d
+}
+
+func writeVector(h io.Writer, key *[512]float32) {
+	var buf [4]byte
+	for _, v := range key {
+		binary.LittleEndian.PutUint32(buf[:], math.Float32bits(v))
+		h.Write(buf[:])
+	}
+}
+
+func (d nodeDigest) differences(other nodeDigest) []string {
+	var fields []string
+	if d.value != other.value {
+		fields = append(fields, "value")
+	}
+	if d.vector != other.vector {
+		fields = append(fields, "vector")
+	}
+	if d.metadata != other.metadata {
+		fields = append(fields, "metadata")
+	}
+	if d.payload != other.payload {
+		fields = append(fields, "payload")
+	}
+	return fields
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"Hippocampus/src/types"
+	"encoding/json"
+	"fmt"
+)
+
+// ExportHeaderVersion is the ExportHeader layout this build writes
+const ExportHeaderVersion = 1
+
+// ExportHeader carries what a database file's header holds, so an import
+// recreates the database an export came from rather than only its nodes.
+// It is the first line of the values file ExportNpy writes; its
+// hippocampus_export field tells it apart from the value lines after it.
+type ExportHeader struct {
+	Version    int                `json:"hippocampus_export"` // ExportHeaderVersion
+	Dimensions int                `json:"dimensions"`         // width of the vectors the database takes, see Tree.VectorDims
+	Normalize  bool               `json:"normalize"`
+	Config     *types.Config      `json:"config,omitempty"` // provider, model, metric and retention
+	Schema     *types.Schema      `json:"schema,omitempty"`
+	Radii      map[string]float32 `json:"radii,omitempty"`
+	Projection *types.Projection  `json:"projection,omitempty"`
+	Nodes      int                `json:"nodes"`
+}
+
+// NewExportHeader describes t
+func NewExportHeader(t *types.Tree) *ExportHeader {
+	return &ExportHeader{
+		Version:    ExportHeaderVersion,
+		Dimensions: t.VectorDims(),
+		Normalize:  t.Normalize,
+		Config:     t.Config,
+		Schema:     t.Schema,
+		Radii:      t.Radii,
+		Projection: t.Projection,
+		Nodes:      len(t.Nodes),
+	}
+}
+
+// Validate checks the parts an import would apply to a database
+func (h *ExportHeader) Validate() error {
+	if h.Version > ExportHeaderVersion {
+		return fmt.Errorf("unsupported export header version %d (newest known is %d)", h.Version, ExportHeaderVersion)
+	}
+	if h.Dimensions <= 0 {
+		return fmt.Errorf("export header has %d dimensions", h.Dimensions)
+	}
+	if h.Projection != nil {
+		if err := h.Projection.Validate(); err != nil {
+			return fmt.Errorf("export header: %w", err)
+		}
+		if h.Projection.InputDims != h.Dimensions {
+			return fmt.Errorf("export header has %d dimensions but a projection from %d", h.Dimensions, h.Projection.InputDims)
+		}
+	} else if h.Dimensions != 512 {
+		return fmt.Errorf("export header has %d dimensions but no projection", h.Dimensions)
+	}
+	if err := h.Schema.Validate(); err != nil {
+		return fmt.Errorf("export header: %w", err)
+	}
+	return nil
+}
+
+// ParseExportHeader reads line as an ExportHeader, reporting false when it
+// is some other JSON line, such as an NpyValue
+func ParseExportHeader(line []byte) (*ExportHeader, bool, error) {
+	var probe struct {
+		Version *int `json:"hippocampus_export"`
+	}
+	if json.Unmarshal(line, &probe) != nil || probe.Version == nil {
+		return nil, false, nil
+	}
+
+	h := &ExportHeader{}
+	if err := json.Unmarshal(line, h); err != nil {
+		return nil, true, fmt.Errorf("export header: %w", err)
+	}
+	if err := h.Validate(); err != nil {
+		return nil, true, err
+	}
+	return h, true, nil
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"Hippocampus/src/types"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// headerTree is an empty tree with every section an export header carries
+func headerTree(t *testing.T, inputDims, outputDims int) *types.Tree {
+	t.Helper()
+	tree := types.NewTree()
+	tree.Normalize = true
+	tree.Config = types.NewConfig("titan amazon.titan-embed-text-v2:0", true)
+	tree.Config.Created = time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	tree.Config.Retention = &types.Retention{MaxNodes: 1000}
+	tree.Schema = &types.Schema{Fields: map[string]types.FieldSpec{"count": {Type: types.FieldInt, Required: true}}, Strict: true}
+	tree.Radii = map[string]float32{"apple": 0.25, "orchard": 0.5}
+	if inputDims != 512 || outputDims != 512 {
+		p, err := types.RandomProjection(inputDims, outputDims, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree.Projection = p
+	}
+	return tree
+}
+
+func TestExportHeaderRoundTrip(t *testing.T) {
+	for _, dims := range [][2]int{{512, 512}, {768, 256}} {
+		want := NewExportHeader(headerTree(t, dims[0], dims[1]))
+		if want.Dimensions != dims[0] {
+			t.Fatalf("header of a %d-dimension tree says %d", dims[0], want.Dimensions)
+		}
+		line, err := json.Marshal(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, isHeader, err := ParseExportHeader(line)
+		if err != nil || !isHeader {
+			t.Fatalf("%s: parsed as header %v: %v", line, isHeader, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%d dimensions: header changed across JSON:\n got %+v\nwant %+v", dims[0], got, want)
+		}
+	}
+}
+
+func TestParseExportHeaderSkipsValueLines(t *testing.T) {
+	for _, line := range []string{`{"index":0,"value":"a memory"}`, `"plain string"`, `not json`} {
+		if h, isHeader, err := ParseExportHeader([]byte(line)); h != nil || isHeader || err != nil {
+			t.Errorf("%s: %v %v %v, want it left for the rows", line, h, isHeader, err)
+		}
+	}
+}
+
+func TestExportHeaderValidate(t *testing.T) {
+	projection, err := types.RandomProjection(768, 256, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		header ExportHeader
+		want   string
+	}{
+		{ExportHeader{Version: ExportHeaderVersion + 1, Dimensions: 512}, "unsupported export header version"},
+		{ExportHeader{Version: 1}, "0 dimensions"},
+		{ExportHeader{Version: 1, Dimensions: 768}, "768 dimensions but no projection"},
+		{ExportHeader{Version: 1, Dimensions: 1024, Projection: projection}, "1024 dimensions but a projection from 768"},
+		{ExportHeader{Version: 1, Dimensions: 512, Schema: &types.Schema{Fields: map[string]types.FieldSpec{"n": {Type: "number"}}}}, "unknown field type"},
+	}
+	for _, tc := range cases {
+		if err := tc.header.Validate(); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%+v: %v, want %q", tc.header, err, tc.want)
+		}
+	}
+
+	line, _ := json.Marshal(cases[2].header)
+	if _, isHeader, err := ParseExportHeader(line); !isHeader || err == nil {
+		t.Errorf("invalid header line parsed as header %v with error %v", isHeader, err)
+	}
+}
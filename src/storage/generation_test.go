@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveDetectsConcurrentModification(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.bin")
+	if err := New(path).Save(valuesTree(t, "base")); err != nil {
+		t.Fatal(err)
+	}
+
+	cli, serve := New(path), New(path)
+	if _, err := cli.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := serve.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if cli.Generation() != 1 || serve.Generation() != 1 {
+		t.Fatalf("loaded generations %d and %d, want 1", cli.Generation(), serve.Generation())
+	}
+
+	if err := cli.Save(valuesTree(t, "base", "from cli")); err != nil {
+		t.Fatal(err)
+	}
+	if cli.Generation() != 2 {
+		t.Errorf("generation after saving is %d, want 2", cli.Generation())
+	}
+
+	// The second writer is refused, and the first writer's save is kept
+	err := serve.Save(valuesTree(t, "base", "from serve"))
+	if !errors.Is(err, ErrConcurrentModification) {
+		t.Fatalf("stale save: %v, want ErrConcurrentModification", err)
+	}
+	tree, err := New(path).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree.Nodes) != 2 || tree.Nodes[1].Value != "from cli" {
+		t.Fatalf("file holds %d nodes ending %q after the refused save", len(tree.Nodes), tree.Nodes[len(tree.Nodes)-1].Value)
+	}
+	if serve.Generation() != 1 {
+		t.Errorf("refused save moved the generation to %d", serve.Generation())
+	}
+
+	// Reloading picks up the other save and lets this one through
+	if _, err := serve.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := serve.Save(valuesTree(t, "base", "from cli", "from serve")); err != nil {
+		t.Fatalf("save after reloading: %v", err)
+	}
+	if h, err := New(path).Header(); err != nil || h.Generation != 3 {
+		t.Errorf("header generation %d (%v), want 3", h.Generation, err)
+	}
+
+	// Now the first writer is the stale one
+	if err := cli.Save(valuesTree(t, "lost")); !errors.Is(err, ErrConcurrentModification) {
+		t.Errorf("save over a newer generation: %v, want ErrConcurrentModification", err)
+	}
+}
+
+func TestSaveWithoutLoadContinuesGeneration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.bin")
+
+	// A missing file loads as generation 0, so the first save is 1
+	first := New(path)
+	if _, err := first.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Save(valuesTree(t, "a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Save(valuesTree(t, "a", "b")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A storage that never loaded overwrites without a check but still
+	// counts on from the file
+	blind := New(path)
+	if err := blind.Save(valuesTree(t, "c")); err != nil {
+		t.Fatal(err)
+	}
+	if blind.Generation() != 3 {
+		t.Errorf("blind save wrote generation %d, want 3", blind.Generation())
+	}
+	if err := first.Save(valuesTree(t, "d")); !errors.Is(err, ErrConcurrentModification) {
+		t.Errorf("save after a blind save: %v, want ErrConcurrentModification", err)
+	}
+}
+
+// Files from before generations were recorded load as generation 0 and
+// take the generation on their next save
+func TestUngeneratedFileGainsGeneration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.bin")
+	legacy := New(path)
+	if err := writeFileAtomic(path, func(w io.Writer) error {
+		return writeTree(w, valuesTree(t, "old"), 0, 0)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	h, err := legacy.Header()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, flag := range h.Flags {
+		if flag == "generation" {
+			t.Fatalf("generation 0 was written: %v", h.Flags)
+		}
+	}
+
+	if _, err := legacy.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if legacy.Generation() != 0 {
+		t.Fatalf("legacy file loaded as generation %d", legacy.Generation())
+	}
+	if err := legacy.Save(valuesTree(t, "old", "new")); err != nil {
+		t.Fatal(err)
+	}
+	if h, err := legacy.Header(); err != nil || h.Generation != 1 {
+		t.Errorf("after saving, header generation %d (%v), want 1", h.Generation, err)
+	}
+}
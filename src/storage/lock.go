@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"errors"
+	"os"
+)
+
+// ErrLocked is returned by TryLock when another process holds the write lock
+var ErrLocked = errors.New("database is locked by another process")
+
+// Lock takes the exclusive write lock, waiting for other writers to finish.
+// The returned function releases it.
+func (fs *FileStorage) Lock() (func() error, error) {
+	return fs.lock(true)
+}
+
+// TryLock is Lock but fails with ErrLocked instead of waiting
+func (fs *FileStorage) TryLock() (func() error, error) {
+	return fs.lock(false)
+}
+
+// lock holds an advisory lock on a sidecar file rather than the database
+// itself, because Save replaces the database file on every write
+func (fs *FileStorage) lock(wait bool) (func() error, error) {
+	f, err := os.OpenFile(fs.path+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := lockFile(f, wait); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return func() error {
+		unlockFile(f)
+		return f.Close()
+	}, nil
+}
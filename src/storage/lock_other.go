@@ -0,0 +1,13 @@
+//go:build !unix
+
+package storage
+
+import "os"
+
+// Advisory locking is only implemented on unix; elsewhere writers are not
+// coordinated across processes.
+func lockFile(f *os.File, wait bool) error {
+	return nil
+}
+
+func unlockFile(f *os.File) {}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"Hippocampus/src/types"
+	"fmt"
+)
+
+// GetNode streams b up to node i and returns it, without loading the tree
+func GetNode(b Backend, i int) (types.Node, error) {
+	if i < 0 {
+		return types.Node{}, fmt.Errorf("node index %d out of range", i)
+	}
+
+	var found *types.Node
+	seen := 0
+	err := b.Scan(func(n *types.Node) bool {
+		if seen == i {
+			node := *n
+			found = &node
+			return false
+		}
+		seen++
+		return true
+	})
+	if err != nil {
+		return types.Node{}, err
+	}
+	if found == nil {
+		return types.Node{}, fmt.Errorf("node index %d out of range: %s has %d nodes", i, b.Path(), seen)
+	}
+	return *found, nil
+}
+
+// CountNodes returns how many nodes b holds, from the file headers when b
+// can read them and by streaming every node otherwise
+func CountNodes(b Backend) (int64, error) {
+	if counter, ok := b.(interface{ NodeCount() (int64, error) }); ok {
+		return counter.NodeCount()
+	}
+	var count int64
+	err := b.Scan(func(*types.Node) bool {
+		count++
+		return true
+	})
+	return count, err
+}
+
+// FindNode streams b for the first node whose metadata key equals value,
+// returning it with its index, or false if there is none
+func FindNode(b Backend, key, value string) (types.IndexedNode, bool, error) {
+	var found types.IndexedNode
+	ok := false
+	index := 0
+	err := b.Scan(func(n *types.Node) bool {
+		if v, has := n.Metadata[key]; has && v == value {
+			found = types.IndexedNode{Index: index, Node: *n}
+			ok = true
+			return false
+		}
+		index++
+		return true
+	})
+	return found, ok, err
+}
+
+// Sample streams b and returns up to n nodes chosen uniformly at random, in
+// database order, along with the number of nodes scanned
+func Sample(b Backend, n int) ([]types.IndexedNode, int, error) {
+	r := types.NewReservoir(n, nil)
+	err := b.Scan(func(node *types.Node) bool {
+		r.Add(node)
+		return true
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return r.Nodes(), r.Seen(), nil
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"Hippocampus/src/types"
+	"sync"
+)
+
+// MemoryStorage keeps the tree in RAM only. Save just records the tree, so
+// flushing costs nothing; ExportTo writes it out in the normal file format.
+type MemoryStorage struct {
+	// ExportPath, if set, is where Close writes the tree
+	ExportPath string
+
+	mu   sync.Mutex
+	tree *types.Tree
+}
+
+func NewMemory() *MemoryStorage {
+	return &MemoryStorage{}
+}
+
+func (ms *MemoryStorage) Path() string {
+	return ":memory:"
+}
+
+func (ms *MemoryStorage) Load() (*types.Tree, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if ms.tree == nil {
+		ms.tree = types.NewTree()
+	}
+	return ms.tree, nil
+}
+
+func (ms *MemoryStorage) Save(t *types.Tree) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.tree = t
+	return nil
+}
+
+func (ms *MemoryStorage) Scan(fn func(n *types.Node) bool) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if ms.tree == nil {
+		return nil
+	}
+	for i := range ms.tree.Nodes {
+		if !fn(&ms.tree.Nodes[i]) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Schema is the last saved tree's metadata schema
+func (ms *MemoryStorage) Schema() (*types.Schema, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if ms.tree == nil {
+		return nil, nil
+	}
+	return ms.tree.Schema, nil
+}
+
+// Lock and TryLock always succeed: nothing outside this process can see the tree
+func (ms *MemoryStorage) Lock() (func() error, error) {
+	return func() error { return nil }, nil
+}
+
+func (ms *MemoryStorage) TryLock() (func() error, error) {
+	return ms.Lock()
+}
+
+// Size is what the tree would take on disk
+func (ms *MemoryStorage) Size() (int64, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if ms.tree == nil {
+		return 0, nil
+	}
+
+	var counter countingWriter
+	if err := writeTree(&counter, ms.tree, 0, 0); err != nil {
+		return 0, err
+	}
+	return counter.n, nil
+}
+
+// ExportTo saves the last saved tree to a database file at path
+func (ms *MemoryStorage) ExportTo(path string) error {
+	tree, err := ms.Load()
+	if err != nil {
+		return err
+	}
+
+	fs := New(path)
+	unlock, err := fs.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return fs.Save(tree)
+}
+
+// Close exports to ExportPath when one is configured
+func (ms *MemoryStorage) Close() error {
+	if ms.ExportPath == "" {
+		return nil
+	}
+	return ms.ExportTo(ms.ExportPath)
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
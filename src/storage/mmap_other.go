@@ -0,0 +1,18 @@
+//go:build !unix
+
+package storage
+
+import (
+	"io"
+	"os"
+)
+
+// Memory mapping is only implemented on unix; elsewhere the file is read
+// into memory instead.
+func mapFile(f *os.File, size int64) ([]byte, func() error, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(f, data); err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
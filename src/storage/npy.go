@@ -0,0 +1,235 @@
+package storage
+
+import (
+	"Hippocampus/src/types"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+// NPY is numpy's array file format: a magic string, a version, a Python
+// dict literal describing dtype and shape padded so the data starts on a
+// 64-byte boundary, then the raw array. np.load reads ExportNpy's output
+// directly.
+var npyMagic = []byte("\x93NUMPY")
+
+// NpyValue is one line of the values file ExportNpy writes next to the
+// matrix; Index is the node's row in the matrix
+type NpyValue struct {
+	Index    int               `json:"index"`
+	Value    string            `json:"value"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Payload  []byte            `json:"payload,omitempty"` // base64
+}
+
+// ExportNpy writes every key as a row of an N×512 little-endian float32 NPY
+// matrix at vecPath, and the node text, metadata and payload as JSON lines
+// at valuesPath, in the same order, after an ExportHeader line
+func ExportNpy(t *types.Tree, vecPath, valuesPath string) error {
+	if err := writeNpyFile(vecPath, t); err != nil {
+		return err
+	}
+
+	f, err := os.Create(valuesPath)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(NewExportHeader(t)); err != nil {
+		f.Close()
+		return err
+	}
+	for i := range t.Nodes {
+		n := &t.Nodes[i]
+		if err := enc.Encode(NpyValue{Index: i, Value: n.Value, Metadata: n.Metadata, Payload: n.Payload}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeNpyFile(path string, t *types.Tree) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	if err := writeNpyHeader(w, len(t.Nodes), len(t.Index)); err != nil {
+		f.Close()
+		return err
+	}
+
+	var buf [4]byte
+	for i := range t.Nodes {
+		for _, v := range t.Nodes[i].Key {
+			binary.LittleEndian.PutUint32(buf[:], math.Float32bits(v))
+			w.Write(buf[:])
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeNpyHeader writes a version 1.0 header for a C-order float32 matrix
+func writeNpyHeader(w io.Writer, rows, cols int) error {
+	dict := fmt.Sprintf("{'descr': '<f4', 'fortran_order': False, 'shape': (%d, %d), }", rows, cols)
+
+	// magic (6) + version (2) + header length (2) + dict + padding + '\n'
+	// must be a multiple of 64
+	pad := 64 - (len(npyMagic)+4+len(dict)+1)%64
+	if pad == 64 {
+		pad = 0
+	}
+	header := dict + string(bytes.Repeat([]byte{' '}, pad)) + "\n"
+
+	var prefix bytes.Buffer
+	prefix.Write(npyMagic)
+	prefix.Write([]byte{1, 0})
+	binary.Write(&prefix, binary.LittleEndian, uint16(len(header)))
+	prefix.WriteString(header)
+
+	_, err := w.Write(prefix.Bytes())
+	return err
+}
+
+// NpyMatrix streams the rows of a 2-D NPY file of little-endian float32 or
+// float64 values in C order, such as np.save of a float32 or float64 array
+type NpyMatrix struct {
+	Rows, Cols int
+
+	f       *os.File
+	r       *bufio.Reader
+	float64 bool
+	row     int
+	buf     []byte
+}
+
+var (
+	npyDescr   = regexp.MustCompile(`'descr':\s*'([^']*)'`)
+	npyFortran = regexp.MustCompile(`'fortran_order':\s*(True|False)`)
+	npyShape   = regexp.MustCompile(`'shape':\s*\((\d+),\s*(\d+),?\s*\)`)
+)
+
+func OpenNpy(path string) (*NpyMatrix, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := readNpyHeader(bufio.NewReader(f))
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	m.f = f
+	return m, nil
+}
+
+func readNpyHeader(r *bufio.Reader) (*NpyMatrix, error) {
+	prefix := make([]byte, len(npyMagic)+2)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, fmt.Errorf("not an NPY file: %w", err)
+	}
+	if !bytes.Equal(prefix[:len(npyMagic)], npyMagic) {
+		return nil, fmt.Errorf("not an NPY file")
+	}
+
+	var headerLen int
+	switch major := prefix[len(npyMagic)]; major {
+	case 1:
+		var n uint16
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return nil, err
+		}
+		headerLen = int(n)
+	case 2, 3:
+		var n uint32
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return nil, err
+		}
+		headerLen = int(n)
+	default:
+		return nil, fmt.Errorf("unsupported NPY version %d", major)
+	}
+
+	header := make([]byte, headerLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("truncated NPY header: %w", err)
+	}
+
+	m := &NpyMatrix{r: r}
+
+	descr := npyDescr.FindSubmatch(header)
+	switch {
+	case descr == nil:
+		return nil, fmt.Errorf("NPY header has no dtype")
+	case string(descr[1]) == "<f4":
+	case string(descr[1]) == "<f8":
+		m.float64 = true
+	default:
+		return nil, fmt.Errorf("unsupported NPY dtype %s, want <f4 or <f8", descr[1])
+	}
+
+	if fortran := npyFortran.FindSubmatch(header); fortran == nil || string(fortran[1]) != "False" {
+		return nil, fmt.Errorf("Fortran-order NPY arrays are not supported; save with np.ascontiguousarray")
+	}
+
+	shape := npyShape.FindSubmatch(header)
+	if shape == nil {
+		return nil, fmt.Errorf("NPY array must be 2-D")
+	}
+	m.Rows, _ = strconv.Atoi(string(shape[1]))
+	m.Cols, _ = strconv.Atoi(string(shape[2]))
+
+	width := 4
+	if m.float64 {
+		width = 8
+	}
+	m.buf = make([]byte, width*m.Cols)
+	return m, nil
+}
+
+// Next returns the next row, or io.EOF after the last one
+func (m *NpyMatrix) Next() ([]float32, error) {
+	if m.row == m.Rows {
+		return nil, io.EOF
+	}
+	if _, err := io.ReadFull(m.r, m.buf); err != nil {
+		return nil, fmt.Errorf("row %d: NPY data is truncated: %w", m.row, err)
+	}
+	m.row++
+
+	vec := make([]float32, m.Cols)
+	for i := range vec {
+		if m.float64 {
+			vec[i] = float32(math.Float64frombits(binary.LittleEndian.Uint64(m.buf[8*i:])))
+		} else {
+			vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(m.buf[4*i:]))
+		}
+	}
+	return vec, nil
+}
+
+func (m *NpyMatrix) Close() error {
+	return m.f.Close()
+}
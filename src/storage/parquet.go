@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"Hippocampus/src/types"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// DefaultParquetRowGroupSize is how many rows ExportParquet puts in each row
+// group. Rows are buffered until a group is full, so this bounds memory.
+const DefaultParquetRowGroupSize = 10000
+
+// parquetRow is the exported schema. id is the node's position in the
+// database; timestamp is the node's types.TimestampKey, null for nodes
+// stored before inserts recorded one.
+type parquetRow struct {
+	ID        int64      `parquet:"id"`
+	Value     string     `parquet:"value"`
+	Timestamp *time.Time `parquet:"timestamp,optional,timestamp(millisecond)"`
+	Metadata  string     `parquet:"metadata"` // JSON object
+	Embedding []float32  `parquet:"embedding,list"`
+}
+
+// ParquetWriter streams nodes into a Parquet file for DuckDB, Spark and
+// pandas, one row group at a time
+type ParquetWriter struct {
+	w            *parquet.GenericWriter[parquetRow]
+	rowGroupSize int
+	rows         []parquetRow // the row group being filled
+	next         int64
+}
+
+// NewParquetWriter writes to w; rowGroupSize <= 0 means
+// DefaultParquetRowGroupSize. Close must be called to write the footer.
+func NewParquetWriter(w io.Writer, rowGroupSize int) *ParquetWriter {
+	if rowGroupSize <= 0 {
+		rowGroupSize = DefaultParquetRowGroupSize
+	}
+	return &ParquetWriter{
+		w:            parquet.NewGenericWriter[parquetRow](w, parquet.Compression(&parquet.Snappy)),
+		rowGroupSize: rowGroupSize,
+		rows:         make([]parquetRow, 0, min(rowGroupSize, 1024)),
+	}
+}
+
+// Write appends n as the next row
+func (pw *ParquetWriter) Write(n *types.Node) error {
+	metadata := "{}"
+	if len(n.Metadata) > 0 {
+		encoded, err := json.Marshal(n.Metadata)
+		if err != nil {
+			return err
+		}
+		metadata = string(encoded)
+	}
+
+	var timestamp *time.Time
+	if ts, err := time.Parse(time.RFC3339Nano, n.Metadata[types.TimestampKey]); err == nil {
+		timestamp = &ts
+	}
+
+	pw.rows = append(pw.rows, parquetRow{
+		ID:        pw.next,
+		Value:     n.Value,
+		Timestamp: timestamp,
+		Metadata:  metadata,
+		Embedding: append([]float32(nil), n.Key[:]...),
+	})
+	pw.next++
+
+	if len(pw.rows) == pw.rowGroupSize {
+		return pw.flushRowGroup()
+	}
+	return nil
+}
+
+func (pw *ParquetWriter) flushRowGroup() error {
+	if len(pw.rows) == 0 {
+		return nil
+	}
+	if _, err := pw.w.Write(pw.rows); err != nil {
+		return err
+	}
+	clear(pw.rows)
+	pw.rows = pw.rows[:0]
+	return pw.w.Flush()
+}
+
+// Close writes the last row group and the file footer. It does not close
+// the underlying writer.
+func (pw *ParquetWriter) Close() error {
+	if err := pw.flushRowGroup(); err != nil {
+		return err
+	}
+	return pw.w.Close()
+}
+
+// ExportParquet writes the tree's nodes to a Parquet file at path with
+// columns id, value, timestamp, metadata (a JSON string) and embedding
+// (list<float>)
+func ExportParquet(t *types.Tree, path string) error {
+	return writeFileAtomic(path, func(w io.Writer) error {
+		pw := NewParquetWriter(w, DefaultParquetRowGroupSize)
+		for i := range t.Nodes {
+			if err := pw.Write(&t.Nodes[i]); err != nil {
+				return err
+			}
+		}
+		return pw.Close()
+	})
+}
+
+// ExportParquetFrom streams a database into a Parquet file without loading
+// it, rowGroupSize rows at a time
+func ExportParquetFrom(b Backend, path string, rowGroupSize int) (int64, error) {
+	var rows int64
+	err := writeFileAtomic(path, func(w io.Writer) error {
+		pw := NewParquetWriter(w, rowGroupSize)
+		var writeErr error
+		err := b.Scan(func(n *types.Node) bool {
+			writeErr = pw.Write(n)
+			return writeErr == nil
+		})
+		if err != nil {
+			return err
+		}
+		if writeErr != nil {
+			return writeErr
+		}
+		rows = pw.next
+		return pw.Close()
+	})
+	return rows, err
+}
+
+// writeFileAtomic writes path through a temp file beside it, like Save
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	defer os.Remove(tmpPath)
+
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"Hippocampus/src/types"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetTree holds n nodes with random keys, every other one timestamped
+// a day apart
+func parquetTree(t *testing.T, n int) *types.Tree {
+	t.Helper()
+	rng := rand.New(rand.NewPCG(uint64(n), 1))
+	tree := types.NewTree()
+	start := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		var key [512]float32
+		for d := range key {
+			key[d] = rng.Float32()*2 - 1
+		}
+		metadata := map[string]string{"source": fmt.Sprintf("doc-%d", i/3)}
+		if i%2 == 0 {
+			metadata = types.WithTimestamp(metadata, start.Add(time.Duration(i)*24*time.Hour))
+		}
+		if err := tree.InsertWithMetadata(key, fmt.Sprintf("memory %d: %s", i, unicodeText), metadata); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tree
+}
+
+// readParquet reads an export back with the library that wrote it
+func readParquet(t *testing.T, data []byte) (*parquet.File, []parquetRow) {
+	t.Helper()
+	file, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := parquet.Read[parquetRow](bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file, rows
+}
+
+func checkParquetRows(t *testing.T, tree *types.Tree, rows []parquetRow) {
+	t.Helper()
+	if len(rows) != len(tree.Nodes) {
+		t.Fatalf("%d rows for %d nodes", len(rows), len(tree.Nodes))
+	}
+	for i, row := range rows {
+		n := &tree.Nodes[i]
+		if row.ID != int64(i) || row.Value != n.Value || !slices.Equal(row.Embedding, n.Key[:]) {
+			t.Fatalf("row %d: id %d, value %q, or embedding differ from the node", i, row.ID, row.Value)
+		}
+		var metadata map[string]string
+		if err := json.Unmarshal([]byte(row.Metadata), &metadata); err != nil || metadata["source"] != n.Metadata["source"] {
+			t.Errorf("row %d: metadata %s (%v)", i, row.Metadata, err)
+		}
+
+		want, stamped := n.Metadata[types.TimestampKey]
+		switch {
+		case !stamped && row.Timestamp != nil:
+			t.Errorf("row %d: timestamp %v for a node without one", i, row.Timestamp)
+		case stamped && (row.Timestamp == nil || row.Timestamp.UTC().Format(time.RFC3339Nano) != want):
+			t.Errorf("row %d: timestamp %v, want %s", i, row.Timestamp, want)
+		}
+	}
+}
+
+func TestParquetWriterRowGroups(t *testing.T) {
+	tree := parquetTree(t, 25)
+
+	var buf bytes.Buffer
+	pw := NewParquetWriter(&buf, 10)
+	for i := range tree.Nodes {
+		if err := pw.Write(&tree.Nodes[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Full row groups go out as they fill, through a buffer far smaller
+	// than the file, not at Close
+	if buf.Len() == 0 {
+		t.Fatal("nothing written before Close")
+	}
+	if err := pw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, rows := readParquet(t, buf.Bytes())
+	var sizes []int64
+	for _, rg := range file.RowGroups() {
+		sizes = append(sizes, rg.NumRows())
+	}
+	if !slices.Equal(sizes, []int64{10, 10, 5}) {
+		t.Errorf("row groups of %v rows, want 10, 10 and 5", sizes)
+	}
+	var columns []string
+	for _, field := range file.Schema().Fields() {
+		columns = append(columns, field.Name())
+	}
+	if want := []string{"id", "value", "timestamp", "metadata", "embedding"}; !slices.Equal(columns, want) {
+		t.Errorf("columns %v, want %v", columns, want)
+	}
+	if embedding, _ := file.Schema().Lookup("embedding", "list", "element"); embedding.Node == nil || embedding.Node.Type().Kind() != parquet.Float {
+		t.Error("embedding is not a list of floats")
+	}
+	checkParquetRows(t, tree, rows)
+}
+
+func TestExportParquet(t *testing.T) {
+	dir := t.TempDir()
+	tree := parquetTree(t, 12)
+
+	path := filepath.Join(dir, "loaded.parquet")
+	if err := ExportParquet(tree, path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, rows := readParquet(t, data)
+	checkParquetRows(t, tree, rows)
+
+	// Streaming from a saved database writes the same rows
+	db := New(filepath.Join(dir, "tree.bin"))
+	if err := db.Save(tree); err != nil {
+		t.Fatal(err)
+	}
+	streamed := filepath.Join(dir, "streamed.parquet")
+	n, err := ExportParquetFrom(db, streamed, 5)
+	if err != nil || n != 12 {
+		t.Fatalf("streamed %d rows, error %v", n, err)
+	}
+	data, err = os.ReadFile(streamed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, rows := readParquet(t, data)
+	if len(file.RowGroups()) != 3 {
+		t.Errorf("%d row groups of at most 5 rows, want 3", len(file.RowGroups()))
+	}
+	checkParquetRows(t, tree, rows)
+}
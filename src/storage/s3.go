@@ -0,0 +1,253 @@
+package storage
+
+import (
+	"Hippocampus/src/types"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrObjectNotFound is returned by an S3API for a key with no object
+	ErrObjectNotFound = errors.New("s3 object not found")
+
+	// ErrNotModified is returned by S3API.Download when the object still
+	// has the ETag the caller already holds
+	ErrNotModified = errors.New("s3 object not modified")
+)
+
+// S3API is the part of S3 the storage layer uses, so tests can swap in a
+// fake instead of talking to AWS
+type S3API interface {
+	// Download writes the object to w and returns its ETag. With
+	// ifNoneMatch set to the object's current ETag it returns
+	// ErrNotModified instead, writing nothing.
+	Download(ctx context.Context, bucket, key, ifNoneMatch string, w io.WriterAt) (etag string, err error)
+
+	// PutObject uploads body and returns the stored object's ETag
+	PutObject(ctx context.Context, bucket, key string, body io.Reader) (etag string, err error)
+
+	// HeadObject returns the object's size without downloading it
+	HeadObject(ctx context.Context, bucket, key string) (size int64, err error)
+
+	DeleteObject(ctx context.Context, bucket, key string) error
+
+	// ListObjects calls fn with every key under prefix and its size
+	ListObjects(ctx context.Context, bucket, prefix string, fn func(key string, size int64)) error
+}
+
+// ParseS3URL splits s3://bucket/key; ok is false for anything else
+func ParseS3URL(url string) (bucket, key string, ok bool) {
+	rest, ok := strings.CutPrefix(url, "s3://")
+	if !ok {
+		return "", "", false
+	}
+	bucket, key, _ = strings.Cut(rest, "/")
+	return bucket, key, bucket != "" && key != ""
+}
+
+// DefaultS3CacheDir is where S3 backends keep their local copies unless told
+// otherwise: the user cache directory, or the temp directory without one
+func DefaultS3CacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "hippocampus", "s3")
+}
+
+// S3Backend keeps a database in an S3 object, working on a local copy.
+// Loading fetches the object only when its ETag has changed since the copy
+// was downloaded (a conditional GET), so reopening an unchanged database
+// costs one request. Save writes the copy as a FileStorage would, then
+// uploads it. Lock guards the local copy only: S3 has no locks, so two
+// machines writing one object overwrite each other.
+type S3Backend struct {
+	Bucket string
+	Key    string
+
+	api     S3API
+	apiErr  error // why api couldn't be created, returned by every call
+	local   *FileStorage
+	refresh sync.Once // the local copy is checked against S3 once per backend
+	err     error     // refresh's result
+}
+
+// NewS3Backend stores the database at s3://bucket/key, cached under
+// cacheDir (DefaultS3CacheDir if empty) at <bucket>/<key>. An empty region
+// comes from the AWS environment, falling back to us-east-1.
+func NewS3Backend(bucket, key, region, cacheDir string) *S3Backend {
+	if cacheDir == "" {
+		cacheDir = DefaultS3CacheDir()
+	}
+	// Cleaning from the root keeps a key with ".." inside the cache
+	localPath := filepath.Join(cacheDir, bucket, filepath.FromSlash(path.Clean("/"+key)))
+
+	api, err := NewS3Client(region)
+	b := NewS3BackendAt(api, bucket, key, localPath)
+	b.apiErr = err
+	return b
+}
+
+// NewS3BackendAt is an S3Backend talking to api whose local copy is
+// localPath
+func NewS3BackendAt(api S3API, bucket, key, localPath string) *S3Backend {
+	return &S3Backend{Bucket: bucket, Key: key, api: api, local: New(localPath)}
+}
+
+func (b *S3Backend) Path() string {
+	return "s3://" + b.Bucket + "/" + b.Key
+}
+
+// LocalPath is where the local copy of the object lives
+func (b *S3Backend) LocalPath() string {
+	return b.local.Path()
+}
+
+// etagPath records the ETag of the object the local copy was downloaded
+// from or uploaded as
+func (b *S3Backend) etagPath() string {
+	return b.local.Path() + ".etag"
+}
+
+// Download brings the local copy up to date with S3, returning false if
+// there is no object. An object whose ETag matches the copy's is not
+// fetched again.
+func (b *S3Backend) Download(ctx context.Context) (bool, error) {
+	if b.apiErr != nil {
+		return false, b.apiErr
+	}
+
+	etag := ""
+	if data, err := os.ReadFile(b.etagPath()); err == nil {
+		if _, err := os.Stat(b.local.Path()); err == nil {
+			etag = string(data)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(b.local.Path()), 0755); err != nil {
+		return false, err
+	}
+
+	// writeFileAtomic hands over the temp file, which the transfer manager
+	// writes parts of at their offsets
+	var newETag string
+	err := writeFileAtomic(b.local.Path(), func(w io.Writer) error {
+		var err error
+		newETag, err = b.api.Download(ctx, b.Bucket, b.Key, etag, w.(io.WriterAt))
+		return err
+	})
+	switch {
+	case errors.Is(err, ErrNotModified):
+		return true, nil
+	case errors.Is(err, ErrObjectNotFound):
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("failed to download %s: %w", b.Path(), err)
+	}
+
+	if err := b.writeETag(newETag); err != nil {
+		return false, fmt.Errorf("failed to cache %s: %w", b.Path(), err)
+	}
+	return true, nil
+}
+
+// Upload copies the local copy to S3
+func (b *S3Backend) Upload(ctx context.Context) error {
+	if b.apiErr != nil {
+		return b.apiErr
+	}
+
+	f, err := os.Open(b.local.Path())
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	etag, err := b.api.PutObject(ctx, b.Bucket, b.Key, f)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", b.Path(), err)
+	}
+	return b.writeETag(etag)
+}
+
+func (b *S3Backend) writeETag(etag string) error {
+	return writeFileAtomic(b.etagPath(), func(w io.Writer) error {
+		_, err := io.WriteString(w, etag)
+		return err
+	})
+}
+
+// sync downloads the object the first time the backend is read. Without
+// an object the local copy is removed too, so the database starts empty
+// rather than from a stale cache.
+func (b *S3Backend) sync() error {
+	b.refresh.Do(func() {
+		var found bool
+		found, b.err = b.Download(context.Background())
+		if b.err == nil && !found {
+			os.Remove(b.local.Path())
+			os.Remove(b.etagPath())
+		}
+	})
+	return b.err
+}
+
+func (b *S3Backend) Load() (*types.Tree, error) {
+	if err := b.sync(); err != nil {
+		return nil, err
+	}
+	return b.local.Load()
+}
+
+// Save writes the local copy, then uploads it
+func (b *S3Backend) Save(t *types.Tree) error {
+	if err := os.MkdirAll(filepath.Dir(b.local.Path()), 0755); err != nil {
+		return err
+	}
+	if err := b.local.Save(t); err != nil {
+		return err
+	}
+	return b.Upload(context.Background())
+}
+
+func (b *S3Backend) Scan(fn func(n *types.Node) bool) error {
+	if err := b.sync(); err != nil {
+		return err
+	}
+	return b.local.Scan(fn)
+}
+
+func (b *S3Backend) Schema() (*types.Schema, error) {
+	if err := b.sync(); err != nil {
+		return nil, err
+	}
+	return b.local.Schema()
+}
+
+func (b *S3Backend) Size() (int64, error) {
+	if err := b.sync(); err != nil {
+		return 0, err
+	}
+	return b.local.Size()
+}
+
+func (b *S3Backend) Lock() (func() error, error) {
+	if err := os.MkdirAll(filepath.Dir(b.local.Path()), 0755); err != nil {
+		return nil, err
+	}
+	return b.local.Lock()
+}
+
+func (b *S3Backend) TryLock() (func() error, error) {
+	if err := os.MkdirAll(filepath.Dir(b.local.Path()), 0755); err != nil {
+		return nil, err
+	}
+	return b.local.TryLock()
+}
@@ -0,0 +1,266 @@
+package storage
+
+import (
+	"Hippocampus/src/types"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// fakeS3 is an in-memory S3API. Versions count uploads and become ETags;
+// fetches counts downloads that transferred an object.
+type fakeS3 struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	etags    map[string]string
+	versions int
+	fetches  int
+	failNext error // returned by the next Download, after writing half the object
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: make(map[string][]byte), etags: make(map[string]string)}
+}
+
+func (f *fakeS3) Download(ctx context.Context, bucket, key, ifNoneMatch string, w io.WriterAt) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.objects[bucket+"/"+key]
+	if !ok {
+		return "", ErrObjectNotFound
+	}
+	etag := f.etags[bucket+"/"+key]
+	if ifNoneMatch == etag {
+		return "", ErrNotModified
+	}
+	if err := f.failNext; err != nil {
+		f.failNext = nil
+		w.WriteAt(data[:len(data)/2], 0)
+		return "", err
+	}
+	f.fetches++
+	if _, err := w.WriteAt(data, 0); err != nil {
+		return "", err
+	}
+	return etag, nil
+}
+
+func (f *fakeS3) PutObject(ctx context.Context, bucket, key string, body io.Reader) (string, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.versions++
+	etag := fmt.Sprintf(`"v%d"`, f.versions)
+	f.objects[bucket+"/"+key] = data
+	f.etags[bucket+"/"+key] = etag
+	return etag, nil
+}
+
+func (f *fakeS3) HeadObject(ctx context.Context, bucket, key string) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.objects[bucket+"/"+key]
+	if !ok {
+		return 0, ErrObjectNotFound
+	}
+	return int64(len(data)), nil
+}
+
+func (f *fakeS3) DeleteObject(ctx context.Context, bucket, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.objects, bucket+"/"+key)
+	delete(f.etags, bucket+"/"+key)
+	return nil
+}
+
+func (f *fakeS3) ListObjects(ctx context.Context, bucket, prefix string, fn func(key string, size int64)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for full, data := range f.objects {
+		if key, ok := strings.CutPrefix(full, bucket+"/"); ok && strings.HasPrefix(key, prefix) {
+			fn(key, int64(len(data)))
+		}
+	}
+	return nil
+}
+
+// s3Values loads b and returns its node values in order
+func s3Values(t *testing.T, b *S3Backend) []string {
+	t.Helper()
+	tree, err := b.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make([]string, len(tree.Nodes))
+	for i := range tree.Nodes {
+		values[i] = tree.Nodes[i].Value
+	}
+	return values
+}
+
+// valuesTree is a tree holding values, one node each
+func valuesTree(t *testing.T, values ...string) *types.Tree {
+	t.Helper()
+	tree := types.NewTree()
+	for i, v := range values {
+		var key [512]float32
+		key[i%512] = 1
+		if err := tree.Insert(key, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tree
+}
+
+func TestS3BackendSaveAndLoad(t *testing.T) {
+	api := newFakeS3()
+	writerCache, readerCache := t.TempDir(), t.TempDir()
+	at := func(dir string) *S3Backend {
+		return NewS3BackendAt(api, "bucket", "agents/foo.bin", filepath.Join(dir, "foo.bin"))
+	}
+
+	writer := at(writerCache)
+	if got := s3Values(t, writer); len(got) != 0 {
+		t.Fatalf("missing object loaded %v, want an empty tree", got)
+	}
+	if err := writer.Save(valuesTree(t, "one", "two")); err != nil {
+		t.Fatal(err)
+	}
+	if writer.Path() != "s3://bucket/agents/foo.bin" || api.versions != 1 {
+		t.Fatalf("saved to %s as %d versions", writer.Path(), api.versions)
+	}
+
+	// Another machine downloads it, then reopening fetches nothing new
+	if got := s3Values(t, at(readerCache)); strings.Join(got, ",") != "one,two" {
+		t.Fatalf("downloaded %v", got)
+	}
+	if got := s3Values(t, at(readerCache)); strings.Join(got, ",") != "one,two" || api.fetches != 1 {
+		t.Fatalf("reopened as %v after %d fetches, want the cached copy and one fetch", got, api.fetches)
+	}
+
+	// A new version is fetched, once
+	if err := writer.Save(valuesTree(t, "one", "two", "three")); err != nil {
+		t.Fatal(err)
+	}
+	if got := s3Values(t, at(readerCache)); len(got) != 3 || api.fetches != 2 {
+		t.Fatalf("after an update loaded %v after %d fetches", got, api.fetches)
+	}
+	// The writer's own upload is already its cached copy
+	if got := s3Values(t, at(writerCache)); len(got) != 3 || api.fetches != 2 {
+		t.Errorf("writer reloaded %v after %d fetches, want no fetch", got, api.fetches)
+	}
+
+	// Once the object is gone the stale cache is not used
+	if err := api.DeleteObject(context.Background(), "bucket", "agents/foo.bin"); err != nil {
+		t.Fatal(err)
+	}
+	reader := at(readerCache)
+	if got := s3Values(t, reader); len(got) != 0 {
+		t.Errorf("deleted object loaded %v", got)
+	}
+	if _, err := os.Stat(reader.LocalPath()); !os.IsNotExist(err) {
+		t.Errorf("stale local copy kept: %v", err)
+	}
+}
+
+// A download that fails part way leaves the previous copy whole
+func TestS3BackendFailedDownloadKeepsCopy(t *testing.T) {
+	api := newFakeS3()
+	cache := t.TempDir()
+	at := func() *S3Backend {
+		return NewS3BackendAt(api, "bucket", "db.bin", filepath.Join(cache, "db.bin"))
+	}
+
+	if err := NewS3BackendAt(api, "bucket", "db.bin", filepath.Join(t.TempDir(), "db.bin")).Save(valuesTree(t, "old")); err != nil {
+		t.Fatal(err)
+	}
+	if got := s3Values(t, at()); len(got) != 1 {
+		t.Fatalf("loaded %v", got)
+	}
+	before, err := os.ReadFile(filepath.Join(cache, "db.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := api.PutObject(context.Background(), "bucket", "db.bin", bytes.NewReader(bytes.Repeat([]byte{1}, 4096))); err != nil {
+		t.Fatal(err)
+	}
+	api.failNext = errors.New("connection reset")
+	if _, err := at().Load(); err == nil || !strings.Contains(err.Error(), "connection reset") {
+		t.Fatalf("failed download: %v", err)
+	}
+	after, err := os.ReadFile(filepath.Join(cache, "db.bin"))
+	if err != nil || !bytes.Equal(before, after) {
+		t.Errorf("local copy changed by a failed download (%v)", err)
+	}
+	entries, _ := os.ReadDir(cache)
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), ".tmp-") {
+			t.Errorf("temp file %s left behind", entry.Name())
+		}
+	}
+}
+
+func TestParseS3URL(t *testing.T) {
+	cases := []struct {
+		url, bucket, key string
+		ok               bool
+	}{
+		{"s3://bucket/agents/foo.bin", "bucket", "agents/foo.bin", true},
+		{"s3://bucket/foo.bin", "bucket", "foo.bin", true},
+		{"s3://bucket", "", "", false},
+		{"s3://bucket/", "", "", false},
+		{"s3:///foo.bin", "", "", false},
+		{"tree.bin", "", "", false},
+		{"/data/s3://bucket/key", "", "", false},
+	}
+	for _, tc := range cases {
+		bucket, key, ok := ParseS3URL(tc.url)
+		if ok != tc.ok || (ok && (bucket != tc.bucket || key != tc.key)) {
+			t.Errorf("ParseS3URL(%q) = %q, %q, %v", tc.url, bucket, key, ok)
+		}
+	}
+}
+
+func TestS3BackendCachePathStaysInCacheDir(t *testing.T) {
+	cache := t.TempDir()
+	for _, key := range []string{"agents/foo.bin", "../../etc/passwd", "a/../../b.bin"} {
+		b := NewS3Backend("bucket", key, "us-east-1", cache)
+		rel, err := filepath.Rel(cache, b.LocalPath())
+		if err != nil || strings.HasPrefix(rel, "..") {
+			t.Errorf("key %q cached at %s, outside %s", key, b.LocalPath(), cache)
+		}
+	}
+}
+
+func TestS3ErrorMapsStatuses(t *testing.T) {
+	status := func(code int) error {
+		return &smithyhttp.ResponseError{Response: &smithyhttp.Response{Response: &http.Response{StatusCode: code}}, Err: errors.New("api error")}
+	}
+	if err := s3Error(status(http.StatusNotModified)); !errors.Is(err, ErrNotModified) {
+		t.Errorf("304 mapped to %v", err)
+	}
+	if err := s3Error(status(http.StatusNotFound)); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("404 mapped to %v", err)
+	}
+	if err := s3Error(status(http.StatusForbidden)); errors.Is(err, ErrObjectNotFound) || err == nil {
+		t.Errorf("403 mapped to %v", err)
+	}
+	if s3Error(nil) != nil {
+		t.Error("nil error mapped to an error")
+	}
+}
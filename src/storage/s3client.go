@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// Uploader is the part of manager.Uploader s3Client uses
+type Uploader interface {
+	Upload(ctx context.Context, input *s3.PutObjectInput, opts ...func(*manager.Uploader)) (*manager.UploadOutput, error)
+}
+
+// Downloader is the part of manager.Downloader s3Client uses
+type Downloader interface {
+	Download(ctx context.Context, w io.WriterAt, input *s3.GetObjectInput, opts ...func(*manager.Downloader)) (int64, error)
+}
+
+// ObjectAPI is the part of s3.Client s3Client uses besides transfers
+type ObjectAPI interface {
+	HeadObject(ctx context.Context, input *s3.HeadObjectInput, opts ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	DeleteObject(ctx context.Context, input *s3.DeleteObjectInput, opts ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	ListObjectsV2(ctx context.Context, input *s3.ListObjectsV2Input, opts ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+}
+
+// s3Client is S3API on the AWS SDK, moving objects with its transfer
+// managers so large databases go up and down in parallel parts
+type s3Client struct {
+	objects    ObjectAPI
+	uploader   Uploader
+	downloader Downloader
+}
+
+// NewS3Client talks to S3 in region; an empty region comes from the AWS
+// environment, falling back to us-east-1
+func NewS3Client(region string) (S3API, error) {
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("aws config error: %w", err)
+	}
+	return NewS3ClientFromConfig(cfg), nil
+}
+
+// NewS3ClientFromConfig talks to S3 with an already loaded AWS config, so a
+// process with several AWS clients loads it once
+func NewS3ClientFromConfig(cfg aws.Config) S3API {
+	client := s3.NewFromConfig(cfg)
+	return NewS3ClientWith(client, manager.NewUploader(client), manager.NewDownloader(client))
+}
+
+// NewS3ClientWith is S3API over the given object calls and transfer
+// managers, such as fakes in tests
+func NewS3ClientWith(objects ObjectAPI, uploader Uploader, downloader Downloader) S3API {
+	return &s3Client{objects: objects, uploader: uploader, downloader: downloader}
+}
+
+// Download asks for the object's ETag first, conditionally, so an unchanged
+// object costs a HEAD. The parts are then fetched pinned to that ETag, which
+// fails rather than mixing two versions if the object changes meanwhile.
+func (c *s3Client) Download(ctx context.Context, bucket, key, ifNoneMatch string, w io.WriterAt) (string, error) {
+	head := &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	if ifNoneMatch != "" {
+		head.IfNoneMatch = aws.String(ifNoneMatch)
+	}
+
+	out, err := c.objects.HeadObject(ctx, head)
+	if err != nil {
+		return "", s3Error(err)
+	}
+	etag := aws.ToString(out.ETag)
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	if etag != "" {
+		input.IfMatch = aws.String(etag)
+	}
+	if _, err := c.downloader.Download(ctx, w, input); err != nil {
+		return "", s3Error(err)
+	}
+	return etag, nil
+}
+
+func (c *s3Client) PutObject(ctx context.Context, bucket, key string, body io.Reader) (string, error) {
+	out, err := c.uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   body,
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(out.ETag), nil
+}
+
+func (c *s3Client) HeadObject(ctx context.Context, bucket, key string) (int64, error) {
+	out, err := c.objects.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return 0, s3Error(err)
+	}
+	return aws.ToInt64(out.ContentLength), nil
+}
+
+func (c *s3Client) DeleteObject(ctx context.Context, bucket, key string) error {
+	_, err := c.objects.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	return s3Error(err)
+}
+
+func (c *s3Client) ListObjects(ctx context.Context, bucket, prefix string, fn func(key string, size int64)) error {
+	pages := s3.NewListObjectsV2Paginator(c.objects, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return s3Error(err)
+		}
+		for _, obj := range page.Contents {
+			fn(aws.ToString(obj.Key), aws.ToInt64(obj.Size))
+		}
+	}
+	return nil
+}
+
+// s3Error maps the SDK's not-found and not-modified responses onto
+// ErrObjectNotFound and ErrNotModified
+func s3Error(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var respErr *smithyhttp.ResponseError
+	if errors.As(err, &respErr) {
+		switch respErr.HTTPStatusCode() {
+		case http.StatusNotModified:
+			return ErrNotModified
+		case http.StatusNotFound:
+			return ErrObjectNotFound
+		}
+	}
+	var noSuchKey *s3types.NoSuchKey
+	var notFound *s3types.NotFound
+	if errors.As(err, &noSuchKey) || errors.As(err, &notFound) {
+		return ErrObjectNotFound
+	}
+	return err
+}
@@ -0,0 +1,411 @@
+package storage
+
+import (
+	"Hippocampus/src/types"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultVerifySample is how many nodes' vectors Verify and ShadowStorage
+// compare when no sample size is given
+const DefaultVerifySample = 1000
+
+// maxDivergenceExamples bounds the divergences a ConsistencyReport lists;
+// the counts cover all of them
+const maxDivergenceExamples = 20
+
+// VerifyOptions tune a consistency check between two copies of a database
+type VerifyOptions struct {
+	// Sample is how many nodes, chosen at random, have their vectors
+	// compared; 0 means DefaultVerifySample and negative compares every one.
+	// Values, metadata and payloads are always compared for every node.
+	Sample int
+
+	// Tolerance is the largest difference between matching vector
+	// components still counted as equal, so a quantized copy can be checked
+	// against the original. 0 requires identical vectors.
+	Tolerance float32
+}
+
+// ConsistencyReport is how copy B of a database compares with A, node by
+// node in storage order
+type ConsistencyReport struct {
+	A              string         `json:"a"`
+	B              string         `json:"b"`
+	NodesA         int            `json:"nodes_a"`
+	NodesB         int            `json:"nodes_b"`
+	Compared       int            `json:"compared"`         // nodes at positions present in both
+	Sampled        int            `json:"sampled"`          // of those, nodes whose vectors were compared
+	MaxVectorError float32        `json:"max_vector_error"` // largest component difference seen in sampled vectors
+	Divergent      map[string]int `json:"divergent"`        // divergences by kind: nodes, normalize, value, metadata, payload, vector
+	Examples       []Divergence   `json:"examples"`         // the first few divergences
+}
+
+// Divergence is one difference between the copies. Index is the node's
+// position, or -1 for the database as a whole.
+type Divergence struct {
+	Index  int    `json:"index"`
+	Kind   string `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Consistent reports whether no divergence was found
+func (r *ConsistencyReport) Consistent() bool {
+	return len(r.Divergent) == 0
+}
+
+// Summary is a one-line description of the divergences, for logs
+func (r *ConsistencyReport) Summary() string {
+	if r.Consistent() {
+		return fmt.Sprintf("%d nodes consistent", r.Compared)
+	}
+	kinds := make([]string, 0, len(r.Divergent))
+	for kind, n := range r.Divergent {
+		kinds = append(kinds, fmt.Sprintf("%s %d", kind, n))
+	}
+	sort.Strings(kinds)
+	return fmt.Sprintf("%d vs %d nodes, divergent: %s (max vector error %g)",
+		r.NodesA, r.NodesB, strings.Join(kinds, ", "), r.MaxVectorError)
+}
+
+func (r *ConsistencyReport) diverge(index int, kind, detail string) {
+	r.Divergent[kind]++
+	if len(r.Examples) < maxDivergenceExamples {
+		r.Examples = append(r.Examples, Divergence{Index: index, Kind: kind, Detail: detail})
+	}
+}
+
+// Verify compares two copies of a database, such as a plain file and a
+// compressed or sharded copy of it, streaming both. Nodes are paired by
+// position, since any backend keeps insertion order. Only digests of A's
+// nodes and the vectors of the sample are held in memory.
+func Verify(a, b Backend, opts VerifyOptions) (ConsistencyReport, error) {
+	return verifyScans(a.Path(), b.Path(), a.Scan, b.Scan, opts)
+}
+
+// CompareTrees is Verify for two trees already in memory
+func CompareTrees(aName string, a *types.Tree, bName string, b *types.Tree, opts VerifyOptions) ConsistencyReport {
+	report, _ := verifyScans(aName, bName, scanNodes(a.Nodes), scanNodes(b.Nodes), opts)
+	if a.Normalize != b.Normalize {
+		report.diverge(-1, "normalize", fmt.Sprintf("%t vs %t", a.Normalize, b.Normalize))
+	}
+	return report
+}
+
+func scanNodes(nodes []types.Node) func(fn func(n *types.Node) bool) error {
+	return func(fn func(n *types.Node) bool) error {
+		for i := range nodes {
+			if !fn(&nodes[i]) {
+				break
+			}
+		}
+		return nil
+	}
+}
+
+func verifyScans(aName, bName string, scanA, scanB func(fn func(n *types.Node) bool) error, opts VerifyOptions) (ConsistencyReport, error) {
+	report := ConsistencyReport{A: aName, B: bName, Divergent: map[string]int{}, Examples: []Divergence{}}
+
+	sampleSize := opts.Sample
+	if sampleSize == 0 {
+		sampleSize = DefaultVerifySample
+	}
+
+	var digests []nodeDigest
+	var reservoir *types.Reservoir
+	sampled := make(map[int]*types.Node)
+	if sampleSize > 0 {
+		reservoir = types.NewReservoir(sampleSize, nil)
+	}
+	err := scanA(func(n *types.Node) bool {
+		digests = append(digests, digestNode(n))
+		if reservoir != nil {
+			reservoir.Add(n)
+		} else {
+			node := *n
+			sampled[len(digests)-1] = &node
+		}
+		return true
+	})
+	if err != nil {
+		return report, fmt.Errorf("%s: %w", aName, err)
+	}
+	report.NodesA = len(digests)
+	if reservoir != nil {
+		for _, in := range reservoir.Nodes() {
+			sampled[in.Index] = &in.Node
+		}
+	}
+
+	err = scanB(func(n *types.Node) bool {
+		index := report.NodesB
+		report.NodesB++
+		if index >= len(digests) {
+			return true
+		}
+		report.Compared++
+
+		want, got := digests[index], digestNode(n)
+		if want.value != got.value {
+			report.diverge(index, "value", shorten(n.Value))
+		}
+		if want.metadata != got.metadata {
+			report.diverge(index, "metadata", "")
+		}
+		if want.payload != got.payload {
+			report.diverge(index, "payload", "")
+		}
+
+		if node, ok := sampled[index]; ok {
+			report.Sampled++
+			if detail, ok := report.compareVectors(node, n, opts.Tolerance); !ok {
+				report.diverge(index, "vector", detail)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return report, fmt.Errorf("%s: %w", bName, err)
+	}
+
+	if report.NodesA != report.NodesB {
+		report.diverge(-1, "nodes", fmt.Sprintf("%d vs %d", report.NodesA, report.NodesB))
+	}
+	return report, nil
+}
+
+// compareVectors checks b's key and alternate keys are within tolerance of
+// a's, recording the largest difference seen
+func (r *ConsistencyReport) compareVectors(a, b *types.Node, tolerance float32) (string, bool) {
+	if len(a.AltKeys) != len(b.AltKeys) {
+		return fmt.Sprintf("%d vs %d alternate keys", len(a.AltKeys), len(b.AltKeys)), false
+	}
+
+	worst := vectorError(&a.Key, &b.Key)
+	for i := range a.AltKeys {
+		worst = max(worst, vectorError(&a.AltKeys[i], &b.AltKeys[i]))
+	}
+	r.MaxVectorError = max(r.MaxVectorError, worst)
+	if worst > tolerance || math.IsNaN(float64(worst)) {
+		return fmt.Sprintf("component differs by %g", worst), false
+	}
+	return "", true
+}
+
+// vectorError is the largest difference between matching components
+func vectorError(a, b *[512]float32) float32 {
+	var worst float32
+	for dim := range a {
+		diff := a[dim] - b[dim]
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff > worst || diff != diff {
+			worst = diff
+		}
+	}
+	return worst
+}
+
+// shorten cuts a node value to fit in a divergence detail
+func shorten(value string) string {
+	const limit = 60
+	if runes := []rune(value); len(runes) > limit {
+		return string(runes[:limit]) + "..."
+	}
+	return value
+}
+
+// ShadowObserver receives the outcome of every shadow comparison: the
+// divergences found by kind, empty when the copies agree. Kind "error"
+// counts a failed secondary load or save. *metrics.Prometheus is one.
+type ShadowObserver interface {
+	ObserveShadowCheck(divergent map[string]int)
+}
+
+// ShadowStorage serves everything from a primary backend while mirroring
+// loads and saves to a secondary one in the background and comparing the
+// two, for gaining confidence in a new storage format before switching to
+// it. Divergences are logged and passed to Observer; the caller never sees
+// them or waits for the secondary.
+type ShadowStorage struct {
+	primary, secondary Backend
+
+	// Sample and Tolerance tune each comparison, see VerifyOptions
+	Sample    int
+	Tolerance float32
+
+	// Logger reports divergences and secondary failures; nil is log.Default
+	Logger *log.Logger
+
+	// Observer, if set, is told the outcome of every comparison
+	Observer ShadowObserver
+
+	mu      sync.Mutex
+	running bool
+	pending *shadowJob
+	done    *sync.Cond
+}
+
+// shadowJob is a load or save to repeat on the secondary, with the nodes the
+// primary loaded or saved to compare against
+type shadowJob struct {
+	save bool
+	tree *types.Tree
+}
+
+// ShadowBackend mirrors primary to secondary, see ShadowStorage
+func ShadowBackend(primary, secondary Backend) *ShadowStorage {
+	s := &ShadowStorage{primary: primary, secondary: secondary}
+	s.done = sync.NewCond(&s.mu)
+	return s
+}
+
+// Load loads the primary, then loads the secondary in the background and
+// compares it with what the primary returned
+func (s *ShadowStorage) Load() (*types.Tree, error) {
+	t, err := s.primary.Load()
+	if err != nil {
+		return nil, err
+	}
+	s.enqueue(shadowJob{tree: snapshotTree(t)})
+	return t, nil
+}
+
+// Save saves to the primary, then in the background saves the same tree to
+// the secondary, reads it back and compares
+func (s *ShadowStorage) Save(t *types.Tree) error {
+	if err := s.primary.Save(t); err != nil {
+		return err
+	}
+	s.enqueue(shadowJob{save: true, tree: snapshotTree(t)})
+	return nil
+}
+
+func (s *ShadowStorage) Scan(fn func(n *types.Node) bool) error { return s.primary.Scan(fn) }
+func (s *ShadowStorage) Lock() (func() error, error)            { return s.primary.Lock() }
+func (s *ShadowStorage) TryLock() (func() error, error)         { return s.primary.TryLock() }
+func (s *ShadowStorage) Size() (int64, error)                   { return s.primary.Size() }
+func (s *ShadowStorage) Path() string                           { return s.primary.Path() }
+func (s *ShadowStorage) Schema() (*types.Schema, error)         { return s.primary.Schema() }
+
+// Wait blocks until the background comparisons queued so far are done
+func (s *ShadowStorage) Wait() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.running {
+		s.done.Wait()
+	}
+}
+
+// Close waits for the background comparisons, then closes both backends
+// where they need it
+func (s *ShadowStorage) Close() error {
+	s.Wait()
+	var first error
+	for _, b := range []Backend{s.primary, s.secondary} {
+		if closer, ok := b.(interface{ Close() error }); ok {
+			if err := closer.Close(); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// snapshotTree copies t's slice header so the caller can keep changing t:
+// nodes are never modified after insert and deletes swap in a new slice
+// (see client.snapshot)
+func snapshotTree(t *types.Tree) *types.Tree {
+	return &types.Tree{
+		Nodes:      t.Nodes[:len(t.Nodes):len(t.Nodes)],
+		Normalize:  t.Normalize,
+		Radii:      t.Radii,
+		Projection: t.Projection,
+		Schema:     t.Schema,
+		Config:     t.Config,
+	}
+}
+
+// enqueue hands job to the background worker. Only the latest job waits:
+// saves replace each other since the secondary only needs the newest tree,
+// but a load never displaces a save the secondary hasn't had yet.
+func (s *ShadowStorage) enqueue(job shadowJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job.save || s.pending == nil || !s.pending.save {
+		s.pending = &job
+	}
+	if !s.running {
+		s.running = true
+		go s.run()
+	}
+}
+
+func (s *ShadowStorage) run() {
+	for {
+		s.mu.Lock()
+		job := s.pending
+		s.pending = nil
+		if job == nil {
+			s.running = false
+			s.done.Broadcast()
+			s.mu.Unlock()
+			return
+		}
+		s.mu.Unlock()
+
+		s.shadow(*job)
+	}
+}
+
+// shadow repeats job on the secondary and reports how it compares
+func (s *ShadowStorage) shadow(job shadowJob) {
+	if job.save {
+		if err := s.saveSecondary(job.tree); err != nil {
+			s.fail("save", err)
+			return
+		}
+	}
+
+	loaded, err := s.secondary.Load()
+	if err != nil {
+		s.fail("load", err)
+		return
+	}
+
+	report := CompareTrees(s.primary.Path(), job.tree, s.secondary.Path(), loaded, VerifyOptions{Sample: s.Sample, Tolerance: s.Tolerance})
+	if !report.Consistent() {
+		s.logger().Printf("shadow: %s diverges from %s: %s", report.B, report.A, report.Summary())
+	}
+	if s.Observer != nil {
+		s.Observer.ObserveShadowCheck(report.Divergent)
+	}
+}
+
+func (s *ShadowStorage) saveSecondary(t *types.Tree) error {
+	unlock, err := s.secondary.Lock()
+	if err != nil {
+		return fmt.Errorf("lock error: %w", err)
+	}
+	defer unlock()
+	return s.secondary.Save(t)
+}
+
+func (s *ShadowStorage) fail(op string, err error) {
+	s.logger().Printf("shadow: %s %s failed: %v", s.secondary.Path(), op, err)
+	if s.Observer != nil {
+		s.Observer.ObserveShadowCheck(map[string]int{"error": 1})
+	}
+}
+
+func (s *ShadowStorage) logger() *log.Logger {
+	if s.Logger != nil {
+		return s.Logger
+	}
+	return log.Default()
+}
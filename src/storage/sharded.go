@@ -0,0 +1,584 @@
+package storage
+
+import (
+	"Hippocampus/src/types"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultShardSize is the nodes per shard for NewSharded callers without an opinion
+const DefaultShardSize = 100000
+
+// DefaultResidentShards is how many searched shards stay decoded between
+// searches unless ShardedStorage.ResidentShards says otherwise
+const DefaultResidentShards = 2
+
+const manifestName = "manifest.json"
+
+// ShardedStorage splits a database across shard-0000.bin, shard-0001.bin, ...
+// in one directory. Each shard is an ordinary database file. Save rewrites
+// only the shards whose contents changed, so appending to a large database
+// touches just the newest shard.
+//
+// SearchOpts answers a query without Load: it reads every shard's header,
+// then maps each shard's file and decodes it only when the search reaches
+// it, keeping the ResidentShards most recently searched decoded. A database
+// larger than memory can be searched this way; Load, and with it inserts
+// and deletes through a Client, still need all of it.
+type ShardedStorage struct {
+	dir       string
+	shardSize int
+
+	// CompressThreshold applies to every shard, see FileStorage
+	CompressThreshold int
+
+	// ResidentShards is how many searched shards stay decoded and indexed
+	// between searches; 0 means DefaultResidentShards
+	ResidentShards int
+
+	// shards caches each file's header and, for resident shards, its tree,
+	// keyed by path. Guarded by mu, which SearchOpts holds throughout.
+	mu       sync.Mutex
+	shards   map[string]*shardState
+	searches uint64
+}
+
+// shardState is what a ShardedStorage remembers about one shard file. The
+// size and modification time tell when the file was rewritten under it.
+type shardState struct {
+	size    int64
+	modTime time.Time
+	header  header
+	tree    *types.Tree // nil unless resident
+	used    uint64      // the search that last used tree, for eviction
+}
+
+type shardManifest struct {
+	ShardSize int          `json:"shard_size"`
+	Shards    []shardEntry `json:"shards"`
+}
+
+type shardEntry struct {
+	File   string `json:"file"`
+	Nodes  int    `json:"nodes"`
+	SHA256 string `json:"sha256"`
+}
+
+// NewSharded opens or creates a sharded database in dir. shardSize <= 0
+// keeps the size recorded in the directory (DefaultShardSize for a new one);
+// a different size rebalances the shards on the next Save.
+func NewSharded(dir string, shardSize int) *ShardedStorage {
+	return &ShardedStorage{dir: dir, shardSize: shardSize}
+}
+
+// Open picks the backend for path: s3://bucket/key is an S3Backend in the
+// environment's region, a directory (or a path ending in a separator) is a
+// sharded database, anything else a single file
+func Open(path string) Backend {
+	if bucket, key, ok := ParseS3URL(path); ok {
+		return NewS3Backend(bucket, key, "", "")
+	}
+	if info, err := os.Stat(path); (err == nil && info.IsDir()) || strings.HasSuffix(path, string(os.PathSeparator)) {
+		return NewSharded(path, 0)
+	}
+	return New(path)
+}
+
+func (ss *ShardedStorage) Path() string {
+	return ss.dir
+}
+
+func shardName(i int) string {
+	return fmt.Sprintf("shard-%04d.bin", i)
+}
+
+// shardFiles lists the shards in order, from the manifest if there is one
+func (ss *ShardedStorage) shardFiles() ([]string, error) {
+	m, err := ss.readManifest()
+	if err != nil {
+		return nil, err
+	}
+	if m != nil {
+		files := make([]string, len(m.Shards))
+		for i, s := range m.Shards {
+			files[i] = filepath.Join(ss.dir, s.File)
+		}
+		return files, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(ss.dir, "shard-*.bin"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func (ss *ShardedStorage) readManifest() (*shardManifest, error) {
+	data, err := os.ReadFile(filepath.Join(ss.dir, manifestName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var m shardManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("corrupt shard manifest: %w", err)
+	}
+	return &m, nil
+}
+
+// Schema reads the metadata schema from the first shard's header
+func (ss *ShardedStorage) Schema() (*types.Schema, error) {
+	files, err := ss.shardFiles()
+	if err != nil || len(files) == 0 {
+		return nil, err
+	}
+	h, err := readFileHeader(files[0])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", files[0], err)
+	}
+	return h.schema, nil
+}
+
+// ShardCounts reads only the shard headers
+func (ss *ShardedStorage) ShardCounts() ([]int64, error) {
+	files, err := ss.shardFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make([]int64, len(files))
+	for i, file := range files {
+		if counts[i], err = New(file).NodeCount(); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return counts, nil
+}
+
+// NodeCount totals the shard headers
+func (ss *ShardedStorage) NodeCount() (int64, error) {
+	counts, err := ss.ShardCounts()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, count := range counts {
+		total += count
+	}
+	return total, nil
+}
+
+// Load concatenates every shard into one tree
+func (ss *ShardedStorage) Load() (*types.Tree, error) {
+	files, err := ss.shardFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	t := types.NewTree()
+	for i, file := range files {
+		err := New(file).Scan(func(n *types.Node) bool {
+			t.Nodes = append(t.Nodes, *n)
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		if i == 0 {
+			h, err := readFileHeader(file)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			t.Normalize = h.flags&flagNormalize != 0
+			t.Radii = h.radii
+			t.Projection = h.projection
+			t.Schema = h.schema
+			t.Config = h.config
+			if h.flags&flagCompressText != 0 && ss.CompressThreshold == 0 {
+				ss.CompressThreshold = DefaultCompressThreshold
+			}
+		}
+	}
+
+	t.RebuildIndex()
+	return t, nil
+}
+
+// Scan streams every shard in order
+func (ss *ShardedStorage) Scan(fn func(n *types.Node) bool) error {
+	files, err := ss.shardFiles()
+	if err != nil {
+		return err
+	}
+
+	stopped := false
+	for _, file := range files {
+		err := New(file).Scan(func(n *types.Node) bool {
+			if !fn(n) {
+				stopped = true
+				return false
+			}
+			return true
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		if stopped {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Save splits t into shards of shardSize nodes and rewrites the shards whose
+// contents differ from the manifest. Changing the shard size rebalances every
+// shard; shards past the new end are removed.
+func (ss *ShardedStorage) Save(t *types.Tree) error {
+	if err := os.MkdirAll(ss.dir, 0755); err != nil {
+		return err
+	}
+
+	old, err := ss.readManifest()
+	if err != nil {
+		return err
+	}
+
+	shardSize := ss.shardSize
+	if shardSize <= 0 {
+		shardSize = DefaultShardSize
+		if old != nil && old.ShardSize > 0 {
+			shardSize = old.ShardSize
+		}
+	}
+
+	next := shardManifest{ShardSize: shardSize}
+	for start := 0; start < len(t.Nodes) || start == 0; start += shardSize {
+		end := start + shardSize
+		if end > len(t.Nodes) {
+			end = len(t.Nodes)
+		}
+
+		shard := &types.Tree{Nodes: t.Nodes[start:end], Normalize: t.Normalize, Radii: t.Radii, Schema: t.Schema, Config: t.Config}
+		if start == 0 {
+			// Load reads the projection from the first shard; it can be
+			// megabytes, so the others don't repeat it
+			shard.Projection = t.Projection
+		}
+		sum, err := shardChecksum(shard, ss.CompressThreshold)
+		if err != nil {
+			return err
+		}
+
+		i := len(next.Shards)
+		entry := shardEntry{File: shardName(i), Nodes: end - start, SHA256: sum}
+		next.Shards = append(next.Shards, entry)
+
+		if old != nil && i < len(old.Shards) && old.Shards[i] == entry {
+			if _, err := os.Stat(filepath.Join(ss.dir, entry.File)); err == nil {
+				continue
+			}
+		}
+
+		fs := New(filepath.Join(ss.dir, entry.File))
+		fs.CompressThreshold = ss.CompressThreshold
+		if err := fs.Save(shard); err != nil {
+			return fmt.Errorf("%s: %w", entry.File, err)
+		}
+	}
+
+	if err := ss.writeManifest(&next); err != nil {
+		return err
+	}
+
+	// Only drop surplus shards once the manifest no longer lists them
+	if old != nil {
+		for i := len(next.Shards); i < len(old.Shards); i++ {
+			os.Remove(filepath.Join(ss.dir, old.Shards[i].File))
+		}
+	}
+	return nil
+}
+
+func shardChecksum(t *types.Tree, compressThreshold int) (string, error) {
+	h := sha256.New()
+	if err := writeTree(h, t, compressThreshold, 0); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (ss *ShardedStorage) writeManifest(m *shardManifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(ss.dir, manifestName+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, filepath.Join(ss.dir, manifestName))
+}
+
+// Size is the total size of the shard files
+func (ss *ShardedStorage) Size() (int64, error) {
+	files, err := ss.shardFiles()
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, file := range files {
+		size, err := New(file).Size()
+		if err != nil {
+			return 0, err
+		}
+		total += size
+	}
+	return total, nil
+}
+
+// Lock and TryLock use one lock file for the whole directory
+func (ss *ShardedStorage) Lock() (func() error, error) {
+	return ss.lock(true)
+}
+
+func (ss *ShardedStorage) TryLock() (func() error, error) {
+	return ss.lock(false)
+}
+
+func (ss *ShardedStorage) lock(wait bool) (func() error, error) {
+	if err := os.MkdirAll(ss.dir, 0755); err != nil {
+		return nil, err
+	}
+	return New(filepath.Join(ss.dir, "shards")).lock(wait)
+}
+
+// Settings is an empty tree carrying the first shard's header: the
+// normalization, projection, radii, schema and config a query is prepared
+// and checked with
+func (ss *ShardedStorage) Settings() (*types.Tree, error) {
+	files, err := ss.shardFiles()
+	if err != nil {
+		return nil, err
+	}
+	t := types.NewTree()
+	if len(files) == 0 {
+		return t, nil
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	state, err := ss.shardState(files[0])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", files[0], err)
+	}
+	h := state.header
+	t.Normalize = h.flags&flagNormalize != 0
+	t.Radii = h.radii
+	t.Projection = h.projection
+	t.Schema = h.schema
+	t.Config = h.config
+	return t, nil
+}
+
+// CanSearch reports whether SearchOpts supports opts. Re-ranking and
+// grouping need every candidate at once, access tracking writes to the
+// nodes and an explanation describes one index, so those need Load.
+func (ss *ShardedStorage) CanSearch(opts types.SearchOptions) bool {
+	return !opts.MMR && len(opts.NegativeVectors) == 0 && opts.GroupBy == "" &&
+		!opts.TrackAccess && opts.Explanation == nil
+}
+
+// SearchOpts runs the query against each shard in turn and merges the
+// per-shard top-k by distance. query must already be prepared (see
+// Settings and Tree.PrepareKey). MaxCandidates applies to each shard;
+// the deadline to the whole search, which stops at the next shard once it
+// has passed. It reports whether either cut the search short.
+func (ss *ShardedStorage) SearchOpts(query [512]float32, opts types.SearchOptions) ([]types.ScoredNode, bool, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, false, err
+	}
+	if !ss.CanSearch(opts) {
+		return nil, false, fmt.Errorf("MMR, negative vectors, group-by, access tracking and explain are not supported across shards; load the database instead")
+	}
+
+	files, err := ss.shardFiles()
+	if err != nil {
+		return nil, false, err
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.searches++
+
+	// Read every header first, so empty shards are skipped unmapped
+	states := make([]*shardState, len(files))
+	for i, file := range files {
+		if states[i], err = ss.shardState(file); err != nil {
+			return nil, false, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+
+	perShard := opts
+	perShard.Offset = 0
+	perShard.TopK = opts.TopK + opts.Offset
+	want := perShard.TopK
+
+	var merged []types.ScoredNode
+	truncated := false
+	for i, state := range states {
+		if state.header.nodeCount == 0 {
+			continue
+		}
+		if !opts.Deadline.IsZero() && !time.Now().Before(opts.Deadline) {
+			truncated = true
+			break
+		}
+		if state.tree == nil {
+			if state.tree, err = loadMapped(files[i]); err != nil {
+				return nil, false, fmt.Errorf("%s: %w", files[i], err)
+			}
+		}
+		state.used = ss.searches
+
+		hits, cut, err := state.tree.SearchOpts(query, perShard)
+		if err != nil {
+			return nil, false, err
+		}
+		truncated = truncated || cut
+
+		merged = append(merged, hits...)
+		sort.SliceStable(merged, func(i, j int) bool {
+			return merged[i].Distance < merged[j].Distance
+		})
+		if len(merged) > want {
+			merged = merged[:want]
+		}
+	}
+	ss.evictShards()
+
+	if opts.Offset >= len(merged) {
+		return nil, truncated, nil
+	}
+	return merged[opts.Offset:], truncated, nil
+}
+
+// shardState returns what is known about file, rereading its header if
+// the file changed since. Call with mu held.
+func (ss *ShardedStorage) shardState(file string) (*shardState, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	if state := ss.shards[file]; state != nil && state.size == info.Size() && state.modTime.Equal(info.ModTime()) {
+		return state, nil
+	}
+
+	h, err := readFileHeader(file)
+	if err != nil {
+		return nil, err
+	}
+	state := &shardState{size: info.Size(), modTime: info.ModTime(), header: h}
+	if ss.shards == nil {
+		ss.shards = make(map[string]*shardState)
+	}
+	ss.shards[file] = state
+	return state, nil
+}
+
+// evictShards drops the decoded trees of all but the ResidentShards most
+// recently searched shards. Call with mu held.
+func (ss *ShardedStorage) evictShards() {
+	limit := ss.ResidentShards
+	if limit <= 0 {
+		limit = DefaultResidentShards
+	}
+	var resident []*shardState
+	for _, state := range ss.shards {
+		if state.tree != nil {
+			resident = append(resident, state)
+		}
+	}
+	if len(resident) <= limit {
+		return
+	}
+	sort.Slice(resident, func(i, j int) bool {
+		return resident[i].used > resident[j].used
+	})
+	for _, state := range resident[limit:] {
+		state.tree = nil
+	}
+}
+
+// loadMapped decodes a shard file through a read-only mapping of it, so
+// the bytes come from the page cache rather than a copy on the heap. The
+// decoded tree copies everything out, and the mapping is released before
+// returning.
+func loadMapped(path string) (*types.Tree, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() == 0 {
+		return types.NewTree(), nil
+	}
+
+	data, unmap, err := mapFile(f, info.Size())
+	if err != nil {
+		return nil, err
+	}
+	defer unmap()
+
+	t, _, err := readTree(bytes.NewReader(data))
+	return t, err
+}
+
+func readFileHeader(path string) (header, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return header{}, err
+	}
+	defer f.Close()
+
+	r, err := openFileReader(f)
+	if err != nil {
+		return header{}, err
+	}
+	return readHeader(r)
+}
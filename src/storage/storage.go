@@ -2,43 +2,240 @@ package storage
 
 import (
 	"Hippocampus/src/types"
+	"bufio"
 	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"sort"
+	"sync"
 )
 
+// File format versions
+const (
+	formatV1      = 1 // key + value per node
+	formatV2      = 2 // adds per-node metadata
+	formatV3      = 3 // adds per-node payload bytes
+	formatV4      = 4 // adds header flags
+	formatVersion = formatV4
+)
+
+// Header flags
+const (
+	flagNormalize int64 = 1 << iota
+	flagCompressText // value and metadata stored as a text block, see compress.go
+	flagRadii // a radius table follows the flags, see writeHeader
+	flagAltKeys // every node ends with its alternate keys, see writeNode
+	flagProjection // a projection matrix follows the radius table, see writeHeader
+	flagSchema // a metadata schema follows the projection, see writeHeader
+	flagConfig // the database's configuration follows the schema, see writeHeader
+	flagGeneration // the save generation follows the configuration, see writeHeader
+
+	knownFlags = flagNormalize | flagCompressText | flagRadii | flagAltKeys | flagProjection | flagSchema | flagConfig | flagGeneration
+)
+
+// maxAltKeys bounds a node's alternate key count when reading, so a corrupt
+// count fails cleanly instead of allocating gigabytes
+const maxAltKeys = 1 << 16
+
+// maxProjectionInput bounds a projection's input width when reading, for
+// the same reason
+const maxProjectionInput = 1 << 16
+
+// ErrCorrupt wraps read errors caused by lengths and counts that cannot
+// fit in what is left of the file
+var ErrCorrupt = errors.New("corrupt file")
+
+// ErrConcurrentModification is returned by Save when another writer has
+// saved the file since this FileStorage loaded it. Saving anyway would throw
+// their changes away; reload, merge and save again instead.
+var ErrConcurrentModification = errors.New("database was modified by another writer")
+
+// minNodeSize is the smallest encoded node: the key and a value length
+// prefix (version 1 files have nothing else)
+const minNodeSize = 512*4 + 8
+
+type header struct {
+	version   int
+	flags     int64
+	radii      map[string]float32
+	projection *types.Projection
+	schema     *types.Schema
+	config     *types.Config
+	generation uint64
+	nodeCount  int64
+}
+
 type FileStorage struct {
 	path string
+
+	// generation is the save count read by the last Load, or written by the
+	// last Save; Save expects to find it still on disk. A FileStorage that
+	// has never loaded checks nothing, so writing a tree to a new path (or
+	// deliberately over an old one) works as it always has.
+	mu         sync.Mutex
+	generation uint64
+	loaded     bool
+
+	// CompressThreshold gzips node text (value plus metadata) of at least
+	// this many bytes. 0 stores text raw, except that loading a compressed
+	// file turns compression on so later saves keep it; negative always
+	// stores raw.
+	CompressThreshold int
 }
 
 func New(path string) *FileStorage {
 	return &FileStorage{path: path}
 }
 
+func (fs *FileStorage) Path() string {
+	return fs.path
+}
+
+// Generation is the file's save count as of the last Load or Save: every
+// Save writes one more than the file held. Files written before generations
+// were recorded start at 0.
+func (fs *FileStorage) Generation() uint64 {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.generation
+}
+
+// Save writes to a temp file next to the database and renames it into place,
+// so an interrupted save never leaves a truncated file behind. After a Load,
+// Save checks the file's generation just before the rename and fails with
+// ErrConcurrentModification if another writer has saved since. The check
+// and the rename are only atomic against writers holding the Lock.
 func (fs *FileStorage) Save(t *types.Tree) error {
-	f, err := os.Create(fs.path)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	f, err := os.CreateTemp(filepath.Dir(fs.path), filepath.Base(fs.path)+".tmp-*")
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+	tmpPath := f.Name()
+	defer os.Remove(tmpPath)
 
-	if err := binary.Write(f, binary.LittleEndian, int64(len(t.Nodes))); err != nil {
+	// CreateTemp uses 0600; keep the permissions os.Create used to give us
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
 		return err
 	}
 
-	for i := range t.Nodes {
-		if err := writeNode(f, &t.Nodes[i]); err != nil {
+	// A FileStorage that has not loaded carries on from whatever is on
+	// disk; a file it can't read counts as generation 0
+	generation := fs.generation + 1
+	if !fs.loaded {
+		if h, err := fs.header(); err == nil {
+			generation = h.generation + 1
+		}
+	}
+
+	if err := writeTree(f, t, fs.CompressThreshold, generation); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	// Check as late as possible, so a save by another writer while this
+	// one was being written is caught too
+	if fs.loaded {
+		onDisk, err := fs.header()
+		if err != nil {
 			return err
 		}
+		if onDisk.generation != fs.generation {
+			return fmt.Errorf("%w: %s is at generation %d, expected %d", ErrConcurrentModification, fs.path, onDisk.generation, fs.generation)
+		}
 	}
 
+	if err := os.Rename(tmpPath, fs.path); err != nil {
+		return err
+	}
+	fs.generation = generation
+	fs.loaded = true
 	return nil
 }
 
+// writeTree writes the header and every node; a generation of 0 is left out
+// of the header
+func writeTree(out io.Writer, t *types.Tree, compressThreshold int, generation uint64) error {
+	w := bufio.NewWriter(out)
+
+	var flags int64
+	if t.Normalize {
+		flags |= flagNormalize
+	}
+	if compressThreshold > 0 {
+		flags |= flagCompressText
+	}
+	if len(t.Radii) > 0 {
+		flags |= flagRadii
+	}
+	if t.Projection != nil {
+		flags |= flagProjection
+	}
+	if t.Schema != nil {
+		flags |= flagSchema
+	}
+	if t.Config != nil {
+		flags |= flagConfig
+	}
+	if generation > 0 {
+		flags |= flagGeneration
+	}
+	for i := range t.Nodes {
+		if len(t.Nodes[i].AltKeys) > 0 {
+			flags |= flagAltKeys
+			break
+		}
+	}
+
+	if err := writeHeader(w, flags, t.Radii, t.Projection, t.Schema, t.Config, generation, int64(len(t.Nodes))); err != nil {
+		return err
+	}
+
+	for i := range t.Nodes {
+		if err := writeNode(w, &t.Nodes[i], flags, compressThreshold); err != nil {
+			return err
+		}
+	}
+
+	return w.Flush()
+}
+
+// Size returns the database file size in bytes, 0 if it does not exist yet
+func (fs *FileStorage) Size() (int64, error) {
+	info, err := os.Stat(fs.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
 func (fs *FileStorage) Load() (*types.Tree, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
 	f, err := os.Open(fs.path)
 	if err != nil {
 		if os.IsNotExist(err) {
+			fs.generation, fs.loaded = 0, true
 			return &types.Tree{
 				Nodes: []types.Node{},
 				Index: [512][]int32{},
@@ -54,62 +251,621 @@ func (fs *FileStorage) Load() (*types.Tree, error) {
 	}
 
 	if info.Size() == 0 {
+		fs.generation, fs.loaded = 0, true
 		return &types.Tree{
 			Nodes: []types.Node{},
 			Index: [512][]int32{},
 		}, nil
 	}
 
-	var nodeCount int64
-	if err := binary.Read(f, binary.LittleEndian, &nodeCount); err != nil {
+	t, h, err := readTree(newFileReader(f, info.Size()))
+	if err != nil {
 		return nil, err
 	}
 
+	if h.flags&flagCompressText != 0 && fs.CompressThreshold == 0 {
+		fs.CompressThreshold = DefaultCompressThreshold
+	}
+
+	fs.generation, fs.loaded = h.generation, true
+
+	return t, nil
+}
+
+// readTree decodes a whole database file from r, which must know its
+// length (see checkRemaining), and builds the indices
+func readTree(r io.Reader) (*types.Tree, header, error) {
+	h, err := readHeader(r)
+	if err != nil {
+		return nil, h, err
+	}
+	if err := checkNodeCount(r, h); err != nil {
+		return nil, h, err
+	}
+
 	t := &types.Tree{
-		Nodes: make([]types.Node, nodeCount),
+		Nodes: make([]types.Node, h.nodeCount),
 		Index: [512][]int32{},
+		Normalize: h.flags&flagNormalize != 0,
+		Radii: h.radii,
+		Projection: h.projection,
+		Schema: h.schema,
+		Config: h.config,
 	}
 
 	for i := range t.Nodes {
-		if err := readNode(f, &t.Nodes[i]); err != nil {
-			return nil, err
+		if err := readNode(r, &t.Nodes[i], h, nil); err != nil {
+			return nil, h, err
 		}
 	}
 
 	t.RebuildIndex()
+	return t, h, nil
+}
 
-	return t, nil
+// Scan streams nodes from disk in insertion order without building indices.
+// fn returns false to stop early.
+func (fs *FileStorage) Scan(fn func(n *types.Node) bool) error {
+	f, err := os.Open(fs.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	r, err := openFileReader(f)
+	if err != nil {
+		return err
+	}
+
+	h, err := readHeader(r)
+	if err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+
+	var n types.Node
+	for i := int64(0); i < h.nodeCount; i++ {
+		if err := readNode(r, &n, h, nil); err != nil {
+			return err
+		}
+		if !fn(&n) {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// NodeCount reads only the file header, so callers can report sizes without loading every node
+func (fs *FileStorage) NodeCount() (int64, error) {
+	h, err := fs.header()
+	return h.nodeCount, err
+}
+
+// Schema reads the metadata schema from the file header; nil if there is none
+func (fs *FileStorage) Schema() (*types.Schema, error) {
+	h, err := fs.header()
+	return h.schema, err
+}
+
+// FileHeader is what a database file records ahead of its nodes, less the
+// sections the tree itself carries (see ExportHeader)
+type FileHeader struct {
+	Version    int      `json:"version"`
+	Flags      []string `json:"flags,omitempty"` // the sections and options present
+	Generation uint64   `json:"generation"`
+	Nodes      int64    `json:"nodes"`
+}
+
+// flagNames names the header flags for FileHeader, in bit order
+var flagNames = []struct {
+	flag int64
+	name string
+}{
+	{flagNormalize, "normalize"},
+	{flagCompressText, "compress-text"},
+	{flagRadii, "radii"},
+	{flagAltKeys, "alt-keys"},
+	{flagProjection, "projection"},
+	{flagSchema, "schema"},
+	{flagConfig, "config"},
+	{flagGeneration, "generation"},
+}
+
+// Header reads the file header without loading the nodes; a missing or
+// empty file has a zero one
+func (fs *FileStorage) Header() (FileHeader, error) {
+	h, err := fs.header()
+	if err != nil {
+		return FileHeader{}, err
+	}
+	fh := FileHeader{Version: h.version, Generation: h.generation, Nodes: h.nodeCount}
+	for _, f := range flagNames {
+		if h.flags&f.flag != 0 {
+			fh.Flags = append(fh.Flags, f.name)
+		}
+	}
+	return fh, nil
+}
+
+// header reads the file header, or returns an empty one for a missing or
+// empty file
+func (fs *FileStorage) header() (header, error) {
+	f, err := os.Open(fs.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return header{}, nil
+		}
+		return header{}, err
+	}
+	defer f.Close()
+
+	r, err := openFileReader(f)
+	if err != nil {
+		return header{}, err
+	}
+	h, err := readHeader(r)
+	if err == io.EOF {
+		return header{}, nil
+	}
+	return h, err
+}
+
+// writeHeader writes -formatVersion, the flags, the radius table when
+// flagRadii is set (an int64 count, then each word and its float32 epsilon
+// in word order), the projection when flagProjection is set (int64 input
+// and output dimensions, then the float32 matrix), the schema as a
+// length-prefixed JSON object when flagSchema is set, the configuration
+// the same way when flagConfig is set, the generation as an int64 when
+// flagGeneration is set and the node count.
+// Version 1 files have no marker and start directly with the (non-negative)
+// count; versions 2 and 3 have no flags.
+func writeHeader(w io.Writer, flags int64, radii map[string]float32, projection *types.Projection, schema *types.Schema, config *types.Config, generation uint64, nodeCount int64) error {
+
+	if err := binary.Write(w, binary.LittleEndian, -int64(formatVersion)); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, flags); err != nil {
+		return err
+	}
+
+	if flags&flagRadii != 0 {
+		words := make([]string, 0, len(radii))
+		for word := range radii {
+			words = append(words, word)
+		}
+		sort.Strings(words)
+
+		if err := binary.Write(w, binary.LittleEndian, int64(len(words))); err != nil {
+			return err
+		}
+		for _, word := range words {
+			if err := writeString(w, word); err != nil {
+				return err
+			}
+			if err := binary.Write(w, binary.LittleEndian, radii[word]); err != nil {
+				return err
+			}
+		}
+	}
+
+	if flags&flagProjection != 0 {
+		dims := []int64{int64(projection.InputDims), int64(projection.OutputDims)}
+		if err := binary.Write(w, binary.LittleEndian, dims); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.LittleEndian, projection.Matrix); err != nil {
+			return err
+		}
+	}
+
+	if flags&flagSchema != 0 {
+		encoded, err := json.Marshal(schema)
+		if err != nil {
+			return err
+		}
+		if err := writeBytes(w, encoded); err != nil {
+			return err
+		}
+	}
+
+	if flags&flagConfig != 0 {
+		encoded, err := json.Marshal(config)
+		if err != nil {
+			return err
+		}
+		if err := writeBytes(w, encoded); err != nil {
+			return err
+		}
+	}
+
+	if flags&flagGeneration != 0 {
+		if err := binary.Write(w, binary.LittleEndian, int64(generation)); err != nil {
+			return err
+		}
+	}
+
+	return binary.Write(w, binary.LittleEndian, nodeCount)
 }
 
-func writeNode(w io.Writer, n *types.Node) error {
+func readHeader(r io.Reader) (header, error) {
+	var first int64
+	if err := binary.Read(r, binary.LittleEndian, &first); err != nil {
+		return header{}, err
+	}
+
+	if first >= 0 {
+		return header{version: formatV1, nodeCount: first}, nil
+	}
+
+	h := header{version: int(-first)}
+	if h.version > formatVersion {
+		return header{}, fmt.Errorf("unsupported file format version %d (newest known is %d)", h.version, formatVersion)
+	}
+
+	if h.version >= formatV4 {
+		if err := binary.Read(r, binary.LittleEndian, &h.flags); err != nil {
+			return header{}, err
+		}
+		if unknown := h.flags &^ knownFlags; unknown != 0 {
+			return header{}, fmt.Errorf("unsupported file format flags %#x", unknown)
+		}
+	}
+
+	if h.flags&flagRadii != 0 {
+		var count int64
+		if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+			return header{}, err
+		}
+		if count < 0 {
+			return header{}, fmt.Errorf("invalid radius table size %d", count)
+		}
+		// Each entry is at least a length prefix and an epsilon
+		if err := checkRemaining(r, count, 8+4, "radius table size"); err != nil {
+			return header{}, err
+		}
+		h.radii = make(map[string]float32, count)
+		for i := int64(0); i < count; i++ {
+			word, err := readString(r)
+			if err != nil {
+				return header{}, err
+			}
+			var epsilon float32
+			if err := binary.Read(r, binary.LittleEndian, &epsilon); err != nil {
+				return header{}, err
+			}
+			h.radii[word] = epsilon
+		}
+	}
+
+	if h.flags&flagProjection != 0 {
+		var dims [2]int64
+		if err := binary.Read(r, binary.LittleEndian, &dims); err != nil {
+			return header{}, err
+		}
+		if dims[0] <= 0 || dims[0] > maxProjectionInput || dims[1] <= 0 || dims[1] > 512 {
+			return header{}, fmt.Errorf("invalid projection %d -> %d dimensions", dims[0], dims[1])
+		}
+		if err := checkRemaining(r, dims[0]*dims[1], 4, "projection size"); err != nil {
+			return header{}, err
+		}
+		h.projection = &types.Projection{
+			InputDims:  int(dims[0]),
+			OutputDims: int(dims[1]),
+			Matrix:     make([]float32, dims[0]*dims[1]),
+		}
+		if err := binary.Read(r, binary.LittleEndian, h.projection.Matrix); err != nil {
+			return header{}, err
+		}
+	}
+
+	if h.flags&flagSchema != 0 {
+		encoded, err := readBytes(r)
+		if err != nil {
+			return header{}, err
+		}
+		h.schema = &types.Schema{}
+		if err := json.Unmarshal(encoded, h.schema); err != nil {
+			return header{}, fmt.Errorf("%w: schema: %v", ErrCorrupt, err)
+		}
+		if err := h.schema.Validate(); err != nil {
+			return header{}, fmt.Errorf("%w: schema: %v", ErrCorrupt, err)
+		}
+	}
+
+	if h.flags&flagConfig != 0 {
+		encoded, err := readBytes(r)
+		if err != nil {
+			return header{}, err
+		}
+		h.config = &types.Config{}
+		if err := json.Unmarshal(encoded, h.config); err != nil {
+			return header{}, fmt.Errorf("%w: config: %v", ErrCorrupt, err)
+		}
+	}
+
+	if h.flags&flagGeneration != 0 {
+		var generation int64
+		if err := binary.Read(r, binary.LittleEndian, &generation); err != nil {
+			return header{}, err
+		}
+		if generation < 0 {
+			return header{}, fmt.Errorf("%w: negative generation %d", ErrCorrupt, generation)
+		}
+		h.generation = uint64(generation)
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &h.nodeCount); err != nil {
+		return header{}, err
+	}
+
+	return h, nil
+}
+
+// writeNode writes the key, the text, the payload and, when flagAltKeys is
+// set, an int64 count of alternate keys followed by the keys
+func writeNode(w io.Writer, n *types.Node, flags int64, compressThreshold int) error {
 	if err := binary.Write(w, binary.LittleEndian, n.Key); err != nil {
 		return err
 	}
 
-	valueBytes := []byte(n.Value)
-	if err := binary.Write(w, binary.LittleEndian, int64(len(valueBytes))); err != nil {
+	if compressThreshold > 0 {
+		if err := writeTextBlock(w, n, compressThreshold); err != nil {
+			return err
+		}
+	} else {
+		if err := writeText(w, n); err != nil {
+			return err
+		}
+	}
+
+	if err := writeBytes(w, n.Payload); err != nil {
 		return err
 	}
 
-	_, err := w.Write(valueBytes)
-	return err
+	if flags&flagAltKeys == 0 {
+		return nil
+	}
+	if err := binary.Write(w, binary.LittleEndian, int64(len(n.AltKeys))); err != nil {
+		return err
+	}
+	for i := range n.AltKeys {
+		if err := binary.Write(w, binary.LittleEndian, &n.AltKeys[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeText writes the value and metadata uncompressed
+func writeText(w io.Writer, n *types.Node) error {
+	if err := writeString(w, n.Value); err != nil {
+		return err
+	}
+	return writeMetadata(w, n.Metadata)
 }
 
-func readNode(r io.Reader, n *types.Node) error {
+// readNode decodes one node; stats, if not nil, accumulates text sizes
+func readNode(r io.Reader, n *types.Node, h header, stats *CompressionStats) error {
 	if err := binary.Read(r, binary.LittleEndian, &n.Key); err != nil {
 		return err
 	}
 
-	var valueLen int64
-	if err := binary.Read(r, binary.LittleEndian, &valueLen); err != nil {
+	if h.flags&flagCompressText != 0 {
+		if err := readTextBlock(r, n, stats); err != nil {
+			return err
+		}
+	} else {
+		if err := readText(r, n, h.version); err != nil {
+			return err
+		}
+	}
+
+	n.Payload = nil
+	if h.version >= formatV3 {
+		var err error
+		if n.Payload, err = readBytes(r); err != nil {
+			return err
+		}
+	}
+
+	n.AltKeys = nil
+	if h.flags&flagAltKeys != 0 {
+		var count int64
+		if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+			return err
+		}
+		if count < 0 || count > maxAltKeys {
+			return fmt.Errorf("invalid alternate key count %d", count)
+		}
+		if err := checkRemaining(r, count, 512*4, "alternate key count"); err != nil {
+			return err
+		}
+		if count > 0 {
+			n.AltKeys = make([][512]float32, count)
+			for i := range n.AltKeys {
+				if err := binary.Read(r, binary.LittleEndian, &n.AltKeys[i]); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func readText(r io.Reader, n *types.Node, version int) error {
+	value, err := readString(r)
+	if err != nil {
+		return err
+	}
+	n.Value = value
+
+	n.Metadata = nil
+	if version >= formatV2 {
+		if n.Metadata, err = readMetadata(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeMetadata writes an entry count followed by key/value pairs in key order
+func writeMetadata(w io.Writer, metadata map[string]string) error {
+	if err := binary.Write(w, binary.LittleEndian, int64(len(metadata))); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(metadata))
+	for k := range metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if err := writeString(w, k); err != nil {
+			return err
+		}
+		if err := writeString(w, metadata[k]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func readMetadata(r io.Reader) (map[string]string, error) {
+	var count int64
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return nil, err
+	}
+
+	if count == 0 {
+		return nil, nil
+	}
+	// Each entry is at least two length prefixes
+	if err := checkRemaining(r, count, 16, "metadata count"); err != nil {
+		return nil, err
+	}
+
+	metadata := make(map[string]string, count)
+	for i := int64(0); i < count; i++ {
+		k, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		v, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		metadata[k] = v
+	}
+
+	return metadata, nil
+}
+
+func writeString(w io.Writer, s string) error {
+	if err := binary.Write(w, binary.LittleEndian, int64(len(s))); err != nil {
 		return err
 	}
 
-	valueBytes := make([]byte, valueLen)
-	if _, err := io.ReadFull(r, valueBytes); err != nil {
+	_, err := io.WriteString(w, s)
+	return err
+}
+
+func readString(r io.Reader) (string, error) {
+	buf, err := readBytes(r)
+	return string(buf), err
+}
+
+func writeBytes(w io.Writer, b []byte) error {
+	if err := binary.Write(w, binary.LittleEndian, int64(len(b))); err != nil {
 		return err
 	}
 
-	n.Value = string(valueBytes)
+	_, err := w.Write(b)
+	return err
+}
+
+// readBytes returns nil rather than an empty slice for zero-length fields
+func readBytes(r io.Reader) ([]byte, error) {
+	var length int64
+	if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+		return nil, err
+	}
+
+	if length == 0 {
+		return nil, nil
+	}
+	if err := checkRemaining(r, length, 1, "field length"); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+// fileReader buffers a file and counts down the bytes left in it, so
+// lengths read from the file can be checked before anything is allocated
+type fileReader struct {
+	r         *bufio.Reader
+	remaining int64
+}
+
+func newFileReader(f *os.File, size int64) *fileReader {
+	return &fileReader{r: bufio.NewReader(f), remaining: size}
+}
+
+// openFileReader is newFileReader for a file whose size is not yet known
+func openFileReader(f *os.File) (*fileReader, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return newFileReader(f, info.Size()), nil
+}
+
+func (fr *fileReader) Read(p []byte) (int, error) {
+	n, err := fr.r.Read(p)
+	fr.remaining -= int64(n)
+	return n, err
+}
+
+// Len is the number of unread bytes, like bytes.Reader's
+func (fr *fileReader) Len() int {
+	return int(fr.remaining)
+}
+
+// checkRemaining fails with ErrCorrupt when count is negative or count
+// items of at least size bytes each cannot fit in what is left of r.
+// Readers that do not know their length (anything but a fileReader or
+// bytes.Reader) only get the sign check.
+func checkRemaining(r io.Reader, count, size int64, what string) error {
+	if count < 0 {
+		return fmt.Errorf("%w: negative %s %d", ErrCorrupt, what, count)
+	}
+	sized, ok := r.(interface{ Len() int })
+	if !ok {
+		return nil
+	}
+	remaining := int64(sized.Len())
+	if count > remaining/size {
+		return fmt.Errorf("%w: %s %d exceeds the %d bytes remaining", ErrCorrupt, what, count, remaining)
+	}
 	return nil
 }
+
+// checkNodeCount rejects a node count the rest of the file cannot hold,
+// before Load allocates the node slice
+func checkNodeCount(r io.Reader, h header) error {
+	return checkRemaining(r, h.nodeCount, minNodeSize, "node count")
+}
@@ -0,0 +1,161 @@
+package types
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Metadata keys access tracking keeps a node's counters under (see
+// SearchOptions.TrackAccess): how many tracked searches returned it, and
+// when the last one did, as an RFC 3339 time
+const (
+	HitCountKey     = "hit_count"
+	LastAccessedKey = "last_accessed"
+)
+
+// access is the hits a node has had since its counters were last written
+type access struct {
+	hits int64
+	last time.Time
+}
+
+// AccessStats summarises the access counters stored on a tree's nodes
+type AccessStats struct {
+	Accessed     int       `json:"accessed"`               // nodes with a hit count
+	Hits         int64     `json:"hits"`                   // summed over every node
+	MaxHits      int64     `json:"max_hits"`               // the most-returned node's count
+	LastAccessed time.Time `json:"last_accessed,omitzero"` // the latest access of any node
+}
+
+// RecordAccess counts one hit at time at for each result's node. The
+// counts are held in memory until ApplyAccess writes them into metadata,
+// so a search pays for a map update rather than a copy of the nodes.
+func (t *Tree) RecordAccess(results []ScoredNode, at time.Time) {
+	if len(results) == 0 {
+		return
+	}
+	if t.accesses == nil {
+		t.accesses = make(map[int32]*access)
+	}
+	for _, r := range results {
+		a := t.accesses[r.index]
+		if a == nil {
+			a = &access{}
+			t.accesses[r.index] = a
+		}
+		a.hits++
+		if at.After(a.last) {
+			a.last = at
+		}
+	}
+}
+
+// PendingAccess is how many nodes have hits ApplyAccess has not written yet
+func (t *Tree) PendingAccess() int {
+	return len(t.accesses)
+}
+
+// ApplyAccess adds the recorded hits to each node's HitCountKey and moves
+// its LastAccessedKey forward, returning how many nodes it updated. Nodes
+// and their metadata maps are replaced rather than edited, since a
+// snapshot being saved in the background may share them.
+func (t *Tree) ApplyAccess() int {
+	if len(t.accesses) == 0 {
+		return 0
+	}
+
+	nodes := slices.Clone(t.Nodes)
+	applied := 0
+	for i, a := range t.accesses {
+		if int(i) >= len(nodes) {
+			continue
+		}
+		n := &nodes[i]
+		metadata := maps.Clone(n.Metadata)
+		if metadata == nil {
+			metadata = make(map[string]string, 2)
+		}
+		hits, _ := strconv.ParseInt(metadata[HitCountKey], 10, 64)
+		metadata[HitCountKey] = strconv.FormatInt(hits+a.hits, 10)
+		if last, ok := nodeLastAccessed(n); !ok || a.last.After(last) {
+			metadata[LastAccessedKey] = a.last.UTC().Format(time.RFC3339Nano)
+		}
+		n.Metadata = metadata
+		applied++
+	}
+
+	// The index and keyword index hold positions, which are unchanged
+	t.Nodes = nodes
+	t.accesses = nil
+	return applied
+}
+
+// remapAccess moves the recorded hits to the nodes' new positions after a
+// delete; kept[i] is whether old node i survived
+func (t *Tree) remapAccess(kept []bool) {
+	if len(t.accesses) == 0 {
+		return
+	}
+	position := make([]int32, len(kept))
+	next := int32(0)
+	for i, k := range kept {
+		position[i] = next
+		if k {
+			next++
+		}
+	}
+	remapped := make(map[int32]*access, len(t.accesses))
+	for i, a := range t.accesses {
+		if int(i) < len(kept) && kept[i] {
+			remapped[position[i]] = a
+		}
+	}
+	t.accesses = remapped
+}
+
+// AccessStats reads the counters ApplyAccess has written into metadata
+func (t *Tree) AccessStats() AccessStats {
+	var stats AccessStats
+	for i := range t.Nodes {
+		n := &t.Nodes[i]
+		hits, err := strconv.ParseInt(n.Metadata[HitCountKey], 10, 64)
+		if err != nil {
+			continue
+		}
+		stats.Accessed++
+		stats.Hits += hits
+		stats.MaxHits = max(stats.MaxHits, hits)
+		if last, ok := nodeLastAccessed(n); ok && last.After(stats.LastAccessed) {
+			stats.LastAccessed = last
+		}
+	}
+	return stats
+}
+
+// nodeAccess is node i's HitCountKey and LastAccessedKey with the hits
+// ApplyAccess has not written yet added in: zero for a node never accessed
+func (t *Tree) nodeAccess(i int) access {
+	n := &t.Nodes[i]
+	hits, _ := strconv.ParseInt(n.Metadata[HitCountKey], 10, 64)
+	last, _ := nodeLastAccessed(n)
+	if a := t.accesses[int32(i)]; a != nil {
+		hits += a.hits
+		if a.last.After(last) {
+			last = a.last
+		}
+	}
+	return access{hits: hits, last: last}
+}
+
+// nodeLastAccessed reads LastAccessedKey, false when it is missing or
+// unreadable
+func nodeLastAccessed(n *Node) (time.Time, bool) {
+	value, ok := n.Metadata[LastAccessedKey]
+	if !ok {
+		return time.Time{}, false
+	}
+	last, err := time.Parse(time.RFC3339Nano, value)
+	return last, err == nil
+}
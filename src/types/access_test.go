@@ -0,0 +1,114 @@
+package types
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// accessTree holds nodes "n0".."n<count-1>", with node i's metadata from
+// metadata[i] where there is one
+func accessTree(t *testing.T, count int, metadata map[int]map[string]string) *Tree {
+	t.Helper()
+	tree := NewTree()
+	for i := 0; i < count; i++ {
+		var key [512]float32
+		key[i%512] = 1
+		if err := tree.InsertWithMetadata(key, fmt.Sprintf("n%d", i), metadata[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tree
+}
+
+// hits returns each node's HitCountKey, by value, for nodes that have one
+func hits(tree *Tree) map[string]int {
+	counts := make(map[string]int)
+	for i := range tree.Nodes {
+		if n, err := strconv.Atoi(tree.Nodes[i].Metadata[HitCountKey]); err == nil {
+			counts[tree.Nodes[i].Value] = n
+		}
+	}
+	return counts
+}
+
+func values(tree *Tree) []string {
+	found := make([]string, len(tree.Nodes))
+	for i := range tree.Nodes {
+		found[i] = tree.Nodes[i].Value
+	}
+	return found
+}
+
+func TestRemapAccessAcrossDeletes(t *testing.T) {
+	tree := accessTree(t, 6, nil)
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tree.RecordAccess([]ScoredNode{{index: 1}, {index: 3}, {index: 5}}, at)
+	tree.RecordAccess([]ScoredNode{{index: 3}, {index: 5}}, at.Add(time.Minute))
+
+	// n3's hits go with it; n1 and n5 keep theirs at their new positions
+	deleted := tree.DeleteFunc(func(n *Node) bool { return n.Value == "n0" || n.Value == "n3" })
+	if deleted != 2 {
+		t.Fatalf("deleted %d nodes, want 2", deleted)
+	}
+	if pending := tree.PendingAccess(); pending != 2 {
+		t.Fatalf("%d nodes with pending hits after the delete, want 2", pending)
+	}
+
+	// A second delete remaps positions that already moved once
+	tree.DeleteFunc(func(n *Node) bool { return n.Value == "n2" })
+	if got := values(tree); !slices.Equal(got, []string{"n1", "n4", "n5"}) {
+		t.Fatalf("nodes %v after the deletes", got)
+	}
+
+	if applied := tree.ApplyAccess(); applied != 2 {
+		t.Fatalf("applied hits to %d nodes, want 2", applied)
+	}
+	if got := hits(tree); len(got) != 2 || got["n1"] != 1 || got["n5"] != 2 {
+		t.Errorf("hit counts %v, want n1 1 and n5 2", got)
+	}
+	for i, want := range map[int]time.Time{0: at, 2: at.Add(time.Minute)} {
+		if last, ok := nodeLastAccessed(&tree.Nodes[i]); !ok || !last.Equal(want) {
+			t.Errorf("%s last accessed %v, want %v", tree.Nodes[i].Value, last, want)
+		}
+	}
+	if _, ok := tree.Nodes[1].Metadata[LastAccessedKey]; ok {
+		t.Errorf("n4 was never returned but has a last access: %v", tree.Nodes[1].Metadata)
+	}
+}
+
+func TestEvictLeastMatchedReadsAccess(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Hour)
+	stamp := func(last time.Time, hits int) map[string]string {
+		return map[string]string{LastAccessedKey: last.Format(time.RFC3339Nano), HitCountKey: strconv.Itoa(hits)}
+	}
+	// n0 was never accessed; n1 and n2 were last at the same time, so the
+	// one with fewer hits goes first; n3 has only hits not yet written;
+	// n4 has the most hits, but longest ago
+	tree := accessTree(t, 5, map[int]map[string]string{
+		1: stamp(t1, 5),
+		2: stamp(t1, 2),
+		4: stamp(t0, 9),
+	})
+	tree.RecordAccess([]ScoredNode{{index: 3}}, t1.Add(time.Hour))
+
+	for _, step := range []struct {
+		evict int
+		want  []string
+	}{
+		{1, []string{"n1", "n2", "n3", "n4"}},
+		{1, []string{"n1", "n2", "n3"}},
+		{1, []string{"n1", "n3"}},
+		{1, []string{"n3"}},
+	} {
+		if evicted := tree.Evict(step.evict, EvictLeastMatched); evicted != step.evict {
+			t.Fatalf("evicted %d nodes, want %d", evicted, step.evict)
+		}
+		if got := values(tree); !slices.Equal(got, step.want) {
+			t.Fatalf("kept %v, want %v", got, step.want)
+		}
+	}
+}
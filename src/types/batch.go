@@ -0,0 +1,70 @@
+package types
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BatchSearch runs SearchWithOptions for every query on a pool of
+// GOMAXPROCS workers sharing the tree's index. Every query is checked
+// before any search starts; an error names the first bad query. Queries
+// have the width VectorDims reports and go through the tree's Projection.
+func (t *Tree) BatchSearch(queries [][]float32, epsilon float32, threshold float32, topK int, opts SearchOptions) ([][]ScoredNode, error) {
+	results, _, err := t.batchSearch(queries, epsilon, threshold, topK, opts)
+	return results, err
+}
+
+// BatchSearchTimed is BatchSearch that also reports how long each query took
+func (t *Tree) BatchSearchTimed(queries [][]float32, epsilon float32, threshold float32, topK int, opts SearchOptions) ([][]ScoredNode, []time.Duration, error) {
+	return t.batchSearch(queries, epsilon, threshold, topK, opts)
+}
+
+func (t *Tree) batchSearch(queries [][]float32, epsilon float32, threshold float32, topK int, opts SearchOptions) ([][]ScoredNode, []time.Duration, error) {
+	if err := opts.withParams(epsilon, threshold, topK).Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	keys := make([][512]float32, len(queries))
+	for i, q := range queries {
+		var err error
+		if keys[i], err = t.VectorKey(q); err != nil {
+			return nil, nil, fmt.Errorf("query %d: %w", i, err)
+		}
+		if keys[i], err = t.PrepareKey(keys[i]); err != nil {
+			return nil, nil, fmt.Errorf("query %d: %w", i, err)
+		}
+	}
+
+	// Build the index once up front: searches only read it, so the
+	// workers can share it without locking
+	t.ensureIndex()
+
+	results := make([][]ScoredNode, len(queries))
+	durations := make([]time.Duration, len(queries))
+
+	workers := min(runtime.GOMAXPROCS(0), len(queries))
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1) - 1)
+				if i >= len(keys) {
+					return
+				}
+				start := time.Now()
+				// opts was validated above, so this cannot fail
+				results[i], _ = t.SearchWithOptions(keys[i], epsilon, threshold, topK, opts)
+				durations[i] = time.Since(start)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return results, durations, nil
+}
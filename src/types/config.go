@@ -0,0 +1,78 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MetricEuclidean is the distance searches rank by; Similarity converts it
+// to cosine for normalized keys
+const MetricEuclidean = "euclidean"
+
+// Config records how a database's vectors were made so that vectors from a
+// different model are not mixed in unnoticed. It is written once, by the
+// first insert into an empty tree, and persisted in the file header. Empty
+// fields mean unknown: databases written before the header existed have no
+// Config at all, and vectors inserted precomputed leave the model unknown.
+type Config struct {
+	Provider  string    `json:"provider,omitempty"` // e.g. "titan", "ollama"
+	Model     string    `json:"model,omitempty"`    // e.g. "amazon.titan-embed-text-v2:0"
+	Metric    string    `json:"metric,omitempty"`
+	Normalize *bool     `json:"normalize,omitempty"`
+	Created   time.Time `json:"created,omitzero"`
+
+	// Retention, unlike the rest, can be changed after creation, by
+	// replacing the Config (see Client.SetRetention)
+	Retention *Retention `json:"retention,omitempty"`
+}
+
+// NewConfig describes a tree created now with vectors from the embedding
+// provider whose Name is providerName, e.g. "titan amazon.titan-embed-text-v2:0";
+// an empty name leaves the provider and model unknown
+func NewConfig(providerName string, normalize bool) *Config {
+	provider, model, _ := strings.Cut(providerName, " ")
+	return &Config{
+		Provider:  provider,
+		Model:     model,
+		Metric:    MetricEuclidean,
+		Normalize: &normalize,
+		Created:   time.Now().UTC(),
+	}
+}
+
+// ConfigMismatchError is an embedding provider that differs from the one a
+// database was created with
+type ConfigMismatchError struct {
+	Recorded string // provider and model from the Config
+	Active   string
+}
+
+func (e *ConfigMismatchError) Error() string {
+	return fmt.Sprintf("database was created with %s but the active embedder is %s; its vectors are not comparable", e.Recorded, e.Active)
+}
+
+// Check returns a *ConfigMismatchError if providerName names a different
+// provider or model than the recorded one. Anything unknown, on either
+// side, matches.
+func (c *Config) Check(providerName string) error {
+	if c == nil || providerName == "" {
+		return nil
+	}
+	provider, model, _ := strings.Cut(providerName, " ")
+	if (c.Provider != "" && c.Provider != provider) || (c.Model != "" && model != "" && c.Model != model) {
+		return &ConfigMismatchError{Recorded: c.String(), Active: providerName}
+	}
+	return nil
+}
+
+// String is the provider and model, as an embedding provider's Name reports them
+func (c *Config) String() string {
+	if c == nil || c.Provider == "" {
+		return "unknown"
+	}
+	if c.Model == "" {
+		return c.Provider
+	}
+	return c.Provider + " " + c.Model
+}
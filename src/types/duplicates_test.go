@@ -0,0 +1,120 @@
+package types
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"testing"
+)
+
+// duplicateTree holds copies of one key, inserted one at a time so the
+// index is extended incrementally, then one node just off it
+func duplicateTree(t *testing.T, copies int) (*Tree, [512]float32, [512]float32) {
+	t.Helper()
+	var same, near [512]float32
+	for d := range same {
+		same[d] = float32(d%7) * 0.1
+	}
+	near = same
+	near[3] += 0.01
+
+	tree := NewTree()
+	tree.RebuildIndex()
+	for i := 0; i < copies; i++ {
+		if err := tree.Insert(same, fmt.Sprintf("copy %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tree.Insert(near, "near"); err != nil {
+		t.Fatal(err)
+	}
+	return tree, same, near
+}
+
+func TestSearchManyDuplicateKeys(t *testing.T) {
+	tree, same, near := duplicateTree(t, 10000)
+	checkIncrementalIndex(t, tree)
+
+	// Equal distances are broken by position, so the result is the first
+	// copies and the same every time
+	for run := 0; run < 3; run++ {
+		results, _, err := tree.SearchOpts(same, SearchOptions{Epsilon: 0.05, MaxDistance: 0.05, TopK: 5})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, r := range results {
+			if r.Node.Value != fmt.Sprintf("copy %d", i) || r.Distance != 0 {
+				t.Fatalf("run %d: result %d is %s at %g, want copy %d at 0", run, i, r.Node.Value, r.Distance, i)
+			}
+		}
+		if len(results) != 5 {
+			t.Fatalf("run %d: %d results, want 5", run, len(results))
+		}
+	}
+
+	results, _, err := tree.SearchOpts(near, SearchOptions{Epsilon: 0.05, MaxDistance: 0.05, TopK: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || results[0].Node.Value != "near" || results[1].Node.Value != "copy 0" {
+		t.Errorf("query at the odd node out found %v first", results)
+	}
+
+	if dups, largest := tree.CountDuplicateKeys(); dups != 9999 || largest != 10000 {
+		t.Errorf("CountDuplicateKeys() = %d, %d; want 9999, 10000", dups, largest)
+	}
+	if stats := tree.ComputeStats(100); stats.Duplicates != 9999 {
+		t.Errorf("stats report %d duplicates", stats.Duplicates)
+	}
+}
+
+func TestZeroVectorPolicies(t *testing.T) {
+	var zero, unit [512]float32
+	unit[0] = 1
+
+	rejecting := NewTree()
+	rejecting.ZeroVectors = ZeroVectorReject
+	if _, err := rejecting.PrepareInsertKey(zero); !errors.Is(err, ErrZeroVector) {
+		t.Errorf("reject policy: %v, want ErrZeroVector", err)
+	}
+	if _, err := rejecting.PrepareInsertKey(unit); err != nil {
+		t.Errorf("reject policy refused a non-zero key: %v", err)
+	}
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	warning := NewTree()
+	warning.ZeroVectors = ZeroVectorWarn
+	if err := warning.Insert(zero, "blank"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logged.String(), "all-zero key") {
+		t.Errorf("warn policy logged %q", logged.String())
+	}
+
+	// A normalized tree keeps a zero key as it is; searching it or with it
+	// must not produce NaN distances
+	normalized := NewTree()
+	normalized.Normalize = true
+	for _, key := range [][512]float32{zero, unit} {
+		if err := normalized.Insert(key, fmt.Sprint(key[0])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, query := range [][512]float32{zero, unit} {
+		results, _, err := normalized.SearchOpts(query, SearchOptions{Epsilon: 2, MaxDistance: 2, TopK: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range results {
+			if math.IsNaN(float64(r.Distance)) {
+				t.Errorf("query %v: %s at NaN", query[0], r.Node.Value)
+			}
+		}
+	}
+}
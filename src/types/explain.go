@@ -0,0 +1,84 @@
+package types
+
+// ExplainReport says how a search got from the whole tree to its results,
+// for working out why it returned what it did. Counts are of keys, so a
+// multi-vector search counts a node once per key it matched through.
+type ExplainReport struct {
+	Vectors     int     `json:"vectors"` // keys in the index
+	Epsilon     float32 `json:"epsilon"`
+	MaxDistance float32 `json:"max_distance"`
+
+	// MinDimMatches is how many of the ranges below a candidate had to be
+	// inside, all of them unless SearchOptions.MinDimMatches lowered it
+	MinDimMatches int `json:"min_dim_matches"`
+
+	// Dimensions lists the keys inside each dimension's epsilon range,
+	// narrowest first, the order they are intersected in. Dimensions a
+	// weight of 0 or a mask removes are left out.
+	Dimensions []DimensionCandidates `json:"dimensions"`
+
+	// Intersected is how many of those ranges were intersected by walking
+	// the index before checking the survivors key by key was cheaper
+	Intersected int `json:"intersected"`
+
+	InBox       int  `json:"in_box"`       // inside MinDimMatches of the dimensions' ranges
+	Filtered    int  `json:"filtered"`     // in the box but not matching the filter
+	Prefiltered int  `json:"prefiltered"`  // of the rest, those the norm pre-filter rules out; scored anyway while explaining
+	Scored      int  `json:"scored"`       // distances computed
+	OutOfRange  int  `json:"out_of_range"` // scored but farther than MaxDistance
+	WithinRange int  `json:"within_range"` // scored and within MaxDistance, before topK and re-ranking
+	Returned    int  `json:"returned"`
+	Truncated   bool `json:"truncated,omitempty"` // MaxCandidates or the deadline stopped the scoring
+
+	// BestRejected is the closest node the distance cutoff dropped, nil
+	// when it dropped none. Nodes outside the box are never scored, so one
+	// of them may be closer still.
+	BestRejected *RejectedCandidate `json:"best_rejected,omitempty"`
+}
+
+// DimensionCandidates is how many keys fell inside one dimension's range
+type DimensionCandidates struct {
+	Dim        int `json:"dim"`
+	Candidates int `json:"candidates"`
+}
+
+// RejectedCandidate is a node a search scored but did not keep
+type RejectedCandidate struct {
+	Value      string            `json:"value"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	Distance   float32           `json:"distance"`
+	Similarity float32           `json:"similarity"`
+}
+
+// Explain runs the search opts describes and reports how it chose its
+// candidates along with the results, which are the same as SearchOpts
+// returns. It fills opts.Explanation; a caller after scores as well can
+// set that and call SearchOpts itself.
+func (t *Tree) Explain(query [512]float32, opts SearchOptions) (ExplainReport, []Node, error) {
+	var report ExplainReport
+	opts.Explanation = &report
+	scored, _, err := t.SearchOpts(query, opts)
+	if err != nil {
+		return report, nil, err
+	}
+
+	nodes := make([]Node, len(scored))
+	for i := range scored {
+		nodes[i] = scored[i].Node
+	}
+	return report, nodes, nil
+}
+
+// reject records a node the distance cutoff dropped, keeping the closest
+func (r *ExplainReport) reject(n *Node, distance float32) {
+	r.OutOfRange++
+	if r.BestRejected != nil && r.BestRejected.Distance <= distance {
+		return
+	}
+	r.BestRejected = &RejectedCandidate{
+		Value:      n.Value,
+		Metadata:   n.Metadata,
+		Distance:   distance,
+		Similarity: Similarity(distance),
+	}
+}
@@ -0,0 +1,222 @@
+package types
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimestampKey is the metadata key holding when a memory happened, as
+// RFC 3339. Filter.Since and Filter.Until compare against it.
+const TimestampKey = "timestamp"
+
+// WithTimestamp returns a copy of metadata with TimestampKey set to ts in
+// UTC, the form Filter.Since and Until parse
+func WithTimestamp(metadata map[string]string, ts time.Time) map[string]string {
+	stamped := make(map[string]string, len(metadata)+1)
+	for k, v := range metadata {
+		stamped[k] = v
+	}
+	stamped[TimestampKey] = ts.UTC().Format(time.RFC3339Nano)
+	return stamped
+}
+
+// StampTimestamp is WithTimestamp for an insert: a zero ts means now,
+// unless metadata already has a TimestampKey, in which case metadata is
+// returned as it is. Every memory inserted through it can be found by time.
+func StampTimestamp(metadata map[string]string, ts time.Time) map[string]string {
+	if ts.IsZero() {
+		if _, ok := metadata[TimestampKey]; ok {
+			return metadata
+		}
+		ts = time.Now()
+	}
+	return WithTimestamp(metadata, ts)
+}
+
+// NoneGroup is the GroupCount bucket for nodes without the group-by key
+const NoneGroup = "(none)"
+
+// Filter restricts queries to nodes whose metadata matches every entry and,
+// when Since or Until is set, whose TimestampKey falls in [Since, Until].
+// Nodes without a parseable timestamp never match a time range. A nil
+// Filter matches everything. Metadata keys may be dotted paths into JSON
+// values (see MetadataValue).
+type Filter struct {
+	Metadata map[string]string
+	Since    time.Time
+	Until    time.Time
+}
+
+func (f *Filter) Matches(n *Node) bool {
+	return f.MatchesSchema(n, nil)
+}
+
+// MatchesSchema is Matches comparing the fields schema declares by value
+// rather than as strings (see Schema); a nil schema is Matches
+func (f *Filter) MatchesSchema(n *Node, schema *Schema) bool {
+	if f == nil {
+		return true
+	}
+	for k, v := range f.Metadata {
+		if got, ok := MetadataValue(n.Metadata, k); !ok || !schema.equal(k, got, v) {
+			return false
+		}
+	}
+
+	if f.Since.IsZero() && f.Until.IsZero() {
+		return true
+	}
+	ts, err := time.Parse(time.RFC3339Nano, n.Metadata[TimestampKey])
+	if err != nil {
+		return false
+	}
+	return !ts.Before(f.Since) && (f.Until.IsZero() || !ts.After(f.Until))
+}
+
+// FilterFromJSON builds a metadata filter from a decoded JSON object. String
+// values are kept as they are and anything else is JSON-encoded, the way
+// JSON metadata is stored, so {"importance": 3} matches a node inserted with
+// the same metadata.
+func FilterFromJSON(raw map[string]any) (*Filter, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	metadata := make(map[string]string, len(raw))
+	for k, v := range raw {
+		if s, ok := v.(string); ok {
+			metadata[k] = s
+			continue
+		}
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		metadata[k] = string(encoded)
+	}
+	return &Filter{Metadata: metadata}, nil
+}
+
+// MetadataValue returns the value at path. A path is a metadata key or,
+// when no key matches it whole, a key followed by dot-separated steps into
+// the JSON object or array stored under it: "user.tier" reads the tier of
+// {"tier":"pro"} stored as user, "tags.0" the first element of a list.
+// Strings come back as they are and other values JSON-encoded. A missing
+// key or step, a bad index, or a step into a string or number is not found.
+func MetadataValue(metadata map[string]string, path string) (string, bool) {
+	if v, ok := metadata[path]; ok {
+		return v, true
+	}
+
+	// Keys may themselves contain dots, so try the longest key first
+	for end := strings.LastIndexByte(path, '.'); end > 0; end = strings.LastIndexByte(path[:end], '.') {
+		raw, ok := metadata[path[:end]]
+		if !ok {
+			continue
+		}
+		dec := json.NewDecoder(strings.NewReader(raw))
+		dec.UseNumber()
+		var v any
+		if err := dec.Decode(&v); err != nil {
+			return "", false
+		}
+		return jsonPath(v, strings.Split(path[end+1:], "."))
+	}
+	return "", false
+}
+
+func jsonPath(v any, steps []string) (string, bool) {
+	for _, step := range steps {
+		switch value := v.(type) {
+		case map[string]any:
+			var ok bool
+			if v, ok = value[step]; !ok {
+				return "", false
+			}
+		case []any:
+			i, err := strconv.Atoi(step)
+			if err != nil || i < 0 || i >= len(value) {
+				return "", false
+			}
+			v = value[i]
+		default:
+			return "", false
+		}
+	}
+
+	switch value := v.(type) {
+	case string:
+		return value, true
+	case json.Number:
+		return value.String(), true
+	}
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return "", false
+	}
+	return string(encoded), true
+}
+
+// GroupKey returns the node's value for metaKey (or a dotted path, see
+// MetadataValue), or NoneGroup if it is missing
+func GroupKey(n *Node, metaKey string) string {
+	if v, ok := MetadataValue(n.Metadata, metaKey); ok {
+		return v
+	}
+	return NoneGroup
+}
+
+func (t *Tree) CountWithFilter(filter *Filter) int {
+	count := 0
+	for i := range t.Nodes {
+		if filter.MatchesSchema(&t.Nodes[i], t.Schema) {
+			count++
+		}
+	}
+	return count
+}
+
+// GroupCount counts matching nodes per value of metaKey
+func (t *Tree) GroupCount(metaKey string, filter *Filter) map[string]int {
+	groups := make(map[string]int)
+	for i := range t.Nodes {
+		if filter.MatchesSchema(&t.Nodes[i], t.Schema) {
+			groups[GroupKey(&t.Nodes[i], metaKey)]++
+		}
+	}
+	return groups
+}
+
+// DeleteWhere removes every node matching filter (all of them for a nil
+// filter) and returns how many were removed. Survivors are copied into a
+// new slice rather than compacted in place, so a snapshot being flushed in
+// the background keeps the nodes it saw. The indices are rebuilt on the
+// next search.
+func (t *Tree) DeleteWhere(filter *Filter) int {
+	return t.DeleteFunc(func(n *Node) bool { return filter.MatchesSchema(n, t.Schema) })
+}
+
+// DeleteFunc is DeleteWhere for the nodes match returns true for, for
+// conditions a Filter can't express
+func (t *Tree) DeleteFunc(match func(n *Node) bool) int {
+	kept := make([]Node, 0, len(t.Nodes))
+	survived := make([]bool, len(t.Nodes))
+	for i := range t.Nodes {
+		if !match(&t.Nodes[i]) {
+			kept = append(kept, t.Nodes[i])
+			survived[i] = true
+		}
+	}
+
+	deleted := len(t.Nodes) - len(kept)
+	if deleted == 0 {
+		return 0
+	}
+
+	t.remapAccess(survived)
+	t.Nodes = kept
+	t.indexBuilt = false
+	t.keywords = nil
+	return deleted
+}
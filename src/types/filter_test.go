@@ -0,0 +1,172 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestInsertWithTimestampFiltersByTime(t *testing.T) {
+	tree := NewTree()
+	var key [512]float32
+	key[0] = 1
+
+	days := map[string]time.Time{
+		"new year": time.Date(2023, 1, 1, 9, 0, 0, 0, time.UTC),
+		"easter":   time.Date(2023, 4, 9, 12, 0, 0, 0, time.FixedZone("NZST", 12*3600)),
+		"solstice": time.Date(2023, 6, 21, 0, 0, 0, 0, time.UTC),
+	}
+	metadata := map[string]string{"source": "chat"}
+	for value, ts := range days {
+		if err := tree.InsertWithTimestamp(key, value, metadata, ts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := time.Now()
+	if err := tree.InsertWithTimestamp(key, "today", metadata, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(metadata) != 1 {
+		t.Fatalf("caller's metadata was modified: %v", metadata)
+	}
+
+	search := func(since, until time.Time) map[string]bool {
+		t.Helper()
+		opts := SearchOptions{Epsilon: 1, MaxDistance: 1, TopK: 10, Filter: &Filter{Since: since, Until: until}}
+		results, _, err := tree.SearchOpts(key, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := make(map[string]bool)
+		for _, r := range results {
+			found[r.Node.Value] = true
+			if r.Node.Metadata["source"] != "chat" {
+				t.Errorf("%s lost its metadata: %v", r.Node.Value, r.Node.Metadata)
+			}
+		}
+		return found
+	}
+
+	// Easter at noon in Auckland is midnight UTC, so the bounds are inclusive
+	spring := search(days["easter"], time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC))
+	if len(spring) != 1 || !spring["easter"] {
+		t.Errorf("April-May 2023 found %v, want only easter", spring)
+	}
+	year := search(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC))
+	if len(year) != 3 || year["today"] {
+		t.Errorf("2023 found %v, want the three historical nodes", year)
+	}
+
+	// A zero timestamp means now
+	if recent := search(before.Add(-time.Second), time.Time{}); len(recent) != 1 || !recent["today"] {
+		t.Errorf("since the last insert found %v, want only today", recent)
+	}
+}
+
+func TestMetadataValueNestedPaths(t *testing.T) {
+	metadata := map[string]string{
+		"user":     `{"id": "u1", "tier": "pro", "org": {"name": "acme", "plan": {"seats": 25, "trial": false}}}`,
+		"tags":     `["alpha", "beta", {"name": "gamma"}]`,
+		"title":    "plain string",
+		"count":    "7",
+		"file.ext": "md",
+		"file":     `{"ext": "txt"}`,
+		"broken":   `{"a":`,
+	}
+
+	cases := []struct {
+		path  string
+		want  string
+		found bool
+	}{
+		{"user.tier", "pro", true},
+		{"user.org.name", "acme", true},
+		{"user.org.plan.seats", "25", true},
+		{"user.org.plan.trial", "false", true},
+		{"user.org.plan", `{"seats":25,"trial":false}`, true},
+		{"tags.0", "alpha", true},
+		{"tags.1", "beta", true},
+		{"tags.2.name", "gamma", true},
+		{"tags.3", "", false},
+		{"tags.-1", "", false},
+		{"tags.first", "", false},
+		// A whole key wins over a path through a shorter one
+		{"file.ext", "md", true},
+		{"title", "plain string", true},
+		// Missing intermediate keys and steps into scalars are not found
+		{"user.missing.name", "", false},
+		{"user.tier.level", "", false},
+		{"user.org.plan.seats.value", "", false},
+		{"tags.0.name", "", false},
+		{"title.length", "", false},
+		{"count.0", "", false},
+		{"nobody.tier", "", false},
+		{"broken.a", "", false},
+		{"user.", "", false},
+	}
+	for _, tc := range cases {
+		got, found := MetadataValue(metadata, tc.path)
+		if got != tc.want || found != tc.found {
+			t.Errorf("%s = %q, %v; want %q, %v", tc.path, got, found, tc.want, tc.found)
+		}
+	}
+}
+
+func TestFilterNestedPaths(t *testing.T) {
+	tree := NewTree()
+	var key [512]float32
+	key[0] = 1
+	users := map[string]string{
+		"pro":   `{"tier": "pro", "org": {"region": {"code": "nz"}}, "tags": ["admin"]}`,
+		"free":  `{"tier": "free", "org": {"region": {"code": "au"}}, "tags": []}`,
+		"plain": `"not an object"`,
+	}
+	for value, user := range users {
+		if err := tree.InsertWithMetadata(key, value, map[string]string{"user": user}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tree.Insert(key, "none"); err != nil {
+		t.Fatal(err)
+	}
+
+	// As the servers decode request bodies
+	matching := func(body string) []string {
+		t.Helper()
+		var raw map[string]any
+		if err := json.Unmarshal([]byte(body), &raw); err != nil {
+			t.Fatal(err)
+		}
+		filter, err := FilterFromJSON(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var found []string
+		for i := range tree.Nodes {
+			if filter.Matches(&tree.Nodes[i]) {
+				found = append(found, tree.Nodes[i].Value)
+			}
+		}
+		return found
+	}
+
+	cases := map[string]string{
+		`{"user.tier": "pro"}`:                         "pro",
+		`{"user.org.region.code": "au"}`:               "free",
+		`{"user.tags.0": "admin"}`:                     "pro",
+		`{"user.tier": "pro", "user.tags.0": "admin"}`: "pro",
+		`{"user.tier.name": "pro"}`:                    "",
+		`{"user.org.region.code.x": "nz"}`:             "",
+		`{"user.tier": "enterprise"}`:                  "",
+	}
+	for body, want := range cases {
+		got := matching(body)
+		if (want == "" && len(got) != 0) || (want != "" && (len(got) != 1 || got[0] != want)) {
+			t.Errorf("%s matched %v, want %q", body, got, want)
+		}
+	}
+
+	if groups := tree.GroupCount("user.org.region.code", nil); groups["nz"] != 1 || groups["au"] != 1 || groups[NoneGroup] != 2 {
+		t.Errorf("grouped by a nested path: %v", groups)
+	}
+}
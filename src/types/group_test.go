@@ -0,0 +1,198 @@
+package types
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"testing"
+)
+
+// chunkedDocs inserts one document per chunks entry, with that many chunks
+// tagged with doc_id whose keys scatter by spread around a random centre
+// per document, and returns the centres
+func chunkedDocs(t *testing.T, tree *Tree, rng *rand.Rand, chunks []int, spread float64) [][512]float32 {
+	t.Helper()
+	centres := make([][512]float32, len(chunks))
+	for d, n := range chunks {
+		for dim := range centres[d] {
+			centres[d][dim] = float32(rng.NormFloat64())
+		}
+		docID := fmt.Sprintf("doc%d", d)
+		for c := 0; c < n; c++ {
+			key := centres[d]
+			for dim := range key {
+				key[dim] += float32(rng.NormFloat64() * spread)
+			}
+			metadata := map[string]string{"doc_id": docID, "chunk": fmt.Sprint(c)}
+			if err := tree.InsertWithMetadata(key, fmt.Sprintf("%s chunk %d", docID, c), metadata); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return centres
+}
+
+// bestDocs returns the doc_ids in order of their closest chunk to query,
+// by brute force
+func bestDocs(tree *Tree, query [512]float32) []string {
+	best := make(map[string]float32)
+	for i := range tree.Nodes {
+		doc := tree.Nodes[i].Metadata["doc_id"]
+		d := squaredDistance(&query, &tree.Nodes[i].Key)
+		if prev, ok := best[doc]; !ok || d < prev {
+			best[doc] = d
+		}
+	}
+	docs := make([]string, 0, len(best))
+	for doc := range best {
+		docs = append(docs, doc)
+	}
+	sort.Slice(docs, func(i, j int) bool { return best[docs[i]] < best[docs[j]] })
+	return docs
+}
+
+func squaredDistance(a, b *[512]float32) float32 {
+	var sum float32
+	for i := range a {
+		d := a[i] - b[i]
+		sum += d * d
+	}
+	return sum
+}
+
+var groupOpts = SearchOptions{Epsilon: 100, MaxDistance: 1000, TopK: 5}
+
+func TestGroupByOneChunkPerDoc(t *testing.T) {
+	rng := rand.New(rand.NewPCG(11, 11))
+	tree := NewTree()
+	chunks := make([]int, 20)
+	for d := range chunks {
+		chunks[d] = 5
+	}
+	centres := chunkedDocs(t, tree, rng, chunks, 0.1)
+	query := centres[0]
+
+	// Ungrouped, doc0's five chunks take every slot
+	plain, _, err := tree.SearchOpts(query, groupOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hit := range plain {
+		if hit.Node.Metadata["doc_id"] != "doc0" || hit.Group != "" || hit.Collapsed != 0 {
+			t.Fatalf("ungrouped search returned %s (group %q, collapsed %d)", hit.Node.Value, hit.Group, hit.Collapsed)
+		}
+	}
+
+	opts := groupOpts
+	opts.GroupBy = "doc_id"
+	grouped, _, err := tree.SearchOpts(query, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var groups []string
+	for _, hit := range grouped {
+		if hit.Group != hit.Node.Metadata["doc_id"] {
+			t.Errorf("%s reports group %q", hit.Node.Value, hit.Group)
+		}
+		groups = append(groups, hit.Group)
+	}
+	if want := bestDocs(tree, query)[:5]; !slices.Equal(groups, want) {
+		t.Errorf("grouped results %v, want the best chunk of %v", groups, want)
+	}
+	if grouped[0].Node.Value != plain[0].Node.Value || grouped[0].Collapsed != 4 {
+		t.Errorf("top group is %s with %d collapsed, want %s standing for its 4 siblings",
+			grouped[0].Node.Value, grouped[0].Collapsed, plain[0].Node.Value)
+	}
+}
+
+// One document with far more chunks than the first fetch holds makes the
+// search fetch again until topK documents are found
+func TestGroupByOverSamples(t *testing.T) {
+	rng := rand.New(rand.NewPCG(12, 12))
+	tree := NewTree()
+	centres := chunkedDocs(t, tree, rng, []int{60, 5, 5, 5, 5, 5, 5, 5}, 0.01)
+
+	opts := groupOpts
+	opts.GroupBy = "doc_id"
+	grouped, _, err := tree.SearchOpts(centres[0], opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(grouped) != 5 {
+		t.Fatalf("returned %d groups, want 5", len(grouped))
+	}
+	if grouped[0].Group != "doc0" || grouped[0].Collapsed != 59 {
+		t.Errorf("top group %s with %d collapsed, want doc0 with 59", grouped[0].Group, grouped[0].Collapsed)
+	}
+	seen := make(map[string]bool)
+	for _, hit := range grouped {
+		if seen[hit.Group] {
+			t.Errorf("group %s returned twice", hit.Group)
+		}
+		seen[hit.Group] = true
+	}
+
+	// Fewer groups than topK returns them all rather than looping
+	opts.TopK = 20
+	all, _, err := tree.SearchOpts(centres[0], opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collapsed := 0
+	for _, hit := range all {
+		collapsed += hit.Collapsed
+	}
+	if len(all) != 8 || len(all)+collapsed != len(tree.Nodes) {
+		t.Errorf("topK 20 over 8 docs returned %d groups standing for %d nodes, want 8 for %d",
+			len(all), len(all)+collapsed, len(tree.Nodes))
+	}
+}
+
+// Nodes without the key are kept one by one, and a filter applies before
+// grouping
+func TestGroupByMissingKeyAndFilter(t *testing.T) {
+	rng := rand.New(rand.NewPCG(13, 13))
+	tree := NewTree()
+	centres := chunkedDocs(t, tree, rng, []int{5, 5, 5}, 0.1)
+	for i := 0; i < 3; i++ {
+		key := centres[0]
+		key[i] += 0.01
+		if err := tree.Insert(key, fmt.Sprintf("loose %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opts := groupOpts
+	opts.GroupBy = "doc_id"
+	results, _, err := tree.SearchOpts(centres[0], opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loose := 0
+	for _, hit := range results {
+		if hit.Group == "" {
+			loose++
+			if hit.Collapsed != 0 {
+				t.Errorf("%s collapsed %d nodes without a group", hit.Node.Value, hit.Collapsed)
+			}
+		}
+	}
+	if loose != 3 {
+		t.Errorf("%d ungrouped nodes returned, want all 3", loose)
+	}
+
+	opts.Filter = &Filter{Metadata: map[string]string{"chunk": "3"}}
+	filtered, _, err := tree.SearchOpts(centres[0], opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filtered) != 3 {
+		t.Fatalf("filtered grouping returned %d results, want one per doc", len(filtered))
+	}
+	for _, hit := range filtered {
+		if hit.Node.Metadata["chunk"] != "3" || hit.Collapsed != 0 {
+			t.Errorf("filtered grouping returned %s with %d collapsed", hit.Node.Value, hit.Collapsed)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package types
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// hintSample bounds how many nodes SearchHint measures exactly, so a hint
+// costs about as much as a search on a large tree
+const hintSample = 10000
+
+// SearchHint explains why a search found nothing, from the node nearest
+// the query: how far it is, and whether the epsilon box or the distance
+// cutoff left it out. Distances are plain Euclidean, whatever weights or
+// mask the search used.
+type SearchHint struct {
+	NearestDistance float32 `json:"nearest_distance"`
+	NearestEpsilon  float32 `json:"nearest_epsilon"` // the smallest epsilon whose box holds the nearest node (see BoxDistance), in MinDimMatches dimensions if set
+	Epsilon         float32 `json:"epsilon"`
+	MaxDistance     float32 `json:"max_distance"`        // the search's distance cutoff
+	Radius          string  `json:"radius,omitempty"`    // the narrowest radius word wide enough, if any is
+	MinScore        float32 `json:"min_score,omitempty"` // a cutoff the nearest node passes, when the cutoff was the problem
+
+	// Sampled is how many nodes were measured. Fewer than the tree holds
+	// means a closer node may have been missed.
+	Sampled int `json:"sampled"`
+
+	Message string `json:"message"`
+}
+
+// SearchHint finds the node nearest query among up to hintSample nodes
+// matching opts.Filter and says what about opts kept it out of the results.
+// query must be prepared like a search's (see PrepareKey). It returns nil
+// when no node matches, so there is nothing to suggest. It measures every
+// sampled node, so call it only after a search came back empty.
+func (t *Tree) SearchHint(query [512]float32, opts SearchOptions) *SearchHint {
+	if t.Normalize {
+		NormalizeVector(&query)
+	}
+
+	hint := &SearchHint{
+		Epsilon:     opts.Epsilon,
+		MaxDistance: opts.maxDistance(opts.Epsilon, opts.Threshold, t.Normalize),
+	}
+	var nearest *Node
+	sample := SampleIndices(len(t.Nodes), hintSample)
+	for _, i := range sample {
+		n := &t.Nodes[i]
+		if !opts.Filter.MatchesSchema(n, t.Schema) {
+			continue
+		}
+		hint.Sampled++
+		var sumSquares float32
+		for dim := 0; dim < 512; dim++ {
+			diff := query[dim] - n.Key[dim]
+			sumSquares += diff * diff
+		}
+		distance := float32(math.Sqrt(float64(sumSquares)))
+		if nearest == nil || distance < hint.NearestDistance {
+			nearest, hint.NearestDistance = n, distance
+		}
+	}
+	if nearest == nil {
+		return nil
+	}
+	hint.NearestEpsilon = matchEpsilon(&query, &nearest.Key, opts.MinDimMatches)
+
+	var advice []string
+	epsilon := opts.Epsilon
+	if hint.NearestEpsilon > epsilon {
+		epsilon = hint.NearestEpsilon
+		hint.Radius = t.narrowestRadius(hint.NearestEpsilon)
+		if hint.Radius != "" {
+			epsilon, _ = t.GetRadiusValue(hint.Radius)
+			advice = append(advice, fmt.Sprintf("your epsilon was %.2f, try radius '%s'", opts.Epsilon, hint.Radius))
+		} else {
+			advice = append(advice, fmt.Sprintf("your epsilon was %.2f, try epsilon %.2f", opts.Epsilon, roundUp(hint.NearestEpsilon)))
+		}
+	}
+	// The legacy cutoff grows with epsilon, so judge it at the epsilon
+	// just suggested
+	if cutoff := opts.maxDistance(epsilon, opts.Threshold, t.Normalize); hint.NearestDistance > cutoff {
+		hint.MinScore = float32(math.Floor(float64(Similarity(hint.NearestDistance))*100) / 100)
+		advice = append(advice, fmt.Sprintf("your cutoff was %.2f, try min_score %.2f", cutoff, hint.MinScore))
+	}
+	if len(advice) == 0 {
+		advice = append(advice, "it is inside the epsilon box and the cutoff, so the offset or the dimension weights dropped it")
+	}
+
+	hint.Message = fmt.Sprintf("nearest node is at distance %.2f (needs epsilon %.2f); %s",
+		hint.NearestDistance, hint.NearestEpsilon, strings.Join(advice, "; "))
+	if len(sample) < len(t.Nodes) {
+		hint.Message += fmt.Sprintf(" (nearest of %d sampled nodes)", hint.Sampled)
+	}
+	return hint
+}
+
+// narrowestRadius is the radius word with the smallest epsilon of at least
+// epsilon, "" when none is that wide
+func (t *Tree) narrowestRadius(epsilon float32) string {
+	table := t.RadiusTable()
+	words := make([]string, 0, len(table))
+	for word, e := range table {
+		if e >= epsilon {
+			words = append(words, word)
+		}
+	}
+	if len(words) == 0 {
+		return ""
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if table[words[i]] != table[words[j]] {
+			return table[words[i]] < table[words[j]]
+		}
+		return words[i] < words[j]
+	})
+	return words[0]
+}
+
+// matchEpsilon is the smallest epsilon whose box around a holds b in at
+// least k dimensions, BoxDistance when k is 0 or all of them
+func matchEpsilon(a, b *[512]float32, k int) float32 {
+	if k <= 0 || k >= 512 {
+		return BoxDistance(a, b)
+	}
+	var diffs [512]float32
+	for dim := range diffs {
+		diffs[dim] = float32(math.Abs(float64(a[dim] - b[dim])))
+	}
+	slices.Sort(diffs[:])
+	return diffs[k-1]
+}
+
+// roundUp rounds up to two decimals, so a suggested epsilon is never just
+// short of the one needed
+func roundUp(x float32) float32 {
+	return float32(math.Ceil(float64(x)*100) / 100)
+}
@@ -0,0 +1,178 @@
+package types
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// BM25 parameters, the usual Lucene defaults
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+type posting struct {
+	node int32
+	freq int32
+}
+
+// keywordIndex is an inverted index over tokenized node values
+type keywordIndex struct {
+	postings map[string][]posting
+	docLen   []int32
+	totalLen int64
+}
+
+func newKeywordIndex() *keywordIndex {
+	return &keywordIndex{postings: make(map[string][]posting)}
+}
+
+func (k *keywordIndex) add(nodeIdx int32, value string) {
+	tokens := Tokenize(value)
+
+	freqs := make(map[string]int32, len(tokens))
+	for _, token := range tokens {
+		freqs[token]++
+	}
+	for token, freq := range freqs {
+		k.postings[token] = append(k.postings[token], posting{node: nodeIdx, freq: freq})
+	}
+
+	k.docLen = append(k.docLen, int32(len(tokens)))
+	k.totalLen += int64(len(tokens))
+}
+
+// score returns the BM25 score of every node matching at least one query token
+func (k *keywordIndex) score(query string) map[int32]float64 {
+	scores := make(map[int32]float64)
+	docCount := float64(len(k.docLen))
+	if docCount == 0 {
+		return scores
+	}
+	avgLen := float64(k.totalLen) / docCount
+
+	seen := make(map[string]bool)
+	for _, token := range Tokenize(query) {
+		if seen[token] {
+			continue
+		}
+		seen[token] = true
+
+		postings := k.postings[token]
+		if len(postings) == 0 {
+			continue
+		}
+
+		df := float64(len(postings))
+		idf := math.Log(1 + (docCount-df+0.5)/(df+0.5))
+
+		for _, p := range postings {
+			tf := float64(p.freq)
+			norm := 1 - bm25B
+			if avgLen > 0 {
+				norm += bm25B * float64(k.docLen[p.node]) / avgLen
+			}
+			scores[p.node] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+		}
+	}
+
+	return scores
+}
+
+// Tokenize lowercases text and splits it on anything that is not a letter or digit
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func (t *Tree) ensureKeywordIndex() {
+	if t.keywords != nil && len(t.keywords.docLen) == len(t.Nodes) {
+		return
+	}
+
+	t.keywords = newKeywordIndex()
+	for i := range t.Nodes {
+		t.keywords.add(int32(i), t.Nodes[i].Value)
+	}
+}
+
+// HybridResult is a hybrid search hit with its component scores
+type HybridResult struct {
+	Node       Node
+	Distance   float32
+	Similarity float32 // cosine similarity to the query vector
+	Keyword    float32 // BM25 score normalized to 0-1 across the result set
+	Score      float32
+}
+
+// HybridSearch ranks every node by alpha*vector similarity + (1-alpha)*keyword
+// score. alpha 1 is pure vector search, 0 is pure keyword search.
+func (t *Tree) HybridSearch(queryText string, queryVec [512]float32, alpha float32, topK int) []HybridResult {
+	if len(t.Nodes) == 0 {
+		return nil
+	}
+
+	t.ensureKeywordIndex()
+
+	if t.Normalize {
+		NormalizeVector(&queryVec)
+	}
+
+	keywordScores := t.keywords.score(queryText)
+	var maxKeyword float64
+	for _, s := range keywordScores {
+		if s > maxKeyword {
+			maxKeyword = s
+		}
+	}
+
+	var queryNorm float64
+	for dim := 0; dim < 512; dim++ {
+		queryNorm += float64(queryVec[dim]) * float64(queryVec[dim])
+	}
+	queryNorm = math.Sqrt(queryNorm)
+
+	results := make([]HybridResult, len(t.Nodes))
+	for i := range t.Nodes {
+		key := &t.Nodes[i].Key
+
+		var dot, keyNorm, sumSquares float64
+		for dim := 0; dim < 512; dim++ {
+			dot += float64(queryVec[dim]) * float64(key[dim])
+			keyNorm += float64(key[dim]) * float64(key[dim])
+			diff := float64(queryVec[dim] - key[dim])
+			sumSquares += diff * diff
+		}
+
+		var cosine float64
+		if queryNorm > 0 && keyNorm > 0 {
+			cosine = dot / (queryNorm * math.Sqrt(keyNorm))
+		}
+
+		var keyword float64
+		if maxKeyword > 0 {
+			keyword = keywordScores[int32(i)] / maxKeyword
+		}
+
+		results[i] = HybridResult{
+			Node:       t.Nodes[i],
+			Distance:   float32(math.Sqrt(sumSquares)),
+			Similarity: float32(cosine),
+			Keyword:    float32(keyword),
+			Score:      alpha*float32(cosine) + (1-alpha)*float32(keyword),
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	if len(results) > topK {
+		results = results[:topK]
+	}
+
+	return results
+}
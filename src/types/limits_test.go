@@ -0,0 +1,111 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"testing"
+	"time"
+)
+
+// uniformTree is the worst case for the epsilon box: n keys scattered
+// uniformly in a cube small enough that a box of 1 holds every one
+func uniformTree(t *testing.T, n int) (*Tree, [512]float32) {
+	t.Helper()
+	rng := rand.New(rand.NewPCG(11, 12))
+	tree := NewTree()
+	for i := 0; i < n; i++ {
+		var key [512]float32
+		for d := range key {
+			key[d] = rng.Float32()*0.02 - 0.01
+		}
+		if err := tree.Insert(key, fmt.Sprintf("node %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var query [512]float32
+	return tree, query
+}
+
+// checkWellFormed fails unless results are distinct nodes, closest first,
+// at their true distances
+func checkWellFormed(t *testing.T, query [512]float32, results []ScoredNode) {
+	t.Helper()
+	seen := make(map[string]bool)
+	for i, r := range results {
+		if seen[r.Node.Value] {
+			t.Errorf("%s returned twice", r.Node.Value)
+		}
+		seen[r.Node.Value] = true
+		if i > 0 && r.Distance < results[i-1].Distance {
+			t.Errorf("result %d at %g is closer than result %d at %g", i, r.Distance, i-1, results[i-1].Distance)
+		}
+		var sum float64
+		for d := range query {
+			diff := float64(query[d] - r.Node.Key[d])
+			sum += diff * diff
+		}
+		if got := math.Sqrt(sum); math.Abs(got-float64(r.Distance)) > 1e-5 {
+			t.Errorf("%s reported at %g, actually %g", r.Node.Value, r.Distance, got)
+		}
+	}
+}
+
+func TestSearchLimits(t *testing.T) {
+	tree, query := uniformTree(t, 3000)
+	base := SearchOptions{Epsilon: 1, MaxDistance: 10, TopK: 10}
+
+	results, truncated, err := tree.SearchOpts(query, base)
+	if err != nil || truncated || len(results) != 10 {
+		t.Fatalf("unlimited search: %d results, truncated %v, error %v", len(results), truncated, err)
+	}
+	checkWellFormed(t, query, results)
+
+	tests := []struct {
+		name   string
+		opts   func(*SearchOptions)
+		reason string
+	}{
+		{"candidates", func(o *SearchOptions) { o.MaxCandidates = 100 }, "100 candidates"},
+		{"deadline", func(o *SearchOptions) { o.Deadline = time.Now().Add(-time.Second) }, "deadline"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := base
+			tt.opts(&opts)
+
+			results, truncated, err := tree.SearchOpts(query, opts)
+			if err != nil || !truncated {
+				t.Fatalf("truncated %v, error %v; want the best found so far", truncated, err)
+			}
+			if len(results) > 10 {
+				t.Errorf("%d results past topK", len(results))
+			}
+			checkWellFormed(t, query, results)
+
+			opts.FailOnLimit = true
+			if _, truncated, err := tree.SearchOpts(query, opts); !truncated || !errors.Is(err, ErrSearchLimit) || !strings.Contains(err.Error(), tt.reason) {
+				t.Errorf("with FailOnLimit: truncated %v, error %v; want ErrSearchLimit naming %q", truncated, err, tt.reason)
+			}
+		})
+	}
+
+	// Only as many nodes as the limit are scored, so the truncated results
+	// are the best of those
+	opts := base
+	opts.MaxCandidates = 100
+	opts.TopK = 200
+	if results, _, _ := tree.SearchOpts(query, opts); len(results) != 100 {
+		t.Errorf("%d results from 100 scored candidates", len(results))
+	}
+
+	// A limit the search doesn't reach changes nothing
+	opts = base
+	opts.MaxCandidates = 3000
+	opts.Deadline = time.Now().Add(time.Minute)
+	if again, truncated, err := tree.SearchOpts(query, opts); err != nil || truncated || again[0].Node.Value != results[0].Node.Value {
+		t.Errorf("limits above the work: truncated %v, error %v", truncated, err)
+	}
+}
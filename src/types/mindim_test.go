@@ -0,0 +1,156 @@
+package types
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+// boxMatches lists the nodes inside the epsilon box around query in at
+// least minMatches dimensions, by brute force
+func boxMatches(tree *Tree, query [512]float32, epsilon float32, minMatches int) []string {
+	var found []string
+	for _, n := range tree.Nodes {
+		inside := 0
+		for d := range query {
+			if v := n.Key[d]; v >= query[d]-epsilon && v <= query[d]+epsilon {
+				inside++
+			}
+		}
+		if inside >= minMatches {
+			found = append(found, n.Value)
+		}
+	}
+	slices.Sort(found)
+	return found
+}
+
+func TestMinDimMatchesCandidates(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4))
+	tree := NewTree()
+	for i, key := range testKeys(rng, 300) {
+		if err := tree.Insert(key, fmt.Sprintf("node %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, matches := range []int{0, 512, 200, 150, 100, 1} {
+		want := matches
+		if want == 0 {
+			want = 512
+		}
+		for q := 0; q < 5; q++ {
+			query := tree.Nodes[rng.IntN(len(tree.Nodes))].Key
+			opts := SearchOptions{Epsilon: 0.3, MaxDistance: 100, TopK: len(tree.Nodes), MinDimMatches: matches, Explanation: &ExplainReport{}}
+			results, _, err := tree.SearchOpts(query, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, len(results))
+			for i, r := range results {
+				got[i] = r.Node.Value
+			}
+			slices.Sort(got)
+			if expected := boxMatches(tree, query, 0.3, want); !slices.Equal(got, expected) {
+				t.Errorf("MinDimMatches %d: found %d nodes, want the %d inside %d dimensions", matches, len(got), len(expected), want)
+			}
+			if opts.Explanation.MinDimMatches != want {
+				t.Errorf("MinDimMatches %d explained as %d", matches, opts.Explanation.MinDimMatches)
+			}
+		}
+	}
+
+	// Masked dimensions put no constraint on candidates, so K counts only
+	// the dimensions left
+	var mask [512]bool
+	for d := 0; d < 256; d++ {
+		mask[d] = true
+	}
+	opts := SearchOptions{Epsilon: 0.3, MaxDistance: 100, TopK: 10, MinDimMatches: 300, DimMask: mask[:], Explanation: &ExplainReport{}}
+	if _, _, err := tree.SearchOpts(tree.Nodes[0].Key, opts); err != nil || opts.Explanation.MinDimMatches != 256 {
+		t.Errorf("300 of 256 unmasked dimensions explained as %d (%v), want all 256", opts.Explanation.MinDimMatches, err)
+	}
+}
+
+// recallTree holds n random keys, in clusters around centres if clusters
+// is positive, with queries near some of them
+func recallTree(t *testing.T, rng *rand.Rand, n, clusters int, spread float32) (*Tree, [][512]float32) {
+	t.Helper()
+	centres := make([][512]float32, max(clusters, 1))
+	for c := range centres {
+		for d := range centres[c] {
+			centres[c][d] = rng.Float32()*2 - 1
+		}
+	}
+
+	tree := NewTree()
+	for i := 0; i < n; i++ {
+		var key [512]float32
+		for d := range key {
+			if clusters > 0 {
+				key[d] = centres[i%clusters][d] + float32(rng.NormFloat64())*spread
+			} else {
+				key[d] = rng.Float32()*2 - 1
+			}
+		}
+		if err := tree.Insert(key, fmt.Sprintf("node %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	queries := make([][512]float32, 20)
+	for q := range queries {
+		queries[q] = tree.Nodes[rng.IntN(n)].Key
+		for d := range queries[q] {
+			queries[q][d] += float32(rng.NormFloat64()) * spread / 4
+		}
+	}
+	return tree, queries
+}
+
+// TestMinDimMatchesRecallTradeoff shows what lowering K buys: recall can
+// only rise as K drops, and so can the number of candidates scored, which
+// is what the search spends its time on. Run with -v for latencies.
+func TestMinDimMatchesRecallTradeoff(t *testing.T) {
+	datasets := []struct {
+		name     string
+		clusters int
+		spread   float32
+		epsilon  float32
+		matches  []int
+	}{
+		// A random pair shares a box of 1 in about three quarters of the
+		// dimensions
+		{"random", 0, 0.5, 1, []int{512, 448, 384, 352}},
+		{"clustered", 8, 0.05, 0.1, []int{512, 496, 480, 448, 384}},
+	}
+
+	for _, ds := range datasets {
+		t.Run(ds.name, func(t *testing.T) {
+			rng := rand.New(rand.NewPCG(5, 6))
+			tree, queries := recallTree(t, rng, 2000, ds.clusters, ds.spread)
+
+			results, err := EvaluateRecall(tree, queries, 10, []float32{ds.epsilon}, []float32{0}, ds.matches)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, r := range results {
+				t.Logf("K=%d recall %.2f scored %.0f p50 %v p95 %v", r.MinDimMatches, r.Recall, r.MeanScored, r.P50, r.P95)
+				if i == 0 {
+					continue
+				}
+				prev := results[i-1]
+				if r.Recall < prev.Recall {
+					t.Errorf("recall fell from %.2f to %.2f as K dropped from %d to %d", prev.Recall, r.Recall, prev.MinDimMatches, r.MinDimMatches)
+				}
+				if r.MeanScored < prev.MeanScored {
+					t.Errorf("fewer candidates scored at K=%d than at K=%d", r.MinDimMatches, prev.MinDimMatches)
+				}
+			}
+			if first, last := results[0], results[len(results)-1]; last.Recall <= first.Recall {
+				t.Errorf("recall %.2f at every dimension and %.2f at K=%d; want partial matching to recover neighbours", first.Recall, last.Recall, last.MinDimMatches)
+			}
+		})
+	}
+}
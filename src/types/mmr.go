@@ -0,0 +1,87 @@
+package types
+
+import "math"
+
+// MMRRerank greedily picks topK candidates maximizing
+// lambda*sim(query, d) - (1-lambda)*max sim(d, selected).
+// Candidates must already be sorted by distance.
+func MMRRerank(query [512]float32, candidates []ScoredNode, topK int, lambda float32) []ScoredNode {
+	if len(candidates) <= 1 || topK <= 0 {
+		if len(candidates) > topK {
+			return candidates[:topK]
+		}
+		return candidates
+	}
+
+	relevance := make([]float32, len(candidates))
+	for i := range candidates {
+		relevance[i] = Cosine(&query, &candidates[i].Node.Key)
+	}
+
+	return mmrSelect(candidates, relevance, topK, lambda)
+}
+
+// mmrSelect is MMRRerank with precomputed relevance scores
+func mmrSelect(candidates []ScoredNode, relevance []float32, topK int, lambda float32) []ScoredNode {
+	// maxSim[i] is the highest similarity of candidate i to anything selected so far
+	maxSim := make([]float32, len(candidates))
+	for i := range maxSim {
+		maxSim[i] = -1
+	}
+	used := make([]bool, len(candidates))
+
+	limit := topK
+	if len(candidates) < limit {
+		limit = len(candidates)
+	}
+	selected := make([]ScoredNode, 0, limit)
+
+	for len(selected) < limit {
+		best := -1
+		var bestScore float32
+		for i := range candidates {
+			if used[i] {
+				continue
+			}
+
+			score := lambda * relevance[i]
+			if len(selected) > 0 {
+				score -= (1 - lambda) * maxSim[i]
+			}
+
+			if best == -1 || score > bestScore {
+				best = i
+				bestScore = score
+			}
+		}
+
+		used[best] = true
+		selected = append(selected, candidates[best])
+
+		for i := range candidates {
+			if used[i] {
+				continue
+			}
+			if sim := Cosine(&candidates[i].Node.Key, &candidates[best].Node.Key); sim > maxSim[i] {
+				maxSim[i] = sim
+			}
+		}
+	}
+
+	return selected
+}
+
+// Cosine returns the cosine similarity of two keys, 0 if either is all zeros
+func Cosine(a, b *[512]float32) float32 {
+	var dot, normA, normB float64
+	for dim := 0; dim < 512; dim++ {
+		dot += float64(a[dim]) * float64(b[dim])
+		normA += float64(a[dim]) * float64(a[dim])
+		normB += float64(b[dim]) * float64(b[dim])
+	}
+
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return float32(dot / (math.Sqrt(normA) * math.Sqrt(normB)))
+}
@@ -0,0 +1,60 @@
+package types
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestMMRSurfacesDistinctResult searches a tight cluster of near-duplicates
+// close to the query and one slightly farther vector pointing elsewhere.
+// Plain ranking fills topK from the cluster; MMR trades a duplicate for the
+// distinct vector.
+func TestMMRSurfacesDistinctResult(t *testing.T) {
+	tree := NewTree()
+	var query [512]float32
+	query[0] = 1
+
+	for i := 0; i < 4; i++ {
+		var key [512]float32
+		key[0], key[1] = 1, 0.3
+		key[10+i] = 0.01
+		if err := tree.Insert(key, "duplicate"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var distinct [512]float32
+	distinct[0], distinct[2] = 1, 0.35
+	if err := tree.Insert(distinct, "distinct"); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := SearchOptions{Epsilon: 1, MaxDistance: 2, TopK: 3}
+	values := func(opts SearchOptions) []string {
+		t.Helper()
+		results, _, err := tree.SearchOpts(query, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != opts.TopK {
+			t.Fatalf("got %d results, want %d", len(results), opts.TopK)
+		}
+		out := make([]string, len(results))
+		for i, r := range results {
+			out[i] = r.Node.Value
+		}
+		return out
+	}
+
+	if plain := values(opts); slices.Contains(plain, "distinct") {
+		t.Fatalf("plain ranking already returns the distinct vector: %v", plain)
+	}
+
+	opts.MMR = true
+	mmr := values(opts)
+	if !slices.Contains(mmr, "distinct") {
+		t.Fatalf("MMR results %v miss the distinct vector", mmr)
+	}
+	if mmr[0] != "duplicate" {
+		t.Errorf("MMR put %q first, want the most relevant duplicate", mmr[0])
+	}
+}
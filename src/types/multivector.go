@@ -0,0 +1,109 @@
+package types
+
+import "fmt"
+
+// Multi-vector nodes carry alternate keys in Node.AltKeys, e.g. a key
+// phrase embedding next to the full text one. Every key goes into the
+// per-dimension indices, so an index entry is a vector ID rather than a
+// node position: IDs >= 0 are node positions (the primary key) and
+// negative IDs are alternate keys, -1 for alt[0], -2 for alt[1] and so on.
+// Negative IDs keep existing entries stable while nodes are appended.
+
+// altRef locates an alternate key: Nodes[node].AltKeys[key]
+type altRef struct {
+	node int32
+	key  int32
+}
+
+// InsertMulti stores one node searchable by several vectors. keys[0] is the
+// primary Key; the rest become AltKeys and only match searches with
+// SearchOptions.MultiVector set. Keys and metadata are checked like
+// InsertWithMetadata's; a key error names the first bad key.
+func (t *Tree) InsertMulti(keys [][512]float32, value string, metadata map[string]string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	primary := keys[0]
+	if err := t.checkKey(&primary); err != nil {
+		return fmt.Errorf("key 0: %w", err)
+	}
+	if err := t.Schema.Check(metadata); err != nil {
+		return err
+	}
+
+	var altKeys [][512]float32
+	if len(keys) > 1 {
+		altKeys = make([][512]float32, len(keys)-1)
+		copy(altKeys, keys[1:])
+		for i := range altKeys {
+			if err := t.checkKey(&altKeys[i]); err != nil {
+				return fmt.Errorf("key %d: %w", i+1, err)
+			}
+			if t.Normalize {
+				NormalizeVector(&altKeys[i])
+			}
+		}
+	}
+
+	t.insertNode(Node{Key: primary, Value: value, Metadata: metadata, AltKeys: altKeys})
+	return nil
+}
+
+// vectorCount is how many keys the index holds
+func (t *Tree) vectorCount() int {
+	return len(t.Nodes) + len(t.alt)
+}
+
+// keyAt returns the key a vector ID refers to
+func (t *Tree) keyAt(id int32) *[512]float32 {
+	if id >= 0 {
+		return &t.Nodes[id].Key
+	}
+	ref := t.alt[-id-1]
+	return &t.Nodes[ref.node].AltKeys[ref.key]
+}
+
+// owner returns the position of the node a vector ID belongs to
+func (t *Tree) owner(id int32) int32 {
+	if id >= 0 {
+		return id
+	}
+	return t.alt[-id-1].node
+}
+
+// slot maps a vector ID to a dense position in [0, vectorCount), for
+// per-vector scratch arrays
+func (t *Tree) slot(id int32) int32 {
+	if id >= 0 {
+		return id
+	}
+	return int32(len(t.Nodes)) - id - 1
+}
+
+// rebuildAlt lists every alternate key in node order
+func (t *Tree) rebuildAlt() {
+	t.alt = t.alt[:0]
+	for i := range t.Nodes {
+		for k := range t.Nodes[i].AltKeys {
+			t.alt = append(t.alt, altRef{node: int32(i), key: int32(k)})
+		}
+	}
+}
+
+// dedupeOwners keeps the closest candidate per node, in first-seen order
+func dedupeOwners(candidates []ScoredNode) []ScoredNode {
+	best := make(map[int32]int, len(candidates))
+	kept := candidates[:0]
+	for _, c := range candidates {
+		if i, ok := best[c.index]; ok {
+			if c.Distance < kept[i].Distance {
+				kept[i].Distance = c.Distance
+			}
+			continue
+		}
+		best[c.index] = len(kept)
+		kept = append(kept, c)
+	}
+	return kept
+}
@@ -0,0 +1,90 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+var ErrZeroVector = errors.New("cannot normalize a zero vector")
+
+// NormalizeVector scales v to unit length in place. A zero vector is left
+// unchanged and reported as ErrZeroVector.
+func NormalizeVector(v *[512]float32) error {
+	length := vectorNorm(v)
+	if length == 0 {
+		return ErrZeroVector
+	}
+
+	norm := float32(length)
+	for dim := 0; dim < 512; dim++ {
+		v[dim] /= norm
+	}
+	return nil
+}
+
+// vectorNorm is the L2 length of v
+func vectorNorm(v *[512]float32) float64 {
+	var sumSquares float64
+	for dim := 0; dim < 512; dim++ {
+		sumSquares += float64(v[dim]) * float64(v[dim])
+	}
+	return math.Sqrt(sumSquares)
+}
+
+// PrepareKey applies the tree's normalization to a key or query, returning
+// ErrZeroVector where Insert and Search would silently keep a zero vector
+func (t *Tree) PrepareKey(key [512]float32) ([512]float32, error) {
+	if !t.Normalize {
+		return key, nil
+	}
+	err := NormalizeVector(&key)
+	return key, err
+}
+
+// ZeroVectorPolicy is what a tree does with an all-zero key on insert. A
+// zero key has no direction, so it cannot be normalized and is never similar
+// to anything; it almost always means the embedding failed upstream.
+type ZeroVectorPolicy int
+
+const (
+	ZeroVectorAllow  ZeroVectorPolicy = iota // Store it silently (the default)
+	ZeroVectorWarn                           // Store it and log a warning
+	ZeroVectorReject                         // PrepareInsertKey fails with ErrZeroVector
+)
+
+// ParseZeroVectorPolicy reads "allow", "warn" or "reject"
+func ParseZeroVectorPolicy(s string) (ZeroVectorPolicy, error) {
+	switch s {
+	case "allow", "":
+		return ZeroVectorAllow, nil
+	case "warn":
+		return ZeroVectorWarn, nil
+	case "reject":
+		return ZeroVectorReject, nil
+	}
+	return ZeroVectorAllow, fmt.Errorf("unknown zero vector policy %q (use allow, warn or reject)", s)
+}
+
+// PrepareInsertKey is PrepareKey for a key about to be stored. It rejects
+// NaN and infinite components (or zeroes them under SanitizeNonFinite), and
+// under ZeroVectorReject an all-zero key fails with ErrZeroVector even when
+// the tree does not normalize.
+func (t *Tree) PrepareInsertKey(key [512]float32) ([512]float32, error) {
+	if err := t.checkKey(&key); err != nil {
+		return key, err
+	}
+	if t.ZeroVectors == ZeroVectorReject && isZeroVector(&key) {
+		return key, fmt.Errorf("key is all zeros: %w", ErrZeroVector)
+	}
+	return t.PrepareKey(key)
+}
+
+func isZeroVector(v *[512]float32) bool {
+	for dim := 0; dim < 512; dim++ {
+		if v[dim] != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,433 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"time"
+)
+
+// SearchOptions describes a search: the epsilon box, threshold and topK
+// SearchOpts reads, and the optional stages. Start from
+// DefaultSearchOptions; the positional search functions take the first three
+// as arguments and ignore the fields. The JSON names are the ones the HTTP
+// server and the Lambda accept, so request types embed this struct and pick
+// up new options without mapping them by hand.
+type SearchOptions struct {
+	// Epsilon is the half-width of the search box in every dimension,
+	// Threshold the similarity the legacy distance cutoff is derived from
+	// (see LegacyMaxDistance) and TopK the number of results
+	Epsilon   float32 `json:"epsilon"`
+	Threshold float32 `json:"threshold"`
+	TopK      int     `json:"top_k"`
+
+	// MMR re-ranks FetchK candidates for diversity before keeping topK
+	MMR       bool    `json:"mmr,omitempty"`
+	MMRLambda float32 `json:"mmr_lambda,omitempty"` // 1 = pure relevance, 0 = pure diversity
+	FetchK    int     `json:"fetch_k,omitempty"`    // candidates to re-rank; 0 means 4*topK
+
+	// NegativeVectors push results away from other directions: a candidate's
+	// score becomes cosine(query) - NegativeWeight*max cosine(negative)
+	NegativeVectors [][]float32 `json:"negative_vectors,omitempty"`
+	NegativeWeight  float32     `json:"negative_weight,omitempty"` // 0 means 1
+
+	// Offset skips the first Offset ranked results, for paging through a query
+	Offset int `json:"offset,omitempty"`
+
+	// MaxDistance is the Euclidean distance cutoff. 0 keeps the legacy
+	// threshold-derived cutoff (see LegacyMaxDistance).
+	MaxDistance float32 `json:"max_distance,omitempty"`
+
+	// MinScore keeps only results whose Similarity is at least this cosine
+	// score, whatever the epsilon; it replaces the threshold's cutoff (see
+	// ScoreDistance) and a looser MaxDistance. On a tree that doesn't
+	// normalize its keys the distance says nothing about the angle, so each
+	// candidate's true cosine is checked instead. 0 leaves the cutoff alone.
+	MinScore float32 `json:"min_score,omitempty"`
+
+	// GroupBy keeps only the best-ranked result per value of this metadata
+	// key (or dotted path, see MetadataValue), e.g. "doc_id" to return one
+	// chunk per document instead of five chunks of the same one. Candidates
+	// are fetched until topK groups are filled or the search runs out, and
+	// each kept result records its group and how many lower-ranked siblings
+	// among the candidates it stands for. Nodes without the key are never
+	// merged.
+	GroupBy string `json:"group_by,omitempty"`
+
+	// Filter drops nodes whose metadata or timestamp does not match before
+	// they are ranked, so topK counts only matching nodes
+	Filter *Filter `json:"filter,omitempty"`
+
+	// DimWeights scales each dimension's squared difference in the
+	// distance, and narrows (or for weight 0 removes) its epsilon range to
+	// match. DimMask[dim] true ignores the dimension entirely. Both are
+	// nil or one entry per dimension; MMR and negative re-ranking still
+	// use plain cosine.
+	DimWeights []float32 `json:"dim_weights,omitempty"`
+	DimMask    []bool    `json:"dim_mask,omitempty"`
+
+	// MinDimMatches makes a node a candidate when it is inside the epsilon
+	// range of at least this many dimensions rather than all of them, so
+	// one stray coordinate no longer hides an otherwise close node. The
+	// distance cutoff still decides the results; a lower count only widens
+	// the set that gets scored, and costs time accordingly. 0, or a count
+	// at least the dimensions searched (those not masked or weighted 0),
+	// means all of them.
+	MinDimMatches int `json:"min_dim_matches,omitempty"`
+
+	// MultiVector also matches nodes through their AltKeys, scoring each
+	// node by its closest key. A node is returned at most once.
+	MultiVector bool `json:"multi_vector,omitempty"`
+
+	// TrackAccess counts the search as a hit on each node it returns,
+	// kept under HitCountKey and LastAccessedKey in the node's metadata
+	// (see access.go). The counts are batched in memory and written on the
+	// next flush; a tracked search skips the result cache, whose hits do
+	// not know which nodes they came from.
+	TrackAccess bool `json:"track_access,omitempty"`
+
+	// Explanation, if set, is filled with a report of how the search chose
+	// its candidates (see Explain). It never changes the results; searches
+	// with it skip the client's result cache. Requests ask for it with
+	// their own explain flag.
+	Explanation *ExplainReport `json:"-"`
+
+	// Hint has the client work out why a search that finds nothing did,
+	// into its OperationStats (see Tree.SearchHint). The work is only done
+	// for empty results. Requests ask for it with their debug flag.
+	Hint bool `json:"-"`
+
+	// MaxCandidates bounds how many nodes inside the epsilon box are
+	// scored and Deadline, if set, when the search must stop, so a huge
+	// epsilon on a large tree cannot run away. Done, like a context's,
+	// stops the search once it is closed. A search that hits any of them
+	// returns the best results among the nodes it scored and reports
+	// itself truncated (see SearchWithLimits), or with FailOnLimit fails
+	// with ErrSearchLimit. 0, the zero time and a nil Done mean no limit.
+	// Servers set these, so they are never read from a request.
+	MaxCandidates int             `json:"-"`
+	Deadline      time.Time       `json:"-"`
+	Done          <-chan struct{} `json:"-"`
+	FailOnLimit   bool            `json:"-"`
+
+	// emit is SearchStream's callback, handed each node as it is scored
+	emit func(Node, float32) bool
+
+	// counts, if set, is added to as candidates are pre-filtered and scored
+	counts *CandidateCounts
+}
+
+// Defaults for the epsilon, threshold and topK of a search that does not
+// choose its own
+const (
+	DefaultEpsilon   = 0.3
+	DefaultThreshold = 0.5
+	DefaultTopK      = 5
+)
+
+// DefaultSearchOptions is a plain search with the default epsilon,
+// threshold and topK
+func DefaultSearchOptions() SearchOptions {
+	return SearchOptions{Epsilon: DefaultEpsilon, Threshold: DefaultThreshold, TopK: DefaultTopK}
+}
+
+// WithDefaults replaces a zero Epsilon, Threshold or TopK with its default,
+// as the server and the Lambda do for a request that leaves one out
+func (o SearchOptions) WithDefaults() SearchOptions {
+	if o.Epsilon == 0 {
+		o.Epsilon = DefaultEpsilon
+	}
+	if o.Threshold == 0 {
+		o.Threshold = DefaultThreshold
+	}
+	if o.TopK == 0 {
+		o.TopK = DefaultTopK
+	}
+	return o
+}
+
+// MinScoreOverridesThreshold reports whether both MinScore and Threshold
+// are set, in which case the threshold is ignored. Check it before
+// WithDefaults fills Threshold in.
+func (o SearchOptions) MinScoreOverridesThreshold() bool {
+	return o.MinScore > 0 && o.Threshold != 0
+}
+
+// withParams is opts carrying the positional epsilon, threshold and topK
+func (o SearchOptions) withParams(epsilon float32, threshold float32, topK int) SearchOptions {
+	o.Epsilon, o.Threshold, o.TopK = epsilon, threshold, topK
+	return o
+}
+
+// Search limits the HTTP server and the Lambda apply unless configured
+// otherwise
+const (
+	DefaultMaxCandidates = 200000
+	DefaultSearchTimeout = 2 * time.Second
+)
+
+// ErrSearchLimit is returned, wrapped, when a search with
+// SearchOptions.FailOnLimit exceeds MaxCandidates or its Deadline
+var ErrSearchLimit = errors.New("search limit exceeded")
+
+const (
+	defaultMMRLambda      = 0.7
+	defaultNegativeWeight = 1.0
+)
+
+func (o SearchOptions) Validate() error {
+	if !(o.Epsilon >= 0) || math.IsInf(float64(o.Epsilon), 0) {
+		return fmt.Errorf("epsilon must be a non-negative number, got %g", o.Epsilon)
+	}
+	if math.IsNaN(float64(o.Threshold)) {
+		return fmt.Errorf("threshold must be a number, got %g", o.Threshold)
+	}
+	if o.TopK <= 0 {
+		return fmt.Errorf("topK must be positive, got %d", o.TopK)
+	}
+	if o.Offset < 0 {
+		return fmt.Errorf("offset must not be negative, got %d", o.Offset)
+	}
+	if f := o.Filter; f != nil && !f.Since.IsZero() && !f.Until.IsZero() && f.Since.After(f.Until) {
+		return fmt.Errorf("filter since %s is after until %s", f.Since.Format(time.RFC3339), f.Until.Format(time.RFC3339))
+	}
+	if o.MaxDistance < 0 {
+		return fmt.Errorf("max distance must not be negative, got %g", o.MaxDistance)
+	}
+	if !(o.MinScore >= 0 && o.MinScore <= 1) {
+		return fmt.Errorf("min score must be between 0 and 1, got %g", o.MinScore)
+	}
+	if o.MaxCandidates < 0 {
+		return fmt.Errorf("max candidates must not be negative, got %d", o.MaxCandidates)
+	}
+	if o.MinDimMatches < 0 || o.MinDimMatches > 512 {
+		return fmt.Errorf("min dimension matches must be between 0 and 512, got %d", o.MinDimMatches)
+	}
+	for i, neg := range o.NegativeVectors {
+		if len(neg) != 512 {
+			return fmt.Errorf("negative vector %d has %d dimensions, expected 512", i, len(neg))
+		}
+	}
+
+	if o.DimWeights != nil && len(o.DimWeights) != 512 {
+		return fmt.Errorf("dimension weights have %d entries, expected 512", len(o.DimWeights))
+	}
+	for dim, w := range o.DimWeights {
+		if !(w >= 0) || math.IsInf(float64(w), 0) {
+			return fmt.Errorf("dimension %d weight must be a non-negative number, got %g", dim, w)
+		}
+	}
+	if o.DimMask != nil && len(o.DimMask) != 512 {
+		return fmt.Errorf("dimension mask has %d entries, expected 512", len(o.DimMask))
+	}
+	var weights [512]float32
+	if o.dimWeights(&weights) && !slices.ContainsFunc(weights[:], func(w float32) bool { return w > 0 }) {
+		return fmt.Errorf("dimension weights and mask leave no dimension to search")
+	}
+	return nil
+}
+
+// dimWeights fills weights with each dimension's effective weight (0 where
+// masked) and reports whether any weighting applies
+func (o SearchOptions) dimWeights(weights *[512]float32) bool {
+	if o.DimWeights == nil && o.DimMask == nil {
+		return false
+	}
+	for dim := range weights {
+		switch {
+		case o.DimMask != nil && o.DimMask[dim]:
+			weights[dim] = 0
+		case o.DimWeights != nil:
+			weights[dim] = o.DimWeights[dim]
+		default:
+			weights[dim] = 1
+		}
+	}
+	return true
+}
+
+// maxDistance is the distance cutoff of a search on a tree whose keys are
+// normalized or not. Without normalization MinScore is checked as a cosine
+// per candidate, so it puts no bound on the distance.
+func (o SearchOptions) maxDistance(epsilon float32, threshold float32, normalized bool) float32 {
+	if o.MinScore > 0 && !normalized {
+		if o.MaxDistance > 0 {
+			return o.MaxDistance
+		}
+		return math.MaxFloat32
+	}
+	if o.MinScore > 0 {
+		cutoff := ScoreDistance(o.MinScore)
+		if o.MaxDistance > 0 {
+			cutoff = min(cutoff, o.MaxDistance)
+		}
+		return cutoff
+	}
+	if o.MaxDistance > 0 {
+		return o.MaxDistance
+	}
+	return LegacyMaxDistance(epsilon, threshold)
+}
+
+func (o SearchOptions) rerank() bool {
+	return o.MMR || len(o.NegativeVectors) > 0
+}
+
+// SearchWithOptions runs SearchScored and then any optional stages in opts
+func (t *Tree) SearchWithOptions(query [512]float32, epsilon float32, threshold float32, topK int, opts SearchOptions) ([]ScoredNode, error) {
+	results, _, err := t.SearchOpts(query, opts.withParams(epsilon, threshold, topK))
+	return results, err
+}
+
+// SearchWithLimits is SearchWithOptions that also reports whether
+// opts.MaxCandidates or opts.Deadline cut the search short (see SearchOpts)
+func (t *Tree) SearchWithLimits(query [512]float32, epsilon float32, threshold float32, topK int, opts SearchOptions) ([]ScoredNode, bool, error) {
+	return t.SearchOpts(query, opts.withParams(epsilon, threshold, topK))
+}
+
+// SearchOpts searches with everything, epsilon, threshold and topK
+// included, taken from opts. It reports whether opts.MaxCandidates or
+// opts.Deadline cut the search short, in which case the results are the
+// best of the nodes it got to rather than of the tree.
+func (t *Tree) SearchOpts(query [512]float32, opts SearchOptions) ([]ScoredNode, bool, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, false, err
+	}
+
+	// Rank offset+topK results and drop the first offset
+	results, truncated := t.rankWithOptions(query, opts.Epsilon, opts.Threshold, opts.TopK+opts.Offset, opts)
+	if truncated && opts.FailOnLimit {
+		return nil, true, fmt.Errorf("%w: stopped after %s", ErrSearchLimit, opts.limitReason())
+	}
+	if opts.Offset >= len(results) {
+		results = nil
+	} else {
+		results = results[opts.Offset:]
+	}
+	if opts.Explanation != nil {
+		opts.Explanation.Returned = len(results)
+	}
+	return results, truncated, nil
+}
+
+// limitReason names the limit a truncated search most likely hit
+func (o SearchOptions) limitReason() string {
+	if !o.Deadline.IsZero() && !time.Now().Before(o.Deadline) {
+		return "the deadline passed"
+	}
+	select {
+	case <-o.Done:
+		return "the search was cancelled"
+	default:
+	}
+	return fmt.Sprintf("%d candidates", o.MaxCandidates)
+}
+
+func (t *Tree) rankWithOptions(query [512]float32, epsilon float32, threshold float32, topK int, opts SearchOptions) ([]ScoredNode, bool) {
+	if opts.GroupBy != "" {
+		// Over-fetch so that collapsing groups still leaves topK results,
+		// fetching more while groups are missing and candidates remain
+		inner := opts
+		inner.GroupBy = ""
+		fetchK := topK * 4
+		if opts.FetchK > fetchK {
+			fetchK = opts.FetchK
+		}
+		for {
+			ranked, truncated := t.rankWithOptions(query, epsilon, threshold, fetchK, inner)
+			groups := groupBest(ranked, opts.GroupBy, topK)
+			if len(groups) >= topK || len(ranked) < fetchK || fetchK >= len(t.Nodes) || truncated {
+				return groups, truncated
+			}
+			fetchK *= 2
+		}
+	}
+
+	maxDistance := opts.maxDistance(epsilon, threshold, t.Normalize)
+	if !opts.rerank() {
+		return t.searchScored(query, epsilon, maxDistance, topK, &opts)
+	}
+
+	fetchK := opts.FetchK
+	if fetchK < topK {
+		fetchK = topK * 4
+	}
+
+	candidates, truncated := t.searchScored(query, epsilon, maxDistance, fetchK, &opts)
+	relevance := make([]float32, len(candidates))
+	for i := range candidates {
+		relevance[i] = Cosine(&query, &candidates[i].Node.Key)
+	}
+
+	if len(opts.NegativeVectors) > 0 {
+		penalizeNegatives(candidates, relevance, opts)
+	}
+
+	for i := range candidates {
+		candidates[i].Score = relevance[i]
+	}
+
+	if opts.MMR {
+		lambda := opts.MMRLambda
+		if lambda == 0 {
+			lambda = defaultMMRLambda
+		}
+		return mmrSelect(candidates, relevance, topK, lambda), truncated
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	if len(candidates) > topK {
+		candidates = candidates[:topK]
+	}
+	return candidates, truncated
+}
+
+// penalizeNegatives subtracts the weighted similarity to the closest negative vector
+func penalizeNegatives(candidates []ScoredNode, relevance []float32, opts SearchOptions) {
+	weight := opts.NegativeWeight
+	if weight == 0 {
+		weight = defaultNegativeWeight
+	}
+
+	negatives := make([][512]float32, len(opts.NegativeVectors))
+	for i, neg := range opts.NegativeVectors {
+		copy(negatives[i][:], neg)
+	}
+
+	for i := range candidates {
+		var worst float32 = -1
+		for n := range negatives {
+			if sim := Cosine(&negatives[n], &candidates[i].Node.Key); sim > worst {
+				worst = sim
+			}
+		}
+		relevance[i] -= weight * worst
+	}
+}
+
+// groupBest keeps the first (best-ranked) result of each metaKey value,
+// up to topK, counting the later results of each kept group in Collapsed
+func groupBest(ranked []ScoredNode, metaKey string, topK int) []ScoredNode {
+	kept := make(map[string]int) // group -> position in results
+	results := make([]ScoredNode, 0, min(topK, len(ranked)))
+	for _, hit := range ranked {
+		group, ok := MetadataValue(hit.Node.Metadata, metaKey)
+		if i, seen := kept[group]; ok && seen {
+			results[i].Collapsed++
+			continue
+		}
+		if len(results) == topK {
+			continue
+		}
+		if ok {
+			kept[group] = len(results)
+			hit.Group = group
+		}
+		results = append(results, hit)
+	}
+	return results
+}
@@ -0,0 +1,288 @@
+package types
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestOffsetPagesMatchTopK checks that page one (offset 0) followed by page
+// two (offset K) is exactly the top 2K, in order, with nothing repeated or
+// skipped. Every fourth key is a copy of an earlier one, so pages also
+// break ties between equal distances the same way the top 2K does.
+func TestOffsetPagesMatchTopK(t *testing.T) {
+	rng := rand.New(rand.NewPCG(5, 5))
+	tree := NewTree()
+	var keys [][512]float32
+	for i := 0; i < 300; i++ {
+		var key [512]float32
+		if i%4 == 3 {
+			key = keys[rng.IntN(len(keys))]
+		} else {
+			for d := range key {
+				key[d] = float32(rng.NormFloat64())
+			}
+		}
+		keys = append(keys, key)
+		if err := tree.Insert(key, fmt.Sprintf("node %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Copies of the query tie at distance 0 across the K=1 and K=5 page
+	// boundaries
+	query := keys[7]
+	for i := 0; i < 5; i++ {
+		if err := tree.Insert(query, fmt.Sprintf("copy %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	base := SearchOptions{Epsilon: 100, MaxDistance: 1000}
+	search := func(topK, offset int) []ScoredNode {
+		t.Helper()
+		opts := base
+		opts.TopK, opts.Offset = topK, offset
+		results, _, err := tree.SearchOpts(query, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return results
+	}
+
+	for _, k := range []int{1, 5, 10, 25} {
+		all := search(2*k, 0)
+		if len(all) != 2*k {
+			t.Fatalf("K=%d: top 2K returned %d results", k, len(all))
+		}
+		pages := append(search(k, 0), search(k, k)...)
+
+		seen := make(map[string]bool)
+		for i := range pages {
+			value := pages[i].Node.Value
+			if seen[value] {
+				t.Fatalf("K=%d: %s is on both pages", k, value)
+			}
+			seen[value] = true
+		}
+		if len(pages) != len(all) {
+			t.Fatalf("K=%d: pages hold %d results, the top 2K %d", k, len(pages), len(all))
+		}
+		for i := range all {
+			if pages[i].Node.Value != all[i].Node.Value || pages[i].Distance != all[i].Distance {
+				t.Fatalf("K=%d: result %d is %s (%v) on the pages, %s (%v) in the top 2K",
+					k, i, pages[i].Node.Value, pages[i].Distance, all[i].Node.Value, all[i].Distance)
+			}
+		}
+	}
+
+	// A page past the end is empty rather than an error
+	if past := search(10, len(tree.Nodes)); len(past) != 0 {
+		t.Fatalf("page past the end returned %d results", len(past))
+	}
+}
+
+// TestMinScoreIsCosine checks MinScore against the angle between vectors
+// whether or not the tree normalizes them. Unnormalized, a vector pointing
+// the query's way but far longer is a perfect match while a short one at
+// 45 degrees, though much nearer, is not.
+func TestMinScoreIsCosine(t *testing.T) {
+	vector := func(x, y float32) [512]float32 {
+		var v [512]float32
+		v[0], v[1] = x, y
+		return v
+	}
+	query := vector(2, 0)
+	keys := map[string][512]float32{
+		"same way, long": vector(10, 0),  // cosine 1, distance 8
+		"45 degrees":     vector(1, 1),   // cosine 0.71, distance 1.41
+		"right angle":    vector(0, 2),   // cosine 0, distance 2.83
+		"opposite":       vector(-1, 0),  // cosine -1, distance 3
+		"zero":           vector(0, 0),   // no direction
+		"slight turn":    vector(3, 0.5), // cosine 0.99, distance 1.12
+	}
+
+	for _, normalize := range []bool{false, true} {
+		tree := NewTree()
+		tree.Normalize = normalize
+		for value, key := range keys {
+			if err := tree.Insert(key, value); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		search := func(minScore, maxDistance float32) []string {
+			t.Helper()
+			opts := SearchOptions{Epsilon: 100, TopK: 10, MinScore: minScore, MaxDistance: maxDistance}
+			results, _, err := tree.SearchOpts(query, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var found []string
+			for _, r := range results {
+				found = append(found, r.Node.Value)
+			}
+			slices.Sort(found)
+			return found
+		}
+
+		if got := search(0.95, 0); !slices.Equal(got, []string{"same way, long", "slight turn"}) {
+			t.Errorf("normalize %v: min score 0.95 found %v", normalize, got)
+		}
+		if got := search(0.5, 0); !slices.Equal(got, []string{"45 degrees", "same way, long", "slight turn"}) {
+			t.Errorf("normalize %v: min score 0.5 found %v", normalize, got)
+		}
+		if got := search(0.01, 0); slices.Contains(got, "right angle") || slices.Contains(got, "zero") || slices.Contains(got, "opposite") {
+			t.Errorf("normalize %v: min score 0.01 found %v, want nothing at or past a right angle", normalize, got)
+		}
+	}
+
+	// A tighter MaxDistance still applies on top of the cosine
+	tree := NewTree()
+	for value, key := range keys {
+		if err := tree.Insert(key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	results, _, err := tree.SearchOpts(query, SearchOptions{Epsilon: 100, TopK: 10, MinScore: 0.5, MaxDistance: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Node.Value != "slight turn" || results[1].Node.Value != "45 degrees" {
+		t.Errorf("min score 0.5 within distance 2 found %v, want the slight turn then 45 degrees", results)
+	}
+}
+
+func TestSearchOptionsValidate(t *testing.T) {
+	nan := float32(math.NaN())
+	inf := float32(math.Inf(1))
+	jan, feb := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	allMasked := make([]bool, 512)
+	for i := range allMasked {
+		allMasked[i] = true
+	}
+
+	valid := DefaultSearchOptions()
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("default options: %v", err)
+	}
+	cases := []struct {
+		name   string
+		change func(*SearchOptions)
+		want   string // empty when the options are valid
+	}{
+		{"zero epsilon", func(o *SearchOptions) { o.Epsilon = 0 }, ""},
+		{"negative threshold", func(o *SearchOptions) { o.Threshold = -1 }, ""},
+		{"negative epsilon", func(o *SearchOptions) { o.Epsilon = -0.1 }, "epsilon must be a non-negative number"},
+		{"NaN epsilon", func(o *SearchOptions) { o.Epsilon = nan }, "epsilon must be a non-negative number"},
+		{"infinite epsilon", func(o *SearchOptions) { o.Epsilon = inf }, "epsilon must be a non-negative number"},
+		{"NaN threshold", func(o *SearchOptions) { o.Threshold = nan }, "threshold must be a number"},
+		{"zero topK", func(o *SearchOptions) { o.TopK = 0 }, "topK must be positive"},
+		{"negative topK", func(o *SearchOptions) { o.TopK = -3 }, "topK must be positive"},
+		{"negative offset", func(o *SearchOptions) { o.Offset = -1 }, "offset must not be negative"},
+		{"since after until", func(o *SearchOptions) { o.Filter = &Filter{Since: feb, Until: jan} }, "filter since"},
+		{"since equals until", func(o *SearchOptions) { o.Filter = &Filter{Since: jan, Until: jan} }, ""},
+		{"negative max distance", func(o *SearchOptions) { o.MaxDistance = -1 }, "max distance must not be negative"},
+		{"min score above 1", func(o *SearchOptions) { o.MinScore = 1.5 }, "min score must be between 0 and 1"},
+		{"NaN min score", func(o *SearchOptions) { o.MinScore = nan }, "min score must be between 0 and 1"},
+		{"negative max candidates", func(o *SearchOptions) { o.MaxCandidates = -1 }, "max candidates must not be negative"},
+		{"min dim matches past 512", func(o *SearchOptions) { o.MinDimMatches = 513 }, "min dimension matches"},
+		{"short negative vector", func(o *SearchOptions) { o.NegativeVectors = [][]float32{make([]float32, 3)} }, "negative vector 0 has 3 dimensions"},
+		{"short dimension weights", func(o *SearchOptions) { o.DimWeights = make([]float32, 8) }, "dimension weights have 8 entries"},
+		{"negative dimension weight", func(o *SearchOptions) { o.DimWeights = make([]float32, 512); o.DimWeights[4] = -1 }, "dimension 4 weight"},
+		{"short dimension mask", func(o *SearchOptions) { o.DimMask = make([]bool, 8) }, "dimension mask has 8 entries"},
+		{"every dimension masked", func(o *SearchOptions) { o.DimMask = allMasked }, "leave no dimension to search"},
+	}
+	for _, tc := range cases {
+		opts := valid
+		tc.change(&opts)
+		err := opts.Validate()
+		switch {
+		case tc.want == "" && err != nil:
+			t.Errorf("%s: %v", tc.name, err)
+		case tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)):
+			t.Errorf("%s: %v, want %q", tc.name, err, tc.want)
+		}
+	}
+
+	// SearchOpts checks before searching
+	if _, _, err := NewTree().SearchOpts([512]float32{}, SearchOptions{Epsilon: -1, TopK: 5}); err == nil {
+		t.Error("SearchOpts ran with a negative epsilon")
+	}
+}
+
+func TestSearchOptionsWithDefaults(t *testing.T) {
+	if got := (SearchOptions{}).WithDefaults(); got.Epsilon != DefaultEpsilon || got.Threshold != DefaultThreshold || got.TopK != DefaultTopK {
+		t.Errorf("zero options filled in as %+v", got)
+	}
+	set := SearchOptions{Epsilon: 0.7, Threshold: 0.2, TopK: 12, Offset: 3, GroupBy: "doc_id"}
+	if got := set.WithDefaults(); got.Epsilon != 0.7 || got.Threshold != 0.2 || got.TopK != 12 || got.Offset != 3 || got.GroupBy != "doc_id" {
+		t.Errorf("chosen options changed to %+v", got)
+	}
+
+	if !(SearchOptions{MinScore: 0.8, Threshold: 0.5}).MinScoreOverridesThreshold() {
+		t.Error("min score with a threshold not reported as overriding it")
+	}
+	if (SearchOptions{MinScore: 0.8}).MinScoreOverridesThreshold() {
+		t.Error("min score alone reported as overriding a threshold")
+	}
+}
+
+// The positional search functions are SearchOpts with epsilon, threshold
+// and topK taken from their arguments
+func TestPositionalSearchesMatchSearchOpts(t *testing.T) {
+	rng := rand.New(rand.NewPCG(6, 6))
+	tree := NewTree()
+	var query [512]float32
+	for i := 0; i < 200; i++ {
+		var key [512]float32
+		for d := range key {
+			key[d] = float32(rng.NormFloat64() * 0.1)
+		}
+		if i == 0 {
+			query = key
+		}
+		if err := tree.Insert(key, fmt.Sprintf("node %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	values := func(results []ScoredNode) []string {
+		out := make([]string, len(results))
+		for i := range results {
+			out[i] = results[i].Node.Value
+		}
+		return out
+	}
+	const epsilon, threshold, topK = 0.4, 0.1, 8
+	want, _, err := tree.SearchOpts(query, SearchOptions{Epsilon: epsilon, Threshold: threshold, TopK: topK})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(want) < 2 {
+		t.Fatalf("search found %d nodes, too few to compare", len(want))
+	}
+
+	if got := values(tree.SearchScored(query, epsilon, threshold, topK)); !slices.Equal(got, values(want)) {
+		t.Errorf("SearchScored found %v, SearchOpts %v", got, values(want))
+	}
+	nodes := tree.Search(query, epsilon, threshold, topK)
+	got := make([]string, len(nodes))
+	for i := range nodes {
+		got[i] = nodes[i].Value
+	}
+	if !slices.Equal(got, values(want)) {
+		t.Errorf("Search found %v, SearchOpts %v", got, values(want))
+	}
+
+	// The options' own epsilon, threshold and topK are ignored
+	ignored := SearchOptions{Epsilon: 5, Threshold: 0.9, TopK: 1}
+	results, err := tree.SearchWithOptions(query, epsilon, threshold, topK, ignored)
+	if err != nil || !slices.Equal(values(results), values(want)) {
+		t.Errorf("SearchWithOptions found %v (%v), SearchOpts %v", values(results), err, values(want))
+	}
+}
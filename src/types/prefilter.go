@@ -0,0 +1,187 @@
+package types
+
+import (
+	"math"
+	"runtime"
+	"sync"
+)
+
+// The pre-filter rejects a candidate from a few numbers stored per node
+// before reading its key: the key's norm, and its coordinates in the
+// subspace of the keys' first few principal components. By the triangle
+// inequality |‖q‖ - ‖n‖| <= ‖q - n‖, and projecting onto a subspace never
+// lengthens a vector, so a node whose norm or projected position is
+// farther from the query's than the distance cutoff cannot be a result.
+// Normalized keys all have norm 1 and only the projection helps; for raw
+// keys both do.
+//
+// Both bounds are exact, so results are the same with or without the
+// pre-filter; it only saves the distance computation. It is skipped when
+// dimensions are weighted or masked, which is no longer Euclidean distance,
+// and for alternate keys, which have no stored values.
+
+// prefilterSlack widens the cutoff the pre-filter checks against, so the
+// float32 rounding of the distance computation can never leave in a node
+// the pre-filter threw out
+const prefilterSlack = 1e-4
+
+// principalComponents is how many principal components each key is
+// projected onto, fitted to at most principalSample keys on RebuildIndex
+const (
+	principalComponents = 8
+	principalSample     = 2048
+)
+
+// CandidateCounts reports how many nodes inside the epsilon box a search
+// scored and how many the pre-filter rejected before scoring
+type CandidateCounts struct {
+	Scored      int `json:"scored"`
+	Prefiltered int `json:"prefiltered"`
+}
+
+// prefilter holds the per-node values the pre-filter checks, indexed like
+// Tree.Nodes. It is rebuilt with the index and extended by inserts that
+// extend the index.
+type prefilter struct {
+	norms       []float32
+	basis       [][512]float32 // orthonormal principal components; empty for a tree too small to fit them
+	projections []float32      // len(basis) coordinates per node, node by node
+}
+
+// buildPrefilter computes every node's norm and, from a sample of the
+// keys, the principal components and every node's coordinates along them
+func (t *Tree) buildPrefilter() {
+	p := &t.prefilter
+	p.norms = resize(p.norms, len(t.Nodes))
+	for i := range t.Nodes {
+		p.norms[i] = float32(vectorNorm(&t.Nodes[i].Key))
+	}
+
+	p.basis = t.principalComponents()
+	p.projections = resize(p.projections, len(t.Nodes)*len(p.basis))
+	if len(p.basis) == 0 {
+		return
+	}
+
+	// Projecting is most of the cost, so split the nodes across workers
+	workers := runtime.NumCPU()
+	chunk := (len(t.Nodes) + workers - 1) / workers
+	var wg sync.WaitGroup
+	for start := 0; start < len(t.Nodes); start += chunk {
+		end := min(start+chunk, len(t.Nodes))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := start; i < end; i++ {
+				p.project(&t.Nodes[i].Key, p.projections[i*len(p.basis):])
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// addPrefilter extends the pre-filter with the node just appended
+func (t *Tree) addPrefilter(nodeIdx int32) {
+	p := &t.prefilter
+	if len(p.norms) != int(nodeIdx) {
+		return
+	}
+	key := &t.Nodes[nodeIdx].Key
+	p.norms = append(p.norms, float32(vectorNorm(key)))
+	start := len(p.projections)
+	for range p.basis {
+		p.projections = append(p.projections, 0)
+	}
+	p.project(key, p.projections[start:])
+}
+
+// project writes key's coordinates along the basis into dst
+func (p *prefilter) project(key *[512]float32, dst []float32) {
+	for c := range p.basis {
+		dst[c] = float32(dot64(&p.basis[c], key))
+	}
+}
+
+// principalComponents fits TrainProjection's PCA to a sample of the keys,
+// returning its components as rows, or nil when the tree is too small. The
+// components are orthonormal, which is all the bound needs.
+func (t *Tree) principalComponents() [][512]float32 {
+	sample := SampleIndices(len(t.Nodes), principalSample)
+	if len(sample) < principalComponents {
+		return nil
+	}
+	vectors := make([][]float32, len(sample))
+	for i, nodeIdx := range sample {
+		vectors[i] = t.Nodes[nodeIdx].Key[:]
+	}
+
+	p, err := TrainProjection(vectors, principalComponents)
+	if err != nil {
+		return nil
+	}
+	basis := make([][512]float32, principalComponents)
+	for c := range basis {
+		copy(basis[c][:], p.Matrix[c*512:(c+1)*512])
+	}
+	return basis
+}
+
+// prefilterQuery is what a search compares each candidate's stored values
+// against: the query's norm and projection, and the cutoff
+type prefilterQuery struct {
+	norm       float32
+	projection [principalComponents]float32
+	bound      float32
+	projected  int // coordinates in projection
+}
+
+// prefilterFor prepares the pre-filter for a search with the given
+// distance cutoff, reporting false when it can't be used: no finite cutoff,
+// weighted dimensions, or values that don't cover the nodes
+func (t *Tree) prefilterFor(query *[512]float32, maxAllowedDistance float32, weighted bool) (prefilterQuery, bool) {
+	p := &t.prefilter
+	bound := float64(maxAllowedDistance)
+	if t.DisablePrefilter || weighted || math.IsInf(bound, 0) || math.IsNaN(bound) ||
+		len(p.norms) != len(t.Nodes) || len(p.projections) != len(t.Nodes)*len(p.basis) {
+		return prefilterQuery{}, false
+	}
+
+	q := prefilterQuery{
+		norm:      float32(vectorNorm(query)),
+		bound:     float32(bound*(1+prefilterSlack) + prefilterSlack),
+		projected: len(p.basis),
+	}
+	p.project(query, q.projection[:])
+	return q, true
+}
+
+// rejects reports whether node nodeIdx is certainly farther than the cutoff
+func (t *Tree) rejects(q *prefilterQuery, nodeIdx int32) bool {
+	if diff := q.norm - t.prefilter.norms[nodeIdx]; diff > q.bound || -diff > q.bound {
+		return true
+	}
+	coords := t.prefilter.projections[int(nodeIdx)*q.projected:][:q.projected]
+	limit := q.bound * q.bound
+	var sumSquares float32
+	for c, x := range coords {
+		diff := q.projection[c] - x
+		sumSquares += diff * diff
+	}
+	return sumSquares > limit
+}
+
+func dot64(a, b *[512]float32) float64 {
+	var sum float64
+	for dim := 0; dim < 512; dim++ {
+		sum += float64(a[dim]) * float64(b[dim])
+	}
+	return sum
+}
+
+// resize returns s with length n, reusing its array when it is big enough
+func resize(s []float32, n int) []float32 {
+	if cap(s) >= n {
+		return s[:n]
+	}
+	return make([]float32, n)
+}
@@ -0,0 +1,113 @@
+package types
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+// scoredBoth runs the search with and without the pre-filter, failing
+// unless both return the same nodes at the same distances, and returns
+// the candidate counts of each
+func scoredBoth(t *testing.T, tree *Tree, query [512]float32, opts SearchOptions) (with, without CandidateCounts) {
+	t.Helper()
+	run := func(disable bool, counts *CandidateCounts) []ScoredNode {
+		tree.DisablePrefilter = disable
+		defer func() { tree.DisablePrefilter = false }()
+		o := opts
+		o.counts = counts
+		results, _, err := tree.SearchOpts(query, o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return results
+	}
+	filtered := run(false, &with)
+	full := run(true, &without)
+
+	same := slices.EqualFunc(filtered, full, func(a, b ScoredNode) bool {
+		return a.Node.Value == b.Node.Value && a.Distance == b.Distance
+	})
+	if !same {
+		t.Errorf("pre-filtered search returned %d results, full search %d, or they differ", len(filtered), len(full))
+	}
+	return with, without
+}
+
+func TestPrefilterKeepsResults(t *testing.T) {
+	// Clusters are about 18 apart and 1.6 across, or 1.4 and 0.12 once
+	// normalized; the cutoffs run from inside a cluster to past it
+	cutoffs := map[bool][]float32{false: {0.5, 2, 8}, true: {0.05, 0.25, 1}}
+	for _, normalize := range []bool{false, true} {
+		rng := rand.New(rand.NewPCG(7, 8))
+		tree, queries := recallTree(t, rng, 1500, 8, 0.05)
+		if normalize {
+			normalized := NewTree()
+			normalized.Normalize = true
+			for _, n := range tree.Nodes {
+				if err := normalized.Insert(n.Key, n.Value); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tree = normalized
+		}
+		tree.RebuildIndex()
+
+		var with, without CandidateCounts
+		for _, query := range queries {
+			for _, cutoff := range cutoffs[normalize] {
+				opts := SearchOptions{Epsilon: 2, MaxDistance: cutoff, TopK: 20}
+				w, wo := scoredBoth(t, tree, query, opts)
+				with.Scored += w.Scored
+				with.Prefiltered += w.Prefiltered
+				without.Scored += wo.Scored
+			}
+		}
+		if without.Prefiltered != 0 {
+			t.Errorf("normalize=%v: %d rejected with the pre-filter off", normalize, without.Prefiltered)
+		}
+		// Rejected nodes include some outside the box, which the full search
+		// drops without scoring either
+		if with.Prefiltered == 0 || with.Scored > without.Scored/2 {
+			t.Errorf("normalize=%v: scored %d candidates (%d rejected), %d without the pre-filter; want under half", normalize, with.Scored, with.Prefiltered, without.Scored)
+		}
+	}
+}
+
+func TestPrefilterFallsBack(t *testing.T) {
+	rng := rand.New(rand.NewPCG(9, 10))
+	tree, queries := recallTree(t, rng, 300, 4, 0.05)
+	tree.RebuildIndex()
+	query := queries[0]
+
+	// Inserts after the rebuild are covered by the stored values
+	for i := 0; i < 20; i++ {
+		key := tree.Nodes[i].Key
+		key[0] += 0.01
+		if err := tree.Insert(key, "late"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(tree.prefilter.norms) != len(tree.Nodes) {
+		t.Fatalf("%d norms for %d nodes", len(tree.prefilter.norms), len(tree.Nodes))
+	}
+	if with, _ := scoredBoth(t, tree, query, SearchOptions{Epsilon: 2, MaxDistance: 1, TopK: 50}); with.Prefiltered == 0 {
+		t.Error("nothing rejected after inserts")
+	}
+
+	// With no finite cutoff or weighted dimensions there is no bound to
+	// check, so every candidate is scored
+	weights := make([]float32, 512)
+	for d := range weights {
+		weights[d] = 2
+	}
+	for name, opts := range map[string]SearchOptions{
+		"no cutoff": {Epsilon: 2, MaxDistance: float32(math.Inf(1)), TopK: 5},
+		"weighted":  {Epsilon: 2, MaxDistance: 1, TopK: 5, DimWeights: weights},
+	} {
+		if with, _ := scoredBoth(t, tree, query, opts); with.Prefiltered != 0 {
+			t.Errorf("%s: %d candidates rejected", name, with.Prefiltered)
+		}
+	}
+}
@@ -0,0 +1,471 @@
+package types
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// Projection maps InputDims-wide embeddings onto the first OutputDims
+// dimensions of a tree key; the rest of the key stays zero. It lets a
+// database hold vectors from a model wider than 512 dimensions, or shrink
+// the effective width of an existing one. A tree with a Projection persists
+// it in its file header and the client applies it to every vector it
+// inserts or searches for.
+type Projection struct {
+	InputDims  int
+	OutputDims int
+	Matrix     []float32 // OutputDims rows of InputDims, row-major
+}
+
+func (p *Projection) Validate() error {
+	if p.InputDims <= 0 {
+		return fmt.Errorf("projection input dimensions must be positive, got %d", p.InputDims)
+	}
+	if p.OutputDims <= 0 || p.OutputDims > 512 {
+		return fmt.Errorf("projection output dimensions must be in [1, 512], got %d", p.OutputDims)
+	}
+	if len(p.Matrix) != p.InputDims*p.OutputDims {
+		return fmt.Errorf("projection matrix has %d entries, expected %d", len(p.Matrix), p.InputDims*p.OutputDims)
+	}
+	return nil
+}
+
+// Project maps vec into a tree key
+func (p *Projection) Project(vec []float32) ([512]float32, error) {
+	var key [512]float32
+	if len(vec) != p.InputDims {
+		return key, fmt.Errorf("vector has %d dimensions, the projection expects %d", len(vec), p.InputDims)
+	}
+
+	for i := 0; i < p.OutputDims; i++ {
+		row := p.Matrix[i*p.InputDims : (i+1)*p.InputDims]
+		var sum float64
+		for j, v := range vec {
+			sum += float64(row[j]) * float64(v)
+		}
+		key[i] = float32(sum)
+	}
+	return key, nil
+}
+
+// Then returns the projection that applies p and then next. next must take
+// tree keys (512 inputs), as when a projected database is reprojected.
+func (p *Projection) Then(next *Projection) (*Projection, error) {
+	if next.InputDims != 512 {
+		return nil, fmt.Errorf("cannot chain a projection taking %d dimensions after one producing tree keys", next.InputDims)
+	}
+
+	combined := &Projection{
+		InputDims:  p.InputDims,
+		OutputDims: next.OutputDims,
+		Matrix:     make([]float32, next.OutputDims*p.InputDims),
+	}
+	row := make([]float64, p.InputDims)
+	for i := 0; i < next.OutputDims; i++ {
+		clear(row)
+		for m := 0; m < p.OutputDims; m++ {
+			w := float64(next.Matrix[i*512+m])
+			if w == 0 {
+				continue
+			}
+			for j, v := range p.Matrix[m*p.InputDims : (m+1)*p.InputDims] {
+				row[j] += w * float64(v)
+			}
+		}
+		for j, v := range row {
+			combined.Matrix[i*p.InputDims+j] = float32(v)
+		}
+	}
+	return combined, nil
+}
+
+// VectorKey turns an embedding into a tree key: through the tree's
+// Projection when it has one, copied as-is otherwise
+func (t *Tree) VectorKey(vec []float32) ([512]float32, error) {
+	if t.Projection != nil {
+		return t.Projection.Project(vec)
+	}
+
+	var key [512]float32
+	if len(vec) != len(key) {
+		return key, fmt.Errorf("vector has %d dimensions, expected %d", len(vec), len(key))
+	}
+	copy(key[:], vec)
+	return key, nil
+}
+
+// VectorDims is the width of the vectors callers insert and search with
+func (t *Tree) VectorDims() int {
+	if t.Projection != nil {
+		return t.Projection.InputDims
+	}
+	return 512
+}
+
+// Reproject returns a copy of the tree with every key (alternate keys too)
+// mapped through p, which must take tree keys. The copy's Projection is the
+// existing one followed by p, so callers keep inserting vectors of the
+// original width. Radii are dropped: calibrated epsilons do not survive a
+// change of basis.
+func (t *Tree) Reproject(p *Projection) (*Tree, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if p.InputDims != 512 {
+		return nil, fmt.Errorf("reprojection must take 512-dimension keys, got %d", p.InputDims)
+	}
+
+	combined := p
+	if t.Projection != nil {
+		var err error
+		if combined, err = t.Projection.Then(p); err != nil {
+			return nil, err
+		}
+	}
+
+	out := &Tree{Nodes: make([]Node, len(t.Nodes)), Normalize: t.Normalize, Projection: combined, Schema: t.Schema, Config: t.Config}
+	for i, n := range t.Nodes {
+		var err error
+		if n.Key, err = out.reprojectKey(p, &t.Nodes[i].Key); err != nil {
+			return nil, fmt.Errorf("node %d: %w", i, err)
+		}
+		if len(n.AltKeys) > 0 {
+			n.AltKeys = make([][512]float32, len(t.Nodes[i].AltKeys))
+			for k := range n.AltKeys {
+				if n.AltKeys[k], err = out.reprojectKey(p, &t.Nodes[i].AltKeys[k]); err != nil {
+					return nil, fmt.Errorf("node %d: %w", i, err)
+				}
+			}
+		}
+		out.Nodes[i] = n
+	}
+
+	out.RebuildIndex()
+	return out, nil
+}
+
+func (t *Tree) reprojectKey(p *Projection, key *[512]float32) ([512]float32, error) {
+	projected, err := p.Project(key[:])
+	if err != nil {
+		return projected, err
+	}
+	return t.PrepareKey(projected)
+}
+
+// subspaceIterations is how many power iterations sharpen the randomized
+// subspace before the final eigendecomposition
+const subspaceIterations = 4
+
+// TrainProjection fits a PCA projection of vectors onto targetDims
+// components. The components come from the uncentered second moment
+// (a truncated SVD), so the origin stays put and cosine similarity survives
+// as well as the kept components allow. For targets well below the input
+// width the top eigenvectors are found by randomized subspace iteration
+// rather than a full eigendecomposition.
+func TrainProjection(vectors [][]float32, targetDims int) (*Projection, error) {
+	if len(vectors) == 0 {
+		return nil, fmt.Errorf("no training vectors")
+	}
+	dims := len(vectors[0])
+	if targetDims <= 0 || targetDims > 512 || targetDims > dims {
+		return nil, fmt.Errorf("target dimensions must be in [1, %d], got %d", min(512, dims), targetDims)
+	}
+	if len(vectors) < targetDims {
+		return nil, fmt.Errorf("need at least %d training vectors for %d components, got %d", targetDims, targetDims, len(vectors))
+	}
+	for i, v := range vectors {
+		if len(v) != dims {
+			return nil, fmt.Errorf("training vector %d has %d dimensions, expected %d", i, len(v), dims)
+		}
+	}
+
+	moment := secondMoment(vectors, dims)
+
+	// Candidate eigenvectors of moment, one orthonormal column each
+	var basis [][]float64
+	if oversampled := targetDims + 10; oversampled < dims {
+		basis = randomizedBasis(moment, dims, oversampled)
+	} else {
+		basis = make([][]float64, dims)
+		for i := range basis {
+			basis[i] = make([]float64, dims)
+			basis[i][i] = 1
+		}
+	}
+	width := len(basis)
+
+	// Rayleigh-Ritz: eigendecompose the moment restricted to the basis,
+	// then rotate the basis onto its eigenvectors
+	small := projectMoment(moment, basis, dims)
+	values, rotation := jacobiEigen(small, width)
+
+	order := make([]int, width)
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return values[order[a]] > values[order[b]] })
+
+	p := &Projection{InputDims: dims, OutputDims: targetDims, Matrix: make([]float32, targetDims*dims)}
+	component := make([]float64, dims)
+	for out := 0; out < targetDims; out++ {
+		clear(component)
+		for k, col := range basis {
+			w := rotation[k*width+order[out]]
+			for i, v := range col {
+				component[i] += w * v
+			}
+		}
+		for i, v := range component {
+			p.Matrix[out*dims+i] = float32(v)
+		}
+	}
+	return p, nil
+}
+
+// RandomProjection is a Gaussian Johnson-Lindenstrauss projection: no
+// training, and pairwise distances are preserved in expectation
+func RandomProjection(inputDims, targetDims int, seed uint64) (*Projection, error) {
+	if targetDims <= 0 || targetDims > 512 || inputDims <= 0 {
+		return nil, fmt.Errorf("invalid random projection %d -> %d dimensions", inputDims, targetDims)
+	}
+
+	rng := rand.New(rand.NewPCG(seed, seed^0x9e3779b97f4a7c15))
+	scale := 1 / math.Sqrt(float64(targetDims))
+	p := &Projection{InputDims: inputDims, OutputDims: targetDims, Matrix: make([]float32, targetDims*inputDims)}
+	for i := range p.Matrix {
+		p.Matrix[i] = float32(rng.NormFloat64() * scale)
+	}
+	return p, nil
+}
+
+// IdentityProjection copies dims-wide vectors into the first dims
+// dimensions of a tree key unchanged
+func IdentityProjection(dims int) (*Projection, error) {
+	if dims <= 0 || dims > 512 {
+		return nil, fmt.Errorf("identity projection dimensions must be in [1, 512], got %d", dims)
+	}
+
+	p := &Projection{InputDims: dims, OutputDims: dims, Matrix: make([]float32, dims*dims)}
+	for i := 0; i < dims; i++ {
+		p.Matrix[i*dims+i] = 1
+	}
+	return p, nil
+}
+
+// secondMoment is X^T X / n, dims x dims, with rows split across workers
+func secondMoment(vectors [][]float32, dims int) []float64 {
+	moment := make([]float64, dims*dims)
+	n := float64(len(vectors))
+
+	rows := make(chan int, dims)
+	for i := 0; i < dims; i++ {
+		rows <- i
+	}
+	close(rows)
+
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.GOMAXPROCS(0); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range rows {
+				row := moment[i*dims : (i+1)*dims]
+				for _, v := range vectors {
+					vi := float64(v[i])
+					if vi == 0 {
+						continue
+					}
+					// Upper triangle only; mirrored below
+					for j := i; j < dims; j++ {
+						row[j] += vi * float64(v[j])
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := 0; i < dims; i++ {
+		for j := i; j < dims; j++ {
+			moment[i*dims+j] /= n
+			moment[j*dims+i] = moment[i*dims+j]
+		}
+	}
+	return moment
+}
+
+// randomizedBasis returns width orthonormal columns spanning (nearly) the
+// top eigenvectors of the symmetric dims x dims matrix m
+func randomizedBasis(m []float64, dims, width int) [][]float64 {
+	rng := rand.New(rand.NewPCG(1, 2))
+	q := make([][]float64, width)
+	for c := range q {
+		q[c] = make([]float64, dims)
+		for i := range q[c] {
+			q[c][i] = rng.NormFloat64()
+		}
+	}
+	orthonormalize(q)
+
+	next := make([][]float64, width)
+	for c := range next {
+		next[c] = make([]float64, dims)
+	}
+	for iter := 0; iter < subspaceIterations; iter++ {
+		multiplyColumns(m, q, next)
+		q, next = next, q
+		orthonormalize(q)
+	}
+	return q
+}
+
+// multiplyColumns sets out[c] = m * q[c] for the square matrix m
+func multiplyColumns(m []float64, q, out [][]float64) {
+	dims := len(q[0])
+	columns := make(chan int, len(q))
+	for c := range q {
+		columns <- c
+	}
+	close(columns)
+
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.GOMAXPROCS(0); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range columns {
+				col := q[c]
+				for i := 0; i < dims; i++ {
+					out[c][i] = dot(m[i*dims:(i+1)*dims], col)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func dot(a, b []float64) float64 {
+	var sum float64
+	for i, v := range a {
+		sum += v * b[i]
+	}
+	return sum
+}
+
+// orthonormalize makes the columns of q orthonormal with Gram-Schmidt, run
+// twice per column since one pass loses orthogonality when columns are
+// nearly dependent. A column with nothing left after removing the earlier
+// ones (the data has lower rank than the basis) is replaced by a random
+// direction so the basis keeps its width.
+func orthonormalize(q [][]float64) {
+	rng := rand.New(rand.NewPCG(3, 4))
+	for c, col := range q {
+		for attempt := 0; ; attempt++ {
+			before := math.Sqrt(dot(col, col))
+			for pass := 0; pass < 2; pass++ {
+				for _, prev := range q[:c] {
+					d := dot(col, prev)
+					for i, v := range prev {
+						col[i] -= d * v
+					}
+				}
+			}
+
+			norm := math.Sqrt(dot(col, col))
+			if norm > 1e-8*before && norm > 0 || attempt == 3 {
+				for i := range col {
+					col[i] /= norm
+				}
+				break
+			}
+			for i := range col {
+				col[i] = rng.NormFloat64()
+			}
+		}
+	}
+}
+
+// projectMoment returns basis^T * m * basis, len(basis) square
+func projectMoment(m []float64, basis [][]float64, dims int) []float64 {
+	width := len(basis)
+	mb := make([][]float64, width)
+	for c := range mb {
+		mb[c] = make([]float64, dims)
+	}
+	multiplyColumns(m, basis, mb)
+
+	small := make([]float64, width*width)
+	for a := 0; a < width; a++ {
+		for b := a; b < width; b++ {
+			sum := dot(basis[a], mb[b])
+			small[a*width+b] = sum
+			small[b*width+a] = sum
+		}
+	}
+	return small
+}
+
+// jacobiEigen diagonalizes the symmetric n x n matrix a (destroying it) by
+// cyclic Jacobi rotations. It returns the eigenvalues and the eigenvectors
+// as the columns of an n x n matrix.
+func jacobiEigen(a []float64, n int) ([]float64, []float64) {
+	v := make([]float64, n*n)
+	for i := 0; i < n; i++ {
+		v[i*n+i] = 1
+	}
+
+	for sweep := 0; sweep < 50; sweep++ {
+		var off, total float64
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				sq := a[i*n+j] * a[i*n+j]
+				total += sq
+				if i != j {
+					off += sq
+				}
+			}
+		}
+		if off <= 1e-22*total || off == 0 {
+			break
+		}
+
+		for p := 0; p < n-1; p++ {
+			for q := p + 1; q < n; q++ {
+				apq := a[p*n+q]
+				if apq == 0 {
+					continue
+				}
+				theta := (a[q*n+q] - a[p*n+p]) / (2 * apq)
+				t := math.Copysign(1, theta) / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+
+				for k := 0; k < n; k++ {
+					akp, akq := a[k*n+p], a[k*n+q]
+					a[k*n+p] = c*akp - s*akq
+					a[k*n+q] = s*akp + c*akq
+				}
+				for k := 0; k < n; k++ {
+					apk, aqk := a[p*n+k], a[q*n+k]
+					a[p*n+k] = c*apk - s*aqk
+					a[q*n+k] = s*apk + c*aqk
+				}
+				for k := 0; k < n; k++ {
+					vkp, vkq := v[k*n+p], v[k*n+q]
+					v[k*n+p] = c*vkp - s*vkq
+					v[k*n+q] = s*vkp + c*vkq
+				}
+			}
+		}
+	}
+
+	values := make([]float64, n)
+	for i := 0; i < n; i++ {
+		values[i] = a[i*n+i]
+	}
+	return values, v
+}
@@ -0,0 +1,226 @@
+package types
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"testing"
+)
+
+// latentVectors returns n dims-wide vectors lying near a rank-latent
+// subspace, like real embeddings, whose variance is spread over every
+// coordinate so that truncation can't find it
+func latentVectors(n, dims, latent int, seed uint64) [][]float32 {
+	rng := rand.New(rand.NewPCG(seed, seed))
+	basis := make([][]float64, latent)
+	for i := range basis {
+		basis[i] = make([]float64, dims)
+		for j := range basis[i] {
+			basis[i][j] = rng.NormFloat64() / math.Sqrt(float64(dims))
+		}
+	}
+
+	vectors := make([][]float32, n)
+	for v := range vectors {
+		vec := make([]float32, dims)
+		for _, row := range basis {
+			z := rng.NormFloat64()
+			for j, b := range row {
+				vec[j] += float32(z * b)
+			}
+		}
+		for j := range vec {
+			vec[j] += float32(rng.NormFloat64() * 0.02)
+		}
+		vectors[v] = vec
+	}
+	return vectors
+}
+
+// vectorTree stores 512-wide vectors as tree keys
+func vectorTree(t *testing.T, vectors [][]float32) *Tree {
+	t.Helper()
+	tree := NewTree()
+	for i, vec := range vectors {
+		var key [512]float32
+		copy(key[:], vec)
+		if err := tree.Insert(key, fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tree
+}
+
+// truncation keeps the first dims coordinates of a tree key
+func truncation(dims int) *Projection {
+	p := &Projection{InputDims: 512, OutputDims: dims, Matrix: make([]float32, dims*512)}
+	for i := 0; i < dims; i++ {
+		p.Matrix[i*512+i] = 1
+	}
+	return p
+}
+
+// Nearest neighbours survive PCA far better than truncation to the same width
+func TestReprojectionKeepsNeighbours(t *testing.T) {
+	vectors := latentVectors(400, 512, 24, 1)
+	before := vectorTree(t, vectors)
+	sample := SampleIndices(len(vectors), 50)
+
+	overlap := func(p *Projection) float64 {
+		t.Helper()
+		after, err := before.Reproject(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		o, err := NeighborOverlap(before, after, sample, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return o
+	}
+
+	pca, err := TrainProjection(vectors, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	random, err := RandomProjection(512, 128, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trained, jl, truncated := overlap(pca), overlap(random), overlap(truncation(32))
+	t.Logf("top-10 overlap: PCA to 32 %.3f, random to 128 %.3f, truncation to 32 %.3f", trained, jl, truncated)
+
+	if trained < 0.9 {
+		t.Errorf("PCA to 32 dimensions kept %.3f of each top-10, want at least 0.9", trained)
+	}
+	if jl < 0.6 {
+		t.Errorf("random projection to 128 dimensions kept %.3f of each top-10, want at least 0.6", jl)
+	}
+	if truncated >= trained-0.2 {
+		t.Errorf("truncation kept %.3f, close to PCA's %.3f", truncated, trained)
+	}
+}
+
+// A projection stored in the tree takes wider vectors than the keys hold
+func TestProjectionTakesWideVectors(t *testing.T) {
+	wide := latentVectors(300, 1536, 16, 2)
+	p, err := TrainProjection(wide, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.InputDims != 1536 || p.OutputDims != 64 {
+		t.Fatalf("trained a %d -> %d projection", p.InputDims, p.OutputDims)
+	}
+
+	// PCA components are orthonormal
+	for a := 0; a < p.OutputDims; a++ {
+		for b := a; b < p.OutputDims; b++ {
+			var d float64
+			for j := 0; j < p.InputDims; j++ {
+				d += float64(p.Matrix[a*p.InputDims+j]) * float64(p.Matrix[b*p.InputDims+j])
+			}
+			want := 0.0
+			if a == b {
+				want = 1
+			}
+			if math.Abs(d-want) > 1e-3 {
+				t.Fatalf("components %d and %d have dot product %.4f", a, b, d)
+			}
+		}
+	}
+
+	tree := NewTree()
+	tree.Projection = p
+	if tree.VectorDims() != 1536 {
+		t.Errorf("tree takes %d-dimension vectors, want 1536", tree.VectorDims())
+	}
+	key, err := tree.VectorKey(wide[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 64; i < 512; i++ {
+		if key[i] != 0 {
+			t.Fatalf("key dimension %d is %v past the projection's 64", i, key[i])
+		}
+	}
+	if _, err := tree.VectorKey(wide[0][:512]); err == nil {
+		t.Error("512-dimension vector accepted by a 1536-dimension projection")
+	}
+}
+
+// Reprojecting a projected tree chains the projections, so callers keep
+// inserting vectors of the original width
+func TestReprojectChainsProjections(t *testing.T) {
+	vectors := latentVectors(100, 768, 8, 3)
+	first, err := RandomProjection(768, 512, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := NewTree()
+	tree.Projection = first
+	tree.Radii = map[string]float32{"similar": 0.1}
+	for i, vec := range vectors {
+		key, err := tree.VectorKey(vec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tree.Insert(key, fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	second := truncation(64)
+	small, err := tree.Reproject(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if small.Projection.InputDims != 768 || small.Projection.OutputDims != 64 || small.Radii != nil {
+		t.Errorf("reprojected tree has projection %d -> %d and radii %v", small.Projection.InputDims, small.Projection.OutputDims, small.Radii)
+	}
+	for i, vec := range vectors[:10] {
+		key, err := small.VectorKey(vec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for d := range key {
+			if diff := math.Abs(float64(key[d] - small.Nodes[i].Key[d])); diff > 1e-3 {
+				t.Fatalf("node %d dimension %d: chained projection gives %v, reprojected key %v", i, d, key[d], small.Nodes[i].Key[d])
+			}
+		}
+	}
+
+	if _, err := tree.Reproject(&Projection{InputDims: 768, OutputDims: 64, Matrix: make([]float32, 768*64)}); err == nil {
+		t.Error("reprojection not taking tree keys accepted")
+	}
+}
+
+func TestTrainProjectionRejects(t *testing.T) {
+	vectors := latentVectors(20, 32, 4, 5)
+	cases := []struct {
+		vectors [][]float32
+		dims    int
+		want    string
+	}{
+		{nil, 8, "no training vectors"},
+		{vectors, 0, "target dimensions"},
+		{vectors, 33, "target dimensions"},
+		{vectors[:5], 8, "need at least 8 training vectors"},
+		{append(vectors[:10:10], []float32{1, 2}), 4, "training vector 10 has 2 dimensions"},
+	}
+	for _, tc := range cases {
+		if _, err := TrainProjection(tc.vectors, tc.dims); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%d vectors to %d dimensions: %v, want %q", len(tc.vectors), tc.dims, err, tc.want)
+		}
+	}
+
+	for _, p := range []*Projection{
+		{InputDims: 0, OutputDims: 8},
+		{InputDims: 8, OutputDims: 513},
+		{InputDims: 8, OutputDims: 8, Matrix: make([]float32, 63)},
+	} {
+		if p.Validate() == nil {
+			t.Errorf("projection %d -> %d with %d entries validated", p.InputDims, p.OutputDims, len(p.Matrix))
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package types
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Radius words name search epsilons so callers can ask for "similar" rather
+// than a number. The defaults are starting points for 512-dimension Titan
+// embeddings ("related" is the CLI's default epsilon); how far apart two
+// texts land depends on the model, so databases can carry their own
+// calibrated values in Tree.Radii (see FitRadius).
+var (
+	radiusMu      sync.RWMutex
+	radiusMapping = map[string]float32{
+		"identical": 0.05,
+		"similar":   0.2,
+		"related":   0.3,
+		"distant":   0.5,
+	}
+)
+
+// RegisterRadius adds word to the global radius table or retunes it. It
+// panics on an epsilon that is not a positive number.
+func RegisterRadius(word string, epsilon float32) {
+	if !(epsilon > 0) || math.IsInf(float64(epsilon), 0) {
+		panic("types: RegisterRadius called with invalid epsilon for " + word)
+	}
+
+	radiusMu.Lock()
+	defer radiusMu.Unlock()
+	radiusMapping[radiusWord(word)] = epsilon
+}
+
+// GetRadiusValue looks word up in the global radius table
+func GetRadiusValue(word string) (float32, bool) {
+	radiusMu.RLock()
+	defer radiusMu.RUnlock()
+	epsilon, ok := radiusMapping[radiusWord(word)]
+	return epsilon, ok
+}
+
+// GetRadiusValue looks word up in the tree's own radius table first, then in
+// the global one
+func (t *Tree) GetRadiusValue(word string) (float32, bool) {
+	if epsilon, ok := t.Radii[radiusWord(word)]; ok {
+		return epsilon, true
+	}
+	return GetRadiusValue(word)
+}
+
+// RadiusTable is every radius word the tree understands, with the tree's own
+// values overriding the global ones
+func (t *Tree) RadiusTable() map[string]float32 {
+	radiusMu.RLock()
+	table := make(map[string]float32, len(radiusMapping)+len(t.Radii))
+	for word, epsilon := range radiusMapping {
+		table[word] = epsilon
+	}
+	radiusMu.RUnlock()
+
+	for word, epsilon := range t.Radii {
+		table[word] = epsilon
+	}
+	return table
+}
+
+func radiusWord(word string) string {
+	return strings.ToLower(strings.TrimSpace(word))
+}
+
+// BoxDistance is the largest per-dimension difference between a and b: the
+// smallest epsilon whose search box around a contains b
+func BoxDistance(a, b *[512]float32) float32 {
+	var maxDiff float32
+	for dim := 0; dim < 512; dim++ {
+		diff := a[dim] - b[dim]
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff > maxDiff {
+			maxDiff = diff
+		}
+	}
+	return maxDiff
+}
+
+// RadiusFit is the epsilon FitRadius chose and how well it separates
+// the labelled pairs
+type RadiusFit struct {
+	Epsilon           float32 `json:"epsilon"`
+	Positives         int     `json:"positives"`
+	Negatives         int     `json:"negatives"`
+	Recall            float64 `json:"recall"`              // share of positive pairs inside the box
+	FalsePositiveRate float64 `json:"false_positive_rate"` // share of negative pairs inside the box
+}
+
+// FitRadius picks the epsilon that best separates pairs that should
+// match (positive) from pairs that should not, given each pair's
+// BoxDistance. It maximises recall minus false positive rate, placing the
+// cut halfway between neighbouring distances; with no negatives it is the
+// largest positive distance. It returns false when there are no positives.
+func FitRadius(positive, negative []float32) (RadiusFit, bool) {
+	if len(positive) == 0 {
+		return RadiusFit{}, false
+	}
+
+	pos := append([]float32(nil), positive...)
+	neg := append([]float32(nil), negative...)
+	sort.Slice(pos, func(i, j int) bool { return pos[i] < pos[j] })
+	sort.Slice(neg, func(i, j int) bool { return neg[i] < neg[j] })
+
+	fit := RadiusFit{Positives: len(pos), Negatives: len(neg)}
+	if len(neg) == 0 {
+		fit.Epsilon = pos[len(pos)-1]
+		fit.Recall = 1
+		return fit, true
+	}
+
+	// Candidate cuts are the positive distances themselves: a cut anywhere
+	// else can be moved down to the next positive without losing recall
+	bestScore := math.Inf(-1)
+	for i, d := range pos {
+		if i+1 < len(pos) && pos[i+1] == d {
+			continue
+		}
+		inside := sort.Search(len(neg), func(j int) bool { return neg[j] > d })
+		recall := float64(i+1) / float64(len(pos))
+		fpr := float64(inside) / float64(len(neg))
+		if score := recall - fpr; score > bestScore {
+			bestScore = score
+			fit.Recall = recall
+			fit.FalsePositiveRate = fpr
+			fit.Epsilon = d
+			if inside < len(neg) {
+				// Halfway to the next negative keeps the same counts
+				// with some margin for unseen pairs
+				next := neg[inside]
+				if i+1 < len(pos) && pos[i+1] < next {
+					next = pos[i+1]
+				}
+				fit.Epsilon = d + (next-d)/2
+			}
+		}
+	}
+	return fit, true
+}
@@ -0,0 +1,90 @@
+package types
+
+import (
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"testing"
+)
+
+// sequentialIndex sorts one dimension at a time the obvious way, as the
+// parallel RebuildIndex must
+func sequentialIndex(tree *Tree) [512][]int32 {
+	ids := make([]int32, 0, tree.vectorCount())
+	for i := range tree.Nodes {
+		ids = append(ids, int32(i))
+	}
+	for j := range tree.alt {
+		ids = append(ids, -int32(j)-1)
+	}
+
+	var index [512][]int32
+	for dim := range index {
+		sorted := slices.Clone(ids)
+		sort.SliceStable(sorted, func(a, b int) bool {
+			va, vb := tree.keyAt(sorted[a])[dim], tree.keyAt(sorted[b])[dim]
+			if va != vb {
+				return va < vb
+			}
+			return indexOrder(sorted[a]) < indexOrder(sorted[b])
+		})
+		index[dim] = sorted
+	}
+	return index
+}
+
+func TestRebuildIndexMatchesSequential(t *testing.T) {
+	rng := rand.New(rand.NewPCG(17, 18))
+	tree := loadedTree(t, rng)
+
+	want := sequentialIndex(tree)
+	for dim := range want {
+		if !slices.Equal(tree.Index[dim], want[dim]) {
+			t.Fatalf("dimension %d: rebuilt %v, sequential %v", dim, tree.Index[dim], want[dim])
+		}
+	}
+
+	// A rebuild of the same nodes reuses every dimension's slice
+	var before [512]*int32
+	for dim := range tree.Index {
+		before[dim] = &tree.Index[dim][0]
+	}
+	tree.RebuildIndex()
+	for dim := range tree.Index {
+		if &tree.Index[dim][0] != before[dim] {
+			t.Fatalf("dimension %d was reallocated", dim)
+		}
+		if !slices.Equal(tree.Index[dim], want[dim]) {
+			t.Fatalf("dimension %d changed on the second rebuild", dim)
+		}
+	}
+
+	// and so does one after deletes, which only shrink it
+	tree.Nodes = tree.Nodes[:len(tree.Nodes)/2]
+	tree.RebuildIndex()
+	want = sequentialIndex(tree)
+	for dim := range tree.Index {
+		if &tree.Index[dim][0] != before[dim] || !slices.Equal(tree.Index[dim], want[dim]) {
+			t.Fatalf("dimension %d after shrinking: reallocated or wrong", dim)
+		}
+	}
+}
+
+// BenchmarkRebuildIndex rebuilds the index of 100k random keys; compare
+// -cpu 1 with the default to see what the worker pool buys
+func BenchmarkRebuildIndex(b *testing.B) {
+	rng := rand.New(rand.NewPCG(19, 20))
+	tree := NewTree()
+	tree.Nodes = make([]Node, 100000)
+	for i := range tree.Nodes {
+		for d := range tree.Nodes[i].Key {
+			tree.Nodes[i].Key[d] = rng.Float32()*2 - 1
+		}
+	}
+	tree.RebuildIndex()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree.RebuildIndex()
+	}
+}
@@ -0,0 +1,180 @@
+package types
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// RecallResult measures the indexed search at one epsilon, threshold and
+// MinDimMatches setting against exact nearest neighbours
+type RecallResult struct {
+	Epsilon       float32       `json:"epsilon"`
+	Threshold     float32       `json:"threshold"`
+	MinDimMatches int           `json:"min_dim_matches"` // 0 means every dimension
+	MaxDistance   float32       `json:"max_distance"`
+	Recall        float64       `json:"recall"`       // mean recall@k over the queries
+	MeanResults   float64       `json:"mean_results"` // hits per query, at most k
+	MeanScored    float64       `json:"mean_scored"`  // candidates whose distance was computed, per query
+	MeanSkipped   float64       `json:"mean_skipped"` // candidates the pre-filter rejected unscored, per query
+	P50           time.Duration `json:"p50"`
+	P95           time.Duration `json:"p95"`
+}
+
+// ExactSearch ranks every node by distance to query and returns the k
+// closest, ties broken by position like SearchScored. It is the brute-force
+// ground truth the index approximates.
+func (t *Tree) ExactSearch(query [512]float32, k int) []ScoredNode {
+	if t.Normalize {
+		NormalizeVector(&query)
+	}
+
+	candidates := make([]ScoredNode, len(t.Nodes))
+	for i := range t.Nodes {
+		key := &t.Nodes[i].Key
+		var sumSquares float32
+		for dim := 0; dim < 512; dim++ {
+			diff := query[dim] - key[dim]
+			sumSquares += diff * diff
+		}
+		candidates[i] = ScoredNode{Distance: float32(math.Sqrt(float64(sumSquares))), index: int32(i)}
+	}
+
+	if len(candidates) > k {
+		selectTopK(candidates, k)
+		candidates = candidates[:k]
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].less(candidates[j])
+	})
+
+	for i := range candidates {
+		candidates[i].Node = t.Nodes[candidates[i].index]
+	}
+	return candidates
+}
+
+// EvaluateRecall computes exact top-k neighbours for each query, then runs
+// SearchScored at every combination of epsilon, threshold and minimum
+// dimension matches (see SearchOptions.MinDimMatches), reporting recall@k
+// (the share of the true neighbours the search found), the latency of the
+// indexed search and how many candidates it scored. Queries run one at a
+// time so latencies are not inflated by contention.
+func EvaluateRecall(t *Tree, queries [][512]float32, k int, epsilons, thresholds []float32, minDimMatches []int) ([]RecallResult, error) {
+	if k <= 0 {
+		return nil, fmt.Errorf("k must be positive, got %d", k)
+	}
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("no queries")
+	}
+	if len(thresholds) == 0 {
+		thresholds = []float32{0}
+	}
+	if len(minDimMatches) == 0 {
+		minDimMatches = []int{0}
+	}
+	for _, m := range minDimMatches {
+		if m < 0 || m > 512 {
+			return nil, fmt.Errorf("min dimension matches must be between 0 and 512, got %d", m)
+		}
+	}
+
+	truth := make([]map[int32]bool, len(queries))
+	for q, query := range queries {
+		exact := t.ExactSearch(query, k)
+		truth[q] = make(map[int32]bool, len(exact))
+		for _, hit := range exact {
+			truth[q][hit.index] = true
+		}
+	}
+
+	t.ensureIndex()
+
+	results := make([]RecallResult, 0, len(epsilons)*len(thresholds)*len(minDimMatches))
+	latencies := make([]time.Duration, len(queries))
+	for _, epsilon := range epsilons {
+		for _, threshold := range thresholds {
+			for _, matches := range minDimMatches {
+				result := RecallResult{
+					Epsilon:       epsilon,
+					Threshold:     threshold,
+					MinDimMatches: matches,
+					MaxDistance:   LegacyMaxDistance(epsilon, threshold),
+				}
+
+				var recallSum float64
+				var hits int
+				var counts CandidateCounts
+				opts := SearchOptions{MinDimMatches: matches, counts: &counts}
+				for q, query := range queries {
+					start := time.Now()
+					found, _ := t.searchScored(query, epsilon, result.MaxDistance, k, &opts)
+					latencies[q] = time.Since(start)
+
+					hits += len(found)
+					if len(truth[q]) == 0 {
+						recallSum++
+						continue
+					}
+					matched := 0
+					for _, hit := range found {
+						if truth[q][hit.index] {
+							matched++
+						}
+					}
+					recallSum += float64(matched) / float64(len(truth[q]))
+				}
+
+				result.Recall = recallSum / float64(len(queries))
+				result.MeanResults = float64(hits) / float64(len(queries))
+				result.MeanScored = float64(counts.Scored) / float64(len(queries))
+				result.MeanSkipped = float64(counts.Prefiltered) / float64(len(queries))
+
+				sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+				result.P50 = latencies[(len(latencies)-1)*50/100]
+				result.P95 = latencies[(len(latencies)-1)*95/100]
+
+				results = append(results, result)
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// NeighborOverlap measures how well after, a reprojected copy of before
+// (same nodes in the same order), keeps each node's exact top-k
+// neighbourhood. Each sampled node's own key is the query in both trees; the
+// result is the mean share of its k nearest neighbours in before that are
+// also among its k nearest in after.
+func NeighborOverlap(before, after *Tree, sample []int, k int) (float64, error) {
+	if len(before.Nodes) != len(after.Nodes) {
+		return 0, fmt.Errorf("trees hold %d and %d nodes", len(before.Nodes), len(after.Nodes))
+	}
+	if k <= 0 {
+		return 0, fmt.Errorf("k must be positive, got %d", k)
+	}
+	if len(sample) == 0 {
+		return 0, fmt.Errorf("no nodes to compare")
+	}
+
+	var sum float64
+	for _, i := range sample {
+		expected := before.ExactSearch(before.Nodes[i].Key, k)
+		found := after.ExactSearch(after.Nodes[i].Key, k)
+
+		want := make(map[int32]bool, len(expected))
+		for _, hit := range expected {
+			want[hit.index] = true
+		}
+		matched := 0
+		for _, hit := range found {
+			if want[hit.index] {
+				matched++
+			}
+		}
+		sum += float64(matched) / float64(len(expected))
+	}
+	return sum / float64(len(sample)), nil
+}
@@ -0,0 +1,209 @@
+package types
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RetentionStrategy decides which memories a size-capped database evicts first
+type RetentionStrategy string
+
+const (
+	EvictOldest       RetentionStrategy = "oldest"        // earliest inserted first (the default)
+	EvictImportance   RetentionStrategy = "importance"    // lowest ImportanceKey first, then oldest
+	EvictLeastMatched RetentionStrategy = "least-matched" // least recently accessed (see TrackAccess) first, then oldest
+)
+
+// ImportanceKey is the metadata key EvictImportance ranks by: a number, or
+// low, medium or high (1, 2 and 3). Nodes without one rank lowest.
+const ImportanceKey = "importance"
+
+// Retention caps a database at MaxNodes nodes and MaxBytes bytes on disk,
+// evicting by Strategy after each flush that goes over. 0 leaves a limit
+// off. It is kept in the database's Config so every client enforces it.
+type Retention struct {
+	MaxNodes int               `json:"max_nodes,omitempty"`
+	MaxBytes int64             `json:"max_bytes,omitempty"`
+	Strategy RetentionStrategy `json:"strategy,omitempty"` // empty is EvictOldest
+}
+
+// ParseRetention reads a comma-separated spec such as
+// "nodes=100000,bytes=50MB,strategy=importance". Bytes take a KB, MB or GB
+// suffix. "none" or an empty spec is nil, no cap.
+func ParseRetention(spec string) (*Retention, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == "none" {
+		return nil, nil
+	}
+
+	r := &Retention{}
+	for _, part := range strings.Split(spec, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, fmt.Errorf("retention %q: want name=value", part)
+		}
+		var err error
+		switch strings.TrimSpace(name) {
+		case "nodes":
+			r.MaxNodes, err = strconv.Atoi(strings.TrimSpace(value))
+		case "bytes":
+			r.MaxBytes, err = parseByteSize(value)
+		case "strategy":
+			r.Strategy = RetentionStrategy(strings.TrimSpace(value))
+		default:
+			return nil, fmt.Errorf("retention %q: unknown setting %q (use nodes, bytes or strategy)", spec, name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("retention %q: %s: %v", spec, name, err)
+		}
+	}
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseByteSize reads a byte count with an optional KB, MB or GB suffix
+func parseByteSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(s, unit.suffix) {
+			s, multiplier = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix)), unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * multiplier, nil
+}
+
+// Validate checks the limits are not negative and the strategy is known
+func (r *Retention) Validate() error {
+	if r.MaxNodes < 0 || r.MaxBytes < 0 {
+		return fmt.Errorf("retention limits must not be negative")
+	}
+	if r.MaxNodes == 0 && r.MaxBytes == 0 {
+		return fmt.Errorf("retention needs nodes or bytes")
+	}
+	switch r.Strategy {
+	case "", EvictOldest, EvictImportance, EvictLeastMatched:
+		return nil
+	}
+	return fmt.Errorf("unknown retention strategy %q (use oldest, importance or least-matched)", r.Strategy)
+}
+
+func (r *Retention) String() string {
+	if r == nil {
+		return "none"
+	}
+	var parts []string
+	if r.MaxNodes > 0 {
+		parts = append(parts, fmt.Sprintf("nodes=%d", r.MaxNodes))
+	}
+	if r.MaxBytes > 0 {
+		parts = append(parts, fmt.Sprintf("bytes=%d", r.MaxBytes))
+	}
+	return strings.Join(append(parts, "strategy="+string(r.strategy())), ",")
+}
+
+func (r *Retention) strategy() RetentionStrategy {
+	if r.Strategy == "" {
+		return EvictOldest
+	}
+	return r.Strategy
+}
+
+// Excess is how many nodes to evict from a database of nodes nodes taking
+// bytes on disk. The byte cap is met by estimating the size of a node from
+// the average, so a caller should check the size again after saving.
+func (r *Retention) Excess(nodes int, bytes int64) int {
+	if r == nil || nodes == 0 {
+		return 0
+	}
+	excess := 0
+	if r.MaxNodes > 0 && nodes > r.MaxNodes {
+		excess = nodes - r.MaxNodes
+	}
+	if r.MaxBytes > 0 && bytes > r.MaxBytes {
+		perNode := float64(bytes) / float64(nodes)
+		excess = max(excess, int(math.Ceil(float64(bytes-r.MaxBytes)/perNode)))
+	}
+	return min(excess, nodes)
+}
+
+// Evict deletes the n nodes the strategy values least. EvictLeastMatched
+// ranks nodes by their LastAccessedKey and then HitCountKey, counting hits
+// RecordAccess has not yet written, never-accessed nodes first, so it works
+// the same on a tree just loaded from disk. Ties go to the oldest node.
+// Evict returns how many nodes it deleted.
+func (t *Tree) Evict(n int, strategy RetentionStrategy) int {
+	if n <= 0 {
+		return 0
+	}
+	if n >= len(t.Nodes) {
+		return t.DeleteFunc(func(*Node) bool { return true })
+	}
+
+	order := make([]int, len(t.Nodes))
+	for i := range order {
+		order[i] = i
+	}
+	switch strategy {
+	case EvictImportance:
+		importance := make([]float64, len(t.Nodes))
+		for i := range t.Nodes {
+			importance[i] = nodeImportance(&t.Nodes[i])
+		}
+		sort.SliceStable(order, func(a, b int) bool { return importance[order[a]] < importance[order[b]] })
+	case EvictLeastMatched:
+		accessed := make([]access, len(t.Nodes))
+		for i := range t.Nodes {
+			accessed[i] = t.nodeAccess(i)
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			x, y := accessed[order[a]], accessed[order[b]]
+			if !x.last.Equal(y.last) {
+				return x.last.Before(y.last)
+			}
+			return x.hits < y.hits
+		})
+	}
+
+	evict := make([]bool, len(t.Nodes))
+	for _, i := range order[:n] {
+		evict[i] = true
+	}
+	// DeleteFunc visits the nodes in order
+	i := 0
+	return t.DeleteFunc(func(*Node) bool {
+		victim := evict[i]
+		i++
+		return victim
+	})
+}
+
+// nodeImportance reads ImportanceKey, 0 when it is missing or unreadable
+func nodeImportance(n *Node) float64 {
+	value := strings.TrimSpace(n.Metadata[ImportanceKey])
+	switch strings.ToLower(value) {
+	case "low":
+		return 1
+	case "medium":
+		return 2
+	case "high":
+		return 3
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil && !math.IsNaN(f) {
+		return f
+	}
+	return 0
+}
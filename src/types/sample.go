@@ -0,0 +1,90 @@
+package types
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sort"
+)
+
+// IndexedNode is a node together with its position in the database
+type IndexedNode struct {
+	Index int
+	Node  Node
+}
+
+// Norm is the L2 length of the node's key
+func (n IndexedNode) Norm() float64 {
+	return vectorNorm(&n.Node.Key)
+}
+
+// Reservoir keeps a uniform random sample of up to n nodes from a stream
+// of unknown length (Algorithm R), so a database can be sampled while it
+// is scanned from disk
+type Reservoir struct {
+	size  int
+	seen  int
+	nodes []IndexedNode
+	rng   *rand.Rand
+}
+
+// NewReservoir samples up to size nodes; a nil rng uses a random seed
+func NewReservoir(size int, rng *rand.Rand) *Reservoir {
+	if rng == nil {
+		rng = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	}
+	return &Reservoir{size: size, rng: rng}
+}
+
+// Add offers the next node of the stream; n is copied if it is kept
+func (r *Reservoir) Add(n *Node) {
+	index := r.seen
+	r.seen++
+
+	if len(r.nodes) < r.size {
+		r.nodes = append(r.nodes, IndexedNode{Index: index, Node: *n})
+		return
+	}
+	if j := r.rng.IntN(r.seen); j < r.size {
+		r.nodes[j] = IndexedNode{Index: index, Node: *n}
+	}
+}
+
+// Seen is how many nodes have been offered
+func (r *Reservoir) Seen() int {
+	return r.seen
+}
+
+// Nodes returns the sample in database order
+func (r *Reservoir) Nodes() []IndexedNode {
+	sample := make([]IndexedNode, len(r.nodes))
+	copy(sample, r.nodes)
+	sort.Slice(sample, func(i, j int) bool { return sample[i].Index < sample[j].Index })
+	return sample
+}
+
+// Sample returns up to n nodes chosen uniformly at random, in database order
+func (t *Tree) Sample(n int) []IndexedNode {
+	r := NewReservoir(n, nil)
+	for i := range t.Nodes {
+		r.Add(&t.Nodes[i])
+	}
+	return r.Nodes()
+}
+
+// GetNode returns the node at position i
+func (t *Tree) GetNode(i int) (Node, error) {
+	if i < 0 || i >= len(t.Nodes) {
+		return Node{}, fmt.Errorf("node index %d out of range: the tree has %d nodes", i, len(t.Nodes))
+	}
+	return t.Nodes[i], nil
+}
+
+// ForEach calls fn with each node and its position in insertion order
+// until fn returns false. fn must not insert or delete nodes.
+func (t *Tree) ForEach(fn func(i int, n *Node) bool) {
+	for i := range t.Nodes {
+		if !fn(i, &t.Nodes[i]) {
+			return
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package types
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ValueMatcher reports whether a stored value matches a grep pattern
+type ValueMatcher func(value string) bool
+
+// NewValueMatcher builds a substring or regex matcher. Matching is
+// case-insensitive unless caseSensitive is set.
+func NewValueMatcher(pattern string, regex, caseSensitive bool) (ValueMatcher, error) {
+	if regex {
+		if !caseSensitive {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	}
+
+	if caseSensitive {
+		return func(value string) bool {
+			return strings.Contains(value, pattern)
+		}, nil
+	}
+
+	lower := strings.ToLower(pattern)
+	return func(value string) bool {
+		return strings.Contains(strings.ToLower(value), lower)
+	}, nil
+}
+
+// ScanValues returns up to limit nodes whose value matches pattern, in
+// insertion order. A limit of 0 returns every match.
+func (t *Tree) ScanValues(pattern string, regex, caseSensitive bool, limit int) ([]Node, error) {
+	match, err := NewValueMatcher(pattern, regex, caseSensitive)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []Node
+	for i := range t.Nodes {
+		if !match(t.Nodes[i].Value) {
+			continue
+		}
+		results = append(results, t.Nodes[i])
+		if limit > 0 && len(results) >= limit {
+			break
+		}
+	}
+
+	return results, nil
+}
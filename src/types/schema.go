@@ -0,0 +1,210 @@
+package types
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldType is the type a schema declares for a metadata field. Values are
+// still stored as strings; the type decides which strings are valid and how
+// filters compare them.
+type FieldType string
+
+const (
+	FieldString FieldType = "string"
+	FieldInt    FieldType = "int"
+	FieldFloat  FieldType = "float"
+	FieldBool   FieldType = "bool"
+	FieldTime   FieldType = "time" // RFC 3339
+)
+
+// FieldSpec declares one metadata field
+type FieldSpec struct {
+	Type     FieldType `json:"type"`
+	Required bool      `json:"required,omitempty"`
+}
+
+// Schema declares the metadata a database's nodes carry. Inserts whose
+// metadata breaks it fail with a *SchemaError, and filters compare declared
+// fields by value, so 5, 5.0 and 5e0 all match an int field equal to 5. A
+// tree without a schema (nil) accepts any metadata. The schema is persisted
+// in the file header.
+type Schema struct {
+	Fields map[string]FieldSpec `json:"fields"`
+
+	// Strict rejects fields the schema does not declare, catching typos;
+	// databases holding documents must then declare doc_id and the other
+	// chunk fields too
+	Strict bool `json:"strict,omitempty"`
+}
+
+// SchemaError is metadata that does not fit a Schema
+type SchemaError struct {
+	Field  string
+	Value  string
+	Reason string
+}
+
+func (e *SchemaError) Error() string {
+	if e.Value == "" {
+		return fmt.Sprintf("metadata %q %s", e.Field, e.Reason)
+	}
+	return fmt.Sprintf("metadata %q: %q %s", e.Field, e.Value, e.Reason)
+}
+
+// ParseSchemaFields reads "name=type[,name=type...]", where type is one of
+// string, int, float, bool or time and a trailing '!' marks the field
+// required, e.g. "category=string!,count=int"
+func ParseSchemaFields(spec string) (map[string]FieldSpec, error) {
+	fields := make(map[string]FieldSpec)
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, typ, ok := strings.Cut(pair, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid schema field %q (want name=type)", pair)
+		}
+		field := FieldSpec{Type: FieldType(strings.TrimSuffix(typ, "!")), Required: strings.HasSuffix(typ, "!")}
+		if err := field.Type.validate(); err != nil {
+			return nil, fmt.Errorf("field %q: %w", name, err)
+		}
+		fields[name] = field
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no fields in %q", spec)
+	}
+	return fields, nil
+}
+
+func (t FieldType) validate() error {
+	switch t {
+	case FieldString, FieldInt, FieldFloat, FieldBool, FieldTime:
+		return nil
+	}
+	return fmt.Errorf("unknown field type %q (use string, int, float, bool or time)", t)
+}
+
+// Validate checks the field types; a nil schema is valid
+func (s *Schema) Validate() error {
+	if s == nil {
+		return nil
+	}
+	for name, field := range s.Fields {
+		if err := field.Type.validate(); err != nil {
+			return fmt.Errorf("field %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Check returns a *SchemaError for the first problem with metadata, in
+// field name order: a missing required field, a value that does not parse
+// as its field's type or, for a strict schema, an undeclared field
+func (s *Schema) Check(metadata map[string]string) error {
+	if s == nil {
+		return nil
+	}
+
+	for _, name := range s.FieldNames() {
+		field := s.Fields[name]
+		v, ok := metadata[name]
+		if !ok {
+			if field.Required {
+				return &SchemaError{Field: name, Reason: "is required"}
+			}
+			continue
+		}
+		if _, err := parseField(field.Type, v); err != nil {
+			return &SchemaError{Field: name, Value: v, Reason: "is not a valid " + string(field.Type)}
+		}
+	}
+
+	if s.Strict {
+		names := make([]string, 0, len(metadata))
+		for name := range metadata {
+			if _, ok := s.Fields[name]; !ok {
+				names = append(names, name)
+			}
+		}
+		if len(names) > 0 {
+			sort.Strings(names)
+			return &SchemaError{Field: names[0], Reason: "is not in the schema"}
+		}
+	}
+	return nil
+}
+
+// FieldNames returns the declared fields in name order
+func (s *Schema) FieldNames() []string {
+	if s == nil {
+		return nil
+	}
+	names := make([]string, 0, len(s.Fields))
+	for name := range s.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// equal compares a stored value with a filter value by the field's declared
+// type. Undeclared fields, and values that do not parse, compare as strings.
+func (s *Schema) equal(name, stored, want string) bool {
+	if stored == want {
+		return true
+	}
+	if s == nil {
+		return false
+	}
+	field, ok := s.Fields[name]
+	if !ok || field.Type == FieldString {
+		return false
+	}
+
+	a, err := parseField(field.Type, stored)
+	if err != nil {
+		return false
+	}
+	b, err := parseField(field.Type, want)
+	if err != nil {
+		return false
+	}
+	if field.Type == FieldTime {
+		return a.(time.Time).Equal(b.(time.Time))
+	}
+	return a == b
+}
+
+// parseField parses v as t: int64, float64, bool or time.Time. Ints accept
+// integral floats such as "5.0" and "5e0", which is how a number can come
+// back from a JSON round trip.
+func parseField(t FieldType, v string) (any, error) {
+	switch t {
+	case FieldInt:
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n, nil
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f != math.Trunc(f) || math.Abs(f) > 1<<53 {
+			return nil, fmt.Errorf("not an int")
+		}
+		return int64(f), nil
+	case FieldFloat:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || math.IsNaN(f) {
+			return nil, fmt.Errorf("not a float")
+		}
+		return f, nil
+	case FieldBool:
+		return strconv.ParseBool(v)
+	case FieldTime:
+		return time.Parse(time.RFC3339Nano, v)
+	}
+	return v, nil
+}
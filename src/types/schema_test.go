@@ -0,0 +1,199 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseSchemaFields(t *testing.T) {
+	fields, err := ParseSchemaFields(" category=string!, count=int ,score=float,done=bool,at=time,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]FieldSpec{
+		"category": {Type: FieldString, Required: true},
+		"count":    {Type: FieldInt},
+		"score":    {Type: FieldFloat},
+		"done":     {Type: FieldBool},
+		"at":       {Type: FieldTime},
+	}
+	if len(fields) != len(want) {
+		t.Fatalf("parsed %v, want %v", fields, want)
+	}
+	for name, spec := range want {
+		if fields[name] != spec {
+			t.Errorf("%s parsed as %+v, want %+v", name, fields[name], spec)
+		}
+	}
+
+	for _, bad := range []string{"", "count", "=int", "count=integer", "count=int!!"} {
+		if _, err := ParseSchemaFields(bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
+
+func TestSchemaCheck(t *testing.T) {
+	schema := &Schema{Fields: map[string]FieldSpec{
+		"category": {Type: FieldString, Required: true},
+		"count":    {Type: FieldInt},
+		"score":    {Type: FieldFloat},
+		"done":     {Type: FieldBool},
+		"at":       {Type: FieldTime},
+	}}
+
+	cases := []struct {
+		metadata map[string]string
+		field    string // of the *SchemaError, "" for none
+	}{
+		{map[string]string{"category": "notes"}, ""},
+		{map[string]string{"category": "notes", "count": "3", "score": "0.5", "done": "true", "at": "2024-02-29T12:00:00+13:00", "catagory": "typo"}, ""},
+		{map[string]string{"count": "3"}, "category"},
+		{map[string]string{"category": "notes", "count": "three"}, "count"},
+		{map[string]string{"category": "notes", "count": "3.5"}, "count"},
+		{map[string]string{"category": "notes", "score": "NaN"}, "score"},
+		{map[string]string{"category": "notes", "done": "yes"}, "done"},
+		{map[string]string{"category": "notes", "at": "yesterday"}, "at"},
+		// Fields are checked in name order
+		{map[string]string{"at": "never", "count": "x"}, "at"},
+	}
+	for _, tc := range cases {
+		err := schema.Check(tc.metadata)
+		var schemaErr *SchemaError
+		switch {
+		case tc.field == "" && err != nil:
+			t.Errorf("%v rejected: %v", tc.metadata, err)
+		case tc.field != "" && !errors.As(err, &schemaErr):
+			t.Errorf("%v: %v, want a *SchemaError", tc.metadata, err)
+		case tc.field != "" && schemaErr.Field != tc.field:
+			t.Errorf("%v: error names %q, want %q", tc.metadata, schemaErr.Field, tc.field)
+		}
+	}
+
+	// Strict schemas catch the typo
+	schema.Strict = true
+	err := schema.Check(map[string]string{"category": "notes", "catagory": "typo"})
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) || schemaErr.Field != "catagory" {
+		t.Errorf("strict schema: %v, want catagory rejected", err)
+	}
+
+	var none *Schema
+	if err := none.Check(map[string]string{"anything": "goes"}); err != nil {
+		t.Errorf("nil schema: %v", err)
+	}
+	if err := (&Schema{Fields: map[string]FieldSpec{"n": {Type: "number"}}}).Validate(); err == nil {
+		t.Error("unknown field type validated")
+	}
+}
+
+func TestInsertChecksSchema(t *testing.T) {
+	tree := NewTree()
+	tree.Schema = &Schema{Fields: map[string]FieldSpec{"count": {Type: FieldInt, Required: true}}}
+	var key [512]float32
+	key[0] = 1
+
+	var schemaErr *SchemaError
+	if err := tree.InsertWithMetadata(key, "missing", nil); !errors.As(err, &schemaErr) {
+		t.Errorf("missing required field: %v, want a *SchemaError", err)
+	}
+	if err := tree.InsertWithMetadata(key, "wrong", map[string]string{"count": "many"}); !errors.As(err, &schemaErr) {
+		t.Errorf("wrong type: %v, want a *SchemaError", err)
+	}
+	if err := tree.InsertMulti([][512]float32{key}, "multi", map[string]string{"count": "many"}); !errors.As(err, &schemaErr) {
+		t.Errorf("multi-vector insert with the wrong type: %v, want a *SchemaError", err)
+	}
+	if len(tree.Nodes) != 0 {
+		t.Fatalf("rejected inserts stored %d nodes", len(tree.Nodes))
+	}
+	if err := tree.InsertWithMetadata(key, "fits", map[string]string{"count": "2"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Numbers decoded from JSON are float64s, which a client may re-encode as
+// "5", "5.0" or "5e0". An int field must match however the filter spells
+// the number.
+func TestSchemaCoercesJSONInts(t *testing.T) {
+	tree := NewTree()
+	var key [512]float32
+	key[0] = 1
+
+	var doc struct {
+		Metadata map[string]any `json:"metadata"`
+	}
+	if err := json.Unmarshal([]byte(`{"metadata": {"count": 5, "ratio": 0.25, "flag": true}}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+	metadata := make(map[string]string)
+	for k, v := range doc.Metadata {
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		metadata[k] = string(encoded)
+	}
+	if err := tree.InsertWithMetadata(key, "five", metadata); err != nil {
+		t.Fatal(err)
+	}
+
+	matches := func(field, want string) bool {
+		t.Helper()
+		return tree.CountWithFilter(&Filter{Metadata: map[string]string{field: want}}) == 1
+	}
+
+	// Without a schema only the exact string matches
+	if !matches("count", "5") || matches("count", "5.0") {
+		t.Fatal("schemaless filter did not compare as strings")
+	}
+
+	tree.Schema = &Schema{Fields: map[string]FieldSpec{
+		"count": {Type: FieldInt},
+		"ratio": {Type: FieldFloat},
+		"flag":  {Type: FieldBool},
+	}}
+	for _, want := range []string{"5", "5.0", "5e0", "0.5e1"} {
+		if !matches("count", want) {
+			t.Errorf("count filter %q did not match 5", want)
+		}
+	}
+	for _, want := range []string{"5.5", "6", "five", ""} {
+		if matches("count", want) {
+			t.Errorf("count filter %q matched 5", want)
+		}
+	}
+	if !matches("ratio", ".25") || !matches("ratio", "2.5e-1") || matches("ratio", "0.3") {
+		t.Error("float field did not compare by value")
+	}
+	if !matches("flag", "1") || matches("flag", "false") {
+		t.Error("bool field did not compare by value")
+	}
+
+	// The same through a JSON filter as the servers decode it
+	var raw map[string]any
+	if err := json.Unmarshal([]byte(`{"count": 5.0}`), &raw); err != nil {
+		t.Fatal(err)
+	}
+	filter, err := FilterFromJSON(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.CountWithFilter(filter) != 1 {
+		t.Errorf("JSON filter %v did not match", filter.Metadata)
+	}
+}
+
+func TestSchemaComparesTimesAcrossZones(t *testing.T) {
+	schema := &Schema{Fields: map[string]FieldSpec{"at": {Type: FieldTime}}}
+	if !schema.equal("at", "2024-01-01T00:00:00Z", "2024-01-01T13:00:00+13:00") {
+		t.Error("the same instant in two zones compared unequal")
+	}
+	if schema.equal("at", "2024-01-01T00:00:00Z", "2024-01-01T00:00:00+13:00") {
+		t.Error("different instants compared equal")
+	}
+	// Undeclared fields still compare as strings
+	if schema.equal("other", "1", "1.0") {
+		t.Error("undeclared field compared by value")
+	}
+}
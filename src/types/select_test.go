@@ -0,0 +1,103 @@
+package types
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"testing"
+)
+
+// topKSorted is what a search does with its candidates: select the k
+// best when there are more, then sort
+func topKSorted(s []ScoredNode, k int) []ScoredNode {
+	if len(s) > k {
+		selectTopK(s, k)
+		s = s[:k]
+	}
+	sort.Slice(s, func(i, j int) bool { return s[i].less(s[j]) })
+	return s
+}
+
+func TestSelectTopKMatchesFullSort(t *testing.T) {
+	rng := rand.New(rand.NewPCG(13, 14))
+	for trial := 0; trial < 500; trial++ {
+		n := rng.IntN(200)
+		// A handful of distances, so most candidates tie
+		levels := 1 + rng.IntN(8)
+		candidates := make([]ScoredNode, n)
+		for i, idx := range rng.Perm(n) {
+			candidates[i] = ScoredNode{Distance: float32(rng.IntN(levels)), index: int32(idx)}
+		}
+		if trial%10 == 0 {
+			slices.SortFunc(candidates, func(a, b ScoredNode) int { return -compareScored(a, b) })
+		}
+
+		naive := slices.Clone(candidates)
+		sort.Slice(naive, func(i, j int) bool { return naive[i].less(naive[j]) })
+		for _, k := range []int{1, 2, n / 3, n - 1, n, n + 5} {
+			if k <= 0 {
+				continue
+			}
+			want := naive[:min(k, n)]
+			if got := topKSorted(slices.Clone(candidates), k); !slices.EqualFunc(got, want, sameScored) {
+				t.Fatalf("trial %d: top %d of %d differs from the full sort", trial, k, n)
+			}
+		}
+	}
+}
+
+func sameScored(a, b ScoredNode) bool {
+	return a.Distance == b.Distance && a.index == b.index
+}
+
+func compareScored(a, b ScoredNode) int {
+	switch {
+	case a.less(b):
+		return -1
+	case b.less(a):
+		return 1
+	}
+	return 0
+}
+
+func TestSearchTopKBreaksTiesByPosition(t *testing.T) {
+	rng := rand.New(rand.NewPCG(15, 16))
+	tree := NewTree()
+	for i, key := range testKeys(rng, 400) {
+		if err := tree.Insert(key, fmt.Sprintf("node %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for q := 0; q < 10; q++ {
+		query := tree.Nodes[rng.IntN(len(tree.Nodes))].Key
+		naive := make([]ScoredNode, len(tree.Nodes))
+		for i, n := range tree.Nodes {
+			var sumSquares float32
+			for d := range query {
+				diff := query[d] - n.Key[d]
+				sumSquares += diff * diff
+			}
+			naive[i] = ScoredNode{Distance: float32(math.Sqrt(float64(sumSquares))), index: int32(i)}
+		}
+		sort.Slice(naive, func(i, j int) bool { return naive[i].less(naive[j]) })
+
+		for _, k := range []int{1, 5, 50, 500} {
+			results, _, err := tree.SearchOpts(query, SearchOptions{Epsilon: 3, MaxDistance: 1000, TopK: k})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := naive[:min(k, len(naive))]
+			if len(results) != len(want) {
+				t.Fatalf("top %d: %d results, want %d", k, len(results), len(want))
+			}
+			for i := range want {
+				if results[i].index != want[i].index || results[i].Distance != want[i].Distance {
+					t.Fatalf("top %d: result %d is node %d at %g, want node %d at %g", k, i, results[i].index, results[i].Distance, want[i].index, want[i].Distance)
+				}
+			}
+		}
+	}
+}
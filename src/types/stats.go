@@ -0,0 +1,231 @@
+package types
+
+import (
+	"math"
+	"sort"
+)
+
+// DimensionStats summarises the values of one embedding dimension
+type DimensionStats struct {
+	Dim    int     `json:"dim"`
+	Min    float32 `json:"min"`
+	Max    float32 `json:"max"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stddev"`
+}
+
+// NormStats describes the distribution of vector lengths. Titan embeddings are
+// normalized, so anything far from 1.0 points at bad input.
+type NormStats struct {
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Mean   float64 `json:"mean"`
+	P50    float64 `json:"p50"`
+	P95    float64 `json:"p95"`
+	Zeroed int     `json:"zeroed"`
+}
+
+type Stats struct {
+	Nodes                 int              `json:"nodes"`
+	Sampled               int              `json:"sampled"`
+	Dimensions            []DimensionStats `json:"dimensions"`
+	Norms                 NormStats        `json:"norms"`
+	Duplicates            int              `json:"duplicates"`
+	LargestDuplicateGroup int              `json:"largest_duplicate_group"`
+	Normalized            bool             `json:"normalized"`
+	Retention             *Retention       `json:"retention,omitempty"` // the cap recorded in the Config, if any
+	Access                AccessStats      `json:"access"`              // hit counters from tracked searches
+}
+
+// SampleIndices picks up to k evenly spaced indices out of n. Striding keeps
+// the result deterministic, so repeated runs over the same file agree.
+func SampleIndices(n, k int) []int {
+	if k <= 0 || k >= n {
+		k = n
+	}
+
+	indices := make([]int, k)
+	for i := range indices {
+		indices[i] = int(int64(i) * int64(n) / int64(k))
+	}
+	return indices
+}
+
+// ComputeStats reports per-dimension and norm statistics over at most
+// sampleSize nodes (0 means all). Duplicates are always counted over every node.
+func (t *Tree) ComputeStats(sampleSize int) Stats {
+	stats := Stats{
+		Nodes:      len(t.Nodes),
+		Dimensions: make([]DimensionStats, 512),
+		Normalized: t.Normalize,
+	}
+	if t.Config != nil {
+		stats.Retention = t.Config.Retention
+	}
+	stats.Access = t.AccessStats()
+
+	for dim := range stats.Dimensions {
+		stats.Dimensions[dim].Dim = dim
+	}
+
+	if len(t.Nodes) == 0 {
+		return stats
+	}
+
+	sample := SampleIndices(len(t.Nodes), sampleSize)
+	stats.Sampled = len(sample)
+
+	var sums, sumSquares [512]float64
+	norms := make([]float64, len(sample))
+
+	for i, nodeIdx := range sample {
+		key := &t.Nodes[nodeIdx].Key
+
+		var normSquared float64
+		for dim := 0; dim < 512; dim++ {
+			v := key[dim]
+			d := &stats.Dimensions[dim]
+			if i == 0 || v < d.Min {
+				d.Min = v
+			}
+			if i == 0 || v > d.Max {
+				d.Max = v
+			}
+			sums[dim] += float64(v)
+			sumSquares[dim] += float64(v) * float64(v)
+			normSquared += float64(v) * float64(v)
+		}
+		norms[i] = math.Sqrt(normSquared)
+	}
+
+	count := float64(len(sample))
+	for dim := 0; dim < 512; dim++ {
+		mean := sums[dim] / count
+		variance := sumSquares[dim]/count - mean*mean
+		if variance < 0 {
+			variance = 0
+		}
+		stats.Dimensions[dim].Mean = mean
+		stats.Dimensions[dim].StdDev = math.Sqrt(variance)
+	}
+
+	stats.Norms = normStats(norms)
+	stats.Duplicates, stats.LargestDuplicateGroup = t.CountDuplicateKeys()
+
+	return stats
+}
+
+func normStats(norms []float64) NormStats {
+	sorted := make([]float64, len(norms))
+	copy(sorted, norms)
+	sort.Float64s(sorted)
+
+	var ns NormStats
+	var sum float64
+	for _, n := range sorted {
+		sum += n
+		if n == 0 {
+			ns.Zeroed++
+		}
+	}
+
+	ns.Min = sorted[0]
+	ns.Max = sorted[len(sorted)-1]
+	ns.Mean = sum / float64(len(sorted))
+	ns.P50 = percentile(sorted, 0.50)
+	ns.P95 = percentile(sorted, 0.95)
+	return ns
+}
+
+// percentile expects sorted input
+func percentile(sorted []float64, p float64) float64 {
+	idx := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return sorted[idx]
+}
+
+// CountDuplicateKeys counts nodes whose key exactly matches an earlier
+// node's key, and the size of the largest group of identical keys (0 when
+// every key is distinct). A large group usually means an embedding bug
+// upstream, such as every text embedding to the same vector.
+func (t *Tree) CountDuplicateKeys() (duplicates, largestGroup int) {
+	groups := make(map[[512]float32]int, len(t.Nodes))
+	for i := range t.Nodes {
+		n := groups[t.Nodes[i].Key] + 1
+		groups[t.Nodes[i].Key] = n
+		if n > 1 {
+			duplicates++
+			largestGroup = max(largestGroup, n)
+		}
+	}
+	return duplicates, largestGroup
+}
+
+// TreeStats is a cheap summary of a loaded tree and the memory it holds.
+// Byte counts cover the data itself, not Go's slice and map headers, so
+// MetadataBytes in particular is an estimate.
+type TreeStats struct {
+	Nodes         int         `json:"nodes"`
+	Dimensions    int         `json:"dimensions"`
+	KeyBytes      int64       `json:"key_bytes"`
+	ValueBytes    int64       `json:"value_bytes"`
+	MetadataBytes int64       `json:"metadata_bytes"`
+	PayloadBytes  int64       `json:"payload_bytes"`
+	IndexBytes    int64       `json:"index_bytes"`
+	IndexDirty    bool        `json:"index_dirty"`
+	Normalized    bool        `json:"normalized"`
+	MinNorm       float64     `json:"min_norm"`
+	MaxNorm       float64     `json:"max_norm"`
+	MeanNorm      float64     `json:"mean_norm"`
+	Config        *Config     `json:"config,omitempty"`
+	Access        AccessStats `json:"access"`
+}
+
+// TotalBytes sums the byte counts
+func (s TreeStats) TotalBytes() int64 {
+	return s.KeyBytes + s.ValueBytes + s.MetadataBytes + s.PayloadBytes + s.IndexBytes
+}
+
+// Stats walks the nodes once, accumulating as it goes, so it allocates
+// nothing proportional to the tree. Use ComputeStats for distributions.
+func (t *Tree) Stats() TreeStats {
+	stats := TreeStats{
+		Nodes:      len(t.Nodes),
+		Dimensions: len(t.Index),
+		KeyBytes:   int64(len(t.Nodes)) * int64(len(t.Index)) * 4,
+		IndexDirty: t.indexStale(),
+		Normalized: t.Normalize,
+		Config:     t.Config,
+		Access:     t.AccessStats(),
+	}
+
+	for dim := range t.Index {
+		stats.IndexBytes += int64(cap(t.Index[dim]))*4 + int64(cap(t.columns[dim]))*4
+	}
+
+	var normSum float64
+	for i := range t.Nodes {
+		n := &t.Nodes[i]
+		stats.ValueBytes += int64(len(n.Value))
+		stats.PayloadBytes += int64(len(n.Payload))
+		for k, v := range n.Metadata {
+			stats.MetadataBytes += int64(len(k) + len(v))
+		}
+
+		norm := vectorNorm(&n.Key)
+		normSum += norm
+		if i == 0 || norm < stats.MinNorm {
+			stats.MinNorm = norm
+		}
+		if norm > stats.MaxNorm {
+			stats.MaxNorm = norm
+		}
+	}
+
+	if len(t.Nodes) > 0 {
+		stats.MeanNorm = normSum / float64(len(t.Nodes))
+	}
+	return stats
+}
@@ -0,0 +1,19 @@
+package types
+
+import "fmt"
+
+// SearchStream is SearchOpts that also hands emit every node inside the
+// distance cutoff as soon as it is scored, in index order rather than by
+// distance, so a caller can show results before the ranking is done. emit
+// returning false stops the search: the nodes scored so far are ranked and
+// returned, and the search reports itself cut short. Stages that need
+// every candidate before they can pick any (MMR, negative vectors,
+// GroupBy), Offset and MultiVector, which would emit a node once per
+// matching key, are rejected.
+func (t *Tree) SearchStream(query [512]float32, opts SearchOptions, emit func(Node, float32) bool) ([]ScoredNode, bool, error) {
+	if opts.rerank() || opts.GroupBy != "" || opts.Offset != 0 || opts.MultiVector {
+		return nil, false, fmt.Errorf("MMR, negative vectors, group-by, offset and multi-vector are not supported when streaming")
+	}
+	opts.emit = emit
+	return t.SearchOpts(query, opts)
+}
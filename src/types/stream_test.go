@@ -0,0 +1,83 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// nearTree holds n nodes just off the first axis, all inside one epsilon
+// box around it
+func nearTree(t *testing.T, n int) (*Tree, [512]float32) {
+	t.Helper()
+	tree := NewTree()
+	for i := 0; i < n; i++ {
+		var key [512]float32
+		key[0], key[1+i%511] = 1, 0.001*float32(1+i/511)
+		if err := tree.Insert(key, fmt.Sprintf("node %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var query [512]float32
+	query[0] = 1
+	return tree, query
+}
+
+func TestSearchStreamEmitsEveryHit(t *testing.T) {
+	tree, query := nearTree(t, 40)
+	opts := SearchOptions{Epsilon: 0.1, MaxDistance: 0.1, TopK: 5}
+
+	seen := make(map[string]bool)
+	results, truncated, err := tree.SearchStream(query, opts, func(n Node, distance float32) bool {
+		seen[n.Value] = true
+		return true
+	})
+	if err != nil || truncated {
+		t.Fatalf("truncated %v, error %v", truncated, err)
+	}
+	if len(seen) != 40 || len(results) != 5 {
+		t.Errorf("emitted %d hits and returned %d, want all 40 and the top 5", len(seen), len(results))
+	}
+
+	emitted := 0
+	results, truncated, _ = tree.SearchStream(query, opts, func(Node, float32) bool {
+		emitted++
+		return emitted < 3
+	})
+	if emitted != 3 || !truncated || len(results) != 3 {
+		t.Errorf("declining the third hit: emitted %d, truncated %v, %d results; want 3, true, 3", emitted, truncated, len(results))
+	}
+}
+
+func TestSearchStopsWhenDoneCloses(t *testing.T) {
+	tree, query := nearTree(t, 4*deadlineCheckInterval)
+	done := make(chan struct{})
+	opts := SearchOptions{Epsilon: 0.1, MaxDistance: 0.1, TopK: 5, Done: done}
+
+	// Done is checked every deadlineCheckInterval candidates, not only
+	// at hits
+	emitted := 0
+	_, truncated, err := tree.SearchStream(query, opts, func(Node, float32) bool {
+		if emitted++; emitted == 1 {
+			close(done)
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !truncated || emitted > deadlineCheckInterval {
+		t.Errorf("closing Done at the first hit: truncated %v after %d hits, want it to stop within %d", truncated, emitted, deadlineCheckInterval)
+	}
+
+	results, truncated, err := tree.SearchOpts(query, opts)
+	if err != nil || !truncated || len(results) != 0 {
+		t.Errorf("already closed Done: %d results, truncated %v, error %v; want none, truncated", len(results), truncated, err)
+	}
+
+	opts.FailOnLimit = true
+	if _, _, err := tree.SearchOpts(query, opts); !errors.Is(err, ErrSearchLimit) || !strings.Contains(err.Error(), "cancelled") {
+		t.Errorf("FailOnLimit with Done closed: error %v, want ErrSearchLimit saying it was cancelled", err)
+	}
+}
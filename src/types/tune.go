@@ -0,0 +1,111 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+)
+
+// DefaultSuggestQueries is how many stored vectors SuggestEpsilon samples
+// as pseudo-queries when it is given none
+const DefaultSuggestQueries = 200
+
+// minSuggestedEpsilon stands in for a zero epsilon, which radius tables
+// reject, when the neighbours are exact duplicates
+const minSuggestedEpsilon = 1e-6
+
+// SuggestEpsilon recommends an epsilon for each default radius word from
+// how this tree's vectors are spread. For every query it finds the exact
+// targetK nearest neighbours (ExactSearch) and the smallest epsilon whose
+// search box holds the nearest 1, targetK/2 and targetK of them (see
+// BoxDistance). Then:
+//
+//	identical  the median epsilon that captures the nearest neighbour
+//	similar    the median epsilon that captures targetK/2 neighbours
+//	related    the median epsilon that captures targetK neighbours
+//	distant    the epsilon that captures targetK neighbours for 90% of queries
+//
+// With no sampleQueries, up to DefaultSuggestQueries stored vectors are
+// sampled as pseudo-queries and each ignores itself, so the work is bounded
+// by the sample rather than the square of the tree. sampleQueries are
+// caller vectors, projected and normalized like search queries. The
+// epsilons only bound the search box; the threshold or MaxDistance still
+// applies on top. Nothing is stored; see Tree.Radii.
+func (t *Tree) SuggestEpsilon(sampleQueries [][]float32, targetK int) (map[string]float32, error) {
+	if targetK <= 0 {
+		return nil, fmt.Errorf("k must be positive, got %d", targetK)
+	}
+
+	queries := make([][512]float32, 0, len(sampleQueries))
+	var self []int // position of each pseudo-query in Nodes
+	if len(sampleQueries) > 0 {
+		for i, vec := range sampleQueries {
+			key, err := t.VectorKey(vec)
+			if err != nil {
+				return nil, fmt.Errorf("query %d: %w", i, err)
+			}
+			if key, err = t.PrepareKey(key); err != nil {
+				return nil, fmt.Errorf("query %d: %w", i, err)
+			}
+			queries = append(queries, key)
+		}
+		if len(t.Nodes) < targetK {
+			return nil, fmt.Errorf("k is %d but the tree has %d nodes", targetK, len(t.Nodes))
+		}
+	} else {
+		if len(t.Nodes) <= targetK {
+			return nil, fmt.Errorf("k is %d but the tree has %d nodes; sampling its own vectors needs more than k", targetK, len(t.Nodes))
+		}
+		for _, n := range t.Sample(DefaultSuggestQueries) {
+			queries = append(queries, n.Node.Key)
+			self = append(self, n.Index)
+		}
+	}
+
+	half := (targetK + 1) / 2
+	nearest := make([]float64, len(queries))
+	halfway := make([]float64, len(queries))
+	all := make([]float64, len(queries))
+	for q := range queries {
+		fetch := targetK
+		if self != nil {
+			fetch++
+		}
+
+		var need float32
+		captured := 0
+		for _, hit := range t.ExactSearch(queries[q], fetch) {
+			if self != nil && int(hit.index) == self[q] {
+				continue
+			}
+			if captured == targetK {
+				break
+			}
+			need = max(need, BoxDistance(&queries[q], &hit.Node.Key))
+			captured++
+			if captured == 1 {
+				nearest[q] = float64(need)
+			}
+			if captured == half {
+				halfway[q] = float64(need)
+			}
+		}
+		all[q] = float64(need)
+	}
+
+	sort.Float64s(nearest)
+	sort.Float64s(halfway)
+	sort.Float64s(all)
+
+	suggested := map[string]float32{
+		"identical": float32(percentile(nearest, 0.5)),
+		"similar":   float32(percentile(halfway, 0.5)),
+		"related":   float32(percentile(all, 0.5)),
+		"distant":   float32(percentile(all, 0.9)),
+	}
+	for word, epsilon := range suggested {
+		if epsilon < minSuggestedEpsilon {
+			suggested[word] = minSuggestedEpsilon
+		}
+	}
+	return suggested, nil
+}
@@ -1,151 +1,800 @@
 package types
 
 import (
+	"cmp"
+	"log"
 	"math"
+	"runtime"
+	"slices"
 	"sort"
+	"sync"
+	"time"
 )
 
 type Node struct {
 	Key   [512]float32
 	Value string
+	Metadata map[string]string // nil when the node has none
+	Payload []byte // Opaque caller data, never searched
+	AltKeys [][512]float32 // Further keys for the same memory, see multivector.go; nil for most nodes
 }
 
 type Tree struct {
 	Nodes []Node
 	Index [512][]int32
-	indexDirty bool // Track if indices need rebuilding
+	indexBuilt bool // Index covers Nodes; set by RebuildIndex, cleared when inserts can't keep it current
+	keywords *keywordIndex // Built on first HybridSearch
+	alt []altRef // Alternate keys in the index, see multivector.go
+	Normalize bool // L2-normalize keys on insert and queries on search; persisted in the file header
+	Radii map[string]float32 // Radius words calibrated for this database (see radius.go); persisted in the file header
+	Projection *Projection // Applied by the client to incoming vectors (see projection.go); persisted in the file header
+	Schema *Schema // Declared metadata fields checked on insert (see schema.go); persisted in the file header
+	Config *Config // Embedding model and settings the tree was created with (see config.go); persisted in the file header
+	ZeroVectors ZeroVectorPolicy // What inserts do with all-zero keys (see normalize.go); not persisted
+	SanitizeNonFinite bool // Inserts replace NaN and ±Inf key values with 0 instead of failing (see validate.go); not persisted
+	accesses map[int32]*access // Hits not yet written into metadata, by node position (see access.go)
+	DisablePrefilter bool // Score every candidate in the epsilon box instead of rejecting some by norm first (see prefilter.go); not persisted
+	prefilter prefilter // Per-node norms and projections, built with the index
+
+	// columnStore keeps columns[dim][i] == Nodes[Index[dim][i]].Key[dim] so
+	// the per-dimension binary searches read contiguous floats instead of
+	// chasing into a node per comparison. Off by default: it doubles the
+	// memory used by keys.
+	columnStore bool
+	columns     [512][]float32
 }
 
 func NewTree() *Tree {
 	return &Tree{
 		Nodes: make([]Node, 0, 1000), // Preallocate for 1000 nodes
 		Index: [512][]int32{},
-		indexDirty: false,
 	}
 }
 
-func (t *Tree) Insert(key [512]float32, value string) {
-	nodeIdx := int32(len(t.Nodes))
-	node := Node{
+func (t *Tree) Insert(key [512]float32, value string) error {
+	return t.InsertWithMetadata(key, value, nil)
+}
+
+// InsertWithMetadata stores a node. A key with a NaN or infinite component
+// is rejected with an *InvalidValueError unless SanitizeNonFinite is set,
+// and metadata that breaks the tree's Schema with a *SchemaError.
+func (t *Tree) InsertWithMetadata(key [512]float32, value string, metadata map[string]string) error {
+	return t.InsertWithPayload(key, value, metadata, nil)
+}
+
+// InsertWithTimestamp is InsertWithMetadata recording ts, or now when ts is
+// zero, under TimestampKey, so a historical import keeps when each memory
+// happened and Filter.Since and Until find it. metadata is not modified.
+func (t *Tree) InsertWithTimestamp(key [512]float32, value string, metadata map[string]string, ts time.Time) error {
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	return t.InsertWithMetadata(key, value, WithTimestamp(metadata, ts))
+}
+
+func (t *Tree) InsertWithPayload(key [512]float32, value string, metadata map[string]string, payload []byte) error {
+	if err := t.checkKey(&key); err != nil {
+		return err
+	}
+	if err := t.Schema.Check(metadata); err != nil {
+		return err
+	}
+
+	t.insertNode(Node{
 		Key:   key,
 		Value: value,
+		Metadata: metadata,
+		Payload: payload,
+	})
+	return nil
+}
+
+// insertNode appends node, normalizing its primary key if the tree does, and
+// indexes every one of its keys
+func (t *Tree) insertNode(node Node) {
+	if t.ZeroVectors == ZeroVectorWarn && isZeroVector(&node.Key) {
+		log.Printf("hippocampus: node %d has an all-zero key", len(t.Nodes))
+	}
+	if t.Normalize {
+		NormalizeVector(&node.Key)
 	}
+
+	// Only extend an index that covers every vector so far; anything else
+	// waits for the rebuild on the next search
+	incremental := t.indexBuilt && len(t.Index[0]) == t.vectorCount()
+
+	nodeIdx := int32(len(t.Nodes))
 	t.Nodes = append(t.Nodes, node)
 
-	// If indices exist, update them incrementally
-	if len(t.Index[0]) > 0 && !t.indexDirty {
-		for dim := 0; dim < 512; dim++ {
-			insertPos := sort.Search(len(t.Index[dim]), func(i int) bool {
-				return t.Nodes[t.Index[dim][i]].Key[dim] >= key[dim]
-			})
-			t.Index[dim] = append(t.Index[dim], 0)
-			copy(t.Index[dim][insertPos+1:], t.Index[dim][insertPos:])
-			t.Index[dim][insertPos] = nodeIdx
+	if t.keywords != nil {
+		t.keywords.add(nodeIdx, node.Value)
+	}
+
+	if incremental {
+		t.indexVector(nodeIdx)
+		t.addPrefilter(nodeIdx)
+		for k := range node.AltKeys {
+			t.alt = append(t.alt, altRef{node: nodeIdx, key: int32(k)})
+			t.indexVector(-int32(len(t.alt)))
 		}
 	} else {
-		// Mark indices as dirty - will rebuild on next search
-		t.indexDirty = true
+		t.indexBuilt = false
 	}
 }
 
+// indexVector inserts vector id into every dimension's index, after the
+// equal values that order before it (see indexOrder)
+func (t *Tree) indexVector(id int32) {
+	key := t.keyAt(id)
+	order := indexOrder(id)
+	for dim := 0; dim < 512; dim++ {
+		insertPos := t.searchDimension(dim, key[dim], false)
+		if end := t.searchDimension(dim, key[dim], true); end > insertPos {
+			// A run of equal values, e.g. duplicate keys: keep it in
+			// vector order so the index matches what RebuildIndex builds
+			index := t.Index[dim]
+			insertPos += sort.Search(end-insertPos, func(i int) bool {
+				return indexOrder(index[insertPos+i]) > order
+			})
+		}
+		t.Index[dim] = append(t.Index[dim], 0)
+		copy(t.Index[dim][insertPos+1:], t.Index[dim][insertPos:])
+		t.Index[dim][insertPos] = id
+
+		if col := t.columns[dim]; col != nil {
+			col = append(col, 0)
+			copy(col[insertPos+1:], col[insertPos:])
+			col[insertPos] = key[dim]
+			t.columns[dim] = col
+		}
+	}
+}
+
+// RebuildIndex sorts every dimension's index. Dimensions are independent, so
+// they are spread across NumCPU workers; each worker copies the dimension's
+// values into a contiguous scratch slice before sorting so comparisons don't
+// chase into a different node per element. Index slices are reused when
+// they are large enough.
 func (t *Tree) RebuildIndex() {
-	nodeCount := len(t.Nodes)
+	t.rebuildAlt()
+	vectorCount := t.vectorCount()
+
+	workers := runtime.NumCPU()
+	if workers > 512 {
+		workers = 512
+	}
+
+	dims := make(chan int, 512)
 	for dim := 0; dim < 512; dim++ {
-		t.Index[dim] = make([]int32, nodeCount)
-		for i := 0; i < nodeCount; i++ {
-			t.Index[dim][i] = int32(i)
+		dims <- dim
+	}
+	close(dims)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			scratch := make([]indexEntry, vectorCount)
+			for dim := range dims {
+				t.rebuildDimension(dim, scratch)
+			}
+		}()
+	}
+	wg.Wait()
+	t.buildPrefilter()
+
+	t.indexBuilt = true
+}
+
+type indexEntry struct {
+	value float32
+	node  int32
+}
+
+// indexOrder breaks ties between equal values in a dimension's index:
+// primary keys by node position, then alternate keys in the order they were
+// added. Without it the unstable sort leaves runs of duplicate keys in
+// arbitrary order, and the index would differ from one rebuild to the next.
+func indexOrder(id int32) int64 {
+	if id >= 0 {
+		return int64(id)
+	}
+	return math.MaxInt32 + int64(-id)
+}
+
+func (t *Tree) rebuildDimension(dim int, scratch []indexEntry) {
+	for i := range t.Nodes {
+		scratch[i] = indexEntry{value: t.Nodes[i].Key[dim], node: int32(i)}
+	}
+	for j, ref := range t.alt {
+		scratch[len(t.Nodes)+j] = indexEntry{value: t.Nodes[ref.node].AltKeys[ref.key][dim], node: -int32(j) - 1}
+	}
+	slices.SortFunc(scratch, func(a, b indexEntry) int {
+		if c := cmp.Compare(a.value, b.value); c != 0 {
+			return c
 		}
-		sort.Slice(t.Index[dim], func(i, j int) bool {
-			return t.Nodes[t.Index[dim][i]].Key[dim] < t.Nodes[t.Index[dim][j]].Key[dim]
-		})
+		return cmp.Compare(indexOrder(a.node), indexOrder(b.node))
+	})
+
+	index := t.Index[dim]
+	if cap(index) >= len(scratch) {
+		index = index[:len(scratch)]
+	} else {
+		index = make([]int32, len(scratch))
 	}
-	t.indexDirty = false
+	for i := range scratch {
+		index[i] = scratch[i].node
+	}
+	t.Index[dim] = index
+
+	if !t.columnStore {
+		t.columns[dim] = nil
+		return
+	}
+
+	col := t.columns[dim]
+	if cap(col) >= len(scratch) {
+		col = col[:len(scratch)]
+	} else {
+		col = make([]float32, len(scratch))
+	}
+	for i := range scratch {
+		col[i] = scratch[i].value
+	}
+	t.columns[dim] = col
+}
+
+// EnableColumnStore turns the sorted column copy of keys on or off. It is
+// built by the next RebuildIndex (or right away if the index is current).
+func (t *Tree) EnableColumnStore(enabled bool) {
+	t.columnStore = enabled
+	if !enabled {
+		t.columns = [512][]float32{}
+		return
+	}
+	if t.indexBuilt && len(t.Index[0]) == t.vectorCount() && len(t.Nodes) > 0 {
+		t.RebuildIndex()
+	}
+}
+
+// searchDimension returns the first position in Index[dim] whose value is
+// >= v (or > v when after is set), reading the column copy when there is one
+func (t *Tree) searchDimension(dim int, v float32, after bool) int {
+	if col := t.columns[dim]; col != nil {
+		if after {
+			return sort.Search(len(col), func(i int) bool { return col[i] > v })
+		}
+		return sort.Search(len(col), func(i int) bool { return col[i] >= v })
+	}
+
+	index := t.Index[dim]
+	if len(t.alt) > 0 {
+		if after {
+			return sort.Search(len(index), func(i int) bool { return t.keyAt(index[i])[dim] > v })
+		}
+		return sort.Search(len(index), func(i int) bool { return t.keyAt(index[i])[dim] >= v })
+	}
+	if after {
+		return sort.Search(len(index), func(i int) bool { return t.Nodes[index[i]].Key[dim] > v })
+	}
+	return sort.Search(len(index), func(i int) bool { return t.Nodes[index[i]].Key[dim] >= v })
+}
+
+// EnsureIndex builds the index now if the next search would have to, and
+// reports whether it did
+func (t *Tree) EnsureIndex() bool {
+	if !t.indexStale() {
+		return false
+	}
+	t.RebuildIndex()
+	return true
 }
 
 // ensureIndex ensures indices are built before search
 func (t *Tree) ensureIndex() {
-	if t.indexDirty || len(t.Index[0]) == 0 {
-		t.RebuildIndex()
+	t.EnsureIndex()
+}
+
+// indexStale reports whether the index must be rebuilt before a search. The
+// length check catches Nodes changed directly rather than through Insert.
+func (t *Tree) indexStale() bool {
+	return !t.indexBuilt || len(t.Index[0]) != t.vectorCount()
+}
+
+// ScoredNode is a search hit together with its Euclidean distance to the query
+type ScoredNode struct {
+	Node      Node
+	Distance  float32
+	Score     float32 // Re-ranking score, set only by the SearchOptions stages
+	Group     string  // GroupBy value, set only by SearchOptions.GroupBy
+	Collapsed int     // Lower-ranked results of the same group that were dropped
+	index     int32   // Position in Tree.Nodes, breaks distance ties
+}
+
+func (s ScoredNode) less(other ScoredNode) bool {
+	if s.Distance != other.Distance {
+		return s.Distance < other.Distance
+	}
+	return s.index < other.index
+}
+
+// Similarity converts a Euclidean distance into cosine similarity.
+// Only meaningful for unit-length vectors (Titan embeddings are normalized).
+func Similarity(distance float32) float32 {
+	return 1 - distance*distance/2
+}
+
+// ScoreDistance is the inverse of Similarity: the largest distance between
+// unit-length vectors whose cosine similarity is still at least score
+func ScoreDistance(score float32) float32 {
+	if score >= 1 {
+		return 0
 	}
+	return float32(math.Sqrt(2 * (1 - float64(max(score, -1)))))
 }
 
 func (t *Tree) Search(query [512]float32, epsilon float32, threshold float32, topK int) []Node {
-	if len(t.Nodes) == 0 {
+	scored := t.SearchScored(query, epsilon, threshold, topK)
+	if scored == nil {
 		return nil
 	}
 
+	results := make([]Node, len(scored))
+	for i := range scored {
+		results[i] = scored[i].Node
+	}
+
+	return results
+}
+
+// LegacyMaxDistance is the distance cutoff Search derives from epsilon and
+// threshold: epsilon * sqrt(512) * (1 - threshold). It scales with epsilon,
+// so threshold alone says little about how close results are; set
+// SearchOptions.MaxDistance to choose the cutoff explicitly.
+func LegacyMaxDistance(epsilon float32, threshold float32) float32 {
+	return epsilon * float32(math.Sqrt(512)) * (1.0 - threshold)
+}
+
+// SearchScored is Search but keeps the distance of every result
+func (t *Tree) SearchScored(query [512]float32, epsilon float32, threshold float32, topK int) []ScoredNode {
+	results, _ := t.searchScored(query, epsilon, LegacyMaxDistance(epsilon, threshold), topK, nil)
+	return results
+}
+
+// searchScored collects nodes inside the epsilon box and keeps those within
+// maxAllowedDistance that match opts.Filter, weighting and masking
+// dimensions as opts says (nil opts is plain search). It reports whether
+// opts.MaxCandidates, opts.Deadline or opts.Done stopped it before every
+// candidate was scored.
+func (t *Tree) searchScored(query [512]float32, epsilon float32, maxAllowedDistance float32, topK int, opts *SearchOptions) ([]ScoredNode, bool) {
+	if len(t.Nodes) == 0 {
+		return nil, false
+	}
+
+	if t.Normalize {
+		NormalizeVector(&query)
+	}
+
 	// Ensure indices are built
 	t.ensureIndex()
 
-	// Preallocate candidate set with estimated size
-	candidateSet := make(map[int32]int, len(t.Nodes)/10)
+	// A node is a candidate only if it falls inside the epsilon range of
+	// every dimension, or of opts.MinDimMatches of them. Measure each range
+	// with the two binary searches and intersect narrowest first: the first
+	// ranges bound the candidate set and each later one can only shrink it.
+	// The counters, candidate lists
+	// and ranges come from a pool so a busy server doesn't allocate them on
+	// every query; concurrent searches each get their own.
+	scratch := getSearchScratch(t.vectorCount())
+	defer searchScratchPool.Put(scratch)
 
+	var filter *Filter
+	multiVector := false
+	var weightBuf [512]float32
+	var weights *[512]float32 // nil unless dimensions are weighted or masked
+	maxCandidates := 0
+	var deadline time.Time
+	var done <-chan struct{}
+	var emit func(Node, float32) bool
+	var tally *CandidateCounts
+	// explain guards every report update, so a search that isn't
+	// explained pays one branch per candidate
+	var report *ExplainReport
+	explain := false
+	minMatches := 0
+	if opts != nil {
+		filter = opts.Filter
+		multiVector = opts.MultiVector
+		if opts.dimWeights(&weightBuf) {
+			weights = &weightBuf
+		}
+		maxCandidates = opts.MaxCandidates
+		deadline = opts.Deadline
+		done = opts.Done
+		emit = opts.emit
+		tally = opts.counts
+		report = opts.Explanation
+		explain = report != nil
+		minMatches = opts.MinDimMatches
+	}
+	bound, prefiltered := t.prefilterFor(&query, maxAllowedDistance, weights != nil)
+
+	// Only unit keys turn a distance into a cosine, so on a tree that
+	// doesn't normalize them MinScore is checked against each candidate's
+	// true cosine. A normalized tree still keeps zero keys, at distance 1
+	// from every query, but they have no direction to score.
+	var minScore float32
+	var queryNorm float64
+	skipZero := false
+	if opts != nil && opts.MinScore > 0 {
+		if t.Normalize {
+			skipZero = true
+		} else {
+			minScore = opts.MinScore
+			queryNorm = weightedNorm(&query, weights)
+		}
+	}
+	if explain {
+		*report = ExplainReport{Vectors: t.vectorCount(), Epsilon: epsilon, MaxDistance: maxAllowedDistance}
+	}
+
+	ranges := scratch.ranges[:0]
 	for dim := 0; dim < 512; dim++ {
-		minVal := query[dim] - epsilon
-		maxVal := query[dim] + epsilon
+		// A weight w scales the dimension's distance by sqrt(w), so its
+		// half of the box shrinks to epsilon/sqrt(w); a dimension with no
+		// weight puts no constraint on candidates
+		radius := epsilon
+		if weights != nil {
+			w := weights[dim]
+			if w == 0 {
+				continue
+			}
+			if w != 1 {
+				radius = epsilon / float32(math.Sqrt(float64(w)))
+			}
+		}
 
-		startIdx := sort.Search(len(t.Index[dim]), func(i int) bool {
-			return t.Nodes[t.Index[dim][i]].Key[dim] >= minVal
+		minVal := query[dim] - radius
+		maxVal := query[dim] + radius
+		ranges = append(ranges, dimRange{
+			dim:    int32(dim),
+			start:  int32(t.searchDimension(dim, minVal, false)),
+			end:    int32(t.searchDimension(dim, maxVal, true)),
+			minVal: minVal,
+			maxVal: maxVal,
 		})
+	}
+	slices.SortFunc(ranges, func(a, b dimRange) int {
+		return cmp.Compare(a.end-a.start, b.end-b.start)
+	})
+	scratch.ranges = ranges
 
-		endIdx := sort.Search(len(t.Index[dim]), func(i int) bool {
-			return t.Nodes[t.Index[dim][i]].Key[dim] > maxVal
-		})
+	// misses is how many ranges a candidate may fall outside of
+	misses := 0
+	if minMatches > 0 && minMatches < len(ranges) {
+		misses = len(ranges) - minMatches
+	}
+	if explain {
+		report.MinDimMatches = len(ranges) - misses
+		report.Dimensions = make([]DimensionCandidates, len(ranges))
+		for i, r := range ranges {
+			report.Dimensions[i] = DimensionCandidates{Dim: int(r.dim), Candidates: int(r.end - r.start)}
+		}
+	}
+
+	// counts[n] is how many of the ranges processed so far node n was
+	// inside. A node outside more than misses ranges can't be a candidate,
+	// so it must be in one of the first misses+1: only nodes there ever get
+	// a count, and the ones that drop out are reset as they go, so the
+	// counters end the query all zero.
+	counts := scratch.counts
+	alive := scratch.touched[:0]
 
-		for i := startIdx; i < endIdx; i++ {
-			nodeIdx := t.Index[dim][i]
-			candidateSet[nodeIdx]++
+	for _, r := range ranges[:misses+1] {
+		for i := r.start; i < r.end; i++ {
+			id := t.Index[r.dim][i]
+			slot := t.slot(id)
+			if counts[slot] == 0 {
+				alive = append(alive, id)
+			}
+			counts[slot]++
 		}
 	}
 
-	type scoredNode struct {
-		node     Node
-		distance float32
+	step := misses + 1
+	for ; step < len(ranges) && len(alive) > 0; step++ {
+		r := ranges[step]
+
+		// Walking a range costs its width, checking the survivors directly
+		// costs one key read each. Ranges only get wider, so once checking
+		// is cheaper it stays cheaper for the rest. Past the deadline the
+		// scoring loop checks the rest instead, and stops early itself.
+		if int(r.end-r.start) >= len(alive) {
+			break
+		}
+		if stopped(deadline, done) {
+			break
+		}
+
+		for i := r.start; i < r.end; i++ {
+			slot := t.slot(t.Index[r.dim][i])
+			if counts[slot] > 0 {
+				counts[slot]++
+			}
+		}
+
+		kept := alive[:0]
+		for _, id := range alive {
+			if slot := t.slot(id); int(counts[slot])+misses > step {
+				kept = append(kept, id)
+			} else {
+				counts[slot] = 0
+			}
+		}
+		alive = kept
 	}
+	if explain {
+		report.Intersected = step
+	}
+
+	// Scored candidates carry only distance and position; the node is
+	// copied in once the topK are known
+	candidates := scratch.candidates[:0]
+
+	// truncated stops the scoring once maxCandidates nodes in the box have
+	// been scored or, checked every deadlineCheckInterval of them, the
+	// deadline has passed or Done has closed
+	truncated := false
+	scored := 0
+	for _, id := range alive {
+		slot := t.slot(id)
+		missed := step - int(counts[slot])
+		counts[slot] = 0 // leave the counters zeroed for the next query
+		if truncated {
+			continue
+		}
+
+		// Alternate keys only count in multi-vector searches
+		if id < 0 && !multiVector {
+			continue
+		}
+		nodeIdx := t.owner(id)
+
+		// The stored norms are contiguous, so this costs less than the
+		// key read it saves. Explaining scores everything, to find the
+		// closest node the cutoff drops.
+		if prefiltered && !explain && id >= 0 && t.rejects(&bound, id) {
+			if tally != nil {
+				tally.Prefiltered++
+			}
+			continue
+		}
 
-	// Preallocate candidates slice
-	candidates := make([]scoredNode, 0, topK*2)
-	maxAllowedDistance := epsilon * float32(math.Sqrt(512)) * (1.0 - threshold)
+		key := t.keyAt(id)
+		if !inRanges(key, ranges[step:], misses-missed) {
+			continue
+		}
+		if explain {
+			report.InBox++
+		}
+		if filter != nil && !filter.MatchesSchema(&t.Nodes[nodeIdx], t.Schema) {
+			if explain {
+				report.Filtered++
+			}
+			continue
+		}
+		if explain && prefiltered && id >= 0 && t.rejects(&bound, id) {
+			report.Prefiltered++
+		}
+
+		if maxCandidates > 0 && scored == maxCandidates {
+			truncated = true
+			continue
+		}
+		if scored%deadlineCheckInterval == 0 && stopped(deadline, done) {
+			truncated = true
+			continue
+		}
+		scored++
+		if tally != nil {
+			tally.Scored++
+		}
 
-	for nodeIdx, count := range candidateSet {
-		if count == 512 {
-			var sumSquares float32
+		var sumSquares float32
+		if weights == nil {
 			for dim := 0; dim < 512; dim++ {
-				diff := query[dim] - t.Nodes[nodeIdx].Key[dim]
+				diff := query[dim] - key[dim]
 				sumSquares += diff * diff
 			}
-			distance := float32(math.Sqrt(float64(sumSquares)))
+		} else {
+			for dim := 0; dim < 512; dim++ {
+				diff := query[dim] - key[dim]
+				sumSquares += weights[dim] * diff * diff
+			}
+		}
+		distance := float32(math.Sqrt(float64(sumSquares)))
 
-			if distance <= maxAllowedDistance {
-				candidates = append(candidates, scoredNode{
-					node:     t.Nodes[nodeIdx],
-					distance: distance,
-				})
+		if skipZero && isZeroVector(key) {
+			continue
+		}
+		if distance <= maxAllowedDistance && (minScore == 0 || cosine(&query, key, queryNorm, weights) >= minScore) {
+			candidates = append(candidates, ScoredNode{
+				Distance: distance,
+				index:    nodeIdx,
+			})
+			if emit != nil && !emit(t.Nodes[nodeIdx], distance) {
+				truncated = true
 			}
+		} else if explain {
+			report.reject(&t.Nodes[nodeIdx], distance)
 		}
 	}
+	if explain {
+		report.Scored = scored
+		report.WithinRange = len(candidates)
+		report.Truncated = truncated
+	}
+
+	scratch.touched = alive
 
-	// Sort only if we have more results than needed
+	// A node matched through several of its keys is scored by the closest
+	if multiVector && len(t.alt) > 0 {
+		candidates = dedupeOwners(candidates)
+	}
+	scratch.candidates = candidates
+
+	// Move the best topK to the front without sorting the rest, then sort
+	// just those. Ties break on node position, a total order, so the result
+	// is exactly what a full sort would give and pages with an Offset never
+	// overlap.
 	if len(candidates) > topK {
-		sort.Slice(candidates, func(i, j int) bool {
-			return candidates[i].distance < candidates[j].distance
-		})
-	} else if len(candidates) > 1 {
-		// For small result sets, still sort
-		sort.Slice(candidates, func(i, j int) bool {
-			return candidates[i].distance < candidates[j].distance
-		})
+		selectTopK(candidates, topK)
+		candidates = candidates[:topK]
 	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].less(candidates[j])
+	})
 
-	limit := topK
-	if len(candidates) < topK {
-		limit = len(candidates)
+	results := make([]ScoredNode, len(candidates))
+	for i, c := range candidates {
+		results[i] = ScoredNode{
+			Node:     t.Nodes[c.index],
+			Distance: c.Distance,
+			index:    c.index,
+		}
 	}
 
-	results := make([]Node, limit)
-	for i := 0; i < limit; i++ {
-		results[i] = candidates[i].node
+	return results, truncated
+}
+
+// weightedNorm is the length of v with each dimension's square scaled by
+// weights, or the plain L2 length when weights is nil
+func weightedNorm(v *[512]float32, weights *[512]float32) float64 {
+	if weights == nil {
+		return vectorNorm(v)
+	}
+	var sumSquares float64
+	for dim := 0; dim < 512; dim++ {
+		sumSquares += float64(weights[dim]) * float64(v[dim]) * float64(v[dim])
 	}
+	return math.Sqrt(sumSquares)
+}
 
-	return results
+// cosine is the cosine similarity of query and key under the same
+// weighting as weightedNorm, given query's norm. A zero vector has no
+// direction, so it scores 0.
+func cosine(query, key *[512]float32, queryNorm float64, weights *[512]float32) float32 {
+	keyNorm := weightedNorm(key, weights)
+	if queryNorm == 0 || keyNorm == 0 {
+		return 0
+	}
+	var dot float64
+	for dim := 0; dim < 512; dim++ {
+		product := float64(query[dim]) * float64(key[dim])
+		if weights != nil {
+			product *= float64(weights[dim])
+		}
+		dot += product
+	}
+	return float32(dot / (queryNorm * keyNorm))
+}
+
+// deadlineCheckInterval is how many candidates searchScored scores between
+// looks at the clock
+const deadlineCheckInterval = 256
+
+// stopped reports whether deadline has passed or done has closed, either of
+// which ends a search early
+func stopped(deadline time.Time, done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+	}
+	return !deadline.IsZero() && !time.Now().Before(deadline)
+}
+
+// searchScratch is the per-query working memory of searchScored
+type searchScratch struct {
+	counts     []uint16 // per indexed vector (see Tree.slot); always all zero between queries
+	touched    []int32
+	candidates []ScoredNode
+	ranges     []dimRange
+}
+
+// dimRange is the slice of Index[dim] holding values in [minVal, maxVal]
+type dimRange struct {
+	dim, start, end int32
+	minVal, maxVal  float32
+}
+
+// inRanges reports whether key lies inside every range but at most misses
+// of them, the same test as membership in the range's slice of the index
+func inRanges(key *[512]float32, ranges []dimRange, misses int) bool {
+	for _, r := range ranges {
+		if v := key[r.dim]; !(v >= r.minVal && v <= r.maxVal) {
+			if misses == 0 {
+				return false
+			}
+			misses--
+		}
+	}
+	return true
+}
+
+var searchScratchPool = sync.Pool{
+	New: func() any { return new(searchScratch) },
+}
+
+func getSearchScratch(nodeCount int) *searchScratch {
+	s := searchScratchPool.Get().(*searchScratch)
+	if cap(s.counts) < nodeCount {
+		s.counts = make([]uint16, nodeCount)
+	}
+	s.counts = s.counts[:nodeCount]
+	return s
+}
+
+// selectTopK partially orders s so that its first k elements are the k
+// smallest (in any order), quickselect style with a median-of-three pivot
+func selectTopK(s []ScoredNode, k int) {
+	lo, hi := 0, len(s)-1
+	for lo < hi {
+		p := partition(s, lo, hi)
+		switch {
+		case p == k-1 || p == k:
+			return
+		case p < k:
+			lo = p + 1
+		default:
+			hi = p - 1
+		}
+	}
+}
+
+// partition orders s[lo..hi] around a pivot and returns its final position
+func partition(s []ScoredNode, lo, hi int) int {
+	mid := lo + (hi-lo)/2
+	if s[mid].less(s[lo]) {
+		s[mid], s[lo] = s[lo], s[mid]
+	}
+	if s[hi].less(s[lo]) {
+		s[hi], s[lo] = s[lo], s[hi]
+	}
+	if s[mid].less(s[hi]) {
+		s[mid], s[hi] = s[hi], s[mid]
+	}
+	// s[hi] now holds the median of the three
+	pivot := s[hi]
+
+	store := lo
+	for i := lo; i < hi; i++ {
+		if s[i].less(pivot) {
+			s[i], s[store] = s[store], s[i]
+			store++
+		}
+	}
+	s[store], s[hi] = s[hi], s[store]
+	return store
 }
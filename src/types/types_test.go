@@ -0,0 +1,155 @@
+package types
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+// testKeys returns n keys whose values come from a handful of levels, so
+// every dimension has long runs of equal values, with every fifth key a
+// copy of an earlier one
+func testKeys(rng *rand.Rand, n int) [][512]float32 {
+	levels := []float32{-1, -0.5, 0, 0.25, 0.5, 1}
+	keys := make([][512]float32, n)
+	for i := range keys {
+		if i%5 == 4 {
+			keys[i] = keys[rng.IntN(i)]
+			continue
+		}
+		for d := range keys[i] {
+			keys[i][d] = levels[rng.IntN(len(levels))]
+		}
+	}
+	return keys
+}
+
+// insertKeys inserts keys one at a time, every third with an alternate key
+func insertKeys(t *testing.T, tree *Tree, keys [][512]float32, prefix string) {
+	t.Helper()
+	for i, key := range keys {
+		value := fmt.Sprintf("%s %d", prefix, i)
+		metadata := map[string]string{"batch": prefix}
+		var err error
+		if i%3 == 0 {
+			err = tree.InsertMulti([][512]float32{key, keys[len(keys)-1-i]}, value, metadata)
+		} else {
+			err = tree.InsertWithMetadata(key, value, metadata)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// checkIncrementalIndex fails unless tree's index was kept current by its
+// inserts and matches what RebuildIndex builds from the same nodes
+func checkIncrementalIndex(t *testing.T, tree *Tree) {
+	t.Helper()
+	if tree.indexStale() {
+		t.Fatal("inserts did not keep the index current")
+	}
+
+	var index [512][]int32
+	var columnValues [512][]float32
+	for dim := range tree.Index {
+		index[dim] = slices.Clone(tree.Index[dim])
+		columnValues[dim] = slices.Clone(tree.columns[dim])
+	}
+	alt := slices.Clone(tree.alt)
+	norms := slices.Clone(tree.prefilter.norms)
+
+	tree.RebuildIndex()
+
+	for dim := range tree.Index {
+		if !slices.Equal(index[dim], tree.Index[dim]) {
+			t.Fatalf("dimension %d: incremental index %v, rebuilt %v", dim, index[dim], tree.Index[dim])
+		}
+		if !slices.Equal(columnValues[dim], tree.columns[dim]) {
+			t.Fatalf("dimension %d: incremental columns differ from rebuilt", dim)
+		}
+	}
+	if !slices.Equal(alt, tree.alt) {
+		t.Fatalf("incremental alternate keys %v, rebuilt %v", alt, tree.alt)
+	}
+	if !slices.Equal(norms, tree.prefilter.norms) {
+		t.Fatal("incremental prefilter norms differ from rebuilt")
+	}
+}
+
+// loadedTree builds a tree the way storage loads one: nodes decoded
+// straight into Nodes, then a single RebuildIndex
+func loadedTree(t *testing.T, rng *rand.Rand) *Tree {
+	t.Helper()
+	source := NewTree()
+	insertKeys(t, source, testKeys(rng, 60), "stored")
+
+	tree := NewTree()
+	tree.Nodes = append(tree.Nodes, source.Nodes...)
+	tree.RebuildIndex()
+	return tree
+}
+
+func TestIncrementalIndexMatchesRebuild(t *testing.T) {
+	t.Run("fresh tree", func(t *testing.T) {
+		rng := rand.New(rand.NewPCG(1, 1))
+		tree := NewTree()
+		// A search on the empty tree builds an empty index for the
+		// inserts to extend
+		tree.EnsureIndex()
+		insertKeys(t, tree, testKeys(rng, 80), "fresh")
+		checkIncrementalIndex(t, tree)
+	})
+
+	t.Run("after load", func(t *testing.T) {
+		rng := rand.New(rand.NewPCG(2, 2))
+		tree := loadedTree(t, rng)
+		insertKeys(t, tree, testKeys(rng, 40), "new")
+		checkIncrementalIndex(t, tree)
+	})
+
+	t.Run("after batch insert", func(t *testing.T) {
+		rng := rand.New(rand.NewPCG(3, 3))
+		tree := loadedTree(t, rng)
+		tree.Normalize = true
+		tree.EnableColumnStore(true)
+
+		// What client.BatchInsert does under its lock: every key checked
+		// first, then all inserted together
+		keys := testKeys(rng, 50)
+		for i := range keys {
+			key, err := tree.PrepareInsertKey(keys[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			keys[i] = key
+		}
+		for i, key := range keys {
+			if err := tree.InsertWithPayload(key, fmt.Sprintf("batch %d", i), nil, []byte{byte(i)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		checkIncrementalIndex(t, tree)
+	})
+
+	t.Run("after delete", func(t *testing.T) {
+		rng := rand.New(rand.NewPCG(4, 4))
+		tree := loadedTree(t, rng)
+		insertKeys(t, tree, testKeys(rng, 30), "doomed")
+
+		if deleted := tree.DeleteWhere(&Filter{Metadata: map[string]string{"batch": "doomed"}}); deleted != 30 {
+			t.Fatalf("deleted %d nodes, want 30", deleted)
+		}
+		// The delete leaves the index stale; inserts before the next
+		// search must not extend it
+		insertKeys(t, tree, testKeys(rng, 5), "early")
+		if !tree.indexStale() {
+			t.Fatal("index extended after a delete")
+		}
+
+		tree.EnsureIndex()
+		insertKeys(t, tree, testKeys(rng, 40), "late")
+		checkIncrementalIndex(t, tree)
+	})
+}
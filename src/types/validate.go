@@ -0,0 +1,105 @@
+package types
+
+import (
+	"fmt"
+	"math"
+)
+
+// InvalidValueError reports a NaN or infinite key component. Distances
+// involving such a key are NaN, so the node would never match and would
+// leave sorts undefined.
+type InvalidValueError struct {
+	Dim   int
+	Value float32
+}
+
+func (e *InvalidValueError) Error() string {
+	return fmt.Sprintf("key dimension %d is %v", e.Dim, e.Value)
+}
+
+// ValidateKey returns an *InvalidValueError for the first non-finite
+// component of key
+func ValidateKey(key *[512]float32) error {
+	for dim := 0; dim < 512; dim++ {
+		if v := float64(key[dim]); math.IsNaN(v) || math.IsInf(v, 0) {
+			return &InvalidValueError{Dim: dim, Value: key[dim]}
+		}
+	}
+	return nil
+}
+
+// SanitizeKey replaces every non-finite component of key with 0 and
+// returns how many it replaced
+func SanitizeKey(key *[512]float32) int {
+	replaced := 0
+	for dim := 0; dim < 512; dim++ {
+		if v := float64(key[dim]); math.IsNaN(v) || math.IsInf(v, 0) {
+			key[dim] = 0
+			replaced++
+		}
+	}
+	return replaced
+}
+
+// checkKey validates key for insert, or sanitizes it when the tree is set to
+func (t *Tree) checkKey(key *[512]float32) error {
+	if t.SanitizeNonFinite {
+		SanitizeKey(key)
+		return nil
+	}
+	return ValidateKey(key)
+}
+
+// InvalidNode is a stored node with a non-finite key component
+type InvalidNode struct {
+	Index  int     `json:"index"`
+	AltKey int     `json:"alt_key"` // -1 for the primary key, else the AltKeys position
+	Dim    int     `json:"dim"`
+	Value  float32 `json:"-"`     // NaN and ±Inf have no JSON encoding...
+	Kind   string  `json:"value"` // ...so JSON carries "NaN", "+Inf" or "-Inf"
+	Text   string  `json:"text"`
+}
+
+// FindInvalidNodes lists every node whose key, or one of whose alternate
+// keys, has a NaN or infinite component, reporting the first bad dimension
+// of each such key. Databases written before inserts were validated can
+// hold them.
+func (t *Tree) FindInvalidNodes() []InvalidNode {
+	var invalid []InvalidNode
+	for i := range t.Nodes {
+		invalid = appendInvalid(invalid, i, &t.Nodes[i])
+	}
+	return invalid
+}
+
+// appendInvalid adds n's bad keys to invalid; i is n's position
+func appendInvalid(invalid []InvalidNode, i int, n *Node) []InvalidNode {
+	check := func(alt int, key *[512]float32) {
+		if err, ok := ValidateKey(key).(*InvalidValueError); ok {
+			invalid = append(invalid, InvalidNode{Index: i, AltKey: alt, Dim: err.Dim, Value: err.Value, Kind: fmt.Sprint(err.Value), Text: n.Value})
+		}
+	}
+	check(-1, &n.Key)
+	for k := range n.AltKeys {
+		check(k, &n.AltKeys[k])
+	}
+	return invalid
+}
+
+// InvalidScanner collects invalid nodes from a stream, for databases
+// scanned from disk rather than loaded
+type InvalidScanner struct {
+	seen    int
+	Invalid []InvalidNode
+}
+
+// Add checks the next node of the stream
+func (s *InvalidScanner) Add(n *Node) {
+	s.Invalid = appendInvalid(s.Invalid, s.seen, n)
+	s.seen++
+}
+
+// Seen is how many nodes have been checked
+func (s *InvalidScanner) Seen() int {
+	return s.seen
+}
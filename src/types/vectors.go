@@ -0,0 +1,56 @@
+package types
+
+import "fmt"
+
+// MeanVector is the element-wise mean of vectors, the centroid of a set of
+// examples. The vectors must all have the same number of dimensions.
+func MeanVector(vectors [][]float32) ([]float32, error) {
+	sum, err := sumVectors(vectors, nil, 1)
+	if err != nil {
+		return nil, err
+	}
+	for dim := range sum {
+		sum[dim] /= float32(len(vectors))
+	}
+	return sum, nil
+}
+
+// CombineVectors is the sum of positive minus the sum of negative, so
+// positive {A, C} and negative {B} give the analogy query A - B + C. With no
+// negatives it points the same way as MeanVector. The result is not
+// normalized; at least one positive vector is required.
+func CombineVectors(positive, negative [][]float32) ([]float32, error) {
+	sum, err := sumVectors(positive, nil, 1)
+	if err != nil {
+		return nil, fmt.Errorf("positive %w", err)
+	}
+	if sum, err = sumVectors(negative, sum, -1); err != nil {
+		return nil, fmt.Errorf("negative %w", err)
+	}
+	return sum, nil
+}
+
+// sumVectors adds sign times each of vectors to sum, checking every vector
+// has sum's width. A nil sum starts a new one as wide as vectors[0], which
+// must exist.
+func sumVectors(vectors [][]float32, sum []float32, sign float32) ([]float32, error) {
+	if sum == nil {
+		if len(vectors) == 0 {
+			return nil, fmt.Errorf("vectors: none given")
+		}
+		if len(vectors[0]) == 0 {
+			return nil, fmt.Errorf("vector 0 has no dimensions")
+		}
+		sum = make([]float32, len(vectors[0]))
+	}
+
+	for i, vec := range vectors {
+		if len(vec) != len(sum) {
+			return nil, fmt.Errorf("vector %d has %d dimensions, expected %d", i, len(vec), len(sum))
+		}
+		for dim, value := range vec {
+			sum[dim] += sign * value
+		}
+	}
+	return sum, nil
+}
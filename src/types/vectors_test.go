@@ -0,0 +1,71 @@
+package types
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMeanVector(t *testing.T) {
+	mean, err := MeanVector([][]float32{{1, 0, 4}, {3, 2, -4}, {2, 1, 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []float32{2, 1, 1}; !slices.Equal(mean, want) {
+		t.Errorf("mean %v, want %v", mean, want)
+	}
+
+	single := []float32{0.5, -0.5}
+	mean, err = MeanVector([][]float32{single})
+	if err != nil || !slices.Equal(mean, single) {
+		t.Errorf("mean of one vector %v (%v), want it unchanged", mean, err)
+	}
+	if mean[0] = 9; single[0] != 0.5 {
+		t.Error("mean shares memory with its input")
+	}
+}
+
+func TestCombineVectors(t *testing.T) {
+	a, b, c := []float32{1, 0, 0}, []float32{0, 1, 0}, []float32{0, 0, 1}
+	analogy, err := CombineVectors([][]float32{a, c}, [][]float32{b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []float32{1, -1, 1}; !slices.Equal(analogy, want) {
+		t.Errorf("a - b + c = %v, want %v", analogy, want)
+	}
+
+	// Without negatives it is the mean scaled by the count
+	sum, err := CombineVectors([][]float32{{1, 2}, {3, 6}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(sum, []float32{4, 8}) {
+		t.Errorf("sum %v, want [4 8]", sum)
+	}
+}
+
+func TestVectorDimensionValidation(t *testing.T) {
+	cases := []struct {
+		name               string
+		positive, negative [][]float32
+		want               string
+	}{
+		{"no positives", nil, [][]float32{{1}}, "positive vectors: none given"},
+		{"empty vector", [][]float32{{}}, nil, "vector 0 has no dimensions"},
+		{"positive widths", [][]float32{{1, 2}, {1, 2, 3}}, nil, "positive vector 1 has 3 dimensions, expected 2"},
+		{"negative widths", [][]float32{{1, 2}}, [][]float32{{1, 2}, {1}}, "negative vector 1 has 1 dimensions, expected 2"},
+	}
+	for _, tc := range cases {
+		if _, err := CombineVectors(tc.positive, tc.negative); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: %v, want %q", tc.name, err, tc.want)
+		}
+	}
+
+	if _, err := MeanVector(nil); err == nil {
+		t.Error("mean of no vectors succeeded")
+	}
+	if _, err := MeanVector([][]float32{{1, 2}, {3}}); err == nil {
+		t.Error("mean of mismatched vectors succeeded")
+	}
+}
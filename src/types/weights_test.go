@@ -0,0 +1,131 @@
+package types
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestAllOnesWeightsMatchUnweighted(t *testing.T) {
+	rng := rand.New(rand.NewPCG(21, 22))
+	tree := NewTree()
+	for i, key := range testKeys(rng, 300) {
+		if err := tree.Insert(key, fmt.Sprintf("node %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ones := make([]float32, 512)
+	for d := range ones {
+		ones[d] = 1
+	}
+
+	for q := 0; q < 10; q++ {
+		query := tree.Nodes[rng.IntN(len(tree.Nodes))].Key
+		opts := SearchOptions{Epsilon: 1, MaxDistance: 20, TopK: 25}
+		plain, _, err := tree.SearchOpts(query, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts.DimWeights = ones
+		opts.DimMask = make([]bool, 512)
+		weighted, _, err := tree.SearchOpts(query, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		same := slices.EqualFunc(plain, weighted, func(a, b ScoredNode) bool {
+			return a.Node.Value == b.Node.Value && math.Float32bits(a.Distance) == math.Float32bits(b.Distance)
+		})
+		if len(plain) == 0 || !same {
+			t.Fatalf("query %d: all-ones weights returned %d results, unweighted %d, or they differ", q, len(weighted), len(plain))
+		}
+	}
+}
+
+func TestDimMaskChangesRanking(t *testing.T) {
+	tree := NewTree()
+	var query, far0, spread [512]float32
+	// far0 is off the query only in dimension 0, spread a little in four
+	far0[0] = 0.9
+	for d := 1; d <= 4; d++ {
+		spread[d] = 0.3
+	}
+	if err := tree.Insert(far0, "far in dimension 0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.Insert(spread, "spread over four"); err != nil {
+		t.Fatal(err)
+	}
+
+	search := func(opts SearchOptions) []string {
+		t.Helper()
+		results, _, err := tree.SearchOpts(query, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var found []string
+		for _, r := range results {
+			found = append(found, fmt.Sprintf("%s %.2f", r.Node.Value, r.Distance))
+		}
+		return found
+	}
+
+	wide := SearchOptions{Epsilon: 1, MaxDistance: 10, TopK: 2}
+	if got := search(wide); !slices.Equal(got, []string{"spread over four 0.60", "far in dimension 0 0.90"}) {
+		t.Errorf("unmasked: %v", got)
+	}
+	mask := make([]bool, 512)
+	mask[0] = true
+	masked := wide
+	masked.DimMask = mask
+	if got := search(masked); !slices.Equal(got, []string{"far in dimension 0 0.00", "spread over four 0.60"}) {
+		t.Errorf("dimension 0 masked: %v", got)
+	}
+
+	// A masked dimension puts no constraint on candidates either: in a box
+	// of 0.5 far0 is only found once dimension 0 is ignored
+	narrow := SearchOptions{Epsilon: 0.5, MaxDistance: 10, TopK: 2}
+	if got := search(narrow); !slices.Equal(got, []string{"spread over four 0.60"}) {
+		t.Errorf("narrow box: %v", got)
+	}
+	narrow.DimMask = mask
+	if got := search(narrow); !slices.Equal(got, []string{"far in dimension 0 0.00", "spread over four 0.60"}) {
+		t.Errorf("narrow box, dimension 0 masked: %v", got)
+	}
+
+	// Weight 4 doubles a dimension's contribution and halves its box
+	weights := make([]float32, 512)
+	for d := range weights {
+		weights[d] = 1
+	}
+	weights[0] = 4
+	weighted := wide
+	weighted.Epsilon = 2
+	weighted.DimWeights = weights
+	if got := search(weighted); !slices.Equal(got, []string{"spread over four 0.60", "far in dimension 0 1.80"}) {
+		t.Errorf("dimension 0 weighted 4: %v", got)
+	}
+	weighted.Epsilon = 1
+	if got := search(weighted); !slices.Equal(got, []string{"spread over four 0.60"}) {
+		t.Errorf("dimension 0 weighted 4 in a box of 1: %v", got)
+	}
+}
+
+func TestDimWeightsValidation(t *testing.T) {
+	bad := map[string]SearchOptions{
+		"short weights":   {DimWeights: make([]float32, 511)},
+		"short mask":      {DimMask: make([]bool, 513)},
+		"negative weight": {DimWeights: append(make([]float32, 511), -1)},
+		"nan weight":      {DimWeights: append(make([]float32, 511), float32(math.NaN()))},
+		"all zero":        {DimWeights: make([]float32, 512)},
+		"all masked":      {DimMask: slices.Repeat([]bool{true}, 512)},
+	}
+	for name, opts := range bad {
+		opts.Epsilon, opts.TopK = 1, 1
+		if err := opts.Validate(); err == nil {
+			t.Errorf("%s accepted", name)
+		}
+	}
+}
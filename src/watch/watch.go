@@ -0,0 +1,338 @@
+// Package watch keeps a database in step with a directory of text files.
+// Each file is stored as a chunked document (see Client.InsertDocument)
+// whose ID is its slash-separated path relative to the directory, with a
+// hash of its contents on every chunk. The database itself is the sync
+// state: a file is re-embedded when its hash differs from the stored one,
+// and documents carrying a hash whose file is gone are deleted.
+package watch
+
+import (
+	"Hippocampus/src/client"
+	"Hippocampus/src/embedding"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// SourceHashKey is the metadata key holding the SHA-256 of the file a
+// chunk came from. Only documents with it are managed by the watcher, so
+// memories inserted by other means are never deleted.
+const SourceHashKey = "source_hash"
+
+// DefaultExtensions are the files synced when Options.Extensions is empty
+var DefaultExtensions = []string{".md", ".markdown", ".txt"}
+
+const (
+	DefaultDebounce = 500 * time.Millisecond
+
+	// readAttempts bounds how often a file that keeps changing while it is
+	// read is retried before the sync gives up on it until the next one
+	readAttempts = 3
+)
+
+// ErrFileChanging is returned for a file that was modified while being read
+var ErrFileChanging = errors.New("file changed while it was read")
+
+type Options struct {
+	Extensions []string // file extensions to sync, with the dot
+	Chunk      embedding.ChunkOptions
+	Debounce   time.Duration // quiet period after a change before syncing
+	Logger     *log.Logger   // nil uses the standard logger
+}
+
+// SyncResult counts what one pass over the directory did
+type SyncResult struct {
+	Added     int `json:"added"`
+	Updated   int `json:"updated"`
+	Deleted   int `json:"deleted"`
+	Unchanged int `json:"unchanged"`
+	Failed    int `json:"failed"` // left as they were; retried on the next sync
+}
+
+func (r SyncResult) String() string {
+	return fmt.Sprintf("%d added, %d updated, %d deleted, %d unchanged, %d failed",
+		r.Added, r.Updated, r.Deleted, r.Unchanged, r.Failed)
+}
+
+type Watcher struct {
+	client *client.Client
+	dir    string
+	opts   Options
+	log    *log.Logger
+}
+
+func New(c *client.Client, dir string, opts Options) (*Watcher, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	if len(opts.Extensions) == 0 {
+		opts.Extensions = DefaultExtensions
+	}
+	if opts.Chunk == (embedding.ChunkOptions{}) {
+		opts.Chunk = embedding.DefaultChunkOptions()
+	}
+	if err := opts.Chunk.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.Debounce <= 0 {
+		opts.Debounce = DefaultDebounce
+	}
+
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	return &Watcher{client: c, dir: dir, opts: opts, log: logger}, nil
+}
+
+// Sync makes one pass over the directory: new and modified files are
+// embedded, and documents whose files were removed are deleted. A file
+// that fails to read or embed is logged and counted in Failed; its stored
+// chunks and hash are left alone so the next sync tries again. The error
+// is for failures that stop the whole pass.
+func (w *Watcher) Sync() (SyncResult, error) {
+	var result SyncResult
+
+	stored, err := w.client.DocumentMetadata(SourceHashKey)
+	if err != nil {
+		return result, err
+	}
+
+	seen := make(map[string]bool)
+	err = filepath.WalkDir(w.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// A file removed mid-walk is picked up as deleted below
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if path != w.dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !w.wanted(path) {
+			return nil
+		}
+
+		docID, err := w.docID(path)
+		if err != nil {
+			return err
+		}
+		seen[docID] = true
+
+		text, err := readStable(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			delete(seen, docID)
+			return nil
+		}
+		if err != nil {
+			w.log.Printf("Skipping %s: %v", docID, err)
+			result.Failed++
+			return nil
+		}
+
+		hash := contentHash(text)
+		previous, known := stored[docID]
+		if known && previous == hash {
+			result.Unchanged++
+			return nil
+		}
+
+		if len(bytes.TrimSpace(text)) == 0 {
+			// Nothing to embed; drop whatever an earlier version stored
+			if known {
+				if _, err := w.client.DeleteDocument(docID); err != nil {
+					w.log.Printf("Failed to delete %s: %v", docID, err)
+					result.Failed++
+					return nil
+				}
+				result.Deleted++
+			}
+			return nil
+		}
+
+		metadata := map[string]string{SourceHashKey: hash}
+		chunks, err := w.client.ReplaceDocument(docID, string(text), metadata, nil, w.opts.Chunk)
+		if err != nil {
+			w.log.Printf("Failed to index %s: %v", docID, err)
+			result.Failed++
+			return nil
+		}
+
+		if known {
+			result.Updated++
+			w.log.Printf("Updated %s (%d chunks)", docID, chunks)
+		} else {
+			result.Added++
+			w.log.Printf("Added %s (%d chunks)", docID, chunks)
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	for docID := range stored {
+		if seen[docID] {
+			continue
+		}
+		if _, err := w.client.DeleteDocument(docID); err != nil {
+			w.log.Printf("Failed to delete %s: %v", docID, err)
+			result.Failed++
+			continue
+		}
+		result.Deleted++
+		w.log.Printf("Deleted %s", docID)
+	}
+
+	return result, nil
+}
+
+// Run syncs once, then watches the directory tree and syncs again after
+// each burst of changes has been quiet for Options.Debounce. It returns
+// when ctx is cancelled.
+func (w *Watcher) Run(ctx context.Context) error {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer fsw.Close()
+
+	// Watch before the first sync so nothing written during it is missed
+	if err := w.addDirs(fsw, w.dir); err != nil {
+		return err
+	}
+
+	w.sync()
+
+	timer := time.NewTimer(w.opts.Debounce)
+	timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event, ok := <-fsw.Events:
+			if !ok {
+				return nil
+			}
+			// fsnotify does not recurse, so new subdirectories are added
+			// as they appear
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := w.addDirs(fsw, event.Name); err != nil {
+						w.log.Printf("Failed to watch %s: %v", event.Name, err)
+					}
+				}
+			}
+			if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+				continue
+			}
+			timer.Reset(w.opts.Debounce)
+
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return nil
+			}
+			// Usually an event queue overflow: a full sync catches up
+			w.log.Printf("Watch error: %v", err)
+			timer.Reset(w.opts.Debounce)
+
+		case <-timer.C:
+			w.sync()
+		}
+	}
+}
+
+func (w *Watcher) sync() {
+	result, err := w.Sync()
+	if err != nil {
+		w.log.Printf("Sync failed: %v", err)
+		return
+	}
+	w.log.Printf("Synced %s: %s", w.dir, result)
+}
+
+// addDirs watches root and every non-hidden directory below it
+func (w *Watcher) addDirs(fsw *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != w.dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		return fsw.Add(path)
+	})
+}
+
+func (w *Watcher) wanted(path string) bool {
+	return slices.Contains(w.opts.Extensions, strings.ToLower(filepath.Ext(path)))
+}
+
+func (w *Watcher) docID(path string) (string, error) {
+	rel, err := filepath.Rel(w.dir, path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// readStable reads a file and checks its size and modification time did
+// not move while it was read, retrying a few times for an editor that is
+// still saving
+func readStable(path string) ([]byte, error) {
+	for attempt := 0; attempt < readAttempts; attempt++ {
+		before, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		after, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if before.Size() == after.Size() && before.ModTime().Equal(after.ModTime()) && int64(len(data)) == after.Size() {
+			return data, nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return nil, ErrFileChanging
+}
+
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
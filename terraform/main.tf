@@ -403,9 +403,10 @@ resource "aws_lambda_function" "hippocampus" {
 
   environment {
     variables = {
-      S3_BUCKET     = aws_s3_bucket.hippocampus_data.bucket
-      EFS_PATH      = "/mnt/efs/agents"
-      LAMBDA_SECRET = aws_secretsmanager_secret.lambda_url.arn
+      S3_BUCKET            = aws_s3_bucket.hippocampus_data.bucket
+      EFS_PATH             = "/mnt/efs/agents"
+      LAMBDA_SECRET        = aws_secretsmanager_secret.lambda_url.arn
+      CORS_ALLOWED_ORIGINS = var.cors_allowed_origins
     }
   }
 
@@ -467,6 +468,42 @@ resource "aws_apigatewayv2_route" "agent_curate" {
   target    = "integrations/${aws_apigatewayv2_integration.lambda_integration.id}"
 }
 
+resource "aws_apigatewayv2_route" "preflight" {
+  api_id    = aws_apigatewayv2_api.hippocampus_api.id
+  route_key = "OPTIONS /{proxy+}"
+  target    = "integrations/${aws_apigatewayv2_integration.lambda_integration.id}"
+}
+
+resource "aws_apigatewayv2_route" "list_agents" {
+  api_id    = aws_apigatewayv2_api.hippocampus_api.id
+  route_key = "GET /agents"
+  target    = "integrations/${aws_apigatewayv2_integration.lambda_integration.id}"
+}
+
+resource "aws_apigatewayv2_route" "agent_delete" {
+  api_id    = aws_apigatewayv2_api.hippocampus_api.id
+  route_key = "POST /agent-delete"
+  target    = "integrations/${aws_apigatewayv2_integration.lambda_integration.id}"
+}
+
+resource "aws_apigatewayv2_route" "flush" {
+  api_id    = aws_apigatewayv2_api.hippocampus_api.id
+  route_key = "POST /flush"
+  target    = "integrations/${aws_apigatewayv2_integration.lambda_integration.id}"
+}
+
+resource "aws_apigatewayv2_route" "conversation" {
+  api_id    = aws_apigatewayv2_api.hippocampus_api.id
+  route_key = "POST /conversation"
+  target    = "integrations/${aws_apigatewayv2_integration.lambda_integration.id}"
+}
+
+resource "aws_apigatewayv2_route" "config" {
+  api_id    = aws_apigatewayv2_api.hippocampus_api.id
+  route_key = "GET /config"
+  target    = "integrations/${aws_apigatewayv2_integration.lambda_integration.id}"
+}
+
 resource "aws_lambda_permission" "api_gateway" {
   statement_id  = "AllowAPIGatewayInvoke"
   action        = "lambda:InvokeFunction"
@@ -14,3 +14,9 @@ variable "memcached_node_type" {
   type        = string
   default     = "cache.t3.micro"
 }
+
+variable "cors_allowed_origins" {
+  description = "Comma-separated browser origins allowed to call the API (empty denies all, * allows any)"
+  type        = string
+  default     = ""
+}